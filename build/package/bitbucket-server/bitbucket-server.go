@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/launchdarkly/ld-find-code-refs/coderefs"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	o "github.com/launchdarkly/ld-find-code-refs/options"
+)
+
+func main() {
+	log.Init(false)
+	dir := os.Getenv("bamboo_build_working_directory")
+	opts, err := o.GetWrapperOptions(dir, mergeBitbucketServerOptions)
+	if err != nil {
+		log.Error.Fatal(err)
+	}
+	levels, _ := opts.LogLevels()
+	log.InitFormat(levels, opts.ConsoleFormat)
+	coderefs.Scan(opts)
+}
+
+// mergeBitbucketServerOptions sets inferred options from the environment of a Bamboo build of a Bitbucket Server or Data
+// Center repository
+func mergeBitbucketServerOptions(opts o.Options) (o.Options, error) {
+	log.Info.Printf("Setting Bitbucket Server env vars")
+	cloneUrl := os.Getenv("bamboo_planRepository_repositoryUrl")
+	if opts.RepoName == "" {
+		opts.RepoName = strings.TrimSuffix(path.Base(cloneUrl), ".git")
+	}
+	opts.RepoType = "bitbucketServer"
+	if opts.RepoUrl == "" {
+		if u, err := url.Parse(cloneUrl); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+			// the clone url is converted to the url of the repository by the scanner
+			opts.RepoUrl = cloneUrl
+		} else if cloneUrl != "" {
+			log.Warning.Printf("unable to generate source code links from repository url %q: set repoUrl to the http url of the repository", cloneUrl)
+		}
+	}
+	if opts.Branch == "" {
+		opts.Branch = os.Getenv("bamboo_planRepository_branchName")
+	}
+	updateSequenceId, err := strconv.Atoi(os.Getenv("bamboo_buildNumber"))
+	if err != nil {
+		updateSequenceId = -1
+	}
+	opts.UpdateSequenceId = updateSequenceId
+	return opts, opts.Validate()
+}
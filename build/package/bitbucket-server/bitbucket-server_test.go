@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	o "github.com/launchdarkly/ld-find-code-refs/options"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	log.Init(true)
+	os.Exit(m.Run())
+}
+
+func TestMergeBitbucketServerOptions_withCliOptions(t *testing.T) {
+	os.Setenv("bamboo_planRepository_repositoryUrl", "https://bitbucket.example.com/scm/proj/myapp-vue.git")
+	os.Setenv("bamboo_planRepository_branchName", "feature")
+	os.Setenv("bamboo_buildNumber", "100")
+	var options o.Options = o.Options{
+		AccessToken: "deaf-beef",
+		ProjKey:     "project-x",
+		RepoName:    "myapp-react",
+		RepoUrl:     "https://bitbucket.example.com/projects/PROJ/repos/myapp-react",
+		Branch:      "main",
+	}
+
+	result, _ := mergeBitbucketServerOptions(options)
+
+	assert.Equal(t, "myapp-react", result.RepoName)
+	assert.Equal(t, "bitbucketServer", result.RepoType)
+	assert.Equal(t, "https://bitbucket.example.com/projects/PROJ/repos/myapp-react", result.RepoUrl)
+	assert.Equal(t, "main", result.Branch)
+	assert.Equal(t, 100, result.UpdateSequenceId)
+}
+
+func TestMergeBitbucketServerOptions_withBambooEnv(t *testing.T) {
+	os.Setenv("bamboo_planRepository_repositoryUrl", "https://bitbucket.example.com/scm/proj/myapp-vue.git")
+	os.Setenv("bamboo_planRepository_branchName", "feature")
+	os.Setenv("bamboo_buildNumber", "200")
+	var options o.Options = o.Options{
+		AccessToken: "deaf-beef",
+		ProjKey:     "project-x",
+	}
+
+	result, _ := mergeBitbucketServerOptions(options)
+
+	assert.Equal(t, "myapp-vue", result.RepoName)
+	assert.Equal(t, "bitbucketServer", result.RepoType)
+	assert.Equal(t, "https://bitbucket.example.com/scm/proj/myapp-vue.git", result.RepoUrl)
+	assert.Equal(t, "feature", result.Branch)
+	assert.Equal(t, 200, result.UpdateSequenceId)
+}
+
+func TestMergeBitbucketServerOptions_withSshUrl(t *testing.T) {
+	os.Setenv("bamboo_planRepository_repositoryUrl", "ssh://git@bitbucket.example.com:7999/proj/myapp-vue.git")
+	os.Setenv("bamboo_buildNumber", "")
+	var options o.Options = o.Options{
+		AccessToken: "deaf-beef",
+		ProjKey:     "project-x",
+	}
+
+	result, _ := mergeBitbucketServerOptions(options)
+
+	assert.Equal(t, "myapp-vue", result.RepoName)
+	assert.Equal(t, "", result.RepoUrl)
+	assert.Equal(t, -1, result.UpdateSequenceId)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/launchdarkly/ld-find-code-refs/coderefs"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	o "github.com/launchdarkly/ld-find-code-refs/options"
+)
+
+func main() {
+	log.Init(false)
+	dir := os.Getenv("CODEBUILD_SRC_DIR")
+	opts, err := o.GetWrapperOptions(dir, mergeCodeBuildOptions)
+	if err != nil {
+		log.Error.Fatal(err)
+	}
+	levels, _ := opts.LogLevels()
+	log.InitFormat(levels, opts.ConsoleFormat)
+	coderefs.Scan(opts)
+}
+
+// mergeCodeBuildOptions sets inferred options from the AWS CodeBuild environment, when available
+func mergeCodeBuildOptions(opts o.Options) (o.Options, error) {
+	log.Info.Printf("Setting AWS CodeBuild env vars")
+	repoUrl := os.Getenv("CODEBUILD_SOURCE_REPO_URL")
+	if opts.RepoName == "" {
+		opts.RepoName = strings.TrimSuffix(path.Base(repoUrl), ".git")
+	}
+	if opts.Branch == "" {
+		opts.Branch = parseBranch(os.Getenv("CODEBUILD_WEBHOOK_HEAD_REF"), os.Getenv("CODEBUILD_SOURCE_VERSION"))
+	}
+
+	u, err := url.Parse(repoUrl)
+	switch {
+	case err != nil || repoUrl == "":
+		// the repository url is unknown, so source code links are not generated
+	case strings.HasPrefix(u.Hostname(), "git-codecommit."):
+		setCodeCommitOptions(&opts, opts.RepoName, codeCommitRegion(u.Hostname()))
+	case u.Hostname() == "github.com":
+		opts.RepoType = "github"
+		opts.RepoUrl = strings.TrimSuffix(repoUrl, ".git")
+	case u.Hostname() == "bitbucket.org":
+		opts.RepoType = "bitbucket"
+		opts.RepoUrl = strings.TrimSuffix(repoUrl, ".git")
+	}
+
+	updateSequenceId, err := strconv.Atoi(os.Getenv("CODEBUILD_BUILD_NUMBER"))
+	if err != nil {
+		updateSequenceId = -1
+	}
+	opts.UpdateSequenceId = updateSequenceId
+	return opts, opts.Validate()
+}
+
+// parseBranch returns the branch which triggered a build. Webhook builds provide the head ref of the event. Otherwise, the
+// source version is a branch only if the build was started for a branch, rather than a commit or pull request.
+func parseBranch(webhookHeadRef, sourceVersion string) string {
+	if webhookHeadRef != "" {
+		return strings.TrimPrefix(webhookHeadRef, "refs/heads/")
+	}
+	if strings.HasPrefix(sourceVersion, "refs/heads/") {
+		return strings.TrimPrefix(sourceVersion, "refs/heads/")
+	}
+	return ""
+}
+
+// codeCommitRegion returns the AWS region of a CodeCommit git host, e.g. git-codecommit.us-east-1.amazonaws.com
+func codeCommitRegion(host string) string {
+	parts := strings.Split(host, ".")
+	if len(parts) > 1 {
+		return parts[1]
+	}
+	return os.Getenv("AWS_REGION")
+}
+
+// setCodeCommitOptions configures links to a CodeCommit repository in the AWS console. LaunchDarkly does not generate links
+// to CodeCommit, so url templates are provided unless they were configured.
+func setCodeCommitOptions(opts *o.Options, repoName, region string) {
+	consoleUrl := fmt.Sprintf("https://%s.console.aws.amazon.com/codesuite/codecommit/repositories/%s", region, repoName)
+	opts.RepoType = "custom"
+	if opts.RepoUrl == "" {
+		opts.RepoUrl = fmt.Sprintf("%s/browse?region=%s", consoleUrl, region)
+	}
+	if opts.CommitUrlTemplate == "" {
+		opts.CommitUrlTemplate = fmt.Sprintf("%s/commit/${sha}?region=%s", consoleUrl, region)
+	}
+	if opts.HunkUrlTemplate == "" {
+		opts.HunkUrlTemplate = fmt.Sprintf("%s/browse/${sha}/--/${filePath}?region=%s&lines=${lineNumber}-${lineNumber}", consoleUrl, region)
+	}
+}
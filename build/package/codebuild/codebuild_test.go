@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	o "github.com/launchdarkly/ld-find-code-refs/options"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	log.Init(true)
+	os.Exit(m.Run())
+}
+
+func TestMergeCodeBuildOptions_withCodeCommit(t *testing.T) {
+	os.Setenv("CODEBUILD_SOURCE_REPO_URL", "https://git-codecommit.us-west-2.amazonaws.com/v1/repos/myapp-react")
+	os.Setenv("CODEBUILD_SOURCE_VERSION", "refs/heads/main")
+	os.Setenv("CODEBUILD_WEBHOOK_HEAD_REF", "")
+	os.Setenv("CODEBUILD_BUILD_NUMBER", "100")
+	var options o.Options = o.Options{
+		AccessToken: "deaf-beef",
+		ProjKey:     "project-x",
+	}
+
+	result, _ := mergeCodeBuildOptions(options)
+
+	consoleUrl := "https://us-west-2.console.aws.amazon.com/codesuite/codecommit/repositories/myapp-react"
+	assert.Equal(t, "myapp-react", result.RepoName)
+	assert.Equal(t, "custom", result.RepoType)
+	assert.Equal(t, consoleUrl+"/browse?region=us-west-2", result.RepoUrl)
+	assert.Equal(t, consoleUrl+"/commit/${sha}?region=us-west-2", result.CommitUrlTemplate)
+	assert.Equal(t, consoleUrl+"/browse/${sha}/--/${filePath}?region=us-west-2&lines=${lineNumber}-${lineNumber}", result.HunkUrlTemplate)
+	assert.Equal(t, "main", result.Branch)
+	assert.Equal(t, 100, result.UpdateSequenceId)
+}
+
+func TestMergeCodeBuildOptions_withGithubWebhook(t *testing.T) {
+	os.Setenv("CODEBUILD_SOURCE_REPO_URL", "https://github.com/launchdarkly/myapp-vue.git")
+	os.Setenv("CODEBUILD_SOURCE_VERSION", "pr/12")
+	os.Setenv("CODEBUILD_WEBHOOK_HEAD_REF", "refs/heads/feature")
+	os.Setenv("CODEBUILD_BUILD_NUMBER", "200")
+	var options o.Options = o.Options{
+		AccessToken: "deaf-beef",
+		ProjKey:     "project-x",
+		RepoName:    "myapp",
+	}
+
+	result, _ := mergeCodeBuildOptions(options)
+
+	assert.Equal(t, "myapp", result.RepoName)
+	assert.Equal(t, "github", result.RepoType)
+	assert.Equal(t, "https://github.com/launchdarkly/myapp-vue", result.RepoUrl)
+	assert.Equal(t, "", result.CommitUrlTemplate)
+	assert.Equal(t, "feature", result.Branch)
+	assert.Equal(t, 200, result.UpdateSequenceId)
+}
+
+func TestParseBranch(t *testing.T) {
+	assert.Equal(t, "feature", parseBranch("refs/heads/feature", "abc123"))
+	assert.Equal(t, "main", parseBranch("", "refs/heads/main"))
+	assert.Equal(t, "", parseBranch("", "abc123"), "commit source versions are not branches")
+	assert.Equal(t, "", parseBranch("", "pr/12"), "pull request source versions are not branches")
+}
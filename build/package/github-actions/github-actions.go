@@ -21,7 +21,8 @@ func main() {
 	if err != nil {
 		log.Error.Fatal(err)
 	}
-	log.Init(opts.Debug)
+	levels, _ := opts.LogLevels()
+	log.InitFormat(levels, opts.ConsoleFormat)
 	coderefs.Scan(opts)
 }
 
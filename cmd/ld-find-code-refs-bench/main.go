@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/bench"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+)
+
+var fixtureOpts bench.FixtureOptions
+
+var gen = &cobra.Command{
+	Use:     "gen [flags] dir",
+	Example: "ld-find-code-refs-bench gen /tmp/fixture --files 5000 --flags 1000 --density 0.01 # synthesizes a repository in /tmp/fixture",
+	Short:   "Synthesize a repository with configurable file counts, sizes, and flag densities",
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags, err := bench.Generate(args[0], fixtureOpts)
+		if err != nil {
+			return err
+		}
+		log.Info.Printf("generated %d files referencing %d flags in %s", fixtureOpts.Files, len(flags), args[0])
+		return nil
+	},
+}
+
+var (
+	iterations int
+	backends   []string
+	matchers   []string
+	outFile    string
+	baseline   string
+	threshold  float64
+)
+
+var run = &cobra.Command{
+	Use:     "run [flags] dir",
+	Example: "ld-find-code-refs-bench run /tmp/fixture --out results.json --baseline previous.json # compares search performance with a previous run",
+	Short:   "Benchmark search backends and matchers against a generated repository",
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir := args[0]
+		flags, err := bench.ReadFlags(dir)
+		if err != nil {
+			return err
+		}
+
+		selectedBackends := make([]bench.Backend, 0, len(backends))
+		for _, b := range backends {
+			selectedBackends = append(selectedBackends, bench.Backend(b))
+		}
+		selectedMatchers, err := selectMatchers(matchers)
+		if err != nil {
+			return err
+		}
+
+		results, err := bench.Run(dir, flags, selectedBackends, selectedMatchers, iterations)
+		if err != nil {
+			return err
+		}
+		if outFile != "" {
+			err = bench.WriteResults(outFile, results)
+			if err != nil {
+				return err
+			}
+		}
+
+		var previous []bench.Result
+		if baseline != "" {
+			previous, err = bench.ReadResults(baseline)
+			if err != nil {
+				return fmt.Errorf("could not read baseline results: %w", err)
+			}
+		}
+		regressions := bench.PrintResults(os.Stdout, results, previous, threshold)
+		if len(regressions) > 0 {
+			return fmt.Errorf("performance regressed by more than %.0f%% for: %s", threshold*100, strings.Join(regressions, ", "))
+		}
+		return nil
+	},
+}
+
+func selectMatchers(names []string) ([]bench.Matcher, error) {
+	if len(names) == 0 {
+		return bench.Matchers, nil
+	}
+	ret := make([]bench.Matcher, 0, len(names))
+	for _, name := range names {
+		found := false
+		for _, m := range bench.Matchers {
+			if m.Name == name {
+				ret = append(ret, m)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown matcher: %s", name)
+		}
+	}
+	return ret, nil
+}
+
+var cmd = &cobra.Command{
+	Use:          "ld-find-code-refs-bench",
+	Short:        "Generate test fixtures and benchmark code reference searches",
+	SilenceUsage: true,
+}
+
+func main() {
+	log.Init(false)
+	gen.Flags().IntVar(&fixtureOpts.Files, "files", 1000, "Number of files to generate")
+	gen.Flags().IntVar(&fixtureOpts.LinesPerFile, "lines", 200, "Number of lines in each file")
+	gen.Flags().IntVar(&fixtureOpts.LineLength, "lineLength", 80, "Approximate number of characters in each line")
+	gen.Flags().IntVar(&fixtureOpts.Flags, "flags", 500, "Number of flag keys to reference")
+	gen.Flags().Float64Var(&fixtureOpts.Density, "density", 0.01, "Fraction of lines referencing a flag, between 0 and 1")
+	gen.Flags().Int64Var(&fixtureOpts.Seed, "seed", 1, "Random seed. Fixtures generated with the same options and seed are identical")
+	run.Flags().IntVar(&iterations, "iterations", 3, "Number of times to search the fixture with each backend and matcher")
+	run.Flags().StringSliceVar(&backends, "backends", []string{string(bench.BackendFilesystem), string(bench.BackendContents)}, "Comma-separated search backends to benchmark")
+	run.Flags().StringSliceVar(&matchers, "matchers", nil, "Comma-separated matchers to benchmark. Defaults to all matchers: no-delimiters, default-delimiters, delimiter-pairs, aliases")
+	run.Flags().StringVar(&outFile, "out", "", "If provided, results are written to this file as JSON, to be used as a baseline for later runs")
+	run.Flags().StringVar(&baseline, "baseline", "", "Results of a previous run to compare with")
+	run.Flags().Float64Var(&threshold, "threshold", 0.1, "Fraction by which a search may be slower than the baseline before it is reported as a regression")
+	cmd.AddCommand(gen)
+	cmd.AddCommand(run)
+
+	err := cmd.Execute()
+	if err != nil {
+		os.Exit(1)
+	}
+}
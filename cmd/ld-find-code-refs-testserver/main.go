@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	"github.com/launchdarkly/ld-find-code-refs/testserver"
+)
+
+var (
+	addr          string
+	accessToken   string
+	projKey       string
+	flags         []string
+	archivedFlags []string
+)
+
+var cmd = &cobra.Command{
+	Use:     "ld-find-code-refs-testserver",
+	Example: "ld-find-code-refs-testserver --projKey default --flags my-flag,my-other-flag # then run ld-find-code-refs with --baseUri http://localhost:8080",
+	Short:   "Run an in-memory emulation of the LaunchDarkly code references API for testing",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		log.Init(false)
+		server := testserver.New(accessToken)
+		server.AddProject(projKey, flags, archivedFlags)
+		log.Info.Printf("listening on %s, state is available at %s", addr, testserver.StatePath)
+		return http.ListenAndServe(addr, server)
+	},
+}
+
+func main() {
+	cmd.Flags().StringVar(&addr, "addr", ":8080", "Address to listen on")
+	cmd.Flags().StringVar(&accessToken, "accessToken", "", "If provided, requests must use this access token. Otherwise, any access token is accepted")
+	cmd.Flags().StringVar(&projKey, "projKey", "default", "Key of the emulated project")
+	cmd.Flags().StringSliceVar(&flags, "flags", nil, "Comma-separated keys of flags in the emulated project")
+	cmd.Flags().StringSliceVar(&archivedFlags, "archivedFlags", nil, "Comma-separated keys of archived flags in the emulated project")
+
+	err := cmd.Execute()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
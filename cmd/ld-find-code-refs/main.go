@@ -1,7 +1,9 @@
 package main
 
 import (
+	"errors"
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
 
@@ -31,12 +33,388 @@ var prune = &cobra.Command{
 			return err
 		}
 
-		log.Init(opts.Debug)
+		initLog(opts)
 		coderefs.Prune(opts, args)
 		return nil
 	},
 }
 
+var openEditor bool
+var stalePolicies []string
+
+var cleanup = &cobra.Command{
+	Use:     "cleanup [flags]",
+	Example: "ld-find-code-refs cleanup --editor # lists stale flags with code references, and opens each reference in $EDITOR",
+	Short:   "Interactively review code references to stale flags",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := o.InitYAML()
+		if err != nil {
+			return err
+		}
+
+		opts, err := o.GetOptions()
+		if err != nil {
+			return err
+		}
+		err = opts.ValidateRequired()
+		if err != nil {
+			return err
+		}
+
+		initLog(opts)
+		return coderefs.Cleanup(opts, os.Stdin, os.Stdout, openEditor, stalePolicies)
+	},
+}
+
+var sampleFlags []string
+
+var config = &cobra.Command{
+	Use:   "config",
+	Short: "Commands for working with YAML configuration",
+}
+
+var lint = &cobra.Command{
+	Use:     "lint [flags]",
+	Example: "ld-find-code-refs config lint --dir . --flags my-flag,my-other-flag # validates .launchdarkly/coderefs.yaml and prints aliases generated for sample flags",
+	Short:   "Validate YAML configuration and evaluate aliases against live or sample flag keys",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := o.ReadYAML()
+		if err != nil {
+			return err
+		}
+
+		opts, err := o.GetOptions()
+		if err != nil {
+			return err
+		}
+
+		initLog(opts)
+		return coderefs.Lint(opts, sampleFlags, os.Stdout)
+	},
+}
+
+var doctor = &cobra.Command{
+	Use:     "doctor [flags]",
+	Example: "ld-find-code-refs doctor --dir . --accessToken $LD_ACCESS_TOKEN --projKey default # checks the environment is able to run a scan",
+	Short:   "Check that the environment is able to run a scan",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := o.ReadYAML()
+		if err != nil {
+			return err
+		}
+
+		opts, err := o.GetOptions()
+		if err != nil {
+			return err
+		}
+
+		initLog(opts)
+		return coderefs.Doctor(opts, os.Stdout)
+	},
+}
+
+var (
+	workspaceFile string
+	concurrency   int
+)
+
+var workspace = &cobra.Command{
+	Use:     "workspace [flags] [dirs...]",
+	Example: "ld-find-code-refs workspace --file workspace.yaml --concurrency 8 # scans all repositories listed in workspace.yaml",
+	Short:   "Scan multiple repositories concurrently. Accepts directories as arguments, or a workspace file listing repositories",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts, err := o.GetOptions()
+		if err != nil {
+			return err
+		}
+		initLog(opts)
+
+		repos := o.WorkspaceReposFromDirs(args)
+		if workspaceFile != "" {
+			fileRepos, err := o.ReadWorkspace(workspaceFile)
+			if err != nil {
+				return err
+			}
+			repos = append(repos, fileRepos...)
+		}
+		if len(repos) == 0 {
+			return errors.New("at least one directory or a workspace file must be provided")
+		}
+		return coderefs.ScanWorkspace(opts, repos, concurrency)
+	},
+}
+
+var serveOpts coderefs.ServeOptions
+
+var serve = &cobra.Command{
+	Use:     "serve [flags] [dirs...]",
+	Example: "LD_SERVE_TOKEN=xxx ld-find-code-refs serve --listen :8080 --file workspace.yaml # serves scans of all repositories listed in workspace.yaml",
+	Short:   "Run an HTTP API server which scans repositories on request. Accepts directories as arguments, or a workspace file listing repositories",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts, err := o.GetOptions()
+		if err != nil {
+			return err
+		}
+		initLog(opts)
+
+		repos := o.WorkspaceReposFromDirs(args)
+		if workspaceFile != "" {
+			fileRepos, err := o.ReadWorkspace(workspaceFile)
+			if err != nil {
+				return err
+			}
+			repos = append(repos, fileRepos...)
+		}
+		if len(repos) == 0 {
+			return errors.New("at least one directory or a workspace file must be provided")
+		}
+		serveOpts.Token = os.Getenv("LD_SERVE_TOKEN")
+		serveOpts.WebhookSecret = os.Getenv("LD_WEBHOOK_SECRET")
+		return coderefs.Serve(opts, repos, serveOpts)
+	},
+}
+
+var watchInterval time.Duration
+
+var watch = &cobra.Command{
+	Use:     "watch [flags]",
+	Example: "ld-find-code-refs watch --dir . --accessToken $LD_ACCESS_TOKEN --projKey default --interval 1m # scans again whenever the checked out commit or configuration changes",
+	Short:   "Scan a repository, then scan it again whenever its checked out commit or configuration changes",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := o.InitYAML()
+		if err != nil {
+			return err
+		}
+
+		opts, err := o.GetOptions()
+		if err != nil {
+			return err
+		}
+
+		initLog(opts)
+		// configuration is read again whenever it changes
+		load := func() (o.Options, error) {
+			err := o.ReadYAML()
+			if err != nil {
+				return o.Options{}, err
+			}
+			opts, err := o.GetOptions()
+			if err != nil {
+				return opts, err
+			}
+			return opts, opts.Validate()
+		}
+		return coderefs.Watch(load, watchInterval)
+	},
+}
+
+var discoverOpts coderefs.DiscoverOptions
+
+var discover = &cobra.Command{
+	Use:     "discover [flags]",
+	Example: "GITHUB_TOKEN=xxx ld-find-code-refs discover --provider github --owner my-org --workDir /tmp/repos # clones and scans all repositories in the my-org GitHub organization",
+	Short:   "Clone and scan all repositories in a GitHub organization or Bitbucket workspace",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts, err := o.GetOptions()
+		if err != nil {
+			return err
+		}
+		initLog(opts)
+
+		switch discoverOpts.Provider {
+		case "github":
+			discoverOpts.Token = os.Getenv("GITHUB_TOKEN")
+		case "bitbucket":
+			discoverOpts.Username = os.Getenv("BITBUCKET_USERNAME")
+			discoverOpts.Token = os.Getenv("BITBUCKET_APP_PASSWORD")
+		}
+		return coderefs.Discover(opts, discoverOpts)
+	},
+}
+
+var checkOnly bool
+
+var update = &cobra.Command{
+	Use:     "update [flags]",
+	Example: "ld-find-code-refs update # replaces the ld-find-code-refs binary with the latest release",
+	Short:   "Update ld-find-code-refs to the latest release",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		log.Init(false)
+		return coderefs.Update(os.Stdout, checkOnly)
+	},
+}
+
+var uploadConcurrency int
+
+var upload = &cobra.Command{
+	Use:     "upload [flags] files...",
+	Example: "ld-find-code-refs upload --repoName my-repo out/*_branch.json # sends branches written by scans with the deferUpload option",
+	Short:   "Send branches written by scans with the deferUpload option to LaunchDarkly. Accepts branch files as arguments",
+	Args:    cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts, err := o.GetOptions()
+		if err != nil {
+			return err
+		}
+		initLog(opts)
+		err = coderefs.Upload(opts, args, uploadConcurrency)
+		if err != nil {
+			log.Error.Fatal(err)
+		}
+		return nil
+	},
+}
+
+var pull = &cobra.Command{
+	Use:     "pull [flags] [branches...]",
+	Example: "ld-find-code-refs pull --repoName my-repo --outDir out main # writes the code references stored in LaunchDarkly for main to out",
+	Short:   "Write the code references stored in LaunchDarkly for branches of a repository to outDir. If no branches are provided, every branch is written",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts, err := o.GetOptions()
+		if err != nil {
+			return err
+		}
+		initLog(opts)
+		return coderefs.Pull(opts, args)
+	},
+}
+
+var deleteAll bool
+
+var deleteBranch = &cobra.Command{
+	Use:     "delete-branch [flags] [branches...]",
+	Example: "ld-find-code-refs delete-branch --repoName my-repo \"branch1\" # deletes the code reference data stored for branch1",
+	Short:   "Delete the code reference data stored in LaunchDarkly for branches of a repository, whether or not they exist on the remote. Accepts branch names as arguments",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts, err := o.GetOptions()
+		if err != nil {
+			return err
+		}
+		initLog(opts)
+		return coderefs.DeleteBranches(opts, args, deleteAll)
+	},
+}
+
+var repo = &cobra.Command{
+	Use:   "repo",
+	Short: "Commands for managing code reference repositories in LaunchDarkly",
+}
+
+var rename = &cobra.Command{
+	Use:     "rename [flags] old new",
+	Example: "ld-find-code-refs repo rename old-repo new-repo # copies the code references of every branch of old-repo to new-repo, and deletes old-repo",
+	Short:   "Rename a code reference repository, copying the code references of every branch to the new repository and deleting the old repository",
+	Args:    cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts, err := o.GetOptions()
+		if err != nil {
+			return err
+		}
+		initLog(opts)
+		return coderefs.RenameRepository(opts, args[0], args[1])
+	},
+}
+
+var publicKey string
+
+var verify = &cobra.Command{
+	Use:     "verify [flags] manifest",
+	Example: "ld-find-code-refs verify --publicKey key.pub coderefs_default_my-repo_0123456_manifest.json # verifies a signed scan manifest and the files it lists",
+	Short:   "Verify the signature of a scan manifest written with the signingKey option, and the digests of the files it lists",
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		log.Init(false)
+		return coderefs.VerifyManifest(args[0], publicKey, os.Stdout)
+	},
+}
+
+var (
+	diffFlags []string
+	diffJSON  bool
+)
+
+var diff = &cobra.Command{
+	Use:     "diff [flags] base [head]",
+	Example: "ld-find-code-refs diff --dir . main my-feature # reports flag references added or removed by my-feature since it diverged from main",
+	Short:   "Report flag references added or removed between two git revisions. If head is not provided, HEAD is used",
+	Args:    cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := o.ReadYAML()
+		if err != nil {
+			return err
+		}
+
+		opts, err := o.GetOptions()
+		if err != nil {
+			return err
+		}
+
+		initLog(opts)
+		head := "HEAD"
+		if len(args) > 1 {
+			head = args[1]
+		}
+		return coderefs.Diff(opts, args[0], head, diffFlags, os.Stdout, diffJSON)
+	},
+}
+
+var check = &cobra.Command{
+	Use:     "check [flags]",
+	Example: "ld-find-code-refs check --dir . --accessToken $LD_ACCESS_TOKEN --projKey default # fails if SDK calls reference flags which do not exist",
+	Short:   "Check that SDK evaluation calls only reference flags which exist in the LaunchDarkly project",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := o.ReadYAML()
+		if err != nil {
+			return err
+		}
+
+		opts, err := o.GetOptions()
+		if err != nil {
+			return err
+		}
+
+		initLog(opts)
+		err = coderefs.Check(opts, os.Stdout)
+		if err != nil {
+			log.Error.Fatal(err)
+		}
+		return nil
+	},
+}
+
+var (
+	terraformDir  string
+	terraformJSON bool
+)
+
+var tf = &cobra.Command{
+	Use:     "terraform [flags]",
+	Example: "ld-find-code-refs terraform --dir . --terraformDir infra # reports flags referenced in code without a launchdarkly_feature_flag resource in infra, and vice versa",
+	Short:   "Reconcile the flags managed by the LaunchDarkly Terraform provider with the flags referenced in code",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := o.ReadYAML()
+		if err != nil {
+			return err
+		}
+
+		opts, err := o.GetOptions()
+		if err != nil {
+			return err
+		}
+
+		initLog(opts)
+		return coderefs.Terraform(opts, terraformDir, os.Stdout, terraformJSON)
+	},
+}
+
 var cmd = &cobra.Command{
 	Use: "ld-find-code-refs",
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -54,7 +432,7 @@ var cmd = &cobra.Command{
 			return err
 		}
 
-		log.Init(opts.Debug)
+		initLog(opts)
 		coderefs.Scan(opts)
 		return nil
 	},
@@ -66,10 +444,66 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	cleanup.Flags().BoolVar(&openEditor, "editor", false, "Prompt to open each code reference in $EDITOR")
+	cleanup.Flags().StringSliceVar(&stalePolicies, "stale", []string{o.StaleArchived, o.StaleRolledOut}, `Comma-separated policies which make a flag stale: "archived", for archived flags, and "rolledOut", for flags which are on and serve the same variation to all users in every environment`)
+	lint.Flags().StringSliceVar(&sampleFlags, "flags", nil, "Comma-separated sample flag keys to evaluate aliases against. If not set, flags are retrieved from LaunchDarkly")
+	config.AddCommand(lint)
+	workspace.Flags().StringVar(&workspaceFile, "file", "", "Path to a YAML workspace file listing repositories to scan")
+	workspace.Flags().IntVar(&concurrency, "concurrency", 4, "The maximum number of repositories to scan concurrently")
+	serve.Flags().StringVar(&workspaceFile, "file", "", "Path to a YAML workspace file listing repositories to scan")
+	serve.Flags().StringVar(&serveOpts.Listen, "listen", ":8080", "The address the server listens on")
+	watch.Flags().DurationVar(&watchInterval, "interval", 30*time.Second, "How often to check the repository for changes, e.g. 1m")
+	serve.Flags().DurationVar(&serveOpts.Interval, "interval", 0, "If set, every repository is scanned when the server starts, and again at this interval, e.g. 6h")
+	discover.Flags().StringVar(&discoverOpts.Provider, "provider", "github", "The source code hosting provider. Acceptable values: github|bitbucket")
+	discover.Flags().StringVar(&discoverOpts.Owner, "owner", "", "The GitHub organization or Bitbucket workspace to discover repositories in")
+	discover.Flags().StringVar(&discoverOpts.ApiUrl, "apiUrl", "", "The provider API URL, e.g. for GitHub Enterprise Server. Defaults to the public GitHub or Bitbucket API")
+	discover.Flags().StringVar(&discoverOpts.WorkDir, "workDir", "", "Directory repositories are cloned into. Existing clones are updated to the latest commit of the default branch, discarding local changes")
+	discover.Flags().BoolVar(&discoverOpts.IncludeArchived, "includeArchived", false, "Scan archived repositories")
+	discover.Flags().BoolVar(&discoverOpts.IncludeForks, "includeForks", false, "Scan forked repositories")
+	discover.Flags().IntVar(&discoverOpts.Concurrency, "concurrency", 4, "The maximum number of repositories to scan concurrently")
+	update.Flags().BoolVar(&checkOnly, "check", false, "Report the latest release without updating")
+	upload.Flags().IntVar(&uploadConcurrency, "concurrency", 4, "The maximum number of branches to send to LaunchDarkly at once")
+	deleteBranch.Flags().BoolVar(&deleteAll, "all", false, "Delete the code reference data stored for every branch of the repository")
+	repo.AddCommand(rename)
+	verify.Flags().StringVar(&publicKey, "publicKey", "", "Path to the PEM encoded public key of the signingKey used to sign the manifest")
+	_ = verify.MarkFlagRequired("publicKey")
+	diff.Flags().StringSliceVar(&diffFlags, "flags", nil, "Comma-separated flag keys to compare references to. If not set, flags are retrieved from LaunchDarkly")
+	diff.Flags().BoolVar(&diffJSON, "json", false, "Write results as JSON")
+	tf.Flags().StringVar(&terraformDir, "terraformDir", "", "Directory containing Terraform configuration. Defaults to the scanned directory")
+	tf.Flags().BoolVar(&terraformJSON, "json", false, "Write results as JSON")
 	cmd.AddCommand(prune)
+	cmd.AddCommand(cleanup)
+	cmd.AddCommand(config)
+	cmd.AddCommand(update)
+	cmd.AddCommand(doctor)
+	cmd.AddCommand(workspace)
+	cmd.AddCommand(watch)
+	cmd.AddCommand(discover)
+	cmd.AddCommand(serve)
+	cmd.AddCommand(upload)
+	cmd.AddCommand(pull)
+	cmd.AddCommand(deleteBranch)
+	cmd.AddCommand(repo)
+	cmd.AddCommand(verify)
+	cmd.AddCommand(diff)
+	cmd.AddCommand(check)
+	cmd.AddCommand(tf)
 
 	err = cmd.Execute()
 	if err != nil {
-		os.Exit(1)
+		os.Exit(coderefs.ExitCode(err))
+	}
+}
+
+// initLog configures console output for a command
+func initLog(opts o.Options) {
+	// invalid levels are reported when options are validated
+	levels, _ := opts.LogLevels()
+	log.InitFormat(levels, opts.ConsoleFormat)
+	if opts.Porcelain {
+		log.UseStderr()
+	}
+	if opts.Quiet {
+		log.Quiet()
 	}
 }
@@ -8,54 +8,241 @@ import (
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/iancoleman/strcase"
 	"github.com/launchdarkly/ld-find-code-refs/internal/helpers"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
 	"github.com/launchdarkly/ld-find-code-refs/internal/validation"
 	"github.com/launchdarkly/ld-find-code-refs/options"
 )
 
-// GenerateAliases returns a map of flag keys to aliases based on config.
-func GenerateAliases(flags []string, aliases []options.Alias, dir string) (map[string][]string, error) {
+// aliasRules records the name and priority of the alias configuration which generated each alias, by flag key and
+// alias, and the aliases generated by configurations which match them regardless of case. An alias generated by more
+// than one configuration is attributed to the configuration of highest priority, or the first of equal priority.
+type aliasRules struct {
+	names           map[string]map[string]string
+	priorities      map[string]map[string]int
+	caseInsensitive map[string]bool
+}
+
+// generateAliasesWithPolicy returns a map of flag keys to aliases based on config, and the configuration which
+// generated each alias. No aliases are generated if any command alias is not allowed by the policy.
+func generateAliasesWithPolicy(flags []string, aliases []options.Alias, dir string, policy *aliasCommandPolicy) (map[string][]string, aliasRules, error) {
+	for _, a := range aliases {
+		err := policy.check(a)
+		if err != nil {
+			return nil, aliasRules{}, err
+		}
+	}
+
 	allFileContents, err := processFileContent(aliases, dir)
 	if err != nil {
-		return nil, err
+		return nil, aliasRules{}, err
 	}
 
+	order := byPriority(aliases)
 	ret := make(map[string][]string, len(flags))
+	rules := aliasRules{
+		names:           make(map[string]map[string]string, len(flags)),
+		priorities:      make(map[string]map[string]int, len(flags)),
+		caseInsensitive: map[string]bool{},
+	}
 	for _, flag := range flags {
-		for _, a := range aliases {
-			flagAliases, err := generateAlias(a, flag, dir, allFileContents)
+		rules.names[flag] = map[string]string{}
+		rules.priorities[flag] = map[string]int{}
+		for _, i := range order {
+			a := aliases[i]
+			if a.Type.Canonical() == options.Exclude {
+				continue
+			}
+			flagAliases, err := generateAlias(a, flag, dir, allFileContents, policy)
 			if err != nil {
-				return nil, err
+				return nil, aliasRules{}, err
 			}
 			ret[flag] = append(ret[flag], flagAliases...)
+			for _, alias := range flagAliases {
+				if _, ok := rules.names[flag][alias]; !ok {
+					rules.names[flag][alias] = aliasName(i, a)
+					rules.priorities[flag][alias] = a.Priority
+				}
+				if a.CaseInsensitive {
+					rules.caseInsensitive[alias] = true
+				}
+			}
+			if a.Exclusive && len(flagAliases) > 0 {
+				log.Debug.Printf("%s generated aliases for flag %s, skipping alias configurations of lower priority", aliasName(i, a), flag)
+				break
+			}
 		}
-		ret[flag] = helpers.Dedupe(ret[flag])
+		ret[flag] = excludeAliases(helpers.Dedupe(ret[flag]), flag, aliases)
 	}
-	return ret, nil
+	return ret, rules, nil
+}
+
+// excludeAliases removes the aliases of a flag which are excluded by any exclude alias configuration
+func excludeAliases(flagAliases []string, flag string, aliases []options.Alias) []string {
+	excluded := map[string]bool{}
+	for _, a := range aliases {
+		if a.Type.Canonical() != options.Exclude {
+			continue
+		}
+		for _, alias := range a.Flags[flag] {
+			excluded[alias] = true
+		}
+	}
+	if len(excluded) == 0 {
+		return flagAliases
+	}
+	ret := make([]string, 0, len(flagAliases))
+	for _, alias := range flagAliases {
+		if excluded[alias] {
+			log.Debug.Printf("excluding alias '%s' of flag %s", alias, flag)
+			continue
+		}
+		ret = append(ret, alias)
+	}
+	return ret
+}
+
+// byPriority returns the indexes of alias configurations in the order aliases are generated: by descending priority,
+// and in the order they are defined if their priorities are equal
+func byPriority(aliases []options.Alias) []int {
+	order := make([]int, len(aliases))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return aliases[order[i]].Priority > aliases[order[j]].Priority
+	})
+	return order
+}
+
+// generateAliases merges shared alias definitions from any configured alias sources with locally configured aliases,
+// then generates and resolves collisions between aliases for each flag.
+func generateAliases(opts options.Options, flags []string, dir string) (map[string][]string, aliasRules, error) {
+	configs := opts.Aliases
+	if len(opts.AliasSources) > 0 {
+		shared, err := options.LoadAliasSources(opts.AliasSources, dir, opts.AllowedConfigSources)
+		if err != nil {
+			return nil, aliasRules{}, err
+		}
+		log.Debug.Printf("loaded %d shared alias definitions from %d source(s)", len(shared), len(opts.AliasSources))
+		configs = append(shared, configs...)
+	}
+
+	aliases, rules, err := generateAliasesWithPolicy(flags, configs, dir, newAliasCommandPolicy(opts))
+	if err != nil {
+		return nil, aliasRules{}, err
+	}
+	return resolveAliasCollisions(aliases, configs, opts.AliasCollisions, rules.priorities), rules, nil
+}
+
+// aliasName identifies an alias configuration by its name, or its index in the combined list of shared and local
+// alias configurations if it is not named
+func aliasName(idx int, a options.Alias) string {
+	id := strconv.Itoa(idx)
+	if a.Name != "" {
+		id = a.Name
+	}
+	return fmt.Sprintf("aliases[%s] (%s)", id, a.Type.Canonical())
+}
+
+// resolveAliasCollisions attributes aliases generated for more than one flag according to the collision policy, given
+// the priority of the configuration which generated each alias, by flag key and alias. Without priorities, the priority
+// policy attributes colliding aliases to every flag which generated them.
+func resolveAliasCollisions(aliases map[string][]string, configs []options.Alias, policy options.AliasCollisionPolicy, priorities map[string]map[string]int) map[string][]string {
+	flagsByAlias := map[string][]string{}
+	for flag, flagAliases := range aliases {
+		for _, alias := range flagAliases {
+			flagsByAlias[alias] = append(flagsByAlias[alias], flag)
+		}
+	}
+
+	collisions := map[string]bool{}
+	for alias, flags := range flagsByAlias {
+		if len(flags) > 1 {
+			sort.Strings(flags)
+			log.Warning.Printf("alias '%s' was generated for multiple flags: %v", alias, flags)
+			collisions[alias] = true
+		}
+	}
+	if len(collisions) == 0 || policy == "" || policy == options.AttributeToAll {
+		return aliases
+	}
+
+	// the highest priority of the configurations which generated each colliding alias, for any flag
+	highest := map[string]int{}
+	for alias := range collisions {
+		for i, flag := range flagsByAlias[alias] {
+			if p := priorities[flag][alias]; i == 0 || p > highest[alias] {
+				highest[alias] = p
+			}
+		}
+	}
+
+	ret := make(map[string][]string, len(aliases))
+	for flag, flagAliases := range aliases {
+		ret[flag] = []string{}
+		for _, alias := range flagAliases {
+			switch {
+			case !collisions[alias],
+				policy == options.RequireLiteral && hasLiteralAlias(configs, flag, alias),
+				policy == options.AttributeToPriority && priorities[flag][alias] == highest[alias]:
+				ret[flag] = append(ret[flag], alias)
+			}
+		}
+	}
+	return ret
 }
 
-func generateAlias(a options.Alias, flag, dir string, allFileContents map[string][]byte) ([]string, error) {
+func hasLiteralAlias(configs []options.Alias, flag, alias string) bool {
+	for _, a := range configs {
+		if a.Type.Canonical() != options.Literal {
+			continue
+		}
+		for _, literal := range a.Flags[flag] {
+			if literal == alias {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func generateAlias(a options.Alias, flag, dir string, allFileContents map[string][]byte, policy *aliasCommandPolicy) ([]string, error) {
 	ret := []string{}
+	key := a.StripKeyPrefix(flag)
 	switch a.Type.Canonical() {
 	case options.Literal:
 		ret = a.Flags[flag]
-	case options.CamelCase:
-		ret = []string{strcase.ToLowerCamel(flag)}
-	case options.PascalCase:
-		ret = []string{strcase.ToCamel(flag)}
-	case options.SnakeCase:
-		ret = []string{strcase.ToSnake(flag)}
-	case options.UpperSnakeCase:
-		ret = []string{strcase.ToScreamingSnake(flag)}
-	case options.KebabCase:
-		ret = []string{strcase.ToKebab(flag)}
-	case options.DotCase:
-		ret = []string{strcase.ToDelimited(flag, '.')}
+	case options.CamelCase, options.PascalCase, options.SnakeCase, options.UpperSnakeCase, options.KebabCase, options.DotCase:
+		ret = []string{options.ConvertCase(a.Type, key)}
+	case options.Template:
+		data := options.NewAliasTemplateData(key)
+		for _, text := range a.Templates {
+			tmpl, err := options.ParseAliasTemplate(text)
+			if err != nil {
+				return nil, fmt.Errorf("could not parse alias template '%s': %w", text, err)
+			}
+			var sb strings.Builder
+			err = tmpl.Execute(&sb, data)
+			if err != nil {
+				return nil, fmt.Errorf("could not execute alias template '%s': %w", text, err)
+			}
+			ret = append(ret, sb.String())
+		}
+	case options.Pipeline:
+		alias := key
+		for i, step := range a.Steps {
+			alias = step.Apply(alias)
+			if step.Emit || i == len(a.Steps)-1 {
+				ret = append(ret, alias)
+			}
+		}
 	case options.FilePattern:
 		// Concatenate the contents of all files into a single byte array to be matched by specified patterns
 		fileContents := []byte{}
@@ -95,8 +282,10 @@ func generateAlias(a options.Alias, flag, dir string, allFileContents map[string
 		if len(tokens) > 1 {
 			args = tokens[1:]
 		}
+		policy.wait()
 		/* #nosec */
 		cmd := exec.CommandContext(ctx, name, args...)
+		cmd.Env = commandEnviron()
 		cmd.Stdin = strings.NewReader(flag)
 		cmd.Dir = dir
 		stdout, err := cmd.Output()
@@ -112,6 +301,102 @@ func generateAlias(a options.Alias, flag, dir string, allFileContents map[string
 	return ret, nil
 }
 
+// aliasCommandPolicy restricts which command aliases may be run, and how often
+type aliasCommandPolicy struct {
+	disallow bool
+	// allowed is the set of executables command aliases may run. If empty, any executable may be run.
+	allowed  []string
+	interval time.Duration
+}
+
+// aliasCommandLimiter spaces command alias executions across every scan in the process, so concurrent workspace,
+// discover, and serve scans share one maxAliasCommandsPerSecond budget
+var aliasCommandLimiter struct {
+	mu   sync.Mutex
+	next time.Time
+}
+
+func newAliasCommandPolicy(opts options.Options) *aliasCommandPolicy {
+	p := &aliasCommandPolicy{disallow: opts.DisallowCommandAliases}
+	for _, name := range strings.Split(opts.AllowedAliasCommands, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			p.allowed = append(p.allowed, name)
+		}
+	}
+	if opts.MaxAliasCommandsPerSecond > 0 {
+		p.interval = time.Second / time.Duration(opts.MaxAliasCommandsPerSecond)
+	}
+	return p
+}
+
+// check returns an error if the alias is a command alias which the policy does not allow to be run. A nil policy allows all commands.
+func (p *aliasCommandPolicy) check(a options.Alias) error {
+	if p == nil || a.Type.Canonical() != options.Command || a.Command == nil {
+		return nil
+	}
+	if p.disallow {
+		return fmt.Errorf("command alias '%s' is not allowed: command aliases are disabled by the disallowCommandAliases option", *a.Command)
+	}
+	if len(p.allowed) == 0 {
+		return nil
+	}
+	name := strings.Split(*a.Command, " ")[0]
+	for _, allowed := range p.allowed {
+		if name == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("command alias '%s' is not allowed: '%s' is not one of the allowedAliasCommands (%s)", *a.Command, name, strings.Join(p.allowed, ", "))
+}
+
+// restricted returns true if the policy does not allow every command to be run
+func (p *aliasCommandPolicy) restricted() bool {
+	return p != nil && (p.disallow || len(p.allowed) > 0)
+}
+
+// checkCommand returns an error if a command set by an option in repository configuration, such as a hook, is not allowed
+// by the policy. Shell commands are only allowed by allowedAliasCommands if they run a single allowed executable, without
+// shell syntax which could run other commands.
+func (p *aliasCommandPolicy) checkCommand(option, command string, shell bool) error {
+	if !p.restricted() {
+		return nil
+	}
+	if p.disallow {
+		return fmt.Errorf("%s command '%s' is not allowed: commands in repository configuration are disabled by the disallowCommandAliases option", option, command)
+	}
+	if shell && strings.ContainsAny(command, shellMetacharacters) {
+		return fmt.Errorf("%s command '%s' is not allowed: shell commands in repository configuration may only run one of the allowedAliasCommands (%s)", option, command, strings.Join(p.allowed, ", "))
+	}
+	name := strings.Fields(command)[0]
+	for _, allowed := range p.allowed {
+		if name == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s command '%s' is not allowed: '%s' is not one of the allowedAliasCommands (%s)", option, command, name, strings.Join(p.allowed, ", "))
+}
+
+// shellMetacharacters are characters which allow a shell command to run commands other than its first word
+const shellMetacharacters = ";&|`$()<>\n\r"
+
+// wait blocks until the next command may be run, if command executions are rate limited. Executions are limited across
+// every scan in the process.
+func (p *aliasCommandPolicy) wait() {
+	if p == nil || p.interval == 0 {
+		return
+	}
+	aliasCommandLimiter.mu.Lock()
+	now := time.Now()
+	slot := now
+	if aliasCommandLimiter.next.After(now) {
+		slot = aliasCommandLimiter.next
+	}
+	aliasCommandLimiter.next = slot.Add(p.interval)
+	aliasCommandLimiter.mu.Unlock()
+	time.Sleep(slot.Sub(now))
+}
+
 // processFileContent reads and stores the content of files specified by filePattern alias matchers to be matched for aliases
 func processFileContent(aliases []options.Alias, dir string) (map[string][]byte, error) {
 	allFileContents := map[string][]byte{}
@@ -1,7 +1,9 @@
 package coderefs
 
 import (
+	"sync"
 	"testing"
+	"time"
 
 	o "github.com/launchdarkly/ld-find-code-refs/options"
 	"github.com/stretchr/testify/assert"
@@ -25,7 +27,7 @@ const (
 	testWildFlagKey  = "wildFlag"
 )
 
-func Test_GenerateAliases(t *testing.T) {
+func Test_generateAliasesWithPolicy(t *testing.T) {
 	specs := []struct {
 		name    string
 		flags   []string
@@ -80,6 +82,58 @@ func Test_GenerateAliases(t *testing.T) {
 			},
 			want: map[string][]string{testWildFlagKey: slice("WILD_FLAG"), testFlagKey: slice("SOME_FLAG")},
 		},
+		{
+			name:  "templates",
+			flags: slice(testFlagAliasKey),
+			aliases: []o.Alias{
+				{Type: o.Template, Templates: slice("FeatureFlags.{{.Pascal}}", "flags::{{.Snake}}", "FLAG_{{.Camel | upper}}")},
+			},
+			want: map[string][]string{testFlagAliasKey: slice("FeatureFlags.AnyKindOfKey", "flags::any_kind.of_key", "FLAG_ANYKINDOFKEY")},
+		},
+		{
+			name:  "pipeline",
+			flags: slice(testFlagKey),
+			aliases: []o.Alias{
+				{Type: o.Pipeline, Steps: []o.AliasStep{{Transform: "camelcase"}, {Transform: "prefix", Value: "FLAG_", Emit: true}, {Transform: "upper"}}},
+			},
+			want: map[string][]string{testFlagKey: slice("FLAG_someFlag", "FLAG_SOMEFLAG")},
+		},
+		{
+			name:  "strip prefix",
+			flags: slice("web.checkout.enable-x", "api.enable-y"),
+			aliases: []o.Alias{
+				{Type: o.UpperSnakeCase, StripPrefix: `(web\.checkout|api)\.`},
+			},
+			want: map[string][]string{"web.checkout.enable-x": slice("ENABLE_X"), "api.enable-y": slice("ENABLE_Y")},
+		},
+		{
+			name:  "priority",
+			flags: slice(testFlagKey),
+			aliases: []o.Alias{
+				alias(o.SnakeCase),
+				{Type: o.PascalCase, Priority: 1},
+			},
+			want: map[string][]string{testFlagKey: slice("SomeFlag", "some_flag")},
+		},
+		{
+			name:  "exclusive",
+			flags: slice(testFlagKey, testFlagKey2),
+			aliases: []o.Alias{
+				alias(o.SnakeCase),
+				{Type: o.Literal, Priority: 1, Exclusive: true, Flags: map[string][]string{testFlagKey: slice("SOME_FLAG")}},
+			},
+			want: map[string][]string{testFlagKey: slice("SOME_FLAG"), testFlagKey2: slice("another_flag")},
+		},
+		{
+			name:  "exclude",
+			flags: slice(testFlagKey, testFlagKey2),
+			aliases: []o.Alias{
+				alias(o.CamelCase),
+				alias(o.UpperSnakeCase),
+				{Type: o.Exclude, Flags: map[string][]string{testFlagKey: slice("someFlag")}},
+			},
+			want: map[string][]string{testFlagKey: slice("SOME_FLAG"), testFlagKey2: slice("anotherFlag", "ANOTHER_FLAG")},
+		},
 		// TODO
 		// {
 		// 	name:    "command",
@@ -90,13 +144,155 @@ func Test_GenerateAliases(t *testing.T) {
 
 	for _, tt := range specs {
 		t.Run(tt.name, func(t *testing.T) {
-			aliases, err := GenerateAliases(tt.flags, tt.aliases, "")
+			aliases, _, err := generateAliasesWithPolicy(tt.flags, tt.aliases, "", nil)
 			assert.Equal(t, tt.want, aliases)
 			assert.Equal(t, tt.wantErr, err)
 		})
 	}
 }
 
+func Test_generateAliasesWithPolicy_caseInsensitive(t *testing.T) {
+	caseInsensitive := alias(o.UpperSnakeCase)
+	caseInsensitive.CaseInsensitive = true
+	_, rules, err := generateAliasesWithPolicy(slice(testFlagKey), []o.Alias{alias(o.CamelCase), caseInsensitive}, "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"SOME_FLAG": true}, rules.caseInsensitive)
+	assert.Equal(t, map[string]string{"someFlag": "aliases[0] (camelcase)", "SOME_FLAG": "aliases[1] (uppersnakecase)"}, rules.names[testFlagKey])
+}
+
+func Test_generateAliasesWithPolicy_priority(t *testing.T) {
+	_, rules, err := generateAliasesWithPolicy(slice(testFlagKey), []o.Alias{alias(o.CamelCase), {Type: o.CamelCase, Name: "preferred", Priority: 2}}, "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"someFlag": "aliases[preferred] (camelcase)"}, rules.names[testFlagKey])
+	assert.Equal(t, map[string]int{"someFlag": 2}, rules.priorities[testFlagKey])
+}
+
+func Test_aliasCommandPolicy(t *testing.T) {
+	specs := []struct {
+		name    string
+		opts    o.Options
+		alias   o.Alias
+		wantErr string
+	}{
+		{
+			name:  "no restrictions",
+			alias: cmd("./aliases.sh --upper", 0),
+		},
+		{
+			name:  "non-command alias",
+			opts:  o.Options{DisallowCommandAliases: true},
+			alias: alias(o.CamelCase),
+		},
+		{
+			name:    "disallowed",
+			opts:    o.Options{DisallowCommandAliases: true},
+			alias:   cmd("./aliases.sh --upper", 0),
+			wantErr: "command alias './aliases.sh --upper' is not allowed: command aliases are disabled by the disallowCommandAliases option",
+		},
+		{
+			name:  "allowed",
+			opts:  o.Options{AllowedAliasCommands: "jq, ./aliases.sh"},
+			alias: cmd("./aliases.sh --upper", 0),
+		},
+		{
+			name:    "not allowed",
+			opts:    o.Options{AllowedAliasCommands: "jq,aliases.sh"},
+			alias:   cmd("./aliases.sh --upper", 0),
+			wantErr: "command alias './aliases.sh --upper' is not allowed: './aliases.sh' is not one of the allowedAliasCommands (jq, aliases.sh)",
+		},
+	}
+
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := newAliasCommandPolicy(tt.opts)
+			err := policy.check(tt.alias)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.wantErr)
+			// no aliases are generated when a command is not allowed
+			aliases, _, err := generateAliasesWithPolicy(slice(testFlagKey), []o.Alias{alias(o.CamelCase), tt.alias}, "", policy)
+			assert.Nil(t, aliases)
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func Test_aliasCommandPolicy_wait(t *testing.T) {
+	policy := newAliasCommandPolicy(o.Options{MaxAliasCommandsPerSecond: 50})
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		policy.wait()
+	}
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(40*time.Millisecond))
+
+	// a nil policy does not wait
+	var unlimited *aliasCommandPolicy
+	unlimited.wait()
+}
+
+func Test_aliasCommandPolicy_wait_concurrent(t *testing.T) {
+	// policies of concurrent scans share one limit
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		policy := newAliasCommandPolicy(o.Options{MaxAliasCommandsPerSecond: 50})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 2; j++ {
+				policy.wait()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(9*20*time.Millisecond))
+}
+
+func Test_resolveAliasCollisions(t *testing.T) {
+	generated := map[string][]string{
+		"enable-x": slice("enable_x", "enableX"),
+		"enable.x": slice("enable_x", "EnableX"),
+	}
+	configs := []o.Alias{{Type: o.Literal, Flags: map[string][]string{"enable-x": slice("enable_x")}}}
+	specs := []struct {
+		policy o.AliasCollisionPolicy
+		want   map[string][]string
+	}{
+		{"", generated},
+		{o.AttributeToAll, generated},
+		{o.AttributeToNone, map[string][]string{"enable-x": slice("enableX"), "enable.x": slice("EnableX")}},
+		{o.RequireLiteral, map[string][]string{"enable-x": slice("enable_x", "enableX"), "enable.x": slice("EnableX")}},
+	}
+	for _, tt := range specs {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			assert.Equal(t, tt.want, resolveAliasCollisions(generated, configs, tt.policy, nil))
+		})
+	}
+}
+
+func Test_resolveAliasCollisions_priority(t *testing.T) {
+	generated := map[string][]string{
+		"enable-x": slice("enable_x", "enableX"),
+		"enable.x": slice("enable_x", "EnableX"),
+		"enable_x": slice("enable_x"),
+	}
+	priorities := map[string]map[string]int{
+		"enable-x": {"enable_x": 1},
+		"enable.x": {"enable_x": 0},
+		"enable_x": {"enable_x": 1},
+	}
+	want := map[string][]string{
+		"enable-x": slice("enable_x", "enableX"),
+		"enable.x": slice("EnableX"),
+		"enable_x": slice("enable_x"),
+	}
+	assert.Equal(t, want, resolveAliasCollisions(generated, nil, o.AttributeToPriority, priorities))
+	// without priorities, colliding aliases are attributed to every flag
+	assert.Equal(t, generated, resolveAliasCollisions(generated, nil, o.AttributeToPriority, nil))
+}
+
 func slice(args ...string) []string {
 	return args
 }
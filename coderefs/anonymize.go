@@ -0,0 +1,37 @@
+package coderefs
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"path"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+)
+
+// anonymizePaths returns a copy of the branch with each file path replaced by an HMAC of the path, keeping the file
+// extension so references can still be grouped by language, and with the source code lines of each hunk removed, since
+// they could identify the file. Paths are hashed with the secret key and the repository name, so the same file has the
+// same hash in every scan of the repository with the same key, but not across repositories, and paths cannot be
+// recovered by hashing guessed paths without the key.
+func anonymizePaths(branch ld.BranchRep, repoName, key string) ld.BranchRep {
+	refs := make([]ld.ReferenceHunksRep, 0, len(branch.References))
+	for _, ref := range branch.References {
+		ref.Path = anonymizePath(key, repoName, ref.Path)
+		hunks := make([]ld.HunkRep, 0, len(ref.Hunks))
+		for _, hunk := range ref.Hunks {
+			hunk.Lines = ""
+			hunks = append(hunks, hunk)
+		}
+		ref.Hunks = hunks
+		refs = append(refs, ref)
+	}
+	branch.References = refs
+	return branch
+}
+
+func anonymizePath(key, repoName, filePath string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	_, _ = mac.Write([]byte(repoName + "\x00" + filePath))
+	return hex.EncodeToString(mac.Sum(nil))[:20] + path.Ext(filePath)
+}
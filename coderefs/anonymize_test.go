@@ -0,0 +1,34 @@
+package coderefs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+)
+
+func TestAnonymizePaths(t *testing.T) {
+	branch := ld.BranchRep{Name: "main", References: []ld.ReferenceHunksRep{
+		{Path: "internal/billing/invoice.go", Hunks: []ld.HunkRep{{FlagKey: "flag1", Lines: "flag1"}}},
+		{Path: "Makefile", Hunks: []ld.HunkRep{{FlagKey: "flag1"}}},
+	}}
+
+	anonymized := anonymizePaths(branch, "repo", "secret")
+	require.Len(t, anonymized.References, 2)
+	assert.Regexp(t, `^[0-9a-f]{20}\.go$`, anonymized.References[0].Path)
+	assert.Regexp(t, `^[0-9a-f]{20}$`, anonymized.References[1].Path)
+	assert.Equal(t, []ld.HunkRep{{FlagKey: "flag1"}}, anonymized.References[0].Hunks, "source code lines are removed")
+	assert.Equal(t, "internal/billing/invoice.go", branch.References[0].Path, "the original branch is not modified")
+	assert.Equal(t, "flag1", branch.References[0].Hunks[0].Lines, "the original branch is not modified")
+
+	assert.Equal(t, anonymized.References[0].Path, anonymizePaths(branch, "repo", "secret").References[0].Path, "paths are hashed consistently")
+	assert.NotEqual(t, anonymized.References[0].Path, anonymizePaths(branch, "other-repo", "secret").References[0].Path, "paths are hashed with the repository name")
+	assert.NotEqual(t, anonymized.References[0].Path, anonymizePaths(branch, "repo", "other-secret").References[0].Path, "paths are hashed with the key")
+
+	unkeyed := sha256.Sum256([]byte("repo\x00internal/billing/invoice.go"))
+	assert.NotEqual(t, hex.EncodeToString(unkeyed[:])[:20]+".go", anonymized.References[0].Path, "paths cannot be recovered without the key")
+}
@@ -0,0 +1,32 @@
+package coderefs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/archive"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+)
+
+// extractArchive extracts an archive of a source snapshot to a temporary directory. Returns the root of the snapshot,
+// which paths of code references are relative to, and a function removing the temporary directory.
+func extractArchive(path string) (string, func(), error) {
+	tmp, err := ioutil.TempDir("", "ld-find-code-refs-archive")
+	if err != nil {
+		return "", nil, fmt.Errorf("unable to create directory to extract archive: %w", err)
+	}
+	cleanup := func() {
+		err := os.RemoveAll(tmp)
+		if err != nil {
+			log.Warning.Printf("unable to remove extracted archive %s: %s", tmp, err)
+		}
+	}
+	root, err := archive.Extract(path, tmp)
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("unable to extract archive %s: %w", path, err)
+	}
+	log.Info.Printf("extracted archive %s to %s", path, root)
+	return root, cleanup, nil
+}
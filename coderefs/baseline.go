@@ -0,0 +1,59 @@
+package coderefs
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+	"github.com/launchdarkly/ld-find-code-refs/search"
+)
+
+// baselineComment marks suppressions written by the writeBaseline option
+const baselineComment = "baseline"
+
+func configureSuppressions(suppressions []options.Suppression) ([]search.Suppression, error) {
+	ret := make([]search.Suppression, 0, len(suppressions))
+	for _, s := range suppressions {
+		suppression, err := search.NewSuppression(s.Path, s.Flag, s.LinePattern)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, suppression)
+	}
+	return ret, nil
+}
+
+// writeBaseline adds a suppression for each line containing a code reference to the repository's suppressions file,
+// so that only references added later are reported. Existing suppressions are kept. Returns the path of the file and
+// the number of suppressions added.
+func writeBaseline(dir string, existing []options.Suppression, refs []ld.ReferenceHunksRep) (string, int, error) {
+	seen := map[options.Suppression]bool{}
+	added := []options.Suppression{}
+	for _, line := range search.ReferencingLines(dir, refs) {
+		s := options.Suppression{
+			Path:        line.Path,
+			Flag:        line.FlagKey,
+			LinePattern: `^\s*` + regexp.QuoteMeta(strings.TrimSpace(line.Line)) + `\s*$`,
+			Comment:     baselineComment,
+		}
+		if seen[s] {
+			continue
+		}
+		seen[s] = true
+		added = append(added, s)
+	}
+	sort.SliceStable(added, func(i, j int) bool {
+		if added[i].Path != added[j].Path {
+			return added[i].Path < added[j].Path
+		}
+		return added[i].Flag < added[j].Flag
+	})
+	path, err := options.WriteSuppressions(dir, append(existing, added...))
+	if err != nil {
+		return "", 0, fmt.Errorf("could not write suppressions: %w", err)
+	}
+	return path, len(added), nil
+}
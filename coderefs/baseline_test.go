@@ -0,0 +1,50 @@
+package coderefs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+	"github.com/launchdarkly/ld-find-code-refs/search"
+)
+
+func Test_writeBaseline(t *testing.T) {
+	dir, err := ioutil.TempDir("", "baseline")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "app.js"), []byte("  if (variation('my-flag')) {\n}\n  if (variation('my-flag')) {\n"), 0600))
+
+	refs := []ld.ReferenceHunksRep{{Path: "app.js", Hunks: []ld.HunkRep{
+		{StartingLineNumber: 1, FlagKey: "my-flag"},
+		{StartingLineNumber: 3, FlagKey: "my-flag"},
+	}}}
+	existing := []options.Suppression{{Path: "docs/**", Flag: "my-flag"}}
+	path, added, err := writeBaseline(dir, existing, refs)
+	require.NoError(t, err)
+	assert.Equal(t, 1, added, "identical lines share a suppression")
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, `suppressions:
+- path: docs/**
+  flag: my-flag
+- path: app.js
+  flag: my-flag
+  linePattern: ^\s*if \(variation\('my-flag'\)\) \{\s*$
+  comment: baseline
+`, string(data))
+
+	config, err := options.ReadSuppressions(dir)
+	require.NoError(t, err)
+	suppressions, err := configureSuppressions(config)
+	require.NoError(t, err)
+	remaining, removed := search.Suppress(dir, refs, suppressions)
+	assert.Equal(t, 2, removed)
+	assert.Empty(t, remaining)
+}
@@ -0,0 +1,177 @@
+package coderefs
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/git"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+)
+
+// staleBranchListAge is the age after which a branch list which was not retrieved from the remote is considered stale
+const staleBranchListAge = 7 * 24 * time.Hour
+
+// branchCache is the contents of a branch cache file
+type branchCache struct {
+	RepoName  string   `json:"repoName"`
+	RemoteUrl string   `json:"remoteUrl"`
+	ListedAt  int64    `json:"listedAt"`
+	Branches  []string `json:"branches"`
+}
+
+// branchList is the branches on the remote, and when they were listed
+type branchList struct {
+	Branches map[string]bool
+	ListedAt time.Time
+	// Live is true if the branches were retrieved from the remote by this run
+	Live bool
+}
+
+// getRemoteBranches returns the branches on the remote, used to prune code references for deleted branches. Branches
+// retrieved from the remote are cached on disk. If the remote is unreachable, the branches in the knownBranches file are
+// used if it is set, and the branches cached by a previous run otherwise.
+func getRemoteBranches(opts options.Options, gitClient *git.Client) (branchList, error) {
+	remoteUrl, _ := gitClient.RemoteUrl()
+	path, pathErr := branchCachePath(opts.RepoName, remoteUrl)
+	branches, err := gitClient.RemoteBranches()
+	if err == nil {
+		if pathErr != nil {
+			log.Warning.Printf("unable to locate branch cache: %s", pathErr)
+		} else {
+			cache := branchCache{RepoName: opts.RepoName, RemoteUrl: remoteUrl, ListedAt: time.Now().Unix(), Branches: make([]string, 0, len(branches))}
+			for name := range branches {
+				cache.Branches = append(cache.Branches, name)
+			}
+			if err := writeBranchCache(path, cache); err != nil {
+				log.Warning.Printf("unable to write branch cache: %s", err)
+			}
+		}
+		return branchList{Branches: canonicalBranches(opts.BranchAliases, branches), ListedAt: time.Now(), Live: true}, nil
+	}
+	log.Warning.Printf("unable to retrieve branch list from remote: %s", strings.TrimSpace(err.Error()))
+
+	var list branchList
+	if opts.KnownBranches != "" {
+		list, err = readKnownBranches(opts.KnownBranches)
+		if err != nil {
+			return list, fmt.Errorf(`invalid value for "knownBranches": %w`, err)
+		}
+		log.Warning.Printf("using %d branches from %s, last modified %s ago", len(list.Branches), opts.KnownBranches, branchListAge(list))
+	} else {
+		if pathErr != nil {
+			return list, pathErr
+		}
+		cache, ok := readBranchCache(path)
+		if !ok {
+			return list, errors.New("no branch list was cached by a previous run, set knownBranches to prune code references when the remote is unreachable")
+		}
+		list = branchList{Branches: make(map[string]bool, len(cache.Branches)), ListedAt: time.Unix(cache.ListedAt, 0)}
+		for _, name := range cache.Branches {
+			list.Branches[name] = true
+		}
+		log.Warning.Printf("using %d branches cached %s ago in %s", len(list.Branches), branchListAge(list), path)
+	}
+	if time.Since(list.ListedAt) > staleBranchListAge {
+		log.Warning.Printf("branch list is more than %d days old, code references for recently deleted branches may not be pruned", int(staleBranchListAge.Hours()/24))
+	}
+	// the current branch should be in the list of remote branches
+	list.Branches[strings.TrimPrefix(gitClient.GitBranch, "refs/heads/")] = true
+	list.Branches = canonicalBranches(opts.BranchAliases, list.Branches)
+	return list, nil
+}
+
+// canonicalBranches returns the names branches on the remote are sent to LaunchDarkly under, so branches scanned under
+// another name are not pruned
+func canonicalBranches(aliases []options.BranchAlias, branches map[string]bool) map[string]bool {
+	if len(aliases) == 0 {
+		return branches
+	}
+	ret := make(map[string]bool, len(branches))
+	for name := range branches {
+		ret[options.CanonicalBranch(aliases, strings.TrimPrefix(name, "refs/heads/"))] = true
+	}
+	return ret
+}
+
+func branchListAge(list branchList) time.Duration {
+	return time.Since(list.ListedAt).Round(time.Second)
+}
+
+// branchCachePath returns the path of the branch cache file for a repository
+func branchCachePath(repoName, remoteUrl string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256([]byte(repoName + "\x00" + remoteUrl))
+	name := unsafeFileNameChars.ReplaceAllString(repoName, "_") + "-" + hex.EncodeToString(hash[:])[:12] + ".json"
+	return filepath.Join(dir, "ld-find-code-refs", "branches", name), nil
+}
+
+func readBranchCache(path string) (branchCache, bool) {
+	var cache branchCache
+	/* #nosec */
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warning.Printf("unable to read branch cache: %s", err)
+		}
+		return cache, false
+	}
+	err = json.Unmarshal(data, &cache)
+	if err != nil {
+		log.Warning.Printf("ignoring invalid branch cache %s: %s", path, err)
+		return cache, false
+	}
+	return cache, true
+}
+
+func writeBranchCache(path string, cache branchCache) error {
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0750)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// readKnownBranches reads a file listing one branch per line, such as the output of git branch --format='%(refname:short)'
+// or git ls-remote --heads. The branches are considered to have been listed when the file was last modified.
+func readKnownBranches(path string) (branchList, error) {
+	list := branchList{Branches: map[string]bool{}}
+	/* #nosec */
+	f, err := os.Open(path)
+	if err != nil {
+		return list, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return list, err
+	}
+	list.ListedAt = info.ModTime()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.Index(line, "refs/heads/"); i >= 0 {
+			line = line[i+len("refs/heads/"):]
+		}
+		if line != "" {
+			list.Branches[line] = true
+		}
+	}
+	return list, scanner.Err()
+}
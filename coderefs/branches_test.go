@@ -0,0 +1,115 @@
+package coderefs
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+	"github.com/launchdarkly/ld-find-code-refs/testserver"
+)
+
+func TestReadKnownBranches(t *testing.T) {
+	dir, err := ioutil.TempDir("", "knownbranches")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "branches.txt")
+	contents := "main\n  feature/ABC#123-añadir\n\n0123456789abcdef\trefs/heads/release/1.0\n"
+	require.NoError(t, ioutil.WriteFile(path, []byte(contents), 0600))
+	modified := time.Now().Add(-time.Hour).Truncate(time.Second)
+	require.NoError(t, os.Chtimes(path, modified, modified))
+
+	list, err := readKnownBranches(path)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"main": true, "feature/ABC#123-añadir": true, "release/1.0": true}, list.Branches)
+	assert.True(t, list.ListedAt.Equal(modified), "branches are listed when the file was last modified")
+	assert.False(t, list.Live)
+
+	_, err = readKnownBranches(filepath.Join(dir, "missing.txt"))
+	assert.Error(t, err)
+}
+
+func TestBranchCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "branchcache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer os.Setenv("XDG_CACHE_HOME", os.Getenv("XDG_CACHE_HOME"))
+	require.NoError(t, os.Setenv("XDG_CACHE_HOME", dir))
+
+	path, err := branchCachePath("my-repo", "git@github.com:my-org/my-repo.git")
+	require.NoError(t, err)
+	_, ok := readBranchCache(path)
+	assert.False(t, ok)
+
+	cache := branchCache{RepoName: "my-repo", ListedAt: time.Now().Unix(), Branches: []string{"main", "feature"}}
+	require.NoError(t, writeBranchCache(path, cache))
+	got, ok := readBranchCache(path)
+	require.True(t, ok)
+	assert.Equal(t, cache, got)
+
+	otherPath, err := branchCachePath("my-repo", "git@github.com:my-org/my-fork.git")
+	require.NoError(t, err)
+	assert.NotEqual(t, path, otherPath, "branches of different remotes are cached separately")
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("{"), 0600))
+	_, ok = readBranchCache(path)
+	assert.False(t, ok)
+}
+
+func TestDeleteStaleBranches(t *testing.T) {
+	now := time.Now()
+	millis := func(t time.Time) int64 { return t.UnixNano() / int64(time.Millisecond) }
+	specs := []struct {
+		name     string
+		branches branchList
+		want     []string
+	}{
+		{
+			name:     "branches listed by the remote",
+			branches: branchList{Branches: map[string]bool{"main": true}, ListedAt: now, Live: true},
+			want:     []string{"deleted", "created"},
+		},
+		{
+			name:     "cached branches",
+			branches: branchList{Branches: map[string]bool{"main": true}, ListedAt: now.Add(-time.Hour)},
+			want:     []string{"deleted"},
+		},
+	}
+
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			server := testserver.New("")
+			server.AddProject("default", []string{"flag1"}, nil)
+			httpServer := httptest.NewServer(server)
+			defer httpServer.Close()
+
+			retryMax := 0
+			client := ld.InitApiClient(ld.ApiOptions{ApiKey: "api-x", ProjKey: "default", BaseUri: httpServer.URL, RetryMax: &retryMax})
+			require.NoError(t, client.MaybeUpsertCodeReferenceRepository(ld.RepoParams{Type: "custom", Name: "repo", DefaultBranch: "main"}))
+			for name, synced := range map[string]time.Time{"main": now, "deleted": now.Add(-2 * time.Hour), "created": now} {
+				require.NoError(t, client.PutCodeReferenceBranch(ld.BranchRep{Name: name, Head: "0123456789abcdef", SyncTime: millis(synced)}, "repo"))
+			}
+
+			require.NoError(t, deleteStaleBranches(client, "repo", tt.branches))
+			state, ok := server.Repository("repo")
+			require.True(t, ok)
+			assert.ElementsMatch(t, tt.want, state.DeletedBranches)
+		})
+	}
+}
+
+func Test_canonicalBranches(t *testing.T) {
+	branches := map[string]bool{"main": true, "mirror/main": true, "mirror/feature": true, "refs/heads/mirror/release": true}
+	assert.Equal(t, branches, canonicalBranches(nil, branches))
+
+	aliases := []options.BranchAlias{{From: "mirror/*", To: "*"}}
+	assert.Equal(t, map[string]bool{"main": true, "feature": true, "release": true}, canonicalBranches(aliases, branches))
+}
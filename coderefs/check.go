@@ -0,0 +1,113 @@
+package coderefs
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/validation"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+	"github.com/launchdarkly/ld-find-code-refs/search"
+)
+
+// maxSuggestionDistance is the maximum edit distance between an unknown flag key and an existing flag key suggested in its place
+const maxSuggestionDistance = 2
+
+// Check searches the configured directory for calls to LaunchDarkly SDK evaluation methods with literal flag keys, and
+// reports each call to a flag which does not exist in the project. Archived flags are considered to exist. Results are
+// written to out, and an error is returned if any calls to unknown flags were found.
+func Check(opts options.Options, out io.Writer) error {
+	missing := []string{}
+	if opts.AccessToken == "" && opts.OfflineFlags == "" {
+		missing = append(missing, "accessToken")
+	}
+	if opts.ProjKey == "" {
+		missing = append(missing, "projKey")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required option(s): %v", missing)
+	}
+
+	absPath, err := validation.NormalizeAndValidatePath(opts.Dir)
+	if err != nil {
+		return fmt.Errorf("could not validate directory option: %w", err)
+	}
+
+	ldApi := ld.InitApiClient(apiOptions(opts))
+	flags, err := getFlags(opts, ldApi)
+	if err != nil {
+		return fmt.Errorf("could not retrieve flag keys from LaunchDarkly: %w", err)
+	}
+	exists := make(map[string]bool, len(flags))
+	for _, flag := range flags {
+		exists[flag] = true
+	}
+
+	calls, err := search.FindSDKCalls(context.Background(), absPath, search.SymlinkPolicy(opts.Symlinks), opts.GitAttributes, int64(opts.MaxFileSizeKb)*1024, configureSDKs(opts))
+	if err != nil {
+		return fmt.Errorf("error searching for SDK calls: %w", err)
+	}
+
+	unknown := 0
+	for _, call := range calls {
+		if exists[call.FlagKey] {
+			continue
+		}
+		unknown++
+		fmt.Fprintf(out, "FAIL %s:%d: flag %q does not exist in project %s", call.Path, call.LineNumber, call.FlagKey, opts.ProjKey)
+		if suggestion := closestFlagKey(call.FlagKey, flags); suggestion != "" {
+			fmt.Fprintf(out, ", did you mean %q?", suggestion)
+		}
+		fmt.Fprintf(out, "\n       %s\n", call.Line)
+	}
+
+	if unknown > 0 {
+		return fmt.Errorf("found %d SDK call(s) referencing flags which do not exist in project %s", unknown, opts.ProjKey)
+	}
+	fmt.Fprintf(out, "all %d SDK call(s) reference existing flags\n", len(calls))
+	return nil
+}
+
+// closestFlagKey returns the flag key with the smallest edit distance to key, if it is within maxSuggestionDistance
+func closestFlagKey(key string, flags []string) string {
+	ret, best := "", maxSuggestionDistance+1
+	for _, flag := range flags {
+		if d := editDistance(key, flag); d < best {
+			ret, best = flag, d
+		}
+	}
+	return ret
+}
+
+// editDistance returns the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
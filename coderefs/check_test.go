@@ -0,0 +1,55 @@
+package coderefs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/options"
+	"github.com/launchdarkly/ld-find-code-refs/testserver"
+)
+
+func TestCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "check")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	server := testserver.New("")
+	server.AddProject("default", []string{"new-checkout"}, []string{"old-checkout"})
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	opts := options.Options{AccessToken: "api-x", BaseUri: httpServer.URL, ProjKey: "default", Dir: dir}
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "app.js"), []byte("client.variation('new-checkout', ctx, false)\nclient.boolVariation(\"old-checkout\", ctx, false)\n"), 0600))
+	var out bytes.Buffer
+	require.NoError(t, Check(opts, &out))
+	assert.Equal(t, "all 2 SDK call(s) reference existing flags\n", out.String())
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "typo.go"), []byte("enabled, _ := client.BoolVariation(\"new-chekout\", ctx, false)\nclient.StringVariation(\"missing-flag\", ctx, \"\")\n"), 0600))
+	out.Reset()
+	err = Check(opts, &out)
+	assert.EqualError(t, err, "found 2 SDK call(s) referencing flags which do not exist in project default")
+	assert.Equal(t, `FAIL typo.go:1: flag "new-chekout" does not exist in project default, did you mean "new-checkout"?
+       enabled, _ := client.BoolVariation("new-chekout", ctx, false)
+FAIL typo.go:2: flag "missing-flag" does not exist in project default
+       client.StringVariation("missing-flag", ctx, "")
+`, out.String())
+}
+
+func TestCheck_missingOptions(t *testing.T) {
+	err := Check(options.Options{Dir: "."}, ioutil.Discard)
+	assert.EqualError(t, err, "missing required option(s): [accessToken projKey]")
+}
+
+func Test_editDistance(t *testing.T) {
+	assert.Equal(t, 0, editDistance("flag", "flag"))
+	assert.Equal(t, 1, editDistance("flag", "flags"))
+	assert.Equal(t, 2, editDistance("checkout", "chekcout"))
+	assert.Equal(t, 4, editDistance("", "flag"))
+}
@@ -0,0 +1,247 @@
+package coderefs
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/checks"
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	"github.com/launchdarkly/ld-find-code-refs/internal/validation"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+)
+
+// publishChecks publishes a summary of the scan to the code review tools enabled by options, with annotations on
+// references to archived flags. Failures are logged, and do not fail the scan.
+func publishChecks(opts options.Options, ldApi ld.ApiClient, sha string, branch ld.BranchRep, partial bool) {
+	if !opts.GithubChecks && !opts.BitbucketCodeInsights {
+		return
+	}
+	report := checksReport(branch, archivedFlagSet(opts, ldApi), partial)
+	if opts.GithubChecks {
+		publishGitHubCheckRun(opts, sha, report)
+	}
+	if opts.BitbucketCodeInsights {
+		publishBitbucketReport(opts, sha, report)
+	}
+}
+
+// writeSonarQubeIssues writes references to archived flags to outDir as SonarQube generic issues, and returns the path of
+// the issues file. Returns an empty path if no issues file was written.
+func writeSonarQubeIssues(opts options.Options, ldApi ld.ApiClient, outDir, projKey, repoName, revision string, branch ld.BranchRep, partial bool) string {
+	absPath, err := validation.NormalizeAndValidatePath(outDir)
+	if err != nil {
+		log.Warning.Printf("invalid outDir '%s', skipping SonarQube issues: %s", outDir, err)
+		return ""
+	}
+	report := checksReport(branch, archivedFlagSet(opts, ldApi), partial)
+	path := filepath.Join(absPath, fmt.Sprintf("coderefs_%s_%s_%s_sonarqube.json", projKey, repoName, branch.FileTag(revision)))
+	/* #nosec */
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Warning.Printf("unable to write SonarQube issues: %s", err)
+		return ""
+	}
+	err = checks.WriteSonarQubeIssues(f, report)
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Warning.Printf("unable to write SonarQube issues: %s", err)
+		return ""
+	}
+	log.Info.Printf("wrote %d SonarQube issues for references to archived flags to %s", len(report.Annotations), path)
+	return path
+}
+
+func archivedFlagSet(opts options.Options, ldApi ld.ApiClient) map[string]bool {
+	ret := map[string]bool{}
+	if opts.OfflineFlags != "" {
+		log.Warning.Printf("archived flags are not available when offlineFlags is set, references to archived flags will not be annotated")
+		return ret
+	} else if opts.AllProjects {
+		log.Warning.Printf("archived flags are not available when allProjects is set, references to archived flags will not be annotated")
+		return ret
+	}
+	archived, err := ldApi.GetArchivedFlagKeyList()
+	if err != nil {
+		log.Warning.Printf("unable to retrieve archived flags, references to archived flags will not be annotated: %s", err)
+		return ret
+	}
+	for _, flag := range archived {
+		ret[flag] = true
+	}
+	return ret
+}
+
+// checksReport summarizes the code references found by a scan, and annotates each reference to an archived flag
+func checksReport(branch ld.BranchRep, archived map[string]bool, partial bool) checks.Report {
+	flags := map[string]bool{}
+	archivedCounts := map[string]int{}
+	annotations := []checks.Annotation{}
+	for _, ref := range branch.References {
+		for _, hunk := range ref.Hunks {
+			flags[hunk.FlagKey] = true
+			if !archived[hunk.FlagKey] {
+				continue
+			}
+			archivedCounts[hunk.FlagKey]++
+			annotations = append(annotations, checks.Annotation{
+				Path:      ref.Path,
+				StartLine: hunk.StartingLineNumber,
+				EndLine:   hunk.StartingLineNumber + hunk.NumLines() - 1,
+				Title:     fmt.Sprintf("Reference to archived flag %s", hunk.FlagKey),
+				Message:   fmt.Sprintf("The flag %q is archived in LaunchDarkly. Remove this reference to clean up the flag.", hunk.FlagKey),
+			})
+		}
+	}
+	sort.SliceStable(annotations, func(i, j int) bool {
+		a, b := annotations[i], annotations[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.StartLine < b.StartLine
+	})
+
+	details := fmt.Sprintf("Found %d code references to %d flags in %d files.", branch.TotalHunkCount(), len(flags), len(branch.References))
+	if partial {
+		details += " The search exceeded maxScanTime, so these results only include files searched before the deadline."
+	}
+	var sb strings.Builder
+	sb.WriteString(details + "\n")
+	title := fmt.Sprintf("%d code references", branch.TotalHunkCount())
+	if len(annotations) > 0 {
+		title = fmt.Sprintf("%d references to archived flags", len(annotations))
+		archivedKeys := make([]string, 0, len(archivedCounts))
+		for flag := range archivedCounts {
+			archivedKeys = append(archivedKeys, flag)
+		}
+		sort.Strings(archivedKeys)
+		sb.WriteString("\n| Archived flag | References |\n| --- | --- |\n")
+		for _, flag := range archivedKeys {
+			fmt.Fprintf(&sb, "| `%s` | %d |\n", flag, archivedCounts[flag])
+		}
+	}
+	stats := []checks.Stat{
+		{Title: "References", Value: branch.TotalHunkCount()},
+		{Title: "Flags", Value: len(flags)},
+		{Title: "Files", Value: len(branch.References)},
+		{Title: "Archived flag references", Value: len(annotations)},
+	}
+	return checks.Report{Title: title, Details: details, Summary: sb.String(), Stats: stats, Annotations: annotations}
+}
+
+func publishGitHubCheckRun(opts options.Options, sha string, report checks.Report) {
+	token := os.Getenv("GITHUB_TOKEN")
+	repo := githubRepository(opts)
+	if token == "" || repo == "" {
+		log.Warning.Printf("skipping GitHub check run: GITHUB_TOKEN and GITHUB_REPOSITORY must be set, or repoUrl must be a GitHub repository")
+		return
+	}
+	checkRunUrl, err := checks.NewGitHub(githubApiUrl(opts), repo, token).CreateCheckRun(sha, report)
+	if err != nil {
+		log.Warning.Printf("unable to create GitHub check run: %s", err)
+		return
+	}
+	log.Info.Printf("created GitHub check run %s", checkRunUrl)
+}
+
+// githubRepository returns the full name of the GitHub repository being scanned, from the GitHub Actions environment or
+// the url of a github repository
+func githubRepository(opts options.Options) string {
+	if repo := os.Getenv("GITHUB_REPOSITORY"); repo != "" {
+		return repo
+	}
+	if strings.ToLower(opts.RepoType) != repoTypeGithub {
+		return ""
+	}
+	u, err := url.Parse(opts.RepoUrl)
+	if err != nil {
+		return ""
+	}
+	parts := strings.Split(strings.Trim(strings.TrimSuffix(u.Path, ".git"), "/"), "/")
+	if len(parts) != 2 {
+		return ""
+	}
+	return parts[0] + "/" + parts[1]
+}
+
+// githubApiUrl returns the url of the GitHub API, from the GitHub Actions environment or the host of a GitHub Enterprise
+// Server repository url
+func githubApiUrl(opts options.Options) string {
+	if apiUrl := os.Getenv("GITHUB_API_URL"); apiUrl != "" {
+		return apiUrl
+	}
+	u, err := url.Parse(opts.RepoUrl)
+	if err != nil || u.Host == "" || strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.") == githubHost {
+		return checks.DefaultGitHubApiUrl
+	}
+	return u.Scheme + "://" + u.Host + "/api/v3"
+}
+
+func publishBitbucketReport(opts options.Options, sha string, report checks.Report) {
+	username := os.Getenv("BITBUCKET_USERNAME")
+	token := os.Getenv("BITBUCKET_APP_PASSWORD")
+	if username == "" {
+		token = os.Getenv("BITBUCKET_ACCESS_TOKEN")
+	}
+	apiUrl, server, repo := bitbucketRepository(opts)
+	if token == "" || repo == "" {
+		log.Warning.Printf("skipping Bitbucket Code Insights report: BITBUCKET_ACCESS_TOKEN, or BITBUCKET_USERNAME and BITBUCKET_APP_PASSWORD, must be set, and repoUrl must be a Bitbucket repository")
+		return
+	}
+	annotated, err := checks.NewBitbucket(apiUrl, server, repo, username, token).CreateReport(sha, report)
+	if err != nil {
+		log.Warning.Printf("unable to create Bitbucket Code Insights report: %s", err)
+		return
+	}
+	if annotated < len(report.Annotations) {
+		log.Warning.Printf("Bitbucket Code Insights report only includes the first %d of %d annotations", annotated, len(report.Annotations))
+	}
+	log.Info.Printf("created Bitbucket Code Insights report for commit %s", sha)
+}
+
+// bitbucketRepository returns the Code Insights API url and repository of a Bitbucket Cloud repository, from the Bitbucket
+// Pipelines environment or the url of a bitbucket repository, or of a Bitbucket Server repository
+func bitbucketRepository(opts options.Options) (apiUrl string, server bool, repo string) {
+	switch strings.ToLower(opts.RepoType) {
+	case repoTypeBitbucketServer:
+		u, err := url.Parse(bitbucketServerRepoUrl(opts.RepoUrl))
+		if err != nil {
+			return "", true, ""
+		}
+		m := bitbucketServerRepoPath.FindStringSubmatch(u.Path)
+		if m == nil {
+			return "", true, ""
+		}
+		// m[1] is <context path>/projects/<key>/repos/<slug>, or <context path>/users/<username>/repos/<slug>
+		parts := strings.Split(m[1], "/")
+		n := len(parts)
+		project := parts[n-3]
+		if parts[n-4] == "users" {
+			project = "~" + project
+		}
+		u.Path = strings.Join(parts[:n-4], "/") + "/rest/insights/1.0"
+		return u.String(), true, project + "/" + parts[n-1]
+	case "bitbucket":
+		apiUrl = os.Getenv("BITBUCKET_API_URL")
+		if repo = os.Getenv("BITBUCKET_REPO_FULL_NAME"); repo != "" {
+			return apiUrl, false, repo
+		}
+		u, err := url.Parse(opts.RepoUrl)
+		if err != nil {
+			return apiUrl, false, ""
+		}
+		parts := strings.Split(strings.Trim(strings.TrimSuffix(u.Path, ".git"), "/"), "/")
+		if len(parts) != 2 {
+			return apiUrl, false, ""
+		}
+		return apiUrl, false, parts[0] + "/" + parts[1]
+	}
+	return "", false, ""
+}
@@ -0,0 +1,135 @@
+package coderefs
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/checks"
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+	"github.com/launchdarkly/ld-find-code-refs/testserver"
+)
+
+func TestChecksReport(t *testing.T) {
+	branch := ld.BranchRep{References: []ld.ReferenceHunksRep{
+		{Path: "b.go", Hunks: []ld.HunkRep{{FlagKey: "old-flag", StartingLineNumber: 10, Lines: "a\nb\nc"}}},
+		{Path: "a.go", Hunks: []ld.HunkRep{
+			{FlagKey: "new-flag", StartingLineNumber: 1, Lines: "a"},
+			{FlagKey: "old-flag", StartingLineNumber: 5, Lines: "a"},
+		}},
+	}}
+
+	report := checksReport(branch, map[string]bool{"old-flag": true}, false)
+	assert.Equal(t, "2 references to archived flags", report.Title)
+	assert.Equal(t, "Found 3 code references to 2 flags in 2 files.", report.Details)
+	assert.Equal(t, "Found 3 code references to 2 flags in 2 files.\n\n| Archived flag | References |\n| --- | --- |\n| `old-flag` | 2 |\n", report.Summary)
+	assert.Equal(t, []checks.Stat{{Title: "References", Value: 3}, {Title: "Flags", Value: 2}, {Title: "Files", Value: 2}, {Title: "Archived flag references", Value: 2}}, report.Stats)
+	require.Len(t, report.Annotations, 2)
+	assert.Equal(t, checks.Annotation{Path: "a.go", StartLine: 5, EndLine: 5, Title: "Reference to archived flag old-flag", Message: `The flag "old-flag" is archived in LaunchDarkly. Remove this reference to clean up the flag.`}, report.Annotations[0])
+	assert.Equal(t, "b.go", report.Annotations[1].Path)
+	assert.Equal(t, 10, report.Annotations[1].StartLine)
+	assert.Equal(t, 12, report.Annotations[1].EndLine)
+
+	report = checksReport(branch, map[string]bool{}, true)
+	assert.Equal(t, "3 code references", report.Title)
+	assert.Contains(t, report.Details, "maxScanTime")
+	assert.Empty(t, report.Annotations)
+}
+
+func TestWriteSonarQubeIssues(t *testing.T) {
+	server := testserver.New("")
+	server.AddProject("default", []string{"new-flag"}, []string{"old-flag"})
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	dir, err := ioutil.TempDir("", "sonarqube")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	retryMax := 0
+	ldApi := ld.InitApiClient(ld.ApiOptions{ApiKey: "api-x", ProjKey: "default", BaseUri: httpServer.URL, RetryMax: &retryMax})
+	branch := ld.BranchRep{Name: "main", References: []ld.ReferenceHunksRep{{Path: "a.go", Hunks: []ld.HunkRep{
+		{FlagKey: "new-flag", StartingLineNumber: 1, Lines: "a"},
+		{FlagKey: "old-flag", StartingLineNumber: 5, Lines: "a\nb"},
+	}}}}
+
+	path := writeSonarQubeIssues(options.Options{}, ldApi, dir, "default", "repo", "0123456789", branch, false)
+	assert.Equal(t, filepath.Join(dir, "coderefs_default_repo_0123456_sonarqube.json"), path)
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	var issues struct {
+		Issues []struct {
+			RuleId          string `json:"ruleId"`
+			PrimaryLocation struct {
+				FilePath  string         `json:"filePath"`
+				TextRange map[string]int `json:"textRange"`
+			} `json:"primaryLocation"`
+		} `json:"issues"`
+	}
+	require.NoError(t, json.Unmarshal(data, &issues))
+	require.Len(t, issues.Issues, 1)
+	assert.Equal(t, checks.SonarQubeRuleId, issues.Issues[0].RuleId)
+	assert.Equal(t, "a.go", issues.Issues[0].PrimaryLocation.FilePath)
+	assert.Equal(t, map[string]int{"startLine": 5, "endLine": 6}, issues.Issues[0].PrimaryLocation.TextRange)
+}
+
+func TestGithubRepository(t *testing.T) {
+	defer os.Setenv("GITHUB_REPOSITORY", os.Getenv("GITHUB_REPOSITORY"))
+	require.NoError(t, os.Unsetenv("GITHUB_REPOSITORY"))
+
+	assert.Equal(t, "org/repo", githubRepository(options.Options{RepoType: "github", RepoUrl: "https://github.com/org/repo.git"}))
+	assert.Equal(t, "", githubRepository(options.Options{RepoType: "custom", RepoUrl: "https://github.com/org/repo"}))
+	assert.Equal(t, "", githubRepository(options.Options{RepoType: "github"}))
+
+	require.NoError(t, os.Setenv("GITHUB_REPOSITORY", "org/other"))
+	assert.Equal(t, "org/other", githubRepository(options.Options{RepoType: "github", RepoUrl: "https://github.com/org/repo"}))
+}
+
+func TestGithubApiUrl(t *testing.T) {
+	defer os.Setenv("GITHUB_API_URL", os.Getenv("GITHUB_API_URL"))
+	require.NoError(t, os.Unsetenv("GITHUB_API_URL"))
+
+	assert.Equal(t, "https://api.github.com", githubApiUrl(options.Options{RepoUrl: "https://github.com/org/repo"}))
+	assert.Equal(t, "https://api.github.com", githubApiUrl(options.Options{}))
+	assert.Equal(t, "https://github.example.com/api/v3", githubApiUrl(options.Options{RepoUrl: "https://github.example.com/org/repo"}))
+
+	require.NoError(t, os.Setenv("GITHUB_API_URL", "https://ghes.example.com/api/v3"))
+	assert.Equal(t, "https://ghes.example.com/api/v3", githubApiUrl(options.Options{RepoUrl: "https://github.com/org/repo"}))
+}
+
+func TestBitbucketRepository(t *testing.T) {
+	defer os.Setenv("BITBUCKET_REPO_FULL_NAME", os.Getenv("BITBUCKET_REPO_FULL_NAME"))
+	require.NoError(t, os.Unsetenv("BITBUCKET_REPO_FULL_NAME"))
+
+	specs := []struct {
+		name   string
+		opts   options.Options
+		apiUrl string
+		server bool
+		repo   string
+	}{
+		{"bitbucket", options.Options{RepoType: "bitbucket", RepoUrl: "https://bitbucket.org/ws/repo"}, "", false, "ws/repo"},
+		{"bitbucket server", options.Options{RepoType: "bitbucketServer", RepoUrl: "https://example.com/bitbucket/scm/proj/repo.git"}, "https://example.com/bitbucket/rest/insights/1.0", true, "PROJ/repo"},
+		{"bitbucket server personal repository", options.Options{RepoType: "bitbucketServer", RepoUrl: "https://bitbucket.example.com/users/jdoe/repos/repo"}, "https://bitbucket.example.com/rest/insights/1.0", true, "~jdoe/repo"},
+		{"bitbucket server without url", options.Options{RepoType: "bitbucketServer"}, "", true, ""},
+		{"github", options.Options{RepoType: "github", RepoUrl: "https://github.com/org/repo"}, "", false, ""},
+	}
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			apiUrl, server, repo := bitbucketRepository(tt.opts)
+			assert.Equal(t, tt.apiUrl, apiUrl)
+			assert.Equal(t, tt.server, server)
+			assert.Equal(t, tt.repo, repo)
+		})
+	}
+
+	require.NoError(t, os.Setenv("BITBUCKET_REPO_FULL_NAME", "ws/other"))
+	_, _, repo := bitbucketRepository(options.Options{RepoType: "bitbucket", RepoUrl: "https://bitbucket.org/ws/repo"})
+	assert.Equal(t, "ws/other", repo)
+}
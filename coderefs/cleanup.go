@@ -0,0 +1,228 @@
+package coderefs
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	"github.com/launchdarkly/ld-find-code-refs/internal/validation"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+	"github.com/launchdarkly/ld-find-code-refs/search"
+)
+
+// cleanupLocation is a single flag reference to be reviewed during cleanup
+type cleanupLocation struct {
+	path       string
+	lineNumber int
+	hunk       ld.HunkRep
+}
+
+// Cleanup interactively walks through stale flags that still have code references in the configured directory. Flags
+// are stale if they match any of the stale policies: options.StaleArchived, for archived flags, and
+// options.StaleRolledOut, for flags which are on and serve the same variation to all users in every environment. If no
+// policies are provided, both are used. For each reference, the surrounding context is printed, and if openEditor is
+// set, the file is opened in $EDITOR.
+func Cleanup(opts options.Options, in io.Reader, out io.Writer, openEditor bool, stalePolicies []string) error {
+	absPath, err := validation.NormalizeAndValidatePath(opts.Dir)
+	if err != nil {
+		return fmt.Errorf("could not validate directory option: %w", err)
+	}
+
+	ldApi := ld.InitApiClient(apiOptions(opts))
+	stale, err := cleanupFlags(ldApi, stalePolicies)
+	if err != nil {
+		return err
+	}
+	staleFlags := make([]string, 0, len(stale))
+	for flag := range stale {
+		staleFlags = append(staleFlags, flag)
+	}
+	staleFlags, _ = filterShortFlagKeys(staleFlags)
+	if len(staleFlags) == 0 {
+		fmt.Fprintf(out, "no stale flags found for project: %s\n", opts.ProjKey)
+		return nil
+	}
+
+	aliases, rules, err := generateAliases(opts, staleFlags, absPath)
+	if err != nil {
+		return fmt.Errorf("failed to create flag key aliases: %w", err)
+	}
+
+	delimiters := configureDelimiters(opts, rules)
+	ctxLines := configureContextLines(opts)
+	refs, err := search.SearchForRefs(context.Background(), search.Options{
+		ProjKey:        opts.ProjKey,
+		Workspace:      absPath,
+		Aliases:        aliases,
+		ContextLines:   ctxLines,
+		Delimiters:     delimiters,
+		LineLengthUnit: search.LineLengthUnit(opts.LineLengthUnit),
+		MergeLines:     opts.HunkMergeLines,
+		Symlinks:       search.SymlinkPolicy(opts.Symlinks),
+		GitAttributes:  opts.GitAttributes,
+		MaxFileSize:    int64(opts.MaxFileSizeKb) * 1024,
+	})
+	if err != nil {
+		return fmt.Errorf("error searching for flag key references: %w", err)
+	}
+	if opts.SourceMaps {
+		refs = search.ResolveSourceMaps(absPath, refs, ctxLines, search.LineLengthUnit(opts.LineLengthUnit))
+	}
+
+	locationsByFlag := groupLocationsByFlag(refs, aliases, delimiters)
+	if len(locationsByFlag) == 0 {
+		fmt.Fprintln(out, "no code references found for stale flags")
+		return nil
+	}
+
+	flags := make([]string, 0, len(locationsByFlag))
+	for flag := range locationsByFlag {
+		flags = append(flags, flag)
+	}
+	sort.Strings(flags)
+
+	editor := os.Getenv("EDITOR")
+	if openEditor && editor == "" {
+		log.Warning.Printf("$EDITOR is not set, files will not be opened")
+		openEditor = false
+	}
+
+	reader := bufio.NewReader(in)
+	for {
+		fmt.Fprintf(out, "\nStale flags with code references:\n")
+		for i, flag := range flags {
+			fmt.Fprintf(out, "  %d) %s (%s, %d references)\n", i+1, flag, stale[flag], len(locationsByFlag[flag]))
+		}
+		answer, err := prompt(reader, out, "Select a flag to clean up (number, or q to quit): ")
+		if err != nil || answer == "q" {
+			return nil
+		}
+		idx, err := strconv.Atoi(answer)
+		if err != nil || idx < 1 || idx > len(flags) {
+			fmt.Fprintf(out, "invalid selection: %q\n", answer)
+			continue
+		}
+
+		flag := flags[idx-1]
+		for _, loc := range locationsByFlag[flag] {
+			fmt.Fprintf(out, "\n%s:%d\n", loc.path, loc.lineNumber)
+			for i, line := range strings.Split(loc.hunk.Lines, "\n") {
+				fmt.Fprintf(out, "%6d | %s\n", loc.hunk.StartingLineNumber+i, line)
+			}
+			if !openEditor {
+				continue
+			}
+			answer, err := prompt(reader, out, "Open in $EDITOR? [y/N/q]: ")
+			if err != nil || answer == "q" {
+				break
+			}
+			if answer == "y" {
+				err = runEditor(editor, filepath.Join(absPath, loc.path), loc.lineNumber)
+				if err != nil {
+					log.Warning.Printf("failed to open editor: %s", err)
+				}
+			}
+		}
+	}
+}
+
+// cleanupFlags returns the stale policy matched by each stale flag, in the order the policies are provided
+func cleanupFlags(ldApi ld.ApiClient, policies []string) (map[string]string, error) {
+	if len(policies) == 0 {
+		policies = []string{options.StaleArchived, options.StaleRolledOut}
+	}
+	ret := map[string]string{}
+	for _, policy := range policies {
+		var flags []string
+		var err error
+		switch policy {
+		case options.StaleArchived:
+			flags, err = ldApi.GetArchivedFlagKeyList()
+		case options.StaleRolledOut:
+			flags, err = ldApi.GetRolledOutFlagKeyList()
+		default:
+			return nil, fmt.Errorf(`invalid stale policy %q: must be %q or %q`, policy, options.StaleArchived, options.StaleRolledOut)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not retrieve %s flags from LaunchDarkly: %w", policy, err)
+		}
+		for _, flag := range flags {
+			if _, ok := ret[flag]; !ok {
+				ret[flag] = policy
+			}
+		}
+	}
+	return ret, nil
+}
+
+// groupLocationsByFlag flattens hunks into a list of locations for each flag, ordered by path and line number
+func groupLocationsByFlag(refs []ld.ReferenceHunksRep, aliases map[string][]string, delimiters search.Delimiters) map[string][]cleanupLocation {
+	ret := map[string][]cleanupLocation{}
+	for _, ref := range refs {
+		for _, hunk := range ref.Hunks {
+			ret[hunk.FlagKey] = append(ret[hunk.FlagKey], cleanupLocation{
+				path:       ref.Path,
+				lineNumber: referenceLineNumber(hunk, aliases[hunk.FlagKey], delimiters),
+				hunk:       hunk,
+			})
+		}
+	}
+	for _, locations := range ret {
+		sort.SliceStable(locations, func(i, j int) bool {
+			if locations[i].path != locations[j].path {
+				return locations[i].path < locations[j].path
+			}
+			return locations[i].lineNumber < locations[j].lineNumber
+		})
+	}
+	return ret
+}
+
+// referenceLineNumber returns the line number of the first line in a hunk containing the flag key or one of its aliases.
+// Falls back to the starting line number of the hunk if no lines were sent, e.g. when contextLines < 0.
+func referenceLineNumber(hunk ld.HunkRep, aliases []string, delimiters search.Delimiters) int {
+	if hunk.Lines == "" {
+		return hunk.StartingLineNumber
+	}
+	for i, line := range strings.Split(hunk.Lines, "\n") {
+		if delimiters.Match(line, hunk.FlagKey) {
+			return hunk.StartingLineNumber + i
+		}
+		for _, alias := range aliases {
+			if strings.Contains(line, alias) {
+				return hunk.StartingLineNumber + i
+			}
+		}
+	}
+	return hunk.StartingLineNumber
+}
+
+func prompt(reader *bufio.Reader, out io.Writer, question string) (string, error) {
+	fmt.Fprint(out, question)
+	answer, err := reader.ReadString('\n')
+	if err != nil && answer == "" {
+		return "", err
+	}
+	return strings.ToLower(strings.TrimSpace(answer)), nil
+}
+
+// runEditor opens a file at the given line using the +line convention supported by most terminal editors
+func runEditor(editor, path string, lineNumber int) error {
+	tokens := strings.Fields(editor)
+	args := append(tokens[1:], fmt.Sprintf("+%d", lineNumber), path)
+	/* #nosec */
+	cmd := exec.Command(tokens[0], args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
@@ -0,0 +1,93 @@
+package coderefs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+)
+
+func cleanupTestServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/v2/flags/default", r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("archived") == "true" {
+			_, _ = w.Write([]byte(`{"items":[{"key":"old-flag"}],"totalCount":1}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"items":[
+			{"key":"done-flag","variations":[{"value":true},{"value":false}],"environments":{"production":{"on":true,"fallthrough":{"variation":0}}}},
+			{"key":"active-flag","variations":[{"value":true},{"value":false}],"environments":{"production":{"on":false,"offVariation":1}}}
+		],"totalCount":2}`))
+	}))
+}
+
+func TestCleanup(t *testing.T) {
+	server := cleanupTestServer(t)
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "cleanup")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	code := "package main\n\nvar done = client.BoolVariation(\"done-flag\", user, false)\nvar old = client.BoolVariation(\"old-flag\", user, false)\nvar active = client.BoolVariation(\"active-flag\", user, false)\n"
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte(code), 0600))
+
+	// the editor records the location it is opened at
+	editorLog := filepath.Join(dir, "editor.log")
+	editor := filepath.Join(dir, "editor.sh")
+	require.NoError(t, ioutil.WriteFile(editor, []byte("#!/bin/sh\necho \"$@\" >> "+editorLog+"\n"), 0700))
+	previous, ok := os.LookupEnv("EDITOR")
+	require.NoError(t, os.Setenv("EDITOR", editor))
+	defer func() {
+		if ok {
+			os.Setenv("EDITOR", previous)
+		} else {
+			os.Unsetenv("EDITOR")
+		}
+	}()
+
+	opts := options.Options{
+		AccessToken:    "api-x",
+		BaseUri:        server.URL,
+		ProjKey:        "default",
+		Dir:            dir,
+		LineLengthUnit: "characters",
+		Symlinks:       "skip",
+	}
+	// an invalid selection, then a rolled out flag which is opened in the editor, then an archived flag which is not
+	in := strings.NewReader("x\n1\ny\n2\nn\nq\n")
+	var out bytes.Buffer
+	require.NoError(t, Cleanup(opts, in, &out, true, nil))
+
+	assert.Contains(t, out.String(), "1) done-flag (rolledOut, 1 references)")
+	assert.Contains(t, out.String(), "2) old-flag (archived, 1 references)")
+	assert.NotContains(t, out.String(), "active-flag", "flags which are not stale are not listed")
+	assert.Contains(t, out.String(), `invalid selection: "x"`)
+	assert.Contains(t, out.String(), "main.go:3\n     3 | var done")
+	assert.Contains(t, out.String(), "main.go:4\n     4 | var old")
+	data, err := ioutil.ReadFile(editorLog)
+	require.NoError(t, err)
+	assert.Equal(t, "+3 "+filepath.Join(dir, "main.go")+"\n", string(data), "only the accepted reference is opened")
+
+	out.Reset()
+	require.NoError(t, Cleanup(opts, strings.NewReader("q\n"), &out, false, []string{options.StaleArchived}))
+	assert.Contains(t, out.String(), "1) old-flag (archived, 1 references)")
+	assert.NotContains(t, out.String(), "done-flag", "only the selected stale policies are applied")
+}
+
+func TestCleanup_invalidPolicy(t *testing.T) {
+	server := cleanupTestServer(t)
+	defer server.Close()
+	ldApi := ld.InitApiClient(ld.ApiOptions{ApiKey: "api-x", ProjKey: "default", BaseUri: server.URL})
+	_, err := cleanupFlags(ldApi, []string{"unused"})
+	assert.EqualError(t, err, `invalid stale policy "unused": must be "archived" or "rolledOut"`)
+}
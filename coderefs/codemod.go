@@ -0,0 +1,191 @@
+package coderefs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/validation"
+)
+
+const codemodContextLines = 3
+
+type codemodLanguage string
+
+const (
+	golang     codemodLanguage = "go"
+	javascript codemodLanguage = "javascript"
+	python     codemodLanguage = "python"
+)
+
+var codemodLanguagesByExt = map[string]codemodLanguage{
+	".go":  golang,
+	".js":  javascript,
+	".jsx": javascript,
+	".ts":  javascript,
+	".tsx": javascript,
+	".py":  python,
+}
+
+// Simple SDK variation call shapes. FLAG_KEY is replaced with the quoted flag key, and only calls with simple
+// (non-nested) arguments are matched, so that replacements are always safe to review as a single line change.
+var codemodCallPatterns = map[codemodLanguage]string{
+	// e.g. client.BoolVariation("flag-key", user, false)
+	golang: `\b(?:\w+\.)+(?:Bool|String|Int|Float64)Variation\(\s*"FLAG_KEY"\s*,\s*[^,()]+,\s*[^,()]+\)`,
+	// e.g. client.variation('flag-key', false) or client.variation('flag-key', user, false)
+	javascript: `\b(?:\w+\.)+variation\(\s*(?:'FLAG_KEY'|"FLAG_KEY"|` + "`FLAG_KEY`" + `)\s*(?:,\s*[^,()]+){1,2}\)`,
+	// e.g. ldclient.get().variation("flag-key", user, False)
+	python: `\b(?:\w+(?:\(\))?\.)+variation\(\s*(?:'FLAG_KEY'|"FLAG_KEY")\s*,\s*[^,()]+,\s*[^,()]+\)`,
+}
+
+// literal formats a flag value as a literal in the given language. Returns false for values that cannot be written as a simple literal.
+func (l codemodLanguage) literal(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case bool:
+		if l == python {
+			if v {
+				return "True", true
+			}
+			return "False", true
+		}
+		return strconv.FormatBool(v), true
+	case string:
+		if l == golang {
+			return strconv.Quote(v), true
+		}
+		b, err := json.Marshal(v)
+		return string(b), err == nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	}
+	return "", false
+}
+
+// replacement returns the expression that should replace a variation call returning the given literal
+func (l codemodLanguage) replacement(literal string) string {
+	if l == golang {
+		// Go SDK variation methods return (value, error)
+		return literal + ", error(nil)"
+	}
+	return literal
+}
+
+// applyCodemods replaces simple variation calls for each flag in the given lines, returning the modified lines
+func applyCodemods(lang codemodLanguage, lines []string, flagValues map[string]interface{}) []string {
+	ret := make([]string, len(lines))
+	copy(ret, lines)
+	for flag, value := range flagValues {
+		literal, ok := lang.literal(value)
+		if !ok {
+			continue
+		}
+		pattern := regexp.MustCompile(strings.ReplaceAll(codemodCallPatterns[lang], "FLAG_KEY", regexp.QuoteMeta(flag)))
+		for i, line := range ret {
+			ret[i] = pattern.ReplaceAllLiteralString(line, lang.replacement(literal))
+		}
+	}
+	return ret
+}
+
+// unifiedDiff generates a unified diff for a file where lines have been replaced in place
+func unifiedDiff(path string, before, after []string) string {
+	changed := []int{}
+	for i := range before {
+		if before[i] != after[i] {
+			changed = append(changed, i)
+		}
+	}
+	if len(changed) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- a/%s\n+++ b/%s\n", path, path)
+	for i := 0; i < len(changed); {
+		start := changed[i] - codemodContextLines
+		if start < 0 {
+			start = 0
+		}
+		// Group changes whose context lines overlap into a single hunk
+		j := i
+		for j+1 < len(changed) && changed[j+1]-changed[j] <= 2*codemodContextLines {
+			j++
+		}
+		end := changed[j] + codemodContextLines + 1
+		if end > len(before) {
+			end = len(before)
+		}
+
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", start+1, end-start, start+1, end-start)
+		for k := start; k < end; k++ {
+			if before[k] == after[k] {
+				fmt.Fprintf(&sb, " %s\n", before[k])
+			} else {
+				fmt.Fprintf(&sb, "-%s\n+%s\n", before[k], after[k])
+			}
+		}
+		i = j + 1
+	}
+	return sb.String()
+}
+
+// generateCodemods returns a unified diff replacing variation calls for constant flags in all files with references to those flags
+func generateCodemods(dir string, refs []ld.ReferenceHunksRep, flagValues map[string]interface{}) (string, error) {
+	paths := []string{}
+	flagsByPath := map[string]map[string]interface{}{}
+	for _, ref := range refs {
+		if _, ok := codemodLanguagesByExt[filepath.Ext(ref.Path)]; !ok {
+			continue
+		}
+		for _, hunk := range ref.Hunks {
+			value, ok := flagValues[hunk.FlagKey]
+			if !ok {
+				continue
+			}
+			if flagsByPath[ref.Path] == nil {
+				flagsByPath[ref.Path] = map[string]interface{}{}
+				paths = append(paths, ref.Path)
+			}
+			flagsByPath[ref.Path][hunk.FlagKey] = value
+		}
+	}
+	sort.Strings(paths)
+
+	var sb strings.Builder
+	for _, path := range paths {
+		/* #nosec */
+		data, err := ioutil.ReadFile(filepath.Join(dir, path))
+		if err != nil {
+			return "", err
+		}
+		lines := strings.Split(string(data), "\n")
+		after := applyCodemods(codemodLanguagesByExt[filepath.Ext(path)], lines, flagsByPath[path])
+		sb.WriteString(unifiedDiff(path, lines, after))
+	}
+	return sb.String(), nil
+}
+
+// WriteCodemods writes suggested patches removing references to constant archived flags to outDir
+func WriteCodemods(dir, outDir, projKey, repo, tag string, refs []ld.ReferenceHunksRep, flagValues map[string]interface{}) (path string, err error) {
+	patch, err := generateCodemods(dir, refs, flagValues)
+	if err != nil {
+		return "", err
+	}
+	if patch == "" {
+		return "", nil
+	}
+
+	absPath, err := validation.NormalizeAndValidatePath(outDir)
+	if err != nil {
+		return "", fmt.Errorf("invalid outDir '%s': %w", outDir, err)
+	}
+	path = filepath.Join(absPath, fmt.Sprintf("codemods_%s_%s_%s.patch", projKey, repo, tag))
+	return path, ioutil.WriteFile(path, []byte(patch), os.FileMode(0644))
+}
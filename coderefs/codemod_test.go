@@ -0,0 +1,75 @@
+package coderefs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_applyCodemods(t *testing.T) {
+	specs := []struct {
+		name     string
+		lang     codemodLanguage
+		line     string
+		value    interface{}
+		expected string
+	}{
+		{
+			name:     "go bool variation",
+			lang:     golang,
+			line:     `enabled, _ := client.BoolVariation("my-flag", user, false)`,
+			value:    true,
+			expected: `enabled, _ := true, error(nil)`,
+		},
+		{
+			name:     "javascript client-side variation",
+			lang:     javascript,
+			line:     `const enabled = ldClient.variation('my-flag', false);`,
+			value:    true,
+			expected: `const enabled = true;`,
+		},
+		{
+			name:     "javascript server-side string variation",
+			lang:     javascript,
+			line:     `const color = ldClient.variation("my-flag", user, "red");`,
+			value:    "blue",
+			expected: `const color = "blue";`,
+		},
+		{
+			name:     "python variation",
+			lang:     python,
+			line:     `if ldclient.get().variation("my-flag", user, False):`,
+			value:    true,
+			expected: `if True:`,
+		},
+		{
+			name:     "does not replace other flags",
+			lang:     python,
+			line:     `if ldclient.get().variation("my-flag-2", user, False):`,
+			value:    true,
+			expected: `if ldclient.get().variation("my-flag-2", user, False):`,
+		},
+		{
+			name:     "does not replace json values",
+			lang:     javascript,
+			line:     `const config = ldClient.variation('my-flag', {});`,
+			value:    map[string]interface{}{},
+			expected: `const config = ldClient.variation('my-flag', {});`,
+		},
+	}
+
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			got := applyCodemods(tt.lang, []string{tt.line}, map[string]interface{}{"my-flag": tt.value})
+			assert.Equal(t, []string{tt.expected}, got)
+		})
+	}
+}
+
+func Test_unifiedDiff(t *testing.T) {
+	before := []string{"a", "b", "c", "d", "e"}
+	after := []string{"a", "b", "C", "d", "e"}
+	expected := "--- a/file.js\n+++ b/file.js\n@@ -1,5 +1,5 @@\n a\n b\n-c\n+C\n d\n e\n"
+	assert.Equal(t, expected, unifiedDiff("file.js", before, after))
+	assert.Equal(t, "", unifiedDiff("file.js", before, before))
+}
@@ -1,17 +1,26 @@
 package coderefs
 
 import (
+	"context"
+	"crypto"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/launchdarkly/ld-find-code-refs/internal/git"
 	"github.com/launchdarkly/ld-find-code-refs/internal/helpers"
 	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
 	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	"github.com/launchdarkly/ld-find-code-refs/internal/profile"
+	"github.com/launchdarkly/ld-find-code-refs/internal/provenance"
+	"github.com/launchdarkly/ld-find-code-refs/internal/tracing"
 	"github.com/launchdarkly/ld-find-code-refs/internal/validation"
 	"github.com/launchdarkly/ld-find-code-refs/internal/version"
+	"github.com/launchdarkly/ld-find-code-refs/internal/warnings"
 	"github.com/launchdarkly/ld-find-code-refs/options"
 	"github.com/launchdarkly/ld-find-code-refs/search"
 )
@@ -21,155 +30,609 @@ const (
 	maxProjKeyLength = 20 // Maximum project key length
 )
 
+// errServiceErrorIgnored stops a scan without failing, when a service error is ignored by the ignoreServiceErrors option
+var errServiceErrorIgnored = errors.New("service error ignored")
+
 // Scan checks the configured directory for flags base on the options configured for Code References.
 func Scan(opts options.Options) {
+	applyResourceLimits(opts)
+	var err error
+	if strings.TrimSpace(opts.Branches) != "" {
+		err = scanBranches(opts)
+	} else {
+		err = scan(opts, nil, nil)
+	}
+	if err != nil && err != errServiceErrorIgnored {
+		log.Error.Print(err)
+		os.Exit(ExitCode(err))
+	}
+}
+
+// scan runs a scan of a single repository. If cache is provided, flag keys and aliases are shared with other scans. If
+// result is provided, it is set to the manifest and code references of the scan once its outputs are written.
+func scan(opts options.Options, cache *scanCache, result *scanResult) (err error) {
+	opts = withNormalizedRepoName(opts)
+	opts = withPrivacyPreset(opts)
 	dir := opts.Dir
+	if opts.Archive != "" {
+		root, cleanup, err := extractArchive(opts.Archive)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		dir = root
+	}
 	absPath, err := validation.NormalizeAndValidatePath(dir)
 	if err != nil {
-		log.Error.Fatalf("could not validate directory option: %s", err)
+		return fmt.Errorf("could not validate directory option: %s", err)
 	}
 
 	log.Info.Printf("absolute directory path: %s", absPath)
 
+	// configuration is not read from archives
+	if opts.Archive == "" {
+		err = checkRepoCommands(opts)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.CheckUpdates {
+		CheckForUpdates()
+	}
+
+	strict, err := warnings.ParseCategories(opts.Strict)
+	if err != nil {
+		return fmt.Errorf(`invalid value for "strict": %w`, err)
+	}
+	warn := &warnings.Collector{}
+
+	suppressionConfig, err := options.ReadSuppressions(absPath)
+	if err != nil {
+		return err
+	}
+	suppressions, err := configureSuppressions(suppressionConfig)
+	if err != nil {
+		return err
+	}
+
+	var signer crypto.Signer
+	if opts.SigningKey != "" {
+		signer, err = provenance.LoadPrivateKey(opts.SigningKey)
+		if err != nil {
+			return fmt.Errorf(`invalid value for "signingKey": %w`, err)
+		}
+	}
+
+	ldApi := newApiClient(opts)
+	if opts.AllProjects {
+		// flags are retrieved from each project separately, the client is only used for APIs which are not specific to a project
+		ldApi.Options.ProjKey = ""
+	}
+
+	tracer := newTracer(opts)
+	tracer.Root().SetAttribute("ld.repository", opts.RepoName)
+	tracer.Root().SetAttribute("ld.project", opts.ProjKey)
+	ldApi.SetTracer(tracer)
+	defer func() {
+		exportTrace(tracer, err)
+	}()
+	timer := &profile.Timer{Tracer: tracer}
+	if opts.Profile != "" {
+		stopProfile := startProfile(opts.Profile, opts.OutDir)
+		defer stopProfile()
+	}
+	defer func() {
+		timer.Stop()
+		summaryLog := log.Info
+		if log.Pretty() {
+			// timings are only logged in interactive use when debugging, to keep console output brief
+			summaryLog = log.Debug
+		}
+		summaryLog.Printf("scan phase timings:\n%s", timer.Summary())
+		summaryLog.Printf("LaunchDarkly API requests:\n%s", ldApi.RequestSummary())
+	}()
+
+	timer.Start("git")
 	branchName := opts.Branch
 	revision := opts.Revision
 	var gitClient *git.Client
 	if revision == "" {
 		gitClient, err = git.NewClient(absPath, branchName)
 		if err != nil {
-			log.Error.Fatalf("%s", err)
+			if !git.IsRepository(absPath) {
+				return fmt.Errorf(`%s is not a git repository, set the "revision" and "branch" options to scan it without git: %w`, absPath, err)
+			}
+			return err
 		}
 		branchName = gitClient.GitBranch
 		revision = gitClient.GitSha
+	} else {
+		log.Info.Printf("revision is set, git is not used: flag extinctions will not be searched for, and stale branches will not be pruned")
 	}
 
 	projKey := opts.ProjKey
-	checkProjKey(projKey)
+	if opts.AllProjects {
+		projKey = allProjectsKey
+	} else {
+		checkProjKey(projKey)
+	}
+	branchName = strings.TrimPrefix(branchName, "refs/heads/")
+	if canonical := options.CanonicalBranch(opts.BranchAliases, branchName); canonical != branchName {
+		log.Info.Printf("scanning branch %s as %s", branchName, canonical)
+		branchName = canonical
+	}
+	tracer.Root().SetAttribute("ld.branch", branchName)
+	// code references found in a sample of files are only used to estimate totals, and are never sent to LaunchDarkly
+	sampleFraction, _ := opts.SampleFraction()
+	isDryRun := opts.DryRun || sampleFraction > 0
+
+	scanStart := time.Now()
+	if opts.Lock {
+		lock, err := acquireScanLock(opts.OutDir, projKey, opts.RepoName, branchName)
+		if errors.Is(err, errScanLocked) {
+			log.Warning.Printf("skipping scan of branch %s: %s", branchName, err)
+			if opts.Porcelain {
+				return writePorcelain(os.Stdout, porcelainSkipped, ld.BranchRep{Name: branchName}, 0, false, nil)
+			}
+			return nil
+		} else if err != nil {
+			return err
+		}
+		defer lock.release()
+	}
 
-	ldApi := ld.InitApiClient(ld.ApiOptions{ApiKey: opts.AccessToken, BaseUri: opts.BaseUri, ProjKey: projKey, UserAgent: "LDFindCodeRefs/" + version.Version})
-	repoParams := ld.RepoParams{
-		Type:              opts.RepoType,
-		Name:              opts.RepoName,
-		Url:               opts.RepoUrl,
-		CommitUrlTemplate: opts.CommitUrlTemplate,
-		HunkUrlTemplate:   opts.HunkUrlTemplate,
-		DefaultBranch:     opts.DefaultBranch,
+	if opts.Hooks.PreScan != "" {
+		timer.Start("hook: " + hookPreScan)
+		preScan := manifest{ProjKey: projKey, RepoName: opts.RepoName, Branch: branchName, Revision: revision}
+		err = runLifecycleHook(hookPreScan, opts.Hooks.PreScan, absPath, hookEnv(hookPreScan, preScan, absPath, isDryRun, false))
+		if err != nil {
+			return err
+		}
 	}
 
-	isDryRun := opts.DryRun
+	repoParams := newRepoParams(opts)
 
 	ignoreServiceErrors := opts.IgnoreServiceErrors
-	if !isDryRun {
+	// dry runs with offline flags do not otherwise use the LaunchDarkly API, so they can run without network access
+	if !isDryRun || opts.OfflineFlags == "" {
+		timer.Start("api: preflight")
+		// dry runs and deferred uploads do not update the repository, so write access is not required
+		writeRepo := ""
+		if !isDryRun && !opts.DeferUpload {
+			writeRepo = repoParams.Name
+		}
+		err = ldApi.PreflightCheck(writeRepo)
+		if err != nil {
+			return serviceError(fmt.Errorf("access token preflight check failed: %w", err), ignoreServiceErrors)
+		}
+	}
+
+	projKeys := []string{projKey}
+	if opts.AllProjects {
+		timer.Start("api: list projects")
+		projKeys, err = ldApi.GetProjectKeys()
+		if err != nil {
+			return serviceError(fmt.Errorf("could not list LaunchDarkly projects: %w", err), ignoreServiceErrors)
+		}
+		log.Info.Printf("searching for flags from %d projects: %s", len(projKeys), strings.Join(projKeys, ", "))
+	}
+
+	if !isDryRun && !opts.DeferUpload {
+		timer.Start("api: update repository")
 		err = ldApi.MaybeUpsertCodeReferenceRepository(repoParams)
+		if err == ld.RepositoryDisabledErr && repoParams.Enabled != nil && !*repoParams.Enabled {
+			log.Info.Printf("repository %s is disabled by repoMetadata configuration, code references will not be sent to LaunchDarkly", repoParams.Name)
+			return nil
+		}
 		if err != nil {
-			fatalServiceError(err, ignoreServiceErrors)
+			return serviceError(err, ignoreServiceErrors)
 		}
 	}
 
-	flags, err := getFlags(ldApi)
+	timer.Start("api: get flags")
+	flags, projectFlags, err := getProjectFlags(opts, ldApi, cache, projKeys)
 	if err != nil {
-		fatalServiceError(fmt.Errorf("could not retrieve flag keys from LaunchDarkly: %w", err), ignoreServiceErrors)
+		return serviceError(fmt.Errorf("could not retrieve flag keys from LaunchDarkly: %w", err), ignoreServiceErrors)
 	}
 
 	filteredFlags, omittedFlags := filterShortFlagKeys(flags)
-	if len(filteredFlags) == 0 {
+	searchShortKeys := opts.ShortFlagKeys == "sdkCalls" && len(omittedFlags) > 0
+	if len(filteredFlags) == 0 && !searchShortKeys {
 		log.Info.Printf("no flag keys longer than the minimum flag key length (%v) were found for project: %s, exiting early",
-			minFlagKeyLen, projKey)
-		os.Exit(0)
+			minFlagKeyLen, strings.Join(projKeys, ", "))
+		return nil
+	} else if searchShortKeys {
+		log.Info.Printf("searching for %d flags with keys less than minimum (%d) in SDK evaluation calls only", len(omittedFlags), minFlagKeyLen)
 	} else if len(omittedFlags) > 0 {
-		log.Warning.Printf("omitting %d flags with keys less than minimum (%d)", len(omittedFlags), minFlagKeyLen)
+		warn.Add(warnings.FlagsOmittedShort, "", "omitting %d flags with keys less than minimum (%d)", len(omittedFlags), minFlagKeyLen)
 	}
 
-	aliases, err := GenerateAliases(filteredFlags, opts.Aliases, dir)
+	timer.Start("generate aliases")
+	aliases, rules, err := cache.generateAliases(opts, filteredFlags, dir)
 	if err != nil {
-		log.Error.Fatalf("failed to create flag key aliases: %v", err)
+		return fmt.Errorf("failed to create flag key aliases: %v", err)
+	}
+	shortKeys := map[string]bool{}
+	if searchShortKeys {
+		// aliases are not generated for short keys, which are only reported in SDK evaluation calls. Aliases may be shared
+		// with other scans, so they are copied rather than modified.
+		searched := make(map[string][]string, len(aliases)+len(omittedFlags))
+		for flag, flagAliases := range aliases {
+			searched[flag] = flagAliases
+		}
+		for _, flag := range omittedFlags {
+			searched[flag] = []string{}
+			shortKeys[flag] = true
+		}
+		aliases = searched
 	}
 
-	ctxLines := opts.ContextLines
+	ctxLines := configureContextLines(opts)
 	var updateId *int
 	if opts.UpdateSequenceId >= 0 {
 		updateIdOption := opts.UpdateSequenceId
 		updateId = &updateIdOption
+	} else if opts.Lock {
+		// code references from scans which started later take precedence, whichever scan finishes first
+		startId := int(scanStart.UnixNano() / int64(time.Millisecond))
+		updateId = &startId
+		log.Info.Printf("using the scan start time %d as the updateSequenceId, later scans of branch %s must use a greater updateSequenceId", startId, branchName)
 	}
 
-	// Configure delimiters
-	delims := []string{`"`, `'`, "`"}
-	if opts.Delimiters.DisableDefaults {
-		delims = []string{}
+	delimiters := configureDelimiters(opts, rules)
+	timer.Start("search")
+	// the search of each top-level directory is recorded as a child span of the search
+	searchCtx := tracing.ContextWithSpan(context.Background(), timer.Span())
+	if opts.MaxScanTime > 0 {
+		var cancel context.CancelFunc
+		searchCtx, cancel = context.WithTimeout(searchCtx, time.Duration(opts.MaxScanTime)*time.Second)
+		defer cancel()
+	}
+	// only the search of checked out files is interrupted by signals
+	interruptCtx := searchCtx
+	var interrupt *signalInterrupt
+	if opts.PartialUploadOnSignal {
+		interruptCtx, interrupt = interruptOnSignal(searchCtx)
+	}
+	searchOpts := search.Options{
+		ProjKey:        projKey,
+		Workspace:      absPath,
+		Aliases:        aliases,
+		ContextLines:   ctxLines,
+		Delimiters:     delimiters,
+		LineLengthUnit: search.LineLengthUnit(opts.LineLengthUnit),
+		MergeLines:     opts.HunkMergeLines,
+		Symlinks:       search.SymlinkPolicy(opts.Symlinks),
+		GitAttributes:  opts.GitAttributes,
+		MaxFileSize:    int64(opts.MaxFileSizeKb) * 1024,
+		Cache:          openContentCache(opts.ContentCache, cache),
+		Warnings:       warn,
+	}
+	if sampleFraction > 0 {
+		searchOpts.Sample = search.NewSample(sampleFraction)
+	}
+	refs, err := search.SearchForRefs(interruptCtx, searchOpts)
+	// read before stopping the signal handler, which cancels interruptCtx
+	searchErr := interruptCtx.Err()
+	if interrupt != nil {
+		// signals received after the search terminate the process as usual
+		interrupt.stop()
 	}
-	delims = append(delims, opts.Delimiters.Additional...)
-	delimString := strings.Join(helpers.Dedupe(delims), "")
-	refs, err := search.SearchForRefs(projKey, absPath, aliases, ctxLines, delimString)
 	if err != nil {
-		log.Error.Fatalf("error searching for flag key references: %s", err)
+		return fmt.Errorf("error searching for flag key references: %s", err)
+	}
+	var interrupted os.Signal
+	if interrupt != nil && searchErr == context.Canceled {
+		interrupted = interrupt.signal()
+	}
+	// the scan is partial if the search was stopped, so files excluded by sparse checkout are not searched
+	if gitClient != nil && searchErr == nil {
+		refs = search.AppendRefs(refs, searchSparsePaths(searchCtx, gitClient, opts.SparsePaths, searchOpts), warn)
+		// maxScanTime may be exceeded while searching sparse paths
+		searchErr = searchCtx.Err()
+	}
+	saveContentCache(searchOpts.Cache)
+	timer.Start("process references")
+	if opts.SourceMaps {
+		refs = search.ResolveSourceMaps(absPath, refs, ctxLines, search.LineLengthUnit(opts.LineLengthUnit))
+	}
+	if opts.SDKCalls {
+		tagged := search.TagSDKCalls(absPath, refs, configureSDKs(opts))
+		log.Info.Printf("found %d code references in SDK evaluation calls", tagged)
+	}
+	search.ScoreConfidence(absPath, refs, aliases, delimiters, configureSDKs(opts))
+	if len(shortKeys) > 0 {
+		var removed int
+		refs, removed = search.FilterFlagConfidence(refs, shortKeys, ld.ConfidenceSDKCall)
+		log.Info.Printf("omitted %d code references to flags with short keys outside of SDK evaluation calls", removed)
+	}
+	aliasOnly := search.TagAliasMatches(absPath, refs, delimiters, rules.names)
+	log.Info.Printf("found %d code references which only match aliases", aliasOnly)
+	if minConfidence, err := ld.ParseConfidence(opts.MinConfidence); err == nil && minConfidence > ld.ConfidenceSubstring {
+		var removed int
+		refs, removed = search.FilterConfidence(refs, minConfidence)
+		log.Info.Printf("omitted %d code references with a confidence lower than %s", removed, minConfidence)
+	}
+	if len(suppressions) > 0 {
+		var suppressed int
+		refs, suppressed = search.Suppress(absPath, refs, suppressions)
+		log.Info.Printf("omitted %d code references matching suppressions", suppressed)
+	}
+	if opts.WriteBaseline {
+		path, added, err := writeBaseline(absPath, suppressionConfig, refs)
+		if err != nil {
+			return err
+		}
+		log.Info.Printf("added %d suppressions to %s, code references will not be sent to LaunchDarkly", added, path)
+		return nil
+	}
+	if opts.AllProjects {
+		refs = attributeProjects(refs, projKeys, projectFlags)
+	}
+	// a deadline which passes after the search, while processing references, does not make the results partial
+	isPartial := searchErr == context.DeadlineExceeded
+	if isPartial {
+		warn.Add(warnings.ScanTimedOut, "", "PARTIAL RESULTS: search exceeded maxScanTime (%ds), code references will only include files searched before the deadline", opts.MaxScanTime)
+	} else if interrupted != nil {
+		if len(refs) == 0 {
+			return fmt.Errorf("search was interrupted by %s before any code references were found", interrupted)
+		}
+		isPartial = true
+		warn.Add(warnings.ScanInterrupted, "", "PARTIAL RESULTS: search was interrupted by %s, code references will only include files searched before the signal", interrupted)
+		var ok bool
+		updateId, ok = partialUpdateSequenceId(updateId, opts.UpdateSequenceId < 0 && opts.Lock)
+		if !ok {
+			return fmt.Errorf("search was interrupted by %s, partial code references cannot be sent with an updateSequenceId of 0", interrupted)
+		}
 	}
 
 	branch := ld.BranchRep{
-		Name:             strings.TrimPrefix(branchName, "refs/heads/"),
+		Name:             branchName,
 		Head:             revision,
 		UpdateSequenceId: updateId,
 		SyncTime:         makeTimestamp(),
 		References:       refs,
 	}
+	tracer.Root().SetAttribute("ld.references", branch.TotalHunkCount())
+	tracer.Root().SetAttribute("ld.partial", isPartial)
+	if searchOpts.Sample != nil {
+		err = writeEstimates(opts.OutDir, projKey, repoParams.Name, branch, filteredFlags, searchOpts.Sample)
+		if err != nil {
+			return err
+		}
+		if summary := warn.Summary(); summary != "" {
+			log.Warning.Printf("scan raised %s", summary)
+		}
+		return warn.Check(strict)
+	}
+	var metadata map[string]ld.FlagMetadata
+	if opts.FlagMetadata {
+		timer.Start("api: get flag metadata")
+		metadata = flagMetadata(opts, ldApi)
+		addFlagMetadata(branch, metadata)
+	}
+
+	// code references sent to LaunchDarkly have anonymized paths, while outputs which stay local keep the original paths
+	uploadBranch := branch
+	if opts.AnonymizePaths {
+		uploadBranch = anonymizePaths(branch, repoParams.Name, opts.AnonymizeKey)
+		log.Info.Printf("file paths will be anonymized before code references are sent to LaunchDarkly")
+	}
+
+	// branches on the remote are listed before outputs are written, so outputs report whether stale branches will be pruned
+	var remoteBranches *branchList
+	if gitClient != nil && !isDryRun && !opts.DeferUpload {
+		timer.Start("list remote branches")
+		list, err := getRemoteBranches(opts, gitClient)
+		if err != nil {
+			warn.Add(warnings.PruneSkippedNoRemote, "", "code references for deleted branches will not be pruned: %s", err)
+		} else {
+			remoteBranches = &list
+		}
+	}
 
+	manifest := newManifest(projKey, repoParams.Name, branch, len(filteredFlags), isPartial, warn.Warnings())
+	printPorcelain := func(outcome string) error {
+		if !opts.Porcelain {
+			return nil
+		}
+		return writePorcelain(os.Stdout, outcome, branch, len(filteredFlags), isPartial, warn.Warnings())
+	}
 	outDir := opts.OutDir
 	if outDir != "" {
-		outPath, err := branch.WriteToCSV(outDir, projKey, repoParams.Name, revision)
+		timer.Start("write outputs")
+		outPath, err := branch.WriteToCSV(outDir, projKey, repoParams.Name, revision, opts.CSVComma())
 		if err != nil {
-			log.Error.Fatalf("error writing code references to csv: %s", err)
+			return fmt.Errorf("error writing code references to csv: %s", err)
 		}
 		log.Info.Printf("wrote code references to %s", outPath)
+
+		artifacts := []string{outPath}
+		if opts.DeferUpload {
+			branchPath, err := uploadBranch.WriteToJSON(outDir, projKey, repoParams.Name, revision)
+			if err != nil {
+				return fmt.Errorf("error writing branch for deferred upload: %s", err)
+			}
+			log.Info.Printf("wrote branch for deferred upload to %s", branchPath)
+			artifacts = append(artifacts, branchPath)
+		}
+		if opts.CompareRuns {
+			summaryPath, err := compareWithPreviousRun(outDir, projKey, repoParams.Name, branch, isPartial)
+			if err != nil {
+				return fmt.Errorf("error comparing code references with the previous scan: %s", err)
+			}
+			if summaryPath != "" {
+				artifacts = append(artifacts, summaryPath)
+			}
+		}
+		if opts.SonarQubeIssues {
+			if issuesPath := writeSonarQubeIssues(opts, ldApi, outDir, projKey, repoParams.Name, revision, branch, isPartial); issuesPath != "" {
+				artifacts = append(artifacts, issuesPath)
+			}
+		}
+		if opts.Xlsx {
+			if xlsxPath := writeXLSX(opts, ldApi, repoParams, outDir, projKey, revision, branch); xlsxPath != "" {
+				artifacts = append(artifacts, xlsxPath)
+			}
+		}
+		if opts.SuggestCodemods {
+			if codemodPath := writeCodemodSuggestions(ldApi, absPath, outDir, projKey, repoParams.Name, revision, branch); codemodPath != "" {
+				artifacts = append(artifacts, codemodPath)
+			}
+		}
+
+		err = manifest.addArtifacts(artifacts...)
+		if err != nil {
+			return fmt.Errorf("error writing scan manifest: %s", err)
+		}
+		manifestPath, err := manifest.write(outDir, signer)
+		if err != nil {
+			return fmt.Errorf("error writing scan manifest: %s", err)
+		}
+		if signer != nil {
+			log.Info.Printf("wrote signed scan manifest to %s", manifestPath)
+		} else {
+			log.Info.Printf("wrote scan manifest to %s", manifestPath)
+		}
+	}
+
+	scanned := newScanResult(manifest, branch, metadata)
+	if outputs, _ := opts.OutputFiles(); len(outputs) > 0 {
+		timer.Start("outputs")
+		err = writeOutputs(outputs, scanned, branch, opts.CSVComma(), delimiters)
+		if err != nil {
+			return err
+		}
 	}
 
-	if opts.Debug {
-		branch.PrintReferenceCountTable()
+	if result != nil {
+		*result = scanned
+	}
+	if opts.OutputHook != "" {
+		timer.Start("output hook")
+		err = runOutputHook(opts.OutputHook, absPath, scanned)
+		if err != nil {
+			return err
+		}
 	}
 
+	if opts.Hooks.PostScan != "" {
+		timer.Start("hook: " + hookPostScan)
+		err = runLifecycleHook(hookPostScan, opts.Hooks.PostScan, absPath, hookEnv(hookPostScan, manifest, absPath, isDryRun, true))
+		if err != nil {
+			return err
+		}
+	}
+
+	if summary := warn.Summary(); summary != "" {
+		log.Warning.Printf("scan raised %s", summary)
+	}
+	err = warn.Check(strict)
+	if err != nil {
+		return err
+	}
+
+	if opts.Report != "" || log.Enabled("coderefs", log.LevelDebug) {
+		branch.PrintReferenceCountTable(log.Console(), reportOptions(opts, ldApi))
+	}
+	if opts.PreviewLinks {
+		printLinkPreview(log.Console(), repoParams, branch, revision)
+	}
+	publishChecks(opts, ldApi, revision, branch, isPartial)
+	publishJiraIssues(opts, ldApi, repoParams.Name, revision, branch, isDryRun, isPartial)
+
 	if isDryRun {
-		log.Info.Printf(
+		log.Success.Printf(
 			"dry run found %d code references across %d flags and %d files",
 			branch.TotalHunkCount(),
 			len(filteredFlags),
 			len(branch.References),
 		)
-		return
+		return printPorcelain(porcelainDryRun)
+	}
+
+	if opts.DeferUpload {
+		log.Success.Printf(
+			"found %d code references across %d flags and %d files, code references will be sent to LaunchDarkly by the upload command",
+			branch.TotalHunkCount(),
+			len(filteredFlags),
+			len(branch.References),
+		)
+		return printPorcelain(porcelainDeferred)
 	}
 
+	partialLabel := ""
+	if isPartial {
+		partialLabel = "partial "
+	}
 	log.Info.Printf(
-		"sending %d code references across %d flags and %d files to LaunchDarkly for project: %s",
+		"sending %d %scode references across %d flags and %d files to LaunchDarkly for project: %s",
 		branch.TotalHunkCount(),
+		partialLabel,
 		len(filteredFlags),
 		len(branch.References),
-		projKey,
+		strings.Join(projKeys, ", "),
 	)
-	err = ldApi.PutCodeReferenceBranch(branch, repoParams.Name)
+	timer.Start("api: upload references")
+	err = ldApi.PutCodeReferenceBranch(uploadBranch, repoParams.Name)
 	switch {
 	case err == ld.BranchUpdateSequenceIdConflictErr:
 		if branch.UpdateSequenceId != nil {
 			log.Warning.Printf("updateSequenceId (%d) must be greater than previously submitted updateSequenceId", *branch.UpdateSequenceId)
 		}
+		err = printPorcelain(porcelainSkipped)
+		if err != nil {
+			return err
+		}
 	case err == ld.EntityTooLargeErr:
-		log.Error.Fatalf("code reference payload too large for LaunchDarkly API - consider excluding more files with .ldignore")
+		return errors.New("code reference payload too large for LaunchDarkly API - consider excluding more files with .ldignore")
 	case err != nil:
-		fatalServiceError(fmt.Errorf("error sending code references to LaunchDarkly: %w", err), ignoreServiceErrors)
+		return serviceError(fmt.Errorf("error sending code references to LaunchDarkly: %w", err), ignoreServiceErrors)
+	default:
+		log.Success.Printf("sent %d code references to LaunchDarkly", branch.TotalHunkCount())
+		err = printPorcelain(porcelainUploaded)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.Hooks.PostUpload != "" {
+		timer.Start("hook: " + hookPostUpload)
+		err = runLifecycleHook(hookPostUpload, opts.Hooks.PostUpload, absPath, hookEnv(hookPostUpload, manifest, absPath, isDryRun, true))
+		if err != nil {
+			return err
+		}
 	}
 
 	if gitClient != nil {
 		lookback := opts.Lookback
-		if lookback > 0 {
-			missingFlags := []string{}
-			for flag, count := range branch.CountByFlag(filteredFlags) {
-				if count == 0 {
-					missingFlags = append(missingFlags, flag)
+		if lookback > 0 && gitClient.IsShallow() {
+			log.Info.Printf("shallow clone detected, flag extinctions will only be searched for within the available commit history")
+		}
+		if isPartial && lookback > 0 {
+			// flags may be missing references because they were not searched, so they cannot be considered extinct
+			log.Warning.Printf("skipping flag extinction search because code references are partial")
+		} else if lookback > 0 {
+			timer.Start("extinctions")
+			counts := branch.CountByFlag(filteredFlags)
+			removedFlags := []ld.ExtinctionRep{}
+			for _, projKey := range projKeys {
+				projFlags, _ := filterShortFlagKeys(projectFlags[projKey])
+				missingFlags := []string{}
+				for _, flag := range projFlags {
+					if counts[flag] == 0 {
+						missingFlags = append(missingFlags, flag)
+					}
 				}
-
-			}
-			log.Info.Printf("checking if %d flags without references were removed in the last %d commits", len(missingFlags), opts.Lookback)
-			removedFlags, err := gitClient.FindExtinctions(projKey, missingFlags, delimString, lookback+1)
-			if err != nil {
-				log.Warning.Printf("unable to generate flag extinctions: %s", err)
-			} else {
-				log.Info.Printf("found %d removed flags", len(removedFlags))
+				log.Info.Printf("checking if %d flags without references were removed in the last %d commits", len(missingFlags), opts.Lookback)
+				removed, err := gitClient.FindExtinctions(projKey, missingFlags, delimiters, lookback+1)
+				if err != nil {
+					log.Warning.Printf("unable to generate flag extinctions: %s", err)
+				} else {
+					log.Info.Printf("found %d removed flags", len(removed))
+				}
+				removedFlags = append(removedFlags, removed...)
 			}
 			if len(removedFlags) > 0 {
 				err = ldApi.PostExtinctionEvents(removedFlags, repoParams.Name, branch.Name)
@@ -178,34 +641,264 @@ func Scan(opts options.Options) {
 				}
 			}
 		}
-		log.Info.Printf("attempting to prune old code reference data from LaunchDarkly")
-		remoteBranches, err := gitClient.RemoteBranches()
-		if err != nil {
-			log.Warning.Printf("unable to retrieve branch list from remote, skipping code reference pruning: %s", err)
-		} else {
-			err = deleteStaleBranches(ldApi, repoParams.Name, remoteBranches)
+		if remoteBranches != nil {
+			timer.Start("prune branches")
+			log.Info.Printf("attempting to prune old code reference data from LaunchDarkly")
+			err = deleteStaleBranches(ldApi, repoParams.Name, *remoteBranches)
 			if err != nil {
-				fatalServiceError(fmt.Errorf("failed to mark old branches for code reference pruning: %w", err), ignoreServiceErrors)
+				return serviceError(fmt.Errorf("failed to mark old branches for code reference pruning: %w", err), ignoreServiceErrors)
 			}
 		}
 	}
+	return nil
+}
+
+// newRepoParams returns the configuration of the code references repository in LaunchDarkly
+func newRepoParams(opts options.Options) ld.RepoParams {
+	params := ld.RepoParams{
+		Type:              opts.RepoType,
+		Name:              opts.RepoName,
+		Url:               opts.RepoUrl,
+		CommitUrlTemplate: opts.CommitUrlTemplate,
+		HunkUrlTemplate:   opts.HunkUrlTemplate,
+		DefaultBranch:     opts.DefaultBranch,
+		Description:       opts.RepoMetadata.Description,
+		Tags:              opts.RepoMetadata.Tags,
+		Enabled:           opts.RepoMetadata.Enabled,
+	}
+	if opts.UrlStyle != "" {
+		return urlStyleRepoParams(params, opts.UrlStyle)
+	}
+	switch strings.ToLower(opts.RepoType) {
+	case repoTypeBitbucketServer:
+		params = bitbucketServerRepoParams(params)
+	case repoTypeGithub:
+		params = githubEnterpriseRepoParams(params)
+	}
+	return params
+}
+
+// withNormalizedRepoName normalizes the repoName option unless normalizeRepoName is disabled, warning if the name was changed
+func withNormalizedRepoName(opts options.Options) options.Options {
+	if !opts.NormalizeRepoName {
+		return opts
+	}
+	name := options.NormalizeRepoName(opts.RepoName)
+	if name != opts.RepoName {
+		log.Warning.Printf("normalized repoName %q to %q, set repoName to %q to silence this warning", opts.RepoName, name, name)
+		opts.RepoName = name
+	}
+	return opts
+}
+
+// withPrivacyPreset restricts the options to the data allowed by the privacyPreset option, logging each option changed
+func withPrivacyPreset(opts options.Options) options.Options {
+	if opts.PrivacyPreset == "" {
+		return opts
+	}
+	opts, changes := opts.WithPrivacyPreset()
+	for _, change := range changes {
+		log.Warning.Printf("privacyPreset %s: %s", opts.PrivacyPreset, change)
+	}
+	log.Info.Printf("privacyPreset %s: sending %s to LaunchDarkly", opts.PrivacyPreset, describeSentData(opts))
+	return opts
+}
+
+// describeSentData describes the source code and paths sent to LaunchDarkly with code references
+func describeSentData(opts options.Options) string {
+	lines := "no source code"
+	// lines are removed when paths are anonymized
+	if opts.AnonymizePaths {
+		return lines + " and anonymized file paths"
+	}
+	if opts.ContextLines == 0 {
+		lines = "the lines containing flag references"
+	} else if opts.ContextLines > 0 {
+		lines = fmt.Sprintf("the lines containing flag references with up to %d context lines", opts.ContextLines)
+	}
+	return lines + " and file paths"
+}
+
+// searchSparsePaths handles tracked files which are not present in a sparse checkout. If policy is "fetch", the files
+// are read from the git object database, fetching them from the remote if necessary. Otherwise, the excluded paths are reported.
+func searchSparsePaths(ctx context.Context, gitClient *git.Client, policy string, searchOpts search.Options) []ld.ReferenceHunksRep {
+	warn := searchOpts.Warnings
+	excluded, err := gitClient.SparsePaths()
+	if err != nil {
+		log.Warning.Printf("unable to detect paths excluded by sparse checkout: %s", err)
+		return nil
+	}
+	paths := make([]string, 0, len(excluded))
+	for _, path := range excluded {
+		if searchOpts.Sample.Includes(path) {
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+
+	if policy != "fetch" {
+		warn.Add(warnings.SparseFilesSkipped, "", "%d tracked files are excluded by sparse checkout and were not searched, set the sparsePaths option to 'fetch' to search them", len(paths))
+		for _, path := range paths {
+			log.Debug.Printf("not searched: %s", path)
+		}
+		return nil
+	}
+
+	if gitClient.IsPartialClone() {
+		log.Info.Printf("partial clone detected, %d files excluded by sparse checkout may be fetched from the remote", len(paths))
+	}
+	contents, err := gitClient.ReadFiles(ctx, paths, searchOpts.MaxFileSize, warn)
+	if err != nil {
+		warn.Add(warnings.SparseFilesSkipped, "", "unable to read %d files excluded by sparse checkout, these files were not searched: %s", len(paths), err)
+		return nil
+	}
+	if len(contents) < len(paths) {
+		warn.Add(warnings.SparseFilesSkipped, "", "%d files excluded by sparse checkout could not be read or were too large, and were not searched", len(paths)-len(contents))
+	}
+	return search.SearchContents(searchOpts, contents)
+}
+
+// openContentCache opens the content cache stored in dir, shared with other scans through cache. Returns nil if dir is
+// not set, or if the cache cannot be opened, in which case every file is searched.
+func openContentCache(dir string, cache *scanCache) *search.ContentCache {
+	if dir == "" {
+		return nil
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		log.Warning.Printf("unable to open content cache %s, all files will be searched: %s", dir, err)
+		return nil
+	}
+	contents, err := cache.openContentCache(absDir)
+	if err != nil {
+		log.Warning.Printf("unable to open content cache %s, all files will be searched: %s", dir, err)
+		return nil
+	}
+	return contents
+}
+
+// saveContentCache stores the code references found by a search in the content cache, for later scans to reuse
+func saveContentCache(contents *search.ContentCache) {
+	if contents == nil {
+		return
+	}
+	hits, misses := contents.Stats()
+	log.Info.Printf("reused code references of %d files from the content cache, searched %d files", hits, misses)
+	if err := contents.Save(); err != nil {
+		log.Warning.Printf("unable to save content cache: %s", err)
+	}
+}
+
+// startProfile begins collecting a profile, writing it to outDir, or the current working directory if outDir is not set
+func startProfile(kind, outDir string) func() {
+	if outDir == "" {
+		outDir = "."
+	}
+	stop, err := profile.Start(kind, outDir)
+	if err != nil {
+		log.Warning.Printf("unable to start %s profile: %s", kind, err)
+		return func() {}
+	}
+	return func() {
+		path, err := stop()
+		if err != nil {
+			log.Warning.Printf("unable to write %s profile: %s", kind, err)
+			return
+		}
+		log.Info.Printf("wrote %s profile to %s", kind, path)
+	}
+}
+
+// writeCodemodSuggestions writes patch suggestions for references to archived flags which serve a constant value, and
+// returns the path of the patch file. Returns an empty path if no patch file was written.
+func writeCodemodSuggestions(ldApi ld.ApiClient, dir, outDir, projKey, repoName, revision string, branch ld.BranchRep) string {
+	flagValues, err := ldApi.GetArchivedFlagConstantValues()
+	if err != nil {
+		log.Warning.Printf("unable to retrieve archived flags from LaunchDarkly, skipping codemod suggestions: %s", err)
+		return ""
+	}
+	tag := branch.Name
+	if len(revision) >= 7 {
+		tag = revision[:7]
+	}
+	path, err := WriteCodemods(dir, outDir, projKey, repoName, tag, branch.References, flagValues)
+	if err != nil {
+		log.Warning.Printf("error writing codemod suggestions: %s", err)
+		return ""
+	} else if path != "" {
+		log.Info.Printf("wrote codemod suggestions for %d archived flags to %s", len(flagValues), path)
+	}
+	return path
+}
+
+// configureDelimiters combines the default and user-configured delimiters, and configures which flag keys and aliases
+// are matched regardless of case
+func configureDelimiters(opts options.Options, rules aliasRules) search.Delimiters {
+	delims := []string{`"`, `'`, "`"}
+	if opts.Delimiters.DisableDefaults {
+		delims = []string{}
+	}
+	delims = append(delims, opts.Delimiters.Additional...)
+	delimiters := search.NewDelimiters(strings.Join(helpers.Dedupe(delims), ""))
+	for _, p := range opts.Delimiters.Pairs {
+		delimiters.Pairs = append(delimiters.Pairs, search.DelimiterPair{Open: p.Open, Close: p.Close})
+	}
+	delimiters.CaseInsensitive = opts.CaseInsensitive
+	delimiters.CaseInsensitiveAliases = rules.caseInsensitive
+	delimiters.SkipDataLines = opts.SkipDataLines
+	return delimiters
+}
+
+// configureSDKs returns the SDK APIs whose evaluation calls are recognized
+func configureSDKs(opts options.Options) []string {
+	sdks := []string{}
+	for _, sdk := range strings.Split(opts.SDKs, ",") {
+		if sdk = strings.TrimSpace(sdk); sdk != "" {
+			sdks = append(sdks, sdk)
+		}
+	}
+	return sdks
+}
+
+// configureContextLines combines the contextLines option with any per-flag or per-path overrides
+func configureContextLines(opts options.Options) search.ContextLines {
+	overrides := make([]search.ContextLinesOverride, 0, len(opts.ContextLineOverrides))
+	for _, o := range opts.ContextLineOverrides {
+		overrides = append(overrides, search.ContextLinesOverride{Flags: o.Flags, Paths: o.Paths, Lines: o.ContextLines})
+	}
+	return search.NewContextLines(opts.ContextLines, overrides)
 }
 
 func Prune(opts options.Options, branches []string) {
-	ldApi := ld.InitApiClient(ld.ApiOptions{ApiKey: opts.AccessToken, BaseUri: opts.BaseUri, ProjKey: opts.ProjKey, UserAgent: "LDFindCodeRefs/" + version.Version})
+	opts = withNormalizedRepoName(opts)
+	ldApi := ld.InitApiClient(apiOptions(opts))
 	err := ldApi.PostDeleteBranchesTask(opts.RepoName, branches)
 	if err != nil {
 		fatalServiceError(err, opts.IgnoreServiceErrors)
 	}
 }
 
-func deleteStaleBranches(ldApi ld.ApiClient, repoName string, remoteBranches map[string]bool) error {
+// deleteStaleBranches marks branches which are no longer on the remote for pruning. If the branch list was not retrieved
+// from the remote, branches sent to LaunchDarkly since the list was retrieved are kept, as they may have been created since.
+func deleteStaleBranches(ldApi ld.ApiClient, repoName string, remoteBranches branchList) error {
 	branches, err := ldApi.GetCodeReferenceRepositoryBranches(repoName)
 	if err != nil {
 		return err
 	}
+	if !remoteBranches.Live {
+		listedAt := remoteBranches.ListedAt.UnixNano() / int64(time.Millisecond)
+		listed := make([]ld.BranchRep, 0, len(branches))
+		for _, branch := range branches {
+			if branch.SyncTime <= listedAt {
+				listed = append(listed, branch)
+			}
+		}
+		branches = listed
+	}
 
-	staleBranches := calculateStaleBranches(branches, remoteBranches)
+	staleBranches := calculateStaleBranches(branches, remoteBranches.Branches)
 	if len(staleBranches) > 0 {
 		log.Debug.Printf("marking stale branches for code reference pruning: %v", staleBranches)
 		err = ldApi.PostDeleteBranchesTask(repoName, staleBranches)
@@ -217,10 +910,16 @@ func deleteStaleBranches(ldApi ld.ApiClient, repoName string, remoteBranches map
 	return nil
 }
 
+// calculateStaleBranches returns the names of branches which are no longer on the remote. Names are compared exactly, as
+// sent to LaunchDarkly, so branches containing slashes, '#', or unicode characters are only pruned when they are deleted.
 func calculateStaleBranches(branches []ld.BranchRep, remoteBranches map[string]bool) []string {
+	remote := make(map[string]bool, len(remoteBranches))
+	for name := range remoteBranches {
+		remote[strings.TrimPrefix(name, "refs/heads/")] = true
+	}
 	staleBranches := []string{}
 	for _, branch := range branches {
-		if !remoteBranches[branch.Name] {
+		if !remote[branch.Name] {
 			staleBranches = append(staleBranches, branch.Name)
 		}
 	}
@@ -229,12 +928,12 @@ func calculateStaleBranches(branches []ld.BranchRep, remoteBranches map[string]b
 }
 
 // Very short flag keys lead to many false positives when searching in code,
-// so we filter them out.
+// so we filter them out. Keys are measured in characters, so keys of a few non-ASCII characters are filtered too.
 func filterShortFlagKeys(flags []string) (filtered []string, omitted []string) {
 	filteredFlags := []string{}
 	omittedFlags := []string{}
 	for _, flag := range flags {
-		if len(flag) >= minFlagKeyLen {
+		if utf8.RuneCountInString(flag) >= minFlagKeyLen {
 			filteredFlags = append(filteredFlags, flag)
 		} else {
 			omittedFlags = append(omittedFlags, flag)
@@ -243,12 +942,32 @@ func filterShortFlagKeys(flags []string) (filtered []string, omitted []string) {
 	return filteredFlags, omittedFlags
 }
 
-func getFlags(ldApi ld.ApiClient) ([]string, error) {
-	flags, err := ldApi.GetFlagKeyList()
+// newApiClient returns a LaunchDarkly API client which retrieves the flags selected by the flagFilter and maxFlags options
+func newApiClient(opts options.Options) ld.ApiClient {
+	apiOpts := apiOptions(opts)
+	apiOpts.FlagFilter = opts.FlagFilter
+	apiOpts.MaxFlags = opts.MaxFlags
+	return ld.InitApiClient(apiOpts)
+}
+
+// apiOptions returns the options of a LaunchDarkly API client, identifying requests with the userAgentSuffix and
+// requestHeaders options
+func apiOptions(opts options.Options) ld.ApiOptions {
+	userAgent := "LDFindCodeRefs/" + version.Version
+	if suffix := strings.TrimSpace(opts.UserAgentSuffix); suffix != "" {
+		userAgent += " " + suffix
+	}
+	headers, err := opts.Headers()
 	if err != nil {
-		return nil, err
+		log.Warning.Printf("ignoring requestHeaders: %s", err)
+	}
+	return ld.ApiOptions{
+		ApiKey:    opts.AccessToken,
+		BaseUri:   opts.BaseUri,
+		ProjKey:   opts.ProjKey,
+		UserAgent: userAgent,
+		Headers:   headers,
 	}
-	return flags, nil
 }
 
 func makeTimestamp() int64 {
@@ -267,11 +986,20 @@ func checkProjKey(projKey string) {
 }
 
 func fatalServiceError(err error, ignoreServiceErrors bool) {
+	err = serviceError(err, ignoreServiceErrors)
+	if err == errServiceErrorIgnored {
+		os.Exit(0)
+	}
+	log.Error.Fatal(err)
+}
+
+// serviceError returns errServiceErrorIgnored for transient errors if ignoreServiceErrors is set
+func serviceError(err error, ignoreServiceErrors bool) error {
 	if ld.IsTransient(err) {
 		if ignoreServiceErrors {
-			os.Exit(0)
+			return errServiceErrorIgnored
 		}
 		err = fmt.Errorf("%w\n Add the --ignoreServiceErrors flag to ignore this error", err)
 	}
-	log.Error.Fatal(err)
+	return err
 }
@@ -9,6 +9,8 @@ import (
 
 	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
 	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+	"github.com/launchdarkly/ld-find-code-refs/search"
 )
 
 func init() {
@@ -46,6 +48,11 @@ func Test_filterShortFlags(t *testing.T) {
 			flags: []string{"catsarecool", "dogsarecool"},
 			want:  []string{"catsarecool", "dogsarecool"},
 		},
+		{
+			name:  "length is counted in characters",
+			flags: []string{"旗", "旗旗", "旗旗旗"},
+			want:  []string{"旗旗旗"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -74,6 +81,18 @@ func Test_calculateStaleBranches(t *testing.T) {
 			remoteBranches: []string{"master"},
 			expected:       []string{},
 		},
+		{
+			name:           "branches with slashes, '#', and unicode",
+			branches:       []string{"feature/ABC#123-añadir", "feature/ABC#124-añadir", "feature%2FABC%23123-a%C3%B1adir"},
+			remoteBranches: []string{"feature/ABC#123-añadir"},
+			expected:       []string{"feature/ABC#124-añadir", "feature%2FABC%23123-a%C3%B1adir"},
+		},
+		{
+			name:           "current branch provided as a ref",
+			branches:       []string{"feature/ABC#123-añadir"},
+			remoteBranches: []string{"refs/heads/feature/ABC#123-añadir"},
+			expected:       []string{},
+		},
 	}
 
 	for _, tt := range specs {
@@ -92,3 +111,44 @@ func Test_calculateStaleBranches(t *testing.T) {
 		})
 	}
 }
+
+func Test_referenceLineNumber(t *testing.T) {
+	delims := search.NewDelimiters(`"`)
+	specs := []struct {
+		name     string
+		hunk     ld.HunkRep
+		aliases  []string
+		expected int
+	}{
+		{
+			name:     "no lines",
+			hunk:     ld.HunkRep{StartingLineNumber: 5, FlagKey: "someFlag"},
+			expected: 5,
+		},
+		{
+			name:     "flag key in context",
+			hunk:     ld.HunkRep{StartingLineNumber: 5, FlagKey: "someFlag", Lines: "a\nb\n\"someFlag\"\nc"},
+			expected: 7,
+		},
+		{
+			name:     "alias in context",
+			hunk:     ld.HunkRep{StartingLineNumber: 1, FlagKey: "someFlag", Lines: "a\nSOME_FLAG\nc"},
+			aliases:  []string{"SOME_FLAG"},
+			expected: 2,
+		},
+	}
+
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, referenceLineNumber(tt.hunk, tt.aliases, delims))
+		})
+	}
+}
+
+func Test_withNormalizedRepoName(t *testing.T) {
+	opts := withNormalizedRepoName(options.Options{RepoName: "Org/My Repo", NormalizeRepoName: true})
+	assert.Equal(t, "org-my-repo", opts.RepoName)
+
+	opts = withNormalizedRepoName(options.Options{RepoName: "My-Repo"})
+	assert.Equal(t, "My-Repo", opts.RepoName, "repo names are not changed when normalizeRepoName is disabled")
+}
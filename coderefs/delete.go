@@ -0,0 +1,77 @@
+package coderefs
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+)
+
+// DeleteBranches deletes the code reference data stored in LaunchDarkly for branches of a repository, or for every branch
+// if all is set. Unlike pruning, branches are deleted whether or not they still exist on the remote. Branches without
+// stored code reference data are reported and skipped.
+func DeleteBranches(opts options.Options, branches []string, all bool) error {
+	missing := []string{}
+	if opts.AccessToken == "" {
+		missing = append(missing, "accessToken")
+	}
+	if opts.RepoName == "" {
+		missing = append(missing, "repoName")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required option(s): %v", missing)
+	}
+	opts = withNormalizedRepoName(opts)
+	if all && len(branches) > 0 {
+		return errors.New("branches cannot be provided when deleting all branches")
+	} else if !all && len(branches) == 0 {
+		return errors.New("at least one branch must be provided, or all branches must be deleted with --all")
+	}
+
+	ldApi := ld.InitApiClient(apiOptions(opts))
+	stored, err := ldApi.GetCodeReferenceRepositoryBranches(opts.RepoName)
+	if err == ld.NotFoundErr {
+		return fmt.Errorf("repository %s does not exist in LaunchDarkly", opts.RepoName)
+	} else if err != nil {
+		return err
+	}
+
+	toDelete := branchesToDelete(stored, branches, all)
+	if len(toDelete) == 0 {
+		log.Info.Printf("no code reference data to delete for repository: %s", opts.RepoName)
+		return nil
+	}
+	err = ldApi.PostDeleteBranchesTask(opts.RepoName, toDelete)
+	if err != nil {
+		return fmt.Errorf("failed to delete branches: %w", err)
+	}
+	log.Info.Printf("deleted code reference data for %d branches of repository %s: %v", len(toDelete), opts.RepoName, toDelete)
+	return nil
+}
+
+// branchesToDelete returns the names of the stored branches to delete, in the order they were requested
+func branchesToDelete(stored []ld.BranchRep, branches []string, all bool) []string {
+	ret := []string{}
+	exists := map[string]bool{}
+	for _, b := range stored {
+		if all {
+			ret = append(ret, b.Name)
+		}
+		exists[b.Name] = true
+	}
+	seen := map[string]bool{}
+	for _, name := range branches {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		if !exists[name] {
+			log.Warning.Printf("branch %s does not have code reference data in LaunchDarkly, skipping", name)
+			continue
+		}
+		ret = append(ret, name)
+	}
+	return ret
+}
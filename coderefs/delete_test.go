@@ -0,0 +1,44 @@
+package coderefs
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+	"github.com/launchdarkly/ld-find-code-refs/testserver"
+)
+
+func TestDeleteBranches(t *testing.T) {
+	server := testserver.New("")
+	server.AddProject("default", []string{"flag1"}, nil)
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	retryMax := 0
+	client := ld.InitApiClient(ld.ApiOptions{ApiKey: "api-x", ProjKey: "default", BaseUri: httpServer.URL, RetryMax: &retryMax})
+	require.NoError(t, client.MaybeUpsertCodeReferenceRepository(ld.RepoParams{Type: "custom", Name: "repo", DefaultBranch: "main"}))
+	for _, name := range []string{"main", "release/1.0", "release/1.1"} {
+		require.NoError(t, client.PutCodeReferenceBranch(ld.BranchRep{Name: name, Head: "0123456789abcdef"}, "repo"))
+	}
+
+	opts := options.Options{AccessToken: "api-x", BaseUri: httpServer.URL, RepoName: "repo"}
+	require.NoError(t, DeleteBranches(opts, []string{"release/1.0", "missing", "release/1.0"}, false))
+	state, ok := server.Repository("repo")
+	require.True(t, ok)
+	assert.Equal(t, []string{"release/1.0"}, state.DeletedBranches)
+
+	require.NoError(t, DeleteBranches(opts, nil, true))
+	state, _ = server.Repository("repo")
+	assert.Empty(t, state.Branches)
+	assert.ElementsMatch(t, []string{"release/1.0", "main", "release/1.1"}, state.DeletedBranches)
+
+	assert.EqualError(t, DeleteBranches(opts, []string{"main"}, true), "branches cannot be provided when deleting all branches")
+	assert.EqualError(t, DeleteBranches(opts, nil, false), "at least one branch must be provided, or all branches must be deleted with --all")
+
+	opts.RepoName = "other"
+	assert.EqualError(t, DeleteBranches(opts, nil, true), "repository other does not exist in LaunchDarkly")
+}
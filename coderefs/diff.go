@@ -0,0 +1,286 @@
+package coderefs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/git"
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	"github.com/launchdarkly/ld-find-code-refs/internal/validation"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+	"github.com/launchdarkly/ld-find-code-refs/search"
+)
+
+// diffBatchSize is the maximum number of unchanged files read from git at once
+const diffBatchSize = 500
+
+// diffResult lists flags with references added or removed between two revisions
+type diffResult struct {
+	Base      string     `json:"base"`
+	Head      string     `json:"head"`
+	MergeBase string     `json:"mergeBase"`
+	Flags     []flagDiff `json:"flags"`
+}
+
+// flagDiff lists the references to a flag added or removed between two revisions
+type flagDiff struct {
+	FlagKey string            `json:"flagKey"`
+	Added   []referenceChange `json:"added"`
+	Removed []referenceChange `json:"removed"`
+	// FirstReference is true if the flag was not referenced before the change
+	FirstReference bool `json:"firstReference"`
+	// LastReference is true if the flag is no longer referenced after the change
+	LastReference bool `json:"lastReference"`
+}
+
+// referenceChange is a single line referencing a flag. Line numbers are those of the head revision for added
+// references, and of the base revision for removed references.
+type referenceChange struct {
+	Path       string `json:"path"`
+	LineNumber int    `json:"lineNumber"`
+	Line       string `json:"line"`
+}
+
+// Diff reports flag references added or removed by the changes on head since it diverged from base, as in
+// `git diff base...head`. References are compared by the contents of referencing lines, so references which only
+// moved within a file are not reported. Flags are retrieved from LaunchDarkly unless sample flag keys are provided.
+// Results are written to out as text, or as JSON if asJSON is set.
+func Diff(opts options.Options, base, head string, sampleFlags []string, out io.Writer, asJSON bool) error {
+	absPath, err := validation.NormalizeAndValidatePath(opts.Dir)
+	if err != nil {
+		return fmt.Errorf("could not validate directory option: %w", err)
+	}
+
+	flags := sampleFlags
+	if len(flags) == 0 {
+		if opts.OfflineFlags == "" && (opts.AccessToken == "" || opts.ProjKey == "") {
+			return fmt.Errorf("flag keys must be provided when accessToken and projKey are not set, unless offlineFlags is set")
+		}
+		ldApi := newApiClient(opts)
+		flags, err = getFlags(opts, ldApi)
+		if err != nil {
+			return fmt.Errorf("could not retrieve flag keys from LaunchDarkly: %w", err)
+		}
+	}
+	flags, _ = filterShortFlagKeys(flags)
+
+	gitClient, err := git.OpenClient(absPath)
+	if err != nil {
+		return err
+	}
+	result := diffResult{}
+	result.Base, err = gitClient.ResolveRevision(base)
+	if err != nil {
+		return err
+	}
+	result.Head, err = gitClient.ResolveRevision(head)
+	if err != nil {
+		return err
+	}
+	result.MergeBase, err = gitClient.MergeBase(result.Base, result.Head)
+	if err != nil {
+		return err
+	}
+
+	aliases, rules, err := generateAliases(opts, flags, absPath)
+	if err != nil {
+		return fmt.Errorf("failed to create flag key aliases: %w", err)
+	}
+
+	d := differ{opts: opts, dir: absPath, git: gitClient, aliases: aliases, delimiters: configureDelimiters(opts, rules)}
+	result.Flags, err = d.diff(result.MergeBase, result.Head)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(out, string(data))
+		return err
+	}
+	printDiff(out, base, head, result)
+	return nil
+}
+
+type differ struct {
+	opts       options.Options
+	dir        string
+	git        *git.Client
+	aliases    map[string][]string
+	delimiters search.Delimiters
+}
+
+func (d differ) diff(from, to string) ([]flagDiff, error) {
+	changed, err := d.git.ChangedFiles(from, to)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list changed files: %w", err)
+	}
+	log.Debug.Printf("found %d files changed between %s and %s", len(changed), from, to)
+	before, err := d.references(from, changed, d.aliases)
+	if err != nil {
+		return nil, err
+	}
+	after, err := d.references(to, changed, d.aliases)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []flagDiff{}
+	changedAliases := map[string][]string{}
+	for flag := range d.aliases {
+		added := subtractReferences(after[flag], before[flag])
+		removed := subtractReferences(before[flag], after[flag])
+		if len(added) == 0 && len(removed) == 0 {
+			continue
+		}
+		ret = append(ret, flagDiff{FlagKey: flag, Added: added, Removed: removed})
+		changedAliases[flag] = d.aliases[flag]
+	}
+	if len(ret) == 0 {
+		return ret, nil
+	}
+
+	// unchanged files contain the same references at both revisions, so a flag is only first or last referenced by
+	// the change when it is not referenced by any unchanged file
+	unchanged, err := d.unchangedFiles(to, changed)
+	if err != nil {
+		return nil, err
+	}
+	remaining, err := d.references(to, unchanged, changedAliases)
+	if err != nil {
+		return nil, err
+	}
+	for i, f := range ret {
+		if len(remaining[f.FlagKey]) > 0 {
+			continue
+		}
+		ret[i].FirstReference = len(before[f.FlagKey]) == 0
+		ret[i].LastReference = len(after[f.FlagKey]) == 0
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].FlagKey < ret[j].FlagKey
+	})
+	return ret, nil
+}
+
+func (d differ) unchangedFiles(rev string, changed []string) ([]string, error) {
+	files, err := d.git.ListFiles(rev)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list files at %s: %w", rev, err)
+	}
+	isChanged := make(map[string]bool, len(changed))
+	for _, path := range changed {
+		isChanged[path] = true
+	}
+	ret := make([]string, 0, len(files))
+	for _, path := range files {
+		if !isChanged[path] {
+			ret = append(ret, path)
+		}
+	}
+	return ret, nil
+}
+
+// references returns the lines referencing each flag in the given paths at a revision
+func (d differ) references(rev string, paths []string, aliases map[string][]string) (map[string][]referenceChange, error) {
+	ret := map[string][]referenceChange{}
+	ctxLines := search.NewContextLines(0, nil)
+	maxFileSize := int64(d.opts.MaxFileSizeKb) * 1024
+	for start := 0; start < len(paths); start += diffBatchSize {
+		end := start + diffBatchSize
+		if end > len(paths) {
+			end = len(paths)
+		}
+		contents, err := d.git.ReadFilesAt(context.Background(), rev, paths[start:end], maxFileSize, nil)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read files at %s: %w", rev, err)
+		}
+		refs := search.SearchContents(search.Options{
+			ProjKey:        d.opts.ProjKey,
+			Workspace:      d.dir,
+			Aliases:        aliases,
+			ContextLines:   ctxLines,
+			Delimiters:     d.delimiters,
+			LineLengthUnit: search.LineLengthUnit(d.opts.LineLengthUnit),
+			GitAttributes:  d.opts.GitAttributes,
+			MaxFileSize:    maxFileSize,
+		}, contents)
+		for _, ref := range refs {
+			for _, hunk := range ref.Hunks {
+				ret[hunk.FlagKey] = append(ret[hunk.FlagKey], referencingLines(ref.Path, hunk)...)
+			}
+		}
+	}
+	return ret, nil
+}
+
+// referencingLines returns the lines of a hunk which contain the flag key or one of its aliases
+func referencingLines(path string, hunk ld.HunkRep) []referenceChange {
+	lines := strings.Split(hunk.Lines, "\n")
+	ret := []referenceChange{}
+	for i, m := range hunk.Matches {
+		idx := m.LineNumber - hunk.StartingLineNumber
+		if (i > 0 && m.LineNumber == hunk.Matches[i-1].LineNumber) || idx < 0 || idx >= len(lines) {
+			continue
+		}
+		ret = append(ret, referenceChange{Path: path, LineNumber: m.LineNumber, Line: strings.TrimSpace(lines[idx])})
+	}
+	return ret
+}
+
+// subtractReferences returns the references in a which are not in b. References are equal if they are in the same file
+// and their lines have the same contents, ignoring surrounding whitespace.
+func subtractReferences(a, b []referenceChange) []referenceChange {
+	counts := map[string]int{}
+	for _, r := range b {
+		counts[r.Path+"\x00"+r.Line]++
+	}
+	ret := []referenceChange{}
+	for _, r := range a {
+		key := r.Path + "\x00" + r.Line
+		if counts[key] > 0 {
+			counts[key]--
+			continue
+		}
+		ret = append(ret, r)
+	}
+	return ret
+}
+
+func printDiff(out io.Writer, base, head string, result diffResult) {
+	if len(result.Flags) == 0 {
+		fmt.Fprintf(out, "no flag references changed between %s and %s\n", base, head)
+		return
+	}
+	fmt.Fprintf(out, "flag references changed between %s (%s) and %s (%s):\n", base, shortSha(result.MergeBase), head, shortSha(result.Head))
+	for _, f := range result.Flags {
+		note := ""
+		if f.FirstReference {
+			note = " (first reference added)"
+		} else if f.LastReference {
+			note = " (last reference removed)"
+		}
+		fmt.Fprintf(out, "\n%s: %d added, %d removed%s\n", f.FlagKey, len(f.Added), len(f.Removed), note)
+		for _, r := range f.Added {
+			fmt.Fprintf(out, "  + %s:%d: %s\n", r.Path, r.LineNumber, r.Line)
+		}
+		for _, r := range f.Removed {
+			fmt.Fprintf(out, "  - %s:%d: %s\n", r.Path, r.LineNumber, r.Line)
+		}
+	}
+}
+
+func shortSha(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
@@ -0,0 +1,89 @@
+package coderefs
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/options"
+)
+
+func TestDiff(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diff")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	dir, err = filepath.EvalSymlinks(dir)
+	require.NoError(t, err)
+
+	run := func(args ...string) {
+		args = append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)
+		out, err := exec.Command("git", args...).CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	write := func(name, data string) {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0600))
+	}
+
+	run("init", "-q")
+	run("checkout", "-q", "-b", "main")
+	write("a.js", "if (variation('old-flag')) {}\nif (variation('kept-flag')) {}\n")
+	write("b.js", "variation('kept-flag')\n")
+	run("add", "-A")
+	run("commit", "-q", "-m", "base")
+	run("checkout", "-q", "-b", "feature")
+	write("a.js", "// moved\nif (variation('kept-flag')) {}\nif (variation('new-flag')) {}\n")
+	write("c.js", "variation('kept-flag')\n")
+	run("add", "-A")
+	run("commit", "-q", "-m", "feature")
+	// changes on the base branch after the feature branch diverged are not reported
+	run("checkout", "-q", "main")
+	write("d.js", "variation('other-flag')\n")
+	run("add", "-A")
+	run("commit", "-q", "-m", "main")
+
+	opts := options.Options{Dir: dir, ProjKey: "default", LineLengthUnit: "characters"}
+	flags := []string{"old-flag", "kept-flag", "new-flag", "other-flag"}
+
+	var out bytes.Buffer
+	require.NoError(t, Diff(opts, "main", "feature", flags, &out, true))
+	var result diffResult
+	require.NoError(t, json.Unmarshal(out.Bytes(), &result))
+	require.Len(t, result.Flags, 3)
+
+	assert.Equal(t, flagDiff{
+		FlagKey: "kept-flag",
+		Added:   []referenceChange{{Path: "c.js", LineNumber: 1, Line: "variation('kept-flag')"}},
+		Removed: []referenceChange{},
+	}, result.Flags[0])
+	assert.Equal(t, flagDiff{
+		FlagKey:        "new-flag",
+		Added:          []referenceChange{{Path: "a.js", LineNumber: 3, Line: "if (variation('new-flag')) {}"}},
+		Removed:        []referenceChange{},
+		FirstReference: true,
+	}, result.Flags[1])
+	assert.Equal(t, flagDiff{
+		FlagKey:       "old-flag",
+		Added:         []referenceChange{},
+		Removed:       []referenceChange{{Path: "a.js", LineNumber: 1, Line: "if (variation('old-flag')) {}"}},
+		LastReference: true,
+	}, result.Flags[2])
+
+	out.Reset()
+	require.NoError(t, Diff(opts, "main", "feature", flags, &out, false))
+	assert.Contains(t, out.String(), "new-flag: 1 added, 0 removed (first reference added)\n  + a.js:3: if (variation('new-flag')) {}")
+	assert.Contains(t, out.String(), "old-flag: 0 added, 1 removed (last reference removed)\n  - a.js:1: if (variation('old-flag')) {}")
+
+	out.Reset()
+	require.NoError(t, Diff(opts, "feature", "feature", flags, &out, false))
+	assert.Equal(t, "no flag references changed between feature and feature\n", out.String())
+
+	err = Diff(opts, "main", "unknown", flags, &out, false)
+	assert.EqualError(t, err, `unknown revision "unknown"`)
+}
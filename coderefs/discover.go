@@ -0,0 +1,86 @@
+package coderefs
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/discovery"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+)
+
+// DiscoverOptions configures which repositories are discovered, and where they are cloned
+type DiscoverOptions struct {
+	Provider        string
+	ApiUrl          string
+	Owner           string
+	Username        string
+	Token           string
+	WorkDir         string
+	IncludeArchived bool
+	IncludeForks    bool
+	Concurrency     int
+}
+
+// Discover lists the repositories belonging to a GitHub organization or Bitbucket workspace, clones or updates each
+// repository in the working directory, and scans all of them. Repositories which fail to clone are skipped.
+func Discover(base options.Options, opts DiscoverOptions) error {
+	provider, err := discovery.NewProvider(opts.Provider, opts.ApiUrl, opts.Owner, opts.Username, opts.Token)
+	if err != nil {
+		return err
+	}
+	if opts.WorkDir == "" {
+		return fmt.Errorf("a working directory is required")
+	}
+
+	repos, err := provider.ListRepositories()
+	if err != nil {
+		return err
+	}
+	log.Info.Printf("found %d repositories for %s", len(repos), opts.Owner)
+
+	workspace := []options.WorkspaceRepo{}
+	failed := []string{}
+	for _, repo := range repos {
+		switch {
+		case repo.Archived && !opts.IncludeArchived:
+			log.Debug.Printf("skipping archived repository %s", repo.Name)
+			continue
+		case repo.Fork && !opts.IncludeForks:
+			log.Debug.Printf("skipping forked repository %s", repo.Name)
+			continue
+		case repo.DefaultBranch == "" || repo.CloneUrl == "":
+			log.Debug.Printf("skipping empty repository %s", repo.Name)
+			continue
+		}
+
+		dir, err := provider.CloneOrUpdate(repo, opts.WorkDir)
+		if err != nil {
+			log.Error.Printf("failed to clone repository %s: %s", repo.Name, err)
+			failed = append(failed, repo.Name)
+			continue
+		}
+		workspace = append(workspace, options.WorkspaceRepo{
+			Dir:           dir,
+			RepoName:      repo.Name,
+			RepoType:      opts.Provider,
+			RepoUrl:       repo.Url,
+			Branch:        repo.DefaultBranch,
+			DefaultBranch: repo.DefaultBranch,
+		})
+	}
+
+	// repositories which could not be cloned count as failed scans
+	total := len(workspace) + len(failed)
+	err = ScanWorkspace(base, workspace, opts.Concurrency)
+	var wsErr *scanFailures
+	if errors.As(err, &wsErr) {
+		failed = append(failed, wsErr.Failed...)
+	} else if err != nil {
+		return err
+	}
+	if len(failed) > 0 {
+		return &scanFailures{Kind: "repositories", Failed: failed, Total: total}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package coderefs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/git"
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/validation"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+)
+
+type checkStatus string
+
+const (
+	checkPass checkStatus = "PASS"
+	checkWarn checkStatus = "WARN"
+	checkFail checkStatus = "FAIL"
+	checkSkip checkStatus = "SKIP"
+)
+
+// doctorCheck is the result of a single environment check
+type doctorCheck struct {
+	name   string
+	status checkStatus
+	detail string
+	hint   string
+}
+
+const doctorNetworkTimeout = 10 * time.Second
+
+// Doctor checks that the environment is able to run a scan, and writes a checklist of results with remediation hints to out.
+// An error is returned if any check fails.
+func Doctor(opts options.Options, out io.Writer) error {
+	checks := []doctorCheck{}
+
+	gitVersion, err := git.Version()
+	if err != nil && opts.Revision != "" {
+		checks = append(checks, doctorCheck{"git", checkSkip, "revision is set, git is not used", ""})
+	} else if err != nil {
+		checks = append(checks, doctorCheck{"git", checkFail, err.Error(), "install git and make sure it is available in the system PATH"})
+	} else {
+		checks = append(checks, doctorCheck{"git", checkPass, "git version " + gitVersion, ""})
+	}
+
+	// Searching is implemented natively, so no external search tool needs to be installed
+	checks = append(checks, doctorCheck{"search", checkPass, "built-in", ""})
+
+	checks = append(checks, checkRepository(opts, gitVersion != "")...)
+	checks = append(checks, checkNetwork(opts.BaseUri))
+	checks = append(checks, checkAccessToken(opts))
+
+	failures := 0
+	for _, c := range checks {
+		fmt.Fprintf(out, "[%s] %s", c.status, c.name)
+		if c.detail != "" {
+			fmt.Fprintf(out, ": %s", c.detail)
+		}
+		fmt.Fprintln(out)
+		if c.hint != "" && c.status != checkPass {
+			fmt.Fprintf(out, "       %s\n", c.hint)
+		}
+		if c.status == checkFail {
+			failures++
+		}
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("%d check(s) failed", failures)
+	}
+	return nil
+}
+
+func checkRepository(opts options.Options, gitAvailable bool) []doctorCheck {
+	absPath, err := validation.NormalizeAndValidatePath(opts.Dir)
+	if err != nil {
+		return []doctorCheck{{"directory", checkFail, err.Error(), "set --dir to the path of an existing checkout of the repository"}}
+	}
+	checks := []doctorCheck{{"directory", checkPass, absPath, ""}}
+	if opts.Revision != "" {
+		return append(checks, doctorCheck{"repository", checkSkip, "revision is set, git is not used", ""})
+	}
+	if !gitAvailable {
+		return append(checks, doctorCheck{"repository", checkSkip, "git is not available", ""})
+	}
+
+	client, err := git.NewClient(absPath, opts.Branch)
+	if err != nil {
+		hint := "make sure --dir is a git repository, or set --revision and --branch to scan it without git"
+		if client != nil && client.IsDetachedHead() {
+			hint = "the repository is in a detached HEAD state, set --branch to the name of the branch being scanned"
+		}
+		return append(checks, doctorCheck{"repository", checkFail, err.Error(), hint})
+	}
+	checks = append(checks, doctorCheck{"repository", checkPass, fmt.Sprintf("branch %s at %s", client.GitBranch, client.GitSha), ""})
+
+	if client.IsShallow() {
+		checks = append(checks, doctorCheck{"history", checkWarn, "shallow clone", "flag extinctions cannot be detected beyond the fetched history, fetch the full history (e.g. git fetch --unshallow) if lookback is enabled"})
+	} else {
+		checks = append(checks, doctorCheck{"history", checkPass, "full clone", ""})
+	}
+	return checks
+}
+
+func checkNetwork(baseUri string) doctorCheck {
+	if baseUri == "" {
+		return doctorCheck{"network", checkSkip, "baseUri is not set", ""}
+	}
+	client := http.Client{Timeout: doctorNetworkTimeout}
+	res, err := client.Get(baseUri)
+	if err != nil {
+		return doctorCheck{"network", checkFail, err.Error(), fmt.Sprintf("make sure %s is reachable, and that any required proxy is configured with HTTPS_PROXY", baseUri)}
+	}
+	res.Body.Close()
+	return doctorCheck{"network", checkPass, fmt.Sprintf("%s is reachable", baseUri), ""}
+}
+
+func checkAccessToken(opts options.Options) doctorCheck {
+	if opts.AccessToken == "" || opts.ProjKey == "" {
+		return doctorCheck{"access token", checkSkip, "accessToken and projKey are required", "set --accessToken and --projKey to validate access to LaunchDarkly"}
+	}
+	ldApi := ld.InitApiClient(apiOptions(opts))
+	// write access to the repository is only checked if it is named, as doctor may not run in the repository
+	err := ldApi.PreflightCheck(opts.RepoName)
+	if err != nil {
+		hint := ""
+		var configErr ld.ConfigurationError
+		if !errors.As(err, &configErr) {
+			hint = "LaunchDarkly could not be reached, try again later"
+		}
+		return doctorCheck{"access token", checkFail, err.Error(), hint}
+	}
+	return doctorCheck{"access token", checkPass, fmt.Sprintf("valid for project %s", opts.ProjKey), ""}
+}
@@ -0,0 +1,47 @@
+package coderefs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/options"
+)
+
+func TestDoctor_notRepository(t *testing.T) {
+	dir, err := ioutil.TempDir("", "doctor")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	err = Doctor(options.Options{Dir: dir, BaseUri: server.URL}, &out)
+	require.Error(t, err)
+	assert.Contains(t, out.String(), "[PASS] directory")
+	assert.Contains(t, out.String(), "[FAIL] repository")
+	assert.Contains(t, out.String(), "[PASS] network")
+	assert.Contains(t, out.String(), "[SKIP] access token")
+}
+
+func TestDoctor_withoutGit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "doctor")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	err = Doctor(options.Options{Dir: dir, BaseUri: server.URL, Revision: "1.2.3", Branch: "release"}, &out)
+	require.NoError(t, err)
+	assert.Contains(t, out.String(), "[PASS] directory")
+	assert.Contains(t, out.String(), "[SKIP] repository: revision is set, git is not used")
+}
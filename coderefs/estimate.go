@@ -0,0 +1,140 @@
+package coderefs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/olekukonko/tablewriter"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	"github.com/launchdarkly/ld-find-code-refs/internal/validation"
+	"github.com/launchdarkly/ld-find-code-refs/search"
+)
+
+// z95 is the z-score of a 95% confidence interval
+const z95 = 1.96
+
+// referenceEstimates are the estimated number of code references to each flag, from a search of a sample of files
+type referenceEstimates struct {
+	Branch   string  `json:"branch"`
+	Revision string  `json:"revision"`
+	SyncTime int64   `json:"syncTime"`
+	Sample   float64 `json:"sample"`
+	// SampledFiles is the number of files searched, and SkippedFiles the number of files which were not in the sample
+	SampledFiles int64          `json:"sampledFiles"`
+	SkippedFiles int64          `json:"skippedFiles"`
+	Flags        []flagEstimate `json:"flags"`
+}
+
+// flagEstimate is the estimated number of code references to a flag. Margin is the half-width of the 95% confidence
+// interval of the estimate.
+type flagEstimate struct {
+	FlagKey             string `json:"flagKey"`
+	SampledReferences   int64  `json:"sampledReferences"`
+	EstimatedReferences int64  `json:"estimatedReferences"`
+	Margin              int64  `json:"margin"`
+}
+
+// estimateReferences estimates the total number of code references to each flag from the references found in a sample
+// of files, where each file was searched with probability fraction. Each file contributes its references divided by
+// fraction, and the variance of the estimate is derived from the number of references in each file, so a flag
+// referenced many times in a few files has a wider margin than a flag referenced once in many files. Estimates are
+// ordered by the estimated number of references, then by flag key.
+func estimateReferences(branch ld.BranchRep, flags []string, fraction float64) []flagEstimate {
+	sampled := map[string]int64{}
+	sumSquares := map[string]float64{}
+	for _, flag := range flags {
+		sampled[flag] = 0
+	}
+	for _, ref := range branch.References {
+		inFile := map[string]int64{}
+		for _, hunk := range ref.Hunks {
+			inFile[hunk.FlagKey]++
+		}
+		for flag, n := range inFile {
+			sampled[flag] += n
+			sumSquares[flag] += float64(n * n)
+		}
+	}
+
+	ret := make([]flagEstimate, 0, len(sampled))
+	for flag, n := range sampled {
+		ret = append(ret, flagEstimate{
+			FlagKey:             flag,
+			SampledReferences:   n,
+			EstimatedReferences: int64(math.Round(float64(n) / fraction)),
+			Margin:              int64(math.Ceil(z95 * math.Sqrt(sumSquares[flag]*(1-fraction)) / fraction)),
+		})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].EstimatedReferences != ret[j].EstimatedReferences {
+			return ret[i].EstimatedReferences > ret[j].EstimatedReferences
+		}
+		return ret[i].FlagKey < ret[j].FlagKey
+	})
+	return ret
+}
+
+// writeEstimates prints the estimated number of code references to each flag from a search of a sample of files, and
+// writes the estimates to outDir, if set
+func writeEstimates(outDir, projKey, repoName string, branch ld.BranchRep, flags []string, sample *search.Sample) error {
+	selected, skipped := sample.Files()
+	estimates := referenceEstimates{
+		Branch:       branch.Name,
+		Revision:     branch.Head,
+		SyncTime:     branch.SyncTime,
+		Sample:       sample.Fraction,
+		SampledFiles: selected,
+		SkippedFiles: skipped,
+		Flags:        estimateReferences(branch, flags, sample.Fraction),
+	}
+	log.Info.Printf("found %d code references in a sample of %d of %d files, code references will not be sent to LaunchDarkly", branch.TotalHunkCount(), selected, selected+skipped)
+	printEstimates(log.Console(), estimates)
+	if outDir == "" {
+		return nil
+	}
+	path, err := estimates.write(outDir, projKey, repoName)
+	if err != nil {
+		return fmt.Errorf("error writing estimated code references: %s", err)
+	}
+	log.Info.Printf("wrote estimated code references to %s", path)
+	return nil
+}
+
+// write writes the estimates to outDir, named to match the CSV output of the same scan
+func (e referenceEstimates) write(outDir, projKey, repoName string) (string, error) {
+	absPath, err := validation.NormalizeAndValidatePath(outDir)
+	if err != nil {
+		return "", fmt.Errorf("invalid outDir '%s': %w", outDir, err)
+	}
+	tag := ld.BranchRep{Name: e.Branch}.FileTag(e.Revision)
+	path := filepath.Join(absPath, fmt.Sprintf("coderefs_%s_%s_%s_estimate.json", projKey, repoName, tag))
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return path, ioutil.WriteFile(path, data, 0600)
+}
+
+// printEstimates prints a table of the flags with at least one code reference in the sample
+func printEstimates(w io.Writer, e referenceEstimates) {
+	fmt.Fprintln(w, log.Highlight(fmt.Sprintf("Estimated references by flag (%s%% sample)", strconv.FormatFloat(e.Sample*100, 'f', -1, 64))))
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"Flag", "# Sampled", "# Estimated", "95% margin"})
+	table.SetBorder(false)
+	table.SetAutoWrapText(false)
+	for _, f := range e.Flags {
+		if f.SampledReferences == 0 {
+			continue
+		}
+		table.Append([]string{f.FlagKey, strconv.FormatInt(f.SampledReferences, 10), strconv.FormatInt(f.EstimatedReferences, 10), "±" + strconv.FormatInt(f.Margin, 10)})
+	}
+	table.Render()
+}
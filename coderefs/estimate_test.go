@@ -0,0 +1,61 @@
+package coderefs
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+)
+
+func TestEstimateReferences(t *testing.T) {
+	branch := ld.BranchRep{References: []ld.ReferenceHunksRep{
+		{Path: "a.go", Hunks: []ld.HunkRep{{FlagKey: "flag-a"}, {FlagKey: "flag-a"}, {FlagKey: "flag-b"}}},
+		{Path: "b.go", Hunks: []ld.HunkRep{{FlagKey: "flag-a"}}},
+	}}
+
+	want := []flagEstimate{
+		{FlagKey: "flag-a", SampledReferences: 3, EstimatedReferences: 6, Margin: 7},
+		{FlagKey: "flag-b", SampledReferences: 1, EstimatedReferences: 2, Margin: 3},
+		{FlagKey: "flag-c", SampledReferences: 0, EstimatedReferences: 0, Margin: 0},
+	}
+	assert.Equal(t, want, estimateReferences(branch, []string{"flag-a", "flag-b", "flag-c"}, 0.5))
+
+	// a sample of every file is exact
+	exact := estimateReferences(branch, []string{"flag-a"}, 1)
+	assert.Equal(t, flagEstimate{FlagKey: "flag-a", SampledReferences: 3, EstimatedReferences: 3, Margin: 0}, exact[0])
+}
+
+func TestReferenceEstimates_write(t *testing.T) {
+	dir, err := ioutil.TempDir("", "estimate")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	estimates := referenceEstimates{
+		Branch:   "main",
+		Revision: "0123456789abcdef",
+		Sample:   0.05,
+		Flags:    []flagEstimate{{FlagKey: "flag-a", SampledReferences: 1, EstimatedReferences: 20, Margin: 38}, {FlagKey: "flag-b"}},
+	}
+	path, err := estimates.write(dir, "default", "repo")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "coderefs_default_repo_0123456_estimate.json"), path)
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	var got referenceEstimates
+	require.NoError(t, json.Unmarshal(data, &got))
+	assert.Equal(t, estimates, got)
+
+	var buf bytes.Buffer
+	printEstimates(&buf, estimates)
+	assert.Contains(t, buf.String(), "Estimated references by flag (5% sample)")
+	assert.Contains(t, buf.String(), "±38")
+	assert.NotContains(t, buf.String(), "flag-b", "flags without references in the sample are not printed")
+}
@@ -0,0 +1,141 @@
+package coderefs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+)
+
+// flagCache is the contents of a flag cache file
+type flagCache struct {
+	BaseUri   string   `json:"baseUri"`
+	ProjKey   string   `json:"projKey"`
+	FetchedAt int64    `json:"fetchedAt"`
+	Flags     []string `json:"flags"`
+}
+
+// getFlags returns the keys of the flags to search for. Flags are read from the offlineFlags file if it is set, and
+// retrieved from LaunchDarkly otherwise. If flagCacheTtl is set, flags retrieved from LaunchDarkly are cached on disk,
+// and reused by later runs until the cache expires.
+func getFlags(opts options.Options, ldApi ld.ApiClient) ([]string, error) {
+	if opts.OfflineFlags != "" {
+		flags, err := readOfflineFlags(opts.OfflineFlags)
+		if err != nil {
+			return nil, fmt.Errorf(`invalid value for "offlineFlags": %w`, err)
+		}
+		log.Info.Printf("using %d flags from %s", len(flags), opts.OfflineFlags)
+		return flags, nil
+	}
+	if opts.FlagCacheTtl <= 0 {
+		return ldApi.GetFlagKeyList()
+	}
+
+	path, err := flagCachePath(ldApi.Options)
+	if err != nil {
+		log.Warning.Printf("unable to locate flag cache: %s", err)
+		return ldApi.GetFlagKeyList()
+	}
+	ttl := time.Duration(opts.FlagCacheTtl) * time.Second
+	if cache, ok := readFlagCache(path, ttl); ok {
+		age := time.Since(time.Unix(cache.FetchedAt, 0)).Round(time.Second)
+		log.Info.Printf("using %d flags cached %s ago in %s", len(cache.Flags), age, path)
+		return cache.Flags, nil
+	}
+	flags, err := ldApi.GetFlagKeyList()
+	if err != nil {
+		return nil, err
+	}
+	err = writeFlagCache(path, flagCache{BaseUri: ldApi.Options.BaseUri, ProjKey: ldApi.Options.ProjKey, FetchedAt: time.Now().Unix(), Flags: flags})
+	if err != nil {
+		log.Warning.Printf("unable to write flag cache: %s", err)
+	}
+	return flags, nil
+}
+
+var unsafeFileNameChars = regexp.MustCompile(`[^a-zA-Z0-9._-]`)
+
+// flagCachePath returns the path of the flag cache file for a project. Flags retrieved with different filters are
+// cached separately.
+func flagCachePath(apiOpts ld.ApiOptions) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256([]byte(apiOpts.BaseUri + "\x00" + apiOpts.ProjKey + "\x00" + apiOpts.FlagFilter + "\x00" + strconv.Itoa(apiOpts.MaxFlags)))
+	name := unsafeFileNameChars.ReplaceAllString(apiOpts.ProjKey, "_") + "-" + hex.EncodeToString(hash[:])[:12] + ".json"
+	return filepath.Join(dir, "ld-find-code-refs", "flags", name), nil
+}
+
+// readFlagCache returns the cached flags at path, if they were cached less than ttl ago
+func readFlagCache(path string, ttl time.Duration) (flagCache, bool) {
+	var cache flagCache
+	/* #nosec */
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warning.Printf("unable to read flag cache: %s", err)
+		}
+		return cache, false
+	}
+	err = json.Unmarshal(data, &cache)
+	if err != nil {
+		log.Warning.Printf("ignoring invalid flag cache %s: %s", path, err)
+		return cache, false
+	}
+	if time.Since(time.Unix(cache.FetchedAt, 0)) >= ttl {
+		log.Debug.Printf("flag cache %s has expired", path)
+		return cache, false
+	}
+	return cache, true
+}
+
+func writeFlagCache(path string, cache flagCache) error {
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0750)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// readOfflineFlags reads flag keys from a JSON file containing either an array of flag keys, or a response from the
+// LaunchDarkly list feature flags API
+func readOfflineFlags(path string) ([]string, error) {
+	/* #nosec */
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	if json.Unmarshal(data, &keys) == nil {
+		return keys, nil
+	}
+	var response struct {
+		Items *[]struct {
+			Key string `json:"key"`
+		} `json:"items"`
+	}
+	err = json.Unmarshal(data, &response)
+	if err != nil || response.Items == nil {
+		return nil, fmt.Errorf("%s must contain an array of flag keys, or a list of flags returned by the LaunchDarkly API", path)
+	}
+	keys = make([]string, 0, len(*response.Items))
+	for _, item := range *response.Items {
+		keys = append(keys, item.Key)
+	}
+	return keys, nil
+}
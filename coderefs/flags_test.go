@@ -0,0 +1,87 @@
+package coderefs
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/options"
+	"github.com/launchdarkly/ld-find-code-refs/testserver"
+)
+
+func TestGetFlags_cache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flagcache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer os.Setenv("XDG_CACHE_HOME", os.Getenv("XDG_CACHE_HOME"))
+	require.NoError(t, os.Setenv("XDG_CACHE_HOME", dir))
+
+	server := testserver.New("")
+	server.AddProject("default", []string{"new-checkout"}, []string{"old-checkout"})
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	opts := options.Options{AccessToken: "api-x", BaseUri: httpServer.URL, ProjKey: "default", FlagCacheTtl: 60}
+
+	ldApi := newApiClient(opts)
+	flags, err := getFlags(opts, ldApi)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"new-checkout", "old-checkout"}, flags)
+	assert.Len(t, ldApi.RequestStats(), 2)
+
+	ldApi = newApiClient(opts)
+	cached, err := getFlags(opts, ldApi)
+	require.NoError(t, err)
+	assert.Equal(t, flags, cached)
+	assert.Empty(t, ldApi.RequestStats(), "cached flags are used")
+
+	path, err := flagCachePath(ldApi.Options)
+	require.NoError(t, err)
+	require.NoError(t, writeFlagCache(path, flagCache{ProjKey: "default", FetchedAt: time.Now().Add(-time.Hour).Unix(), Flags: []string{"stale-flag"}}))
+	ldApi = newApiClient(opts)
+	flags, err = getFlags(opts, ldApi)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"new-checkout", "old-checkout"}, flags, "expired caches are replaced")
+	assert.Len(t, ldApi.RequestStats(), 2)
+
+	opts.FlagFilter = "query:checkout"
+	filteredPath, err := flagCachePath(newApiClient(opts).Options)
+	require.NoError(t, err)
+	assert.NotEqual(t, path, filteredPath, "flags retrieved with different filters are cached separately")
+}
+
+func TestReadOfflineFlags(t *testing.T) {
+	dir, err := ioutil.TempDir("", "offlineflags")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	specs := []struct {
+		name     string
+		contents string
+		want     []string
+		wantErr  bool
+	}{
+		{name: "array of flag keys", contents: `["flag-a", "flag-b"]`, want: []string{"flag-a", "flag-b"}},
+		{name: "api response", contents: `{"items": [{"key": "flag-a", "name": "Flag A"}], "totalCount": 1}`, want: []string{"flag-a"}},
+		{name: "unknown format", contents: `{"flags": ["flag-a"]}`, wantErr: true},
+	}
+
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "flags.json")
+			require.NoError(t, ioutil.WriteFile(path, []byte(tt.contents), 0600))
+			flags, err := readOfflineFlags(path)
+			if tt.wantErr {
+				assert.EqualError(t, err, path+" must contain an array of flag keys, or a list of flags returned by the LaunchDarkly API")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, flags)
+		})
+	}
+}
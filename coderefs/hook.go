@@ -0,0 +1,188 @@
+package coderefs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	"github.com/launchdarkly/ld-find-code-refs/internal/warnings"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+)
+
+// scanResult is the JSON document sent to the output hook and written to JSON outputs. It includes the scan manifest, all
+// code references found, and the metadata of each referenced flag if the flagMetadata option is enabled.
+type scanResult struct {
+	Manifest   manifest                   `json:"manifest"`
+	References []ld.ReferenceHunksRep     `json:"references"`
+	Flags      map[string]ld.FlagMetadata `json:"flags,omitempty"`
+}
+
+func newScanResult(m manifest, branch ld.BranchRep, metadata map[string]ld.FlagMetadata) scanResult {
+	refs := branch.References
+	if refs == nil {
+		refs = []ld.ReferenceHunksRep{}
+	}
+	return scanResult{Manifest: m, References: refs, Flags: referencedFlagMetadata(branch, metadata)}
+}
+
+// runOutputHook runs the output hook command in dir, sending the scan result to its standard input as JSON. The command's
+// output is forwarded to the scanner's output, and a non-zero exit status is returned as an error.
+func runOutputHook(command, dir string, result scanResult) error {
+	tokens := strings.Fields(command)
+	if len(tokens) == 0 {
+		return errors.New("output hook command is empty")
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	log.Debug.Printf("running output hook: %s", command)
+	/* #nosec */
+	cmd := exec.Command(tokens[0], tokens[1:]...)
+	cmd.Env = commandEnviron()
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = log.Console()
+	cmd.Stderr = os.Stderr
+	cmd.Dir = dir
+	err = cmd.Run()
+	if err != nil {
+		return fmt.Errorf("failed to execute output hook: %w", err)
+	}
+	return nil
+}
+
+// Lifecycle hooks
+const (
+	hookPreScan    = "preScan"
+	hookPostScan   = "postScan"
+	hookPostUpload = "postUpload"
+)
+
+// hookEnv returns environment variables describing a scan to lifecycle hooks. Results are included once the search has completed.
+func hookEnv(hook string, m manifest, dir string, dryRun, searched bool) []string {
+	env := []string{
+		"LD_CODEREFS_HOOK=" + hook,
+		"LD_CODEREFS_DIR=" + dir,
+		"LD_CODEREFS_PROJ_KEY=" + m.ProjKey,
+		"LD_CODEREFS_REPO_NAME=" + m.RepoName,
+		"LD_CODEREFS_BRANCH=" + m.Branch,
+		"LD_CODEREFS_REVISION=" + m.Revision,
+		"LD_CODEREFS_DRY_RUN=" + strconv.FormatBool(dryRun),
+	}
+	if searched {
+		env = append(env,
+			"LD_CODEREFS_FLAGS="+strconv.Itoa(m.Flags),
+			"LD_CODEREFS_FILES="+strconv.Itoa(m.Files),
+			"LD_CODEREFS_REFERENCES="+strconv.Itoa(m.References),
+			"LD_CODEREFS_WARNINGS="+strconv.Itoa(len(m.Warnings)),
+			"LD_CODEREFS_CODES="+joinCodes(m.Codes),
+			"LD_CODEREFS_PARTIAL="+strconv.FormatBool(m.Partial),
+		)
+	}
+	return env
+}
+
+func joinCodes(codes []warnings.Code) string {
+	names := make([]string, 0, len(codes))
+	for _, c := range codes {
+		names = append(names, string(c))
+	}
+	return strings.Join(names, ",")
+}
+
+// runLifecycleHook runs a hook's shell command in dir, with env added to the scanner's environment, see commandEnviron. The command's output is
+// forwarded to the scanner's output, and a non-zero exit status is returned as an error. Empty commands are not run.
+func runLifecycleHook(hook, command, dir string, env []string) error {
+	if strings.TrimSpace(command) == "" {
+		return nil
+	}
+	log.Info.Printf("running %s hook", hook)
+	/* #nosec */
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Env = append(commandEnviron(), env...)
+	cmd.Stdout = log.Console()
+	cmd.Stderr = os.Stderr
+	cmd.Dir = dir
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("%s hook failed: %w", hook, err)
+	}
+	return nil
+}
+
+// credentialEnv are the environment variables holding credentials read by the scanner, including the variables named by
+// the accessTokenEnv option of workspace repositories
+var credentialEnv = struct {
+	sync.Mutex
+	names map[string]bool
+}{names: map[string]bool{
+	"BITBUCKET_ACCESS_TOKEN":            true,
+	"BITBUCKET_APP_PASSWORD":            true,
+	"GITHUB_TOKEN":                      true,
+	"JIRA_API_TOKEN":                    true,
+	"LD_ACCESS_TOKEN":                   true,
+	"LD_ANONYMIZE_KEY":                  true,
+	"LD_SERVE_TOKEN":                    true,
+	"LD_WEBHOOK_SECRET":                 true,
+	"OTEL_EXPORTER_OTLP_HEADERS":        true,
+	"OTEL_EXPORTER_OTLP_TRACES_HEADERS": true,
+}}
+
+// addCredentialEnv adds the environment variables holding the access tokens of workspace repositories to credentialEnv
+func addCredentialEnv(repos []options.WorkspaceRepo) {
+	credentialEnv.Lock()
+	defer credentialEnv.Unlock()
+	for _, repo := range repos {
+		if repo.AccessTokenEnv != "" {
+			credentialEnv.names[repo.AccessTokenEnv] = true
+		}
+	}
+}
+
+// commandEnviron returns the scanner's environment without credentials, which hooks, the output hook, and command
+// aliases do not need, and which commands set by repository configuration could otherwise read
+func commandEnviron() []string {
+	credentialEnv.Lock()
+	defer credentialEnv.Unlock()
+	env := os.Environ()
+	ret := make([]string, 0, len(env))
+	for _, v := range env {
+		if !credentialEnv.names[strings.SplitN(v, "=", 2)[0]] {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+// checkRepoCommands returns an error if hooks or the output hook set by the repository's configuration are not allowed
+// by the command alias policy, so configuration which is not trusted to run command aliases cannot run commands
+// through hooks either
+func checkRepoCommands(opts options.Options) error {
+	policy := newAliasCommandPolicy(opts)
+	if !policy.restricted() {
+		return nil
+	}
+	commands, err := opts.RepoCommands()
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{options.CommandPreScan, options.CommandOutputHook, options.CommandPostScan, options.CommandPostUpload} {
+		command, ok := commands[name]
+		if !ok {
+			continue
+		}
+		err := policy.checkCommand(name, command, name != options.CommandOutputHook)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
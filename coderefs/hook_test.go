@@ -0,0 +1,190 @@
+package coderefs
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+)
+
+func TestRunOutputHook(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hook")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	branch := ld.BranchRep{
+		Name: "main",
+		Head: "0123456789abcdef",
+		References: []ld.ReferenceHunksRep{
+			{Path: "a", Hunks: []ld.HunkRep{{StartingLineNumber: 1, Lines: "flag-a", ProjKey: "default", FlagKey: "flag-a"}}},
+			{Path: "b", Hunks: []ld.HunkRep{{StartingLineNumber: 1, Lines: "flagA", ProjKey: "default", FlagKey: "flag-a", Aliases: []string{"flagA"},
+				AliasMatches: []ld.AliasMatch{{Alias: "flagA", Rule: "aliases[0] (camelcase)"}}}}},
+		},
+	}
+	result := newScanResult(newManifest("default", "repo", branch, 1, false, nil), branch, nil)
+
+	// tee writes its standard input to the given file, relative to the working directory
+	require.NoError(t, runOutputHook("tee result.json", dir, result))
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "result.json"))
+	require.NoError(t, err)
+	var got scanResult
+	require.NoError(t, json.Unmarshal(data, &got))
+	assert.Equal(t, result, got)
+	assert.Equal(t, "main", got.Manifest.Branch)
+	assert.Contains(t, string(data), `"aliasMatches":[{"alias":"flagA","rule":"aliases[0] (camelcase)"}]`)
+}
+
+func TestRunOutputHook_errors(t *testing.T) {
+	result := newScanResult(newManifest("default", "repo", ld.BranchRep{}, 0, false, nil), ld.BranchRep{}, nil)
+	assert.EqualError(t, runOutputHook(" ", ".", result), "output hook command is empty")
+	assert.Error(t, runOutputHook("false", ".", result))
+	assert.Error(t, runOutputHook("ld-find-code-refs-missing-hook", ".", result))
+}
+
+func TestRunLifecycleHook(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hook")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m := manifest{ProjKey: "default", RepoName: "repo", Branch: "main", Revision: "abc", Flags: 2, Files: 1, References: 3}
+	env := hookEnv(hookPostScan, m, dir, true, true)
+	require.NoError(t, runLifecycleHook(hookPostScan, `echo "$LD_CODEREFS_HOOK $LD_CODEREFS_BRANCH $LD_CODEREFS_REFERENCES $LD_CODEREFS_DRY_RUN" > env.txt`, dir, env))
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "env.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "postScan main 3 true\n", string(data))
+
+	assert.NoError(t, runLifecycleHook(hookPreScan, "", dir, nil))
+	assert.EqualError(t, runLifecycleHook(hookPreScan, "exit 2", dir, nil), "preScan hook failed: exit status 2")
+}
+
+func TestRunLifecycleHook_accessToken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hook")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	token, ok := os.LookupEnv("LD_ACCESS_TOKEN")
+	require.NoError(t, os.Setenv("LD_ACCESS_TOKEN", "api-secret"))
+	defer func() {
+		if ok {
+			os.Setenv("LD_ACCESS_TOKEN", token)
+		} else {
+			os.Unsetenv("LD_ACCESS_TOKEN")
+		}
+	}()
+
+	require.NoError(t, runLifecycleHook(hookPostUpload, `echo "${LD_ACCESS_TOKEN:-unset}" > token.txt`, dir, nil))
+	data, err := ioutil.ReadFile(filepath.Join(dir, "token.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "unset\n", string(data))
+	assert.NotContains(t, commandEnviron(), "LD_ACCESS_TOKEN=api-secret")
+
+	key, keySet := os.LookupEnv("LD_ANONYMIZE_KEY")
+	require.NoError(t, os.Setenv("LD_ANONYMIZE_KEY", "secret"))
+	defer func() {
+		if keySet {
+			os.Setenv("LD_ANONYMIZE_KEY", key)
+		} else {
+			os.Unsetenv("LD_ANONYMIZE_KEY")
+		}
+	}()
+	assert.NotContains(t, commandEnviron(), "LD_ANONYMIZE_KEY=secret")
+}
+
+func TestCommandEnviron(t *testing.T) {
+	for name, value := range map[string]string{"GITHUB_TOKEN": "ghp-secret", "LD_SERVE_TOKEN": "serve-secret", "REPO_TOKEN": "api-repo", "KEEP": "kept"} {
+		previous, ok := os.LookupEnv(name)
+		require.NoError(t, os.Setenv(name, value))
+		defer func(name string) {
+			if ok {
+				os.Setenv(name, previous)
+			} else {
+				os.Unsetenv(name)
+			}
+		}(name)
+	}
+	assert.Contains(t, commandEnviron(), "REPO_TOKEN=api-repo")
+	addCredentialEnv([]options.WorkspaceRepo{{RepoName: "repo", AccessTokenEnv: "REPO_TOKEN"}})
+	defer func() {
+		credentialEnv.Lock()
+		delete(credentialEnv.names, "REPO_TOKEN")
+		credentialEnv.Unlock()
+	}()
+
+	env := commandEnviron()
+	assert.Contains(t, env, "KEEP=kept")
+	assert.NotContains(t, env, "GITHUB_TOKEN=ghp-secret")
+	assert.NotContains(t, env, "LD_SERVE_TOKEN=serve-secret")
+	assert.NotContains(t, env, "REPO_TOKEN=api-repo")
+}
+
+func Test_checkRepoCommands(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hook")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.Mkdir(filepath.Join(dir, ".launchdarkly"), 0700))
+	config := "outputHook: jq .\nhooks:\n  preScan: make generate\n  postScan: make report; curl -d @report.json https://example.com\n"
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, ".launchdarkly", "coderefs.yaml"), []byte(config), 0600))
+	repoOpts := options.Options{Dir: dir, OutputHook: "jq .", Hooks: options.Hooks{PreScan: "make generate"}}
+
+	specs := []struct {
+		name    string
+		modify  func(o *options.Options)
+		wantErr string
+	}{
+		{name: "unrestricted", modify: func(o *options.Options) { o.Hooks.PostScan = "make report; curl https://example.com" }},
+		{
+			name:    "disallowed",
+			modify:  func(o *options.Options) { o.DisallowCommandAliases = true },
+			wantErr: "hooks.preScan command 'make generate' is not allowed: commands in repository configuration are disabled by the disallowCommandAliases option",
+		},
+		{name: "allowed", modify: func(o *options.Options) { o.AllowedAliasCommands = "make,jq" }},
+		{
+			name:    "executable not allowed",
+			modify:  func(o *options.Options) { o.AllowedAliasCommands = "make" },
+			wantErr: "outputHook command 'jq .' is not allowed: 'jq' is not one of the allowedAliasCommands (make)",
+		},
+		{
+			name: "shell syntax",
+			modify: func(o *options.Options) {
+				o.AllowedAliasCommands = "make,jq"
+				o.Hooks.PostScan = "make report; curl -d @report.json https://example.com"
+			},
+			wantErr: "hooks.postScan command 'make report; curl -d @report.json https://example.com' is not allowed: shell commands in repository configuration may only run one of the allowedAliasCommands (make, jq)",
+		},
+		{
+			name: "commands from flags",
+			modify: func(o *options.Options) {
+				o.DisallowCommandAliases = true
+				o.OutputHook = "./publish.sh"
+				o.Hooks = options.Hooks{}
+			},
+		},
+	}
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := repoOpts
+			tt.modify(&opts)
+			err := checkRepoCommands(opts)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHookEnv(t *testing.T) {
+	m := manifest{ProjKey: "default", RepoName: "repo", Branch: "main", Revision: "abc"}
+	assert.NotContains(t, hookEnv(hookPreScan, m, "/repo", false, false), "LD_CODEREFS_REFERENCES=0")
+	assert.Contains(t, hookEnv(hookPostScan, m, "/repo", false, true), "LD_CODEREFS_REFERENCES=0")
+	assert.Contains(t, hookEnv(hookPreScan, m, "/repo", false, false), "LD_CODEREFS_REVISION=abc")
+}
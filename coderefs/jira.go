@@ -0,0 +1,222 @@
+package coderefs
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/jira"
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+)
+
+// jiraFlagLabelPrefix and jiraRepoLabelPrefix label the flag and repository of each issue, so later scans update the
+// issue rather than creating another
+const (
+	jiraFlagLabelPrefix = "launchdarkly-flag:"
+	jiraRepoLabelPrefix = "launchdarkly-repo:"
+)
+
+// publishJiraIssues creates a Jira issue for each stale flag referenced in the branch, or updates the issue created by a
+// previous scan. Failures are logged, and do not fail the scan.
+func publishJiraIssues(opts options.Options, ldApi ld.ApiClient, repoName, revision string, branch ld.BranchRep, dryRun, partial bool) {
+	if opts.Jira.Project == "" {
+		return
+	}
+	if partial {
+		// issues would only list the references found before the deadline
+		log.Warning.Printf("skipping Jira issues because code references are partial")
+		return
+	}
+	issues := jiraIssues(opts.Jira, repoName, revision, branch, staleFlags(opts, ldApi))
+	if len(issues) == 0 {
+		log.Info.Printf("no stale flags have code references, no Jira issues will be created")
+		return
+	}
+	if dryRun {
+		log.Info.Printf("found %d stale flags with code references, Jira issues are not created or updated during a dry run", len(issues))
+		return
+	}
+	token := os.Getenv("JIRA_API_TOKEN")
+	if token == "" {
+		log.Warning.Printf("skipping Jira issues: JIRA_API_TOKEN, and JIRA_USER_EMAIL for Jira Cloud, must be set")
+		return
+	}
+
+	client := jira.NewClient(opts.Jira.Url, os.Getenv("JIRA_USER_EMAIL"), token)
+	created, updated := 0, 0
+	for _, issue := range issues {
+		existing, err := client.FindIssue(issue.Project, issue.Labels[:2])
+		if err != nil {
+			log.Warning.Printf("unable to search for Jira issues, skipping remaining issues: %s", err)
+			break
+		}
+		if existing == nil {
+			key, err := client.CreateIssue(issue)
+			if err != nil {
+				log.Warning.Printf("unable to create Jira issue %q: %s", issue.Summary, err)
+				continue
+			}
+			log.Info.Printf("created Jira issue %s", client.IssueUrl(key))
+			created++
+			continue
+		}
+		issue.Key = existing.Key
+		issue.Labels = mergeLabels(existing.Labels, issue.Labels)
+		if issue.Summary == existing.Summary && issue.Description == existing.Description && len(issue.Labels) == len(existing.Labels) {
+			continue
+		}
+		err = client.UpdateIssue(issue)
+		if err != nil {
+			log.Warning.Printf("unable to update Jira issue %s: %s", existing.Key, err)
+			continue
+		}
+		log.Info.Printf("updated Jira issue %s", client.IssueUrl(existing.Key))
+		updated++
+	}
+	log.Info.Printf("created %d and updated %d Jira issues for %d stale flags with code references", created, updated, len(issues))
+}
+
+// staleFlags returns the reason each stale flag is stale, according to the configured policies
+func staleFlags(opts options.Options, ldApi ld.ApiClient) map[string]string {
+	policies := opts.Jira.StaleFlags
+	if len(policies) == 0 {
+		policies = []string{options.StaleArchived, options.StaleRolledOut}
+	}
+	ret := map[string]string{}
+	for _, policy := range policies {
+		switch policy {
+		case options.StaleArchived:
+			for flag := range archivedFlagSet(opts, ldApi) {
+				ret[flag] = policy
+			}
+		case options.StaleRolledOut:
+			if opts.OfflineFlags != "" || opts.AllProjects {
+				log.Warning.Printf("flag rollouts are not available when offlineFlags or allProjects is set, Jira issues will not be created for rolled out flags")
+				continue
+			}
+			flags, err := ldApi.GetRolledOutFlagKeyList()
+			if err != nil {
+				log.Warning.Printf("unable to retrieve rolled out flags, Jira issues will not be created for rolled out flags: %s", err)
+				continue
+			}
+			for _, flag := range flags {
+				if _, ok := ret[flag]; !ok {
+					ret[flag] = policy
+				}
+			}
+		}
+	}
+	return ret
+}
+
+// jiraIssues returns an issue for each stale flag referenced in the branch, listing the referencing files, ordered by flag
+func jiraIssues(config options.Jira, repoName, revision string, branch ld.BranchRep, stale map[string]string) []jira.Issue {
+	type flagRef struct {
+		projKey, flagKey string
+	}
+	lines := map[flagRef]map[string][]int{}
+	for _, ref := range branch.References {
+		for _, hunk := range ref.Hunks {
+			if _, ok := stale[hunk.FlagKey]; !ok {
+				continue
+			}
+			key := flagRef{hunk.ProjKey, hunk.FlagKey}
+			if lines[key] == nil {
+				lines[key] = map[string][]int{}
+			}
+			if len(hunk.Matches) == 0 {
+				lines[key][ref.Path] = append(lines[key][ref.Path], hunk.StartingLineNumber)
+			}
+			for _, m := range hunk.Matches {
+				lines[key][ref.Path] = append(lines[key][ref.Path], m.LineNumber)
+			}
+		}
+	}
+	flags := make([]flagRef, 0, len(lines))
+	for key := range lines {
+		flags = append(flags, key)
+	}
+	sort.Slice(flags, func(i, j int) bool {
+		if flags[i].flagKey != flags[j].flagKey {
+			return flags[i].flagKey < flags[j].flagKey
+		}
+		return flags[i].projKey < flags[j].projKey
+	})
+
+	issueType := config.IssueType
+	if issueType == "" {
+		issueType = "Task"
+	}
+	commit := shortRevision(revision)
+	ret := make([]jira.Issue, 0, len(flags))
+	for _, f := range flags {
+		var sb strings.Builder
+		if stale[f.flagKey] == options.StaleArchived {
+			fmt.Fprintf(&sb, "The flag {{%s}} is archived in LaunchDarkly project {{%s}}, but is still referenced in repository {{%s}}.", f.flagKey, f.projKey, repoName)
+		} else {
+			fmt.Fprintf(&sb, "The flag {{%s}} in LaunchDarkly project {{%s}} serves the same variation to all users in every environment, and can be removed from repository {{%s}}.", f.flagKey, f.projKey, repoName)
+		}
+		fmt.Fprintf(&sb, "\n\nCode references on branch {{%s}} at commit {{%s}}:\n", branch.Name, commit)
+		paths := make([]string, 0, len(lines[f]))
+		for path := range lines[f] {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			fmt.Fprintf(&sb, "* {{%s}}: %s\n", path, lineList(lines[f][path]))
+		}
+		sb.WriteString("\nThis issue was created by ld-find-code-refs, and is updated each time the repository is scanned.")
+
+		summary := fmt.Sprintf("Remove references to archived flag %s from %s", f.flagKey, repoName)
+		if stale[f.flagKey] == options.StaleRolledOut {
+			summary = fmt.Sprintf("Remove rolled out flag %s from %s", f.flagKey, repoName)
+		}
+		labels := append([]string{jiraFlagLabelPrefix + f.projKey + "/" + f.flagKey, jiraRepoLabelPrefix + repoName}, config.Labels...)
+		ret = append(ret, jira.Issue{
+			Project:     config.Project,
+			IssueType:   issueType,
+			Summary:     summary,
+			Description: sb.String(),
+			Labels:      labels,
+		})
+	}
+	return ret
+}
+
+// lineList formats line numbers, e.g. "line 3" or "lines 5, 12"
+func lineList(lineNumbers []int) string {
+	sort.Ints(lineNumbers)
+	formatted := []string{}
+	for i, n := range lineNumbers {
+		if i > 0 && n == lineNumbers[i-1] {
+			continue
+		}
+		formatted = append(formatted, strconv.Itoa(n))
+	}
+	if len(formatted) == 1 {
+		return "line " + formatted[0]
+	}
+	return "lines " + strings.Join(formatted, ", ")
+}
+
+// mergeLabels adds labels to the labels of an existing issue, keeping labels added to the issue since it was created
+func mergeLabels(existing, labels []string) []string {
+	ret := append([]string{}, existing...)
+	for _, label := range labels {
+		found := false
+		for _, e := range existing {
+			if e == label {
+				found = true
+				break
+			}
+		}
+		if !found {
+			ret = append(ret, label)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,121 @@
+package coderefs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/jira"
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+	"github.com/launchdarkly/ld-find-code-refs/testserver"
+)
+
+func TestJiraIssues(t *testing.T) {
+	branch := ld.BranchRep{Name: "main", References: []ld.ReferenceHunksRep{
+		{Path: "b.go", Hunks: []ld.HunkRep{{ProjKey: "default", FlagKey: "old-flag", StartingLineNumber: 10, Matches: []ld.Match{{LineNumber: 12}, {LineNumber: 14}}}}},
+		{Path: "a.go", Hunks: []ld.HunkRep{
+			{ProjKey: "default", FlagKey: "new-flag", StartingLineNumber: 1},
+			{ProjKey: "default", FlagKey: "old-flag", StartingLineNumber: 5},
+			{ProjKey: "default", FlagKey: "launched", StartingLineNumber: 7},
+		}},
+	}}
+	config := options.Jira{Project: "FLAGS", Labels: []string{"flag-debt"}}
+	stale := map[string]string{"old-flag": options.StaleArchived, "launched": options.StaleRolledOut}
+
+	issues := jiraIssues(config, "my-repo", "0123456789", branch, stale)
+	require.Len(t, issues, 2)
+	assert.Equal(t, jira.Issue{
+		Project:   "FLAGS",
+		IssueType: "Task",
+		Summary:   "Remove rolled out flag launched from my-repo",
+		Description: "The flag {{launched}} in LaunchDarkly project {{default}} serves the same variation to all users in every environment, and can be removed from repository {{my-repo}}." +
+			"\n\nCode references on branch {{main}} at commit {{0123456}}:\n* {{a.go}}: line 7\n" +
+			"\nThis issue was created by ld-find-code-refs, and is updated each time the repository is scanned.",
+		Labels: []string{"launchdarkly-flag:default/launched", "launchdarkly-repo:my-repo", "flag-debt"},
+	}, issues[0])
+	assert.Equal(t, "Remove references to archived flag old-flag from my-repo", issues[1].Summary)
+	assert.Contains(t, issues[1].Description, "* {{a.go}}: line 5\n* {{b.go}}: lines 12, 14\n")
+}
+
+// jiraServer emulates issue search, creation, and updates of the Jira REST API
+type jiraServer struct {
+	mu     sync.Mutex
+	issues []map[string]interface{}
+}
+
+func (s *jiraServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var body map[string]interface{}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+	switch {
+	case r.Method == "POST" && r.URL.Path == "/rest/api/2/search":
+		found := []map[string]interface{}{}
+		for _, issue := range s.issues {
+			labels := issue["fields"].(map[string]interface{})["labels"].([]interface{})
+			if len(labels) > 0 && strings.Contains(body["jql"].(string), labels[0].(string)) {
+				found = append(found, issue)
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"issues": found})
+	case r.Method == "POST" && r.URL.Path == "/rest/api/2/issue":
+		key := fmt.Sprintf("FLAGS-%d", len(s.issues)+1)
+		s.issues = append(s.issues, map[string]interface{}{"key": key, "fields": body["fields"]})
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]string{"key": key})
+	case r.Method == "PUT" && strings.HasPrefix(r.URL.Path, "/rest/api/2/issue/"):
+		for _, issue := range s.issues {
+			if "/rest/api/2/issue/"+issue["key"].(string) == r.URL.Path {
+				issue["fields"] = body["fields"]
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestPublishJiraIssues(t *testing.T) {
+	server := testserver.New("")
+	server.AddProject("default", []string{"new-flag"}, []string{"old-flag", "other-old-flag"})
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	jiraState := &jiraServer{}
+	jiraHttpServer := httptest.NewServer(jiraState)
+	defer jiraHttpServer.Close()
+	defer os.Setenv("JIRA_API_TOKEN", os.Getenv("JIRA_API_TOKEN"))
+	os.Setenv("JIRA_API_TOKEN", "jira-token")
+
+	retryMax := 0
+	ldApi := ld.InitApiClient(ld.ApiOptions{ApiKey: "api-x", ProjKey: "default", BaseUri: httpServer.URL, RetryMax: &retryMax})
+	opts := options.Options{Jira: options.Jira{Url: jiraHttpServer.URL, Project: "FLAGS", StaleFlags: []string{options.StaleArchived}}}
+	branch := func(paths ...string) ld.BranchRep {
+		refs := []ld.ReferenceHunksRep{}
+		for _, path := range paths {
+			refs = append(refs, ld.ReferenceHunksRep{Path: path, Hunks: []ld.HunkRep{{ProjKey: "default", FlagKey: "old-flag", StartingLineNumber: 1}}})
+		}
+		return ld.BranchRep{Name: "main", References: refs}
+	}
+
+	publishJiraIssues(opts, ldApi, "my-repo", "0123456789", branch("a.go"), true, false)
+	assert.Empty(t, jiraState.issues, "issues are not created during a dry run")
+
+	publishJiraIssues(opts, ldApi, "my-repo", "0123456789", branch("a.go"), false, false)
+	require.Len(t, jiraState.issues, 1)
+
+	jiraState.issues[0]["fields"].(map[string]interface{})["labels"] = append(jiraState.issues[0]["fields"].(map[string]interface{})["labels"].([]interface{}), "triaged")
+	publishJiraIssues(opts, ldApi, "my-repo", "0123456789", branch("a.go", "b.go"), false, false)
+	require.Len(t, jiraState.issues, 1, "the issue created by the previous scan is updated")
+	fields := jiraState.issues[0]["fields"].(map[string]interface{})
+	assert.Contains(t, fields["description"], "* {{b.go}}: line 1")
+	assert.Equal(t, []interface{}{"launchdarkly-flag:default/old-flag", "launchdarkly-repo:my-repo", "triaged"}, fields["labels"])
+}
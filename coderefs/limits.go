@@ -0,0 +1,22 @@
+package coderefs
+
+import (
+	"runtime"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+	"github.com/launchdarkly/ld-find-code-refs/search"
+)
+
+// applyResourceLimits limits the CPUs, files searched at once, and rate of reads used by searches in this process
+func applyResourceLimits(opts options.Options) {
+	if opts.MaxProcs > 0 {
+		previous := runtime.GOMAXPROCS(opts.MaxProcs)
+		log.Debug.Printf("limited GOMAXPROCS from %d to %d", previous, opts.MaxProcs)
+	}
+	search.SetLimits(search.Limits{
+		Concurrency:        opts.SearchConcurrency,
+		ReadBytesPerSecond: int64(opts.MaxReadKbPerSecond) * 1024,
+		Adaptive:           opts.AdaptiveThrottle,
+	})
+}
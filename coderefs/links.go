@@ -0,0 +1,97 @@
+package coderefs
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+)
+
+// previewLinkCount is the number of code references whose links are printed by the previewLinks option
+const previewLinkCount = 5
+
+// commitUrl returns the url of a commit in the repository's VCS provider, using the commit url template, or the url
+// LaunchDarkly would generate for GitHub and Bitbucket repositories. If neither is available, an empty string is returned.
+func commitUrl(repoParams ld.RepoParams, branchName, revision string) string {
+	switch {
+	case repoParams.CommitUrlTemplate != "":
+		return strings.NewReplacer("${branchName}", escapeUrlPath(branchName), "${sha}", revision).Replace(repoParams.CommitUrlTemplate)
+	case repoParams.Url == "" || revision == "":
+		return ""
+	case strings.EqualFold(repoParams.Type, repoTypeGithub):
+		return repoParams.Url + "/commit/" + revision
+	case strings.EqualFold(repoParams.Type, "bitbucket"):
+		return repoParams.Url + "/commits/" + revision
+	}
+	return ""
+}
+
+// hunkUrl returns the url of a code reference in the repository's VCS provider, using the hunk url template, or the url
+// LaunchDarkly would generate for GitHub and Bitbucket repositories. If neither is available, an empty string is returned.
+func hunkUrl(repoParams ld.RepoParams, revision, path string, line int) string {
+	escapedPath := escapeUrlPath(path)
+	lineNumber := strconv.Itoa(line)
+	switch {
+	case repoParams.HunkUrlTemplate != "":
+		return strings.NewReplacer("${sha}", revision, "${filePath}", escapedPath, "${lineNumber}", lineNumber).Replace(repoParams.HunkUrlTemplate)
+	case repoParams.Url == "" || revision == "":
+		return ""
+	case strings.EqualFold(repoParams.Type, repoTypeGithub):
+		return repoParams.Url + "/blob/" + revision + "/" + escapedPath + "#L" + lineNumber
+	case strings.EqualFold(repoParams.Type, "bitbucket"):
+		return repoParams.Url + "/src/" + revision + "/" + escapedPath + "#lines-" + lineNumber
+	}
+	return ""
+}
+
+// escapeUrlPath escapes each segment of a slash-separated branch name or file path for use in a url path, so characters
+// such as '#' and '?' do not start the fragment or query of the url
+func escapeUrlPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// printLinkPreview prints the commit url of a scan, and the hunk urls of the first code reference in each of a sample
+// of files, so url templates can be checked before links are shown in LaunchDarkly. Urls which are not absolute http
+// or https urls are flagged.
+func printLinkPreview(w io.Writer, repoParams ld.RepoParams, branch ld.BranchRep, revision string) {
+	fmt.Fprintln(w, "Links to the VCS provider, as shown in LaunchDarkly:")
+	fmt.Fprintf(w, "  commit  %s\n", previewLink(commitUrl(repoParams, branch.Name, revision), "commitUrlTemplate"))
+
+	refs := make([]ld.ReferenceHunksRep, 0, len(branch.References))
+	for _, ref := range branch.References {
+		if len(ref.Hunks) > 0 {
+			refs = append(refs, ref)
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Path < refs[j].Path })
+	if len(refs) > previewLinkCount {
+		refs = refs[:previewLinkCount]
+	}
+	for _, ref := range refs {
+		hunk := ref.Hunks[0]
+		link := hunkUrl(repoParams, revision, ref.Path, hunk.StartingLineNumber)
+		fmt.Fprintf(w, "  %s:%d (%s)  %s\n", ref.Path, hunk.StartingLineNumber, hunk.FlagKey, previewLink(link, "hunkUrlTemplate"))
+	}
+	if len(refs) == 0 {
+		fmt.Fprintln(w, "  no code references were found")
+	}
+}
+
+// previewLink returns a link to print, or an explanation of why the link is missing or invalid
+func previewLink(link, templateOption string) string {
+	if link == "" {
+		return fmt.Sprintf("(none: set %s, or repoType and repoUrl for a GitHub or Bitbucket repository)", templateOption)
+	}
+	if u, err := url.Parse(link); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return link + " (not an absolute http or https url, check " + templateOption + ")"
+	}
+	return link
+}
@@ -0,0 +1,88 @@
+package coderefs
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+)
+
+func Test_commitUrl(t *testing.T) {
+	specs := []struct {
+		name       string
+		repoParams ld.RepoParams
+		want       string
+	}{
+		{"template", ld.RepoParams{Type: "custom", CommitUrlTemplate: "https://example.com/${branchName}/${sha}"}, "https://example.com/main/abc"},
+		{"github", ld.RepoParams{Type: "github", Url: "https://github.com/org/repo"}, "https://github.com/org/repo/commit/abc"},
+		{"bitbucket", ld.RepoParams{Type: "bitbucket", Url: "https://bitbucket.org/org/repo"}, "https://bitbucket.org/org/repo/commits/abc"},
+		{"custom without template", ld.RepoParams{Type: "custom", Url: "https://example.com/repo"}, ""},
+	}
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, commitUrl(tt.repoParams, "main", "abc"))
+		})
+	}
+
+	// branch names are escaped, so '#' does not start a fragment
+	template := ld.RepoParams{Type: "custom", CommitUrlTemplate: "https://example.com/tree/${branchName}?sha=${sha}"}
+	assert.Equal(t, "https://example.com/tree/feature/ABC%23123?sha=abc", commitUrl(template, "feature/ABC#123", "abc"))
+}
+
+func Test_escapeUrlPath(t *testing.T) {
+	assert.Equal(t, "feature/ABC%23123", escapeUrlPath("feature/ABC#123"))
+	assert.Equal(t, "dir/my%20file%3F.go", escapeUrlPath("dir/my file?.go"))
+	assert.Equal(t, "caf%C3%A9", escapeUrlPath("café"))
+}
+
+func Test_hunkUrl(t *testing.T) {
+	specs := []struct {
+		name       string
+		repoParams ld.RepoParams
+		revision   string
+		want       string
+	}{
+		{"template", ld.RepoParams{Type: "custom", HunkUrlTemplate: "https://example.com/${sha}/${filePath}?line=${lineNumber}"}, "abc", "https://example.com/abc/dir/my%20file.go?line=7"},
+		{"github", ld.RepoParams{Type: "github", Url: "https://github.com/org/repo"}, "abc", "https://github.com/org/repo/blob/abc/dir/my%20file.go#L7"},
+		{"bitbucket", ld.RepoParams{Type: "bitbucket", Url: "https://bitbucket.org/org/repo"}, "abc", "https://bitbucket.org/org/repo/src/abc/dir/my%20file.go#lines-7"},
+		{"github without revision", ld.RepoParams{Type: "github", Url: "https://github.com/org/repo"}, "", ""},
+		{"custom without template", ld.RepoParams{Type: "custom", Url: "https://example.com/repo"}, "abc", ""},
+	}
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, hunkUrl(tt.repoParams, tt.revision, "dir/my file.go", 7))
+		})
+	}
+}
+
+func Test_printLinkPreview(t *testing.T) {
+	branch := ld.BranchRep{Name: "main", References: []ld.ReferenceHunksRep{
+		{Path: "b.go", Hunks: []ld.HunkRep{{FlagKey: "flag1", StartingLineNumber: 3}}},
+		{Path: "a.go", Hunks: []ld.HunkRep{{FlagKey: "flag2", StartingLineNumber: 2}, {FlagKey: "flag1", StartingLineNumber: 10}}},
+	}}
+	for i := 0; i < previewLinkCount; i++ {
+		branch.References = append(branch.References, ld.ReferenceHunksRep{Path: "z/" + strings.Repeat("z", i+1) + ".go", Hunks: []ld.HunkRep{{FlagKey: "flag1", StartingLineNumber: 1}}})
+	}
+
+	var buf bytes.Buffer
+	printLinkPreview(&buf, ld.RepoParams{Type: "github", Url: "https://github.com/org/repo"}, branch, "abc")
+	assert.Equal(t, `Links to the VCS provider, as shown in LaunchDarkly:
+  commit  https://github.com/org/repo/commit/abc
+  a.go:2 (flag2)  https://github.com/org/repo/blob/abc/a.go#L2
+  b.go:3 (flag1)  https://github.com/org/repo/blob/abc/b.go#L3
+  z/z.go:1 (flag1)  https://github.com/org/repo/blob/abc/z/z.go#L1
+  z/zz.go:1 (flag1)  https://github.com/org/repo/blob/abc/z/zz.go#L1
+  z/zzz.go:1 (flag1)  https://github.com/org/repo/blob/abc/z/zzz.go#L1
+`, buf.String())
+
+	buf.Reset()
+	repoParams := ld.RepoParams{Type: "custom", HunkUrlTemplate: "example.com/${sha}/${filePath}#${lineNumber}"}
+	printLinkPreview(&buf, repoParams, ld.BranchRep{References: branch.References[:1]}, "abc")
+	assert.Equal(t, `Links to the VCS provider, as shown in LaunchDarkly:
+  commit  (none: set commitUrlTemplate, or repoType and repoUrl for a GitHub or Bitbucket repository)
+  b.go:3 (flag1)  example.com/abc/b.go#3 (not an absolute http or https url, check hunkUrlTemplate)
+`, buf.String())
+}
@@ -0,0 +1,136 @@
+package coderefs
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/validation"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+)
+
+// maxLintExamples is the maximum number of generated aliases printed for each alias definition
+const maxLintExamples = 3
+
+// Lint validates YAML configuration, and evaluates each alias definition against the given sample flag keys, or against
+// flags retrieved from LaunchDarkly if no sample flag keys are provided. Results are written to out, and an error is
+// returned if any problems were found.
+func Lint(opts options.Options, sampleFlags []string, out io.Writer) error {
+	absPath, err := validation.NormalizeAndValidatePath(opts.Dir)
+	if err != nil {
+		return fmt.Errorf("could not validate directory option: %w", err)
+	}
+
+	problems := 0
+	fail := func(format string, args ...interface{}) {
+		problems++
+		fmt.Fprintf(out, "FAIL "+format+"\n", args...)
+	}
+
+	err = opts.ValidateYAML()
+	if err != nil {
+		fail("%s", err)
+	}
+
+	flags := sampleFlags
+	if len(flags) == 0 {
+		if opts.OfflineFlags == "" && (opts.AccessToken == "" || opts.ProjKey == "") {
+			return fmt.Errorf("sample flag keys must be provided when accessToken and projKey are not set, unless offlineFlags is set")
+		}
+		ldApi := newApiClient(opts)
+		flags, err = getFlags(opts, ldApi)
+		if err != nil {
+			return fmt.Errorf("could not retrieve flag keys from LaunchDarkly: %w", err)
+		}
+	}
+	sort.Strings(flags)
+
+	configs := opts.Aliases
+	if len(opts.AliasSources) > 0 {
+		shared, err := options.LoadAliasSources(opts.AliasSources, absPath, opts.AllowedConfigSources)
+		if err != nil {
+			fail("%s", err)
+		}
+		configs = append(shared, configs...)
+	}
+
+	policy := newAliasCommandPolicy(opts)
+	// aliases generated for each flag by any alias definition, to evaluate exclude alias definitions against
+	allGenerated := map[string]map[string]bool{}
+	exclusions := []int{}
+	for i, a := range configs {
+		// Invalid alias definitions have already been reported
+		if a.IsValid() != nil {
+			continue
+		}
+		if a.Type.Canonical() == options.Exclude {
+			exclusions = append(exclusions, i)
+			continue
+		}
+		name := aliasName(i, a)
+
+		if a.Type.Canonical() == options.FilePattern {
+			for _, glob := range a.Paths {
+				matches, err := filepath.Glob(filepath.Join(absPath, glob))
+				if err != nil || len(matches) == 0 {
+					fail("%s: path '%s' does not match any files", name, glob)
+				}
+			}
+		}
+
+		generated, _, err := generateAliasesWithPolicy(flags, []options.Alias{a}, absPath, policy)
+		if err != nil {
+			fail("%s: %s", name, err)
+			continue
+		}
+
+		examples := []string{}
+		total := 0
+		for _, flag := range flags {
+			if len(generated[flag]) == 0 {
+				continue
+			}
+			if allGenerated[flag] == nil {
+				allGenerated[flag] = map[string]bool{}
+			}
+			for _, alias := range generated[flag] {
+				allGenerated[flag][alias] = true
+			}
+			total += len(generated[flag])
+			if len(examples) < maxLintExamples {
+				examples = append(examples, fmt.Sprintf("%s -> %s", flag, strings.Join(generated[flag], ", ")))
+			}
+		}
+		if total == 0 {
+			fmt.Fprintf(out, "WARN %s: no aliases generated for %d flag(s)\n", name, len(flags))
+			continue
+		}
+		fmt.Fprintf(out, "ok   %s: generated %d alias(es) for %d flag(s)\n", name, total, len(flags))
+		for _, example := range examples {
+			fmt.Fprintf(out, "       %s\n", example)
+		}
+	}
+
+	for _, i := range exclusions {
+		name := aliasName(i, configs[i])
+		total := 0
+		for _, flag := range flags {
+			for _, alias := range configs[i].Flags[flag] {
+				if allGenerated[flag][alias] {
+					total++
+				} else {
+					fmt.Fprintf(out, "WARN %s: alias '%s' of flag %s is not generated by any alias definition\n", name, alias, flag)
+				}
+			}
+		}
+		fmt.Fprintf(out, "ok   %s: excluded %d alias(es)\n", name, total)
+	}
+
+	if problems > 0 {
+		return fmt.Errorf("found %d problem(s) in configuration", problems)
+	}
+	fmt.Fprintln(out, "configuration is valid")
+	return nil
+}
@@ -0,0 +1,66 @@
+package coderefs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/options"
+)
+
+func TestLint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lint")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "flags.go"), []byte(`const SOME_FLAG = "some-flag"`), 0600))
+
+	specs := []struct {
+		name    string
+		aliases []options.Alias
+		wantErr bool
+		want    []string
+	}{
+		{
+			name:    "valid aliases",
+			aliases: []options.Alias{{Type: options.CamelCase}, {Type: options.FilePattern, Paths: []string{"*.go"}, Patterns: []string{`(\w+) = "FLAG_KEY"`}}},
+			want:    []string{"ok   aliases[0] (camelcase)", "some-flag -> someFlag", "ok   aliases[1] (filepattern)", "some-flag -> SOME_FLAG", "configuration is valid"},
+		},
+		{
+			name:    "invalid alias",
+			aliases: []options.Alias{{Type: "unknown"}},
+			wantErr: true,
+			want:    []string{"FAIL", "'unknown' is not a valid alias type"},
+		},
+		{
+			name:    "unmatched path",
+			aliases: []options.Alias{{Type: options.FilePattern, Paths: []string{"*.js"}, Patterns: []string{`(\w+) = "FLAG_KEY"`}}},
+			wantErr: true,
+			want:    []string{"FAIL aliases[0] (filepattern): path '*.js' does not match any files", "WARN aliases[0] (filepattern): no aliases generated"},
+		},
+		{
+			name:    "exclusions",
+			aliases: []options.Alias{{Type: options.CamelCase}, {Type: options.Exclude, Flags: map[string][]string{"some-flag": {"someFlag", "SOME_FLAG"}}}},
+			want:    []string{"WARN aliases[1] (exclude): alias 'SOME_FLAG' of flag some-flag is not generated by any alias definition", "ok   aliases[1] (exclude): excluded 1 alias(es)", "configuration is valid"},
+		},
+	}
+
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := Lint(options.Options{Dir: dir, Aliases: tt.aliases}, []string{"some-flag"}, &out)
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			for _, want := range tt.want {
+				assert.Contains(t, out.String(), want)
+			}
+		})
+	}
+}
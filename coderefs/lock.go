@@ -0,0 +1,157 @@
+package coderefs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	"github.com/launchdarkly/ld-find-code-refs/internal/validation"
+)
+
+const (
+	// staleLockAge is the age after which a lockfile is assumed to have been left behind by a scan which did not exit
+	// cleanly. Scans refresh the modification time of their lockfile every lockRefreshInterval, so long scans keep it.
+	staleLockAge = 10 * time.Minute
+	// lockRefreshInterval is how often a scan refreshes the modification time of its lockfile
+	lockRefreshInterval = time.Minute
+)
+
+// errScanLocked is returned when another scan of the same branch holds the lock
+var errScanLocked = errors.New("another scan of the branch is in progress")
+
+// lockHolder identifies the scan holding a lock
+type lockHolder struct {
+	Pid     int       `json:"pid"`
+	Host    string    `json:"host"`
+	Started time.Time `json:"started"`
+}
+
+// scanLock is a lockfile held while a branch is scanned, so concurrent scans of the branch cannot send code references
+// out of order
+type scanLock struct {
+	path string
+	stop chan struct{}
+	done chan struct{}
+}
+
+// acquireScanLock creates the lockfile for scans of a branch in outDir. If the lockfile is held by another scan,
+// errScanLocked is returned. Lockfiles which have not been refreshed for staleLockAge are replaced. The lockfile is
+// refreshed until it is released.
+func acquireScanLock(outDir, projKey, repoName, branchName string) (*scanLock, error) {
+	absPath, err := validation.NormalizeAndValidatePath(outDir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid outDir '%s': %w", outDir, err)
+	}
+	tag := ld.BranchRep{Name: branchName}.FileTag("")
+	path := filepath.Join(absPath, fmt.Sprintf(".coderefs_%s_%s_%s.lock", projKey, repoName, tag))
+
+	host, _ := os.Hostname()
+	data, err := json.Marshal(lockHolder{Pid: os.Getpid(), Host: host, Started: time.Now()})
+	if err != nil {
+		return nil, err
+	}
+	for attempt := 0; attempt < 2; attempt++ {
+		/* #nosec */
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if os.IsExist(err) {
+			if removeStaleLock(path) {
+				continue
+			}
+			if holder, ok := readLockHolder(path); ok {
+				return nil, fmt.Errorf("%w: scan started at %s by process %d on %s holds %s", errScanLocked, holder.Started.Format(time.RFC3339), holder.Pid, holder.Host, path)
+			}
+			return nil, fmt.Errorf("%w: %s is held by another scan", errScanLocked, path)
+		} else if err != nil {
+			return nil, fmt.Errorf("unable to create lockfile: %w", err)
+		}
+		_, err = f.Write(data)
+		closeErr := f.Close()
+		if err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			_ = os.Remove(path)
+			return nil, fmt.Errorf("unable to create lockfile: %w", err)
+		}
+		log.Debug.Printf("acquired lockfile %s", path)
+		lock := &scanLock{path: path, stop: make(chan struct{}), done: make(chan struct{})}
+		go lock.refresh(lockRefreshInterval)
+		return lock, nil
+	}
+	return nil, fmt.Errorf("%w: %s is held by another scan", errScanLocked, path)
+}
+
+// removeStaleLock removes the lockfile at path if it has not been refreshed for staleLockAge, and returns true if it was
+// removed. Concurrent scans may find the same stale lockfile, and one of them may replace it with its own lockfile before
+// another removes it, so the lockfile is first renamed to a unique name, which only one scan can do, and only removed if
+// it is still the stale lockfile once renamed. Otherwise, it is put back.
+func removeStaleLock(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || time.Since(info.ModTime()) <= staleLockAge {
+		return false
+	}
+	stale := fmt.Sprintf("%s.%d.%d.stale", path, os.Getpid(), time.Now().UnixNano())
+	err = os.Rename(path, stale)
+	if err != nil {
+		// another scan removed the lockfile first
+		return os.IsNotExist(err)
+	}
+	renamed, err := os.Stat(stale)
+	if err != nil || !os.SameFile(info, renamed) {
+		err = os.Link(stale, path)
+		if err != nil {
+			log.Warning.Printf("unable to restore lockfile %s of another scan: %s", path, err)
+		}
+		_ = os.Remove(stale)
+		return false
+	}
+	log.Warning.Printf("removing lockfile %s left behind by a scan which started %s ago", path, time.Since(info.ModTime()).Round(time.Minute))
+	_ = os.Remove(stale)
+	return true
+}
+
+func readLockHolder(path string) (lockHolder, bool) {
+	var holder lockHolder
+	/* #nosec */
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return holder, false
+	}
+	return holder, json.Unmarshal(data, &holder) == nil && holder.Pid != 0
+}
+
+// refresh updates the modification time of the lockfile at each interval until the lock is released, so it is not
+// mistaken for a stale lockfile while the scan is running
+func (l *scanLock) refresh(interval time.Duration) {
+	defer close(l.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			now := time.Now()
+			err := os.Chtimes(l.path, now, now)
+			if err != nil {
+				log.Warning.Printf("unable to refresh lockfile %s: %s", l.path, err)
+			}
+		case <-l.stop:
+			return
+		}
+	}
+}
+
+// release stops refreshing the lockfile, and removes it
+func (l *scanLock) release() {
+	close(l.stop)
+	<-l.done
+	err := os.Remove(l.path)
+	if err != nil && !os.IsNotExist(err) {
+		log.Warning.Printf("unable to remove lockfile %s: %s", l.path, err)
+	}
+}
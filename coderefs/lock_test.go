@@ -0,0 +1,102 @@
+package coderefs
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcquireScanLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lock")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	lock, err := acquireScanLock(dir, "default", "repo", "feature/x")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, ".coderefs_default_repo_feature_x.lock"), lock.path)
+
+	_, err = acquireScanLock(dir, "default", "repo", "feature/x")
+	assert.True(t, errors.Is(err, errScanLocked))
+	assert.Contains(t, err.Error(), "by process")
+
+	other, err := acquireScanLock(dir, "default", "repo", "main")
+	require.NoError(t, err, "scans of other branches are not locked")
+	other.release()
+
+	lock.release()
+	lock, err = acquireScanLock(dir, "default", "repo", "feature/x")
+	require.NoError(t, err, "the lock can be acquired once released")
+
+	stale := time.Now().Add(-2 * staleLockAge)
+	require.NoError(t, os.Chtimes(lock.path, stale, stale))
+	lock, err = acquireScanLock(dir, "default", "repo", "feature/x")
+	require.NoError(t, err, "stale locks are replaced")
+	lock.release()
+	_, err = os.Stat(lock.path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestAcquireScanLock_staleConcurrently(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lock")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, ".coderefs_default_repo_main.lock")
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"pid":1}`), 0600))
+	stale := time.Now().Add(-2 * staleLockAge)
+	require.NoError(t, os.Chtimes(path, stale, stale))
+
+	// only one of the scans which find the stale lockfile takes it over
+	locks := make(chan *scanLock, 10)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(locks); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lock, err := acquireScanLock(dir, "default", "repo", "main")
+			if err == nil {
+				locks <- lock
+			} else {
+				assert.True(t, errors.Is(err, errScanLocked), err)
+			}
+		}()
+	}
+	wg.Wait()
+	close(locks)
+	acquired := 0
+	for lock := range locks {
+		acquired++
+		lock.release()
+	}
+	assert.Equal(t, 1, acquired)
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, files, "renamed lockfiles are removed")
+}
+
+func TestScanLock_refresh(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lock")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, ".coderefs.lock")
+	require.NoError(t, ioutil.WriteFile(path, nil, 0600))
+	stale := time.Now().Add(-2 * staleLockAge)
+	require.NoError(t, os.Chtimes(path, stale, stale))
+
+	lock := &scanLock{path: path, stop: make(chan struct{}), done: make(chan struct{})}
+	go lock.refresh(10 * time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.True(t, time.Since(info.ModTime()) < staleLockAge, "the lockfile of a running scan is not stale")
+
+	lock.release()
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,91 @@
+package coderefs
+
+import (
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/provenance"
+	"github.com/launchdarkly/ld-find-code-refs/internal/validation"
+	"github.com/launchdarkly/ld-find-code-refs/internal/version"
+	"github.com/launchdarkly/ld-find-code-refs/internal/warnings"
+)
+
+// manifest summarizes a scan, including any warnings raised while scanning
+type manifest struct {
+	Version    string `json:"version"`
+	ProjKey    string `json:"projKey"`
+	RepoName   string `json:"repoName"`
+	Branch     string `json:"branch"`
+	Revision   string `json:"revision"`
+	Flags      int    `json:"flags"`
+	Files      int    `json:"files"`
+	References int    `json:"references"`
+	Partial    bool   `json:"partial"`
+	// Codes are the distinct codes of the warnings raised, so pipelines can act on specific conditions
+	Codes     []warnings.Code    `json:"codes"`
+	Warnings  []warnings.Warning `json:"warnings"`
+	Artifacts []artifact         `json:"artifacts,omitempty"`
+}
+
+// artifact is a file written to outDir by a scan, with its digest so modifications can be detected
+type artifact struct {
+	Name   string `json:"name"`
+	SHA256 string `json:"sha256"`
+}
+
+func newManifest(projKey, repoName string, branch ld.BranchRep, flags int, partial bool, warns []warnings.Warning) manifest {
+	return manifest{
+		Version:    version.Version,
+		ProjKey:    projKey,
+		RepoName:   repoName,
+		Branch:     branch.Name,
+		Revision:   branch.Head,
+		Flags:      flags,
+		Files:      len(branch.References),
+		References: branch.TotalHunkCount(),
+		Partial:    partial,
+		Codes:      warnings.Codes(warns),
+		Warnings:   warns,
+	}
+}
+
+// addArtifacts records the digests of files written to outDir
+func (m *manifest) addArtifacts(paths ...string) error {
+	for _, path := range paths {
+		digest, err := provenance.Digest(path)
+		if err != nil {
+			return err
+		}
+		m.Artifacts = append(m.Artifacts, artifact{Name: filepath.Base(path), SHA256: digest})
+	}
+	return nil
+}
+
+// write writes the manifest to outDir as JSON, named to match the CSV output of the same scan. If signer is provided,
+// a base64 encoded signature of the manifest is written alongside it, with a .sig extension.
+func (m manifest) write(outDir string, signer crypto.Signer) (string, error) {
+	tag := ld.BranchRep{Name: m.Branch}.FileTag(m.Revision)
+	absPath, err := validation.NormalizeAndValidatePath(outDir)
+	if err != nil {
+		return "", fmt.Errorf("invalid outDir '%s': %w", outDir, err)
+	}
+	path := filepath.Join(absPath, fmt.Sprintf("coderefs_%s_%s_%s_manifest.json", m.ProjKey, m.RepoName, tag))
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	err = ioutil.WriteFile(path, data, 0600)
+	if err != nil || signer == nil {
+		return path, err
+	}
+	signature, err := provenance.Sign(signer, data)
+	if err != nil {
+		return "", fmt.Errorf("could not sign scan manifest: %w", err)
+	}
+	return path, ioutil.WriteFile(path+".sig", []byte(base64.StdEncoding.EncodeToString(signature)+"\n"), 0600)
+}
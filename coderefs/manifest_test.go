@@ -0,0 +1,47 @@
+package coderefs
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/warnings"
+)
+
+func TestManifest_write(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manifest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	branch := ld.BranchRep{
+		Name: "main",
+		Head: "0123456789abcdef",
+		References: []ld.ReferenceHunksRep{
+			{Path: "a", Hunks: []ld.HunkRep{{FlagKey: "flag-a"}, {FlagKey: "flag-b"}}},
+		},
+	}
+	warns := []warnings.Warning{
+		{Category: warnings.Truncation, Code: warnings.LinesTruncated, Message: "truncated 1 lines", Path: "a"},
+		{Category: warnings.Truncation, Code: warnings.LinesTruncated, Message: "truncated 2 lines", Path: "b"},
+	}
+	m := newManifest("default", "repo", branch, 3, true, warns)
+
+	path, err := m.write(dir, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "coderefs_default_repo_0123456_manifest.json", filepath.Base(path))
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	var got manifest
+	require.NoError(t, json.Unmarshal(data, &got))
+	assert.Equal(t, m, got)
+	assert.Equal(t, 1, got.Files)
+	assert.Equal(t, 2, got.References)
+	assert.Equal(t, []warnings.Code{warnings.LinesTruncated}, got.Codes)
+}
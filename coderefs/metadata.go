@@ -0,0 +1,53 @@
+package coderefs
+
+import (
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+)
+
+// flagMetadata returns the tags and maintainer of each flag, for the flagMetadata option. If metadata is not available,
+// no flags have metadata.
+func flagMetadata(opts options.Options, ldApi ld.ApiClient) map[string]ld.FlagMetadata {
+	if opts.OfflineFlags != "" {
+		log.Warning.Printf("flag metadata is not available when offlineFlags is set, tags and maintainers will not be included in outputs")
+		return nil
+	} else if opts.AllProjects {
+		log.Warning.Printf("flag metadata is not available when allProjects is set, tags and maintainers will not be included in outputs")
+		return nil
+	}
+	metadata, err := ldApi.GetFlagMetadata()
+	if err != nil {
+		log.Warning.Printf("unable to retrieve flag metadata, tags and maintainers will not be included in outputs: %s", err)
+		return nil
+	}
+	return metadata
+}
+
+// addFlagMetadata sets the tags and maintainer of the flag of each hunk in the branch, which are written to CSV outputs
+func addFlagMetadata(branch ld.BranchRep, metadata map[string]ld.FlagMetadata) {
+	for _, ref := range branch.References {
+		for i, hunk := range ref.Hunks {
+			if m, ok := metadata[hunk.FlagKey]; ok {
+				ref.Hunks[i].Tags = m.Tags
+				ref.Hunks[i].Maintainer = m.Maintainer
+			}
+		}
+	}
+}
+
+// referencedFlagMetadata returns the metadata of the flags referenced by a branch
+func referencedFlagMetadata(branch ld.BranchRep, metadata map[string]ld.FlagMetadata) map[string]ld.FlagMetadata {
+	if metadata == nil {
+		return nil
+	}
+	ret := map[string]ld.FlagMetadata{}
+	for _, ref := range branch.References {
+		for _, hunk := range ref.Hunks {
+			if m, ok := metadata[hunk.FlagKey]; ok {
+				ret[hunk.FlagKey] = m
+			}
+		}
+	}
+	return ret
+}
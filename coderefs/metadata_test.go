@@ -0,0 +1,47 @@
+package coderefs
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+	"github.com/launchdarkly/ld-find-code-refs/testserver"
+)
+
+func TestFlagMetadata(t *testing.T) {
+	server := testserver.New("")
+	server.AddProject("default", []string{"flag-a", "flag-b", "flag-c"}, nil)
+	server.SetFlagTags("default", "flag-a", "checkout")
+	server.SetFlagMaintainer("default", "flag-a", "payments@example.com")
+	server.SetFlagMaintainer("default", "flag-b", "web@example.com")
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	retryMax := 0
+	client := ld.InitApiClient(ld.ApiOptions{ApiKey: "api-x", ProjKey: "default", BaseUri: httpServer.URL, RetryMax: &retryMax})
+
+	metadata := flagMetadata(options.Options{}, client)
+	require.Len(t, metadata, 3)
+	assert.Nil(t, flagMetadata(options.Options{OfflineFlags: "flags.json"}, client), "metadata is not available offline")
+
+	branch := ld.BranchRep{References: []ld.ReferenceHunksRep{
+		{Path: "a.go", Hunks: []ld.HunkRep{{FlagKey: "flag-a"}, {FlagKey: "flag-b"}, {FlagKey: "unknown"}}},
+	}}
+	addFlagMetadata(branch, metadata)
+	hunks := branch.References[0].Hunks
+	assert.Equal(t, []string{"checkout"}, hunks[0].Tags)
+	assert.Equal(t, "payments@example.com", hunks[0].Maintainer)
+	assert.Equal(t, []string{}, hunks[1].Tags)
+	assert.Equal(t, "web@example.com", hunks[1].Maintainer)
+	assert.Nil(t, hunks[2].Tags)
+
+	result := newScanResult(newManifest("default", "repo", branch, 3, false, nil), branch, metadata)
+	assert.Equal(t, map[string]ld.FlagMetadata{
+		"flag-a": {Tags: []string{"checkout"}, Maintainer: "payments@example.com"},
+		"flag-b": {Tags: []string{}, Maintainer: "web@example.com"},
+	}, result.Flags, "only referenced flags are included in the scan result")
+	assert.Nil(t, newScanResult(manifest{}, branch, nil).Flags)
+}
@@ -0,0 +1,62 @@
+package coderefs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+	"github.com/launchdarkly/ld-find-code-refs/search"
+)
+
+// writeOutputs writes the code references found by a scan to each file of the outputs option. Every output is written
+// from the same scan result, so all outputs of a scan agree.
+func writeOutputs(outputs []options.Output, result scanResult, branch ld.BranchRep, csvDelimiter rune, delimiters search.Delimiters) error {
+	for _, output := range outputs {
+		var write func(io.Writer) error
+		switch output.Format {
+		case options.OutputCSV:
+			write = func(w io.Writer) error { return branch.WriteCSV(w, csvDelimiter) }
+		case options.OutputJSON:
+			write = func(w io.Writer) error {
+				enc := json.NewEncoder(w)
+				enc.SetIndent("", "  ")
+				return enc.Encode(result)
+			}
+		case options.OutputSARIF:
+			write = func(w io.Writer) error { return writeSARIF(w, branch, delimiters) }
+		default:
+			return fmt.Errorf("unknown output format %q", output.Format)
+		}
+		err := writeOutputFile(output.Path, write)
+		if err != nil {
+			return fmt.Errorf("error writing %s output to %s: %w", output.Format, output.Path, err)
+		}
+		log.Info.Printf("wrote %s output to %s", output.Format, output.Path)
+	}
+	return nil
+}
+
+// writeOutputFile creates or truncates the file at path, creating its directory if needed, and writes to it
+func writeOutputFile(path string, write func(io.Writer) error) (err error) {
+	err = os.MkdirAll(filepath.Dir(path), 0750)
+	if err != nil {
+		return err
+	}
+	/* #nosec */
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		closeErr := f.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+	return write(f)
+}
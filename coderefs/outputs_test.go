@@ -0,0 +1,66 @@
+package coderefs
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+	"github.com/launchdarkly/ld-find-code-refs/search"
+)
+
+func TestWriteOutputs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outputs")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	branch := ld.BranchRep{
+		Name: "main",
+		Head: "0123456789abcdef",
+		References: []ld.ReferenceHunksRep{
+			{Path: "a.go", Hunks: []ld.HunkRep{{StartingLineNumber: 1, Lines: `"flag-a"`, ProjKey: "default", FlagKey: "flag-a"}}},
+		},
+	}
+	scanned := newScanResult(newManifest("default", "repo", branch, 1, false, nil), branch, nil)
+	outputs := []options.Output{
+		{Format: options.OutputCSV, Path: filepath.Join(dir, "refs.csv")},
+		{Format: options.OutputJSON, Path: filepath.Join(dir, "nested", "refs.json")},
+		{Format: options.OutputSARIF, Path: filepath.Join(dir, "refs.sarif")},
+	}
+	require.NoError(t, writeOutputs(outputs, scanned, branch, ',', search.NewDelimiters(`"`)))
+
+	/* #nosec */
+	f, err := os.Open(filepath.Join(dir, "refs.csv"))
+	require.NoError(t, err)
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, ld.CSVColumns, rows[0])
+	assert.Equal(t, []string{"flag-a", "a.go", "1"}, rows[1][:3])
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "nested", "refs.json"))
+	require.NoError(t, err)
+	var result scanResult
+	require.NoError(t, json.Unmarshal(data, &result))
+	assert.Equal(t, scanned, result)
+
+	data, err = ioutil.ReadFile(filepath.Join(dir, "refs.sarif"))
+	require.NoError(t, err)
+	var sarif sarifLog
+	require.NoError(t, json.Unmarshal(data, &sarif))
+	require.Len(t, sarif.Runs, 1)
+	require.Len(t, sarif.Runs[0].Results, 1)
+	assert.Equal(t, "a.go", sarif.Runs[0].Results[0].Locations[0].PhysicalLocation.ArtifactLocation.Uri)
+
+	blocked := filepath.Join(dir, "refs.csv", "refs.json")
+	err = writeOutputs([]options.Output{{Format: options.OutputJSON, Path: blocked}}, scanned, branch, ',', search.NewDelimiters(`"`))
+	assert.Error(t, err, "outputs which cannot be written fail the scan")
+}
@@ -0,0 +1,77 @@
+package coderefs
+
+import (
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/warnings"
+)
+
+// Outcomes of a scan reported in porcelain output
+const (
+	porcelainDryRun   = "dry-run"
+	porcelainDeferred = "deferred"
+	porcelainUploaded = "uploaded"
+	porcelainSkipped  = "skipped"
+)
+
+// writePorcelain writes the results of a scan in a stable, machine-readable format. Each line is a record of tab-separated
+// fields, starting with the type of the record:
+//
+//	reference <flag key> <path> <starting line number> <number of lines>
+//	warning <category> <path> <message>
+//	result <outcome> <references> <flags> <files> <partial>
+//
+// References are sorted by path, line number, and flag key, and followed by warnings and a single result record. Fields
+// containing tabs, newlines, or double quotes are quoted as Go string literals.
+func writePorcelain(w io.Writer, outcome string, branch ld.BranchRep, flags int, partial bool, warns []warnings.Warning) error {
+	type reference struct {
+		flagKey  string
+		path     string
+		line     int
+		numLines int
+	}
+	refs := []reference{}
+	for _, ref := range branch.References {
+		for _, hunk := range ref.Hunks {
+			refs = append(refs, reference{hunk.FlagKey, ref.Path, hunk.StartingLineNumber, hunk.NumLines()})
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		a, b := refs[i], refs[j]
+		if a.path != b.path {
+			return a.path < b.path
+		}
+		if a.line != b.line {
+			return a.line < b.line
+		}
+		return a.flagKey < b.flagKey
+	})
+
+	var sb strings.Builder
+	for _, r := range refs {
+		writePorcelainRecord(&sb, "reference", r.flagKey, r.path, strconv.Itoa(r.line), strconv.Itoa(r.numLines))
+	}
+	for _, warning := range warns {
+		writePorcelainRecord(&sb, "warning", string(warning.Category), warning.Path, warning.Message)
+	}
+	writePorcelainRecord(&sb, "result", outcome, strconv.Itoa(len(refs)), strconv.Itoa(flags), strconv.Itoa(len(branch.References)), strconv.FormatBool(partial))
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func writePorcelainRecord(sb *strings.Builder, fields ...string) {
+	for i, field := range fields {
+		if strings.ContainsAny(field, "\t\n\r\"") {
+			field = strconv.Quote(field)
+		}
+		if i > 0 {
+			sb.WriteByte('\t')
+		}
+		sb.WriteString(field)
+	}
+	sb.WriteByte('\n')
+}
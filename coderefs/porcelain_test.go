@@ -0,0 +1,30 @@
+package coderefs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/warnings"
+)
+
+func TestWritePorcelain(t *testing.T) {
+	branch := ld.BranchRep{References: []ld.ReferenceHunksRep{
+		{Path: "src/b.js", Hunks: []ld.HunkRep{{StartingLineNumber: 10, Lines: "a\nb\nc", FlagKey: "flag-b"}, {StartingLineNumber: 2, Lines: "a", FlagKey: "flag-a"}}},
+		{Path: "src/a\tb.js", Hunks: []ld.HunkRep{{StartingLineNumber: 1, Lines: "a", FlagKey: "flag-a"}}},
+	}}
+	warns := []warnings.Warning{{Category: warnings.Truncation, Path: "src/b.js", Message: "truncated 1 line"}}
+
+	var sb strings.Builder
+	require.NoError(t, writePorcelain(&sb, porcelainDryRun, branch, 3, false, warns))
+	assert.Equal(t, strings.Join([]string{
+		"reference\tflag-a\t\"src/a\\tb.js\"\t1\t1",
+		"reference\tflag-a\tsrc/b.js\t2\t1",
+		"reference\tflag-b\tsrc/b.js\t10\t3",
+		"warning\ttruncation\tsrc/b.js\ttruncated 1 line",
+		"result\tdry-run\t3\t3\t2\tfalse",
+	}, "\n")+"\n", sb.String())
+}
@@ -0,0 +1,60 @@
+package coderefs
+
+import (
+	"fmt"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+)
+
+// allProjectsKey replaces the project key in the names of files written by scans of all projects
+const allProjectsKey = "all-projects"
+
+// getProjectFlags retrieves the flag keys of each project. Returns the keys of the flags in any project, in the order of
+// the projects, and the keys of the flags in each project.
+func getProjectFlags(opts options.Options, ldApi ld.ApiClient, cache *scanCache, projKeys []string) ([]string, map[string][]string, error) {
+	flags := []string{}
+	byProject := make(map[string][]string, len(projKeys))
+	seen := map[string]bool{}
+	for _, projKey := range projKeys {
+		projApi := ldApi
+		projApi.Options.ProjKey = projKey
+		projFlags, err := cache.getFlags(opts, projApi)
+		if err != nil {
+			if len(projKeys) > 1 {
+				return nil, nil, fmt.Errorf("project %s: %w", projKey, err)
+			}
+			return nil, nil, err
+		}
+		byProject[projKey] = projFlags
+		for _, flag := range projFlags {
+			if !seen[flag] {
+				seen[flag] = true
+				flags = append(flags, flag)
+			}
+		}
+	}
+	return flags, byProject, nil
+}
+
+// attributeProjects sets the project of each code reference found when searching for the flags of several projects.
+// References to a flag key which exists in more than one project are attributed to each of those projects.
+func attributeProjects(refs []ld.ReferenceHunksRep, projKeys []string, byProject map[string][]string) []ld.ReferenceHunksRep {
+	flagProjects := map[string][]string{}
+	for _, projKey := range projKeys {
+		for _, flag := range byProject[projKey] {
+			flagProjects[flag] = append(flagProjects[flag], projKey)
+		}
+	}
+	for i, ref := range refs {
+		hunks := make([]ld.HunkRep, 0, len(ref.Hunks))
+		for _, hunk := range ref.Hunks {
+			for _, projKey := range flagProjects[hunk.FlagKey] {
+				hunk.ProjKey = projKey
+				hunks = append(hunks, hunk)
+			}
+		}
+		refs[i].Hunks = hunks
+	}
+	return refs
+}
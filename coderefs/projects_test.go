@@ -0,0 +1,53 @@
+package coderefs
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+	"github.com/launchdarkly/ld-find-code-refs/testserver"
+)
+
+func TestGetProjectFlags(t *testing.T) {
+	server := testserver.New("")
+	server.AddProject("web", []string{"checkout", "dark-mode"}, nil)
+	server.AddProject("mobile", []string{"dark-mode", "offline-sync"}, nil)
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	retryMax := 0
+	ldApi := ld.InitApiClient(ld.ApiOptions{ApiKey: "api-x", BaseUri: httpServer.URL, RetryMax: &retryMax})
+	projKeys, err := ldApi.GetProjectKeys()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"mobile", "web"}, projKeys)
+
+	flags, byProject, err := getProjectFlags(options.Options{}, ldApi, newScanCache(), projKeys)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dark-mode", "offline-sync", "checkout"}, flags)
+	assert.Equal(t, map[string][]string{"mobile": {"dark-mode", "offline-sync"}, "web": {"checkout", "dark-mode"}}, byProject)
+
+	_, _, err = getProjectFlags(options.Options{}, ldApi, nil, []string{"web", "missing"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "project missing")
+}
+
+func TestAttributeProjects(t *testing.T) {
+	refs := []ld.ReferenceHunksRep{{Path: "main.go", Hunks: []ld.HunkRep{
+		{StartingLineNumber: 1, FlagKey: "checkout"},
+		{StartingLineNumber: 5, FlagKey: "dark-mode"},
+	}}}
+	byProject := map[string][]string{"mobile": {"dark-mode"}, "web": {"checkout", "dark-mode"}}
+
+	got := attributeProjects(refs, []string{"mobile", "web"}, byProject)
+	want := []ld.HunkRep{
+		{StartingLineNumber: 1, ProjKey: "web", FlagKey: "checkout"},
+		{StartingLineNumber: 5, ProjKey: "mobile", FlagKey: "dark-mode"},
+		{StartingLineNumber: 5, ProjKey: "web", FlagKey: "dark-mode"},
+	}
+	require.Len(t, got, 1)
+	assert.Equal(t, want, got[0].Hunks)
+}
@@ -0,0 +1,66 @@
+package coderefs
+
+import (
+	"fmt"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+)
+
+// Pull writes the code references stored in LaunchDarkly for branches of a repository to outDir, as CSV in the format
+// written by scans, and as JSON in the format sent to LaunchDarkly. If no branches are provided, every branch of the
+// repository is written. Files are named after the branch rather than the head commit, so branches at the same commit
+// do not overwrite each other.
+func Pull(opts options.Options, branches []string) error {
+	missing := []string{}
+	if opts.AccessToken == "" {
+		missing = append(missing, "accessToken")
+	}
+	if opts.ProjKey == "" {
+		missing = append(missing, "projKey")
+	}
+	if opts.RepoName == "" {
+		missing = append(missing, "repoName")
+	}
+	if opts.OutDir == "" {
+		missing = append(missing, "outDir")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required option(s): %v", missing)
+	}
+	opts = withNormalizedRepoName(opts)
+
+	ldApi := ld.InitApiClient(apiOptions(opts))
+	if len(branches) == 0 {
+		stored, err := ldApi.GetCodeReferenceRepositoryBranches(opts.RepoName)
+		if err == ld.NotFoundErr {
+			return fmt.Errorf("repository %s does not exist in LaunchDarkly", opts.RepoName)
+		} else if err != nil {
+			return err
+		}
+		for _, b := range stored {
+			branches = append(branches, b.Name)
+		}
+		log.Info.Printf("found %d branches for repository: %s", len(branches), opts.RepoName)
+	}
+
+	for _, name := range branches {
+		branch, err := ldApi.GetCodeReferenceBranch(opts.RepoName, name)
+		if err == ld.NotFoundErr {
+			return fmt.Errorf("branch %s of repository %s does not exist in LaunchDarkly", name, opts.RepoName)
+		} else if err != nil {
+			return fmt.Errorf("could not retrieve branch %s: %w", name, err)
+		}
+		csvPath, err := branch.WriteToCSV(opts.OutDir, opts.ProjKey, opts.RepoName, "", opts.CSVComma())
+		if err != nil {
+			return fmt.Errorf("could not write branch %s: %w", name, err)
+		}
+		jsonPath, err := branch.WriteToJSON(opts.OutDir, opts.ProjKey, opts.RepoName, "")
+		if err != nil {
+			return fmt.Errorf("could not write branch %s: %w", name, err)
+		}
+		log.Info.Printf("wrote %d code references across %d files for branch %s at %s to %s and %s", branch.TotalHunkCount(), len(branch.References), branch.Name, branch.Head, csvPath, jsonPath)
+	}
+	return nil
+}
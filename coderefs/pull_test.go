@@ -0,0 +1,61 @@
+package coderefs
+
+import (
+	"encoding/csv"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+	"github.com/launchdarkly/ld-find-code-refs/testserver"
+)
+
+func TestPull(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pull")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	server := testserver.New("")
+	server.AddProject("default", []string{"flag1"}, nil)
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	retryMax := 0
+	client := ld.InitApiClient(ld.ApiOptions{ApiKey: "api-x", ProjKey: "default", BaseUri: httpServer.URL, RetryMax: &retryMax})
+	require.NoError(t, client.MaybeUpsertCodeReferenceRepository(ld.RepoParams{Type: "custom", Name: "repo", DefaultBranch: "main"}))
+	for _, name := range []string{"main", "release/1.0"} {
+		branch := ld.BranchRep{
+			Name:       name,
+			Head:       "0123456789abcdef",
+			References: []ld.ReferenceHunksRep{{Path: "main.go", Hunks: []ld.HunkRep{{StartingLineNumber: 1, ProjKey: "default", FlagKey: "flag1"}}}},
+		}
+		require.NoError(t, client.PutCodeReferenceBranch(branch, "repo"))
+	}
+
+	opts := options.Options{AccessToken: "api-x", BaseUri: httpServer.URL, ProjKey: "default", RepoName: "repo", OutDir: dir}
+	require.NoError(t, Pull(opts, nil))
+
+	f, err := os.Open(filepath.Join(dir, "coderefs_default_repo_release_1.0.csv"))
+	require.NoError(t, err)
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, []string{"flag1", "main.go", "1"}, records[1][:3])
+
+	branch, err := readBranch(filepath.Join(dir, "coderefs_default_repo_main_branch.json"))
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789abcdef", branch.Head)
+	assert.Len(t, branch.References, 1)
+
+	assert.EqualError(t, Pull(opts, []string{"missing"}), "branch missing of repository repo does not exist in LaunchDarkly")
+
+	opts.OutDir = ""
+	assert.EqualError(t, Pull(opts, nil), "missing required option(s): [outDir]")
+}
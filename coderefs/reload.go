@@ -0,0 +1,152 @@
+package coderefs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+)
+
+// secretOptions are the options whose values are never logged
+var secretOptions = map[string]bool{
+	"accessToken":  true,
+	"anonymizeKey": true,
+}
+
+// reloadConfig records the effective configuration of a validated scan, and logs how it differs from the configuration
+// of the previous scan of the same repository and branch. The server reads .launchdarkly/coderefs.yaml and .ldignore
+// again for every scan, so changes take effect without restarting it.
+func (s *server) reloadConfig(sc *serverScan, opts options.Options) {
+	config := effectiveConfig(opts)
+	s.mu.Lock()
+	r := s.repos[sc.Repository]
+	previous, ok := r.configs[sc.Branch]
+	r.configs[sc.Branch] = config
+	s.mu.Unlock()
+	if ok {
+		logConfigChanges(sc.Repository, previous, config)
+	}
+}
+
+// logConfigChanges logs how the effective configuration of a repository differs from its previous configuration
+func logConfigChanges(repoName string, previous, current []string) {
+	removed, added := diffConfig(previous, current)
+	if len(removed) == 0 && len(added) == 0 {
+		return
+	}
+	log.Info.Printf("reloaded configuration of repository %s, which changed since the last scan:", repoName)
+	for _, line := range removed {
+		log.Info.Printf("  - %s", line)
+	}
+	for _, line := range added {
+		log.Info.Printf("  + %s", line)
+	}
+}
+
+// effectiveConfig describes every option of a scan which is set, one setting per line, followed by the patterns read
+// from .ldignore. Each element of a list option is described on its own line, and the values of secret options are
+// redacted.
+func effectiveConfig(opts options.Options) []string {
+	config := []string{}
+	value := reflect.ValueOf(opts)
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		if field.IsZero() {
+			continue
+		}
+		name := optionName(value.Type().Field(i))
+		switch {
+		case secretOptions[name]:
+			config = append(config, name+": <redacted>")
+		case field.Kind() == reflect.Slice:
+			for j := 0; j < field.Len(); j++ {
+				config = append(config, name+": "+describeConfig(field.Index(j)))
+			}
+		default:
+			config = append(config, name+": "+describeConfig(field))
+		}
+	}
+	/* #nosec */
+	ignore, err := ioutil.ReadFile(filepath.Join(opts.Dir, ".ldignore"))
+	if err == nil {
+		for _, line := range strings.Split(string(ignore), "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "#") {
+				config = append(config, ".ldignore: "+line)
+			}
+		}
+	}
+	return config
+}
+
+// optionName returns the name of the option configuring a struct field
+func optionName(field reflect.StructField) string {
+	if name := strings.Split(field.Tag.Get("mapstructure"), ",")[0]; name != "" {
+		return name
+	}
+	return field.Name
+}
+
+// describeConfig formats a configuration value with the names of its options, omitting options which are not set
+func describeConfig(value reflect.Value) string {
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if value.IsNil() {
+			return "<nil>"
+		}
+		return describeConfig(value.Elem())
+	case reflect.Struct:
+		fields := []string{}
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Field(i)
+			// unexported fields have a package path
+			if value.Type().Field(i).PkgPath != "" || field.IsZero() {
+				continue
+			}
+			fields = append(fields, fmt.Sprintf("%s: %s", optionName(value.Type().Field(i)), describeConfig(field)))
+		}
+		return "{" + strings.Join(fields, ", ") + "}"
+	case reflect.Slice, reflect.Array:
+		elements := make([]string, 0, value.Len())
+		for i := 0; i < value.Len(); i++ {
+			elements = append(elements, describeConfig(value.Index(i)))
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case reflect.Map:
+		entries := make([]string, 0, value.Len())
+		for _, key := range value.MapKeys() {
+			entries = append(entries, fmt.Sprintf("%v: %s", key.Interface(), describeConfig(value.MapIndex(key))))
+		}
+		sort.Strings(entries)
+		return "{" + strings.Join(entries, ", ") + "}"
+	default:
+		return fmt.Sprint(value.Interface())
+	}
+}
+
+// diffConfig returns the lines of previous which are not in current, and the lines of current which are not in previous
+func diffConfig(previous, current []string) (removed, added []string) {
+	count := map[string]int{}
+	for _, line := range previous {
+		count[line]++
+	}
+	for _, line := range current {
+		if count[line] > 0 {
+			count[line]--
+			continue
+		}
+		added = append(added, line)
+	}
+	for _, line := range previous {
+		if count[line] > 0 {
+			count[line]--
+			removed = append(removed, line)
+		}
+	}
+	return removed, added
+}
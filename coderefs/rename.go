@@ -0,0 +1,77 @@
+package coderefs
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+)
+
+// RenameRepository moves the code reference data stored in LaunchDarkly from one repository name to another. The new
+// repository is created with the configuration of the old repository, the code references of each branch are copied to it,
+// and the old repository is deleted once every branch has been copied. A rename which failed part way can be run again.
+// Flag extinctions are not copied.
+func RenameRepository(opts options.Options, oldName, newName string) error {
+	if opts.AccessToken == "" {
+		return fmt.Errorf("missing required option(s): %v", []string{"accessToken"})
+	}
+	if strings.EqualFold(oldName, newName) {
+		// repository names are not case sensitive, so the old repository is the new repository
+		return errors.New("the new repository name must be different from the old repository name")
+	}
+
+	ldApi := ld.InitApiClient(apiOptions(opts))
+	oldRepo, err := ldApi.GetCodeReferenceRepository(oldName)
+	if err == ld.NotFoundErr {
+		return fmt.Errorf("repository %s does not exist in LaunchDarkly", oldName)
+	} else if err != nil {
+		return err
+	}
+
+	enabled := oldRepo.Enabled
+	err = ldApi.MaybeUpsertCodeReferenceRepository(ld.RepoParams{
+		Type:              oldRepo.Type,
+		Name:              newName,
+		Url:               oldRepo.Url,
+		CommitUrlTemplate: oldRepo.CommitUrlTemplate,
+		HunkUrlTemplate:   oldRepo.HunkUrlTemplate,
+		DefaultBranch:     oldRepo.DefaultBranch,
+		Description:       oldRepo.Description,
+		Tags:              oldRepo.Tags,
+		Enabled:           &enabled,
+	})
+	if err != nil {
+		return fmt.Errorf("could not create repository %s: %w", newName, err)
+	}
+
+	branches, err := ldApi.GetCodeReferenceRepositoryBranches(oldName)
+	if err != nil {
+		return err
+	}
+	log.Info.Printf("copying %d branches from repository %s to %s", len(branches), oldName, newName)
+	for _, b := range branches {
+		branch, err := ldApi.GetCodeReferenceBranch(oldName, b.Name)
+		if err != nil {
+			return fmt.Errorf("could not retrieve branch %s: %w", b.Name, err)
+		}
+		err = ldApi.PutCodeReferenceBranch(*branch, newName)
+		if err == ld.BranchUpdateSequenceIdConflictErr {
+			// the branch was copied by a previous attempt, or has since been updated by a scan using the new name
+			log.Info.Printf("skipped branch %s: repository %s already has a newer version of the branch", b.Name, newName)
+			continue
+		} else if err != nil {
+			return fmt.Errorf("could not copy branch %s, repository %s was not deleted: %w", b.Name, oldName, err)
+		}
+		log.Debug.Printf("copied %d code references for branch %s", branch.TotalHunkCount(), b.Name)
+	}
+
+	err = ldApi.DeleteCodeReferenceRepository(oldName)
+	if err != nil {
+		return fmt.Errorf("could not delete repository %s: %w", oldName, err)
+	}
+	log.Info.Printf("renamed repository %s to %s, set the repoName option to %s to continue scanning the repository", oldName, newName, newName)
+	return nil
+}
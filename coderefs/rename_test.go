@@ -0,0 +1,53 @@
+package coderefs
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+	"github.com/launchdarkly/ld-find-code-refs/testserver"
+)
+
+func TestRenameRepository(t *testing.T) {
+	server := testserver.New("")
+	server.AddProject("default", []string{"flag1"}, nil)
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	retryMax := 0
+	client := ld.InitApiClient(ld.ApiOptions{ApiKey: "api-x", ProjKey: "default", BaseUri: httpServer.URL, RetryMax: &retryMax})
+	repo := ld.RepoParams{Type: "github", Name: "old-repo", Url: "https://github.com/org/old-repo", DefaultBranch: "main", Tags: []string{"payments"}}
+	require.NoError(t, client.MaybeUpsertCodeReferenceRepository(repo))
+	seq := 3
+	for _, name := range []string{"main", "feature/x"} {
+		branch := ld.BranchRep{
+			Name:             name,
+			Head:             "0123456789abcdef",
+			UpdateSequenceId: &seq,
+			References:       []ld.ReferenceHunksRep{{Path: "main.go", Hunks: []ld.HunkRep{{StartingLineNumber: 1, ProjKey: "default", FlagKey: "flag1"}}}},
+		}
+		require.NoError(t, client.PutCodeReferenceBranch(branch, "old-repo"))
+	}
+	// a branch which was copied by a previous attempt
+	require.NoError(t, client.MaybeUpsertCodeReferenceRepository(ld.RepoParams{Type: "github", Name: "new-repo", DefaultBranch: "main"}))
+	require.NoError(t, client.PutCodeReferenceBranch(ld.BranchRep{Name: "main", Head: "0123456789abcdef", UpdateSequenceId: &seq}, "new-repo"))
+
+	opts := options.Options{AccessToken: "api-x", BaseUri: httpServer.URL}
+	require.NoError(t, RenameRepository(opts, "old-repo", "new-repo"))
+
+	_, ok := server.Repository("old-repo")
+	assert.False(t, ok)
+	state, ok := server.Repository("new-repo")
+	require.True(t, ok)
+	assert.Equal(t, "https://github.com/org/old-repo", state.Url)
+	assert.Equal(t, []string{"payments"}, state.Tags)
+	assert.Len(t, state.Branches, 2)
+	assert.Len(t, state.Branches["feature/x"].References, 1)
+
+	assert.EqualError(t, RenameRepository(opts, "old-repo", "other-repo"), "repository old-repo does not exist in LaunchDarkly")
+	assert.EqualError(t, RenameRepository(opts, "new-repo", "New-Repo"), "the new repository name must be different from the old repository name")
+}
@@ -0,0 +1,49 @@
+package coderefs
+
+import (
+	"strings"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+)
+
+// reportOptions returns the configuration of the reference count report printed after a scan. If the report option is not
+// set, references are grouped by flag. Flag tags are only retrieved from LaunchDarkly when references are grouped by tag.
+func reportOptions(opts options.Options, ldApi ld.ApiClient) ld.ReportOptions {
+	ret := ld.ReportOptions{Groupings: []string{}, Sort: opts.ReportSort, Top: opts.Top}
+	for _, grouping := range strings.Split(opts.Report, ",") {
+		grouping = strings.TrimSpace(grouping)
+		if grouping != "" {
+			ret.Groupings = append(ret.Groupings, grouping)
+		}
+	}
+	if len(ret.Groupings) == 0 {
+		ret.Groupings = []string{ld.ReportByFlag}
+	}
+
+	for _, grouping := range ret.Groupings {
+		if grouping == ld.ReportByTag {
+			ret.FlagTags = flagTags(opts, ldApi)
+			break
+		}
+	}
+	return ret
+}
+
+// flagTags returns the tags of each flag with tags. If tags are not available, no flags have tags.
+func flagTags(opts options.Options, ldApi ld.ApiClient) map[string][]string {
+	if opts.OfflineFlags != "" {
+		log.Warning.Printf("flag tags are not available when offlineFlags is set, all references will be reported as untagged")
+		return nil
+	} else if opts.AllProjects {
+		log.Warning.Printf("flag tags are not available when allProjects is set, all references will be reported as untagged")
+		return nil
+	}
+	tags, err := ldApi.GetFlagTags()
+	if err != nil {
+		log.Warning.Printf("unable to retrieve flag tags, all references will be reported as untagged: %s", err)
+		return nil
+	}
+	return tags
+}
@@ -0,0 +1,146 @@
+package coderefs
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+)
+
+const (
+	repoTypeGithub = "github"
+	// repoTypeBitbucketServer is the repoType of Bitbucket Server and Data Center repositories. LaunchDarkly only generates
+	// links to Bitbucket Cloud, so these repositories are sent to LaunchDarkly as bitbucket repositories with url templates.
+	repoTypeBitbucketServer = "bitbucketserver"
+)
+
+// Url styles are presets of url templates for the repository providers which LaunchDarkly does not generate links to
+const (
+	urlStyleGitlab          = "gitlab"
+	urlStyleGitea           = "gitea"
+	urlStyleAzure           = "azure"
+	urlStyleBitbucketServer = "bitbucket-server"
+)
+
+// githubHost is the host of repositories on github.com. LaunchDarkly only generates links to repositories on github.com,
+// so url templates are generated for repositories on GitHub Enterprise Server.
+const githubHost = "github.com"
+
+var (
+	// bitbucketServerClonePath matches the path of a Bitbucket Server HTTP clone URL, e.g. /scm/proj/my-repo.git
+	bitbucketServerClonePath = regexp.MustCompile(`^(.*)/scm/([^/]+)/([^/]+?)(?:\.git)?/?$`)
+	// bitbucketServerRepoPath matches the path of a page in a Bitbucket Server repository, e.g. /projects/PROJ/repos/my-repo/browse
+	bitbucketServerRepoPath = regexp.MustCompile(`^(.*/(?:projects|users)/[^/]+/repos/[^/]+)(?:/.*)?$`)
+)
+
+// bitbucketServerRepoParams configures links to a Bitbucket Server or Data Center repository. Url templates which were
+// not provided are generated from the repository url.
+func bitbucketServerRepoParams(params ld.RepoParams) ld.RepoParams {
+	params.Type = "bitbucket"
+	params.Url = bitbucketServerRepoUrl(params.Url)
+	if params.Url == "" {
+		return params
+	}
+	if params.CommitUrlTemplate == "" {
+		params.CommitUrlTemplate = params.Url + "/commits/${sha}"
+	}
+	if params.HunkUrlTemplate == "" {
+		params.HunkUrlTemplate = params.Url + "/browse/${filePath}?at=${sha}#${lineNumber}"
+	}
+	return params
+}
+
+// bitbucketServerRepoUrl returns the url of the web page of a Bitbucket Server repository, given its HTTP clone url or the
+// url of any page in the repository. Credentials are removed. Other urls are returned unchanged.
+func bitbucketServerRepoUrl(repoUrl string) string {
+	u, err := url.Parse(repoUrl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return repoUrl
+	}
+	u.User = nil
+	u.RawQuery = ""
+	u.Fragment = ""
+	if m := bitbucketServerClonePath.FindStringSubmatch(u.Path); m != nil {
+		owner := "projects/" + strings.ToUpper(m[2])
+		if strings.HasPrefix(m[2], "~") {
+			// personal repositories are cloned from /scm/~username
+			owner = "users/" + strings.TrimPrefix(m[2], "~")
+		}
+		u.Path = m[1] + "/" + owner + "/repos/" + m[3]
+	} else if m := bitbucketServerRepoPath.FindStringSubmatch(u.Path); m != nil {
+		u.Path = m[1]
+	}
+	u.RawPath = ""
+	return strings.TrimSuffix(u.String(), "/")
+}
+
+// githubEnterpriseRepoParams configures links to a GitHub Enterprise Server repository, when the repository url is not on
+// github.com. Url templates which were not provided are generated from the repository url.
+func githubEnterpriseRepoParams(params ld.RepoParams) ld.RepoParams {
+	u, err := url.Parse(params.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return params
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	if host == githubHost {
+		return params
+	}
+	params.Url = webRepoUrl(u)
+	if params.CommitUrlTemplate == "" {
+		params.CommitUrlTemplate = params.Url + "/commit/${sha}"
+	}
+	if params.HunkUrlTemplate == "" {
+		params.HunkUrlTemplate = params.Url + "/blob/${sha}/${filePath}#L${lineNumber}"
+	}
+	return params
+}
+
+// urlStyleRepoParams configures links to a repository using the url conventions of its provider. Url templates which were
+// not provided are generated from the repository url. The repository type is not changed.
+func urlStyleRepoParams(params ld.RepoParams, style string) ld.RepoParams {
+	if strings.ToLower(style) == urlStyleBitbucketServer {
+		repoType := params.Type
+		params = bitbucketServerRepoParams(params)
+		params.Type = repoType
+		return params
+	}
+	u, err := url.Parse(params.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return params
+	}
+	params.Url = webRepoUrl(u)
+	var commitUrlTemplate, hunkUrlTemplate string
+	switch strings.ToLower(style) {
+	case urlStyleGitlab:
+		commitUrlTemplate = params.Url + "/-/commit/${sha}"
+		hunkUrlTemplate = params.Url + "/-/blob/${sha}/${filePath}#L${lineNumber}"
+	case urlStyleGitea:
+		commitUrlTemplate = params.Url + "/commit/${sha}"
+		hunkUrlTemplate = params.Url + "/src/commit/${sha}/${filePath}#L${lineNumber}"
+	case urlStyleAzure:
+		// Azure Repos selects lines with query parameters, and versions commits with a GC prefix
+		commitUrlTemplate = params.Url + "/commit/${sha}"
+		hunkUrlTemplate = params.Url + "?path=/${filePath}&version=GC${sha}&line=${lineNumber}&lineEnd=${lineNumber}&lineStartColumn=1&lineEndColumn=1&lineStyle=plain&_a=contents"
+	default:
+		return params
+	}
+	if params.CommitUrlTemplate == "" {
+		params.CommitUrlTemplate = commitUrlTemplate
+	}
+	if params.HunkUrlTemplate == "" {
+		params.HunkUrlTemplate = hunkUrlTemplate
+	}
+	return params
+}
+
+// webRepoUrl returns the url of the web page of a repository, given its HTTP clone url. Credentials, a trailing .git, and
+// any query or fragment are removed.
+func webRepoUrl(u *url.URL) string {
+	u.User = nil
+	u.RawQuery = ""
+	u.Fragment = ""
+	u.Path = strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), ".git")
+	u.RawPath = ""
+	return u.String()
+}
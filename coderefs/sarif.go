@@ -0,0 +1,125 @@
+package coderefs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/version"
+	"github.com/launchdarkly/ld-find-code-refs/search"
+)
+
+const (
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+	// sarifRuleId is the rule of results for code references
+	sarifRuleId = "flag-reference"
+)
+
+// sarifLog is a SARIF 2.1.0 log with a single run
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version"`
+	InformationUri string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	Id               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleId     string                 `json:"ruleId"`
+	Level      string                 `json:"level"`
+	Message    sarifMessage           `json:"message"`
+	Locations  []sarifLocation        `json:"locations"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	Uri string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// writeSARIF writes the code references of a branch as a SARIF 2.1.0 log, reporting each hunk as a note on the line
+// referencing its flag, so code references can be viewed in tools which import SARIF, such as GitHub code scanning
+func writeSARIF(w io.Writer, branch ld.BranchRep, delimiters search.Delimiters) error {
+	results := make([]sarifResult, 0, branch.TotalHunkCount())
+	for _, ref := range branch.References {
+		uri := (&url.URL{Path: filepath.ToSlash(ref.Path)}).String()
+		for _, hunk := range ref.Hunks {
+			line := referenceLineNumber(hunk, hunk.Aliases, delimiters)
+			if len(hunk.Matches) > 0 {
+				line = hunk.Matches[0].LineNumber
+			}
+			properties := map[string]interface{}{"flagKey": hunk.FlagKey, "projKey": hunk.ProjKey}
+			if len(hunk.Aliases) > 0 {
+				properties["aliases"] = hunk.Aliases
+			}
+			if len(hunk.Tags) > 0 {
+				properties["tags"] = hunk.Tags
+			}
+			if hunk.Maintainer != "" {
+				properties["maintainer"] = hunk.Maintainer
+			}
+			results = append(results, sarifResult{
+				RuleId:     sarifRuleId,
+				Level:      "note",
+				Message:    sarifMessage{Text: fmt.Sprintf("Reference to LaunchDarkly flag %q", hunk.FlagKey)},
+				Locations:  []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{Uri: uri}, Region: sarifRegion{StartLine: line}}}},
+				Properties: properties,
+			})
+		}
+	}
+	log := sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "ld-find-code-refs",
+				Version:        version.Version,
+				InformationUri: "https://github.com/launchdarkly/ld-find-code-refs",
+				Rules:          []sarifRule{{Id: sarifRuleId, ShortDescription: sarifMessage{Text: "Reference to a LaunchDarkly feature flag"}}},
+			}},
+			Results: results,
+		}},
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(log)
+}
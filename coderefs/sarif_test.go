@@ -0,0 +1,64 @@
+package coderefs
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/version"
+	"github.com/launchdarkly/ld-find-code-refs/search"
+)
+
+func TestWriteSARIF(t *testing.T) {
+	branch := ld.BranchRep{References: []ld.ReferenceHunksRep{
+		{Path: "src/my app.js", Hunks: []ld.HunkRep{
+			{StartingLineNumber: 3, Lines: "// context\nif (variation('flag-a')) {", ProjKey: "default", FlagKey: "flag-a"},
+			{StartingLineNumber: 10, Lines: "// context\nflagA()", ProjKey: "default", FlagKey: "flag-a", Aliases: []string{"flagA"}},
+			{StartingLineNumber: 20, Lines: "a\nb\nflag-a", ProjKey: "default", FlagKey: "flag-a", Matches: []ld.Match{{LineNumber: 22, Column: 1}}},
+		}},
+	}}
+	var buf bytes.Buffer
+	require.NoError(t, writeSARIF(&buf, branch, search.NewDelimiters(`"'`)))
+	assert.JSONEq(t, `{
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"version": "2.1.0",
+		"runs": [{
+			"tool": {"driver": {
+				"name": "ld-find-code-refs",
+				"version": "`+version.Version+`",
+				"informationUri": "https://github.com/launchdarkly/ld-find-code-refs",
+				"rules": [{"id": "flag-reference", "shortDescription": {"text": "Reference to a LaunchDarkly feature flag"}}]
+			}},
+			"results": [
+				{
+					"ruleId": "flag-reference",
+					"level": "note",
+					"message": {"text": "Reference to LaunchDarkly flag \"flag-a\""},
+					"locations": [{"physicalLocation": {"artifactLocation": {"uri": "src/my%20app.js"}, "region": {"startLine": 4}}}],
+					"properties": {"flagKey": "flag-a", "projKey": "default"}
+				},
+				{
+					"ruleId": "flag-reference",
+					"level": "note",
+					"message": {"text": "Reference to LaunchDarkly flag \"flag-a\""},
+					"locations": [{"physicalLocation": {"artifactLocation": {"uri": "src/my%20app.js"}, "region": {"startLine": 11}}}],
+					"properties": {"flagKey": "flag-a", "projKey": "default", "aliases": ["flagA"]}
+				},
+				{
+					"ruleId": "flag-reference",
+					"level": "note",
+					"message": {"text": "Reference to LaunchDarkly flag \"flag-a\""},
+					"locations": [{"physicalLocation": {"artifactLocation": {"uri": "src/my%20app.js"}, "region": {"startLine": 22}}}],
+					"properties": {"flagKey": "flag-a", "projKey": "default"}
+				}
+			]
+		}]
+	}`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, writeSARIF(&buf, ld.BranchRep{}, search.NewDelimiters(`"'`)))
+	assert.Contains(t, buf.String(), `"results": []`, "SARIF requires the results of a run")
+}
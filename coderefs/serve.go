@@ -0,0 +1,696 @@
+package coderefs
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/git"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+)
+
+// Statuses of scans run by the server
+const (
+	scanQueued    = "queued"
+	scanRunning   = "running"
+	scanSucceeded = "succeeded"
+	scanFailed    = "failed"
+)
+
+const (
+	// serverScanHistory is the number of scans of each repository whose status, results, and logs are kept
+	serverScanHistory = 10
+	// serverQueueSize is the maximum number of scans waiting to run
+	serverQueueSize       = 100
+	serverShutdownTimeout = 10 * time.Second
+)
+
+// ServeOptions configures the HTTP API server
+type ServeOptions struct {
+	// Listen is the address the server listens on, e.g. ":8080"
+	Listen string
+	// Token is required as a bearer token by every request other than health checks, if set
+	Token string
+	// Interval is how often every repository is scanned. If 0, repositories are only scanned on request.
+	Interval time.Duration
+	// WebhookSecret validates push webhooks, which are only accepted if it is set
+	WebhookSecret string
+}
+
+// server runs scans of configured repositories requested through its HTTP API. Scans run one at a time, in the order
+// they are requested, so the console output of each scan can be captured as its log.
+type server struct {
+	base          options.Options
+	token         string
+	webhookSecret string
+	// run scans a repository, setting result to the results of the scan
+	run func(opts options.Options, result *scanResult) error
+
+	mu    sync.Mutex
+	repos map[string]*serverRepo
+	names []string
+	// urls are the names of the repositories with each normalized url, to match webhooks to repositories
+	urls    map[string][]string
+	nextId  int64
+	queue   chan *serverScan
+	stopped bool
+}
+
+type serverRepo struct {
+	repo options.WorkspaceRepo
+	// scans are the most recent scans of the repository, oldest first
+	scans []*serverScan
+	// configs are the effective configurations of the last valid scan of each branch, to log changes between scans
+	configs map[string][]string
+}
+
+// serverScan is a scan requested through the API. Fields other than logs are guarded by the server's lock.
+type serverScan struct {
+	Id         int64  `json:"id"`
+	Repository string `json:"repository"`
+	// Branch is checked out before the scan, if set. Otherwise, the current contents of the repository are scanned.
+	Branch   string     `json:"branch,omitempty"`
+	Status   string     `json:"status"`
+	Queued   time.Time  `json:"queued"`
+	Started  *time.Time `json:"started,omitempty"`
+	Finished *time.Time `json:"finished,omitempty"`
+	Error    string     `json:"error,omitempty"`
+	// Manifest summarizes the results of a scan which wrote its outputs
+	Manifest *manifest `json:"manifest,omitempty"`
+
+	result *scanResult
+	logs   *scanLog
+}
+
+// serverRepoStatus is a configured repository, and the most recent scan of it
+type serverRepoStatus struct {
+	Name       string      `json:"name"`
+	Dir        string      `json:"dir"`
+	Branch     string      `json:"branch,omitempty"`
+	LatestScan *serverScan `json:"latestScan,omitempty"`
+}
+
+// Serve runs an HTTP API server which scans the configured repositories on request, until the process receives SIGINT
+// or SIGTERM. Options for each repository are the base options, overridden by the repository's entry.
+func Serve(base options.Options, repos []options.WorkspaceRepo, opts ServeOptions) error {
+	s, err := newServer(base, repos, opts)
+	if err != nil {
+		return err
+	}
+	applyResourceLimits(base)
+	addCredentialEnv(repos)
+	if opts.Token == "" {
+		log.Warning.Printf("LD_SERVE_TOKEN is not set, requests to the server are not authenticated")
+	}
+
+	httpServer := &http.Server{Addr: opts.Listen, Handler: s, ReadHeaderTimeout: 10 * time.Second}
+	done := make(chan struct{})
+	go func() {
+		s.work()
+		close(done)
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Info.Printf("listening on %s, serving scans of %d repositories", opts.Listen, len(repos))
+		serveErr <- httpServer.ListenAndServe()
+	}()
+
+	stopSchedule := make(chan struct{})
+	defer close(stopSchedule)
+	if opts.Interval > 0 {
+		go s.schedule(opts.Interval, stopSchedule)
+	}
+
+	select {
+	case err := <-serveErr:
+		return err
+	case sig := <-signals:
+		log.Info.Printf("received %s, waiting for the running scan to finish", sig)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+	defer cancel()
+	err = httpServer.Shutdown(ctx)
+	if err != nil {
+		log.Warning.Printf("unable to stop server: %s", err)
+	}
+	s.stop()
+	<-done
+	return nil
+}
+
+func newServer(base options.Options, repos []options.WorkspaceRepo, opts ServeOptions) (*server, error) {
+	s := &server{
+		base:          base,
+		token:         opts.Token,
+		webhookSecret: opts.WebhookSecret,
+		run: func(opts options.Options, result *scanResult) error {
+			return scan(opts, nil, result)
+		},
+		repos: map[string]*serverRepo{},
+		urls:  map[string][]string{},
+		queue: make(chan *serverScan, serverQueueSize),
+	}
+	for _, repo := range repos {
+		if _, ok := s.repos[repo.RepoName]; ok {
+			return nil, fmt.Errorf("repository %s is configured more than once", repo.RepoName)
+		}
+		s.repos[repo.RepoName] = &serverRepo{repo: repo, configs: map[string][]string{}}
+		s.names = append(s.names, repo.RepoName)
+		if u := repoUrl(repo); u != "" {
+			s.urls[u] = append(s.urls[u], repo.RepoName)
+		}
+	}
+	return s, nil
+}
+
+// repoUrl returns the normalized url of a repository, from its repoUrl option, or the url of its origin remote
+func repoUrl(repo options.WorkspaceRepo) string {
+	if repo.RepoUrl != "" {
+		return normalizeRepoUrl(repo.RepoUrl)
+	}
+	if !git.IsRepository(repo.Dir) {
+		return ""
+	}
+	client, err := git.OpenClient(repo.Dir)
+	if err != nil {
+		return ""
+	}
+	remote, err := client.RemoteUrl()
+	if err != nil {
+		log.Debug.Printf("push webhooks will not scan repository %s: %s", repo.RepoName, err)
+		return ""
+	}
+	return normalizeRepoUrl(remote)
+}
+
+// work runs queued scans until the server is stopped
+func (s *server) work() {
+	for sc := range s.queue {
+		s.runScan(sc)
+	}
+}
+
+// schedule requests a scan of every repository now, and again at each interval, until stop is closed
+func (s *server) schedule(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for _, name := range s.names {
+			sc, queued, err := s.enqueue(name, "")
+			if err != nil {
+				log.Warning.Printf("unable to schedule scan of repository %s: %s", name, err)
+			} else if queued {
+				log.Info.Printf("scheduled scan %d of repository %s", sc.Id, name)
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// stop discards queued scans, and stops the worker once the running scan finishes
+func (s *server) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return
+	}
+	s.stopped = true
+	close(s.queue)
+	for sc := range s.queue {
+		sc.Status = scanFailed
+		sc.Error = "server stopped before the scan started"
+		sc.logs.close()
+	}
+}
+
+func (s *server) runScan(sc *serverScan) {
+	s.mu.Lock()
+	if s.stopped {
+		sc.Status = scanFailed
+		sc.Error = "server stopped before the scan started"
+		sc.logs.close()
+		s.mu.Unlock()
+		return
+	}
+	repo := s.repos[sc.Repository].repo
+	started := time.Now()
+	sc.Status = scanRunning
+	sc.Started = &started
+	s.mu.Unlock()
+
+	restore := log.Tee(sc.logs)
+	var result scanResult
+	opts, err := repo.Options(s.base)
+	if err == nil && sc.Branch != "" {
+		var remove func()
+		opts, remove, err = withBranchWorktree(opts, sc.Branch)
+		if err == nil {
+			defer remove()
+		}
+	}
+	if err == nil {
+		err = opts.Validate()
+	}
+	if err == nil {
+		s.reloadConfig(sc, opts)
+		log.Info.Printf("scanning repository %s in %s", opts.RepoName, opts.Dir)
+		err = s.run(opts, &result)
+	}
+	if err == errServiceErrorIgnored {
+		log.Warning.Printf("skipped repository %s after an ignored service error", repo.RepoName)
+		err = nil
+	} else if err != nil {
+		log.Error.Printf("failed to scan repository %s: %s", repo.RepoName, err)
+	}
+	restore()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	finished := time.Now()
+	sc.Finished = &finished
+	sc.Status = scanSucceeded
+	if err != nil {
+		sc.Status = scanFailed
+		sc.Error = err.Error()
+	}
+	if result.Manifest.Version != "" {
+		sc.Manifest = &result.Manifest
+		sc.result = &result
+	}
+	sc.logs.close()
+}
+
+// enqueue requests a scan of a branch of a repository, or of its current contents if branch is empty. If the same scan is
+// already waiting to run, it is returned instead, since it will scan the latest contents of the branch.
+func (s *server) enqueue(name, branch string) (scan serverScan, queued bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.repos[name]
+	for _, sc := range r.scans {
+		if sc.Status == scanQueued && sc.Branch == branch {
+			return *sc, false, nil
+		}
+	}
+	if s.stopped {
+		return serverScan{}, false, errors.New("server is stopping")
+	}
+	s.nextId++
+	sc := &serverScan{Id: s.nextId, Repository: name, Branch: branch, Status: scanQueued, Queued: time.Now(), logs: newScanLog()}
+	select {
+	case s.queue <- sc:
+	default:
+		return serverScan{}, false, fmt.Errorf("too many scans are waiting to run, %d at most", serverQueueSize)
+	}
+	r.scans = append(r.scans, sc)
+	// scans which are waiting to run are kept, so they can be reused
+	for len(r.scans) > serverScanHistory && r.scans[0].Status != scanQueued {
+		r.scans = r.scans[1:]
+	}
+	return *sc, true, nil
+}
+
+// findScan returns a scan of a repository by id, or its most recent scan if id is "latest"
+func (s *server) findScan(name, id string) (*serverScan, bool) {
+	r := s.repos[name]
+	if len(r.scans) == 0 {
+		return nil, false
+	}
+	if id == "latest" {
+		return r.scans[len(r.scans)-1], true
+	}
+	for _, sc := range r.scans {
+		if strconv.FormatInt(sc.Id, 10) == id {
+			return sc, true
+		}
+	}
+	return nil, false
+}
+
+// ServeHTTP routes requests to the API:
+//
+//	GET  /healthz                                      responds while the server is running, for liveness probes
+//	GET  /readyz                                       responds with 503 if the server is stopping or cannot queue scans, for readiness probes
+//	GET  /repositories                                 configured repositories and their latest scans
+//	GET  /repositories/{name}                          a repository and its latest scan
+//	GET  /repositories/{name}/scans                    the most recent scans of a repository
+//	POST /repositories/{name}/scans                    requests a scan of a repository, or of a branch if branch is set
+//	POST /webhooks/{provider}                          requests scans of the branches pushed to a repository
+//	GET  /repositories/{name}/scans/{id}               the status of a scan, or of the latest scan if id is "latest"
+//	GET  /repositories/{name}/scans/{id}/results       the manifest and code references found by a scan
+//	GET  /repositories/{name}/scans/{id}/logs          the console output of a scan, streamed until the scan finishes if follow=true
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// health checks are not authenticated, as probes do not send credentials
+	switch r.URL.Path {
+	case "/healthz":
+		writeServerJSON(w, http.StatusOK, serverHealth{Status: "ok"})
+		return
+	case "/readyz":
+		s.checkReady(w)
+		return
+	}
+	// webhooks are validated with the webhook secret instead of the token
+	if provider := strings.TrimPrefix(r.URL.Path, "/webhooks/"); provider != r.URL.Path {
+		if allowMethod(w, r, http.MethodPost) {
+			s.handleWebhook(w, r, provider)
+		}
+		return
+	}
+	if s.token != "" && !validBearerToken(r.Header.Get("Authorization"), s.token) {
+		writeServerError(w, http.StatusUnauthorized, "a valid bearer token is required")
+		return
+	}
+	segments := strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/")
+	for i, segment := range segments {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			writeServerError(w, http.StatusBadRequest, "invalid path")
+			return
+		}
+		segments[i] = unescaped
+	}
+	if segments[0] != "repositories" {
+		writeServerError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if len(segments) == 1 {
+		if allowMethod(w, r, http.MethodGet) {
+			s.listRepos(w)
+		}
+		return
+	}
+
+	name := segments[1]
+	if _, ok := s.repos[name]; !ok {
+		writeServerError(w, http.StatusNotFound, fmt.Sprintf("repository %s is not configured", name))
+		return
+	}
+	switch {
+	case len(segments) == 2:
+		if allowMethod(w, r, http.MethodGet) {
+			s.mu.Lock()
+			status := s.repoStatus(name)
+			s.mu.Unlock()
+			writeServerJSON(w, http.StatusOK, status)
+		}
+	case len(segments) == 3 && segments[2] == "scans":
+		switch r.Method {
+		case http.MethodGet:
+			s.listScans(w, name)
+		case http.MethodPost:
+			s.triggerScan(w, name, r.URL.Query().Get("branch"))
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			writeServerError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	case len(segments) >= 4 && len(segments) <= 5 && segments[2] == "scans":
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		s.mu.Lock()
+		sc, ok := s.findScan(name, segments[3])
+		var snapshot serverScan
+		if ok {
+			snapshot = *sc
+		}
+		s.mu.Unlock()
+		if !ok {
+			writeServerError(w, http.StatusNotFound, fmt.Sprintf("scan %s of repository %s was not found", segments[3], name))
+			return
+		}
+		switch {
+		case len(segments) == 4:
+			writeServerJSON(w, http.StatusOK, snapshot)
+		case segments[4] == "results":
+			if snapshot.result == nil {
+				writeServerError(w, http.StatusNotFound, fmt.Sprintf("scan %d has no results, its status is %s", snapshot.Id, snapshot.Status))
+				return
+			}
+			writeServerJSON(w, http.StatusOK, snapshot.result)
+		case segments[4] == "logs":
+			snapshot.logs.stream(r.Context(), w, r.URL.Query().Get("follow") == "true")
+		default:
+			writeServerError(w, http.StatusNotFound, "not found")
+		}
+	default:
+		writeServerError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// serverHealth is the response to health checks
+type serverHealth struct {
+	Status string `json:"status"`
+	// Queued is the number of scans waiting to run
+	Queued int `json:"queued"`
+}
+
+func (s *server) checkReady(w http.ResponseWriter) {
+	s.mu.Lock()
+	stopped := s.stopped
+	queued := len(s.queue)
+	s.mu.Unlock()
+	switch {
+	case stopped:
+		writeServerJSON(w, http.StatusServiceUnavailable, serverHealth{Status: "stopping", Queued: queued})
+	case queued >= serverQueueSize:
+		writeServerJSON(w, http.StatusServiceUnavailable, serverHealth{Status: "queue full", Queued: queued})
+	default:
+		writeServerJSON(w, http.StatusOK, serverHealth{Status: "ok", Queued: queued})
+	}
+}
+
+func (s *server) listRepos(w http.ResponseWriter) {
+	s.mu.Lock()
+	repos := make([]serverRepoStatus, 0, len(s.names))
+	for _, name := range s.names {
+		repos = append(repos, s.repoStatus(name))
+	}
+	s.mu.Unlock()
+	writeServerJSON(w, http.StatusOK, repos)
+}
+
+// repoStatus must be called with the server's lock held
+func (s *server) repoStatus(name string) serverRepoStatus {
+	r := s.repos[name]
+	status := serverRepoStatus{Name: name, Dir: r.repo.Dir, Branch: r.repo.Branch}
+	if len(r.scans) > 0 {
+		latest := *r.scans[len(r.scans)-1]
+		status.LatestScan = &latest
+	}
+	return status
+}
+
+func (s *server) listScans(w http.ResponseWriter, name string) {
+	s.mu.Lock()
+	r := s.repos[name]
+	scans := make([]serverScan, 0, len(r.scans))
+	for i := len(r.scans) - 1; i >= 0; i-- {
+		scans = append(scans, *r.scans[i])
+	}
+	s.mu.Unlock()
+	writeServerJSON(w, http.StatusOK, scans)
+}
+
+func (s *server) triggerScan(w http.ResponseWriter, name, branch string) {
+	sc, queued, err := s.enqueue(name, branch)
+	if err != nil {
+		writeServerError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/repositories/%s/scans/%d", url.PathEscape(name), sc.Id))
+	if queued {
+		logQueuedScan(sc)
+	}
+	writeServerJSON(w, http.StatusAccepted, sc)
+}
+
+func logQueuedScan(sc serverScan) {
+	if sc.Branch != "" {
+		log.Info.Printf("queued scan %d of branch %s of repository %s", sc.Id, sc.Branch, sc.Repository)
+		return
+	}
+	log.Info.Printf("queued scan %d of repository %s", sc.Id, sc.Repository)
+}
+
+// handleWebhook queues a scan of each branch pushed to a configured repository. Repositories are matched by url, and
+// events other than pushes of branches are ignored.
+func (s *server) handleWebhook(w http.ResponseWriter, r *http.Request, provider string) {
+	if s.webhookSecret == "" {
+		writeServerError(w, http.StatusNotFound, "webhooks are not enabled, set LD_WEBHOOK_SECRET to enable them")
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookSize))
+	if err != nil {
+		writeServerError(w, http.StatusRequestEntityTooLarge, "webhook is too large")
+		return
+	}
+	err = verifyWebhook(provider, r.Header, body, s.webhookSecret)
+	if err == errInvalidSignature {
+		writeServerError(w, http.StatusUnauthorized, err.Error())
+		return
+	} else if err != nil {
+		writeServerError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	event, err := parsePushEvent(provider, r.Header, body)
+	if err != nil {
+		writeServerError(w, http.StatusBadRequest, err.Error())
+		return
+	} else if event == nil || len(event.Branches) == 0 {
+		writeServerJSON(w, http.StatusOK, serverMessage{"event ignored, only pushes of branches are scanned"})
+		return
+	}
+
+	names := map[string]bool{}
+	for _, u := range event.Urls {
+		for _, name := range s.urls[normalizeRepoUrl(u)] {
+			names[name] = true
+		}
+	}
+	if len(names) == 0 {
+		writeServerJSON(w, http.StatusOK, serverMessage{fmt.Sprintf("event ignored, no configured repository matches %v", event.Urls)})
+		return
+	}
+	scans := []serverScan{}
+	for _, name := range s.names {
+		if !names[name] {
+			continue
+		}
+		for _, branch := range event.Branches {
+			sc, queued, err := s.enqueue(name, branch)
+			if err != nil {
+				writeServerError(w, http.StatusServiceUnavailable, err.Error())
+				return
+			}
+			if queued {
+				logQueuedScan(sc)
+			}
+			scans = append(scans, sc)
+		}
+	}
+	writeServerJSON(w, http.StatusAccepted, scans)
+}
+
+func validBearerToken(header, token string) bool {
+	const prefix = "Bearer "
+	if !strings.HasPrefix(header, prefix) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(header, prefix)), []byte(token)) == 1
+}
+
+// allowMethod writes a 405 response if the request's method is not method
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeServerError(w, http.StatusMethodNotAllowed, "method not allowed")
+	return false
+}
+
+func writeServerJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Debug.Printf("unable to write response: %s", err)
+	}
+}
+
+// serverMessage is the response to a request which failed, or which did not change anything
+type serverMessage struct {
+	Message string `json:"message"`
+}
+
+func writeServerError(w http.ResponseWriter, status int, message string) {
+	writeServerJSON(w, status, serverMessage{message})
+}
+
+// scanLog is the console output of a scan. Readers may follow the log as it is written.
+type scanLog struct {
+	mu   sync.Mutex
+	buf  bytes.Buffer
+	done bool
+	// changed is closed and replaced whenever the log is written to or closed
+	changed chan struct{}
+}
+
+func newScanLog() *scanLog {
+	return &scanLog{changed: make(chan struct{})}
+}
+
+func (l *scanLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.done {
+		return len(p), nil
+	}
+	l.buf.Write(p)
+	close(l.changed)
+	l.changed = make(chan struct{})
+	return len(p), nil
+}
+
+// close marks the log as complete, ending streams following it
+func (l *scanLog) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.done {
+		return
+	}
+	l.done = true
+	close(l.changed)
+}
+
+// stream writes the log to w. If follow is set, output is written as it is logged until the scan finishes or the
+// request is cancelled.
+func (l *scanLog) stream(ctx context.Context, w http.ResponseWriter, follow bool) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	flusher, _ := w.(http.Flusher)
+	offset := 0
+	for {
+		l.mu.Lock()
+		chunk := append([]byte{}, l.buf.Bytes()[offset:]...)
+		done, changed := l.done, l.changed
+		l.mu.Unlock()
+
+		offset += len(chunk)
+		if _, err := w.Write(chunk); err != nil {
+			return
+		}
+		if !follow || done {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package coderefs
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+)
+
+func newTestServer(t *testing.T, token string, run func(opts options.Options, result *scanResult) error) (*server, string) {
+	dir, err := ioutil.TempDir("", "serve")
+	require.NoError(t, err)
+	base := options.Options{
+		AccessToken:    "api-x",
+		ProjKey:        "default",
+		RepoType:       "custom",
+		ContextLines:   2,
+		ConsoleFormat:  "auto",
+		SDKs:           "launchdarkly",
+		ShortFlagKeys:  "omit",
+		Symlinks:       "skip",
+		SparsePaths:    "report",
+		LineLengthUnit: "characters",
+		MinConfidence:  "substring",
+		ReportSort:     "references",
+	}
+	s, err := newServer(base, []options.WorkspaceRepo{{Dir: dir, RepoName: "my-repo", RepoUrl: "https://github.com/my-org/my-repo"}}, ServeOptions{Token: token, WebhookSecret: "webhook-secret"})
+	require.NoError(t, err)
+	s.run = run
+	return s, dir
+}
+
+func serveRequest(s *server, method, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w
+}
+
+func TestServer_scan(t *testing.T) {
+	log.Init(false)
+	release := make(chan struct{})
+	s, dir := newTestServer(t, "", func(opts options.Options, result *scanResult) error {
+		log.Info.Printf("scanning %s", opts.RepoName)
+		<-release
+		*result = newScanResult(manifest{Version: "1", RepoName: opts.RepoName, References: 1}, ld.BranchRep{
+			References: []ld.ReferenceHunksRep{{Path: "main.go", Hunks: []ld.HunkRep{{FlagKey: "flag"}}}},
+		}, nil)
+		return nil
+	})
+	defer os.RemoveAll(dir)
+
+	w := serveRequest(s, http.MethodGet, "/repositories/my-repo/scans/latest")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = serveRequest(s, http.MethodPost, "/repositories/my-repo/scans")
+	require.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, "/repositories/my-repo/scans/1", w.Header().Get("Location"))
+	var sc serverScan
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &sc))
+	assert.Equal(t, int64(1), sc.Id)
+	assert.Equal(t, scanQueued, sc.Status)
+
+	// a scan which has not started is reused by later requests
+	w = serveRequest(s, http.MethodPost, "/repositories/my-repo/scans")
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &sc))
+	assert.Equal(t, int64(1), sc.Id)
+
+	done := make(chan struct{})
+	go func() {
+		s.work()
+		close(done)
+	}()
+	// follow the logs of the scan until it finishes
+	logs := make(chan string)
+	go func() {
+		w := serveRequest(s, http.MethodGet, "/repositories/my-repo/scans/1/logs?follow=true")
+		logs <- w.Body.String()
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	assert.Contains(t, <-logs, "scanning my-repo")
+	s.stop()
+	<-done
+
+	w = serveRequest(s, http.MethodGet, "/repositories/my-repo")
+	var status serverRepoStatus
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	require.NotNil(t, status.LatestScan)
+	assert.Equal(t, scanSucceeded, status.LatestScan.Status)
+	require.NotNil(t, status.LatestScan.Manifest)
+	assert.Equal(t, 1, status.LatestScan.Manifest.References)
+
+	w = serveRequest(s, http.MethodGet, "/repositories/my-repo/scans/latest/results")
+	require.Equal(t, http.StatusOK, w.Code)
+	var result scanResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	require.Len(t, result.References, 1)
+	assert.Equal(t, "main.go", result.References[0].Path)
+
+	// requests after the server stops are refused
+	w = serveRequest(s, http.MethodPost, "/repositories/my-repo/scans")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestServer_failedScan(t *testing.T) {
+	log.Init(false)
+	s, dir := newTestServer(t, "", func(opts options.Options, result *scanResult) error {
+		return errors.New("no flags found")
+	})
+	defer os.RemoveAll(dir)
+
+	serveRequest(s, http.MethodPost, "/repositories/my-repo/scans")
+	go s.work()
+	defer s.stop()
+	// following the logs waits for the scan to finish
+	serveRequest(s, http.MethodGet, "/repositories/my-repo/scans/latest/logs?follow=true")
+
+	w := serveRequest(s, http.MethodGet, "/repositories/my-repo/scans")
+	var scans []serverScan
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &scans))
+	require.Len(t, scans, 1)
+	assert.Equal(t, scanFailed, scans[0].Status)
+	assert.Equal(t, "no flags found", scans[0].Error)
+
+	w = serveRequest(s, http.MethodGet, "/repositories/my-repo/scans/1/results")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = serveRequest(s, http.MethodGet, "/repositories/my-repo/scans/1/logs")
+	assert.Contains(t, w.Body.String(), "failed to scan repository my-repo: no flags found")
+}
+
+func TestServer_reloadConfig(t *testing.T) {
+	log.Init(false)
+	s, dir := newTestServer(t, "", func(opts options.Options, result *scanResult) error {
+		return nil
+	})
+	defer os.RemoveAll(dir)
+	go s.work()
+	defer s.stop()
+	scanLogs := func() string {
+		serveRequest(s, http.MethodPost, "/repositories/my-repo/scans")
+		// following the logs waits for the scan to finish
+		return serveRequest(s, http.MethodGet, "/repositories/my-repo/scans/latest/logs?follow=true").Body.String()
+	}
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, ".launchdarkly"), 0750))
+	writeConfig := func(config, ignore string) {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, ".launchdarkly", "coderefs.yaml"), []byte(config), 0600))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, ".ldignore"), []byte(ignore), 0600))
+	}
+	writeConfig("aliases:\n  - type: camelcase\n", "vendor/\n")
+	assert.NotContains(t, scanLogs(), "reloaded configuration", "the first scan has nothing to compare")
+	assert.NotContains(t, scanLogs(), "reloaded configuration", "unchanged configuration is not logged")
+
+	writeConfig("aliases:\n  - type: camelcase\n  - type: snakecase\ndelimiters:\n  additional: [\"<\"]\n", "# generated\ndist/\n")
+	logs := scanLogs()
+	assert.Contains(t, logs, "reloaded configuration of repository my-repo")
+	assert.Contains(t, logs, "  - .ldignore: vendor/")
+	assert.Contains(t, logs, "  + aliases: {type: snakecase}")
+	assert.Contains(t, logs, "  + delimiters: {additional: [<]}")
+	assert.Contains(t, logs, "  + .ldignore: dist/")
+	assert.NotContains(t, logs, "aliases: {type: camelcase}")
+
+	writeConfig("aliases:\n  - type: unknown\n", "")
+	assert.Contains(t, scanLogs(), "failed to scan repository my-repo", "invalid configuration fails the scan")
+	w := serveRequest(s, http.MethodGet, "/repositories/my-repo/scans/latest")
+	var sc serverScan
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &sc))
+	assert.Equal(t, scanFailed, sc.Status)
+}
+
+func TestServer_routes(t *testing.T) {
+	s, dir := newTestServer(t, "", nil)
+	defer os.RemoveAll(dir)
+
+	w := serveRequest(s, http.MethodGet, "/repositories")
+	require.Equal(t, http.StatusOK, w.Code)
+	var repos []serverRepoStatus
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &repos))
+	assert.Equal(t, []serverRepoStatus{{Name: "my-repo", Dir: dir}}, repos)
+
+	assert.Equal(t, http.StatusNotFound, serveRequest(s, http.MethodGet, "/").Code)
+	assert.Equal(t, http.StatusNotFound, serveRequest(s, http.MethodGet, "/repositories/other").Code)
+	assert.Equal(t, http.StatusNotFound, serveRequest(s, http.MethodGet, "/repositories/my-repo/scans/2").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, serveRequest(s, http.MethodDelete, "/repositories/my-repo/scans").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, serveRequest(s, http.MethodPost, "/repositories").Code)
+}
+
+func TestServer_token(t *testing.T) {
+	s, dir := newTestServer(t, "secret", nil)
+	defer os.RemoveAll(dir)
+
+	assert.Equal(t, http.StatusUnauthorized, serveRequest(s, http.MethodGet, "/repositories").Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/repositories", nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.HasPrefix(w.Header().Get("Content-Type"), "application/json"))
+}
+
+func TestNewServer_duplicateRepos(t *testing.T) {
+	_, err := newServer(options.Options{}, []options.WorkspaceRepo{{Dir: "a", RepoName: "repo"}, {Dir: "b", RepoName: "repo"}}, ServeOptions{})
+	assert.EqualError(t, err, "repository repo is configured more than once")
+}
+
+func TestServer_health(t *testing.T) {
+	s, dir := newTestServer(t, "secret", nil)
+	defer os.RemoveAll(dir)
+
+	// probes do not need the token
+	assert.Equal(t, http.StatusOK, serveRequest(s, http.MethodGet, "/healthz").Code)
+	w := serveRequest(s, http.MethodGet, "/readyz")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"ok","queued":0}`, w.Body.String())
+
+	s.stop()
+	assert.Equal(t, http.StatusOK, serveRequest(s, http.MethodGet, "/healthz").Code)
+	w = serveRequest(s, http.MethodGet, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.JSONEq(t, `{"status":"stopping","queued":0}`, w.Body.String())
+}
+
+func TestServer_schedule(t *testing.T) {
+	log.Init(false)
+	s, dir := newTestServer(t, "", nil)
+	defer os.RemoveAll(dir)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		s.schedule(time.Hour, stop)
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(stop)
+	<-done
+
+	// every repository is scanned when the schedule starts
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	require.Len(t, s.repos["my-repo"].scans, 1)
+	assert.Equal(t, scanQueued, s.repos["my-repo"].scans[0].Status)
+}
+
+func TestServer_webhook(t *testing.T) {
+	log.Init(false)
+	s, dir := newTestServer(t, "secret", nil)
+	defer os.RemoveAll(dir)
+	post := func(body string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/github", strings.NewReader(body))
+		req.Header = header
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w
+	}
+	push := `{"ref":"refs/heads/feature","repository":{"html_url":"https://github.com/my-org/my-repo","clone_url":"https://github.com/my-org/my-repo.git"}}`
+
+	// webhooks are validated by signature, and do not need the token
+	w := post(push, http.Header{"X-Github-Event": {"push"}, "X-Hub-Signature-256": {sign("secret", []byte(push))}})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	header := http.Header{"X-Github-Event": {"push"}, "X-Hub-Signature-256": {sign("webhook-secret", []byte(push))}}
+	w = post(push, header)
+	require.Equal(t, http.StatusAccepted, w.Code)
+	var scans []serverScan
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &scans))
+	require.Len(t, scans, 1)
+	assert.Equal(t, "my-repo", scans[0].Repository)
+	assert.Equal(t, "feature", scans[0].Branch)
+
+	// a push of a branch already waiting to be scanned does not queue another scan
+	w = post(push, header)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &scans))
+	assert.Equal(t, int64(1), scans[0].Id)
+
+	other := strings.Replace(push, "my-repo", "other-repo", -1)
+	w = post(other, http.Header{"X-Github-Event": {"push"}, "X-Hub-Signature-256": {sign("webhook-secret", []byte(other))}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "no configured repository matches")
+
+	w = post(`{}`, http.Header{"X-Github-Event": {"ping"}, "X-Hub-Signature-256": {sign("webhook-secret", []byte(`{}`))}})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// a scan of a branch requested through the API is a separate scan
+	w = serveRequest(s, http.MethodPost, "/repositories/my-repo/scans?branch=main")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	s.token = ""
+	w = serveRequest(s, http.MethodPost, "/repositories/my-repo/scans?branch=main")
+	var sc serverScan
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &sc))
+	assert.Equal(t, int64(2), sc.Id)
+	assert.Equal(t, "main", sc.Branch)
+
+	s.webhookSecret = ""
+	assert.Equal(t, http.StatusNotFound, post(push, header).Code)
+}
@@ -0,0 +1,82 @@
+package coderefs
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+)
+
+// signalInterrupt cancels a search when the process receives SIGTERM or SIGINT, such as when a CI job is about to time
+// out, so the code references found so far can be sent to LaunchDarkly instead of being lost.
+type signalInterrupt struct {
+	ch       chan os.Signal
+	done     chan struct{}
+	once     sync.Once
+	mu       sync.Mutex
+	received os.Signal
+}
+
+// interruptOnSignal returns a context which is canceled when the process receives SIGTERM or SIGINT. Only the first signal
+// is handled, so a second signal terminates the process as usual. stop must be called when the scan is complete.
+func interruptOnSignal(parent context.Context) (context.Context, *signalInterrupt) {
+	ctx, cancel := context.WithCancel(parent)
+	s := &signalInterrupt{ch: make(chan os.Signal, 1), done: make(chan struct{})}
+	signal.Notify(s.ch, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		defer cancel()
+		select {
+		case sig := <-s.ch:
+			signal.Stop(s.ch)
+			s.mu.Lock()
+			s.received = sig
+			s.mu.Unlock()
+			log.Warning.Printf("received %s, stopping search and sending the code references found so far to LaunchDarkly, signal again to terminate immediately", sig)
+		case <-s.done:
+		}
+	}()
+	return ctx, s
+}
+
+// signal returns the signal received, or nil if no signal was received
+func (s *signalInterrupt) signal() os.Signal {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.received
+}
+
+// stop stops handling signals
+func (s *signalInterrupt) stop() {
+	s.once.Do(func() {
+		signal.Stop(s.ch)
+		close(s.done)
+	})
+}
+
+// partialUpdateSequenceId returns the update sequence id of code references sent after the search was interrupted, given
+// the id of a complete scan. The id is lowered, so a complete scan of the same revision, such as a retry of the job, is
+// accepted by LaunchDarkly after the partial results: millisecond timestamps of locked scans are lowered to a whole second,
+// and an updateSequenceId set by the user is decremented. If the id cannot be lowered, the partial results are not sent.
+func partialUpdateSequenceId(updateId *int, locked bool) (*int, bool) {
+	if updateId == nil {
+		return nil, true
+	}
+	id := *updateId
+	if locked {
+		// an id which is already a whole second is lowered to the previous second
+		if id%1000 == 0 {
+			id -= 1000
+		} else {
+			id -= id % 1000
+		}
+	} else {
+		id--
+	}
+	if id < 0 {
+		return nil, false
+	}
+	return &id, true
+}
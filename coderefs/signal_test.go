@@ -0,0 +1,58 @@
+package coderefs
+
+import (
+	"context"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_interruptOnSignal(t *testing.T) {
+	ctx, interrupt := interruptOnSignal(context.Background())
+	defer interrupt.stop()
+	assert.Nil(t, interrupt.signal())
+
+	require.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGTERM))
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("context was not canceled by SIGTERM")
+	}
+	assert.Equal(t, syscall.SIGTERM, interrupt.signal())
+}
+
+func Test_interruptOnSignal_stop(t *testing.T) {
+	ctx, interrupt := interruptOnSignal(context.Background())
+	interrupt.stop()
+	interrupt.stop()
+	<-ctx.Done()
+	assert.Nil(t, interrupt.signal())
+}
+
+func Test_partialUpdateSequenceId(t *testing.T) {
+	intPtr := func(i int) *int { return &i }
+	specs := []struct {
+		name     string
+		updateId *int
+		locked   bool
+		want     *int
+		wantOk   bool
+	}{
+		{"no update sequence id", nil, false, nil, true},
+		{"update sequence id", intPtr(42), false, intPtr(41), true},
+		{"update sequence id of 0", intPtr(0), false, nil, false},
+		{"locked", intPtr(1700000000123), true, intPtr(1700000000000), true},
+		{"locked whole second", intPtr(1700000000000), true, intPtr(1699999999000), true},
+		{"locked id of 0", intPtr(0), true, nil, false},
+	}
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := partialUpdateSequenceId(tt.updateId, tt.locked)
+			assert.Equal(t, tt.wantOk, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
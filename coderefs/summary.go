@@ -0,0 +1,167 @@
+package coderefs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/olekukonko/tablewriter"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	"github.com/launchdarkly/ld-find-code-refs/internal/validation"
+)
+
+// runSummary is the number of code references to each flag found by a scan of a branch. It is saved to outDir, so the
+// next scan of the branch can report how references changed.
+type runSummary struct {
+	Branch   string `json:"branch"`
+	Revision string `json:"revision"`
+	SyncTime int64  `json:"syncTime"`
+	// References counts the code references to each flag with at least one reference
+	References map[string]int64 `json:"references"`
+}
+
+func newRunSummary(branch ld.BranchRep) runSummary {
+	return runSummary{Branch: branch.Name, Revision: branch.Head, SyncTime: branch.SyncTime, References: branch.CountByFlag(nil)}
+}
+
+// flagDelta is the change in the number of code references to a flag since the previous scan
+type flagDelta struct {
+	flagKey  string
+	previous int64
+	current  int64
+}
+
+// runSummaryPath returns the path of the summary of the last scan of a branch. Summaries are named after the branch
+// rather than the revision, so each scan replaces the summary of the previous scan.
+func runSummaryPath(outDir, projKey, repoName, branch string) (string, error) {
+	absPath, err := validation.NormalizeAndValidatePath(outDir)
+	if err != nil {
+		return "", fmt.Errorf("invalid outDir '%s': %w", outDir, err)
+	}
+	tag := ld.BranchRep{Name: branch}.FileTag("")
+	return filepath.Join(absPath, fmt.Sprintf("coderefs_%s_%s_%s_summary.json", projKey, repoName, tag)), nil
+}
+
+// readRunSummary reads a summary written by a previous scan. If there is no summary, nil is returned.
+func readRunSummary(path string) (*runSummary, error) {
+	/* #nosec */
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var summary runSummary
+	err = json.Unmarshal(data, &summary)
+	if err != nil {
+		return nil, fmt.Errorf("invalid summary %s: %w", path, err)
+	}
+	return &summary, nil
+}
+
+func (s runSummary) write(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// compareRunSummaries returns the flags whose number of code references changed between two scans. Flags which gained
+// references are listed first, followed by flags which lost references, each ordered by the size of the change.
+func compareRunSummaries(previous, current runSummary) []flagDelta {
+	deltas := []flagDelta{}
+	for flagKey, count := range current.References {
+		if count != previous.References[flagKey] {
+			deltas = append(deltas, flagDelta{flagKey, previous.References[flagKey], count})
+		}
+	}
+	for flagKey, count := range previous.References {
+		if _, ok := current.References[flagKey]; !ok && count != 0 {
+			deltas = append(deltas, flagDelta{flagKey, count, 0})
+		}
+	}
+	sort.Slice(deltas, func(i, j int) bool {
+		a, b := deltas[i].current-deltas[i].previous, deltas[j].current-deltas[j].previous
+		if (a > 0) != (b > 0) {
+			return a > 0
+		}
+		if a < 0 {
+			a = -a
+		}
+		if b < 0 {
+			b = -b
+		}
+		if a != b {
+			return a > b
+		}
+		return deltas[i].flagKey < deltas[j].flagKey
+	})
+	return deltas
+}
+
+// printRunDeltas prints a table of the flags whose number of code references changed since the previous scan
+func printRunDeltas(w io.Writer, previous runSummary, deltas []flagDelta) {
+	added, removed := 0, 0
+	for _, d := range deltas {
+		if d.current > d.previous {
+			added++
+		} else {
+			removed++
+		}
+	}
+	fmt.Fprintln(w, log.Highlight(fmt.Sprintf("Changes since the previous scan of %s: %d flags with new references, %d flags with fewer references", shortRevision(previous.Revision), added, removed)))
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"Flag", "# Previous", "# Current", "Change"})
+	table.SetBorder(false)
+	table.SetAutoWrapText(false)
+	for _, d := range deltas {
+		change := strconv.FormatInt(d.current-d.previous, 10)
+		if d.current > d.previous {
+			change = "+" + change
+		}
+		table.Append([]string{d.flagKey, strconv.FormatInt(d.previous, 10), strconv.FormatInt(d.current, 10), change})
+	}
+	table.Render()
+}
+
+func shortRevision(revision string) string {
+	if len(revision) > 7 {
+		return revision[:7]
+	}
+	return revision
+}
+
+// compareWithPreviousRun prints how code references changed since the previous scan of the branch saved to outDir, and
+// saves the summary of this scan for the next scan to compare with. Returns the path of the saved summary. The summaries
+// of partial scans are not saved, since references which were not searched would be reported as removed.
+func compareWithPreviousRun(outDir, projKey, repoName string, branch ld.BranchRep, partial bool) (string, error) {
+	path, err := runSummaryPath(outDir, projKey, repoName, branch.Name)
+	if err != nil {
+		return "", err
+	}
+	previous, err := readRunSummary(path)
+	if err != nil {
+		return "", err
+	}
+	current := newRunSummary(branch)
+	if previous == nil {
+		log.Info.Printf("no previous scan of branch %s to compare code references with", branch.Name)
+	} else if deltas := compareRunSummaries(*previous, current); len(deltas) == 0 {
+		log.Info.Printf("code references are unchanged since the previous scan of %s", shortRevision(previous.Revision))
+	} else {
+		printRunDeltas(log.Console(), *previous, deltas)
+	}
+	if partial {
+		log.Info.Printf("summary of partial scan was not saved, the next scan will be compared with the previous scan")
+		return "", nil
+	}
+	return path, current.write(path)
+}
@@ -0,0 +1,70 @@
+package coderefs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+)
+
+func TestCompareRunSummaries(t *testing.T) {
+	previous := runSummary{References: map[string]int64{"unchanged": 2, "fewer": 5, "removed": 1, "more": 1}}
+	current := runSummary{References: map[string]int64{"unchanged": 2, "fewer": 2, "more": 2, "new-a": 3, "new-b": 3}}
+
+	want := []flagDelta{
+		{"new-a", 0, 3},
+		{"new-b", 0, 3},
+		{"more", 1, 2},
+		{"fewer", 5, 2},
+		{"removed", 1, 0},
+	}
+	deltas := compareRunSummaries(previous, current)
+	assert.Equal(t, want, deltas)
+
+	var buf bytes.Buffer
+	printRunDeltas(&buf, runSummary{Revision: "0123456789abcdef"}, deltas)
+	assert.Contains(t, buf.String(), "Changes since the previous scan of 0123456: 3 flags with new references, 2 flags with fewer references")
+	assert.Contains(t, buf.String(), "+3")
+}
+
+func TestCompareWithPreviousRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "summary")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	branch := func(head string, flagKeys ...string) ld.BranchRep {
+		hunks := []ld.HunkRep{}
+		for _, flagKey := range flagKeys {
+			hunks = append(hunks, ld.HunkRep{FlagKey: flagKey})
+		}
+		return ld.BranchRep{Name: "feature/x", Head: head, References: []ld.ReferenceHunksRep{{Path: "main.go", Hunks: hunks}}}
+	}
+
+	path, err := compareWithPreviousRun(dir, "default", "repo", branch("aaa", "flag1"), false)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "coderefs_default_repo_feature_x_summary.json"), path)
+	summary, err := readRunSummary(path)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{"flag1": 1}, summary.References)
+
+	path, err = compareWithPreviousRun(dir, "default", "repo", branch("bbb"), true)
+	require.NoError(t, err)
+	assert.Empty(t, path, "summaries of partial scans are not saved")
+
+	path, err = compareWithPreviousRun(dir, "default", "repo", branch("ccc", "flag1", "flag2"), false)
+	require.NoError(t, err)
+	summary, err = readRunSummary(path)
+	require.NoError(t, err)
+	assert.Equal(t, "ccc", summary.Revision)
+	assert.Equal(t, map[string]int64{"flag1": 1, "flag2": 1}, summary.References)
+
+	summary, err = readRunSummary(filepath.Join(dir, "missing.json"))
+	require.NoError(t, err)
+	assert.Nil(t, summary)
+}
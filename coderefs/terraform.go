@@ -0,0 +1,163 @@
+package coderefs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/helpers"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	"github.com/launchdarkly/ld-find-code-refs/internal/terraform"
+	"github.com/launchdarkly/ld-find-code-refs/internal/validation"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+	"github.com/launchdarkly/ld-find-code-refs/search"
+)
+
+// terraformReport reconciles the flags defined in Terraform configuration with the flags referenced in code
+type terraformReport struct {
+	Definitions int `json:"definitions"`
+	// Undefined are flags referenced in code without a Terraform definition
+	Undefined []undefinedFlag `json:"undefined"`
+	// Unreferenced are flags defined in Terraform without code references
+	Unreferenced []terraform.Definition `json:"unreferenced"`
+	// Unresolved are definitions whose flag key is not a literal string, so they cannot be reconciled
+	Unresolved []terraform.Definition `json:"unresolved"`
+}
+
+type undefinedFlag struct {
+	FlagKey    string `json:"flagKey"`
+	References int    `json:"references"`
+	Files      int    `json:"files"`
+}
+
+// Terraform compares the flags defined by launchdarkly_feature_flag resources in the Terraform configuration in tfDir
+// with the flags referenced in the configured directory, and reports flags referenced in code without a Terraform
+// definition, and flags defined in Terraform without code references. References in .tf files are not counted. Flags
+// are retrieved from LaunchDarkly when possible, otherwise only the flags defined in Terraform are searched for. Results
+// are written to out as text, or as JSON if asJSON is set.
+func Terraform(opts options.Options, tfDir string, out io.Writer, asJSON bool) error {
+	absPath, err := validation.NormalizeAndValidatePath(opts.Dir)
+	if err != nil {
+		return fmt.Errorf("could not validate directory option: %w", err)
+	}
+	if tfDir == "" {
+		tfDir = absPath
+	}
+	defs, err := terraform.FindDefinitions(tfDir)
+	if err != nil {
+		return fmt.Errorf("unable to read Terraform configuration: %w", err)
+	}
+
+	report := terraformReport{Undefined: []undefinedFlag{}, Unreferenced: []terraform.Definition{}, Unresolved: []terraform.Definition{}}
+	defined := map[string]terraform.Definition{}
+	for _, def := range defs {
+		switch {
+		case def.Key == "":
+			report.Unresolved = append(report.Unresolved, def)
+		case def.ProjectKey != "" && opts.ProjKey != "" && def.ProjectKey != opts.ProjKey:
+			log.Debug.Printf("skipping %s in %s, which belongs to project %s", def.Resource, def.Path, def.ProjectKey)
+		default:
+			report.Definitions++
+			defined[def.Key] = def
+		}
+	}
+
+	flags := []string{}
+	if opts.OfflineFlags == "" && (opts.AccessToken == "" || opts.ProjKey == "") {
+		log.Warning.Printf("accessToken and projKey are not set, only flags defined in Terraform will be searched for")
+	} else {
+		flags, err = getFlags(opts, newApiClient(opts))
+		if err != nil {
+			return fmt.Errorf("could not retrieve flag keys from LaunchDarkly: %w", err)
+		}
+	}
+	for key := range defined {
+		flags = append(flags, key)
+	}
+	flags, _ = filterShortFlagKeys(helpers.Dedupe(flags))
+
+	aliases, rules, err := generateAliases(opts, flags, absPath)
+	if err != nil {
+		return fmt.Errorf("failed to create flag key aliases: %w", err)
+	}
+	refs, err := search.SearchForRefs(context.Background(), search.Options{
+		ProjKey:        opts.ProjKey,
+		Workspace:      absPath,
+		Aliases:        aliases,
+		ContextLines:   search.NewContextLines(0, nil),
+		Delimiters:     configureDelimiters(opts, rules),
+		LineLengthUnit: search.LineLengthUnit(opts.LineLengthUnit),
+		Symlinks:       search.SymlinkPolicy(opts.Symlinks),
+		GitAttributes:  opts.GitAttributes,
+		MaxFileSize:    int64(opts.MaxFileSizeKb) * 1024,
+	})
+	if err != nil {
+		return fmt.Errorf("error searching for flag key references: %w", err)
+	}
+
+	references := map[string]int{}
+	files := map[string]map[string]bool{}
+	for _, ref := range refs {
+		if filepath.Ext(ref.Path) == ".tf" {
+			continue
+		}
+		for _, hunk := range ref.Hunks {
+			references[hunk.FlagKey]++
+			if files[hunk.FlagKey] == nil {
+				files[hunk.FlagKey] = map[string]bool{}
+			}
+			files[hunk.FlagKey][ref.Path] = true
+		}
+	}
+	for flag, count := range references {
+		if _, ok := defined[flag]; !ok {
+			report.Undefined = append(report.Undefined, undefinedFlag{FlagKey: flag, References: count, Files: len(files[flag])})
+		}
+	}
+	for key, def := range defined {
+		if references[key] == 0 {
+			report.Unreferenced = append(report.Unreferenced, def)
+		}
+	}
+	sort.Slice(report.Undefined, func(i, j int) bool { return report.Undefined[i].FlagKey < report.Undefined[j].FlagKey })
+	sort.Slice(report.Unreferenced, func(i, j int) bool { return report.Unreferenced[i].Key < report.Unreferenced[j].Key })
+
+	if asJSON {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(out, string(data))
+		return err
+	}
+	printTerraformReport(out, report)
+	return nil
+}
+
+func printTerraformReport(out io.Writer, report terraformReport) {
+	fmt.Fprintf(out, "found %d flags defined in Terraform\n", report.Definitions)
+	if len(report.Undefined) > 0 {
+		fmt.Fprintf(out, "\nflags referenced in code without a Terraform definition (%d):\n", len(report.Undefined))
+		for _, f := range report.Undefined {
+			fmt.Fprintf(out, "  %s: %d references in %d files\n", f.FlagKey, f.References, f.Files)
+		}
+	}
+	if len(report.Unreferenced) > 0 {
+		fmt.Fprintf(out, "\nflags defined in Terraform without code references (%d):\n", len(report.Unreferenced))
+		for _, def := range report.Unreferenced {
+			fmt.Fprintf(out, "  %s: %s (%s:%d)\n", def.Key, def.Resource, def.Path, def.Line)
+		}
+	}
+	if len(report.Unresolved) > 0 {
+		fmt.Fprintf(out, "\nflags defined in Terraform with keys which are not literal strings (%d):\n", len(report.Unresolved))
+		for _, def := range report.Unresolved {
+			fmt.Fprintf(out, "  %s: key = %s (%s:%d)\n", def.Resource, def.Expression, def.Path, def.Line)
+		}
+	}
+	if len(report.Undefined) == 0 && len(report.Unreferenced) == 0 {
+		fmt.Fprintln(out, "all flags referenced in code are defined in Terraform, and all flags defined in Terraform are referenced")
+	}
+}
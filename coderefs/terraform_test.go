@@ -0,0 +1,88 @@
+package coderefs
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/options"
+	"github.com/launchdarkly/ld-find-code-refs/testserver"
+)
+
+func TestTerraform(t *testing.T) {
+	dir, err := ioutil.TempDir("", "terraform")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "infra"), 0700))
+
+	server := testserver.New("")
+	server.AddProject("default", []string{"new-checkout", "dark-mode", "unused-flag"}, nil)
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	opts := options.Options{AccessToken: "api-x", BaseUri: httpServer.URL, ProjKey: "default", Dir: dir}
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "infra", "flags.tf"), []byte(`
+resource "launchdarkly_feature_flag" "checkout" {
+  project_key = "default"
+  key         = "new-checkout"
+}
+
+resource "launchdarkly_feature_flag" "unused" {
+  project_key = "default"
+  key         = "unused-flag"
+}
+
+resource "launchdarkly_feature_flag" "other" {
+  project_key = "other-project"
+  key         = "other-flag"
+}
+
+resource "launchdarkly_feature_flag" "dynamic" {
+  key = var.flag_key
+}
+`), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "app.js"), []byte("client.variation('new-checkout', ctx, false)\nclient.variation('dark-mode', ctx, false)\n"), 0600))
+
+	var out bytes.Buffer
+	require.NoError(t, Terraform(opts, "", &out, false))
+	assert.Equal(t, `found 2 flags defined in Terraform
+
+flags referenced in code without a Terraform definition (1):
+  dark-mode: 1 references in 1 files
+
+flags defined in Terraform without code references (1):
+  unused-flag: launchdarkly_feature_flag.unused (infra/flags.tf:7)
+
+flags defined in Terraform with keys which are not literal strings (1):
+  launchdarkly_feature_flag.dynamic: key = var.flag_key (infra/flags.tf:17)
+`, out.String())
+
+	out.Reset()
+	require.NoError(t, Terraform(opts, filepath.Join(dir, "infra"), &out, true))
+	var report terraformReport
+	require.NoError(t, json.Unmarshal(out.Bytes(), &report))
+	assert.Equal(t, 2, report.Definitions)
+	assert.Equal(t, []undefinedFlag{{FlagKey: "dark-mode", References: 1, Files: 1}}, report.Undefined)
+	require.Len(t, report.Unreferenced, 1)
+	assert.Equal(t, "flags.tf", report.Unreferenced[0].Path, "paths are relative to the Terraform directory")
+}
+
+func TestTerraform_withoutAccessToken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "terraform")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "main.tf"), []byte("resource \"launchdarkly_feature_flag\" \"f\" {\n  key = \"new-checkout\"\n}\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "app.js"), []byte("client.variation('new-checkout', ctx, false)\n"), 0600))
+
+	var out bytes.Buffer
+	require.NoError(t, Terraform(options.Options{Dir: dir}, "", &out, false))
+	assert.Equal(t, "found 1 flags defined in Terraform\nall flags referenced in code are defined in Terraform, and all flags defined in Terraform are referenced\n", out.String())
+}
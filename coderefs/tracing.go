@@ -0,0 +1,82 @@
+package coderefs
+
+import (
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	"github.com/launchdarkly/ld-find-code-refs/internal/tracing"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+)
+
+const (
+	defaultServiceName = "ld-find-code-refs"
+	otlpTracesPath     = "/v1/traces"
+)
+
+// newTracer returns a tracer exporting the spans of a scan to the OpenTelemetry collector set by the otlpEndpoint option,
+// or by the standard OpenTelemetry environment variables. Returns nil if tracing is not configured.
+func newTracer(opts options.Options) *tracing.Tracer {
+	endpoint := tracesEndpoint(opts.OtlpEndpoint, os.Getenv)
+	if endpoint == "" {
+		return nil
+	}
+	service := os.Getenv("OTEL_SERVICE_NAME")
+	if service == "" {
+		service = defaultServiceName
+	}
+	headers := otlpHeaders(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"))
+	for name, value := range otlpHeaders(os.Getenv("OTEL_EXPORTER_OTLP_TRACES_HEADERS")) {
+		headers[name] = value
+	}
+	log.Debug.Printf("exporting spans of the scan to %s", endpoint)
+	return tracing.New(endpoint, headers, service, "scan")
+}
+
+// tracesEndpoint returns the url spans are exported to. The otlpEndpoint option, and OTEL_EXPORTER_OTLP_ENDPOINT, are the
+// base url of a collector, while OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is the full url of its traces endpoint.
+func tracesEndpoint(endpoint string, getenv func(string) string) string {
+	if endpoint == "" {
+		if traces := getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); traces != "" {
+			return traces
+		}
+		endpoint = getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	}
+	if endpoint == "" {
+		return ""
+	}
+	return strings.TrimSuffix(endpoint, "/") + otlpTracesPath
+}
+
+// otlpHeaders parses headers in the format of OTEL_EXPORTER_OTLP_HEADERS, a comma-separated list of name=value pairs with
+// url encoded values. Invalid pairs are ignored.
+func otlpHeaders(value string) map[string]string {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			continue
+		}
+		v, err := url.QueryUnescape(strings.TrimSpace(parts[1]))
+		if err != nil {
+			continue
+		}
+		headers[strings.TrimSpace(parts[0])] = v
+	}
+	return headers
+}
+
+// exportTrace sends the spans of a scan to the collector, marking the scan as failed if err is not nil. Spans which cannot
+// be exported are logged as a warning, and do not fail the scan.
+func exportTrace(tracer *tracing.Tracer, err error) {
+	if tracer == nil {
+		return
+	}
+	if err != errServiceErrorIgnored {
+		tracer.Root().SetError(err)
+	}
+	if exportErr := tracer.Export(); exportErr != nil {
+		log.Warning.Printf("unable to export spans of the scan to OpenTelemetry collector: %s", exportErr)
+	}
+}
@@ -0,0 +1,31 @@
+package coderefs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_tracesEndpoint(t *testing.T) {
+	specs := []struct {
+		name     string
+		endpoint string
+		env      map[string]string
+		want     string
+	}{
+		{name: "not configured", want: ""},
+		{name: "option", endpoint: "http://localhost:4318/", env: map[string]string{"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "http://collector/traces"}, want: "http://localhost:4318/v1/traces"},
+		{name: "traces endpoint", env: map[string]string{"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "http://collector/traces", "OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector"}, want: "http://collector/traces"},
+		{name: "endpoint", env: map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318"}, want: "http://collector:4318/v1/traces"},
+	}
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tracesEndpoint(tt.endpoint, func(key string) string { return tt.env[key] }))
+		})
+	}
+}
+
+func Test_otlpHeaders(t *testing.T) {
+	assert.Equal(t, map[string]string{}, otlpHeaders(""))
+	assert.Equal(t, map[string]string{"api-key": "secret", "x-team": "platform team"}, otlpHeaders("api-key=secret, x-team=platform%20team,invalid"))
+}
@@ -0,0 +1,62 @@
+package coderefs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	"github.com/launchdarkly/ld-find-code-refs/internal/update"
+	"github.com/launchdarkly/ld-find-code-refs/internal/version"
+)
+
+// CheckForUpdates logs a warning if the running version is outdated or has been yanked. Failures to check for updates are not fatal.
+func CheckForUpdates() {
+	status, err := update.NewChecker(update.DefaultReleasesUrl).Check(version.Version)
+	if err != nil {
+		log.Debug.Printf("could not check for updates: %s", err)
+		return
+	}
+	if status.Yanked && status.Latest == nil {
+		// every release has been yanked, so there is nothing to upgrade to
+		log.Warning.Printf("ld-find-code-refs version %s has been yanked and should no longer be used", status.Current)
+	} else if status.Yanked {
+		log.Warning.Printf("ld-find-code-refs version %s has been yanked and should no longer be used, please upgrade to version %s", status.Current, status.Latest.Version())
+	} else if status.Outdated {
+		log.Warning.Printf("a newer version of ld-find-code-refs is available: %s (running %s)", status.Latest.Version(), status.Current)
+	}
+}
+
+// Update replaces the running binary with the latest release. If checkOnly is set, the latest release is reported without updating.
+func Update(out io.Writer, checkOnly bool) error {
+	checker := update.NewChecker(update.DefaultReleasesUrl)
+	status, err := checker.Check(version.Version)
+	if err != nil {
+		return fmt.Errorf("could not check for updates: %w", err)
+	}
+	if status.Yanked && status.Latest == nil {
+		fmt.Fprintf(out, "ld-find-code-refs %s has been yanked, and no other release is available\n", version.Version)
+		return nil
+	}
+	if status.Latest == nil || (!status.Outdated && !status.Yanked) {
+		fmt.Fprintf(out, "ld-find-code-refs %s is the latest version\n", version.Version)
+		return nil
+	}
+	if status.Yanked {
+		fmt.Fprintf(out, "ld-find-code-refs %s has been yanked\n", version.Version)
+	}
+	fmt.Fprintf(out, "ld-find-code-refs %s is available (running %s)\n", status.Latest.Version(), version.Version)
+	if checkOnly {
+		return nil
+	}
+	if update.IsContainer() {
+		return errors.New("ld-find-code-refs appears to be running in a container, please pull the latest image instead of updating in place")
+	}
+
+	path, err := checker.Update(*status.Latest)
+	if err != nil {
+		return fmt.Errorf("failed to update ld-find-code-refs: %w", err)
+	}
+	fmt.Fprintf(out, "updated %s to version %s\n", path, status.Latest.Version())
+	return nil
+}
@@ -0,0 +1,86 @@
+package coderefs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+)
+
+// Upload sends branches written by scans with the deferUpload option to LaunchDarkly. Up to concurrency branches are sent
+// at once, and an error is returned if any branch could not be sent.
+func Upload(opts options.Options, paths []string, concurrency int) error {
+	missing := []string{}
+	if opts.AccessToken == "" {
+		missing = append(missing, "accessToken")
+	}
+	if opts.RepoName == "" {
+		missing = append(missing, "repoName")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required option(s): %v", missing)
+	}
+	opts = withNormalizedRepoName(opts)
+
+	branches := make([]ld.BranchRep, 0, len(paths))
+	seen := map[string]string{}
+	for _, path := range paths {
+		branch, err := readBranch(path)
+		if err != nil {
+			return fmt.Errorf("could not read branch from %s: %w", path, err)
+		}
+		if other, ok := seen[branch.Name]; ok {
+			return fmt.Errorf("branch '%s' is included in both %s and %s", branch.Name, other, path)
+		}
+		seen[branch.Name] = path
+		branches = append(branches, branch)
+	}
+
+	ldApi := ld.InitApiClient(apiOptions(opts))
+	err := ldApi.MaybeUpsertCodeReferenceRepository(newRepoParams(opts))
+	if err != nil {
+		return serviceError(err, opts.IgnoreServiceErrors)
+	}
+
+	log.Info.Printf("sending %d branches to LaunchDarkly for repository: %s", len(branches), opts.RepoName)
+	errs := ldApi.PutCodeReferenceBranches(branches, opts.RepoName, concurrency)
+	failed := 0
+	for _, branch := range branches {
+		err := errs[branch.Name]
+		switch {
+		case err == nil:
+			log.Info.Printf("sent %d code references across %d files for branch %s", branch.TotalHunkCount(), len(branch.References), branch.Name)
+		case err == ld.BranchUpdateSequenceIdConflictErr:
+			log.Warning.Printf("skipped branch %s: updateSequenceId must be greater than previously submitted updateSequenceId", branch.Name)
+		default:
+			failed++
+			log.Error.Printf("error sending branch %s to LaunchDarkly: %s", branch.Name, err)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to send %d of %d branches to LaunchDarkly", failed, len(branches))
+	}
+	return nil
+}
+
+// readBranch reads a branch written with the deferUpload option
+func readBranch(path string) (ld.BranchRep, error) {
+	var branch ld.BranchRep
+	/* #nosec */
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return branch, err
+	}
+	err = json.Unmarshal(data, &branch)
+	if err != nil {
+		return branch, err
+	}
+	if branch.Name == "" || branch.Head == "" {
+		return branch, errors.New("branch name and head are required")
+	}
+	return branch, nil
+}
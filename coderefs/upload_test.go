@@ -0,0 +1,54 @@
+package coderefs
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+	"github.com/launchdarkly/ld-find-code-refs/testserver"
+)
+
+func TestUpload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "upload")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	server := testserver.New("")
+	server.AddProject("default", []string{"flag1"}, nil)
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	paths := []string{}
+	for _, name := range []string{"main", "release/1.0", "release/1.1"} {
+		branch := ld.BranchRep{
+			Name:       name,
+			Head:       "0123456789abcdef",
+			References: []ld.ReferenceHunksRep{{Path: "main.go", Hunks: []ld.HunkRep{{StartingLineNumber: 1, ProjKey: "default", FlagKey: "flag1"}}}},
+		}
+		branchDir := filepath.Join(dir, filepath.Base(name))
+		require.NoError(t, os.Mkdir(branchDir, 0700))
+		path, err := branch.WriteToJSON(branchDir, "default", "repo", branch.Head)
+		require.NoError(t, err)
+		paths = append(paths, path)
+	}
+
+	opts := options.Options{AccessToken: "api-x", BaseUri: httpServer.URL, RepoName: "repo", RepoType: "custom", DefaultBranch: "main"}
+	require.NoError(t, Upload(opts, paths, 2))
+	state, ok := server.Repository("repo")
+	require.True(t, ok)
+	assert.Len(t, state.Branches, 3)
+	assert.Len(t, state.Branches["release/1.1"].References, 1)
+
+	err = Upload(opts, []string{paths[0], paths[0]}, 2)
+	assert.EqualError(t, err, "branch 'main' is included in both "+paths[0]+" and "+paths[0])
+
+	opts.RepoName = ""
+	assert.EqualError(t, Upload(opts, paths, 2), "missing required option(s): [repoName]")
+}
@@ -0,0 +1,68 @@
+package coderefs
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/provenance"
+)
+
+// VerifyManifest verifies the signature of a scan manifest written with the signingKey option, and the digests of the
+// artifacts it lists, which must be in the same directory as the manifest. Results are written to out, and an error is
+// returned if verification fails.
+func VerifyManifest(manifestPath, publicKeyPath string, out io.Writer) error {
+	key, err := provenance.LoadPublicKey(publicKeyPath)
+	if err != nil {
+		return err
+	}
+	/* #nosec */
+	data, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		return err
+	}
+	/* #nosec */
+	encoded, err := ioutil.ReadFile(manifestPath + ".sig")
+	if err != nil {
+		return fmt.Errorf("could not read manifest signature: %w", err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return fmt.Errorf("could not decode manifest signature: %w", err)
+	}
+	err = provenance.Verify(key, data, signature)
+	if err != nil {
+		fmt.Fprintf(out, "FAIL %s: %s\n", filepath.Base(manifestPath), err)
+		return fmt.Errorf("scan manifest %s could not be verified", manifestPath)
+	}
+	fmt.Fprintf(out, "ok   %s: signature verified\n", filepath.Base(manifestPath))
+
+	var m manifest
+	err = json.Unmarshal(data, &m)
+	if err != nil {
+		return fmt.Errorf("could not parse scan manifest: %w", err)
+	}
+	dir := filepath.Dir(manifestPath)
+	failures := 0
+	for _, a := range m.Artifacts {
+		digest, err := provenance.Digest(filepath.Join(dir, filepath.Base(a.Name)))
+		switch {
+		case err != nil:
+			failures++
+			fmt.Fprintf(out, "FAIL %s: %s\n", a.Name, err)
+		case digest != a.SHA256:
+			failures++
+			fmt.Fprintf(out, "FAIL %s: digest %s does not match manifest digest %s\n", a.Name, digest, a.SHA256)
+		default:
+			fmt.Fprintf(out, "ok   %s: digest verified\n", a.Name)
+		}
+	}
+	if failures > 0 {
+		return fmt.Errorf("%d artifact(s) could not be verified", failures)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package coderefs
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+)
+
+func TestVerifyManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "verify")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	publicBytes, err := x509.MarshalPKIXPublicKey(public)
+	require.NoError(t, err)
+	publicPath := filepath.Join(dir, "key.pub")
+	require.NoError(t, ioutil.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicBytes}), 0600))
+
+	csvPath := filepath.Join(dir, "coderefs.csv")
+	require.NoError(t, ioutil.WriteFile(csvPath, []byte("flagKey,path\n"), 0600))
+	m := newManifest("default", "repo", ld.BranchRep{Name: "main", Head: "0123456789abcdef"}, 1, false, nil)
+	require.NoError(t, m.addArtifacts(csvPath))
+	manifestPath, err := m.write(dir, private)
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, VerifyManifest(manifestPath, publicPath, &out))
+	assert.Equal(t, "ok   coderefs_default_repo_0123456_manifest.json: signature verified\nok   coderefs.csv: digest verified\n", out.String())
+
+	// modified artifact
+	require.NoError(t, ioutil.WriteFile(csvPath, []byte("flagKey,path\nflag,a\n"), 0600))
+	out.Reset()
+	assert.EqualError(t, VerifyManifest(manifestPath, publicPath, &out), "1 artifact(s) could not be verified")
+	assert.Contains(t, out.String(), "FAIL coderefs.csv: digest")
+
+	// modified manifest
+	data, err := ioutil.ReadFile(manifestPath)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(manifestPath, bytes.Replace(data, []byte(`"flags": 1`), []byte(`"flags": 2`), 1), 0600))
+	out.Reset()
+	assert.EqualError(t, VerifyManifest(manifestPath, publicPath, &out), "scan manifest "+manifestPath+" could not be verified")
+	assert.Equal(t, "FAIL coderefs_default_repo_0123456_manifest.json: invalid signature\n", out.String())
+}
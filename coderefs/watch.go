@@ -0,0 +1,102 @@
+package coderefs
+
+import (
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/git"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+)
+
+// watchState is the state of a watched repository which is checked for changes
+type watchState struct {
+	head   string
+	config string
+	ignore string
+}
+
+// readWatchState reads the checked out commit and configuration of the repository in dir
+func readWatchState(dir string) watchState {
+	var state watchState
+	if client, err := git.OpenClient(dir); err == nil {
+		state.head, _ = client.ResolveRevision("HEAD")
+	}
+	for _, name := range []string{"coderefs.yaml", "coderefs.yml"} {
+		/* #nosec */
+		if data, err := ioutil.ReadFile(filepath.Join(dir, ".launchdarkly", name)); err == nil {
+			state.config += string(data)
+		}
+	}
+	/* #nosec */
+	if data, err := ioutil.ReadFile(filepath.Join(dir, ".ldignore")); err == nil {
+		state.ignore = string(data)
+	}
+	return state
+}
+
+// Watch scans a repository, then scans it again whenever its checked out commit or configuration changes, until the
+// process receives SIGINT or SIGTERM. Changes are checked for at the given interval. load reads and validates the options
+// of a scan, and is called again whenever .launchdarkly/coderefs.yaml or .ldignore change, so configuration changes take
+// effect without restarting. If the new configuration is invalid, the error is logged and the previous configuration is
+// kept.
+func Watch(load func() (options.Options, error), interval time.Duration) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	stop := make(chan struct{})
+	go func() {
+		sig := <-signals
+		log.Info.Printf("received %s, stopping after the running scan", sig)
+		close(stop)
+	}()
+	return watch(load, func(opts options.Options) error { return scan(opts, nil, nil) }, interval, stop)
+}
+
+// watch runs scans with run until stop is closed
+func watch(load func() (options.Options, error), run func(options.Options) error, interval time.Duration, stop <-chan struct{}) error {
+	opts, err := load()
+	if err != nil {
+		return err
+	}
+	config := effectiveConfig(opts)
+	state := readWatchState(opts.Dir)
+	for {
+		log.Info.Printf("scanning repository %s in %s", opts.RepoName, opts.Dir)
+		err = run(opts)
+		if err != nil && err != errServiceErrorIgnored {
+			log.Error.Printf("scan failed: %s", err)
+		}
+
+		// wait for a change which requires another scan
+		rescan := false
+		for !rescan {
+			select {
+			case <-stop:
+				return nil
+			case <-time.After(interval):
+			}
+			current := readWatchState(opts.Dir)
+			if current == state {
+				continue
+			}
+			rescan = current.head != state.head
+			if current.config != state.config || current.ignore != state.ignore {
+				next, err := load()
+				if err != nil {
+					log.Error.Printf("configuration of repository %s is invalid, keeping the previous configuration: %s", opts.RepoName, err)
+				} else {
+					nextConfig := effectiveConfig(next)
+					logConfigChanges(opts.RepoName, config, nextConfig)
+					opts, config = next, nextConfig
+					rescan = true
+				}
+			}
+			state = current
+		}
+	}
+}
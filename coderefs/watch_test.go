@@ -0,0 +1,95 @@
+package coderefs
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/options"
+)
+
+func TestWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.Mkdir(filepath.Join(dir, ".launchdarkly"), 0700))
+	configPath := filepath.Join(dir, ".launchdarkly", "coderefs.yaml")
+	// the configuration is replaced in one step, so it is never read while partially written
+	writeConfig := func(projKey string) {
+		require.NoError(t, ioutil.WriteFile(configPath+".tmp", []byte(projKey), 0600))
+		require.NoError(t, os.Rename(configPath+".tmp", configPath))
+	}
+	writeConfig("first")
+
+	load := func() (options.Options, error) {
+		data, err := ioutil.ReadFile(configPath)
+		if err != nil {
+			return options.Options{}, err
+		}
+		if string(data) == "invalid" {
+			return options.Options{}, errors.New("invalid configuration")
+		}
+		return options.Options{Dir: dir, ProjKey: string(data)}, nil
+	}
+	scans := make(chan string)
+	run := func(opts options.Options) error {
+		scans <- opts.ProjKey
+		return nil
+	}
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- watch(load, run, 5*time.Millisecond, stop)
+	}()
+
+	assert.Equal(t, "first", <-scans)
+	writeConfig("second")
+	assert.Equal(t, "second", <-scans, "a configuration change is reloaded and scanned")
+	writeConfig("invalid")
+	select {
+	case projKey := <-scans:
+		assert.Fail(t, "unexpected scan with invalid configuration", projKey)
+	case <-time.After(50 * time.Millisecond):
+	}
+	writeConfig("third")
+	assert.Equal(t, "third", <-scans)
+	close(stop)
+	assert.NoError(t, <-done)
+}
+
+func TestEffectiveConfig(t *testing.T) {
+	enabled := true
+	opts := options.Options{
+		AccessToken:  "api-secret",
+		AnonymizeKey: "secret",
+		ProjKey:      "default",
+		ContextLines: 2,
+		AliasSources: []string{"aliases.yaml", "more-aliases.yaml"},
+		Delimiters:   options.Delimiters{Additional: []string{"<"}},
+		Hooks:        options.Hooks{PreScan: "make generate"},
+		RepoMetadata: options.RepoMetadata{Enabled: &enabled},
+	}
+	assert.Equal(t, []string{
+		"accessToken: <redacted>",
+		"anonymizeKey: <redacted>",
+		"projkey: default",
+		"contextLines: 2",
+		"aliasSources: aliases.yaml",
+		"aliasSources: more-aliases.yaml",
+		"delimiters: {additional: [<]}",
+		"hooks: {preScan: make generate}",
+		"repoMetadata: {enabled: true}",
+	}, effectiveConfig(opts))
+}
+
+func TestDiffConfig(t *testing.T) {
+	removed, added := diffConfig([]string{"a", "b", "b"}, []string{"b", "c"})
+	assert.Equal(t, []string{"a", "b"}, removed)
+	assert.Equal(t, []string{"c"}, added)
+}
@@ -0,0 +1,229 @@
+package coderefs
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Providers of push webhooks accepted by the server
+const (
+	webhookGitHub    = "github"
+	webhookGitLab    = "gitlab"
+	webhookBitbucket = "bitbucket"
+)
+
+// maxWebhookSize is the maximum size of a webhook request body
+const maxWebhookSize = 25 << 20
+
+var errInvalidSignature = errors.New("webhook signature is missing or invalid")
+
+// pushEvent is a push of one or more branches to a repository, parsed from a webhook
+type pushEvent struct {
+	// Branches are the names of the branches which were created or updated. Deleted branches are not included.
+	Branches []string
+	// Urls identify the pushed repository, e.g. its web and clone urls
+	Urls []string
+}
+
+// verifyWebhook checks that a webhook was sent by the provider, using the secret configured for the webhook. GitHub and
+// Bitbucket sign the request body with the secret, while GitLab sends the secret as a token.
+func verifyWebhook(provider string, header http.Header, body []byte, secret string) error {
+	var signature string
+	switch provider {
+	case webhookGitHub:
+		signature = header.Get("X-Hub-Signature-256")
+	case webhookBitbucket:
+		signature = header.Get("X-Hub-Signature")
+	case webhookGitLab:
+		if subtle.ConstantTimeCompare([]byte(header.Get("X-Gitlab-Token")), []byte(secret)) != 1 {
+			return errInvalidSignature
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown webhook provider %q", provider)
+	}
+	if !strings.HasPrefix(signature, "sha256=") {
+		return errInvalidSignature
+	}
+	got, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return errInvalidSignature
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(body)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return errInvalidSignature
+	}
+	return nil
+}
+
+// parsePushEvent parses a push webhook. Returns nil if the webhook is another type of event, such as a ping.
+func parsePushEvent(provider string, header http.Header, body []byte) (*pushEvent, error) {
+	switch provider {
+	case webhookGitHub:
+		if header.Get("X-GitHub-Event") != "push" {
+			return nil, nil
+		}
+		return parseGitHubPush(body)
+	case webhookGitLab:
+		if header.Get("X-Gitlab-Event") != "Push Hook" {
+			return nil, nil
+		}
+		return parseGitLabPush(body)
+	case webhookBitbucket:
+		switch header.Get("X-Event-Key") {
+		case "repo:push":
+			return parseBitbucketCloudPush(body)
+		case "repo:refs_changed":
+			return parseBitbucketServerPush(body)
+		}
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown webhook provider %q", provider)
+}
+
+func parseGitHubPush(body []byte) (*pushEvent, error) {
+	var payload struct {
+		Ref        string `json:"ref"`
+		Deleted    bool   `json:"deleted"`
+		Repository struct {
+			HtmlUrl  string `json:"html_url"`
+			CloneUrl string `json:"clone_url"`
+			SshUrl   string `json:"ssh_url"`
+		} `json:"repository"`
+	}
+	err := json.Unmarshal(body, &payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitHub push event: %w", err)
+	}
+	event := &pushEvent{Urls: []string{payload.Repository.HtmlUrl, payload.Repository.CloneUrl, payload.Repository.SshUrl}}
+	if branch := strings.TrimPrefix(payload.Ref, "refs/heads/"); branch != payload.Ref && !payload.Deleted {
+		event.Branches = []string{branch}
+	}
+	return event, nil
+}
+
+func parseGitLabPush(body []byte) (*pushEvent, error) {
+	var payload struct {
+		Ref     string `json:"ref"`
+		After   string `json:"after"`
+		Project struct {
+			WebUrl     string `json:"web_url"`
+			GitHttpUrl string `json:"git_http_url"`
+			GitSshUrl  string `json:"git_ssh_url"`
+		} `json:"project"`
+	}
+	err := json.Unmarshal(body, &payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitLab push event: %w", err)
+	}
+	event := &pushEvent{Urls: []string{payload.Project.WebUrl, payload.Project.GitHttpUrl, payload.Project.GitSshUrl}}
+	// the commit a deleted branch is pushed to is all zeros
+	deleted := strings.Trim(payload.After, "0") == ""
+	if branch := strings.TrimPrefix(payload.Ref, "refs/heads/"); branch != payload.Ref && !deleted {
+		event.Branches = []string{branch}
+	}
+	return event, nil
+}
+
+func parseBitbucketCloudPush(body []byte) (*pushEvent, error) {
+	var payload struct {
+		Push struct {
+			Changes []struct {
+				New *struct {
+					Type string `json:"type"`
+					Name string `json:"name"`
+				} `json:"new"`
+			} `json:"changes"`
+		} `json:"push"`
+		Repository struct {
+			Links struct {
+				Html struct {
+					Href string `json:"href"`
+				} `json:"html"`
+			} `json:"links"`
+		} `json:"repository"`
+	}
+	err := json.Unmarshal(body, &payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Bitbucket push event: %w", err)
+	}
+	event := &pushEvent{Urls: []string{payload.Repository.Links.Html.Href}}
+	for _, change := range payload.Push.Changes {
+		// deleted branches have no new state
+		if change.New != nil && change.New.Type == "branch" {
+			event.Branches = append(event.Branches, change.New.Name)
+		}
+	}
+	return event, nil
+}
+
+func parseBitbucketServerPush(body []byte) (*pushEvent, error) {
+	var payload struct {
+		Repository struct {
+			Links struct {
+				Clone []struct {
+					Href string `json:"href"`
+				} `json:"clone"`
+				Self []struct {
+					Href string `json:"href"`
+				} `json:"self"`
+			} `json:"links"`
+		} `json:"repository"`
+		Changes []struct {
+			Ref struct {
+				DisplayId string `json:"displayId"`
+				Type      string `json:"type"`
+			} `json:"ref"`
+			Type string `json:"type"`
+		} `json:"changes"`
+	}
+	err := json.Unmarshal(body, &payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Bitbucket push event: %w", err)
+	}
+	event := &pushEvent{}
+	for _, link := range payload.Repository.Links.Clone {
+		event.Urls = append(event.Urls, link.Href)
+	}
+	for _, link := range payload.Repository.Links.Self {
+		// the web url of a repository is its browse url without the trailing /browse
+		event.Urls = append(event.Urls, strings.TrimSuffix(link.Href, "/browse"))
+	}
+	for _, change := range payload.Changes {
+		if change.Ref.Type == "BRANCH" && change.Type != "DELETE" {
+			event.Branches = append(event.Branches, change.Ref.DisplayId)
+		}
+	}
+	return event, nil
+}
+
+// normalizeRepoUrl returns a url identifying a repository regardless of how it is accessed, by removing the scheme,
+// credentials, port, and .git suffix, e.g. both https://github.com/my-org/my-repo.git and git@github.com:my-org/my-repo
+// are normalized to github.com/my-org/my-repo. Returns an empty string for an empty url.
+func normalizeRepoUrl(rawUrl string) string {
+	rawUrl = strings.TrimSpace(rawUrl)
+	if rawUrl == "" {
+		return ""
+	}
+	if !strings.Contains(rawUrl, "://") {
+		// scp-like ssh urls, e.g. git@github.com:my-org/my-repo.git
+		if i := strings.Index(rawUrl, ":"); i > 0 {
+			rawUrl = "ssh://" + rawUrl[:i] + "/" + rawUrl[i+1:]
+		}
+	}
+	host, path := rawUrl, ""
+	if u, err := url.Parse(rawUrl); err == nil && u.Host != "" {
+		host, path = u.Hostname(), u.Path
+	}
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	return strings.ToLower(host + "/" + path)
+}
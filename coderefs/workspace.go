@@ -0,0 +1,217 @@
+package coderefs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+	"github.com/launchdarkly/ld-find-code-refs/search"
+)
+
+// scanCache shares flag keys, generated aliases, and content caches between concurrent scans of multiple repositories.
+// A nil scanCache disables caching.
+type scanCache struct {
+	mu       sync.Mutex
+	flags    map[string]*cachedFlags
+	aliases  map[string]cachedAliases
+	contents map[string]*search.ContentCache
+}
+
+type cachedFlags struct {
+	once  sync.Once
+	flags []string
+	err   error
+}
+
+type cachedAliases struct {
+	aliases map[string][]string
+	rules   aliasRules
+}
+
+func newScanCache() *scanCache {
+	return &scanCache{flags: map[string]*cachedFlags{}, aliases: map[string]cachedAliases{}, contents: map[string]*search.ContentCache{}}
+}
+
+// openContentCache opens the content cache stored in dir once, and shares it with all scans using the same directory,
+// so concurrent scans do not overwrite each other's entries
+func (c *scanCache) openContentCache(dir string) (*search.ContentCache, error) {
+	if c == nil {
+		return search.OpenContentCache(dir)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached, ok := c.contents[dir]; ok {
+		return cached, nil
+	}
+	contents, err := search.OpenContentCache(dir)
+	if err != nil {
+		return nil, err
+	}
+	c.contents[dir] = contents
+	return contents, nil
+}
+
+// getFlags retrieves flag keys for the client's project once, and shares them with all scans of the same project
+func (c *scanCache) getFlags(opts options.Options, ldApi ld.ApiClient) ([]string, error) {
+	if c == nil {
+		return getFlags(opts, ldApi)
+	}
+	key := ldApi.Options.BaseUri + "/" + ldApi.Options.ProjKey
+	c.mu.Lock()
+	entry, ok := c.flags[key]
+	if !ok {
+		entry = &cachedFlags{}
+		c.flags[key] = entry
+	}
+	c.mu.Unlock()
+
+	entry.once.Do(func() {
+		entry.flags, entry.err = getFlags(opts, ldApi)
+	})
+	return append([]string{}, entry.flags...), entry.err
+}
+
+// generateAliases shares generated aliases between scans with the same alias configuration. Aliases which depend on
+// the contents of the repository, i.e. filepattern and command aliases, or aliases loaded from alias sources, are not shared.
+func (c *scanCache) generateAliases(opts options.Options, flags []string, dir string) (map[string][]string, aliasRules, error) {
+	if c == nil || len(opts.AliasSources) > 0 {
+		return generateAliases(opts, flags, dir)
+	}
+	for _, a := range opts.Aliases {
+		switch a.Type.Canonical() {
+		case options.FilePattern, options.Command:
+			return generateAliases(opts, flags, dir)
+		}
+	}
+
+	keyBytes, err := json.Marshal(struct {
+		ProjKey         string
+		Aliases         []options.Alias
+		AliasCollisions options.AliasCollisionPolicy
+	}{opts.ProjKey, opts.Aliases, opts.AliasCollisions})
+	if err != nil {
+		return generateAliases(opts, flags, dir)
+	}
+	key := string(keyBytes)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached, ok := c.aliases[key]; ok {
+		return cached.aliases, cached.rules, nil
+	}
+	aliases, rules, err := generateAliases(opts, flags, dir)
+	if err != nil {
+		return nil, aliasRules{}, err
+	}
+	c.aliases[key] = cachedAliases{aliases: aliases, rules: rules}
+	return aliases, rules, nil
+}
+
+// ScanWorkspace scans multiple repositories concurrently, sharing flag keys and aliases between scans. Options for each
+// repository are the base options, overridden by the repository's workspace entry and YAML-only options configured in
+// the repository's .launchdarkly/coderefs.yaml. A failure to scan one repository does not stop other scans.
+func ScanWorkspace(base options.Options, repos []options.WorkspaceRepo, concurrency int) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	applyResourceLimits(base)
+	addCredentialEnv(repos)
+	cache := newScanCache()
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	failed := []string{}
+
+	for _, repo := range repos {
+		repo := repo
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			err := scanWorkspaceRepo(base, repo, cache)
+			if err != nil {
+				log.Error.Printf("failed to scan repository %s: %s", repo.RepoName, err)
+				mu.Lock()
+				failed = append(failed, repo.RepoName)
+				mu.Unlock()
+				return
+			}
+			log.Info.Printf("finished scanning repository %s", repo.RepoName)
+		}()
+	}
+	wg.Wait()
+
+	if len(failed) > 0 {
+		return &scanFailures{Kind: "repositories", Failed: failed, Total: len(repos)}
+	}
+	return nil
+}
+
+// Exit codes of commands, so schedulers such as Kubernetes can tell a scan of some repositories which failed from a
+// misconfigured command
+const (
+	// ExitError is the exit code of a command which failed before scanning, e.g. because of invalid options
+	ExitError = 1
+	// ExitPartialFailure is the exit code of a command which failed to scan some of its repositories
+	ExitPartialFailure = 2
+	// ExitFailure is the exit code of a command which failed to scan every repository
+	ExitFailure = 3
+)
+
+// scanFailures is returned when scans of some of the repositories or branches scanned by a command fail
+type scanFailures struct {
+	// Kind is what was scanned, e.g. "repositories" or "branches"
+	Kind string
+	// Failed are the names of the repositories or branches which could not be scanned
+	Failed []string
+	Total  int
+}
+
+func (e *scanFailures) Error() string {
+	return fmt.Sprintf("failed to scan %d of %d %s: %v", len(e.Failed), e.Total, e.Kind, e.Failed)
+}
+
+// ExitCode returns ExitFailure if every scan failed, and ExitPartialFailure otherwise
+func (e *scanFailures) ExitCode() int {
+	if len(e.Failed) >= e.Total {
+		return ExitFailure
+	}
+	return ExitPartialFailure
+}
+
+// ExitCode returns the exit code of a command which returned err
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var coded interface{ ExitCode() int }
+	if errors.As(err, &coded) {
+		return coded.ExitCode()
+	}
+	return ExitError
+}
+
+func scanWorkspaceRepo(base options.Options, repo options.WorkspaceRepo, cache *scanCache) error {
+	opts, err := repo.Options(base)
+	if err != nil {
+		return err
+	}
+	err = opts.Validate()
+	if err != nil {
+		return err
+	}
+	log.Info.Printf("scanning repository %s in %s", opts.RepoName, opts.Dir)
+	err = scan(opts, cache, nil)
+	if err == errServiceErrorIgnored {
+		log.Warning.Printf("skipped repository %s after an ignored service error", opts.RepoName)
+		return nil
+	}
+	return err
+}
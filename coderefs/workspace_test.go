@@ -0,0 +1,44 @@
+package coderefs
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/options"
+)
+
+func Test_scanCache_generateAliases(t *testing.T) {
+	cache := newScanCache()
+	opts := options.Options{ProjKey: "default", Aliases: []options.Alias{{Type: options.CamelCase}}}
+
+	aliases, _, err := cache.generateAliases(opts, []string{"some-flag"}, "")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"some-flag": {"someFlag"}}, aliases)
+	assert.Len(t, cache.aliases, 1)
+
+	// aliases are shared between scans with the same configuration
+	aliases, _, err = cache.generateAliases(opts, []string{"some-flag"}, "other")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"some-flag": {"someFlag"}}, aliases)
+	assert.Len(t, cache.aliases, 1)
+
+	// aliases depending on repository contents are not shared
+	opts.Aliases = append(opts.Aliases, options.Alias{Type: options.FilePattern, Paths: []string{"*.go"}, Patterns: []string{"(\\w+) = FLAG_KEY"}})
+	_, _, err = cache.generateAliases(opts, []string{"some-flag"}, "")
+	require.NoError(t, err)
+	assert.Len(t, cache.aliases, 1)
+}
+
+func TestExitCode(t *testing.T) {
+	assert.Equal(t, 0, ExitCode(nil))
+	assert.Equal(t, ExitError, ExitCode(errors.New("invalid options")))
+	assert.Equal(t, ExitPartialFailure, ExitCode(&scanFailures{Kind: "repositories", Failed: []string{"a"}, Total: 2}))
+	assert.Equal(t, ExitFailure, ExitCode(&scanFailures{Kind: "repositories", Failed: []string{"a", "b"}, Total: 2}))
+	assert.Equal(t, ExitFailure, ExitCode(fmt.Errorf("discover: %w", &scanFailures{Kind: "repositories", Failed: []string{"a"}, Total: 1})))
+	assert.EqualError(t, &scanFailures{Kind: "repositories", Failed: []string{"a"}, Total: 2}, "failed to scan 1 of 2 repositories: [a]")
+	assert.EqualError(t, &scanFailures{Kind: "branches", Failed: []string{"main"}, Total: 3}, "failed to scan 1 of 3 branches: [main]")
+}
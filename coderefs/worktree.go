@@ -0,0 +1,154 @@
+package coderefs
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/git"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	"github.com/launchdarkly/ld-find-code-refs/internal/validation"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+)
+
+// withBranchWorktree checks out a branch of the repository in opts.Dir in a temporary worktree, and returns options
+// scanning the worktree as the branch. The checkout in opts.Dir is not modified. The returned function removes the
+// worktree, and must be called once the scan has finished.
+func withBranchWorktree(opts options.Options, branch string) (options.Options, func(), error) {
+	absPath, err := validation.NormalizeAndValidatePath(opts.Dir)
+	if err != nil {
+		return opts, nil, fmt.Errorf("could not validate directory option: %s", err)
+	}
+	client, err := git.OpenClient(absPath)
+	if err != nil {
+		return opts, nil, err
+	}
+	log.Info.Printf("checking out branch %s in a temporary worktree", branch)
+	dir, err := client.AddWorktree(branch)
+	if err != nil {
+		return opts, nil, err
+	}
+	remove := func() {
+		err := client.RemoveWorktree(dir)
+		if err != nil {
+			log.Warning.Printf("unable to remove temporary worktree of branch %s: %s", branch, err)
+		}
+	}
+	opts.Dir = dir
+	opts.Branch = branch
+	return opts, remove, nil
+}
+
+// scanBranches scans each branch of the branches option in its own temporary worktree, one branch at a time, sharing
+// flag keys, aliases, and cached file contents between scans. A failure to scan one branch does not stop other scans.
+func scanBranches(opts options.Options) error {
+	absPath, err := validation.NormalizeAndValidatePath(opts.Dir)
+	if err != nil {
+		return fmt.Errorf("could not validate directory option: %s", err)
+	}
+	client, err := git.OpenClient(absPath)
+	if err != nil {
+		return err
+	}
+	patterns := splitBranches(opts.Branches)
+	remote := map[string]bool{}
+	if hasBranchPattern(patterns) {
+		remote, err = client.RemoteBranches()
+		if err != nil {
+			return fmt.Errorf("unable to list branches on origin: %s", strings.TrimSpace(err.Error()))
+		}
+	}
+	branches := resolveBranches(patterns, remote)
+	if len(branches) == 0 {
+		return fmt.Errorf(`no branches on origin match "branches" option %q`, opts.Branches)
+	}
+	log.Info.Printf("scanning %d branches: %s", len(branches), strings.Join(branches, ", "))
+
+	cache := newScanCache()
+	failed := []string{}
+	for _, branch := range branches {
+		err := scanBranch(opts, branch, cache)
+		if err != nil {
+			log.Error.Printf("failed to scan branch %s: %s", branch, err)
+			failed = append(failed, branch)
+			continue
+		}
+		log.Info.Printf("finished scanning branch %s", branch)
+	}
+	if len(failed) > 0 {
+		return &scanFailures{Kind: "branches", Failed: failed, Total: len(branches)}
+	}
+	return nil
+}
+
+func scanBranch(opts options.Options, branch string, cache *scanCache) error {
+	opts.Branches = ""
+	branchOpts, remove, err := withBranchWorktree(opts, branch)
+	if err != nil {
+		return err
+	}
+	defer remove()
+	err = scan(branchOpts, cache, nil)
+	if err == errServiceErrorIgnored {
+		log.Warning.Printf("skipped branch %s after an ignored service error", branch)
+		return nil
+	}
+	return err
+}
+
+func splitBranches(value string) []string {
+	ret := []string{}
+	for _, branch := range strings.Split(value, ",") {
+		branch = strings.TrimSpace(branch)
+		if branch != "" {
+			ret = append(ret, branch)
+		}
+	}
+	return ret
+}
+
+func hasBranchPattern(patterns []string) bool {
+	for _, p := range patterns {
+		if strings.ContainsAny(p, "*?[") {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveBranches returns the branches named by patterns, in the order they are listed. Patterns containing wildcards
+// are replaced by the matching branches on the remote, sorted by name. Each branch is only returned once.
+func resolveBranches(patterns []string, remote map[string]bool) []string {
+	remoteNames := make([]string, 0, len(remote))
+	for name := range remote {
+		remoteNames = append(remoteNames, name)
+	}
+	sort.Strings(remoteNames)
+
+	seen := map[string]bool{}
+	ret := []string{}
+	add := func(branch string) {
+		if !seen[branch] {
+			seen[branch] = true
+			ret = append(ret, branch)
+		}
+	}
+	for _, pattern := range patterns {
+		if !hasBranchPattern([]string{pattern}) {
+			add(pattern)
+			continue
+		}
+		matched := false
+		for _, name := range remoteNames {
+			if ok, _ := path.Match(pattern, name); ok {
+				matched = true
+				add(name)
+			}
+		}
+		if !matched {
+			log.Warning.Printf("no branches on origin match %q", pattern)
+		}
+	}
+	return ret
+}
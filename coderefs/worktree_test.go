@@ -0,0 +1,31 @@
+package coderefs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_resolveBranches(t *testing.T) {
+	remote := map[string]bool{"main": true, "release/2.0": true, "release/1.0": true, "release/1.0/hotfix": true, "feature": true}
+	specs := []struct {
+		name     string
+		patterns []string
+		expected []string
+	}{
+		{name: "names", patterns: []string{"main", "not-on-origin"}, expected: []string{"main", "not-on-origin"}},
+		{name: "wildcards are sorted", patterns: []string{"main", "release/*"}, expected: []string{"main", "release/1.0", "release/2.0"}},
+		{name: "duplicates", patterns: []string{"release/2.0", "release/*", "main", "main"}, expected: []string{"release/2.0", "release/1.0", "main"}},
+		{name: "no matches", patterns: []string{"hotfix/*"}, expected: []string{}},
+	}
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, resolveBranches(tt.patterns, remote))
+		})
+	}
+}
+
+func Test_splitBranches(t *testing.T) {
+	assert.Equal(t, []string{"main", "release/*"}, splitBranches(" main, ,release/* "))
+	assert.Equal(t, []string{}, splitBranches(""))
+}
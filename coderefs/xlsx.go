@@ -0,0 +1,141 @@
+package coderefs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	"github.com/launchdarkly/ld-find-code-refs/internal/validation"
+	"github.com/launchdarkly/ld-find-code-refs/internal/xlsx"
+	"github.com/launchdarkly/ld-find-code-refs/options"
+)
+
+const (
+	xlsxAllSheet      = "All references"
+	xlsxUntaggedSheet = "Untagged"
+)
+
+var xlsxHeader = []string{"Flag", "Path", "Line", "Lines", "Aliases", "Link"}
+
+// writeXLSX writes the code references of a branch to an Excel workbook in outDir, with a sheet of every reference,
+// followed by a sheet of the references to the flags with each tag. Returns the path of the workbook, or an empty string
+// if it could not be written.
+func writeXLSX(opts options.Options, ldApi ld.ApiClient, repoParams ld.RepoParams, outDir, projKey, revision string, branch ld.BranchRep) string {
+	absPath, err := validation.NormalizeAndValidatePath(outDir)
+	if err != nil {
+		log.Warning.Printf("invalid outDir '%s', skipping Excel workbook: %s", outDir, err)
+		return ""
+	}
+	wb := xlsxWorkbook(branch, flagTags(opts, ldApi), repoParams, revision)
+	path := filepath.Join(absPath, fmt.Sprintf("coderefs_%s_%s_%s.xlsx", projKey, repoParams.Name, branch.FileTag(revision)))
+	/* #nosec */
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Warning.Printf("unable to write Excel workbook: %s", err)
+		return ""
+	}
+	err = xlsx.Write(f, wb)
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Warning.Printf("unable to write Excel workbook: %s", err)
+		return ""
+	}
+	log.Info.Printf("wrote code references to Excel workbook %s", path)
+	return path
+}
+
+// xlsxWorkbook returns a workbook with a sheet of every reference, followed by a sheet for each flag tag in alphabetical
+// order, and a sheet of references to flags without tags. Flags with several tags are included in the sheet of each tag.
+// Tag sheets are omitted if no flags have tags.
+func xlsxWorkbook(branch ld.BranchRep, tags map[string][]string, repoParams ld.RepoParams, revision string) xlsx.Workbook {
+	all := [][]xlsx.Cell{}
+	byTag := map[string][][]xlsx.Cell{}
+	for _, ref := range branch.References {
+		for _, hunk := range ref.Hunks {
+			row := xlsxRow(ref.Path, hunk, repoParams, revision)
+			all = append(all, row)
+			if len(tags) == 0 {
+				continue
+			}
+			flagTags := tags[hunk.FlagKey]
+			if len(flagTags) == 0 {
+				flagTags = []string{""}
+			}
+			for _, tag := range flagTags {
+				byTag[tag] = append(byTag[tag], row)
+			}
+		}
+	}
+
+	names := sheetNames{}
+	sheets := []xlsx.Sheet{{Name: names.add(xlsxAllSheet), Header: xlsxHeader, Rows: sortXLSXRows(all)}}
+	sortedTags := make([]string, 0, len(byTag))
+	for tag := range byTag {
+		if tag != "" {
+			sortedTags = append(sortedTags, tag)
+		}
+	}
+	sort.Strings(sortedTags)
+	for _, tag := range sortedTags {
+		sheets = append(sheets, xlsx.Sheet{Name: names.add(tag), Header: xlsxHeader, Rows: sortXLSXRows(byTag[tag])})
+	}
+	if untagged, ok := byTag[""]; ok {
+		sheets = append(sheets, xlsx.Sheet{Name: names.add(xlsxUntaggedSheet), Header: xlsxHeader, Rows: sortXLSXRows(untagged)})
+	}
+	return xlsx.Workbook{Sheets: sheets}
+}
+
+func xlsxRow(path string, hunk ld.HunkRep, repoParams ld.RepoParams, revision string) []xlsx.Cell {
+	link := xlsx.Text("")
+	if u := hunkUrl(repoParams, revision, path, hunk.StartingLineNumber); u != "" {
+		link = xlsx.Link(fmt.Sprintf("%s:%d", path, hunk.StartingLineNumber), u)
+	}
+	return []xlsx.Cell{
+		xlsx.Text(hunk.FlagKey),
+		xlsx.Text(path),
+		xlsx.Number(hunk.StartingLineNumber),
+		xlsx.Text(hunk.Lines),
+		xlsx.Text(strings.Join(hunk.Aliases, " ")),
+		link,
+	}
+}
+
+// sortXLSXRows sorts rows by flag key, path, and line number, like the CSV output
+func sortXLSXRows(rows [][]xlsx.Cell) [][]xlsx.Cell {
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if a[0].Text != b[0].Text {
+			return a[0].Text < b[0].Text
+		}
+		if a[1].Text != b[1].Text {
+			return a[1].Text < b[1].Text
+		}
+		return *a[2].Number < *b[2].Number
+	})
+	return rows
+}
+
+// sheetNames assigns unique, valid sheet names
+type sheetNames map[string]bool
+
+func (n sheetNames) add(name string) string {
+	name = xlsx.SheetName(name)
+	unique := name
+	for i := 2; n[strings.ToLower(unique)]; i++ {
+		suffix := fmt.Sprintf(" (%d)", i)
+		runes := []rune(name)
+		if len(runes)+len(suffix) > xlsx.MaxSheetNameLength {
+			runes = runes[:xlsx.MaxSheetNameLength-len(suffix)]
+		}
+		unique = string(runes) + suffix
+	}
+	n[strings.ToLower(unique)] = true
+	return unique
+}
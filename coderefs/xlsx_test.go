@@ -0,0 +1,55 @@
+package coderefs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/xlsx"
+)
+
+func Test_xlsxWorkbook(t *testing.T) {
+	branch := ld.BranchRep{References: []ld.ReferenceHunksRep{
+		{Path: "b.go", Hunks: []ld.HunkRep{{FlagKey: "flag2", StartingLineNumber: 3}, {FlagKey: "flag1", StartingLineNumber: 10}}},
+		{Path: "a.go", Hunks: []ld.HunkRep{{FlagKey: "flag1", StartingLineNumber: 2}}},
+	}}
+	repoParams := ld.RepoParams{Type: "github", Url: "https://github.com/launchdarkly/example"}
+	sheetRows := func(s xlsx.Sheet) []string {
+		ret := []string{}
+		for _, row := range s.Rows {
+			ret = append(ret, row[5].Text)
+		}
+		return ret
+	}
+
+	t.Run("without tags", func(t *testing.T) {
+		wb := xlsxWorkbook(branch, nil, repoParams, "abc")
+		require.Len(t, wb.Sheets, 1)
+		assert.Equal(t, xlsxAllSheet, wb.Sheets[0].Name)
+		assert.Equal(t, []string{"a.go:2", "b.go:10", "b.go:3"}, sheetRows(wb.Sheets[0]))
+		assert.Equal(t, "https://github.com/launchdarkly/example/blob/abc/a.go#L2", wb.Sheets[0].Rows[0][5].Link)
+	})
+
+	t.Run("with tags", func(t *testing.T) {
+		wb := xlsxWorkbook(branch, map[string][]string{"flag1": {"team-b", "team-a"}}, repoParams, "abc")
+		require.Len(t, wb.Sheets, 4)
+		names := []string{}
+		for _, s := range wb.Sheets {
+			names = append(names, s.Name)
+		}
+		assert.Equal(t, []string{xlsxAllSheet, "team-a", "team-b", xlsxUntaggedSheet}, names)
+		assert.Equal(t, []string{"a.go:2", "b.go:10"}, sheetRows(wb.Sheets[1]))
+		assert.Equal(t, []string{"b.go:3"}, sheetRows(wb.Sheets[3]))
+	})
+}
+
+func Test_sheetNames(t *testing.T) {
+	names := sheetNames{}
+	assert.Equal(t, "team", names.add("team"))
+	assert.Equal(t, "Team (2)", names.add("Team"))
+	assert.Equal(t, "team_a", names.add("team/a"))
+	assert.Equal(t, "abcdefghijklmnopqrstuvwxyz01234", names.add("abcdefghijklmnopqrstuvwxyz0123456789"))
+	assert.Equal(t, "abcdefghijklmnopqrstuvwxyz0 (2)", names.add("abcdefghijklmnopqrstuvwxyz0123456789"))
+}
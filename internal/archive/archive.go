@@ -0,0 +1,204 @@
+// Package archive extracts source snapshots packaged as tar or zip archives, so release artifacts can be scanned without
+// a checkout. Entries which would be written outside the destination directory are rejected, and links are skipped.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+)
+
+// MaxExtractedSize is the maximum total size in bytes of the files extracted from an archive, to protect against
+// archives which expand to exhaust the disk
+const MaxExtractedSize = 4 << 30
+
+// IsArchive returns true if the path has the extension of a supported archive format
+func IsArchive(path string) bool {
+	return format(path) != ""
+}
+
+func format(path string) string {
+	name := strings.ToLower(path)
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar", ".zip"} {
+		if strings.HasSuffix(name, ext) {
+			return ext
+		}
+	}
+	return ""
+}
+
+// Extract writes the files in a tar, gzip compressed tar, or zip archive to dir, and returns the root of the extracted
+// snapshot. If every file in the archive is in a single top-level directory, as in archives of a repository downloaded
+// from GitHub or GitLab, the root is that directory, so that paths are relative to the root of the repository.
+func Extract(archivePath, dir string) (string, error) {
+	var err error
+	switch format(archivePath) {
+	case ".zip":
+		err = extractZip(archivePath, dir)
+	case ".tar.gz", ".tgz":
+		err = extractTar(archivePath, dir, true)
+	case ".tar":
+		err = extractTar(archivePath, dir, false)
+	default:
+		return "", fmt.Errorf("unsupported archive format: %s, must be a .tar, .tar.gz, .tgz, or .zip file", archivePath)
+	}
+	if err != nil {
+		return "", err
+	}
+	return snapshotRoot(dir)
+}
+
+// snapshotRoot returns the single top-level directory of the extracted files, if there is one, or dir
+func snapshotRoot(dir string) (string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 1 && entries[0].IsDir() {
+		return filepath.Join(dir, entries[0].Name()), nil
+	}
+	return dir, nil
+}
+
+// extractor writes the entries of an archive to a directory
+type extractor struct {
+	dir     string
+	written int64
+}
+
+// target returns the path an entry is extracted to. Absolute paths, and paths containing '..' elements, are rejected.
+func (e *extractor) target(name string) (string, error) {
+	name = strings.TrimPrefix(strings.Replace(name, `\`, "/", -1), "./")
+	if path.IsAbs(name) || filepath.IsAbs(filepath.FromSlash(name)) || filepath.VolumeName(filepath.FromSlash(name)) != "" {
+		return "", fmt.Errorf("archive entry has an absolute path: %s", name)
+	}
+	for _, element := range strings.Split(name, "/") {
+		if element == ".." {
+			return "", fmt.Errorf("archive entry is outside the archive root: %s", name)
+		}
+	}
+	return filepath.Join(e.dir, filepath.FromSlash(path.Clean(name))), nil
+}
+
+func (e *extractor) mkdir(name string) error {
+	target, err := e.target(name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(target, 0750)
+}
+
+func (e *extractor) writeFile(name string, r io.Reader) error {
+	target, err := e.target(name)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(target), 0750)
+	if err != nil {
+		return err
+	}
+	/* #nosec */
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0640)
+	if err != nil {
+		return err
+	}
+	// read one byte past the limit, to detect archives which exceed it
+	n, err := io.Copy(f, io.LimitReader(r, MaxExtractedSize-e.written+1))
+	closeErr := f.Close()
+	if err != nil {
+		return err
+	}
+	e.written += n
+	if e.written > MaxExtractedSize {
+		return fmt.Errorf("archive contents exceed the maximum extracted size of %d GB", MaxExtractedSize>>30)
+	}
+	return closeErr
+}
+
+func extractZip(archivePath, dir string) error {
+	r, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return fmt.Errorf("unable to read zip archive: %w", err)
+	}
+	defer r.Close()
+
+	e := extractor{dir: dir}
+	for _, f := range r.File {
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			err = e.mkdir(f.Name)
+		case mode.IsRegular():
+			err = extractZipFile(&e, f)
+		default:
+			log.Debug.Printf("skipping archive entry %s: not a regular file or directory", f.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractZipFile(e *extractor, f *zip.File) error {
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("unable to read %s from zip archive: %w", f.Name, err)
+	}
+	defer rc.Close()
+	return e.writeFile(f.Name, rc)
+}
+
+func extractTar(archivePath, dir string, compressed bool) error {
+	/* #nosec */
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if compressed {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("unable to read gzip compressed archive: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	e := extractor{dir: dir}
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("unable to read tar archive: %w", err)
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = e.mkdir(header.Name)
+		case tar.TypeReg, tar.TypeRegA:
+			err = e.writeFile(header.Name, tr)
+		case tar.TypeXGlobalHeader:
+			// e.g. the commit id recorded by git archive
+		default:
+			log.Debug.Printf("skipping archive entry %s: not a regular file or directory", header.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
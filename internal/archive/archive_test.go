@@ -0,0 +1,137 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+)
+
+func TestMain(m *testing.M) {
+	log.Init(true)
+	os.Exit(m.Run())
+}
+
+type entry struct {
+	name     string
+	contents string
+	link     bool
+}
+
+func writeTar(t *testing.T, path string, compressed bool, entries []entry) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Typeflag: tar.TypeXGlobalHeader, Name: "pax_global_header", PAXRecords: map[string]string{"comment": "0123456789abcdef"}}))
+	for _, e := range entries {
+		if e.link {
+			require.NoError(t, tw.WriteHeader(&tar.Header{Typeflag: tar.TypeSymlink, Name: e.name, Linkname: e.contents}))
+			continue
+		}
+		require.NoError(t, tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: e.name, Mode: 0600, Size: int64(len(e.contents))}))
+		_, err := tw.Write([]byte(e.contents))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+
+	data := buf.Bytes()
+	if compressed {
+		var gz bytes.Buffer
+		w := gzip.NewWriter(&gz)
+		_, err := w.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		data = gz.Bytes()
+	}
+	require.NoError(t, ioutil.WriteFile(path, data, 0600))
+}
+
+func writeZip(t *testing.T, path string, entries []entry) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		w, err := zw.Create(e.name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(e.contents))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	require.NoError(t, ioutil.WriteFile(path, buf.Bytes(), 0600))
+}
+
+func TestExtract(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	snapshot := []entry{
+		{name: "my-repo-0123456/src/app.js", contents: "client.variation('my-flag')"},
+		{name: "my-repo-0123456/README.md", contents: "# my-repo"},
+		{name: "my-repo-0123456/link", contents: "/etc/passwd", link: true},
+	}
+	writeTar(t, filepath.Join(dir, "snapshot.tar.gz"), true, snapshot)
+	writeTar(t, filepath.Join(dir, "snapshot.tar"), false, snapshot)
+	writeZip(t, filepath.Join(dir, "snapshot.zip"), snapshot[:2])
+
+	for _, name := range []string{"snapshot.tar.gz", "snapshot.tar", "snapshot.zip"} {
+		t.Run(name, func(t *testing.T) {
+			out := filepath.Join(dir, name+"-out")
+			require.NoError(t, os.Mkdir(out, 0750))
+			root, err := Extract(filepath.Join(dir, name), out)
+			require.NoError(t, err)
+			assert.Equal(t, filepath.Join(out, "my-repo-0123456"), root, "the single top-level directory is the root of the snapshot")
+
+			data, err := ioutil.ReadFile(filepath.Join(root, "src", "app.js"))
+			require.NoError(t, err)
+			assert.Equal(t, "client.variation('my-flag')", string(data))
+			_, err = os.Lstat(filepath.Join(root, "link"))
+			assert.True(t, os.IsNotExist(err), "links are not extracted")
+		})
+	}
+}
+
+func TestExtract_multipleTopLevelEntries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	writeZip(t, filepath.Join(dir, "snapshot.zip"), []entry{{name: "src/app.js"}, {name: "README.md"}})
+	root, err := Extract(filepath.Join(dir, "snapshot.zip"), dir)
+	require.NoError(t, err)
+	assert.Equal(t, dir, root)
+}
+
+func TestExtract_unsafePaths(t *testing.T) {
+	for _, name := range []string{"../evil.js", "src/../../evil.js", "/etc/evil.js"} {
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "archive")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			out := filepath.Join(dir, "out")
+			require.NoError(t, os.Mkdir(out, 0750))
+			writeTar(t, filepath.Join(dir, "snapshot.tgz"), true, []entry{{name: name, contents: "evil"}})
+			_, err = Extract(filepath.Join(dir, "snapshot.tgz"), out)
+			assert.Error(t, err)
+			_, err = os.Stat(filepath.Join(dir, "evil.js"))
+			assert.True(t, os.IsNotExist(err))
+		})
+	}
+}
+
+func TestIsArchive(t *testing.T) {
+	assert.True(t, IsArchive("release.tar.gz"))
+	assert.True(t, IsArchive("release.TGZ"))
+	assert.True(t, IsArchive("release.tar"))
+	assert.True(t, IsArchive("release.zip"))
+	assert.False(t, IsArchive("release.rar"))
+	assert.False(t, IsArchive("release"))
+}
@@ -0,0 +1,314 @@
+// Package bench synthesizes repositories for benchmarking code reference searches, and measures the performance of
+// different matcher configurations against them.
+package bench
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/iancoleman/strcase"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/search"
+)
+
+// FlagsFile is the path of the file listing flag keys in a generated fixture, relative to the fixture directory.
+// It is hidden, so it is not searched.
+const FlagsFile = ".bench/flags.txt"
+
+const filesPerDir = 100
+
+var words = []string{"user", "config", "result", "value", "handler", "request", "response", "context", "error", "index", "count", "client", "options"}
+
+// FixtureOptions configures a synthesized repository
+type FixtureOptions struct {
+	Files        int
+	LinesPerFile int
+	// LineLength is the approximate number of characters in each line
+	LineLength int
+	Flags      int
+	// Density is the fraction of lines containing a reference to a flag, between 0 and 1
+	Density float64
+	// Seed makes fixtures reproducible. Fixtures generated with the same options and seed are identical.
+	Seed int64
+}
+
+func (o FixtureOptions) validate() error {
+	switch {
+	case o.Files <= 0:
+		return errors.New("files must be > 0")
+	case o.LinesPerFile <= 0:
+		return errors.New("lines per file must be > 0")
+	case o.LineLength <= 0:
+		return errors.New("line length must be > 0")
+	case o.Flags <= 0:
+		return errors.New("flags must be > 0")
+	case o.Density < 0 || o.Density > 1:
+		return errors.New("density must be between 0 and 1")
+	}
+	return nil
+}
+
+// Generate writes a synthesized repository to dir, and returns the flag keys referenced in it
+func Generate(dir string, opts FixtureOptions) ([]string, error) {
+	err := opts.validate()
+	if err != nil {
+		return nil, err
+	}
+	/* #nosec */
+	r := rand.New(rand.NewSource(opts.Seed))
+
+	flags := make([]string, 0, opts.Flags)
+	for i := 0; i < opts.Flags; i++ {
+		flags = append(flags, fmt.Sprintf("%s-%s-%d", words[r.Intn(len(words))], words[r.Intn(len(words))], i))
+	}
+
+	for i := 0; i < opts.Files; i++ {
+		path := filepath.Join(dir, "src", fmt.Sprintf("pkg%03d", i/filesPerDir), fmt.Sprintf("file%05d.go", i))
+		err := os.MkdirAll(filepath.Dir(path), 0750)
+		if err != nil {
+			return nil, err
+		}
+		var sb strings.Builder
+		for j := 0; j < opts.LinesPerFile; j++ {
+			sb.WriteString(line(r, flags, opts))
+			sb.WriteByte('\n')
+		}
+		err = ioutil.WriteFile(path, []byte(sb.String()), 0600)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	flagsPath := filepath.Join(dir, FlagsFile)
+	err = os.MkdirAll(filepath.Dir(flagsPath), 0750)
+	if err != nil {
+		return nil, err
+	}
+	return flags, ioutil.WriteFile(flagsPath, []byte(strings.Join(flags, "\n")+"\n"), 0600)
+}
+
+// line returns a line of code which references a random flag with the configured density. References use a mix of
+// delimited flag keys, wrapper functions, and camel case aliases.
+func line(r *rand.Rand, flags []string, opts FixtureOptions) string {
+	var sb strings.Builder
+	if r.Float64() < opts.Density {
+		flag := flags[r.Intn(len(flags))]
+		switch r.Intn(3) {
+		case 0:
+			sb.WriteString(`enabled := client.BoolVariation("` + flag + `", user, false)`)
+		case 1:
+			sb.WriteString(`value := Flag(` + flag + `)`)
+		default:
+			sb.WriteString(`if flags.` + strcase.ToLowerCamel(flag) + ` {`)
+		}
+	}
+	for sb.Len() < opts.LineLength {
+		if sb.Len() > 0 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(words[r.Intn(len(words))])
+	}
+	return sb.String()
+}
+
+// ReadFlags returns the flag keys referenced in a generated fixture
+func ReadFlags(dir string) ([]string, error) {
+	/* #nosec */
+	data, err := ioutil.ReadFile(filepath.Join(dir, FlagsFile))
+	if err != nil {
+		return nil, fmt.Errorf("could not read flag keys, was the fixture created with the gen command?: %w", err)
+	}
+	return strings.Fields(string(data)), nil
+}
+
+// Matcher is a configuration of the search for flag references to be benchmarked
+type Matcher struct {
+	Name       string
+	Delimiters search.Delimiters
+	// Aliases generates aliases for a flag key, if set
+	Aliases func(flag string) []string
+}
+
+// Matchers are the matcher configurations which are benchmarked by default
+var Matchers = []Matcher{
+	{Name: "no-delimiters", Delimiters: search.NewDelimiters("")},
+	{Name: "default-delimiters", Delimiters: search.NewDelimiters(`"'` + "`")},
+	{Name: "delimiter-pairs", Delimiters: search.Delimiters{Pairs: []search.DelimiterPair{{Open: "Flag(", Close: ")"}}}},
+	{Name: "aliases", Delimiters: search.NewDelimiters(`"'` + "`"), Aliases: func(flag string) []string {
+		return []string{strcase.ToLowerCamel(flag)}
+	}},
+}
+
+// Backend is the implementation used to search a fixture
+type Backend string
+
+const (
+	// BackendFilesystem searches files as they are read from the workspace
+	BackendFilesystem Backend = "filesystem"
+	// BackendContents searches file contents which are already in memory, as for files excluded by a sparse checkout
+	BackendContents Backend = "contents"
+)
+
+// Backends are the search backends which are benchmarked by default
+var Backends = []Backend{BackendFilesystem, BackendContents}
+
+// Result is the performance of a matcher and search backend against a fixture
+type Result struct {
+	Backend    Backend       `json:"backend"`
+	Matcher    string        `json:"matcher"`
+	Iterations int           `json:"iterations"`
+	Duration   time.Duration `json:"duration"`
+	Files      int           `json:"files"`
+	Hunks      int           `json:"hunks"`
+}
+
+func (r Result) name() string {
+	return string(r.Backend) + "/" + r.Matcher
+}
+
+// Run searches the fixture in dir for references to flags with each backend and matcher, and returns the mean duration of each search
+func Run(dir string, flags []string, backends []Backend, matchers []Matcher, iterations int) ([]Result, error) {
+	if iterations <= 0 {
+		return nil, errors.New("iterations must be > 0")
+	}
+	results := make([]Result, 0, len(backends)*len(matchers))
+	for _, backend := range backends {
+		var contents map[string][]byte
+		switch backend {
+		case BackendFilesystem:
+		case BackendContents:
+			var err error
+			contents, err = readContents(dir)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unknown search backend: %s", backend)
+		}
+
+		for _, m := range matchers {
+			aliases := make(map[string][]string, len(flags))
+			for _, flag := range flags {
+				aliases[flag] = []string{}
+				if m.Aliases != nil {
+					aliases[flag] = m.Aliases(flag)
+				}
+			}
+
+			result := Result{Backend: backend, Matcher: m.Name, Iterations: iterations}
+			searchOpts := search.Options{
+				ProjKey:        "default",
+				Workspace:      dir,
+				Aliases:        aliases,
+				ContextLines:   search.NewContextLines(2, nil),
+				Delimiters:     m.Delimiters,
+				LineLengthUnit: search.LineLengthCharacters,
+				Symlinks:       search.SymlinkSkip,
+			}
+			var total time.Duration
+			for i := 0; i < iterations; i++ {
+				var refs []ld.ReferenceHunksRep
+				var err error
+				start := time.Now()
+				if backend == BackendContents {
+					refs = search.SearchContents(searchOpts, contents)
+				} else {
+					refs, err = search.SearchForRefs(context.Background(), searchOpts)
+				}
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", result.name(), err)
+				}
+				total += time.Since(start)
+				result.Files = len(refs)
+				result.Hunks = 0
+				for _, ref := range refs {
+					result.Hunks += len(ref.Hunks)
+				}
+			}
+			result.Duration = total / time.Duration(iterations)
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+// readContents reads all files in a fixture into memory, keyed by their path relative to dir
+func readContents(dir string) (map[string][]byte, error) {
+	contents := map[string][]byte{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		/* #nosec */
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		contents[filepath.ToSlash(rel)] = data
+		return nil
+	})
+	return contents, err
+}
+
+// ReadResults reads results previously written by WriteResults
+func ReadResults(path string) ([]Result, error) {
+	/* #nosec */
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var results []Result
+	err = json.Unmarshal(data, &results)
+	return results, err
+}
+
+// WriteResults writes results as JSON, so they may be compared with later runs
+func WriteResults(path string, results []Result) error {
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// PrintResults writes a table of results. If baseline results are provided, the change in duration of each matcher is
+// included, and the names of backend and matcher combinations which are slower than the baseline by more than threshold (e.g. 0.1 for 10%) are returned.
+func PrintResults(out io.Writer, results, baseline []Result, threshold float64) []string {
+	previous := make(map[string]Result, len(baseline))
+	for _, r := range baseline {
+		previous[r.name()] = r
+	}
+
+	regressions := []string{}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "BACKEND\tMATCHER\tDURATION\tFILES\tHUNKS\tCHANGE")
+	for _, r := range results {
+		change := "-"
+		if p, ok := previous[r.name()]; ok && p.Duration > 0 {
+			delta := float64(r.Duration-p.Duration) / float64(p.Duration)
+			change = fmt.Sprintf("%+.1f%%", delta*100)
+			if delta > threshold {
+				change += " REGRESSION"
+				regressions = append(regressions, r.name())
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\n", r.Backend, r.Matcher, r.Duration.Round(time.Microsecond), r.Files, r.Hunks, change)
+	}
+	w.Flush()
+	return regressions
+}
@@ -0,0 +1,120 @@
+package bench
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+)
+
+func TestMain(m *testing.M) {
+	log.Init(true)
+	os.Exit(m.Run())
+}
+
+var testFixture = FixtureOptions{Files: 20, LinesPerFile: 50, LineLength: 60, Flags: 10, Density: 0.1, Seed: 1}
+
+func generateFixture(t testing.TB) (string, []string) {
+	dir, err := ioutil.TempDir("", "bench")
+	require.NoError(t, err)
+	flags, err := Generate(dir, testFixture)
+	require.NoError(t, err)
+	return dir, flags
+}
+
+func TestGenerate(t *testing.T) {
+	dir, flags := generateFixture(t)
+	defer os.RemoveAll(dir)
+	assert.Len(t, flags, testFixture.Flags)
+
+	read, err := ReadFlags(dir)
+	require.NoError(t, err)
+	assert.Equal(t, flags, read)
+
+	contents, err := readContents(dir)
+	require.NoError(t, err)
+	assert.Len(t, contents, testFixture.Files+1, "expected generated files and the flags file")
+
+	// fixtures with the same seed are identical
+	dir2, _ := generateFixture(t)
+	defer os.RemoveAll(dir2)
+	contents2, err := readContents(dir2)
+	require.NoError(t, err)
+	assert.Equal(t, contents, contents2)
+}
+
+func TestGenerate_invalidOptions(t *testing.T) {
+	opts := testFixture
+	opts.Density = 2
+	_, err := Generate("unused", opts)
+	assert.EqualError(t, err, "density must be between 0 and 1")
+}
+
+func TestRun(t *testing.T) {
+	dir, flags := generateFixture(t)
+	defer os.RemoveAll(dir)
+
+	results, err := Run(dir, flags, Backends, Matchers, 1)
+	require.NoError(t, err)
+	require.Len(t, results, len(Backends)*len(Matchers))
+	for i, r := range results[:len(Matchers)] {
+		contentsResult := results[len(Matchers)+i]
+		assert.Greater(t, r.Hunks, 0, r.Matcher)
+		assert.Equal(t, r.Files, contentsResult.Files, "backends should find the same references with %s", r.Matcher)
+		assert.Equal(t, r.Hunks, contentsResult.Hunks, "backends should find the same references with %s", r.Matcher)
+	}
+
+	_, err = Run(dir, flags, []Backend{"unknown"}, Matchers, 1)
+	assert.Error(t, err)
+}
+
+func TestPrintResults(t *testing.T) {
+	baseline := []Result{
+		{Backend: BackendFilesystem, Matcher: "a", Duration: time.Second},
+		{Backend: BackendFilesystem, Matcher: "b", Duration: time.Second},
+	}
+	results := []Result{
+		{Backend: BackendFilesystem, Matcher: "a", Duration: 1050 * time.Millisecond},
+		{Backend: BackendFilesystem, Matcher: "b", Duration: 2 * time.Second},
+		{Backend: BackendContents, Matcher: "a", Duration: time.Second},
+	}
+	var out bytes.Buffer
+	regressions := PrintResults(&out, results, baseline, 0.1)
+	assert.Equal(t, []string{"filesystem/b"}, regressions)
+	assert.Contains(t, out.String(), "+5.0%")
+	assert.Contains(t, out.String(), "+100.0% REGRESSION")
+}
+
+func TestWriteResults(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bench")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "results.json")
+	results := []Result{{Backend: BackendContents, Matcher: "a", Iterations: 2, Duration: time.Second, Files: 1, Hunks: 2}}
+	require.NoError(t, WriteResults(path, results))
+	read, err := ReadResults(path)
+	require.NoError(t, err)
+	assert.Equal(t, results, read)
+}
+
+func BenchmarkSearch(b *testing.B) {
+	dir, flags := generateFixture(b)
+	defer os.RemoveAll(dir)
+	for _, backend := range Backends {
+		for _, m := range Matchers {
+			b.Run(string(backend)+"/"+m.Name, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					_, err := Run(dir, flags, []Backend{backend}, []Matcher{m}, 1)
+					require.NoError(b, err)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package checks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const DefaultBitbucketApiUrl = "https://api.bitbucket.org/2.0"
+
+const (
+	// bitbucketReportId identifies the Code Insights report of a commit, so each scan replaces the previous report
+	bitbucketReportId = "ld-find-code-refs"
+	// maxBitbucketAnnotations is the maximum number of annotations in a Code Insights report
+	maxBitbucketAnnotations = 1000
+	// maxBitbucketCloudAnnotationsPerRequest is the maximum number of annotations Bitbucket Cloud accepts in a single request
+	maxBitbucketCloudAnnotationsPerRequest = 100
+)
+
+// Bitbucket creates Code Insights reports in Bitbucket Cloud, or Bitbucket Server and Data Center
+type Bitbucket struct {
+	// ApiUrl is the url of the Bitbucket Cloud API, or the Code Insights API of Bitbucket Server, e.g.
+	// https://bitbucket.example.com/rest/insights/1.0
+	ApiUrl string
+	// Server is true for Bitbucket Server and Data Center
+	Server bool
+	// Repo is the workspace and slug of a Bitbucket Cloud repository, e.g. launchdarkly/ld-find-code-refs, or the project
+	// key and slug of a Bitbucket Server repository, e.g. PROJ/my-repo
+	Repo string
+	// Username is only required for Bitbucket Cloud app passwords. Other tokens are sent as bearer tokens.
+	Username string
+	Token    string
+
+	client *http.Client
+}
+
+func NewBitbucket(apiUrl string, server bool, repo, username, token string) *Bitbucket {
+	if apiUrl == "" {
+		apiUrl = DefaultBitbucketApiUrl
+	}
+	return &Bitbucket{
+		ApiUrl:   strings.TrimSuffix(apiUrl, "/"),
+		Server:   server,
+		Repo:     repo,
+		Username: username,
+		Token:    token,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+type bitbucketReport struct {
+	Title    string          `json:"title"`
+	Details  string          `json:"details"`
+	Reporter string          `json:"reporter"`
+	Type     string          `json:"report_type,omitempty"`
+	Result   string          `json:"result,omitempty"`
+	Data     []bitbucketData `json:"data"`
+}
+
+type bitbucketData struct {
+	Title string `json:"title"`
+	Type  string `json:"type"`
+	Value int    `json:"value"`
+}
+
+type bitbucketCloudAnnotation struct {
+	ExternalId string `json:"external_id"`
+	Type       string `json:"annotation_type"`
+	Path       string `json:"path"`
+	Line       int    `json:"line"`
+	Summary    string `json:"summary"`
+	Severity   string `json:"severity"`
+}
+
+type bitbucketServerAnnotation struct {
+	ExternalId string `json:"externalId"`
+	Type       string `json:"type"`
+	Path       string `json:"path"`
+	Line       int    `json:"line"`
+	Message    string `json:"message"`
+	Severity   string `json:"severity"`
+}
+
+// CreateReport replaces the Code Insights report of a commit. Reports without annotations pass, and reports with
+// annotations have no result, so they do not fail merge checks. Annotations past the maximum Bitbucket allows are omitted.
+// Returns the number of annotations added.
+func (b *Bitbucket) CreateReport(sha string, report Report) (int, error) {
+	reportUrl := b.reportUrl(sha)
+	// reports are deleted first, so annotations from a previous scan are removed
+	err := b.do("DELETE", reportUrl, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	r := bitbucketReport{Title: Name, Details: report.Details, Reporter: "LaunchDarkly", Data: []bitbucketData{}}
+	if !b.Server {
+		r.Type = "BUG"
+	}
+	if len(report.Annotations) == 0 {
+		r.Result = "PASSED"
+	}
+	for _, stat := range report.Stats {
+		r.Data = append(r.Data, bitbucketData{Title: stat.Title, Type: "NUMBER", Value: stat.Value})
+	}
+	err = b.do("PUT", reportUrl, r)
+	if err != nil {
+		return 0, err
+	}
+
+	annotations := report.Annotations
+	if len(annotations) > maxBitbucketAnnotations {
+		annotations = annotations[:maxBitbucketAnnotations]
+	}
+	if len(annotations) == 0 {
+		return 0, nil
+	}
+	if b.Server {
+		body := struct {
+			Annotations []bitbucketServerAnnotation `json:"annotations"`
+		}{}
+		for i, a := range annotations {
+			body.Annotations = append(body.Annotations, bitbucketServerAnnotation{
+				ExternalId: fmt.Sprintf("ref-%d", i),
+				Type:       "CODE_SMELL",
+				Path:       a.Path,
+				Line:       a.StartLine,
+				Message:    a.Message,
+				Severity:   "LOW",
+			})
+		}
+		return len(annotations), b.do("POST", reportUrl+"/annotations", body)
+	}
+	for start := 0; start < len(annotations); start += maxBitbucketCloudAnnotationsPerRequest {
+		end := start + maxBitbucketCloudAnnotationsPerRequest
+		if end > len(annotations) {
+			end = len(annotations)
+		}
+		batch := []bitbucketCloudAnnotation{}
+		for i, a := range annotations[start:end] {
+			batch = append(batch, bitbucketCloudAnnotation{
+				ExternalId: fmt.Sprintf("ref-%d", start+i),
+				Type:       "CODE_SMELL",
+				Path:       a.Path,
+				Line:       a.StartLine,
+				Summary:    a.Message,
+				Severity:   "LOW",
+			})
+		}
+		err = b.do("POST", reportUrl+"/annotations", batch)
+		if err != nil {
+			return start, err
+		}
+	}
+	return len(annotations), nil
+}
+
+func (b *Bitbucket) reportUrl(sha string) string {
+	if b.Server {
+		parts := strings.SplitN(b.Repo, "/", 2)
+		return fmt.Sprintf("%s/projects/%s/repos/%s/commits/%s/reports/%s", b.ApiUrl, parts[0], parts[len(parts)-1], sha, bitbucketReportId)
+	}
+	return fmt.Sprintf("%s/repositories/%s/commit/%s/reports/%s", b.ApiUrl, b.Repo, sha, bitbucketReportId)
+}
+
+func (b *Bitbucket) do(method, url string, body interface{}) error {
+	var reqBody bytes.Buffer
+	if body != nil {
+		err := json.NewEncoder(&reqBody).Encode(body)
+		if err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, url, &reqBody)
+	if err != nil {
+		return err
+	}
+	if b.Username != "" {
+		req.SetBasicAuth(b.Username, b.Token)
+	} else if b.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+b.Token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if method == "DELETE" && res.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("bitbucket responded with status code %d creating a Code Insights report for %s", res.StatusCode, b.Repo)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package checks
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testAnnotations(n int) []Annotation {
+	annotations := []Annotation{}
+	for i := 1; i <= n; i++ {
+		annotations = append(annotations, Annotation{Path: fmt.Sprintf("file%d.go", i), StartLine: i, EndLine: i + 1, Title: "title", Message: "message"})
+	}
+	return annotations
+}
+
+func TestCreateReport_cloud(t *testing.T) {
+	requests := []string{}
+	var report bitbucketReport
+	annotations := []bitbucketCloudAnnotation{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "user", user)
+		assert.Equal(t, "app-password", password)
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch r.Method {
+		case "DELETE":
+			w.WriteHeader(http.StatusNotFound)
+		case "PUT":
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&report))
+		case "POST":
+			var batch []bitbucketCloudAnnotation
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&batch))
+			annotations = append(annotations, batch...)
+		}
+	}))
+	defer server.Close()
+
+	n, err := NewBitbucket(server.URL, false, "ws/repo", "user", "app-password").CreateReport("abc123", Report{
+		Details:     "details",
+		Stats:       []Stat{{"References", 150}},
+		Annotations: testAnnotations(150),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 150, n)
+
+	reportPath := "/repositories/ws/repo/commit/abc123/reports/ld-find-code-refs"
+	assert.Equal(t, []string{"DELETE " + reportPath, "PUT " + reportPath, "POST " + reportPath + "/annotations", "POST " + reportPath + "/annotations"}, requests)
+	assert.Equal(t, bitbucketReport{Title: Name, Details: "details", Reporter: "LaunchDarkly", Type: "BUG", Data: []bitbucketData{{"References", "NUMBER", 150}}}, report)
+	require.Len(t, annotations, 150)
+	assert.Equal(t, bitbucketCloudAnnotation{ExternalId: "ref-0", Type: "CODE_SMELL", Path: "file1.go", Line: 1, Summary: "message", Severity: "LOW"}, annotations[0])
+	assert.Equal(t, "ref-149", annotations[149].ExternalId)
+}
+
+func TestCreateReport_server(t *testing.T) {
+	requests := []string{}
+	var report bitbucketReport
+	var annotations struct {
+		Annotations []bitbucketServerAnnotation `json:"annotations"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch r.Method {
+		case "DELETE":
+			w.WriteHeader(http.StatusNoContent)
+		case "PUT":
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&report))
+		case "POST":
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&annotations))
+		}
+	}))
+	defer server.Close()
+
+	n, err := NewBitbucket(server.URL, true, "PROJ/repo", "", "token").CreateReport("abc123", Report{Annotations: testAnnotations(1001)})
+	require.NoError(t, err)
+	assert.Equal(t, maxBitbucketAnnotations, n)
+
+	reportPath := "/projects/PROJ/repos/repo/commits/abc123/reports/ld-find-code-refs"
+	assert.Equal(t, []string{"DELETE " + reportPath, "PUT " + reportPath, "POST " + reportPath + "/annotations"}, requests)
+	assert.Equal(t, "", report.Type)
+	assert.Equal(t, "", report.Result, "reports with annotations have no result")
+	require.Len(t, annotations.Annotations, maxBitbucketAnnotations)
+	assert.Equal(t, bitbucketServerAnnotation{ExternalId: "ref-0", Type: "CODE_SMELL", Path: "file1.go", Line: 1, Message: "message", Severity: "LOW"}, annotations.Annotations[0])
+}
+
+func TestCreateReport_withoutAnnotations(t *testing.T) {
+	var report bitbucketReport
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NotEqual(t, "POST", r.Method, "no annotations are posted")
+		if r.Method == "PUT" {
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&report))
+		}
+	}))
+	defer server.Close()
+
+	n, err := NewBitbucket(server.URL, false, "ws/repo", "", "token").CreateReport("abc123", Report{})
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, "PASSED", report.Result)
+}
+
+func TestCreateReport_error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	_, err := NewBitbucket(server.URL, false, "ws/repo", "", "token").CreateReport("abc123", Report{})
+	assert.EqualError(t, err, "bitbucket responded with status code 401 creating a Code Insights report for ws/repo")
+}
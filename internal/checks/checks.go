@@ -0,0 +1,32 @@
+// Package checks publishes the results of a scan to the code review tools of source code hosting services, so reviewers
+// can see code reference hygiene issues alongside the changes they review.
+package checks
+
+// Name is the name results are published under
+const Name = "LaunchDarkly code references"
+
+// Report summarizes the results of a scan of a single commit
+type Report struct {
+	Title string
+	// Details is a plain text description of the results
+	Details string
+	// Summary is a markdown description of the results
+	Summary     string
+	Stats       []Stat
+	Annotations []Annotation
+}
+
+// Stat is a count of something found by a scan
+type Stat struct {
+	Title string
+	Value int
+}
+
+// Annotation is a message about a range of lines in a file
+type Annotation struct {
+	Path      string
+	StartLine int
+	EndLine   int
+	Title     string
+	Message   string
+}
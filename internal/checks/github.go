@@ -0,0 +1,136 @@
+package checks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const DefaultGitHubApiUrl = "https://api.github.com"
+
+// maxGitHubAnnotations is the maximum number of annotations GitHub accepts in a single request
+const maxGitHubAnnotations = 50
+
+// GitHub creates check runs with the GitHub Checks API
+type GitHub struct {
+	ApiUrl string
+	// Repo is the full name of the repository, e.g. launchdarkly/ld-find-code-refs
+	Repo string
+	// Token is a GitHub app installation token, such as the GITHUB_TOKEN of a GitHub Actions workflow
+	Token string
+
+	client *http.Client
+}
+
+func NewGitHub(apiUrl, repo, token string) *GitHub {
+	if apiUrl == "" {
+		apiUrl = DefaultGitHubApiUrl
+	}
+	return &GitHub{
+		ApiUrl: strings.TrimSuffix(apiUrl, "/"),
+		Repo:   repo,
+		Token:  token,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+type githubCheckRun struct {
+	Name       string               `json:"name,omitempty"`
+	HeadSha    string               `json:"head_sha,omitempty"`
+	Status     string               `json:"status,omitempty"`
+	Conclusion string               `json:"conclusion,omitempty"`
+	Output     githubCheckRunOutput `json:"output"`
+}
+
+type githubCheckRunOutput struct {
+	Title       string             `json:"title"`
+	Summary     string             `json:"summary"`
+	Annotations []githubAnnotation `json:"annotations,omitempty"`
+}
+
+type githubAnnotation struct {
+	Path            string `json:"path"`
+	StartLine       int    `json:"start_line"`
+	EndLine         int    `json:"end_line"`
+	AnnotationLevel string `json:"annotation_level"`
+	Title           string `json:"title"`
+	Message         string `json:"message"`
+}
+
+// CreateCheckRun creates a completed check run for a commit. The check run is neutral if the report has annotations, and
+// successful otherwise. GitHub limits the number of annotations per request, so the remaining annotations are added by
+// updating the check run. Returns the url of the check run.
+func (g *GitHub) CreateCheckRun(sha string, report Report) (string, error) {
+	annotations := make([]githubAnnotation, 0, len(report.Annotations))
+	for _, a := range report.Annotations {
+		annotations = append(annotations, githubAnnotation{
+			Path:            a.Path,
+			StartLine:       a.StartLine,
+			EndLine:         a.EndLine,
+			AnnotationLevel: "warning",
+			Title:           a.Title,
+			Message:         a.Message,
+		})
+	}
+	conclusion := "success"
+	if len(annotations) > 0 {
+		conclusion = "neutral"
+	}
+	output := githubCheckRunOutput{Title: report.Title, Summary: report.Summary}
+
+	batch, annotations := splitAnnotations(annotations)
+	output.Annotations = batch
+	var created struct {
+		Id      int64  `json:"id"`
+		HtmlUrl string `json:"html_url"`
+	}
+	checkRun := githubCheckRun{Name: Name, HeadSha: sha, Status: "completed", Conclusion: conclusion, Output: output}
+	err := g.do("POST", fmt.Sprintf("%s/repos/%s/check-runs", g.ApiUrl, g.Repo), checkRun, &created)
+	if err != nil {
+		return "", err
+	}
+	for len(annotations) > 0 {
+		output.Annotations, annotations = splitAnnotations(annotations)
+		err = g.do("PATCH", fmt.Sprintf("%s/repos/%s/check-runs/%d", g.ApiUrl, g.Repo, created.Id), githubCheckRun{Output: output}, nil)
+		if err != nil {
+			return created.HtmlUrl, err
+		}
+	}
+	return created.HtmlUrl, nil
+}
+
+func splitAnnotations(annotations []githubAnnotation) (batch, rest []githubAnnotation) {
+	if len(annotations) <= maxGitHubAnnotations {
+		return annotations, nil
+	}
+	return annotations[:maxGitHubAnnotations], annotations[maxGitHubAnnotations:]
+}
+
+func (g *GitHub) do(method, url string, body, v interface{}) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "token "+g.Token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Content-Type", "application/json")
+	res, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("github responded with status code %d creating a check run for %s", res.StatusCode, g.Repo)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
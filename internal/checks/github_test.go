@@ -0,0 +1,75 @@
+package checks
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateCheckRun(t *testing.T) {
+	requests := []githubCheckRun{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "token gh-token", r.Header.Get("Authorization"))
+		var checkRun githubCheckRun
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&checkRun))
+		requests = append(requests, checkRun)
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/repos/org/repo/check-runs":
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"id":7,"html_url":"https://github.com/org/repo/runs/7"}`))
+		case r.Method == "PATCH" && r.URL.Path == "/repos/org/repo/check-runs/7":
+			_, _ = w.Write([]byte(`{}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	annotations := []Annotation{}
+	for i := 1; i <= 60; i++ {
+		annotations = append(annotations, Annotation{Path: fmt.Sprintf("file%d.go", i), StartLine: i, EndLine: i + 1, Title: "title", Message: "message"})
+	}
+	url, err := NewGitHub(server.URL, "org/repo", "gh-token").CreateCheckRun("abc123", Report{Title: "title", Summary: "summary", Annotations: annotations})
+	require.NoError(t, err)
+	assert.Equal(t, "https://github.com/org/repo/runs/7", url)
+
+	require.Len(t, requests, 2)
+	assert.Equal(t, Name, requests[0].Name)
+	assert.Equal(t, "abc123", requests[0].HeadSha)
+	assert.Equal(t, "completed", requests[0].Status)
+	assert.Equal(t, "neutral", requests[0].Conclusion)
+	assert.Equal(t, "summary", requests[0].Output.Summary)
+	assert.Len(t, requests[0].Output.Annotations, maxGitHubAnnotations)
+	assert.Equal(t, githubAnnotation{Path: "file1.go", StartLine: 1, EndLine: 2, AnnotationLevel: "warning", Title: "title", Message: "message"}, requests[0].Output.Annotations[0])
+	assert.Len(t, requests[1].Output.Annotations, 10)
+	assert.Equal(t, "file51.go", requests[1].Output.Annotations[0].Path)
+}
+
+func TestCreateCheckRun_withoutAnnotations(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var checkRun githubCheckRun
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&checkRun))
+		assert.Equal(t, "success", checkRun.Conclusion)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id":1}`))
+	}))
+	defer server.Close()
+
+	_, err := NewGitHub(server.URL, "org/repo", "gh-token").CreateCheckRun("abc123", Report{Title: "title"})
+	require.NoError(t, err)
+}
+
+func TestCreateCheckRun_error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	_, err := NewGitHub(server.URL, "org/repo", "gh-token").CreateCheckRun("abc123", Report{Title: "title"})
+	assert.EqualError(t, err, "github responded with status code 403 creating a check run for org/repo")
+}
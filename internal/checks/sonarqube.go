@@ -0,0 +1,64 @@
+package checks
+
+import (
+	"encoding/json"
+	"io"
+)
+
+const (
+	// SonarQubeEngineId identifies the issues imported from a scan in SonarQube
+	SonarQubeEngineId = "ld-find-code-refs"
+	// SonarQubeRuleId is the rule of issues about code references to archived flags
+	SonarQubeRuleId = "archived-flag-reference"
+	// sonarQubeEffortMinutes is the estimated time to remove a reference to an archived flag, which SonarQube adds to
+	// the technical debt of the project
+	sonarQubeEffortMinutes = 5
+)
+
+// sonarQubeIssues is a SonarQube Generic Issue Import report
+type sonarQubeIssues struct {
+	Issues []sonarQubeIssue `json:"issues"`
+}
+
+type sonarQubeIssue struct {
+	EngineId        string            `json:"engineId"`
+	RuleId          string            `json:"ruleId"`
+	Severity        string            `json:"severity"`
+	Type            string            `json:"type"`
+	EffortMinutes   int               `json:"effortMinutes"`
+	PrimaryLocation sonarQubeLocation `json:"primaryLocation"`
+}
+
+type sonarQubeLocation struct {
+	Message   string             `json:"message"`
+	FilePath  string             `json:"filePath"`
+	TextRange sonarQubeTextRange `json:"textRange"`
+}
+
+type sonarQubeTextRange struct {
+	StartLine int `json:"startLine"`
+	EndLine   int `json:"endLine"`
+}
+
+// WriteSonarQubeIssues writes the annotations of a report as SonarQube Generic Issue Import JSON, reporting each
+// annotation as a minor code smell. The report can be imported with the sonar.externalIssuesReportPaths analysis parameter.
+func WriteSonarQubeIssues(w io.Writer, report Report) error {
+	issues := sonarQubeIssues{Issues: make([]sonarQubeIssue, 0, len(report.Annotations))}
+	for _, a := range report.Annotations {
+		issues.Issues = append(issues.Issues, sonarQubeIssue{
+			EngineId:      SonarQubeEngineId,
+			RuleId:        SonarQubeRuleId,
+			Severity:      "MINOR",
+			Type:          "CODE_SMELL",
+			EffortMinutes: sonarQubeEffortMinutes,
+			PrimaryLocation: sonarQubeLocation{
+				Message:   a.Message,
+				FilePath:  a.Path,
+				TextRange: sonarQubeTextRange{StartLine: a.StartLine, EndLine: a.EndLine},
+			},
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(issues)
+}
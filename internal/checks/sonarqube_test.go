@@ -0,0 +1,27 @@
+package checks
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteSonarQubeIssues(t *testing.T) {
+	var buf bytes.Buffer
+	report := Report{Annotations: []Annotation{{Path: "src/app.go", StartLine: 3, EndLine: 5, Title: "title", Message: "message"}}}
+	require.NoError(t, WriteSonarQubeIssues(&buf, report))
+	assert.JSONEq(t, `{"issues": [{
+		"engineId": "ld-find-code-refs",
+		"ruleId": "archived-flag-reference",
+		"severity": "MINOR",
+		"type": "CODE_SMELL",
+		"effortMinutes": 5,
+		"primaryLocation": {"message": "message", "filePath": "src/app.go", "textRange": {"startLine": 3, "endLine": 5}}
+	}]}`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, WriteSonarQubeIssues(&buf, Report{}))
+	assert.JSONEq(t, `{"issues": []}`, buf.String(), "SonarQube requires the issues list")
+}
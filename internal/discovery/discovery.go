@@ -0,0 +1,266 @@
+// Package discovery lists the repositories belonging to a GitHub organization or Bitbucket workspace, and clones them
+// into a working directory so they can be scanned.
+package discovery
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+)
+
+const (
+	GitHub    = "github"
+	Bitbucket = "bitbucket"
+
+	DefaultGitHubApiUrl    = "https://api.github.com"
+	DefaultBitbucketApiUrl = "https://api.bitbucket.org/2.0"
+)
+
+type Repository struct {
+	Name          string
+	CloneUrl      string
+	Url           string
+	DefaultBranch string
+	Archived      bool
+	Fork          bool
+}
+
+// Provider lists repositories from a source code hosting service
+type Provider struct {
+	Type   string
+	ApiUrl string
+	// Owner is the GitHub organization or Bitbucket workspace
+	Owner string
+	// Username is only required for Bitbucket app passwords. GitHub tokens are sent with the x-access-token username.
+	Username string
+	Token    string
+
+	client *http.Client
+}
+
+func NewProvider(providerType, apiUrl, owner, username, token string) (*Provider, error) {
+	switch providerType {
+	case GitHub:
+		if apiUrl == "" {
+			apiUrl = DefaultGitHubApiUrl
+		}
+		if username == "" {
+			username = "x-access-token"
+		}
+	case Bitbucket:
+		if apiUrl == "" {
+			apiUrl = DefaultBitbucketApiUrl
+		}
+	default:
+		return nil, fmt.Errorf(`invalid provider %q: must be "github" or "bitbucket"`, providerType)
+	}
+	if owner == "" {
+		return nil, errors.New("a GitHub organization or Bitbucket workspace is required")
+	}
+	return &Provider{
+		Type:     providerType,
+		ApiUrl:   strings.TrimSuffix(apiUrl, "/"),
+		Owner:    owner,
+		Username: username,
+		Token:    token,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// authHeader returns the value of the Authorization header used for API requests and git operations
+func (p *Provider) authHeader() string {
+	if p.Token == "" {
+		return ""
+	}
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(p.Username+":"+p.Token))
+}
+
+// ListRepositories returns all repositories belonging to the provider's owner
+func (p *Provider) ListRepositories() ([]Repository, error) {
+	if p.Type == Bitbucket {
+		return p.listBitbucketRepositories()
+	}
+	return p.listGitHubRepositories()
+}
+
+type githubRepository struct {
+	Name          string `json:"name"`
+	CloneUrl      string `json:"clone_url"`
+	HtmlUrl       string `json:"html_url"`
+	DefaultBranch string `json:"default_branch"`
+	Archived      bool   `json:"archived"`
+	Fork          bool   `json:"fork"`
+}
+
+var nextLinkRegex = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+func (p *Provider) listGitHubRepositories() ([]Repository, error) {
+	ret := []Repository{}
+	next := fmt.Sprintf("%s/orgs/%s/repos?per_page=100", p.ApiUrl, url.PathEscape(p.Owner))
+	for next != "" {
+		var page []githubRepository
+		res, err := p.get(next, &page)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range page {
+			ret = append(ret, Repository{Name: r.Name, CloneUrl: r.CloneUrl, Url: r.HtmlUrl, DefaultBranch: r.DefaultBranch, Archived: r.Archived, Fork: r.Fork})
+		}
+		next = ""
+		if match := nextLinkRegex.FindStringSubmatch(res.Header.Get("Link")); match != nil {
+			next = match[1]
+		}
+	}
+	return ret, nil
+}
+
+type bitbucketPage struct {
+	Next   string `json:"next"`
+	Values []struct {
+		Slug  string `json:"slug"`
+		Links struct {
+			Clone []struct {
+				Name string `json:"name"`
+				Href string `json:"href"`
+			} `json:"clone"`
+			Html struct {
+				Href string `json:"href"`
+			} `json:"html"`
+		} `json:"links"`
+		Mainbranch *struct {
+			Name string `json:"name"`
+		} `json:"mainbranch"`
+		Parent *json.RawMessage `json:"parent"`
+	} `json:"values"`
+}
+
+func (p *Provider) listBitbucketRepositories() ([]Repository, error) {
+	ret := []Repository{}
+	next := fmt.Sprintf("%s/repositories/%s?pagelen=100", p.ApiUrl, url.PathEscape(p.Owner))
+	for next != "" {
+		var page bitbucketPage
+		_, err := p.get(next, &page)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range page.Values {
+			repo := Repository{Name: v.Slug, Url: v.Links.Html.Href, Fork: v.Parent != nil}
+			for _, c := range v.Links.Clone {
+				if c.Name == "https" {
+					repo.CloneUrl = c.Href
+				}
+			}
+			if v.Mainbranch != nil {
+				repo.DefaultBranch = v.Mainbranch.Name
+			}
+			ret = append(ret, repo)
+		}
+		next = page.Next
+	}
+	return ret, nil
+}
+
+func (p *Provider) get(url string, v interface{}) (*http.Response, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if auth := p.authHeader(); auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	res, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s responded with status code %d listing repositories for %s", p.Type, res.StatusCode, p.Owner)
+	}
+	return res, json.NewDecoder(res.Body).Decode(v)
+}
+
+// CloneOrUpdate clones the repository into workDir, or if it has already been cloned, fetches and checks out the latest
+// commit of the default branch, discarding any local changes. Credentials are passed to git in the environment of each
+// command, so they are not visible in process listings or stored in the repository's configuration. Returns the path
+// of the clone.
+func (p *Provider) CloneOrUpdate(repo Repository, workDir string) (string, error) {
+	dir := filepath.Join(workDir, p.Owner, repo.Name)
+	g := gitRunner{env: os.Environ()}
+	if auth := p.authHeader(); auth != "" {
+		g.env = withGitConfig(g.env, "http.extraHeader", "Authorization: "+auth)
+		g.secrets = []string{auth, p.Token}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+		log.Debug.Printf("updating existing clone of %s in %s", repo.Name, dir)
+		err := g.run("fetch", "-C", dir, "fetch", "--prune", "origin")
+		if err != nil {
+			return "", err
+		}
+		return dir, g.run("checkout", "-C", dir, "checkout", "--force", "-B", repo.DefaultBranch, "origin/"+repo.DefaultBranch)
+	}
+
+	log.Debug.Printf("cloning %s into %s", repo.Name, dir)
+	err := os.MkdirAll(filepath.Dir(dir), 0750)
+	if err != nil {
+		return "", err
+	}
+	return dir, g.run("clone", "clone", "--branch", repo.DefaultBranch, repo.CloneUrl, dir)
+}
+
+// withGitConfig returns env with a git configuration option added through GIT_CONFIG_COUNT, after any options
+// already configured by env
+func withGitConfig(env []string, key, value string) []string {
+	count := 0
+	ret := make([]string, 0, len(env)+3)
+	for _, v := range env {
+		if strings.HasPrefix(v, "GIT_CONFIG_COUNT=") {
+			count, _ = strconv.Atoi(strings.TrimPrefix(v, "GIT_CONFIG_COUNT="))
+			continue
+		}
+		ret = append(ret, v)
+	}
+	return append(ret,
+		fmt.Sprintf("GIT_CONFIG_KEY_%d=%s", count, key),
+		fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", count, value),
+		fmt.Sprintf("GIT_CONFIG_COUNT=%d", count+1),
+	)
+}
+
+// gitRunner runs git commands with an environment, removing secrets from the output of failed commands
+type gitRunner struct {
+	env     []string
+	secrets []string
+}
+
+func (g gitRunner) run(operation string, args ...string) error {
+	/* #nosec */
+	cmd := exec.Command("git", args...)
+	cmd.Env = g.env
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("git %s failed: %s", operation, g.redact(strings.TrimSpace(string(out))))
+	}
+	return nil
+}
+
+func (g gitRunner) redact(out string) string {
+	for _, secret := range g.secrets {
+		if secret != "" {
+			out = strings.Replace(out, secret, "<redacted>", -1)
+		}
+	}
+	return out
+}
@@ -0,0 +1,113 @@
+package discovery
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+)
+
+func TestMain(m *testing.M) {
+	log.Init(true)
+	os.Exit(m.Run())
+}
+
+func TestListRepositories_github(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, token, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "x-access-token", user)
+		assert.Equal(t, "gh-token", token)
+		assert.Equal(t, "/orgs/my-org/repos", r.URL.Path)
+		if r.URL.Query().Get("page") == "" {
+			w.Header().Set("Link", fmt.Sprintf(`<%s/orgs/my-org/repos?per_page=100&page=2>; rel="next", <%s/orgs/my-org/repos?per_page=100&page=2>; rel="last"`, server.URL, server.URL))
+			_, _ = w.Write([]byte(`[{"name":"a","clone_url":"https://github.com/my-org/a.git","html_url":"https://github.com/my-org/a","default_branch":"main"}]`))
+			return
+		}
+		_, _ = w.Write([]byte(`[{"name":"b","clone_url":"https://github.com/my-org/b.git","html_url":"https://github.com/my-org/b","default_branch":"master","archived":true,"fork":true}]`))
+	}))
+	defer server.Close()
+
+	provider, err := NewProvider(GitHub, server.URL, "my-org", "", "gh-token")
+	require.NoError(t, err)
+	repos, err := provider.ListRepositories()
+	require.NoError(t, err)
+	assert.Equal(t, []Repository{
+		{Name: "a", CloneUrl: "https://github.com/my-org/a.git", Url: "https://github.com/my-org/a", DefaultBranch: "main"},
+		{Name: "b", CloneUrl: "https://github.com/my-org/b.git", Url: "https://github.com/my-org/b", DefaultBranch: "master", Archived: true, Fork: true},
+	}, repos)
+}
+
+func TestListRepositories_bitbucket(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "user", user)
+		assert.Equal(t, "app-password", password)
+		if r.URL.Query().Get("page") == "" {
+			_, _ = fmt.Fprintf(w, `{"next":"%s/repositories/ws?pagelen=100&page=2","values":[{"slug":"a","links":{"clone":[{"name":"ssh","href":"git@bitbucket.org:ws/a.git"},{"name":"https","href":"https://bitbucket.org/ws/a.git"}],"html":{"href":"https://bitbucket.org/ws/a"}},"mainbranch":{"name":"main"}}]}`, server.URL)
+			return
+		}
+		_, _ = w.Write([]byte(`{"values":[{"slug":"empty","links":{"clone":[],"html":{"href":"https://bitbucket.org/ws/empty"}},"mainbranch":null}]}`))
+	}))
+	defer server.Close()
+
+	provider, err := NewProvider(Bitbucket, server.URL, "ws", "user", "app-password")
+	require.NoError(t, err)
+	repos, err := provider.ListRepositories()
+	require.NoError(t, err)
+	assert.Equal(t, []Repository{
+		{Name: "a", CloneUrl: "https://bitbucket.org/ws/a.git", Url: "https://bitbucket.org/ws/a", DefaultBranch: "main"},
+		{Name: "empty", Url: "https://bitbucket.org/ws/empty"},
+	}, repos)
+}
+
+func TestNewProvider_invalid(t *testing.T) {
+	_, err := NewProvider("gitlab", "", "my-org", "", "")
+	assert.Error(t, err)
+	_, err = NewProvider(GitHub, "", "", "", "")
+	assert.Error(t, err)
+}
+
+func TestCloneOrUpdate_credentials(t *testing.T) {
+	auth := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth <- r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "discovery")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	provider, err := NewProvider(GitHub, server.URL, "my-org", "", "gh-token")
+	require.NoError(t, err)
+	_, err = provider.CloneOrUpdate(Repository{Name: "a", CloneUrl: server.URL + "/my-org/a.git", DefaultBranch: "main"}, dir)
+	require.Error(t, err, "the server is not a git repository")
+	assert.Equal(t, provider.authHeader(), <-auth, "credentials are passed to git through its environment")
+}
+
+func Test_withGitConfig(t *testing.T) {
+	env := withGitConfig([]string{"HOME=/home/me"}, "http.extraHeader", "Authorization: Basic abc")
+	assert.Equal(t, []string{"HOME=/home/me", "GIT_CONFIG_KEY_0=http.extraHeader", "GIT_CONFIG_VALUE_0=Authorization: Basic abc", "GIT_CONFIG_COUNT=1"}, env)
+
+	env = withGitConfig([]string{"GIT_CONFIG_COUNT=1", "GIT_CONFIG_KEY_0=core.autocrlf", "GIT_CONFIG_VALUE_0=false"}, "http.extraHeader", "Authorization: Basic abc")
+	assert.Equal(t, []string{"GIT_CONFIG_KEY_0=core.autocrlf", "GIT_CONFIG_VALUE_0=false", "GIT_CONFIG_KEY_1=http.extraHeader", "GIT_CONFIG_VALUE_1=Authorization: Basic abc", "GIT_CONFIG_COUNT=2"}, env, "configuration from the environment is kept")
+}
+
+func TestGitRunner_redact(t *testing.T) {
+	g := gitRunner{env: os.Environ(), secrets: []string{"Basic abc", "gh-token"}}
+	err := g.run("fetch", "-c", "http.extraHeader=Authorization: Basic abc", "-C", "/nonexistent-gh-token", "fetch")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "<redacted>")
+	assert.NotContains(t, err.Error(), "gh-token")
+}
@@ -1,20 +1,27 @@
 package git
 
 import (
+	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 
 	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
 	object "github.com/go-git/go-git/v5/plumbing/object"
 
 	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
 
 	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	"github.com/launchdarkly/ld-find-code-refs/internal/warnings"
 	"github.com/launchdarkly/ld-find-code-refs/search"
 )
 
@@ -57,6 +64,47 @@ func NewClient(path string, branch string) (*Client, error) {
 	return &client, nil
 }
 
+// OpenClient returns a client for the repository at path, without resolving the current branch or commit. Use this
+// client when working with explicit revisions.
+func OpenClient(path string) (*Client, error) {
+	client := Client{workspace: path}
+	_, err := exec.LookPath("git")
+	if err != nil {
+		return nil, errors.New("git is a required dependency, but was not found in the system PATH")
+	}
+	/* #nosec */
+	cmd := exec.Command("git", "-C", path, "rev-parse", "--git-dir")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a git repository: %s", path, strings.TrimSpace(string(out)))
+	}
+	return &client, nil
+}
+
+// IsRepository returns true if path is inside a git working tree
+func IsRepository(path string) bool {
+	/* #nosec */
+	cmd := exec.Command("git", "-C", path, "rev-parse", "--is-inside-work-tree")
+	out, err := cmd.Output()
+	return err == nil && strings.TrimSpace(string(out)) == "true"
+}
+
+// Version returns the version of the git executable found in the system PATH
+func Version() (string, error) {
+	/* #nosec */
+	out, err := exec.Command("git", "--version").Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(strings.TrimSpace(string(out)), "git version "), nil
+}
+
+// IsDetachedHead returns true if the repository does not have a branch checked out
+func (c *Client) IsDetachedHead() bool {
+	branch, err := c.branchName()
+	return err == nil && branch == ""
+}
+
 func (c *Client) branchName() (string, error) {
 	/* #nosec */
 	cmd := exec.Command("git", "-C", c.workspace, "rev-parse", "--abbrev-ref", "HEAD")
@@ -84,10 +132,40 @@ func (c *Client) headSha() (string, error) {
 	return ret, nil
 }
 
+// IsShallow returns true if the repository is a shallow clone with truncated history
+func (c *Client) IsShallow() bool {
+	/* #nosec */
+	cmd := exec.Command("git", "-C", c.workspace, "rev-parse", "--is-shallow-repository")
+	out, err := cmd.Output()
+	return err == nil && strings.TrimSpace(string(out)) == "true"
+}
+
+// isSingleBranch returns true if the repository only fetches a single branch from origin, e.g. a clone made with --single-branch
+func (c *Client) isSingleBranch() bool {
+	/* #nosec */
+	cmd := exec.Command("git", "-C", c.workspace, "config", "--get-all", "remote.origin.fetch")
+	out, err := cmd.Output()
+	return err == nil && !strings.Contains(string(out), "*")
+}
+
 func (c *Client) RemoteBranches() (map[string]bool, error) {
+	args := []string{"-C", c.workspace, "ls-remote", "--quiet", "--heads"}
+	// CI clones are often shallow or single-branch, and may not have an upstream configured for the current branch, so
+	// query origin explicitly
+	queryOrigin := c.IsShallow() || c.isSingleBranch()
+	if queryOrigin {
+		log.Debug.Printf("shallow or single-branch clone detected, listing branches from origin")
+		args = append(args, "origin")
+	}
 	/* #nosec */
-	cmd := exec.Command("git", "-C", c.workspace, "ls-remote", "--quiet", "--heads")
+	cmd := exec.Command("git", args...)
 	out, err := cmd.CombinedOutput()
+	if err != nil && !queryOrigin {
+		log.Debug.Printf("unable to list branches from the default remote, falling back to origin: %s", strings.TrimSpace(string(out)))
+		/* #nosec */
+		cmd = exec.Command("git", append(args, "origin")...)
+		out, err = cmd.CombinedOutput()
+	}
 	if err != nil {
 		return nil, errors.New(string(out))
 	}
@@ -99,22 +177,282 @@ func (c *Client) RemoteBranches() (map[string]bool, error) {
 		ret[r[1]] = true
 	}
 	// the current branch should be in the list of remote branches
-	ret[c.GitBranch] = true
+	ret[strings.TrimPrefix(c.GitBranch, "refs/heads/")] = true
+	return ret, nil
+}
+
+// SparsePaths returns the paths of tracked files which are not present in the workspace because they are excluded by a sparse checkout
+func (c *Client) SparsePaths() ([]string, error) {
+	/* #nosec */
+	cmd := exec.Command("git", "-C", c.workspace, "ls-files", "-t", "-z")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	ret := []string{}
+	for _, entry := range strings.Split(string(out), "\x00") {
+		// skip-worktree entries are tagged with "S"
+		if strings.HasPrefix(entry, "S ") {
+			ret = append(ret, strings.TrimPrefix(entry, "S "))
+		}
+	}
+	log.Debug.Printf("found %d paths excluded by sparse checkout", len(ret))
 	return ret, nil
 }
 
+// IsPartialClone returns true if the repository was cloned with a filter, meaning some objects may need to be fetched from the remote on demand
+func (c *Client) IsPartialClone() bool {
+	/* #nosec */
+	cmd := exec.Command("git", "-C", c.workspace, "config", "--get", "extensions.partialClone")
+	out, err := cmd.Output()
+	return err == nil && strings.TrimSpace(string(out)) != ""
+}
+
+// ReadFiles returns the contents of the given paths at the current commit without checking them out.
+// In a partial clone, missing objects are fetched from the remote.
+func (c *Client) ReadFiles(ctx context.Context, paths []string, maxFileSize int64, warn *warnings.Collector) (map[string][]byte, error) {
+	return c.ReadFilesAt(ctx, c.GitSha, paths, maxFileSize, warn)
+}
+
+// ReadFilesAt returns the contents of the given paths at a revision without checking them out. Paths which do not
+// exist at the revision are omitted, as are files larger than maxFileSize bytes, unless maxFileSize is 0. In a partial
+// clone, missing objects are fetched from the remote. Reading stops with an error if ctx is done.
+func (c *Client) ReadFilesAt(ctx context.Context, rev string, paths []string, maxFileSize int64, warn *warnings.Collector) (ret map[string][]byte, err error) {
+	/* #nosec */
+	cmd := exec.CommandContext(ctx, "git", "-C", c.workspace, "cat-file", "--batch")
+	var stdin strings.Builder
+	for _, path := range paths {
+		fmt.Fprintf(&stdin, "%s:%s\n", rev, path)
+	}
+	cmd.Stdin = strings.NewReader(stdin.String())
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			// git may be blocked writing objects which were not read
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+			return
+		}
+		err = cmd.Wait()
+	}()
+
+	ret = make(map[string][]byte, len(paths))
+	reader := bufio.NewReader(stdout)
+	for _, path := range paths {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s: %s", path, err)
+		}
+		// header format: <sha> <type> <size>, or <object> missing
+		fields := strings.Fields(header)
+		if len(fields) != 3 {
+			log.Debug.Printf("unable to read %s: %s", path, strings.TrimSpace(header))
+			continue
+		}
+		size, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("unable to read %s: invalid object size %q", path, fields[2])
+		}
+		// contents are followed by a newline
+		if fields[1] != "blob" || search.ExceedsMaxFileSize(path, size, maxFileSize, warn) {
+			_, err = io.CopyN(ioutil.Discard, reader, size+1)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read %s: %s", path, err)
+			}
+			continue
+		}
+		data := make([]byte, size+1)
+		_, err = io.ReadFull(reader, data)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s: %s", path, err)
+		}
+		ret[path] = data[:size]
+	}
+	return ret, nil
+}
+
+// fetchRemoteBranch fetches a branch from origin, and returns the remote-tracking ref it was fetched to
+func (c *Client) fetchRemoteBranch(branch string) (string, error) {
+	ref := "refs/remotes/origin/" + branch
+	/* #nosec */
+	cmd := exec.Command("git", "-C", c.workspace, "fetch", "--prune", "origin", "+refs/heads/"+branch+":"+ref)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("unable to fetch branch %s: %s", branch, strings.TrimSpace(string(out)))
+	}
+	return ref, nil
+}
+
+// AddWorktree checks out a branch in a new linked worktree in a temporary directory, leaving the workspace's checkout
+// unchanged, and returns the path of the worktree. The branch is fetched from origin first. If it cannot be fetched, the
+// commit of its remote-tracking branch or local branch is checked out instead. HEAD of the worktree is detached, so no
+// local branches are created or moved. The worktree must be removed with RemoveWorktree.
+func (c *Client) AddWorktree(branch string) (string, error) {
+	ref, err := c.fetchRemoteBranch(branch)
+	if err != nil {
+		ref = ""
+		for _, candidate := range []string{"refs/remotes/origin/" + branch, "refs/heads/" + branch} {
+			if _, resolveErr := c.ResolveRevision(candidate); resolveErr == nil {
+				ref = candidate
+				break
+			}
+		}
+		if ref == "" {
+			return "", err
+		}
+		log.Warning.Printf("%s, checking out %s instead", err, ref)
+	}
+	// worktrees whose directories were deleted, e.g. by a scan which was killed, are no longer listed
+	/* #nosec */
+	_ = exec.Command("git", "-C", c.workspace, "worktree", "prune").Run()
+
+	parent, err := ioutil.TempDir("", "ld-find-code-refs-worktree")
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(parent, "worktree")
+	/* #nosec */
+	cmd := exec.Command("git", "-C", c.workspace, "worktree", "add", "--detach", dir, ref)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		_ = os.RemoveAll(parent)
+		return "", fmt.Errorf("unable to check out branch %s in a worktree: %s", branch, strings.TrimSpace(string(out)))
+	}
+	log.Debug.Printf("checked out %s in worktree %s", ref, dir)
+	return dir, nil
+}
+
+// RemoveWorktree removes a worktree added by AddWorktree, and its temporary directory, including any changes made in it
+func (c *Client) RemoveWorktree(dir string) error {
+	/* #nosec */
+	cmd := exec.Command("git", "-C", c.workspace, "worktree", "remove", "--force", dir)
+	out, err := cmd.CombinedOutput()
+	removeErr := os.RemoveAll(filepath.Dir(dir))
+	if err != nil {
+		return fmt.Errorf("unable to remove worktree %s: %s", dir, strings.TrimSpace(string(out)))
+	}
+	return removeErr
+}
+
+// RemoteUrl returns the url of the origin remote
+func (c *Client) RemoteUrl() (string, error) {
+	/* #nosec */
+	cmd := exec.Command("git", "-C", c.workspace, "remote", "get-url", "origin")
+	out, err := cmd.Output()
+	if err != nil {
+		return "", errors.New("repository has no origin remote")
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// ResolveRevision returns the commit sha of a revision, e.g. a branch name, tag, or sha
+func (c *Client) ResolveRevision(rev string) (string, error) {
+	/* #nosec */
+	cmd := exec.Command("git", "-C", c.workspace, "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("unknown revision %q", rev)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// MergeBase returns the sha of the best common ancestor of two commits
+func (c *Client) MergeBase(a, b string) (string, error) {
+	/* #nosec */
+	cmd := exec.Command("git", "-C", c.workspace, "merge-base", a, b)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("unable to find a common ancestor of %s and %s: %s", a, b, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// ListFiles returns the paths of all files tracked at a revision
+func (c *Client) ListFiles(rev string) ([]string, error) {
+	/* #nosec */
+	cmd := exec.Command("git", "-C", c.workspace, "ls-tree", "-r", "-z", "--name-only", rev)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	return splitNullTerminated(out), nil
+}
+
+// ChangedFiles returns the paths of files which differ between two revisions, including added and deleted files
+func (c *Client) ChangedFiles(from, to string) ([]string, error) {
+	/* #nosec */
+	cmd := exec.Command("git", "-C", c.workspace, "diff", "--name-only", "-z", "--no-renames", from, to)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	return splitNullTerminated(out), nil
+}
+
+func splitNullTerminated(out []byte) []string {
+	ret := []string{}
+	for _, entry := range strings.Split(string(out), "\x00") {
+		if entry != "" {
+			ret = append(ret, entry)
+		}
+	}
+	return ret
+}
+
+// gitCommonDir returns the absolute path of the git directory containing objects and refs shared across all worktrees
+func (c *Client) gitCommonDir() (string, error) {
+	/* #nosec */
+	cmd := exec.Command("git", "-C", c.workspace, "rev-parse", "--git-common-dir")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", errors.New(string(out))
+	}
+	dir := strings.TrimSpace(string(out))
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(c.workspace, dir)
+	}
+	return dir, nil
+}
+
+// openRepository opens the repository at the workspace. Linked worktrees, where .git is a file pointing to a
+// directory inside the main repository, are opened using the main repository's git directory.
+func (c Client) openRepository() (*git.Repository, error) {
+	info, err := os.Lstat(filepath.Join(c.workspace, ".git"))
+	if err != nil || info.IsDir() {
+		return git.PlainOpen(c.workspace)
+	}
+	commonDir, err := c.gitCommonDir()
+	if err != nil {
+		return nil, fmt.Errorf("unable to locate git directory for worktree: %s", err)
+	}
+	log.Debug.Printf("opening git worktree using common git directory: %s", commonDir)
+	return git.PlainOpen(commonDir)
+}
+
 type CommitData struct {
 	commit *object.Commit
 	tree   *object.Tree
 }
 
 // FindExtinctions searches commit history for flags that had references removed recently
-func (c Client) FindExtinctions(projKey string, flags []string, delimiters string, lookback int) ([]ld.ExtinctionRep, error) {
-	repo, err := git.PlainOpen(c.workspace)
+func (c Client) FindExtinctions(projKey string, flags []string, delimiters search.Delimiters, lookback int) ([]ld.ExtinctionRep, error) {
+	repo, err := c.openRepository()
 	if err != nil {
 		return nil, err
 	}
-	logResult, err := repo.Log(&git.LogOptions{})
+	logOpts := git.LogOptions{}
+	if c.GitSha != "" {
+		// HEAD of the main repository may differ from HEAD of a linked worktree
+		logOpts.From = plumbing.NewHash(c.GitSha)
+	}
+	logResult, err := repo.Log(&logOpts)
 	if err != nil {
 		return nil, err
 	}
@@ -123,8 +461,8 @@ func (c Client) FindExtinctions(projKey string, flags []string, delimiters strin
 	for i := 0; i < lookback; i++ {
 		commit, err := logResult.Next()
 		if err != nil {
-			// reached end of commit tree
-			if err == io.EOF {
+			// reached end of commit tree, or the history boundary of a shallow clone
+			if err == io.EOF || err == plumbing.ErrObjectNotFound {
 				break
 			}
 			return nil, err
@@ -159,7 +497,7 @@ func (c Client) FindExtinctions(projKey string, flags []string, delimiters strin
 					delta = -1
 				}
 
-				if delta != 0 && search.MatchDelimiters(patchLine, flag, delimiters) {
+				if delta != 0 && delimiters.Match(patchLine, flag) {
 					removalCount += delta
 				}
 			}
@@ -1,9 +1,13 @@
 package git
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -12,6 +16,8 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	"github.com/launchdarkly/ld-find-code-refs/search"
 )
 
 const (
@@ -20,6 +26,11 @@ const (
 	flag2   = "flag2"
 )
 
+func TestMain(m *testing.M) {
+	log.Init(true)
+	os.Exit(m.Run())
+}
+
 func setupRepo(t *testing.T) *git.Repository {
 	os.RemoveAll(repoDir)
 	require.NoError(t, os.MkdirAll(repoDir, 0700))
@@ -75,7 +86,7 @@ func TestFindExtinctions(t *testing.T) {
 
 	c := Client{workspace: repoDir}
 	projKey := "default"
-	extinctions, err := c.FindExtinctions(projKey, []string{flag1, flag2}, "", 10)
+	extinctions, err := c.FindExtinctions(projKey, []string{flag1, flag2}, search.Delimiters{}, 10)
 	require.NoError(t, err)
 	fmt.Println(commit2, commit3)
 
@@ -98,3 +109,174 @@ func TestFindExtinctions(t *testing.T) {
 	require.Equal(t, expected, extinctions)
 
 }
+
+// TestOpenRepository_worktree ensures linked worktrees, where .git is a file, can be opened.
+func TestOpenRepository_worktree(t *testing.T) {
+	repo := setupRepo(t)
+	wt, err := repo.Worktree()
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(repoDir, flag1), []byte(flag1), 0600))
+	_, err = wt.Add(flag1)
+	require.NoError(t, err)
+	who := object.Signature{Name: "LaunchDarkly", Email: "dev@launchdarkly.com", When: time.Unix(100000000, 0)}
+	hash, err := wt.Commit("add flag", &git.CommitOptions{Committer: &who, Author: &who})
+	require.NoError(t, err)
+
+	absRepoDir, err := filepath.Abs(repoDir)
+	require.NoError(t, err)
+	worktreeDir := absRepoDir + "-worktree"
+	defer os.RemoveAll(worktreeDir)
+	/* #nosec */
+	out, err := exec.Command("git", "-C", absRepoDir, "worktree", "add", "--detach", worktreeDir).CombinedOutput()
+	require.NoError(t, err, string(out))
+
+	c := Client{workspace: worktreeDir, GitSha: hash.String()}
+	worktreeRepo, err := c.openRepository()
+	require.NoError(t, err)
+	commit, err := worktreeRepo.CommitObject(hash)
+	require.NoError(t, err)
+	require.Equal(t, "add flag", commit.Message)
+}
+
+func TestIsRepository(t *testing.T) {
+	setupRepo(t)
+	require.True(t, IsRepository(repoDir))
+
+	dir, err := ioutil.TempDir("", "snapshot")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.False(t, IsRepository(dir))
+}
+
+func TestSparsePathsAndReadFiles(t *testing.T) {
+	repo := setupRepo(t)
+	wt, err := repo.Worktree()
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(repoDir, "excluded"), 0700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(repoDir, "excluded", flag1), []byte(flag1), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(repoDir, flag2), []byte(flag2), 0600))
+	_, err = wt.Add(".")
+	require.NoError(t, err)
+	who := object.Signature{Name: "LaunchDarkly", Email: "dev@launchdarkly.com", When: time.Unix(100000000, 0)}
+	hash, err := wt.Commit("add flags", &git.CommitOptions{Committer: &who, Author: &who})
+	require.NoError(t, err)
+
+	/* #nosec */
+	out, err := exec.Command("git", "-C", repoDir, "sparse-checkout", "set", "--no-cone", "/"+flag2).CombinedOutput()
+	require.NoError(t, err, string(out))
+
+	c := Client{workspace: repoDir, GitSha: hash.String()}
+	paths, err := c.SparsePaths()
+	require.NoError(t, err)
+	require.Equal(t, []string{"excluded/" + flag1}, paths)
+
+	contents, err := c.ReadFiles(context.Background(), append(paths, "missing"), 0, nil)
+	require.NoError(t, err)
+	require.Equal(t, map[string][]byte{"excluded/" + flag1: []byte(flag1)}, contents)
+
+	// files larger than the maximum size are skipped
+	contents, err = c.ReadFiles(context.Background(), append(paths, flag2), int64(len(flag1)-1), nil)
+	require.NoError(t, err)
+	require.Empty(t, contents)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = c.ReadFiles(ctx, paths, 0, nil)
+	require.Error(t, err)
+}
+
+// TestShallowClone ensures extinctions and remote branches can be found in a shallow clone.
+func TestShallowClone(t *testing.T) {
+	repo := setupRepo(t)
+	wt, err := repo.Worktree()
+	require.NoError(t, err)
+	who := object.Signature{Name: "LaunchDarkly", Email: "dev@launchdarkly.com", When: time.Unix(100000000, 0)}
+	for _, flag := range []string{flag1, flag2} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(repoDir, flag), []byte(flag), 0600))
+		_, err = wt.Add(flag)
+		require.NoError(t, err)
+		_, err = wt.Commit("add "+flag, &git.CommitOptions{Committer: &who, Author: &who})
+		require.NoError(t, err)
+	}
+
+	absRepoDir, err := filepath.Abs(repoDir)
+	require.NoError(t, err)
+	cloneDir := absRepoDir + "-shallow"
+	defer os.RemoveAll(cloneDir)
+	/* #nosec */
+	out, err := exec.Command("git", "clone", "--depth", "1", "file://"+absRepoDir, cloneDir).CombinedOutput()
+	require.NoError(t, err, string(out))
+
+	c, err := NewClient(cloneDir, "")
+	require.NoError(t, err)
+	require.True(t, c.IsShallow())
+
+	_, err = c.FindExtinctions("default", []string{flag1}, search.Delimiters{}, 10)
+	require.NoError(t, err)
+
+	branches, err := c.RemoteBranches()
+	require.NoError(t, err)
+	require.True(t, branches[c.GitBranch])
+}
+
+func TestAddWorktree(t *testing.T) {
+	repo := setupRepo(t)
+	wt, err := repo.Worktree()
+	require.NoError(t, err)
+	who := object.Signature{Name: "LaunchDarkly", Email: "dev@launchdarkly.com", When: time.Unix(100000000, 0)}
+	require.NoError(t, ioutil.WriteFile(filepath.Join(repoDir, flag1), []byte(flag1), 0600))
+	_, err = wt.Add(flag1)
+	require.NoError(t, err)
+	_, err = wt.Commit("add "+flag1, &git.CommitOptions{Committer: &who, Author: &who})
+	require.NoError(t, err)
+
+	absRepoDir, err := filepath.Abs(repoDir)
+	require.NoError(t, err)
+	cloneDir := absRepoDir + "-clone"
+	defer os.RemoveAll(cloneDir)
+	/* #nosec */
+	out, err := exec.Command("git", "clone", "file://"+absRepoDir, cloneDir).CombinedOutput()
+	require.NoError(t, err, string(out))
+	c, err := OpenClient(cloneDir)
+	require.NoError(t, err)
+	url, err := c.RemoteUrl()
+	require.NoError(t, err)
+	require.Equal(t, "file://"+absRepoDir, url)
+
+	// a branch pushed after the clone was made is fetched and checked out
+	/* #nosec */
+	out, err = exec.Command("git", "-C", repoDir, "checkout", "-b", "feature").CombinedOutput()
+	require.NoError(t, err, string(out))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(repoDir, flag2), []byte(flag2), 0600))
+	_, err = wt.Add(flag2)
+	require.NoError(t, err)
+	hash, err := wt.Commit("add "+flag2, &git.CommitOptions{Committer: &who, Author: &who})
+	require.NoError(t, err)
+
+	before, err := c.ResolveRevision("HEAD")
+	require.NoError(t, err)
+	dir, err := c.AddWorktree("feature")
+	require.NoError(t, err)
+	require.FileExists(t, filepath.Join(dir, flag2))
+	/* #nosec */
+	out, err = exec.Command("git", "-C", dir, "rev-parse", "HEAD").CombinedOutput()
+	require.NoError(t, err, string(out))
+	require.Equal(t, hash.String(), strings.TrimSpace(string(out)))
+
+	// the checkout of the clone is unchanged
+	head, err := c.ResolveRevision("HEAD")
+	require.NoError(t, err)
+	require.Equal(t, before, head)
+	branch, err := c.branchName()
+	require.NoError(t, err)
+	require.Equal(t, "master", branch)
+	_, err = os.Stat(filepath.Join(cloneDir, flag2))
+	require.True(t, os.IsNotExist(err))
+
+	require.NoError(t, c.RemoveWorktree(dir))
+	_, err = os.Stat(filepath.Dir(dir))
+	require.True(t, os.IsNotExist(err))
+
+	_, err = c.AddWorktree("missing")
+	require.Error(t, err)
+}
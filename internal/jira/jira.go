@@ -0,0 +1,180 @@
+// Package jira creates and updates Jira issues with the Jira REST API, which is supported by both Jira Cloud and Jira
+// Data Center.
+package jira
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Client creates and updates issues in a Jira site
+type Client struct {
+	Url string
+	// Email is only required for Jira Cloud API tokens. Other tokens, such as Jira Data Center personal access tokens,
+	// are sent as bearer tokens.
+	Email string
+	Token string
+
+	client *http.Client
+}
+
+func NewClient(url, email, token string) *Client {
+	return &Client{
+		Url:    strings.TrimSuffix(url, "/"),
+		Email:  email,
+		Token:  token,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Issue is a Jira issue
+type Issue struct {
+	// Key is the key of an existing issue, e.g. FLAGS-123
+	Key         string
+	Project     string
+	IssueType   string
+	Summary     string
+	Description string
+	Labels      []string
+}
+
+type issueFields struct {
+	Project     *projectRef   `json:"project,omitempty"`
+	IssueType   *issueTypeRef `json:"issuetype,omitempty"`
+	Summary     string        `json:"summary"`
+	Description string        `json:"description"`
+	Labels      []string      `json:"labels"`
+}
+
+type projectRef struct {
+	Key string `json:"key"`
+}
+
+type issueTypeRef struct {
+	Name string `json:"name"`
+}
+
+// FindIssue returns the most recently created issue in a project with all of the given labels, whether or not the
+// issue is resolved. Returns nil if there is no such issue.
+func (c *Client) FindIssue(project string, labels []string) (*Issue, error) {
+	clauses := []string{"project = " + quote(project)}
+	for _, label := range labels {
+		clauses = append(clauses, "labels = "+quote(label))
+	}
+	req := map[string]interface{}{
+		"jql":        strings.Join(clauses, " AND ") + " ORDER BY created DESC",
+		"maxResults": 1,
+		"fields":     []string{"summary", "description", "labels"},
+	}
+	var res struct {
+		Issues []struct {
+			Key    string      `json:"key"`
+			Fields issueFields `json:"fields"`
+		} `json:"issues"`
+	}
+	err := c.do("POST", "/rest/api/2/search", req, &res)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Issues) == 0 {
+		return nil, nil
+	}
+	found := res.Issues[0]
+	return &Issue{
+		Key:         found.Key,
+		Project:     project,
+		Summary:     found.Fields.Summary,
+		Description: found.Fields.Description,
+		Labels:      found.Fields.Labels,
+	}, nil
+}
+
+// CreateIssue creates an issue, and returns its key
+func (c *Client) CreateIssue(issue Issue) (string, error) {
+	fields := issueFields{
+		Project:     &projectRef{Key: issue.Project},
+		IssueType:   &issueTypeRef{Name: issue.IssueType},
+		Summary:     issue.Summary,
+		Description: issue.Description,
+		Labels:      issue.Labels,
+	}
+	var res struct {
+		Key string `json:"key"`
+	}
+	err := c.do("POST", "/rest/api/2/issue", map[string]interface{}{"fields": fields}, &res)
+	return res.Key, err
+}
+
+// UpdateIssue replaces the summary, description, and labels of an existing issue
+func (c *Client) UpdateIssue(issue Issue) error {
+	fields := issueFields{Summary: issue.Summary, Description: issue.Description, Labels: issue.Labels}
+	return c.do("PUT", "/rest/api/2/issue/"+issue.Key, map[string]interface{}{"fields": fields}, nil)
+}
+
+// IssueUrl returns the url of an issue in the Jira site
+func (c *Client) IssueUrl(key string) string {
+	return c.Url + "/browse/" + key
+}
+
+func (c *Client) do(method, path string, body, result interface{}) error {
+	var reqBody bytes.Buffer
+	err := json.NewEncoder(&reqBody).Encode(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(method, c.Url+path, &reqBody)
+	if err != nil {
+		return err
+	}
+	if c.Email != "" {
+		req.SetBasicAuth(c.Email, c.Token)
+	} else if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	res, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("jira responded with status code %d to %s %s: %s", res.StatusCode, method, path, errorMessages(res.Body))
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(result)
+}
+
+// errorMessages returns the error messages of a Jira error response
+func errorMessages(body io.Reader) string {
+	var res struct {
+		ErrorMessages []string          `json:"errorMessages"`
+		Errors        map[string]string `json:"errors"`
+	}
+	if json.NewDecoder(body).Decode(&res) != nil {
+		return "unexpected response"
+	}
+	messages := res.ErrorMessages
+	fields := make([]string, 0, len(res.Errors))
+	for field := range res.Errors {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		messages = append(messages, field+": "+res.Errors[field])
+	}
+	return strings.Join(messages, ", ")
+}
+
+// quote quotes a string for use in JQL
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,58 @@
+package jira
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient(t *testing.T) {
+	var search map[string]interface{}
+	var created, updated map[string]map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		email, token, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "dev@example.com", email)
+		assert.Equal(t, "jira-token", token)
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/rest/api/2/search":
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&search))
+			_, _ = w.Write([]byte(`{"issues":[{"key":"FLAGS-1","fields":{"summary":"summary","description":"description","labels":["a","b"]}}]}`))
+		case r.Method == "POST" && r.URL.Path == "/rest/api/2/issue":
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&created))
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"id":"10001","key":"FLAGS-2"}`))
+		case r.Method == "PUT" && r.URL.Path == "/rest/api/2/issue/FLAGS-1":
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&updated))
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"errorMessages":[],"errors":{"summary":"Summary is required.","issuetype":"Specify an issue type"}}`))
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL+"/", "dev@example.com", "jira-token")
+	issue, err := client.FindIssue("FLAGS", []string{"a", `b"c`})
+	require.NoError(t, err)
+	assert.Equal(t, `project = "FLAGS" AND labels = "a" AND labels = "b\"c" ORDER BY created DESC`, search["jql"])
+	assert.Equal(t, &Issue{Key: "FLAGS-1", Project: "FLAGS", Summary: "summary", Description: "description", Labels: []string{"a", "b"}}, issue)
+
+	key, err := client.CreateIssue(Issue{Project: "FLAGS", IssueType: "Task", Summary: "summary", Description: "description", Labels: []string{"a"}})
+	require.NoError(t, err)
+	assert.Equal(t, "FLAGS-2", key)
+	assert.Equal(t, map[string]interface{}{"key": "FLAGS"}, created["fields"]["project"])
+	assert.Equal(t, map[string]interface{}{"name": "Task"}, created["fields"]["issuetype"])
+	assert.Equal(t, server.URL+"/browse/FLAGS-2", client.IssueUrl(key))
+
+	require.NoError(t, client.UpdateIssue(Issue{Key: "FLAGS-1", Summary: "new summary", Labels: []string{"a"}}))
+	assert.Equal(t, "new summary", updated["fields"]["summary"])
+	assert.NotContains(t, updated["fields"], "project", "the project of an issue is not changed")
+
+	err = client.UpdateIssue(Issue{Key: "FLAGS-3"})
+	assert.EqualError(t, err, "jira responded with status code 400 to PUT /rest/api/2/issue/FLAGS-3: issuetype: Specify an issue type, summary: Summary is required.")
+}
@@ -0,0 +1,102 @@
+package ld
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/validation"
+)
+
+// CSVColumns are the columns of the CSV output, in order. New columns are only ever added after the existing columns, so
+// scripts may read columns by position.
+var CSVColumns = []string{"flagKey", "path", "startingLineNumber", "lines", "aliases", "sdkCall", "confidence", "aliasMatches", "tags", "maintainer"}
+
+// hunkIndex locates a hunk in a branch
+type hunkIndex struct {
+	ref, hunk int
+}
+
+// WriteToCSV writes the code references of the branch to outDir, one row per hunk, sorted by flag key, path, and starting
+// line number. Fields are separated by delimiter, and a .tsv file is written if delimiter is a tab.
+func (b BranchRep) WriteToCSV(outDir, projKey, repo, sha string, delimiter rune) (path string, err error) {
+	tag := b.FileTag(sha)
+	absPath, err := validation.NormalizeAndValidatePath(outDir)
+	if err != nil {
+		return "", fmt.Errorf("invalid outDir '%s': %w", outDir, err)
+	}
+	ext := "csv"
+	if delimiter == '\t' {
+		ext = "tsv"
+	}
+	path = filepath.Join(absPath, fmt.Sprintf("coderefs_%s_%s_%s.%s", projKey, repo, tag, ext))
+
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		closeErr := f.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+	return path, b.WriteCSV(f, delimiter)
+}
+
+// WriteCSV streams the rows of the CSV output to out. Rows are formatted as they are written, so memory use does not
+// grow with the size of the hunks. Fields containing the delimiter, quotes, or line breaks, such as the lines of a hunk,
+// are quoted.
+func (b BranchRep) WriteCSV(out io.Writer, delimiter rune) error {
+	w := csv.NewWriter(out)
+	w.Comma = delimiter
+	err := w.Write(CSVColumns)
+	if err != nil {
+		return err
+	}
+	for _, i := range b.sortedHunks() {
+		ref := b.References[i.ref]
+		err = w.Write(hunkRecord(ref.Path, ref.Hunks[i.hunk]))
+		if err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// sortedHunks returns the location of each hunk in the branch, sorted by flag key, path, and starting line number
+func (b BranchRep) sortedHunks() []hunkIndex {
+	ret := make([]hunkIndex, 0, b.TotalHunkCount())
+	for r, ref := range b.References {
+		for h := range ref.Hunks {
+			ret = append(ret, hunkIndex{r, h})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		refA, refB := b.References[ret[i].ref], b.References[ret[j].ref]
+		hunkA, hunkB := refA.Hunks[ret[i].hunk], refB.Hunks[ret[j].hunk]
+		if hunkA.FlagKey != hunkB.FlagKey {
+			return hunkA.FlagKey < hunkB.FlagKey
+		}
+		if refA.Path != refB.Path {
+			return refA.Path < refB.Path
+		}
+		return hunkA.StartingLineNumber < hunkB.StartingLineNumber
+	})
+	return ret
+}
+
+// hunkRecord returns the fields of the CSV row of a hunk, in the order of CSVColumns
+func hunkRecord(path string, hunk HunkRep) []string {
+	aliasMatches := make([]string, 0, len(hunk.AliasMatches))
+	for _, m := range hunk.AliasMatches {
+		aliasMatches = append(aliasMatches, fmt.Sprintf("%s: %s", m.Alias, m.Rule))
+	}
+	return []string{hunk.FlagKey, path, strconv.FormatInt(int64(hunk.StartingLineNumber), 10), hunk.Lines, strings.Join(hunk.Aliases, " "), hunk.SDKCall, hunk.Confidence.String(), strings.Join(aliasMatches, "; "), strings.Join(hunk.Tags, " "), hunk.Maintainer}
+}
@@ -0,0 +1,58 @@
+package ld
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var csvBranch = BranchRep{
+	Name: "main",
+	References: []ReferenceHunksRep{
+		{Path: "b.go", Hunks: []HunkRep{{StartingLineNumber: 10, FlagKey: "flag1", Lines: "x := \"flag1\"\nif x {\n\ty, z\n}"}}},
+		{Path: "a.go", Hunks: []HunkRep{
+			{StartingLineNumber: 9, FlagKey: "flag1", Lines: "say \"hi\", \tflag1", Aliases: []string{"FLAG_1", "flagOne"}},
+			{StartingLineNumber: 2, FlagKey: "flag2", Lines: "flag2", Tags: []string{"checkout", "web"}, Maintainer: "owner@example.com"},
+			{StartingLineNumber: 12, FlagKey: "flag1", AliasMatches: []AliasMatch{{Alias: "FLAG_1", Rule: "aliases[0]"}}},
+		}},
+	},
+}
+
+func TestWriteCSV(t *testing.T) {
+	for _, comma := range []rune{',', '\t', ';'} {
+		buf := &bytes.Buffer{}
+		require.NoError(t, csvBranch.WriteCSV(buf, comma))
+
+		r := csv.NewReader(buf)
+		r.Comma = comma
+		records, err := r.ReadAll()
+		require.NoError(t, err, "output delimited by %q can be read", comma)
+		assert.Equal(t, [][]string{
+			CSVColumns,
+			{"flag1", "a.go", "9", "say \"hi\", \tflag1", "FLAG_1 flagOne", "", "", "", "", ""},
+			{"flag1", "a.go", "12", "", "", "", "", "FLAG_1: aliases[0]", "", ""},
+			{"flag1", "b.go", "10", "x := \"flag1\"\nif x {\n\ty, z\n}", "", "", "", "", "", ""},
+			{"flag2", "a.go", "2", "flag2", "", "", "", "", "checkout web", "owner@example.com"},
+		}, records, "rows delimited by %q are sorted by flag key, path, and line number, and embedded line breaks are kept", comma)
+	}
+}
+
+func TestWriteToCSV(t *testing.T) {
+	dir, err := ioutil.TempDir("", "csv")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path, err := csvBranch.WriteToCSV(dir, "default", "my-repo", "0123456789", ',')
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "coderefs_default_my-repo_0123456.csv"), path)
+
+	path, err = csvBranch.WriteToCSV(dir, "default", "my-repo", "0123456789", '\t')
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "coderefs_default_my-repo_0123456.tsv"), path)
+}
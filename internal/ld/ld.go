@@ -3,23 +3,26 @@ package ld
 import (
 	"bytes"
 	"context"
-	"encoding/csv"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
-	"os"
 	"path/filepath"
 	"reflect"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode"
 
 	"github.com/antihax/optional"
 	h "github.com/hashicorp/go-retryablehttp"
-	"github.com/olekukonko/tablewriter"
 
 	ldapi "github.com/launchdarkly/api-client-go"
 	jsonpatch "github.com/launchdarkly/json-patch"
@@ -30,6 +33,7 @@ import (
 type ApiClient struct {
 	ldClient   *ldapi.APIClient
 	httpClient *h.Client
+	recorder   *requestRecorder
 	Options    ApiOptions
 }
 
@@ -39,11 +43,18 @@ type ApiOptions struct {
 	BaseUri   string
 	UserAgent string
 	RetryMax  *int
+	// FlagFilter is a LaunchDarkly flag list filter, e.g. "query:checkout", restricting the flags returned
+	FlagFilter string
+	// MaxFlags is the maximum number of flags returned, if > 0
+	MaxFlags int
+	// Headers are added to every request, e.g. to attribute requests to the pipeline which sent them
+	Headers map[string]string
 }
 
 const (
-	v2ApiPath = "/api/v2"
-	reposPath = v2ApiPath + "/code-refs/repositories"
+	v2ApiPath    = "/api/v2"
+	reposPath    = v2ApiPath + "/code-refs/repositories"
+	projectsPath = v2ApiPath + "/projects"
 )
 
 type ConfigurationError struct {
@@ -63,6 +74,7 @@ var (
 	BranchUpdateSequenceIdConflictErr = errors.New("updateSequenceId conflict")
 	RepositoryDisabledErr             = newConfigurationError("repository is disabled")
 	UnauthorizedErr                   = newConfigurationError("unauthorized, check your LaunchDarkly access token")
+	ForbiddenErr                      = newConfigurationError("forbidden, check that your LaunchDarkly access token has the required permissions")
 	EntityTooLargeErr                 = newConfigurationError("entity too large")
 )
 
@@ -81,35 +93,485 @@ func InitApiClient(options ApiOptions) ApiClient {
 	if options.RetryMax != nil && *options.RetryMax >= 0 {
 		client.RetryMax = *options.RetryMax
 	}
+	// requests sent by both clients are recorded, so their latency can be reported at the end of a scan
+	recorder := &requestRecorder{transport: client.HTTPClient.Transport}
+	client.HTTPClient.Transport = recorder
 	return ApiClient{
 		ldClient: ldapi.NewAPIClient(&ldapi.Configuration{
-			BasePath:  options.BaseUri + v2ApiPath,
-			UserAgent: options.UserAgent,
+			BasePath:      options.BaseUri + v2ApiPath,
+			DefaultHeader: options.Headers,
+			UserAgent:     options.UserAgent,
+			HTTPClient:    &http.Client{Transport: recorder},
 		}),
 		httpClient: client,
+		recorder:   recorder,
 		Options:    options,
 	}
 }
 
+// GetFlagKeyList returns the keys of all flags in the project, including archived flags. If the FlagFilter or MaxFlags
+// options are set, only matching flags are returned, and active flags take precedence over archived flags.
 func (c ApiClient) GetFlagKeyList() ([]string, error) {
+	flags, err := c.listFlags()
+	if err != nil {
+		return nil, err
+	}
+	return flagKeys(flags), nil
+}
+
+// GetFlagTags returns the tags of each flag retrieved by GetFlagKeyList. Flags without tags are omitted.
+func (c ApiClient) GetFlagTags() (map[string][]string, error) {
+	flags, err := c.listFlags()
+	if err != nil {
+		return nil, err
+	}
+	ret := map[string][]string{}
+	for _, flag := range flags {
+		if len(flag.Tags) > 0 {
+			ret[flag.Key] = flag.Tags
+		}
+	}
+	return ret, nil
+}
+
+// FlagMetadata is the ownership of a flag, used to group code references by team or initiative
+type FlagMetadata struct {
+	Tags []string `json:"tags"`
+	// Maintainer is the email address of the member maintaining the flag, if any
+	Maintainer string `json:"maintainer,omitempty"`
+}
+
+// GetFlagMetadata returns the tags and maintainer of each flag retrieved by GetFlagKeyList
+func (c ApiClient) GetFlagMetadata() (map[string]FlagMetadata, error) {
+	flags, err := c.listFlags()
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]FlagMetadata, len(flags))
+	for _, flag := range flags {
+		metadata := FlagMetadata{Tags: flag.Tags}
+		if metadata.Tags == nil {
+			metadata.Tags = []string{}
+		}
+		if flag.Maintainer != nil {
+			metadata.Maintainer = flag.Maintainer.Email
+		}
+		ret[flag.Key] = metadata
+	}
+	return ret, nil
+}
+
+// listFlags returns the active flags in the project followed by the archived flags, limited to MaxFlags flags in total
+func (c ApiClient) listFlags() ([]ldapi.FeatureFlag, error) {
+	flags, err := c.getFlags(&ldapi.GetFeatureFlagsOpts{Summary: optional.NewBool(true)}, c.Options.MaxFlags)
+	if err != nil {
+		return nil, err
+	}
+
+	maxArchived := 0
+	if c.Options.MaxFlags > 0 {
+		maxArchived = c.Options.MaxFlags - len(flags)
+		if maxArchived <= 0 {
+			return flags, nil
+		}
+	}
+	archivedFlags, err := c.getFlags(&ldapi.GetFeatureFlagsOpts{Archived: optional.NewBool(true), Summary: optional.NewBool(true)}, maxArchived)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(flags, archivedFlags...), nil
+}
+
+// GetArchivedFlagKeyList returns the keys of all archived flags in the project
+func (c ApiClient) GetArchivedFlagKeyList() ([]string, error) {
+	flags, err := c.getFlags(&ldapi.GetFeatureFlagsOpts{Archived: optional.NewBool(true), Summary: optional.NewBool(true)}, c.Options.MaxFlags)
+	if err != nil {
+		return nil, err
+	}
+	return flagKeys(flags), nil
+}
+
+func flagKeys(flags []ldapi.FeatureFlag) []string {
+	ret := make([]string, 0, len(flags))
+	for _, flag := range flags {
+		ret = append(ret, flag.Key)
+	}
+	return ret
+}
+
+// GetArchivedFlagConstantValues returns the value served by each archived flag which serves the same variation to all users in every environment.
+// Archived flags which may serve more than one variation are omitted.
+func (c ApiClient) GetArchivedFlagConstantValues() (map[string]interface{}, error) {
+	// pages are requested concurrently
+	var mu sync.Mutex
+	offVariations := map[string]map[string]bool{}
+	getPage := func(opts ldapi.GetFeatureFlagsOpts, offset int) ([]ldapi.FeatureFlag, int, error) {
+		body, err := c.getFlagPageBody(opts, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		var flags ldapi.FeatureFlags
+		err = json.Unmarshal(body, &flags)
+		if err != nil {
+			return nil, 0, err
+		}
+		page, err := decodeOffVariations(body)
+		if err != nil {
+			return nil, 0, err
+		}
+		mu.Lock()
+		for key, environments := range page {
+			offVariations[key] = environments
+		}
+		mu.Unlock()
+		return flags.Items, int(flags.TotalCount), nil
+	}
+	flags, err := c.paginateFlags(&ldapi.GetFeatureFlagsOpts{Archived: optional.NewBool(true), Summary: optional.NewBool(false)}, 0, getPage)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := map[string]interface{}{}
+	for _, flag := range flags {
+		value, ok := constantFlagValue(flag, offVariations[flag.Key])
+		if ok {
+			ret[flag.Key] = value
+		}
+	}
+	return ret, nil
+}
+
+// getFlagPageBody returns the undecoded body of a page of flags starting at offset, so fields which the API model cannot
+// represent can be read from it
+func (c ApiClient) getFlagPageBody(opts ldapi.GetFeatureFlagsOpts, offset int) ([]byte, error) {
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(flagPageSize))
+	query.Set("offset", strconv.Itoa(offset))
+	if opts.Archived.IsSet() {
+		query.Set("archived", strconv.FormatBool(opts.Archived.Value()))
+	}
+	if opts.Summary.IsSet() {
+		query.Set("summary", strconv.FormatBool(opts.Summary.Value()))
+	}
+	if opts.Filter.IsSet() {
+		query.Set("filter", opts.Filter.Value())
+	}
+	if opts.Sort.IsSet() {
+		query.Set("sort", opts.Sort.Value())
+	}
+	req, err := h.NewRequest("GET", fmt.Sprintf("%s%s/flags/%s?%s", c.Options.BaseUri, v2ApiPath, url.PathEscape(c.Options.ProjKey), query.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	return ioutil.ReadAll(res.Body)
+}
+
+// decodeOffVariations returns the environments of each flag in a page of flags which have an off variation. The API
+// model decodes a missing off variation as variation 0, but a flag which is off without an off variation serves the
+// fallback value passed to the SDK instead.
+func decodeOffVariations(body []byte) (map[string]map[string]bool, error) {
+	var page struct {
+		Items []struct {
+			Key          string `json:"key"`
+			Environments map[string]struct {
+				OffVariation *int32 `json:"offVariation"`
+			} `json:"environments"`
+		} `json:"items"`
+	}
+	err := json.Unmarshal(body, &page)
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]map[string]bool, len(page.Items))
+	for _, flag := range page.Items {
+		ret[flag.Key] = map[string]bool{}
+		for env, config := range flag.Environments {
+			ret[flag.Key][env] = config.OffVariation != nil
+		}
+	}
+	return ret, nil
+}
+
+// GetRolledOutFlagKeyList returns the keys of active flags which are on, and serve the same variation to all users, in
+// every environment
+func (c ApiClient) GetRolledOutFlagKeyList() ([]string, error) {
+	flags, err := c.getFlags(&ldapi.GetFeatureFlagsOpts{Summary: optional.NewBool(false)}, c.Options.MaxFlags)
+	if err != nil {
+		return nil, err
+	}
+	ret := []string{}
+	for _, flag := range flags {
+		if isRolledOut(flag) {
+			ret = append(ret, flag.Key)
+		}
+	}
+	return ret, nil
+}
+
+// isRolledOut returns true if a flag is on in every environment, and serves the same variation to all users
+func isRolledOut(flag ldapi.FeatureFlag) bool {
+	for _, env := range flag.Environments {
+		if !env.On {
+			return false
+		}
+	}
+	// every environment is on, so off variations are not served
+	_, ok := constantFlagValue(flag, nil)
+	return ok
+}
+
+// constantFlagValue returns the value of the only variation a flag can serve, if every environment serves the same variation without targeting.
+// hasOffVariation are the environments of the flag which have an off variation. Flags which are off in an environment
+// without an off variation serve the fallback value passed to the SDK, so are not constant.
+func constantFlagValue(flag ldapi.FeatureFlag, hasOffVariation map[string]bool) (interface{}, bool) {
+	if len(flag.Environments) == 0 {
+		return nil, false
+	}
+	variation := int32(-1)
+	for name, env := range flag.Environments {
+		if !env.On && !hasOffVariation[name] {
+			return nil, false
+		}
+		served := env.OffVariation
+		if env.On {
+			if len(env.Targets) > 0 || len(env.Rules) > 0 || len(env.Prerequisites) > 0 || env.Fallthrough_ == nil || env.Fallthrough_.Rollout != nil {
+				return nil, false
+			}
+			served = env.Fallthrough_.Variation
+		}
+		if variation >= 0 && served != variation {
+			return nil, false
+		}
+		variation = served
+	}
+	if int(variation) >= len(flag.Variations) || flag.Variations[variation].Value == nil {
+		return nil, false
+	}
+	return *flag.Variations[variation].Value, true
+}
+
+const (
+	// flagPageSize is the number of flags requested in each page
+	flagPageSize = 100
+	// flagPageConcurrency is the maximum number of pages of flags requested at once
+	flagPageConcurrency = 4
+	// maxRateLimitRetries is the number of times a request for a page of flags is retried after being rate limited
+	maxRateLimitRetries = 5
+	// maxRateLimitWait is the longest time waited before retrying a rate limited request
+	maxRateLimitWait = time.Minute
+)
+
+// getFlags returns the flags matching opts, most recently created first. If maxFlags > 0, at most maxFlags flags are
+// returned. The first page reports the total number of flags, so the remaining pages are requested concurrently.
+func (c ApiClient) getFlags(opts *ldapi.GetFeatureFlagsOpts, maxFlags int) ([]ldapi.FeatureFlag, error) {
+	return c.paginateFlags(opts, maxFlags, c.getFlagPage)
+}
+
+// paginateFlags returns the flags matching opts, requesting each page of flags with getPage, which returns a page of flags
+// starting at an offset, and the total number of flags, if known
+func (c ApiClient) paginateFlags(opts *ldapi.GetFeatureFlagsOpts, maxFlags int, getPage func(ldapi.GetFeatureFlagsOpts, int) ([]ldapi.FeatureFlag, int, error)) ([]ldapi.FeatureFlag, error) {
+	if c.Options.FlagFilter != "" {
+		opts.Filter = optional.NewString(c.Options.FlagFilter)
+	}
+	// a consistent order is required for pages requested at different times to not overlap
+	opts.Sort = optional.NewString("-creationDate")
+
+	first, total, err := getPage(*opts, 0)
+	if err != nil {
+		return nil, err
+	}
+	flags := first
+
+	switch {
+	case len(first) < flagPageSize:
+		// all flags were returned in the first page
+	case total > 0:
+		if maxFlags > 0 && maxFlags < total {
+			total = maxFlags
+		}
+		pages := make([][]ldapi.FeatureFlag, (total+flagPageSize-1)/flagPageSize)
+		pages[0] = first
+		errs := make([]error, len(pages))
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, flagPageConcurrency)
+		for i := 1; i < len(pages); i++ {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(i int) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				pages[i], _, errs[i] = getPage(*opts, i*flagPageSize)
+			}(i)
+		}
+		wg.Wait()
+		flags = make([]ldapi.FeatureFlag, 0, total)
+		for i, page := range pages {
+			if errs[i] != nil {
+				return nil, errs[i]
+			}
+			flags = append(flags, page...)
+		}
+	default:
+		// the total number of flags is unknown, so pages are requested until a page is not full
+		for page := first; len(page) == flagPageSize && (maxFlags <= 0 || len(flags) < maxFlags); {
+			page, _, err = getPage(*opts, len(flags))
+			if err != nil {
+				return nil, err
+			}
+			flags = append(flags, page...)
+		}
+	}
+
+	if maxFlags > 0 && len(flags) > maxFlags {
+		flags = flags[:maxFlags]
+	}
+	log.Debug.Printf("retrieved %d flags", len(flags))
+	return flags, nil
+}
+
+// getFlagPage returns a page of flags starting at offset, and the total number of flags, if known. Rate
+// limited requests are retried after the rate limit resets.
+func (c ApiClient) getFlagPage(opts ldapi.GetFeatureFlagsOpts, offset int) ([]ldapi.FeatureFlag, int, error) {
 	ctx := context.WithValue(context.Background(), ldapi.ContextAPIKey, ldapi.APIKey{Key: c.Options.ApiKey})
+	opts.Limit = optional.NewFloat32(flagPageSize)
+	opts.Offset = optional.NewFloat32(float32(offset))
+
+	for attempt := 0; ; attempt++ {
+		flags, res, err := c.ldClient.FeatureFlagsApi.GetFeatureFlags(ctx, c.Options.ProjKey, &opts)
+		if err != nil {
+			if res != nil && res.StatusCode == http.StatusTooManyRequests && attempt < maxRateLimitRetries {
+				wait := rateLimitWait(res, attempt)
+				log.Debug.Printf("rate limited retrieving flags, retrying in %s", wait)
+				time.Sleep(wait)
+				continue
+			}
+			return nil, 0, err
+		}
+		return flags.Items, int(flags.TotalCount), nil
+	}
+}
+
+// rateLimitWait returns the time to wait before retrying a rate limited request, from the Retry-After or
+// X-Ratelimit-Reset headers of the response, or an exponential backoff if neither is present
+func rateLimitWait(res *http.Response, attempt int) time.Duration {
+	wait := time.Second << uint(attempt)
+	if seconds, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil {
+		wait = time.Duration(seconds) * time.Second
+	} else if resetMs, err := strconv.ParseInt(res.Header.Get("X-Ratelimit-Reset"), 10, 64); err == nil {
+		wait = time.Until(time.Unix(0, resetMs*int64(time.Millisecond)))
+	}
+	if wait < 0 {
+		wait = 0
+	} else if wait > maxRateLimitWait {
+		wait = maxRateLimitWait
+	}
+	return wait
+}
 
-	flags, _, err := c.ldClient.FeatureFlagsApi.GetFeatureFlags(ctx, c.Options.ProjKey, &ldapi.GetFeatureFlagsOpts{Summary: optional.NewBool(true)})
+// GetProjectKeys returns the keys of all projects which the access token can read, in alphabetical order
+func (c ApiClient) GetProjectKeys() ([]string, error) {
+	req, err := h.NewRequest("GET", c.Options.BaseUri+projectsPath, nil)
 	if err != nil {
 		return nil, err
 	}
+	res, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
 
-	archivedFlags, _, err := c.ldClient.FeatureFlagsApi.GetFeatureFlags(ctx, c.Options.ProjKey, &ldapi.GetFeatureFlagsOpts{Archived: optional.NewBool(true), Summary: optional.NewBool(true)})
+	var projects struct {
+		Items []struct {
+			Key string `json:"key"`
+		} `json:"items"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&projects)
 	if err != nil {
 		return nil, err
 	}
+	keys := make([]string, 0, len(projects.Items))
+	for _, p := range projects.Items {
+		keys = append(keys, p.Key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// PreflightCheck verifies that the configured access token is able to access the target project and the
+// code references API before a scan is started, so that permission problems are surfaced immediately.
+// If the client does not have a project key, as when scanning all projects, only the code references API is checked.
+// If repoName is not empty, the access token must also be able to update the code references repository, which is
+// checked with an empty update, so that tokens with a reader role fail before the scan rather than when uploading.
+func (c ApiClient) PreflightCheck(repoName string) error {
+	if c.Options.ProjKey != "" {
+		err := c.projectPreflightCheck()
+		if err != nil {
+			return err
+		}
+	}
+
+	req, err := h.NewRequest("GET", c.repoUrl(), nil)
+	if err != nil {
+		return err
+	}
+	res, err := c.do(req)
+	if res != nil {
+		defer res.Body.Close()
+	}
+	if err == ForbiddenErr {
+		return newConfigurationError("access token does not have permission to manage code references, a writer role or a custom role with access to the code-reference-repository resource is required")
+	}
+	if err != nil || repoName == "" {
+		return err
+	}
+	return c.repositoryPreflightCheck(repoName)
+}
 
-	flagKeys := make([]string, 0, len(flags.Items))
-	for _, flag := range append(flags.Items, archivedFlags.Items...) {
-		flagKeys = append(flagKeys, flag.Key)
+func (c ApiClient) repositoryPreflightCheck(repoName string) error {
+	req, err := h.NewRequest("PATCH", fmt.Sprintf("%s/%s", c.repoUrl(), url.PathEscape(repoName)), bytes.NewBufferString("{}"))
+	if err != nil {
+		return err
+	}
+	res, err := c.do(req)
+	if res != nil {
+		defer res.Body.Close()
 	}
+	switch err {
+	case NotFoundErr:
+		// the repository is created when code references are first sent, so there is nothing to update yet
+		return nil
+	case ForbiddenErr:
+		return newConfigurationError(fmt.Sprintf("access token does not have permission to update code references repository %q, a writer role or a custom role with access to the code-reference-repository resource is required", repoName))
+	}
+	return err
+}
 
-	return flagKeys, nil
+func (c ApiClient) projectPreflightCheck() error {
+	req, err := h.NewRequest("GET", fmt.Sprintf("%s%s/%s", c.Options.BaseUri, projectsPath, url.PathEscape(c.Options.ProjKey)), nil)
+	if err != nil {
+		return err
+	}
+	res, err := c.do(req)
+	if res != nil {
+		defer res.Body.Close()
+	}
+	switch {
+	case err == NotFoundErr:
+		return newConfigurationError(fmt.Sprintf("project %q was not found, check that the projKey option is correct and that your access token belongs to the right account", c.Options.ProjKey))
+	case err == UnauthorizedErr:
+		return UnauthorizedErr
+	case err == ForbiddenErr:
+		return newConfigurationError(fmt.Sprintf("access token does not have permission to read project %q, a reader role or a custom role with access to the project is required", c.Options.ProjKey))
+	}
+	return err
 }
 
 func (c ApiClient) repoUrl() string {
@@ -145,7 +607,8 @@ func (c ApiClient) patchCodeReferenceRepository(currentRepo, repo RepoParams) er
 	return nil
 }
 
-func (c ApiClient) getCodeReferenceRepository(name string) (*RepoRep, error) {
+// GetCodeReferenceRepository returns a code references repository. NotFoundErr is returned if the repository does not exist.
+func (c ApiClient) GetCodeReferenceRepository(name string) (*RepoRep, error) {
 	req, err := h.NewRequest("GET", fmt.Sprintf("%s/%s", c.repoUrl(), name), nil)
 	if err != nil {
 		return nil, err
@@ -171,6 +634,16 @@ func (c ApiClient) getCodeReferenceRepository(name string) (*RepoRep, error) {
 	return &repo, err
 }
 
+// DeleteCodeReferenceRepository deletes a code references repository, and the code references of all of its branches
+func (c ApiClient) DeleteCodeReferenceRepository(name string) error {
+	req, err := h.NewRequest("DELETE", fmt.Sprintf("%s/%s", c.repoUrl(), url.PathEscape(name)), nil)
+	if err != nil {
+		return err
+	}
+	_, err = c.do(req)
+	return err
+}
+
 func (c ApiClient) GetCodeReferenceRepositoryBranches(repoName string) ([]BranchRep, error) {
 	req, err := h.NewRequest("GET", fmt.Sprintf("%s/%s/branches", c.repoUrl(), repoName), nil)
 	if err != nil {
@@ -197,6 +670,33 @@ func (c ApiClient) GetCodeReferenceRepositoryBranches(repoName string) ([]Branch
 	return branches.Items, err
 }
 
+// GetCodeReferenceBranch returns a branch of a code references repository, including its code references
+func (c ApiClient) GetCodeReferenceBranch(repoName, branchName string) (*BranchRep, error) {
+	req, err := h.NewRequest("GET", c.branchUrl(repoName, branchName), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resBytes, err := ioutil.ReadAll(res.Body)
+	if res != nil {
+		defer res.Body.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var branch BranchRep
+	err = json.Unmarshal(resBytes, &branch)
+	if err != nil {
+		return nil, err
+	}
+	return &branch, nil
+}
+
 func (c ApiClient) postCodeReferenceRepository(repo RepoParams) error {
 	repoBytes, err := json.Marshal(repo)
 	if err != nil {
@@ -217,15 +717,13 @@ func (c ApiClient) postCodeReferenceRepository(repo RepoParams) error {
 }
 
 func (c ApiClient) MaybeUpsertCodeReferenceRepository(repo RepoParams) error {
-	currentRepo, err := c.getCodeReferenceRepository(repo.Name)
+	currentRepo, err := c.GetCodeReferenceRepository(repo.Name)
 	if err != nil && err != NotFoundErr {
 		return fmt.Errorf("error retrieving repository: %w", err)
 	}
 
 	if currentRepo != nil {
-		if !currentRepo.Enabled {
-			return RepositoryDisabledErr
-		}
+		currentEnabled := currentRepo.Enabled
 		currentRepoParams := RepoParams{
 			Name:              currentRepo.Name,
 			Type:              currentRepo.Type,
@@ -233,6 +731,23 @@ func (c ApiClient) MaybeUpsertCodeReferenceRepository(repo RepoParams) error {
 			CommitUrlTemplate: currentRepo.CommitUrlTemplate,
 			HunkUrlTemplate:   currentRepo.HunkUrlTemplate,
 			DefaultBranch:     currentRepo.DefaultBranch,
+			Description:       currentRepo.Description,
+			Tags:              currentRepo.Tags,
+			Enabled:           &currentEnabled,
+		}
+
+		// Metadata which is not configured is left unchanged
+		if repo.Description == "" {
+			repo.Description = currentRepo.Description
+		}
+		if repo.Tags == nil {
+			repo.Tags = currentRepo.Tags
+		}
+		if repo.Enabled == nil {
+			repo.Enabled = &currentEnabled
+		}
+		if !currentEnabled && !*repo.Enabled {
+			return RepositoryDisabledErr
 		}
 
 		// Don't patch templates if command line arguments are not provided.
@@ -257,6 +772,9 @@ func (c ApiClient) MaybeUpsertCodeReferenceRepository(repo RepoParams) error {
 				return fmt.Errorf("error updating repository: %w", err)
 			}
 		}
+		if !*repo.Enabled {
+			return RepositoryDisabledErr
+		}
 		return nil
 	}
 
@@ -264,22 +782,49 @@ func (c ApiClient) MaybeUpsertCodeReferenceRepository(repo RepoParams) error {
 	if err != nil {
 		return fmt.Errorf("error creating repository: %w", err)
 	}
+	if repo.Enabled != nil && !*repo.Enabled {
+		return RepositoryDisabledErr
+	}
 
 	return nil
 }
 
+// idempotencyKeyHeader identifies requests which are retried, so a request which was applied before its response was lost
+// is not applied again, e.g. rejected because its updateSequenceId is no longer greater than the stored updateSequenceId
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// idempotencyKey returns a key identifying a request body sent to a repository. Retries of a request share its key.
+func idempotencyKey(repoName string, body []byte) string {
+	digest := sha256.New()
+	digest.Write([]byte(repoName))
+	digest.Write([]byte{0})
+	digest.Write(body)
+	return hex.EncodeToString(digest.Sum(nil))
+}
+
+// branchUrl returns the url of a branch of a code references repository. Branch names are escaped, so names containing
+// slashes, '#', or unicode characters address a single path segment.
+func (c ApiClient) branchUrl(repoName, branchName string) string {
+	return fmt.Sprintf("%s%s/%s/branches/%s", c.Options.BaseUri, reposPath, url.PathEscape(repoName), url.PathEscape(branchName))
+}
+
 func (c ApiClient) PutCodeReferenceBranch(branch BranchRep, repoName string) error {
 	branchBytes, err := json.Marshal(branch)
 	if err != nil {
 		return err
 	}
-	putUrl := fmt.Sprintf("%s%s/%s/branches/%s", c.Options.BaseUri, reposPath, repoName, url.PathEscape(branch.Name))
-	req, err := h.NewRequest("PUT", putUrl, bytes.NewBuffer(branchBytes))
+	req, err := h.NewRequest("PUT", c.branchUrl(repoName, branch.Name), bytes.NewBuffer(branchBytes))
 	if err != nil {
 		return err
 	}
+	req.Header.Set(idempotencyKeyHeader, idempotencyKey(repoName, branchBytes))
 
-	_, err = c.do(req)
+	res, err := c.do(req)
+	if res != nil {
+		// drain the response so the connection can be reused by subsequent requests
+		_, _ = io.Copy(ioutil.Discard, res.Body)
+		res.Body.Close()
+	}
 	if err != nil {
 		return err
 	}
@@ -287,13 +832,42 @@ func (c ApiClient) PutCodeReferenceBranch(branch BranchRep, repoName string) err
 	return nil
 }
 
+// PutCodeReferenceBranches sends multiple branches to LaunchDarkly. Up to concurrency requests are sent at once, sharing the
+// client's pooled connections. Returns an error for each branch which could not be sent, keyed by branch name.
+func (c ApiClient) PutCodeReferenceBranches(branches []BranchRep, repoName string, concurrency int) map[string]error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	errs := map[string]error{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for _, branch := range branches {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(branch BranchRep) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			err := c.PutCodeReferenceBranch(branch, repoName)
+			if err != nil {
+				mu.Lock()
+				errs[branch.Name] = err
+				mu.Unlock()
+			}
+		}(branch)
+	}
+	wg.Wait()
+	return errs
+}
+
 func (c ApiClient) PostExtinctionEvents(extinctions []ExtinctionRep, repoName, branchName string) error {
 	data, err := json.Marshal(extinctions)
 	if err != nil {
 		return err
 	}
-	url := fmt.Sprintf("%s%s/%s/branches/%s/extinction-events", c.Options.BaseUri, reposPath, repoName, url.PathEscape(branchName))
-	req, err := h.NewRequest("POST", url, bytes.NewBuffer(data))
+	req, err := h.NewRequest("POST", c.branchUrl(repoName, branchName)+"/extinction-events", bytes.NewBuffer(data))
 	if err != nil {
 		return err
 	}
@@ -331,6 +905,9 @@ type ldErrorResponse struct {
 }
 
 func (c ApiClient) do(req *h.Request) (*http.Response, error) {
+	for name, value := range c.Options.Headers {
+		req.Header.Set(name, value)
+	}
 	req.Header.Set("Authorization", c.Options.ApiKey)
 	req.Header.Set("User-Agent", c.Options.UserAgent)
 	req.Header.Set("Content-Type", "application/json")
@@ -380,6 +957,8 @@ func fallbackErrorForStatus(code int) error {
 		return errors.New("bad request")
 	case http.StatusUnauthorized:
 		return UnauthorizedErr
+	case http.StatusForbidden:
+		return ForbiddenErr
 	case http.StatusNotFound:
 		return NotFoundErr
 	case http.StatusConflict:
@@ -404,16 +983,22 @@ type RepoParams struct {
 	CommitUrlTemplate string `json:"commitUrlTemplate"`
 	HunkUrlTemplate   string `json:"hunkUrlTemplate"`
 	DefaultBranch     string `json:"defaultBranch"`
+	// Metadata which is not set is left unchanged when updating an existing repository
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Enabled     *bool    `json:"enabled,omitempty"`
 }
 
 type RepoRep struct {
-	Type              string `json:"type"`
-	Name              string `json:"name"`
-	Url               string `json:"sourceLink"`
-	CommitUrlTemplate string `json:"commitUrlTemplate"`
-	HunkUrlTemplate   string `json:"hunkUrlTemplate"`
-	DefaultBranch     string `json:"defaultBranch"`
-	Enabled           bool   `json:"enabled,omitempty"`
+	Type              string   `json:"type"`
+	Name              string   `json:"name"`
+	Url               string   `json:"sourceLink"`
+	CommitUrlTemplate string   `json:"commitUrlTemplate"`
+	HunkUrlTemplate   string   `json:"hunkUrlTemplate"`
+	DefaultBranch     string   `json:"defaultBranch"`
+	Description       string   `json:"description,omitempty"`
+	Tags              []string `json:"tags,omitempty"`
+	Enabled           bool     `json:"enabled,omitempty"`
 }
 
 type BranchCollection struct {
@@ -436,47 +1021,33 @@ func (b BranchRep) TotalHunkCount() int {
 	return count
 }
 
-func (b BranchRep) WriteToCSV(outDir, projKey, repo, sha string) (path string, err error) {
-	// Try to create a filename with a shortened sha, but if the sha is too short for some unexpected reason, use the branch name instead
-	var tag string
+// FileTag identifies a scan in the names of output files. Try to use a shortened sha, but if the sha is too short for
+// some unexpected reason, use the branch name instead, replacing characters which are not safe in file names such as '/'.
+func (b BranchRep) FileTag(sha string) string {
 	if len(sha) >= 7 {
-		tag = sha[:7]
-	} else {
-		tag = b.Name
+		return sha[:7]
 	}
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, b.Name)
+}
 
+// WriteToJSON writes the branch as JSON, in the format sent to LaunchDarkly, named to match the CSV output of the same scan
+func (b BranchRep) WriteToJSON(outDir, projKey, repo, sha string) (string, error) {
+	tag := b.FileTag(sha)
 	absPath, err := validation.NormalizeAndValidatePath(outDir)
 	if err != nil {
 		return "", fmt.Errorf("invalid outDir '%s': %w", outDir, err)
 	}
-	path = filepath.Join(absPath, fmt.Sprintf("coderefs_%s_%s_%s.csv", projKey, repo, tag))
-
-	f, err := os.Create(path)
+	path := filepath.Join(absPath, fmt.Sprintf("coderefs_%s_%s_%s_branch.json", projKey, repo, tag))
+	data, err := json.Marshal(b)
 	if err != nil {
 		return "", err
 	}
-	defer f.Close()
-
-	w := csv.NewWriter(f)
-	records := make([][]string, 0, len(b.References)+1)
-	for _, ref := range b.References {
-		records = append(records, ref.toRecords()...)
-	}
-
-	// sort csv by flag key
-	sort.Slice(records, func(i, j int) bool {
-		// sort by flagKey -> path -> startingLineNumber
-		for k := 0; k < 3; k++ {
-			if records[i][k] != records[j][k] {
-				return records[i][k] < records[j][k]
-			}
-		}
-		// above loop should always return since startingLineNumber is guaranteed to be unique
-		return false
-	})
-
-	records = append([][]string{{"flagKey", "path", "startingLineNumber", "lines", "aliases"}}, records...)
-	return path, w.WriteAll(records)
+	return path, ioutil.WriteFile(path, data, 0600)
 }
 
 type ReferenceHunksRep struct {
@@ -484,20 +1055,80 @@ type ReferenceHunksRep struct {
 	Hunks []HunkRep `json:"hunks"`
 }
 
-func (r ReferenceHunksRep) toRecords() [][]string {
-	ret := make([][]string, 0, len(r.Hunks))
-	for _, hunk := range r.Hunks {
-		ret = append(ret, []string{hunk.FlagKey, r.Path, strconv.FormatInt(int64(hunk.StartingLineNumber), 10), hunk.Lines, strings.Join(hunk.Aliases, " ")})
-	}
-	return ret
-}
-
 type HunkRep struct {
 	StartingLineNumber int      `json:"startingLineNumber"`
 	Lines              string   `json:"lines,omitempty"`
 	ProjKey            string   `json:"projKey"`
 	FlagKey            string   `json:"flagKey"`
 	Aliases            []string `json:"aliases,omitempty"`
+	// SDKCall is the SDK evaluation method called with the flag key in the hunk, if detected. It is only included in CSV output.
+	SDKCall string `json:"-"`
+	// Confidence is how likely the hunk is to be a genuine reference to the flag, if scored. It is only included in CSV output.
+	Confidence Confidence `json:"-"`
+	// Tags and Maintainer are the tags and maintainer of the flag, if the flagMetadata option is enabled. They are only
+	// included in CSV output.
+	Tags       []string `json:"-"`
+	Maintainer string   `json:"-"`
+	// AliasMatches are the aliases matched by a hunk which does not contain the flag key, and the alias configuration
+	// which generated each
+	AliasMatches []AliasMatch `json:"aliasMatches,omitempty"`
+	// Matches are the positions of each occurrence of the flag key or its aliases in the hunk
+	Matches []Match `json:"matches,omitempty"`
+}
+
+// Match is the position of an occurrence of a flag key, or one of its aliases, in a file
+type Match struct {
+	LineNumber int `json:"lineNumber"`
+	// Column is the 1-based offset of the start of the match in its line, measured in the configured line length unit
+	Column int `json:"column"`
+	// Alias is the matched alias, if the flag key itself was not matched
+	Alias string `json:"alias,omitempty"`
+}
+
+// AliasMatch is an alias matched by a hunk, and the name of the alias configuration which generated it
+type AliasMatch struct {
+	Alias string `json:"alias"`
+	Rule  string `json:"rule"`
+}
+
+// IsAliasOnly returns true if the hunk only references its flag through aliases
+func (h HunkRep) IsAliasOnly() bool {
+	return len(h.AliasMatches) > 0
+}
+
+// Confidence ranks how likely a hunk is to be a genuine reference to its flag
+type Confidence int
+
+const (
+	// ConfidenceSubstring is a flag key matched without quotes, e.g. with custom delimiters or no delimiters
+	ConfidenceSubstring Confidence = iota + 1
+	// ConfidenceAlias is a match of a flag key alias, without the flag key
+	ConfidenceAlias
+	// ConfidenceQuoted is a flag key in a string literal
+	ConfidenceQuoted
+	// ConfidenceSDKCall is a flag key in a string literal passed to an SDK evaluation method
+	ConfidenceSDKCall
+)
+
+var confidenceNames = map[Confidence]string{
+	ConfidenceSubstring: "substring",
+	ConfidenceAlias:     "alias",
+	ConfidenceQuoted:    "quoted",
+	ConfidenceSDKCall:   "sdkCall",
+}
+
+// ParseConfidence parses the name of a confidence level
+func ParseConfidence(name string) (Confidence, error) {
+	for c, n := range confidenceNames {
+		if n == name {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("'%s' is not a valid confidence, must be one of: substring, alias, quoted, sdkCall", name)
+}
+
+func (c Confidence) String() string {
+	return confidenceNames[c]
 }
 
 // Returns the number of lines overlapping between the receiver (h) and the parameter (hr) hunkreps
@@ -518,24 +1149,6 @@ type ExtinctionRep struct {
 	FlagKey  string `json:"flagKey"`
 }
 
-type tableData [][]string
-
-func (t tableData) Len() int {
-	return len(t)
-}
-
-func (t tableData) Less(i, j int) bool {
-	first, _ := strconv.ParseInt(t[i][1], 10, 32)
-	second, _ := strconv.ParseInt(t[j][1], 10, 32)
-	return first > second
-}
-
-func (t tableData) Swap(i, j int) {
-	t[i], t[j] = t[j], t[i]
-}
-
-const maxFlagKeysDisplayed = 50
-
 func (b BranchRep) CountByFlag(flags []string) map[string]int64 {
 	refCountByFlag := map[string]int64{}
 	for _, flag := range flags {
@@ -548,30 +1161,3 @@ func (b BranchRep) CountByFlag(flags []string) map[string]int64 {
 	}
 	return refCountByFlag
 }
-
-func (b BranchRep) PrintReferenceCountTable() {
-	data := tableData{}
-
-	for k, v := range b.CountByFlag(nil) {
-		data = append(data, []string{k, strconv.FormatInt(v, 10)})
-	}
-	sort.Sort(data)
-
-	truncatedData := data
-	var additionalRefCount int64 = 0
-	if len(truncatedData) > maxFlagKeysDisplayed {
-		truncatedData = data[0:maxFlagKeysDisplayed]
-
-		for _, v := range data[maxFlagKeysDisplayed:] {
-			i, _ := strconv.ParseInt(v[1], 10, 64)
-			additionalRefCount += i
-		}
-	}
-	truncatedData = append(truncatedData, []string{"Other flags", strconv.FormatInt(additionalRefCount, 10)})
-
-	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"Flag", "# References"})
-	table.SetBorder(false)
-	table.AppendBulk(truncatedData)
-	table.Render()
-}
@@ -1,13 +1,20 @@
 package ld
 
 import (
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	ldapi "github.com/launchdarkly/api-client-go"
 	"github.com/launchdarkly/ld-find-code-refs/internal/log"
 )
 
@@ -61,7 +68,7 @@ func TestGetCodeReferenceRepository(t *testing.T) {
 
 			retryMax := 0
 			client := InitApiClient(ApiOptions{ApiKey: "api-x", ProjKey: "default", BaseUri: testServer.URL, RetryMax: &retryMax})
-			_, err := client.getCodeReferenceRepository("test")
+			_, err := client.GetCodeReferenceRepository("test")
 			require.Equal(t, tt.expectedErr, err)
 		})
 	}
@@ -117,6 +124,99 @@ func TestPutCodeReferenceBranch(t *testing.T) {
 	}
 }
 
+func TestPutCodeReferenceBranch_escapesBranchName(t *testing.T) {
+	var escapedPath, path string
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		escapedPath, path = req.URL.EscapedPath(), req.URL.Path
+		res.WriteHeader(http.StatusOK)
+	}))
+	defer testServer.Close()
+
+	retryMax := 0
+	client := InitApiClient(ApiOptions{ApiKey: "api-x", ProjKey: "default", BaseUri: testServer.URL, RetryMax: &retryMax})
+	require.NoError(t, client.PutCodeReferenceBranch(BranchRep{Name: "feature/ABC#123-añadir"}, "test"))
+	assert.Equal(t, "/api/v2/code-refs/repositories/test/branches/feature%2FABC%23123-a%C3%B1adir", escapedPath)
+	assert.Equal(t, "/api/v2/code-refs/repositories/test/branches/feature/ABC#123-añadir", path)
+
+	require.NoError(t, client.PostExtinctionEvents([]ExtinctionRep{}, "test", "feature/ABC#123-añadir"))
+	assert.Equal(t, "/api/v2/code-refs/repositories/test/branches/feature%2FABC%23123-a%C3%B1adir/extinction-events", escapedPath)
+
+	assert.Equal(t, "/api/v2/code-refs/repositories/test/branches/feature%2FABC%23123-a%C3%B1adir", client.RequestStats()[0].Path)
+}
+
+func TestPutCodeReferenceBranch_idempotencyKey(t *testing.T) {
+	keys := []string{}
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		keys = append(keys, req.Header.Get("Idempotency-Key"))
+		if len(keys) == 1 {
+			res.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		res.WriteHeader(http.StatusOK)
+	}))
+	defer testServer.Close()
+
+	retryMax := 1
+	client := InitApiClient(ApiOptions{ApiKey: "api-x", ProjKey: "default", BaseUri: testServer.URL, RetryMax: &retryMax})
+	require.NoError(t, client.PutCodeReferenceBranch(BranchRep{Name: "main", SyncTime: 1}, "test"))
+	require.NoError(t, client.PutCodeReferenceBranch(BranchRep{Name: "main", SyncTime: 2}, "test"))
+	require.Len(t, keys, 3)
+	assert.NotEmpty(t, keys[0])
+	assert.Equal(t, keys[0], keys[1], "retries share the key of the request")
+	assert.NotEqual(t, keys[1], keys[2])
+}
+
+func TestApiClient_headers(t *testing.T) {
+	type request struct{ userAgent, source, auth string }
+	requests := []request{}
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		requests = append(requests, request{req.Header.Get("User-Agent"), req.Header.Get("X-Request-Source"), req.Header.Get("Authorization")})
+		res.Header().Set("Content-Type", "application/json")
+		_, _ = res.Write([]byte(`{"items": []}`))
+	}))
+	defer testServer.Close()
+
+	retryMax := 0
+	client := InitApiClient(ApiOptions{
+		ApiKey:    "api-x",
+		ProjKey:   "default",
+		BaseUri:   testServer.URL,
+		RetryMax:  &retryMax,
+		UserAgent: "LDFindCodeRefs/2.0.0 nightly-scan",
+		Headers:   map[string]string{"X-Request-Source": "nightly-scan"},
+	})
+	require.NoError(t, client.PutCodeReferenceBranch(BranchRep{Name: "main"}, "test"))
+	_, err := client.GetFlagKeyList()
+	require.NoError(t, err)
+	require.NotEmpty(t, requests)
+	for _, r := range requests {
+		assert.Equal(t, request{"LDFindCodeRefs/2.0.0 nightly-scan", "nightly-scan", "api-x"}, r)
+	}
+}
+
+func TestBranchRep_FileTag(t *testing.T) {
+	branch := BranchRep{Name: "feature/ABC#123-añadir"}
+	assert.Equal(t, "0123456", branch.FileTag("0123456789"))
+	assert.Equal(t, "feature_ABC_123-añadir", branch.FileTag(""))
+}
+
+func TestPutCodeReferenceBranches(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if strings.HasSuffix(req.URL.Path, "/branches/broken") {
+			res.WriteHeader(http.StatusNotFound)
+			return
+		}
+		res.WriteHeader(http.StatusOK)
+	}))
+	defer testServer.Close()
+
+	retryMax := 0
+	client := InitApiClient(ApiOptions{ApiKey: "api-x", ProjKey: "default", BaseUri: testServer.URL, RetryMax: &retryMax})
+	branches := []BranchRep{{Name: "main"}, {Name: "broken"}, {Name: "release"}}
+	errs := client.PutCodeReferenceBranches(branches, "test", 2)
+	require.Equal(t, map[string]error{"broken": NotFoundErr}, errs)
+}
+
 func TestPostDeleteBranchesTask(t *testing.T) {
 	specs := []struct {
 		name           string
@@ -167,3 +267,272 @@ func TestGetCodeReferenceRepositoryBranches(t *testing.T) {
 		})
 	}
 }
+
+func TestPreflightCheck(t *testing.T) {
+	specs := []struct {
+		name          string
+		projectStatus int
+		reposStatus   int
+		patchStatus   int
+		expectErr     bool
+		transient     bool
+	}{
+		{"succeeds", 200, 200, 200, false, false},
+		{"succeeds before the repository is created", 200, 200, 404, false, false},
+		{"fails on unknown project", 404, 200, 200, true, false},
+		{"fails on invalid token", 401, 200, 200, true, false},
+		{"fails on missing code references permission", 200, 403, 200, true, false},
+		{"fails on missing repository write permission", 200, 200, 403, true, false},
+		{"fails transiently on service error", 503, 200, 200, true, true},
+	}
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			patched := false
+			testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				switch {
+				case req.URL.Path == projectsPath+"/default":
+					res.WriteHeader(tt.projectStatus)
+				case req.Method == "PATCH":
+					body, _ := ioutil.ReadAll(req.Body)
+					assert.Equal(t, reposPath+"/repo", req.URL.Path)
+					assert.Equal(t, "{}", string(body), "repository is not modified")
+					patched = true
+					res.WriteHeader(tt.patchStatus)
+				default:
+					res.WriteHeader(tt.reposStatus)
+				}
+			}))
+			defer testServer.Close()
+
+			retryMax := 0
+			client := InitApiClient(ApiOptions{ApiKey: "api-x", ProjKey: "default", BaseUri: testServer.URL, RetryMax: &retryMax})
+			if tt.patchStatus == 403 {
+				require.NoError(t, client.PreflightCheck(""), "write access is not checked without a repository")
+				require.False(t, patched)
+			}
+			err := client.PreflightCheck("repo")
+			if !tt.expectErr {
+				require.NoError(t, err)
+				assert.True(t, patched)
+				return
+			}
+			require.Error(t, err)
+			require.Equal(t, tt.transient, IsTransient(err))
+		})
+	}
+}
+
+func TestPreflightCheck_withoutProject(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if strings.HasPrefix(req.URL.Path, projectsPath) {
+			res.WriteHeader(404)
+		}
+	}))
+	defer testServer.Close()
+
+	retryMax := 0
+	client := InitApiClient(ApiOptions{ApiKey: "api-x", BaseUri: testServer.URL, RetryMax: &retryMax})
+	require.NoError(t, client.PreflightCheck(""), "only the code references API is checked when scanning all projects")
+}
+
+func TestIsRolledOut(t *testing.T) {
+	var on, off interface{} = true, false
+	variations := []ldapi.Variation{{Value: &on}, {Value: &off}}
+	rolledOut := ldapi.FeatureFlag{Variations: variations, Environments: map[string]ldapi.FeatureFlagConfig{
+		"production": {On: true, Fallthrough_: &ldapi.ModelFallthrough{Variation: 0}},
+		"test":       {On: true, Fallthrough_: &ldapi.ModelFallthrough{Variation: 0}},
+	}}
+	assert.True(t, isRolledOut(rolledOut))
+
+	partial := ldapi.FeatureFlag{Variations: variations, Environments: map[string]ldapi.FeatureFlagConfig{
+		"production": {On: true, Fallthrough_: &ldapi.ModelFallthrough{Variation: 0}},
+		"test":       {On: false, OffVariation: 0},
+	}}
+	assert.False(t, isRolledOut(partial), "flags which are off in any environment are not rolled out")
+}
+
+func TestConstantFlagValue(t *testing.T) {
+	var on, off interface{} = true, false
+	variations := []ldapi.Variation{{Value: &on}, {Value: &off}}
+	specs := []struct {
+		name           string
+		environments   map[string]ldapi.FeatureFlagConfig
+		noOffVariation []string
+		expectedValue  interface{}
+		expectedOk     bool
+	}{
+		{
+			name: "all environments off",
+			environments: map[string]ldapi.FeatureFlagConfig{
+				"production": {On: false, OffVariation: 1},
+				"test":       {On: false, OffVariation: 1},
+			},
+			expectedValue: false,
+			expectedOk:    true,
+		},
+		{
+			name: "fallthrough matches off variation",
+			environments: map[string]ldapi.FeatureFlagConfig{
+				"production": {On: true, Fallthrough_: &ldapi.ModelFallthrough{Variation: 0}},
+				"test":       {On: false, OffVariation: 0},
+			},
+			expectedValue: true,
+			expectedOk:    true,
+		},
+		{
+			name: "off without an off variation",
+			environments: map[string]ldapi.FeatureFlagConfig{
+				"production": {On: true, Fallthrough_: &ldapi.ModelFallthrough{Variation: 0}},
+				"test":       {On: false},
+			},
+			noOffVariation: []string{"test"},
+		},
+		{
+			name: "environments serve different variations",
+			environments: map[string]ldapi.FeatureFlagConfig{
+				"production": {On: true, Fallthrough_: &ldapi.ModelFallthrough{Variation: 0}},
+				"test":       {On: false, OffVariation: 1},
+			},
+		},
+		{
+			name: "targeting rules",
+			environments: map[string]ldapi.FeatureFlagConfig{
+				"production": {On: true, Fallthrough_: &ldapi.ModelFallthrough{Variation: 0}, Rules: []ldapi.Rule{{Variation: 1}}},
+			},
+		},
+		{
+			name: "percentage rollout",
+			environments: map[string]ldapi.FeatureFlagConfig{
+				"production": {On: true, Fallthrough_: &ldapi.ModelFallthrough{Rollout: &ldapi.Rollout{}}},
+			},
+		},
+	}
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			hasOffVariation := map[string]bool{}
+			for env := range tt.environments {
+				hasOffVariation[env] = true
+			}
+			for _, env := range tt.noOffVariation {
+				hasOffVariation[env] = false
+			}
+			value, ok := constantFlagValue(ldapi.FeatureFlag{Key: "flag", Variations: variations, Environments: tt.environments}, hasOffVariation)
+			require.Equal(t, tt.expectedOk, ok)
+			require.Equal(t, tt.expectedValue, value)
+		})
+	}
+}
+
+func TestGetArchivedFlagConstantValues(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "/api/v2/flags/default", req.URL.Path)
+		assert.Equal(t, "true", req.URL.Query().Get("archived"))
+		_, _ = res.Write([]byte(`{"items": [
+			{"key": "with-off-variation", "variations": [{"value": true}, {"value": false}], "environments": {"production": {"on": false, "offVariation": 0}}},
+			{"key": "without-off-variation", "variations": [{"value": true}, {"value": false}], "environments": {"production": {"on": false}}}
+		]}`))
+	}))
+	defer testServer.Close()
+
+	retryMax := 0
+	client := InitApiClient(ApiOptions{ApiKey: "api-x", ProjKey: "default", BaseUri: testServer.URL, RetryMax: &retryMax})
+	values, err := client.GetArchivedFlagConstantValues()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"with-off-variation": true}, values)
+}
+
+func TestGetArchivedFlagConstantValues_paginated(t *testing.T) {
+	const total = flagPageSize + 50
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+		assert.Equal(t, "true", query.Get("archived"))
+		assert.Equal(t, strconv.Itoa(flagPageSize), query.Get("limit"))
+		offset, err := strconv.Atoi(query.Get("offset"))
+		require.NoError(t, err)
+		items := []string{}
+		for i := offset; i < total && i < offset+flagPageSize; i++ {
+			items = append(items, fmt.Sprintf(`{"key": "flag-%d", "variations": [{"value": true}, {"value": false}], "environments": {"production": {"on": false, "offVariation": 1}}}`, i))
+		}
+		res.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(res, `{"items": [%s], "totalCount": %d}`, strings.Join(items, ","), total)
+	}))
+	defer testServer.Close()
+
+	retryMax := 0
+	client := InitApiClient(ApiOptions{ApiKey: "api-x", ProjKey: "default", BaseUri: testServer.URL, RetryMax: &retryMax})
+	values, err := client.GetArchivedFlagConstantValues()
+	require.NoError(t, err)
+	assert.Len(t, values, total)
+	assert.Equal(t, false, values[fmt.Sprintf("flag-%d", total-1)])
+}
+
+func TestRequestStats(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.Method == "GET" {
+			_, _ = res.Write([]byte(`{"items": []}`))
+			return
+		}
+		res.WriteHeader(http.StatusOK)
+	}))
+	defer testServer.Close()
+
+	retryMax := 0
+	client := InitApiClient(ApiOptions{ApiKey: "api-x", ProjKey: "default", BaseUri: testServer.URL, RetryMax: &retryMax})
+	require.NoError(t, client.PutCodeReferenceBranch(BranchRep{Name: "main"}, "test"))
+	_, err := client.GetArchivedFlagKeyList()
+	require.NoError(t, err)
+
+	stats := client.RequestStats()
+	require.Len(t, stats, 2)
+	assert.Equal(t, "PUT", stats[0].Method)
+	assert.Equal(t, "/api/v2/code-refs/repositories/test/branches/main", stats[0].Path)
+	assert.Equal(t, http.StatusOK, stats[0].Status)
+	assert.Equal(t, int64(len(`{"name":"main","head":"","syncTime":0}`)), stats[0].RequestBytes)
+	assert.Equal(t, "GET", stats[1].Method)
+	assert.Equal(t, "/api/v2/flags/default", stats[1].Path)
+	assert.Equal(t, int64(len(`{"items": []}`)), stats[1].ResponseBytes)
+
+	assert.Contains(t, client.RequestSummary(), "Total (2 requests)")
+}
+
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "512 B", formatBytes(512))
+	assert.Equal(t, "1.5 KiB", formatBytes(1536))
+	assert.Equal(t, "2.0 MiB", formatBytes(2<<20))
+}
+
+func TestGetFlagKeyList_rateLimited(t *testing.T) {
+	requests := 0
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		requests++
+		if requests == 1 {
+			res.Header().Set("Retry-After", "0")
+			res.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		assert.Equal(t, "100", req.URL.Query().Get("limit"))
+		assert.Equal(t, "query:checkout", req.URL.Query().Get("filter"))
+		res.Header().Set("Content-Type", "application/json")
+		if req.URL.Query().Get("archived") == "true" {
+			_, _ = res.Write([]byte(`{"items": [{"key": "archived-flag"}]}`))
+			return
+		}
+		_, _ = res.Write([]byte(`{"items": [{"key": "checkout-flag"}]}`))
+	}))
+	defer testServer.Close()
+
+	client := InitApiClient(ApiOptions{ApiKey: "api-x", ProjKey: "default", BaseUri: testServer.URL, FlagFilter: "query:checkout"})
+	flags, err := client.GetFlagKeyList()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"checkout-flag", "archived-flag"}, flags)
+	assert.Equal(t, 3, requests)
+}
+
+func TestRateLimitWait(t *testing.T) {
+	res := &http.Response{Header: http.Header{}}
+	assert.Equal(t, 4*time.Second, rateLimitWait(res, 2))
+	res.Header.Set("Retry-After", "3")
+	assert.Equal(t, 3*time.Second, rateLimitWait(res, 2))
+	res.Header.Set("Retry-After", "3600")
+	assert.Equal(t, maxRateLimitWait, rateLimitWait(res, 2))
+}
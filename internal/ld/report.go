@@ -0,0 +1,257 @@
+package ld
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+)
+
+// Groupings of code references in the reference count report
+const (
+	ReportByFlag      = "flag"
+	ReportByDirectory = "directory"
+	ReportByLanguage  = "language"
+	ReportByTag       = "tag"
+)
+
+// Orders of the rows in the reference count report
+const (
+	ReportSortReferences = "references"
+	ReportSortAliasOnly  = "aliasOnly"
+	ReportSortName       = "name"
+)
+
+// ReportOptions configures the reference count report
+type ReportOptions struct {
+	// Groupings are the groupings of code references to print a table for, in order
+	Groupings []string
+	// Sort is the order of the rows in each table. Rows are sorted by number of references by default.
+	Sort string
+	// Top is the maximum number of rows in each table. References in the remaining rows are counted in a final row. If 0,
+	// all rows are printed.
+	Top int
+	// FlagTags are the tags of each flag, for grouping code references by tag
+	FlagTags map[string][]string
+}
+
+// reportRow counts the code references in a group
+type reportRow struct {
+	name       string
+	flags      map[string]bool
+	files      map[string]bool
+	references int64
+	aliasOnly  int64
+}
+
+func newReportRow(name string) *reportRow {
+	return &reportRow{name: name, flags: map[string]bool{}, files: map[string]bool{}}
+}
+
+func (r *reportRow) add(other *reportRow) {
+	for f := range other.flags {
+		r.flags[f] = true
+	}
+	for f := range other.files {
+		r.files[f] = true
+	}
+	r.references += other.references
+	r.aliasOnly += other.aliasOnly
+}
+
+// PrintReferenceCountTable prints a table of the number of code references in each group, and how many of them only
+// reference their flag through aliases, for each of the report's groupings
+func (b BranchRep) PrintReferenceCountTable(w io.Writer, opts ReportOptions) {
+	for i, grouping := range opts.Groupings {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		b.printReportTable(w, grouping, opts)
+	}
+}
+
+func (b BranchRep) printReportTable(w io.Writer, grouping string, opts ReportOptions) {
+	rowsByName := map[string]*reportRow{}
+	for _, ref := range b.References {
+		for _, hunk := range ref.Hunks {
+			for _, name := range reportGroups(grouping, ref.Path, hunk.FlagKey, opts.FlagTags) {
+				row := rowsByName[name]
+				if row == nil {
+					row = newReportRow(name)
+					rowsByName[name] = row
+				}
+				row.flags[hunk.FlagKey] = true
+				row.files[ref.Path] = true
+				row.references++
+				if hunk.IsAliasOnly() {
+					row.aliasOnly++
+				}
+			}
+		}
+	}
+
+	rows := make([]*reportRow, 0, len(rowsByName))
+	for _, row := range rowsByName {
+		rows = append(rows, row)
+	}
+	sortReportRows(rows, opts.Sort)
+
+	var other *reportRow
+	if opts.Top > 0 && len(rows) > opts.Top {
+		other = newReportRow("Other " + reportGroupingPlurals[grouping])
+		for _, row := range rows[opts.Top:] {
+			other.add(row)
+		}
+		rows = append(rows[:opts.Top], other)
+	}
+
+	title := reportGroupingTitles[grouping]
+	fmt.Fprintln(w, log.Highlight("References by "+strings.ToLower(title)))
+	table := tablewriter.NewWriter(w)
+	if grouping == ReportByFlag {
+		table.SetHeader([]string{title, "# Files", "# References", "# Alias only"})
+	} else {
+		table.SetHeader([]string{title, "# Flags", "# Files", "# References", "# Alias only"})
+	}
+	table.SetBorder(false)
+	table.SetAutoWrapText(false)
+	for _, row := range rows {
+		cells := []string{row.name}
+		if grouping != ReportByFlag {
+			cells = append(cells, strconv.Itoa(len(row.flags)))
+		}
+		cells = append(cells, strconv.Itoa(len(row.files)), strconv.FormatInt(row.references, 10), strconv.FormatInt(row.aliasOnly, 10))
+		table.Append(cells)
+	}
+	table.Render()
+}
+
+var reportGroupingTitles = map[string]string{
+	ReportByFlag:      "Flag",
+	ReportByDirectory: "Directory",
+	ReportByLanguage:  "Language",
+	ReportByTag:       "Tag",
+}
+
+var reportGroupingPlurals = map[string]string{
+	ReportByFlag:      "flags",
+	ReportByDirectory: "directories",
+	ReportByLanguage:  "languages",
+	ReportByTag:       "tags",
+}
+
+// reportGroups returns the groups a code reference is counted in. References to flags with more than one tag are
+// counted in each tag.
+func reportGroups(grouping, filePath, flagKey string, flagTags map[string][]string) []string {
+	switch grouping {
+	case ReportByDirectory:
+		return []string{topLevelDirectory(filePath)}
+	case ReportByLanguage:
+		return []string{languageFor(filePath)}
+	case ReportByTag:
+		if tags := flagTags[flagKey]; len(tags) > 0 {
+			return tags
+		}
+		return []string{"(untagged)"}
+	}
+	return []string{flagKey}
+}
+
+func topLevelDirectory(filePath string) string {
+	filePath = filepath.ToSlash(filePath)
+	i := strings.Index(filePath, "/")
+	if i < 0 {
+		return "(root)"
+	}
+	return filePath[:i]
+}
+
+var languagesByExtension = map[string]string{
+	".c":      "C",
+	".h":      "C",
+	".cc":     "C++",
+	".cpp":    "C++",
+	".cxx":    "C++",
+	".hpp":    "C++",
+	".cs":     "C#",
+	".css":    "CSS",
+	".dart":   "Dart",
+	".ex":     "Elixir",
+	".exs":    "Elixir",
+	".erl":    "Erlang",
+	".fs":     "F#",
+	".go":     "Go",
+	".groovy": "Groovy",
+	".html":   "HTML",
+	".java":   "Java",
+	".js":     "JavaScript",
+	".jsx":    "JavaScript",
+	".mjs":    "JavaScript",
+	".cjs":    "JavaScript",
+	".json":   "JSON",
+	".kt":     "Kotlin",
+	".kts":    "Kotlin",
+	".lua":    "Lua",
+	".md":     "Markdown",
+	".m":      "Objective-C",
+	".mm":     "Objective-C",
+	".php":    "PHP",
+	".py":     "Python",
+	".rb":     "Ruby",
+	".erb":    "Ruby",
+	".rs":     "Rust",
+	".scala":  "Scala",
+	".scss":   "SCSS",
+	".sh":     "Shell",
+	".sql":    "SQL",
+	".svelte": "Svelte",
+	".swift":  "Swift",
+	".tf":     "Terraform",
+	".ts":     "TypeScript",
+	".tsx":    "TypeScript",
+	".mts":    "TypeScript",
+	".cts":    "TypeScript",
+	".vb":     "Visual Basic",
+	".vue":    "Vue",
+	".xml":    "XML",
+	".yaml":   "YAML",
+	".yml":    "YAML",
+}
+
+// languageFor returns the language of a file, based on its extension. Files with unrecognized extensions are grouped by
+// extension.
+func languageFor(filePath string) string {
+	ext := strings.ToLower(path.Ext(filepath.ToSlash(filePath)))
+	if language, ok := languagesByExtension[ext]; ok {
+		return language
+	}
+	if ext == "" {
+		return "(no extension)"
+	}
+	return ext
+}
+
+func sortReportRows(rows []*reportRow, order string) {
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		switch order {
+		case ReportSortName:
+			return a.name < b.name
+		case ReportSortAliasOnly:
+			if a.aliasOnly != b.aliasOnly {
+				return a.aliasOnly > b.aliasOnly
+			}
+		}
+		if a.references != b.references {
+			return a.references > b.references
+		}
+		return a.name < b.name
+	})
+}
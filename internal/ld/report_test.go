@@ -0,0 +1,119 @@
+package ld
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testReportBranch() BranchRep {
+	aliasOnly := []AliasMatch{{Alias: "newCheckout", Rule: "aliases[0] (camelcase)"}}
+	return BranchRep{References: []ReferenceHunksRep{
+		{Path: "web/src/checkout.ts", Hunks: []HunkRep{{FlagKey: "new-checkout"}, {FlagKey: "new-checkout", AliasMatches: aliasOnly}, {FlagKey: "dark-mode"}}},
+		{Path: "web/src/theme.ts", Hunks: []HunkRep{{FlagKey: "dark-mode"}}},
+		{Path: "api/checkout.go", Hunks: []HunkRep{{FlagKey: "new-checkout", AliasMatches: aliasOnly}}},
+		{Path: "Makefile", Hunks: []HunkRep{{FlagKey: "legacy-build"}}},
+	}}
+}
+
+func TestPrintReferenceCountTable(t *testing.T) {
+	specs := []struct {
+		name     string
+		opts     ReportOptions
+		expected [][]string
+	}{
+		{
+			name: "by flag",
+			opts: ReportOptions{Groupings: []string{ReportByFlag}},
+			expected: [][]string{
+				{"new-checkout", "2", "3", "2"},
+				{"dark-mode", "2", "2", "0"},
+				{"legacy-build", "1", "1", "0"},
+			},
+		},
+		{
+			name: "by directory",
+			opts: ReportOptions{Groupings: []string{ReportByDirectory}},
+			expected: [][]string{
+				{"web", "2", "2", "4", "1"},
+				{"(root)", "1", "1", "1", "0"},
+				{"api", "1", "1", "1", "1"},
+			},
+		},
+		{
+			name: "by language",
+			opts: ReportOptions{Groupings: []string{ReportByLanguage}},
+			expected: [][]string{
+				{"TypeScript", "2", "2", "4", "1"},
+				{"(no extension)", "1", "1", "1", "0"},
+				{"Go", "1", "1", "1", "1"},
+			},
+		},
+		{
+			name: "by tag",
+			opts: ReportOptions{Groupings: []string{ReportByTag}, FlagTags: map[string][]string{"new-checkout": {"checkout", "web"}, "dark-mode": {"web"}}},
+			expected: [][]string{
+				{"web", "2", "3", "5", "2"},
+				{"checkout", "1", "2", "3", "2"},
+				{"(untagged)", "1", "1", "1", "0"},
+			},
+		},
+		{
+			name: "sorted by alias only references",
+			opts: ReportOptions{Groupings: []string{ReportByDirectory}, Sort: ReportSortAliasOnly},
+			expected: [][]string{
+				{"web", "2", "2", "4", "1"},
+				{"api", "1", "1", "1", "1"},
+				{"(root)", "1", "1", "1", "0"},
+			},
+		},
+		{
+			name: "sorted by name",
+			opts: ReportOptions{Groupings: []string{ReportByFlag}, Sort: ReportSortName},
+			expected: [][]string{
+				{"dark-mode", "2", "2", "0"},
+				{"legacy-build", "1", "1", "0"},
+				{"new-checkout", "2", "3", "2"},
+			},
+		},
+		{
+			name: "top rows",
+			opts: ReportOptions{Groupings: []string{ReportByFlag}, Top: 1},
+			expected: [][]string{
+				{"new-checkout", "2", "3", "2"},
+				{"Other flags", "3", "3", "0"},
+			},
+		},
+	}
+
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			testReportBranch().PrintReferenceCountTable(&buf, tt.opts)
+			assert.Equal(t, tt.expected, reportTableRows(buf.String()))
+		})
+	}
+}
+
+func TestPrintReferenceCountTable_groupings(t *testing.T) {
+	var buf bytes.Buffer
+	testReportBranch().PrintReferenceCountTable(&buf, ReportOptions{Groupings: []string{ReportByFlag, ReportByLanguage}})
+	assert.Contains(t, buf.String(), "References by flag\n")
+	assert.Contains(t, buf.String(), "References by language\n")
+}
+
+// reportTableRows returns the cells of each row of a rendered table, excluding the title and header
+func reportTableRows(table string) [][]string {
+	lines := strings.Split(strings.TrimRight(table, "\n"), "\n")
+	rows := [][]string{}
+	for _, line := range lines[3:] {
+		cells := []string{}
+		for _, cell := range strings.Split(line, "|") {
+			cells = append(cells, strings.TrimSpace(cell))
+		}
+		rows = append(rows, cells)
+	}
+	return rows
+}
@@ -0,0 +1,147 @@
+package ld
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	"github.com/launchdarkly/ld-find-code-refs/internal/tracing"
+)
+
+// RequestStat is the latency and payload sizes of a single request to the LaunchDarkly API. Retried requests are
+// recorded once per attempt.
+type RequestStat struct {
+	Method string
+	Path   string
+	// Status is 0 if no response was received
+	Status int
+	// Latency is the time until the response headers were received
+	Latency       time.Duration
+	RequestBytes  int64
+	ResponseBytes int64
+}
+
+// requestRecorder is an http.RoundTripper which records the latency and payload sizes of each request
+type requestRecorder struct {
+	transport http.RoundTripper
+	// tracer, if set, records a span for each request, as a child of its current span
+	tracer *tracing.Tracer
+	mu     sync.Mutex
+	stats  []*RequestStat
+}
+
+func (r *requestRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	stat := &RequestStat{Method: req.Method, Path: req.URL.EscapedPath()}
+	if req.ContentLength > 0 {
+		stat.RequestBytes = req.ContentLength
+	}
+	span := r.tracer.Start(req.Method, r.tracer.Current(), tracing.KindClient)
+	span.SetAttribute("http.request.method", req.Method)
+	span.SetAttribute("server.address", req.URL.Hostname())
+	span.SetAttribute("url.path", stat.Path)
+	start := time.Now()
+	res, err := r.transport.RoundTrip(req)
+	stat.Latency = time.Since(start)
+	span.SetError(err)
+	if res != nil {
+		span.SetAttribute("http.response.status_code", res.StatusCode)
+	}
+	span.End()
+	r.mu.Lock()
+	r.stats = append(r.stats, stat)
+	r.mu.Unlock()
+	if err != nil {
+		log.Trace.Printf("%s %s failed after %s: %s", req.Method, req.URL.RequestURI(), stat.Latency, err)
+	}
+	if res != nil {
+		log.Trace.Printf("%s %s returned %d in %s, sent %d bytes", req.Method, req.URL.RequestURI(), res.StatusCode, stat.Latency, stat.RequestBytes)
+		stat.Status = res.StatusCode
+		// the response body may be read after the request returns, so it is counted as it is read
+		res.Body = &countingBody{ReadCloser: res.Body, recorder: r, stat: stat}
+	}
+	return res, err
+}
+
+// RequestStats returns the recorded requests, in the order they were sent
+func (r *requestRecorder) RequestStats() []RequestStat {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ret := make([]RequestStat, 0, len(r.stats))
+	for _, s := range r.stats {
+		ret = append(ret, *s)
+	}
+	return ret
+}
+
+type countingBody struct {
+	io.ReadCloser
+	recorder *requestRecorder
+	stat     *RequestStat
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.recorder.mu.Lock()
+	b.stat.ResponseBytes += int64(n)
+	b.recorder.mu.Unlock()
+	return n, err
+}
+
+// SetTracer records a span for each request sent by the client, as a child of the current span of the tracer. It must be
+// called before any requests are sent.
+func (c ApiClient) SetTracer(t *tracing.Tracer) {
+	if c.recorder != nil {
+		c.recorder.tracer = t
+	}
+}
+
+// RequestStats returns the latency and payload sizes of each request sent by the client, in the order they were sent
+func (c ApiClient) RequestStats() []RequestStat {
+	if c.recorder == nil {
+		return nil
+	}
+	return c.recorder.RequestStats()
+}
+
+// RequestSummary renders a table of the latency and payload sizes of each request sent by the client
+func (c ApiClient) RequestSummary() string {
+	var sb strings.Builder
+	table := tablewriter.NewWriter(&sb)
+	table.SetHeader([]string{"Request", "Status", "Latency", "Sent", "Received"})
+	table.SetBorder(false)
+	table.SetAutoWrapText(false)
+	var total time.Duration
+	var sent, received int64
+	stats := c.RequestStats()
+	for _, s := range stats {
+		status := "-"
+		if s.Status != 0 {
+			status = strconv.Itoa(s.Status)
+		}
+		path := strings.TrimPrefix(s.Path, v2ApiPath)
+		table.Append([]string{s.Method + " " + path, status, s.Latency.Round(time.Millisecond).String(), formatBytes(s.RequestBytes), formatBytes(s.ResponseBytes)})
+		total += s.Latency
+		sent += s.RequestBytes
+		received += s.ResponseBytes
+	}
+	table.Append([]string{"Total (" + strconv.Itoa(len(stats)) + " requests)", "", total.Round(time.Millisecond).String(), formatBytes(sent), formatBytes(received)})
+	table.Render()
+	return sb.String()
+}
+
+// formatBytes renders a payload size in B, KiB, or MiB
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return strconv.FormatFloat(float64(n)/(1<<20), 'f', 1, 64) + " MiB"
+	case n >= 1<<10:
+		return strconv.FormatFloat(float64(n)/(1<<10), 'f', 1, 64) + " KiB"
+	}
+	return strconv.FormatInt(n, 10) + " B"
+}
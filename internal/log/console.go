@@ -0,0 +1,162 @@
+package log
+
+import (
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+)
+
+// Console output formats
+const (
+	// FormatAuto uses the pretty format when standard output is a terminal, and the plain format otherwise, e.g. in CI
+	FormatAuto = "auto"
+	// FormatPlain writes timestamped log lines
+	FormatPlain = "plain"
+	// FormatPretty writes log lines without timestamps, and highlights warnings, errors, and summaries in color
+	FormatPretty = "pretty"
+)
+
+var (
+	pretty bool
+	colors bool
+)
+
+// ANSI escape codes
+const (
+	reset  = "\x1b[0m"
+	bold   = "\x1b[1m"
+	dim    = "\x1b[2m"
+	red    = "\x1b[31m"
+	green  = "\x1b[32m"
+	yellow = "\x1b[33m"
+)
+
+// ciEnvVars are set by common CI services. Pretty output is not used by default when any of them are set, since build
+// logs are rarely rendered as a terminal.
+var ciEnvVars = []string{
+	"CI",
+	"BUILD_NUMBER",
+	"TF_BUILD",
+	"TEAMCITY_VERSION",
+	"BITBUCKET_BUILD_NUMBER",
+	"CODEBUILD_BUILD_ID",
+	"bamboo_buildNumber",
+}
+
+// InitFormat overrides the default loggers, writing console output in the given format and logging messages of each
+// module at the given levels
+func InitFormat(l Levels, format string) {
+	initLevels(l)
+	pretty = ResolveFormat(format) == FormatPretty
+	colors = pretty && os.Getenv("NO_COLOR") == ""
+	if !pretty {
+		return
+	}
+
+	Trace = log.New(output(LevelTrace, os.Stdout), Color(dim, "trace: "), log.Lshortfile)
+	Debug = log.New(output(LevelDebug, os.Stdout), Color(dim, "debug: "), log.Lshortfile)
+	Info = log.New(output(LevelInfo, os.Stdout), "", 0)
+	Warning = log.New(output(LevelWarn, os.Stdout), Color(yellow+bold, "warning: "), 0)
+	Error = log.New(os.Stderr, Color(red+bold, "error: "), 0)
+	Success = log.New(output(LevelInfo, os.Stdout), Color(green+bold, "✔ "), 0)
+}
+
+// ResolveFormat returns the format used for console output. The auto format resolves to pretty when standard output is a
+// terminal outside of CI, and plain otherwise.
+func ResolveFormat(format string) string {
+	if format != FormatAuto {
+		return format
+	}
+	if !IsTerminal(os.Stdout) || os.Getenv("TERM") == "dumb" {
+		return FormatPlain
+	}
+	for _, name := range ciEnvVars {
+		if os.Getenv(name) != "" {
+			return FormatPlain
+		}
+	}
+	return FormatPretty
+}
+
+// IsTerminal returns true if f is a terminal
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// Pretty returns true if console output is written in the pretty format
+func Pretty() bool {
+	return pretty
+}
+
+// Color wraps s in the given ANSI escape codes, if console output is in color
+func Color(codes, s string) string {
+	if !colors {
+		return s
+	}
+	return codes + s + reset
+}
+
+// Highlight renders s in bold, if console output is in color
+func Highlight(s string) string {
+	return Color(bold, s)
+}
+
+// console is where console output other than log lines is written, such as tables and the output of hooks
+var console io.Writer = os.Stdout
+
+// Console returns the writer for console output other than log lines
+func Console() io.Writer {
+	return console
+}
+
+// UseStderr writes console output to standard error instead of standard output, so that standard output can be reserved
+// for machine-readable results
+func UseStderr() {
+	for _, l := range []*log.Logger{Trace, Debug, Info, Success, Warning} {
+		redirect(l, func(w io.Writer) io.Writer {
+			if w == os.Stdout {
+				return os.Stderr
+			}
+			return w
+		})
+	}
+	if console == os.Stdout {
+		console = os.Stderr
+	}
+}
+
+// Quiet discards all console output except errors
+func Quiet() {
+	for _, l := range []*log.Logger{Trace, Debug, Info, Success, Warning} {
+		l.SetOutput(ioutil.Discard)
+	}
+	console = ioutil.Discard
+}
+
+// Tee copies console output, and log lines which are not discarded, to w until the returned function is called. Output
+// written concurrently by other goroutines is copied as well.
+func Tee(w io.Writer) (restore func()) {
+	loggers := []*log.Logger{Trace, Debug, Info, Success, Warning, Error}
+	outputs := make([]io.Writer, len(loggers))
+	for i, l := range loggers {
+		outputs[i] = l.Writer()
+		redirect(l, func(out io.Writer) io.Writer {
+			return io.MultiWriter(out, w)
+		})
+	}
+	prevConsole := console
+	if console != ioutil.Discard {
+		console = io.MultiWriter(console, w)
+	}
+	return func() {
+		for i, l := range loggers {
+			l.SetOutput(outputs[i])
+		}
+		console = prevConsole
+	}
+}
@@ -0,0 +1,92 @@
+package log
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveFormat(t *testing.T) {
+	assert.Equal(t, FormatPlain, ResolveFormat(FormatPlain))
+	assert.Equal(t, FormatPretty, ResolveFormat(FormatPretty))
+
+	// standard output is not a terminal when running tests
+	assert.Equal(t, FormatPlain, ResolveFormat(FormatAuto))
+}
+
+func TestIsTerminal(t *testing.T) {
+	f, err := ioutil.TempFile("", "console")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+	assert.False(t, IsTerminal(f))
+}
+
+func TestColor(t *testing.T) {
+	defer os.Setenv("NO_COLOR", os.Getenv("NO_COLOR"))
+	require.NoError(t, os.Unsetenv("NO_COLOR"))
+
+	InitFormat(DefaultLevels(false), FormatPretty)
+	assert.True(t, Pretty())
+	assert.Equal(t, "\x1b[1mflag\x1b[0m", Highlight("flag"))
+
+	require.NoError(t, os.Setenv("NO_COLOR", "1"))
+	InitFormat(DefaultLevels(false), FormatPretty)
+	assert.True(t, Pretty())
+	assert.Equal(t, "flag", Highlight("flag"))
+
+	Init(false)
+	assert.False(t, Pretty())
+	assert.Equal(t, "flag", Highlight("flag"))
+}
+
+func TestUseStderr(t *testing.T) {
+	defer Init(false)
+
+	Init(true)
+	UseStderr()
+	assert.Equal(t, os.Stderr, Info.Writer())
+	assert.Equal(t, os.Stderr, Debug.Writer())
+	assert.Equal(t, os.Stderr, Console())
+
+	Init(false)
+	UseStderr()
+	assert.Equal(t, ioutil.Discard, Debug.Writer(), "disabled debug logging is not enabled")
+}
+
+func TestQuiet(t *testing.T) {
+	defer Init(false)
+
+	Init(true)
+	Quiet()
+	assert.Equal(t, ioutil.Discard, Info.Writer())
+	assert.Equal(t, ioutil.Discard, Warning.Writer())
+	assert.Equal(t, ioutil.Discard, Console())
+	assert.Equal(t, os.Stderr, Error.Writer(), "errors are still written")
+}
+
+func TestTee(t *testing.T) {
+	defer Init(false)
+
+	Init(false)
+	Quiet()
+	Info.SetOutput(ioutil.Discard)
+	Warning.SetOutput(&bytes.Buffer{})
+	var buf bytes.Buffer
+	restore := Tee(&buf)
+	Info.Print("discarded")
+	Warning.Print("copied")
+	Debug.Print("discarded")
+	restore()
+	Warning.Print("not copied")
+
+	assert.NotContains(t, buf.String(), "discarded")
+	assert.Contains(t, buf.String(), "WARNING: ")
+	assert.Contains(t, buf.String(), "copied\n")
+	assert.NotContains(t, buf.String(), "not copied")
+	assert.Equal(t, ioutil.Discard, Console())
+}
@@ -0,0 +1,199 @@
+package log
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"path"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// Level is the verbosity of logging. Messages are logged if their level is at most the level configured.
+type Level int
+
+const (
+	LevelError Level = iota
+	LevelWarn
+	LevelInfo
+	LevelDebug
+	LevelTrace
+)
+
+var levelNames = []string{"error", "warn", "info", "debug", "trace"}
+
+func (l Level) String() string {
+	if l < LevelError || l > LevelTrace {
+		return fmt.Sprintf("Level(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel returns the level with the given name
+func ParseLevel(name string) (Level, error) {
+	for i, n := range levelNames {
+		if strings.EqualFold(name, n) {
+			return Level(i), nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown level %q: must be one of %s", name, strings.Join(levelNames, ", "))
+}
+
+// Modules are the packages whose logging may be configured separately, named by the last element of their import path
+var Modules = []string{"archive", "coderefs", "discovery", "git", "ld", "search", "warnings"}
+
+// Levels is the level of logging of each module. Modules without a level of their own log at the default level.
+type Levels struct {
+	Default Level
+	Modules map[string]Level
+}
+
+// DefaultLevels returns the levels used when no levels are configured: info, or debug if debug is true
+func DefaultLevels(debug bool) Levels {
+	if debug {
+		return Levels{Default: LevelDebug}
+	}
+	return Levels{Default: LevelInfo}
+}
+
+// ParseLevels parses a comma-separated list of levels, where each entry is either a level, which replaces the default
+// level def, or a module and level separated by "=", e.g. "warn,ld=trace,search=info".
+func ParseLevels(spec string, def Level) (Levels, error) {
+	levels := Levels{Default: def}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		module, name := "", entry
+		if i := strings.Index(entry, "="); i >= 0 {
+			module, name = strings.TrimSpace(entry[:i]), strings.TrimSpace(entry[i+1:])
+		}
+		level, err := ParseLevel(name)
+		if err != nil {
+			return Levels{Default: def}, err
+		}
+		if module == "" {
+			levels.Default = level
+			continue
+		}
+		if !isModule(module) {
+			return Levels{Default: def}, fmt.Errorf("unknown module %q: must be one of %s", module, strings.Join(Modules, ", "))
+		}
+		if levels.Modules == nil {
+			levels.Modules = map[string]Level{}
+		}
+		levels.Modules[module] = level
+	}
+	return levels, nil
+}
+
+func isModule(name string) bool {
+	for _, m := range Modules {
+		if m == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Level returns the level of logging of a module
+func (l Levels) Level(module string) Level {
+	if level, ok := l.Modules[module]; ok {
+		return level
+	}
+	return l.Default
+}
+
+// levels is the configured level of logging of each module
+var levels = DefaultLevels(false)
+
+// Enabled returns true if messages of the given level are logged by a module
+func Enabled(module string, level Level) bool {
+	return level <= levels.Level(module)
+}
+
+// output returns the writer for messages of the given level: w if every module logs the level, ioutil.Discard if no
+// module logs it, and a writer which discards messages logged by modules which do not log the level otherwise
+func output(level Level, w io.Writer) io.Writer {
+	min, max := levels.Default, levels.Default
+	for _, l := range levels.Modules {
+		if l < min {
+			min = l
+		}
+		if l > max {
+			max = l
+		}
+	}
+	switch {
+	case level <= min:
+		return w
+	case level > max:
+		return ioutil.Discard
+	}
+	return &moduleWriter{level: level, out: w}
+}
+
+// moduleWriter writes messages of a level logged by modules which log the level
+type moduleWriter struct {
+	level Level
+	out   io.Writer
+}
+
+func (w *moduleWriter) Write(p []byte) (int, error) {
+	if !Enabled(callerModule(), w.level) {
+		return len(p), nil
+	}
+	return w.out.Write(p)
+}
+
+// redirect replaces the destination of a logger's messages with the result of f, keeping messages which the logger's level
+// discards discarded
+func redirect(l *log.Logger, f func(io.Writer) io.Writer) {
+	switch w := l.Writer().(type) {
+	case *moduleWriter:
+		l.SetOutput(&moduleWriter{level: w.level, out: f(w.out)})
+	default:
+		if w != ioutil.Discard {
+			l.SetOutput(f(w))
+		}
+	}
+}
+
+// modulePath is the import path of the ld-find-code-refs module
+var modulePath = strings.TrimSuffix(reflect.TypeOf(Levels{}).PkgPath(), "/internal/log")
+
+// callerModule returns the module which logged a message, i.e. the closest caller within ld-find-code-refs, so messages
+// logged by libraries are attributed to the module using them. Returns an empty string if the caller is not a module,
+// e.g. a main package.
+func callerModule() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if module := moduleOf(frame.Function); module != "" {
+			return module
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+// moduleOf returns the module a function belongs to, given its fully-qualified name, e.g.
+// github.com/launchdarkly/ld-find-code-refs/internal/ld.(*ApiClient).do belongs to ld. Returns an empty string for
+// functions outside ld-find-code-refs, and in this package.
+func moduleOf(function string) string {
+	slash := strings.LastIndex(function, "/")
+	pkg := function
+	if i := strings.Index(function[slash+1:], "."); i >= 0 {
+		pkg = function[:slash+1+i]
+	}
+	if !strings.HasPrefix(pkg, modulePath+"/") || pkg == modulePath+"/internal/log" {
+		return ""
+	}
+	return path.Base(pkg)
+}
@@ -0,0 +1,91 @@
+package log
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLevels(t *testing.T) {
+	specs := []struct {
+		name    string
+		spec    string
+		want    Levels
+		wantErr string
+	}{
+		{name: "empty", spec: "", want: Levels{Default: LevelInfo}},
+		{name: "default level", spec: "TRACE", want: Levels{Default: LevelTrace}},
+		{
+			name: "module overrides",
+			spec: "ld=trace, search=warn",
+			want: Levels{Default: LevelInfo, Modules: map[string]Level{"ld": LevelTrace, "search": LevelWarn}},
+		},
+		{
+			name: "default level and module overrides",
+			spec: "error,ld=debug",
+			want: Levels{Default: LevelError, Modules: map[string]Level{"ld": LevelDebug}},
+		},
+		{name: "unknown level", spec: "ld=verbose", wantErr: `unknown level "verbose": must be one of error, warn, info, debug, trace`},
+		{name: "unknown module", spec: "serach=info", wantErr: `unknown module "serach": must be one of archive, coderefs, discovery, git, ld, search, warnings`},
+	}
+
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			levels, err := ParseLevels(tt.spec, LevelInfo)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				assert.Equal(t, Levels{Default: LevelInfo}, levels)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, levels)
+		})
+	}
+}
+
+func Test_moduleOf(t *testing.T) {
+	assert.Equal(t, "ld", moduleOf(modulePath+"/internal/ld.(*ApiClient).do"))
+	assert.Equal(t, "search", moduleOf(modulePath+"/search.processFiles.func1"))
+	assert.Equal(t, "coderefs", moduleOf(modulePath+"/coderefs.Run"))
+	assert.Equal(t, "", moduleOf(modulePath+"/internal/log.Tee"))
+	assert.Equal(t, "", moduleOf("github.com/hashicorp/go-retryablehttp.(*Client).Do"))
+	assert.Equal(t, "", moduleOf("log.(*Logger).Printf"))
+	assert.Equal(t, "", moduleOf("main.main"))
+}
+
+func TestInitFormat_levels(t *testing.T) {
+	defer Init(false)
+
+	Init(false)
+	assert.Equal(t, ioutil.Discard, Debug.Writer())
+	assert.Equal(t, ioutil.Discard, Trace.Writer())
+	assert.Equal(t, os.Stdout, Info.Writer())
+	assert.True(t, Enabled("ld", LevelInfo))
+	assert.False(t, Enabled("ld", LevelDebug))
+
+	InitFormat(Levels{Default: LevelWarn, Modules: map[string]Level{"ld": LevelTrace}}, FormatPlain)
+	assert.Equal(t, os.Stdout, Warning.Writer())
+	assert.IsType(t, &moduleWriter{}, Info.Writer(), "info messages are only logged by some modules")
+	assert.IsType(t, &moduleWriter{}, Trace.Writer())
+	assert.True(t, Enabled("ld", LevelTrace))
+	assert.False(t, Enabled("search", LevelInfo))
+
+	// messages logged outside of a module, such as by this test, are logged at the default level
+	var buf bytes.Buffer
+	restore := Tee(&buf)
+	Info.Print("discarded")
+	Warning.Print("copied")
+	restore()
+	assert.NotContains(t, buf.String(), "discarded")
+	assert.Contains(t, buf.String(), "copied")
+
+	InitFormat(Levels{Default: LevelDebug, Modules: map[string]Level{"search": LevelError}}, FormatPlain)
+	UseStderr()
+	debug, ok := Debug.Writer().(*moduleWriter)
+	require.True(t, ok)
+	assert.Equal(t, os.Stderr, debug.out, "messages are redirected without logging messages discarded by level")
+}
@@ -1,35 +1,51 @@
 package log
 
 import (
-	"io/ioutil"
 	"log"
 	"os"
 )
 
 // Global package level loggers
 var (
+	Trace   *log.Logger
 	Debug   *log.Logger
 	Info    *log.Logger
+	Success *log.Logger // logs the outcome of a command
 	Warning *log.Logger
 	Error   *log.Logger
 )
 
-// Init overrides the default loggers that write to stdout
+// Init overrides the default loggers that write to stdout, writing console output in the plain format. Debug messages are
+// logged if debug is true.
 func Init(debug bool) {
-	debugHandle := ioutil.Discard
-	if debug {
-		debugHandle = os.Stdout
-	}
+	initLevels(DefaultLevels(debug))
+}
+
+// initLevels overrides the default loggers, writing console output in the plain format and logging messages of each
+// module at the given levels
+func initLevels(l Levels) {
+	levels = l
+	pretty = false
+	colors = false
+	console = os.Stdout
+
+	Trace = log.New(output(LevelTrace, os.Stdout),
+		"TRACE: ",
+		log.Ldate|log.Ltime|log.Lshortfile)
 
-	Debug = log.New(debugHandle,
+	Debug = log.New(output(LevelDebug, os.Stdout),
 		"DEBUG: ",
 		log.Ldate|log.Ltime|log.Lshortfile)
 
-	Info = log.New(os.Stdout,
+	Info = log.New(output(LevelInfo, os.Stdout),
+		"INFO: ",
+		log.Ldate|log.Ltime|log.Lshortfile)
+
+	Success = log.New(output(LevelInfo, os.Stdout),
 		"INFO: ",
 		log.Ldate|log.Ltime|log.Lshortfile)
 
-	Warning = log.New(os.Stdout,
+	Warning = log.New(output(LevelWarn, os.Stdout),
 		"WARNING: ",
 		log.Ldate|log.Ltime|log.Lshortfile)
 
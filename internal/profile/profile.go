@@ -0,0 +1,141 @@
+package profile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/tracing"
+)
+
+const (
+	Cpu   = "cpu"
+	Mem   = "mem"
+	Trace = "trace"
+)
+
+// IsValid returns an error if the given profile type is not supported
+func IsValid(kind string) error {
+	switch kind {
+	case Cpu, Mem, Trace:
+		return nil
+	}
+	return fmt.Errorf("'%s' is not a valid profile type, must be one of: %s, %s, %s", kind, Cpu, Mem, Trace)
+}
+
+// Start begins collecting a profile of the given type, which will be written to a file in dir.
+// The returned function stops profiling and writes the profile, and returns the path of the written file. Calling it
+// again returns the same result without writing the profile again.
+func Start(kind, dir string) (stop func() (string, error), err error) {
+	err = IsValid(kind)
+	if err != nil {
+		return nil, err
+	}
+	ext := "pprof"
+	if kind == Trace {
+		ext = "out"
+	}
+	path := filepath.Join(dir, fmt.Sprintf("ld-find-code-refs.%s.%s", kind, ext))
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case Cpu:
+		err = pprof.StartCPUProfile(f)
+		stop = func() (string, error) {
+			pprof.StopCPUProfile()
+			return path, f.Close()
+		}
+	case Trace:
+		err = trace.Start(f)
+		stop = func() (string, error) {
+			trace.Stop()
+			return path, f.Close()
+		}
+	case Mem:
+		stop = func() (string, error) {
+			defer f.Close()
+			runtime.GC()
+			return path, pprof.WriteHeapProfile(f)
+		}
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	var once sync.Once
+	var stopErr error
+	stopOnce := stop
+	return func() (string, error) {
+		once.Do(func() { _, stopErr = stopOnce() })
+		return path, stopErr
+	}, nil
+}
+
+type phase struct {
+	name     string
+	duration time.Duration
+}
+
+// Timer records the duration of each sequential phase of a scan
+type Timer struct {
+	// Tracer, if set, records a span for each phase, as a child of the root span
+	Tracer *tracing.Tracer
+
+	phases  []phase
+	current string
+	start   time.Time
+	span    *tracing.Span
+}
+
+// Start ends the current phase, if any, and begins timing a new phase
+func (t *Timer) Start(name string) {
+	t.Stop()
+	t.current = name
+	t.start = time.Now()
+	t.span = t.Tracer.Start(name, t.Tracer.Root(), tracing.KindInternal)
+	t.Tracer.SetCurrent(t.span)
+}
+
+// Stop ends the current phase
+func (t *Timer) Stop() {
+	if t.current == "" {
+		return
+	}
+	t.phases = append(t.phases, phase{name: t.current, duration: time.Since(t.start)})
+	t.current = ""
+	t.span.End()
+	t.span = nil
+	t.Tracer.SetCurrent(nil)
+}
+
+// Span returns the span of the current phase, or nil if there is no current phase or tracer
+func (t *Timer) Span() *tracing.Span {
+	return t.span
+}
+
+// Summary renders a table of the duration of each completed phase
+func (t *Timer) Summary() string {
+	var sb strings.Builder
+	table := tablewriter.NewWriter(&sb)
+	table.SetHeader([]string{"Phase", "Duration"})
+	table.SetBorder(false)
+	var total time.Duration
+	for _, p := range t.phases {
+		table.Append([]string{p.name, p.duration.Round(time.Millisecond).String()})
+		total += p.duration
+	}
+	table.Append([]string{"Total", total.Round(time.Millisecond).String()})
+	table.Render()
+	return sb.String()
+}
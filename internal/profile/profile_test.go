@@ -0,0 +1,93 @@
+package profile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/tracing"
+)
+
+func TestStart(t *testing.T) {
+	specs := []struct {
+		kind string
+		file string
+	}{
+		{Cpu, "ld-find-code-refs.cpu.pprof"},
+		{Mem, "ld-find-code-refs.mem.pprof"},
+		{Trace, "ld-find-code-refs.trace.out"},
+	}
+	for _, tt := range specs {
+		t.Run(tt.kind, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "profile")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			stop, err := Start(tt.kind, dir)
+			require.NoError(t, err)
+			path, err := stop()
+			require.NoError(t, err)
+			assert.Equal(t, filepath.Join(dir, tt.file), path)
+			info, err := os.Stat(path)
+			require.NoError(t, err)
+			assert.NotZero(t, info.Size())
+
+			// stopping again does not write the profile again
+			again, err := stop()
+			require.NoError(t, err)
+			assert.Equal(t, path, again)
+			after, err := os.Stat(path)
+			require.NoError(t, err)
+			assert.Equal(t, info.Size(), after.Size())
+		})
+	}
+}
+
+func TestStart_invalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profile")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	_, err = Start("block", dir)
+	assert.EqualError(t, err, "'block' is not a valid profile type, must be one of: cpu, mem, trace")
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestTimer(t *testing.T) {
+	timer := Timer{}
+	timer.Start("search")
+	time.Sleep(2 * time.Millisecond)
+	timer.Start("upload")
+	timer.Stop()
+	timer.Stop()
+	assert.Nil(t, timer.Span())
+
+	require.Len(t, timer.phases, 2)
+	assert.Equal(t, "search", timer.phases[0].name)
+	assert.True(t, timer.phases[0].duration >= 2*time.Millisecond)
+	assert.Equal(t, "upload", timer.phases[1].name)
+
+	summary := timer.Summary()
+	lines := strings.Split(strings.TrimSpace(summary), "\n")
+	require.Len(t, lines, 5)
+	assert.Contains(t, lines[0], "PHASE")
+	assert.Contains(t, lines[2], "search")
+	assert.Contains(t, lines[3], "upload")
+	assert.Contains(t, lines[4], "Total")
+}
+
+func TestTimer_tracer(t *testing.T) {
+	timer := Timer{Tracer: tracing.New("http://localhost:4318/v1/traces", nil, "code-refs", "scan")}
+	timer.Start("search")
+	assert.NotNil(t, timer.Span())
+	timer.Stop()
+	assert.Nil(t, timer.Span())
+}
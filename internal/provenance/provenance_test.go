@@ -0,0 +1,85 @@
+package provenance
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeKeys(t *testing.T, dir, name string, key crypto.Signer) (string, string) {
+	private, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	public, err := x509.MarshalPKIXPublicKey(key.Public())
+	require.NoError(t, err)
+	privatePath := filepath.Join(dir, name+".pem")
+	publicPath := filepath.Join(dir, name+".pub")
+	require.NoError(t, ioutil.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: private}), 0600))
+	require.NoError(t, ioutil.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public}), 0600))
+	return privatePath, publicPath
+}
+
+func TestSignAndVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "provenance")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keys := map[string]crypto.Signer{"ed25519": edKey, "ecdsa": ecKey, "rsa": rsaKey}
+
+	data := []byte(`{"references":1}`)
+	for name, key := range keys {
+		t.Run(name, func(t *testing.T) {
+			privatePath, publicPath := writeKeys(t, dir, name, key)
+			signer, err := LoadPrivateKey(privatePath)
+			require.NoError(t, err)
+			public, err := LoadPublicKey(publicPath)
+			require.NoError(t, err)
+
+			signature, err := Sign(signer, data)
+			require.NoError(t, err)
+			assert.NoError(t, Verify(public, data, signature))
+			assert.Equal(t, ErrInvalidSignature, Verify(public, []byte(`{"references":2}`), signature))
+			assert.Equal(t, ErrInvalidSignature, Verify(public, data, signature[1:]))
+		})
+	}
+}
+
+func TestLoadPrivateKey_invalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "provenance")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "key.pem")
+	require.NoError(t, ioutil.WriteFile(path, []byte("not a key"), 0600))
+	_, err = LoadPrivateKey(path)
+	assert.EqualError(t, err, path+" does not contain a PEM encoded key")
+}
+
+func TestDigest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "provenance")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "refs.csv")
+	require.NoError(t, ioutil.WriteFile(path, []byte("abc"), 0600))
+	digest, err := Digest(path)
+	require.NoError(t, err)
+	assert.Equal(t, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", digest)
+}
@@ -0,0 +1,196 @@
+// Package sourcemap parses version 3 source maps, to resolve locations in generated files to their original sources.
+package sourcemap
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Map is a parsed source map
+type Map struct {
+	Sources        []string
+	SourcesContent []*string
+	// lines contains the segments of each generated line, sorted by generated column
+	lines [][]segment
+}
+
+type segment struct {
+	genColumn int
+	source    int
+	origLine  int
+	hasOrigin bool
+}
+
+type rawMap struct {
+	Version        int               `json:"version"`
+	SourceRoot     string            `json:"sourceRoot"`
+	Sources        []string          `json:"sources"`
+	SourcesContent []*string         `json:"sourcesContent"`
+	Mappings       string            `json:"mappings"`
+	Sections       []json.RawMessage `json:"sections"`
+}
+
+// Parse parses a version 3 source map. Sources are joined with the source root, if one is provided.
+func Parse(data []byte) (*Map, error) {
+	var raw rawMap
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, err
+	}
+	if raw.Version != 3 {
+		return nil, fmt.Errorf("unsupported source map version: %d", raw.Version)
+	}
+	if len(raw.Sections) > 0 {
+		return nil, errors.New("indexed source maps are not supported")
+	}
+
+	m := &Map{Sources: make([]string, 0, len(raw.Sources)), SourcesContent: raw.SourcesContent}
+	for _, source := range raw.Sources {
+		if raw.SourceRoot != "" && !isURL(source) && !path.IsAbs(source) {
+			source = strings.TrimSuffix(raw.SourceRoot, "/") + "/" + source
+		}
+		m.Sources = append(m.Sources, source)
+	}
+	m.lines, err = decodeMappings(raw.Mappings, len(m.Sources))
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+var urlScheme = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*:`)
+
+func isURL(s string) bool {
+	return urlScheme.MatchString(s)
+}
+
+// Lookup returns the original source index and line of a 1-based line and 0-based column in the generated file.
+// Returns false if the location is not mapped.
+func (m *Map) Lookup(line, column int) (source int, origLine int, ok bool) {
+	if line < 1 || line > len(m.lines) {
+		return 0, 0, false
+	}
+	segments := m.lines[line-1]
+	// find the last segment starting at or before the column
+	i := sort.Search(len(segments), func(i int) bool {
+		return segments[i].genColumn > column
+	}) - 1
+	if i < 0 || !segments[i].hasOrigin {
+		return 0, 0, false
+	}
+	return segments[i].source, segments[i].origLine + 1, true
+}
+
+// Content returns the embedded content of a source, if the source map includes it
+func (m *Map) Content(source int) (string, bool) {
+	if source < 0 || source >= len(m.SourcesContent) || m.SourcesContent[source] == nil {
+		return "", false
+	}
+	return *m.SourcesContent[source], true
+}
+
+func decodeMappings(mappings string, sources int) ([][]segment, error) {
+	ret := [][]segment{}
+	// source and original line are relative to the previous segment with an origin, across all lines
+	var source, origLine int
+	for _, line := range strings.Split(mappings, ";") {
+		segments := []segment{}
+		genColumn := 0
+		for _, s := range strings.Split(line, ",") {
+			if s == "" {
+				continue
+			}
+			fields, err := decodeVLQ(s)
+			if err != nil {
+				return nil, err
+			}
+			switch len(fields) {
+			case 1, 4, 5:
+			default:
+				return nil, fmt.Errorf("invalid mapping segment %q", s)
+			}
+			genColumn += fields[0]
+			seg := segment{genColumn: genColumn}
+			if len(fields) >= 4 {
+				source += fields[1]
+				origLine += fields[2]
+				if source < 0 || source >= sources {
+					return nil, fmt.Errorf("invalid source index %d in mapping segment %q", source, s)
+				}
+				seg.source, seg.origLine, seg.hasOrigin = source, origLine, true
+			}
+			segments = append(segments, seg)
+		}
+		sort.SliceStable(segments, func(i, j int) bool {
+			return segments[i].genColumn < segments[j].genColumn
+		})
+		ret = append(ret, segments)
+	}
+	return ret, nil
+}
+
+const base64Chars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+// decodeVLQ decodes a segment of base64 variable-length quantities
+func decodeVLQ(s string) ([]int, error) {
+	ret := []int{}
+	value, shift := 0, uint(0)
+	for i := 0; i < len(s); i++ {
+		digit := strings.IndexByte(base64Chars, s[i])
+		if digit < 0 {
+			return nil, fmt.Errorf("invalid character %q in mapping segment %q", s[i], s)
+		}
+		value += (digit & 31) << shift
+		if digit&32 != 0 {
+			shift += 5
+			continue
+		}
+		if value&1 != 0 {
+			ret = append(ret, -(value >> 1))
+		} else {
+			ret = append(ret, value>>1)
+		}
+		value, shift = 0, 0
+	}
+	if shift != 0 {
+		return nil, fmt.Errorf("incomplete mapping segment %q", s)
+	}
+	return ret, nil
+}
+
+var sourceMappingURL = regexp.MustCompile(`^\s*//[#@]\s*sourceMappingURL=(\S+)\s*$`)
+
+// FindURL returns the URL of the source map referenced by a sourceMappingURL comment in the last lines of a generated file
+func FindURL(lines []string) (string, bool) {
+	for i := len(lines) - 1; i >= 0 && i >= len(lines)-5; i-- {
+		if match := sourceMappingURL.FindStringSubmatch(lines[i]); match != nil {
+			return match[1], true
+		}
+	}
+	return "", false
+}
+
+// DecodeDataURL returns the contents of an inline source map provided as a base64 encoded data URL. Returns false if
+// url is not a data URL.
+func DecodeDataURL(url string) ([]byte, bool, error) {
+	if !strings.HasPrefix(url, "data:") {
+		return nil, false, nil
+	}
+	idx := strings.Index(url, ";base64,")
+	if idx < 0 {
+		return nil, true, errors.New("inline source maps must be base64 encoded")
+	}
+	data, err := base64.StdEncoding.DecodeString(url[idx+len(";base64,"):])
+	return data, true, err
+}
+
+// IsRemote returns true if the source map or source is located at a URL which cannot be resolved to a local file
+func IsRemote(url string) bool {
+	return isURL(url) && !strings.HasPrefix(url, "file:")
+}
@@ -0,0 +1,117 @@
+package sourcemap
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_decodeVLQ(t *testing.T) {
+	specs := []struct {
+		segment string
+		want    []int
+	}{
+		{segment: "AAAA", want: []int{0, 0, 0, 0}},
+		{segment: "MAEE", want: []int{6, 0, 2, 2}},
+		{segment: "D", want: []int{-1}},
+		{segment: "gBAAgB", want: []int{16, 0, 0, 16}},
+	}
+	for _, tt := range specs {
+		t.Run(tt.segment, func(t *testing.T) {
+			got, err := decodeVLQ(tt.segment)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := decodeVLQ("g")
+	assert.Error(t, err, "continuation bit without a following digit")
+	_, err = decodeVLQ("A!")
+	assert.Error(t, err)
+}
+
+const testMap = `{
+  "version": 3,
+  "sourceRoot": "src",
+  "sources": ["app.js", "other.js"],
+  "sourcesContent": ["line 1\nline 2\nline 3", null],
+  "mappings": "AAAA,MAEA,MCAA;A;AACA"
+}`
+
+func TestParse(t *testing.T) {
+	m, err := Parse([]byte(testMap))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"src/app.js", "src/other.js"}, m.Sources)
+
+	specs := []struct {
+		name       string
+		line       int
+		column     int
+		wantSource int
+		wantLine   int
+		wantOk     bool
+	}{
+		{name: "first segment", line: 1, column: 0, wantSource: 0, wantLine: 1, wantOk: true},
+		{name: "within first segment", line: 1, column: 5, wantSource: 0, wantLine: 1, wantOk: true},
+		{name: "second segment", line: 1, column: 6, wantSource: 0, wantLine: 3, wantOk: true},
+		{name: "second source", line: 1, column: 20, wantSource: 1, wantLine: 3, wantOk: true},
+		{name: "segment without origin", line: 2, column: 0, wantOk: false},
+		{name: "relative to previous line", line: 3, column: 0, wantSource: 1, wantLine: 4, wantOk: true},
+		{name: "unmapped line", line: 4, column: 0, wantOk: false},
+	}
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			source, line, ok := m.Lookup(tt.line, tt.column)
+			require.Equal(t, tt.wantOk, ok)
+			if ok {
+				assert.Equal(t, tt.wantSource, source)
+				assert.Equal(t, tt.wantLine, line)
+			}
+		})
+	}
+
+	content, ok := m.Content(0)
+	assert.True(t, ok)
+	assert.Equal(t, "line 1\nline 2\nline 3", content)
+	_, ok = m.Content(1)
+	assert.False(t, ok)
+}
+
+func TestParse_invalid(t *testing.T) {
+	_, err := Parse([]byte(`{"version": 2, "sources": [], "mappings": ""}`))
+	assert.EqualError(t, err, "unsupported source map version: 2")
+	_, err = Parse([]byte(`{"version": 3, "sections": [{}]}`))
+	assert.EqualError(t, err, "indexed source maps are not supported")
+	_, err = Parse([]byte(`{"version": 3, "sources": ["a.js"], "mappings": "ACAA"}`))
+	assert.Error(t, err, "source index out of range")
+}
+
+func TestFindURL(t *testing.T) {
+	url, ok := FindURL([]string{"var a=1;", "//# sourceMappingURL=app.js.map"})
+	assert.True(t, ok)
+	assert.Equal(t, "app.js.map", url)
+
+	url, ok = FindURL([]string{"var a=1;", "//@ sourceMappingURL=legacy.js.map", ""})
+	assert.True(t, ok)
+	assert.Equal(t, "legacy.js.map", url)
+
+	_, ok = FindURL([]string{"var a=1;"})
+	assert.False(t, ok)
+}
+
+func TestDecodeDataURL(t *testing.T) {
+	data, ok, err := DecodeDataURL("data:application/json;charset=utf-8;base64," + base64.StdEncoding.EncodeToString([]byte(testMap)))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, testMap, string(data))
+
+	_, ok, err = DecodeDataURL("app.js.map")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, ok, err = DecodeDataURL("data:application/json,{}")
+	assert.True(t, ok)
+	assert.Error(t, err)
+}
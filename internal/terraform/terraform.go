@@ -0,0 +1,106 @@
+// Package terraform finds the feature flags managed by the LaunchDarkly Terraform provider in Terraform configuration.
+package terraform
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FlagResourceType is the type of the resource managing a feature flag in the LaunchDarkly Terraform provider
+const FlagResourceType = "launchdarkly_feature_flag"
+
+// Definition is a launchdarkly_feature_flag resource
+type Definition struct {
+	// Key is the flag key, if it is a literal string
+	Key string `json:"key,omitempty"`
+	// ProjectKey is the project key, if it is a literal string
+	ProjectKey string `json:"projectKey,omitempty"`
+	// Expression is the expression of the flag key, if it is not a literal string, e.g. var.flag_key
+	Expression string `json:"expression,omitempty"`
+	Resource   string `json:"resource"`
+	Path       string `json:"path"`
+	Line       int    `json:"line"`
+}
+
+// FindDefinitions returns the launchdarkly_feature_flag resources in the .tf files in dir and its subdirectories. Paths
+// are relative to dir. The .terraform directories of modules and providers installed by Terraform are not searched.
+func FindDefinitions(dir string) ([]Definition, error) {
+	ret := []Definition{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != dir && (info.Name() == ".terraform" || info.Name() == ".git") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) != ".tf" {
+			return nil
+		}
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		ret = append(ret, ParseDefinitions(filepath.ToSlash(rel), string(contents))...)
+		return nil
+	})
+	return ret, err
+}
+
+// ParseDefinitions returns the launchdarkly_feature_flag resources in the contents of a .tf file. Only the top-level key
+// and project_key attributes of each resource are read.
+func ParseDefinitions(path, contents string) []Definition {
+	tokens := tokenize(contents)
+	ret := []Definition{}
+	var current *Definition
+	depth := 0
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		switch {
+		case depth == 0 && tok.is(tokenIdent, "resource") && i+3 < len(tokens) &&
+			tokens[i+1].is(tokenString, FlagResourceType) && tokens[i+2].kind == tokenString && tokens[i+3].is(tokenPunct, "{"):
+			current = &Definition{Resource: FlagResourceType + "." + tokens[i+2].text, Path: path, Line: tok.line}
+			depth = 1
+			i += 3
+		case tok.is(tokenPunct, "{"):
+			depth++
+		case tok.is(tokenPunct, "}"):
+			depth--
+			if depth == 0 && current != nil {
+				ret = append(ret, *current)
+				current = nil
+			}
+		case current != nil && depth == 1 && tok.kind == tokenIdent && (tok.text == "key" || tok.text == "project_key") &&
+			i+2 < len(tokens) && tokens[i+1].is(tokenPunct, "="):
+			value, expression := attributeValue(tokens, i+2)
+			if tok.text == "key" {
+				current.Key, current.Expression = value, expression
+			} else {
+				current.ProjectKey = value
+			}
+		}
+	}
+	return ret
+}
+
+// attributeValue returns the value of an attribute starting at tokens[i] if it is a literal string. Otherwise, the tokens
+// of the value on the same line are returned as an expression.
+func attributeValue(tokens []token, i int) (value, expression string) {
+	first := tokens[i]
+	if first.kind == tokenString && first.literal && (i+1 == len(tokens) || tokens[i+1].line > first.line || tokens[i+1].is(tokenPunct, "}")) {
+		return first.text, ""
+	}
+	parts := []string{}
+	for j := i; j < len(tokens) && tokens[j].line == first.line && !tokens[j].is(tokenPunct, "}"); j++ {
+		parts = append(parts, tokens[j].source)
+	}
+	return "", strings.Join(parts, "")
+}
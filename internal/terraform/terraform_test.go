@@ -0,0 +1,80 @@
+package terraform
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const flagsTf = `# feature flags
+resource "launchdarkly_project" "default" {
+  key  = "default"
+  name = "Default"
+}
+
+resource "launchdarkly_feature_flag" "checkout" {
+  project_key    = launchdarkly_project.default.key
+  key            = "new-checkout"
+  name           = "New checkout {beta}"
+  variation_type = "boolean"
+
+  custom_properties {
+    key    = "jira.issues"
+    name   = "Jira issues"
+    value  = ["CHK-1"]
+  }
+
+  description = <<EOT
+    key = "not-a-flag"
+  EOT
+}
+
+/* resource "launchdarkly_feature_flag" "commented" {
+  key = "commented-flag"
+} */
+
+resource "launchdarkly_feature_flag" "dynamic" {
+  project_key = "other-project"
+  key         = "${var.prefix}-flag"
+  tags        = { team = "web" }
+}
+
+resource "launchdarkly_feature_flag" "escaped" {
+  project_key = "default"
+  key = "price-$${currency}" // a literal
+}
+`
+
+func TestParseDefinitions(t *testing.T) {
+	defs := ParseDefinitions("flags.tf", flagsTf)
+	assert.Equal(t, []Definition{
+		{Key: "new-checkout", Resource: "launchdarkly_feature_flag.checkout", Path: "flags.tf", Line: 7},
+		{ProjectKey: "other-project", Expression: `"${var.prefix}-flag"`, Resource: "launchdarkly_feature_flag.dynamic", Path: "flags.tf", Line: 28},
+		{Key: "price-${currency}", ProjectKey: "default", Resource: "launchdarkly_feature_flag.escaped", Path: "flags.tf", Line: 34},
+	}, defs)
+}
+
+func TestParseDefinitions_expression(t *testing.T) {
+	defs := ParseDefinitions("main.tf", "resource \"launchdarkly_feature_flag\" \"f\" {\n  key = var.flag_key\n}\n")
+	assert.Equal(t, []Definition{{Expression: "var.flag_key", Resource: "launchdarkly_feature_flag.f", Path: "main.tf", Line: 1}}, defs)
+}
+
+func TestFindDefinitions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "terraform")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "modules", "flags"), 0700))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, ".terraform", "modules"), 0700))
+	resource := "resource \"launchdarkly_feature_flag\" \"f\" {\n  key = \"module-flag\"\n}\n"
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "modules", "flags", "main.tf"), []byte(resource), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, ".terraform", "modules", "main.tf"), []byte(resource), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte(resource), 0600))
+
+	defs, err := FindDefinitions(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []Definition{{Key: "module-flag", Resource: "launchdarkly_feature_flag.f", Path: "modules/flags/main.tf", Line: 1}}, defs)
+}
@@ -0,0 +1,170 @@
+package terraform
+
+import (
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenIdent tokenKind = iota
+	tokenString
+	tokenPunct
+	tokenOther
+)
+
+type token struct {
+	kind tokenKind
+	// text is the value of strings, and the source of other tokens
+	text string
+	// source is the text of the token in the file
+	source string
+	line   int
+	// literal is true for strings without template interpolations or directives
+	literal bool
+}
+
+func (t token) is(kind tokenKind, text string) bool {
+	return t.kind == kind && t.text == text
+}
+
+// tokenize splits HCL source into identifiers, strings, braces, and equals signs. Comments and heredocs are skipped, and
+// all other characters are returned as single character tokens.
+func tokenize(src string) []token {
+	ret := []token{}
+	line := 1
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == '#' || strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				end = len(src) - i - 4
+			}
+			line += strings.Count(src[i:i+end+4], "\n")
+			i += end + 4
+		case strings.HasPrefix(src[i:], "<<"):
+			end := skipHeredoc(src, i)
+			line += strings.Count(src[i:end], "\n")
+			i = end
+		case c == '"':
+			end, value, literal := readString(src, i)
+			ret = append(ret, token{kind: tokenString, text: value, source: src[i:end], line: line, literal: literal})
+			line += strings.Count(src[i:end], "\n")
+			i = end
+		case isIdentStart(rune(c)):
+			end := i + 1
+			for end < len(src) && isIdentPart(rune(src[end])) {
+				end++
+			}
+			ret = append(ret, token{kind: tokenIdent, text: src[i:end], source: src[i:end], line: line})
+			i = end
+		case c == '{' || c == '}' || c == '=':
+			if c == '=' && i+1 < len(src) && (src[i+1] == '=' || src[i+1] == '>') {
+				ret = append(ret, token{kind: tokenOther, text: src[i : i+2], source: src[i : i+2], line: line})
+				i += 2
+				continue
+			}
+			ret = append(ret, token{kind: tokenPunct, text: string(c), source: string(c), line: line})
+			i++
+		default:
+			ret = append(ret, token{kind: tokenOther, text: string(c), source: string(c), line: line})
+			i++
+		}
+	}
+	return ret
+}
+
+// readString reads a quoted string starting at src[start], including any nested strings in template interpolations.
+// Returns the index after the closing quote, the unescaped value, and whether the string is a literal.
+func readString(src string, start int) (end int, value string, literal bool) {
+	var sb strings.Builder
+	literal = true
+	depth := 0
+	for i := start + 1; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case depth == 0 && c == '"':
+			return i + 1, sb.String(), literal
+		case depth == 0 && c == '\\' && i+1 < len(src):
+			i++
+			switch src[i] {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			default:
+				sb.WriteByte(src[i])
+			}
+			continue
+		case c == '\n' && depth == 0:
+			// strings cannot span lines, so the string is unterminated
+			return i, sb.String(), false
+		case depth == 0 && (c == '$' || c == '%') && strings.HasPrefix(src[i+1:], string(c)+"{"):
+			// $${ and %%{ are escaped template sequences
+			sb.WriteByte(c)
+			sb.WriteByte('{')
+			i += 2
+			continue
+		case (c == '$' || c == '%') && i+1 < len(src) && src[i+1] == '{':
+			literal = false
+			depth++
+			i++
+		case depth > 0 && c == '}':
+			depth--
+		case depth > 0 && c == '"':
+			i, _, _ = readString(src, i)
+			i--
+		}
+		sb.WriteByte(c)
+	}
+	return len(src), sb.String(), false
+}
+
+// skipHeredoc returns the index after the heredoc starting at src[start], or after the << if it does not start a heredoc
+func skipHeredoc(src string, start int) int {
+	i := start + 2
+	if i < len(src) && src[i] == '-' {
+		i++
+	}
+	idStart := i
+	for i < len(src) && isIdentPart(rune(src[i])) {
+		i++
+	}
+	id := src[idStart:i]
+	if id == "" {
+		return start + 2
+	}
+	for {
+		nl := strings.IndexByte(src[i:], '\n')
+		if nl < 0 {
+			return len(src)
+		}
+		i += nl + 1
+		lineEnd := strings.IndexByte(src[i:], '\n')
+		if lineEnd < 0 {
+			lineEnd = len(src) - i
+		}
+		if strings.TrimSpace(src[i:i+lineEnd]) == id {
+			return i + lineEnd
+		}
+	}
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isIdentPart(r rune) bool {
+	return isIdentStart(r) || r == '-' || unicode.IsDigit(r)
+}
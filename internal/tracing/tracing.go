@@ -0,0 +1,321 @@
+// Package tracing records spans of the phases of a scan, and exports them to an OpenTelemetry collector with the OTLP/HTTP
+// protocol, using its JSON encoding. A nil Tracer or Span records nothing, so code may be instrumented unconditionally.
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Span kinds, as defined by OTLP
+const (
+	KindInternal = 1
+	KindClient   = 3
+)
+
+const (
+	statusError   = 2
+	exportTimeout = 10 * time.Second
+)
+
+// Tracer records the spans of a single trace, with a root span for the whole operation
+type Tracer struct {
+	endpoint string
+	headers  map[string]string
+	service  string
+	traceID  string
+	root     *Span
+
+	mu      sync.Mutex
+	spans   []*Span
+	current *Span
+}
+
+// Span is a timed operation within a trace
+type Span struct {
+	tracer   *Tracer
+	name     string
+	kind     int
+	id       string
+	parentID string
+	start    time.Time
+
+	mu         sync.Mutex
+	end        time.Time
+	attributes map[string]interface{}
+	err        string
+}
+
+// New returns a tracer exporting spans to the OTLP/HTTP traces endpoint, e.g. http://localhost:4318/v1/traces, with a root
+// span of the given name. Headers are added to the export request, e.g. to authenticate with the collector.
+func New(endpoint string, headers map[string]string, service, rootName string) *Tracer {
+	t := &Tracer{endpoint: endpoint, headers: headers, service: service, traceID: randomID(16)}
+	t.root = t.Start(rootName, nil, KindInternal)
+	t.current = t.root
+	return t
+}
+
+// Root returns the root span of the trace
+func (t *Tracer) Root() *Span {
+	if t == nil {
+		return nil
+	}
+	return t.root
+}
+
+// Start starts a span, as a child of parent, or a root span if parent is nil
+func (t *Tracer) Start(name string, parent *Span, kind int) *Span {
+	if t == nil {
+		return nil
+	}
+	s := &Span{tracer: t, name: name, kind: kind, id: randomID(8), start: time.Now(), attributes: map[string]interface{}{}}
+	if parent != nil {
+		s.parentID = parent.id
+	}
+	t.mu.Lock()
+	t.spans = append(t.spans, s)
+	t.mu.Unlock()
+	return s
+}
+
+// SetCurrent sets the span which operations without a span of their own, such as API requests, are recorded as children of.
+// If s is nil, operations are recorded as children of the root span.
+func (t *Tracer) SetCurrent(s *Span) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if s == nil {
+		s = t.root
+	}
+	t.current = s
+}
+
+// Current returns the span set by SetCurrent, or the root span
+func (t *Tracer) Current() *Span {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.current
+}
+
+// StartChild starts a span as a child of s
+func (s *Span) StartChild(name string, kind int) *Span {
+	if s == nil {
+		return nil
+	}
+	return s.tracer.Start(name, s, kind)
+}
+
+// SetAttribute sets an attribute of the span. Values may be strings, integers, or booleans.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attributes[key] = value
+}
+
+// SetError marks the span as failed with err, if err is not nil
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err.Error()
+}
+
+// End ends the span now
+func (s *Span) End() {
+	s.EndAt(time.Now())
+}
+
+// EndAt ends the span at the given time. Spans which are ended more than once keep their first end time.
+func (s *Span) EndAt(end time.Time) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.end.IsZero() {
+		s.end = end
+	}
+}
+
+type spanKey struct{}
+
+// ContextWithSpan returns a context carrying s, so functions called with the context may record child spans of it
+func ContextWithSpan(ctx context.Context, s *Span) context.Context {
+	if s == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanKey{}, s)
+}
+
+// SpanFromContext returns the span carried by ctx, or nil
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// Export ends the root span, and sends every span to the collector. Spans which have not ended are sent as ending now.
+func (t *Tracer) Export() error {
+	if t == nil {
+		return nil
+	}
+	t.root.End()
+	body, err := json.Marshal(t.request())
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+	req, err := http.NewRequest(http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	for name, value := range t.headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, res.Body)
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("collector responded with status %d", res.StatusCode)
+	}
+	return nil
+}
+
+// The following types are the JSON encoding of an OTLP ExportTraceServiceRequest
+
+type exportRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeSpans struct {
+	Scope scope      `json:"scope"`
+	Spans []spanJSON `json:"spans"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type spanJSON struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	Status            *status    `json:"status,omitempty"`
+}
+
+type status struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type keyValue struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+func (t *Tracer) request() exportRequest {
+	t.mu.Lock()
+	spans := make([]*Span, len(t.spans))
+	copy(spans, t.spans)
+	t.mu.Unlock()
+
+	now := time.Now()
+	encoded := make([]spanJSON, 0, len(spans))
+	for _, s := range spans {
+		s.mu.Lock()
+		end := s.end
+		if end.IsZero() {
+			end = now
+		}
+		js := spanJSON{
+			TraceID:           t.traceID,
+			SpanID:            s.id,
+			ParentSpanID:      s.parentID,
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(end.UnixNano(), 10),
+			Attributes:        attributes(s.attributes),
+		}
+		if s.err != "" {
+			js.Status = &status{Code: statusError, Message: s.err}
+		}
+		s.mu.Unlock()
+		encoded = append(encoded, js)
+	}
+	return exportRequest{ResourceSpans: []resourceSpans{{
+		Resource:   resource{Attributes: attributes(map[string]interface{}{"service.name": t.service})},
+		ScopeSpans: []scopeSpans{{Scope: scope{Name: "github.com/launchdarkly/ld-find-code-refs"}, Spans: encoded}},
+	}}}
+}
+
+// attributes encodes attributes in key order, so requests are deterministic
+func attributes(attrs map[string]interface{}) []keyValue {
+	ret := make([]keyValue, 0, len(attrs))
+	for k, v := range attrs {
+		var value map[string]interface{}
+		switch v := v.(type) {
+		case bool:
+			value = map[string]interface{}{"boolValue": v}
+		case int:
+			// 64-bit integers are encoded as strings in JSON
+			value = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		case int64:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		ret = append(ret, keyValue{Key: k, Value: value})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Key < ret[j].Key
+	})
+	return ret
+}
+
+// randomID returns a random hex encoded id of n bytes
+func randomID(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
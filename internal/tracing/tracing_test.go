@@ -0,0 +1,83 @@
+package tracing
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExport(t *testing.T) {
+	var received exportRequest
+	var auth string
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "/v1/traces", req.URL.Path)
+		assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+		auth = req.Header.Get("Authorization")
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&received))
+		res.WriteHeader(http.StatusOK)
+	}))
+	defer testServer.Close()
+
+	tracer := New(testServer.URL+"/v1/traces", map[string]string{"Authorization": "Bearer token"}, "code-refs", "scan")
+	tracer.Root().SetAttribute("ld.repository", "my-repo")
+	phase := tracer.Start("search", tracer.Root(), KindInternal)
+	tracer.SetCurrent(phase)
+	request := tracer.Start("GET", tracer.Current(), KindClient)
+	request.SetAttribute("http.response.status_code", 500)
+	request.SetError(errors.New("internal service error"))
+	request.End()
+	dir := phase.StartChild("search src", KindInternal)
+	dir.EndAt(time.Now())
+	phase.End()
+	require.NoError(t, tracer.Export())
+
+	assert.Equal(t, "Bearer token", auth)
+	require.Len(t, received.ResourceSpans, 1)
+	assert.Equal(t, []keyValue{{Key: "service.name", Value: map[string]interface{}{"stringValue": "code-refs"}}}, received.ResourceSpans[0].Resource.Attributes)
+	spans := received.ResourceSpans[0].ScopeSpans[0].Spans
+	require.Len(t, spans, 4)
+	root, search, get, src := spans[0], spans[1], spans[2], spans[3]
+
+	assert.Equal(t, "scan", root.Name)
+	assert.Empty(t, root.ParentSpanID)
+	assert.Equal(t, []keyValue{{Key: "ld.repository", Value: map[string]interface{}{"stringValue": "my-repo"}}}, root.Attributes)
+	assert.Equal(t, root.SpanID, search.ParentSpanID)
+	assert.Equal(t, search.SpanID, get.ParentSpanID)
+	assert.Equal(t, search.SpanID, src.ParentSpanID)
+	assert.Equal(t, KindClient, get.Kind)
+	assert.Equal(t, &status{Code: statusError, Message: "internal service error"}, get.Status)
+	assert.Equal(t, []keyValue{{Key: "http.response.status_code", Value: map[string]interface{}{"intValue": "500"}}}, get.Attributes)
+	for _, s := range spans {
+		assert.Len(t, s.TraceID, 32)
+		assert.Equal(t, root.TraceID, s.TraceID)
+		assert.Len(t, s.SpanID, 16)
+		assert.NotEqual(t, "0", s.EndTimeUnixNano)
+	}
+}
+
+func TestExport_error(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusBadRequest)
+	}))
+	defer testServer.Close()
+
+	assert.EqualError(t, New(testServer.URL, nil, "code-refs", "scan").Export(), "collector responded with status 400")
+}
+
+func TestNilTracer(t *testing.T) {
+	var tracer *Tracer
+	span := tracer.Start("search", tracer.Root(), KindInternal)
+	assert.Nil(t, span)
+	span.SetAttribute("files", 1)
+	span.SetError(errors.New("error"))
+	span.StartChild("child", KindInternal).End()
+	tracer.SetCurrent(span)
+	assert.Nil(t, tracer.Current())
+	assert.NoError(t, tracer.Export())
+}
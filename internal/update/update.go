@@ -0,0 +1,295 @@
+// Package update checks for new releases of ld-find-code-refs, and replaces the running binary with the latest release.
+package update
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultReleasesUrl = "https://api.github.com/repos/launchdarkly/ld-find-code-refs/releases"
+	binaryName         = "ld-find-code-refs"
+	// Releases whose notes contain this marker should no longer be used
+	yankedMarker = "[yanked]"
+)
+
+type Release struct {
+	TagName    string  `json:"tag_name"`
+	Body       string  `json:"body"`
+	Prerelease bool    `json:"prerelease"`
+	Draft      bool    `json:"draft"`
+	Assets     []Asset `json:"assets"`
+}
+
+type Asset struct {
+	Name               string `json:"name"`
+	BrowserDownloadUrl string `json:"browser_download_url"`
+}
+
+func (r Release) Version() string {
+	return strings.TrimPrefix(r.TagName, "v")
+}
+
+// Status describes the running version compared to the latest release
+type Status struct {
+	Current  string
+	Latest   *Release
+	Outdated bool
+	Yanked   bool
+}
+
+type Checker struct {
+	ReleasesUrl string
+	client      *http.Client
+}
+
+func NewChecker(releasesUrl string) *Checker {
+	return &Checker{ReleasesUrl: releasesUrl, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Check retrieves recent releases, and reports whether the current version is outdated or has been yanked
+func (c *Checker) Check(current string) (Status, error) {
+	status := Status{Current: current}
+	res, err := c.client.Get(c.ReleasesUrl)
+	if err != nil {
+		return status, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return status, fmt.Errorf("unexpected status code retrieving releases: %d", res.StatusCode)
+	}
+	releases := []Release{}
+	err = json.NewDecoder(res.Body).Decode(&releases)
+	if err != nil {
+		return status, fmt.Errorf("could not parse releases: %w", err)
+	}
+
+	for i, r := range releases {
+		if r.Draft || r.Prerelease {
+			continue
+		}
+		if r.Version() == current && strings.Contains(strings.ToLower(r.Body), yankedMarker) {
+			status.Yanked = true
+		}
+		if strings.Contains(strings.ToLower(r.Body), yankedMarker) {
+			continue
+		}
+		if status.Latest == nil || compareVersions(r.Version(), status.Latest.Version()) > 0 {
+			status.Latest = &releases[i]
+		}
+	}
+	if status.Latest != nil {
+		status.Outdated = compareVersions(current, status.Latest.Version()) < 0
+	}
+	return status, nil
+}
+
+// compareVersions compares two semantic versions, ignoring pre-release and build metadata.
+// Returns a negative number if a < b, 0 if a == b, and a positive number if a > b.
+func compareVersions(a, b string) int {
+	aParts, bParts := versionParts(a), versionParts(b)
+	for i := range aParts {
+		if aParts[i] != bParts[i] {
+			return aParts[i] - bParts[i]
+		}
+	}
+	return 0
+}
+
+func versionParts(v string) [3]int {
+	ret := [3]int{}
+	v = strings.TrimPrefix(v, "v")
+	if idx := strings.IndexAny(v, "-+"); idx >= 0 {
+		v = v[:idx]
+	}
+	for i, part := range strings.SplitN(v, ".", 3) {
+		n, err := strconv.Atoi(part)
+		if err == nil {
+			ret[i] = n
+		}
+	}
+	return ret
+}
+
+// assetName returns the name of the release archive for the current platform, following goreleaser's default naming
+func assetName(version string) string {
+	return fmt.Sprintf("%s_%s_%s_%s.tar.gz", binaryName, version, runtime.GOOS, runtime.GOARCH)
+}
+
+// checksumsName returns the name of the release's checksums file, following goreleaser's default naming
+func checksumsName(version string) string {
+	return fmt.Sprintf("%s_%s_checksums.txt", binaryName, version)
+}
+
+// IsContainer reports whether the running process appears to be inside a container, where binaries should be updated
+// by pulling a new image instead
+func IsContainer() bool {
+	_, err := os.Stat("/.dockerenv")
+	return err == nil
+}
+
+// Update replaces the running executable with the binary from the given release, and returns the path to the updated executable.
+// The release archive must match the checksum listed in the release's checksums file.
+func (c *Checker) Update(release Release) (string, error) {
+	name := assetName(release.Version())
+	var asset *Asset
+	for i, a := range release.Assets {
+		if a.Name == name {
+			asset = &release.Assets[i]
+			break
+		}
+	}
+	if asset == nil {
+		return "", fmt.Errorf("release %s does not contain an archive for %s/%s", release.TagName, runtime.GOOS, runtime.GOARCH)
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	executable, err = filepath.EvalSymlinks(executable)
+	if err != nil {
+		return "", err
+	}
+
+	// Write the new binary alongside the current executable, so it can be renamed into place atomically
+	tmp, err := ioutil.TempFile(filepath.Dir(executable), "."+binaryName+"-update")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	err = c.downloadBinary(release, *asset, tmp)
+	tmp.Close()
+	if err != nil {
+		return "", err
+	}
+	err = os.Chmod(tmp.Name(), 0755)
+	if err != nil {
+		return "", err
+	}
+
+	// Windows does not allow replacing a running executable, but does allow renaming it
+	old := executable + ".old"
+	_ = os.Remove(old)
+	err = os.Rename(executable, old)
+	if err != nil {
+		return "", err
+	}
+	err = os.Rename(tmp.Name(), executable)
+	if err != nil {
+		_ = os.Rename(old, executable)
+		return "", err
+	}
+	_ = os.Remove(old)
+	return executable, nil
+}
+
+// downloadBinary copies the binary from a release archive to w, after verifying the archive against the release's checksums
+func (c *Checker) downloadBinary(release Release, asset Asset, w io.Writer) error {
+	expected, err := c.checksum(release, asset.Name)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.client.Get(asset.BrowserDownloadUrl)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code downloading %s: %d", asset.Name, res.StatusCode)
+	}
+
+	// The archive is hashed as it is extracted, so the binary must not be used until the whole archive has been read
+	hash := sha256.New()
+	archive := io.TeeReader(res.Body, hash)
+	err = extractBinary(archive, w)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(ioutil.Discard, archive)
+	if err != nil {
+		return err
+	}
+	actual := hex.EncodeToString(hash.Sum(nil))
+	if actual != expected {
+		return fmt.Errorf("checksum of %s does not match %s: expected %s, got %s", asset.Name, checksumsName(release.Version()), expected, actual)
+	}
+	return nil
+}
+
+// checksum returns the SHA-256 checksum of the named release asset, as listed by the release's checksums file
+func (c *Checker) checksum(release Release, name string) (string, error) {
+	checksums := checksumsName(release.Version())
+	var asset *Asset
+	for i, a := range release.Assets {
+		if a.Name == checksums {
+			asset = &release.Assets[i]
+			break
+		}
+	}
+	if asset == nil {
+		return "", fmt.Errorf("release %s does not contain %s, the update cannot be verified", release.TagName, checksums)
+	}
+
+	res, err := c.client.Get(asset.BrowserDownloadUrl)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code downloading %s: %d", checksums, res.StatusCode)
+	}
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		// each line is the checksum and the name of an asset, separated by whitespace
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[1] == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("%s does not contain a checksum for %s, the update cannot be verified", checksums, name)
+}
+
+// extractBinary copies the ld-find-code-refs binary from a gzipped tar archive to w
+func extractBinary(r io.Reader, w io.Writer) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return errors.New("release archive does not contain " + binaryName)
+		}
+		if err != nil {
+			return err
+		}
+		name := filepath.Base(header.Name)
+		if name == binaryName || name == binaryName+".exe" {
+			/* #nosec */
+			_, err = io.Copy(w, tr)
+			return err
+		}
+	}
+}
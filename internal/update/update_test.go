@@ -0,0 +1,138 @@
+package update
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_compareVersions(t *testing.T) {
+	specs := []struct {
+		a, b     string
+		expected int
+	}{
+		{"2.2.4", "2.2.4", 0},
+		{"2.2.4", "v2.2.4", 0},
+		{"2.2.4", "2.3.0", -1},
+		{"2.10.0", "2.9.1", 1},
+		{"3.0.0-rc1", "2.9.1", 1},
+	}
+	for _, tt := range specs {
+		got := compareVersions(tt.a, tt.b)
+		switch {
+		case tt.expected < 0:
+			assert.True(t, got < 0, "%s < %s", tt.a, tt.b)
+		case tt.expected > 0:
+			assert.True(t, got > 0, "%s > %s", tt.a, tt.b)
+		default:
+			assert.Equal(t, 0, got, "%s == %s", tt.a, tt.b)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	releases := []Release{
+		{TagName: "v2.4.0-rc1", Prerelease: true},
+		{TagName: "v2.3.1", Body: "[YANKED] broken release"},
+		{TagName: "v2.3.0"},
+		{TagName: "v2.2.4"},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(releases)
+	}))
+	defer server.Close()
+	checker := NewChecker(server.URL)
+
+	specs := []struct {
+		current  string
+		outdated bool
+		yanked   bool
+	}{
+		{"2.2.4", true, false},
+		{"2.3.0", false, false},
+		{"2.3.1", false, true},
+	}
+	for _, tt := range specs {
+		t.Run(tt.current, func(t *testing.T) {
+			status, err := checker.Check(tt.current)
+			require.NoError(t, err)
+			require.NotNil(t, status.Latest)
+			assert.Equal(t, "2.3.0", status.Latest.Version())
+			assert.Equal(t, tt.outdated, status.Outdated)
+			assert.Equal(t, tt.yanked, status.Yanked)
+		})
+	}
+}
+
+func testArchive(t *testing.T) []byte {
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gz)
+	for name, contents := range map[string]string{"README.md": "readme", binaryName: "binary"} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0755, Size: int64(len(contents))}))
+		_, err := tw.Write([]byte(contents))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return archive.Bytes()
+}
+
+func Test_extractBinary(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, extractBinary(bytes.NewReader(testArchive(t)), &out))
+	assert.Equal(t, "binary", out.String())
+}
+
+func Test_downloadBinary(t *testing.T) {
+	archive := testArchive(t)
+	sum := sha256.Sum256(archive)
+	name := assetName("1.2.0")
+	specs := []struct {
+		name      string
+		checksums string
+		expectErr string
+	}{
+		{"verified", hex.EncodeToString(sum[:]) + "  " + name + "\n", ""},
+		{"mismatch", strings.Repeat("0", 64) + "  " + name + "\n", "checksum of " + name + " does not match"},
+		{"not listed", hex.EncodeToString(sum[:]) + "  other.tar.gz\n", "does not contain a checksum for " + name},
+		{"missing checksums", "", "does not contain " + checksumsName("1.2.0")},
+	}
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/checksums.txt" {
+					_, _ = w.Write([]byte(tt.checksums))
+					return
+				}
+				_, _ = w.Write(archive)
+			}))
+			defer server.Close()
+
+			asset := Asset{Name: name, BrowserDownloadUrl: server.URL + "/archive.tar.gz"}
+			release := Release{TagName: "v1.2.0", Assets: []Asset{asset}}
+			if tt.checksums != "" {
+				release.Assets = append(release.Assets, Asset{Name: checksumsName("1.2.0"), BrowserDownloadUrl: server.URL + "/checksums.txt"})
+			}
+			var out bytes.Buffer
+			err := NewChecker(server.URL).downloadBinary(release, asset, &out)
+			if tt.expectErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "binary", out.String())
+		})
+	}
+}
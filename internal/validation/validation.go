@@ -6,6 +6,8 @@ import (
 	"path/filepath"
 )
 
+// NormalizeAndValidatePath returns the absolute path of an existing directory. If the path is a symbolic link,
+// the path of the link target is returned.
 func NormalizeAndValidatePath(path string) (string, error) {
 	absPath, err := filepath.Abs(path)
 	if err != nil {
@@ -21,7 +23,12 @@ func NormalizeAndValidatePath(path string) (string, error) {
 		return "", fmt.Errorf("directory does not exist: %s", absPath)
 	}
 
-	return absPath, nil
+	realPath, err := filepath.EvalSymlinks(absPath)
+	if err != nil {
+		return "", fmt.Errorf("invalid directory: %s", err)
+	}
+
+	return realPath, nil
 }
 
 func dirExists(path string) (bool, error) {
@@ -0,0 +1,77 @@
+package warnings
+
+// Code identifies the condition a warning describes, so pipelines can act on specific conditions. Codes are included in
+// scan manifests, and a scan which fails in strict mode exits with the exit code of the first code raised.
+type Code string
+
+const (
+	// LinesTruncated: lines longer than the maximum line length were truncated
+	LinesTruncated Code = "LINES_TRUNCATED"
+	// PayloadTruncated: the maximum number of files or code references was reached, and remaining files were not searched
+	PayloadTruncated Code = "PAYLOAD_TRUNCATED"
+	// ScanTimedOut: the search exceeded maxScanTime, and code references are partial
+	ScanTimedOut Code = "SCAN_TIMED_OUT"
+	// ScanInterrupted: the search was interrupted by a signal, and code references are partial
+	ScanInterrupted Code = "SCAN_INTERRUPTED"
+	// FileTooLarge: files larger than maxFileSizeKb were not searched
+	FileTooLarge Code = "FILE_TOO_LARGE"
+	// SparseFilesSkipped: files excluded by a sparse checkout were not searched
+	SparseFilesSkipped Code = "SPARSE_FILES_SKIPPED"
+	// FlagsOmittedShort: flags with keys shorter than the minimum length were not searched for
+	FlagsOmittedShort Code = "FLAGS_OMITTED_SHORT"
+	// PruneSkippedNoRemote: the branches on the remote could not be listed, so code references for deleted branches were
+	// not pruned
+	PruneSkippedNoRemote Code = "PRUNE_SKIPPED_NO_REMOTE"
+)
+
+// codeInfo is every code, in the order they are documented, with its category and the exit code of a scan which fails
+// in strict mode because of it
+var codeInfo = []struct {
+	code     Code
+	category Category
+	exitCode int
+}{
+	{LinesTruncated, Truncation, 10},
+	{PayloadTruncated, Limit, 11},
+	{ScanTimedOut, Limit, 12},
+	{ScanInterrupted, Limit, 13},
+	{FileTooLarge, SkippedFile, 14},
+	{SparseFilesSkipped, SkippedFile, 15},
+	{FlagsOmittedShort, OmittedFlag, 16},
+	{PruneSkippedNoRemote, Prune, 17},
+}
+
+// Category returns the category of warnings with the code
+func (c Code) Category() Category {
+	for _, info := range codeInfo {
+		if info.code == c {
+			return info.category
+		}
+	}
+	return ""
+}
+
+// ExitCode returns the exit code of a scan which fails in strict mode because of a warning with the code
+func (c Code) ExitCode() int {
+	for _, info := range codeInfo {
+		if info.code == c {
+			return info.exitCode
+		}
+	}
+	return 1
+}
+
+// Codes returns the distinct codes of warnings, in the order codes are documented
+func Codes(warnings []Warning) []Code {
+	raised := map[Code]bool{}
+	for _, w := range warnings {
+		raised[w.Code] = true
+	}
+	ret := []Code{}
+	for _, info := range codeInfo {
+		if raised[info.code] {
+			ret = append(ret, info.code)
+		}
+	}
+	return ret
+}
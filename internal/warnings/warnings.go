@@ -0,0 +1,177 @@
+// Package warnings collects warnings raised during a scan, so they can be included in scan outputs, and selected
+// categories of warnings can be treated as failures.
+package warnings
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+)
+
+// Category groups warnings of the same kind
+type Category string
+
+const (
+	// Truncation warns that lines were truncated before being sent to LaunchDarkly
+	Truncation Category = "truncation"
+	// Limit warns that a limit on the number of references or the duration of a scan was reached, and results are incomplete
+	Limit Category = "limit"
+	// SkippedFile warns that files were not searched
+	SkippedFile Category = "skipped-file"
+	// OmittedFlag warns that flags were not searched for
+	OmittedFlag Category = "omitted-flag"
+	// Prune warns that code references for deleted branches were not pruned
+	Prune Category = "prune"
+)
+
+// All is every warning category, in the order they are documented
+var All = []Category{Truncation, Limit, SkippedFile, OmittedFlag, Prune}
+
+// ParseCategories parses a comma-separated list of warning categories. "all" selects every category.
+func ParseCategories(s string) ([]Category, error) {
+	ret := []Category{}
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if name == "all" {
+			return All, nil
+		}
+		valid := false
+		for _, c := range All {
+			if Category(name) == c {
+				valid = true
+				ret = append(ret, c)
+			}
+		}
+		if !valid {
+			names := make([]string, 0, len(All))
+			for _, c := range All {
+				names = append(names, string(c))
+			}
+			return nil, fmt.Errorf("'%s' is not a valid warning category, must be one of: all, %s", name, strings.Join(names, ", "))
+		}
+	}
+	return ret, nil
+}
+
+// Warning is a single structured warning
+type Warning struct {
+	Category Category `json:"category"`
+	Code     Code     `json:"code"`
+	Message  string   `json:"message"`
+	// Path is the file the warning applies to, if any
+	Path string `json:"path,omitempty"`
+}
+
+// Collector records warnings. Collectors are safe for concurrent use, and a nil Collector only logs warnings.
+type Collector struct {
+	mu       sync.Mutex
+	warnings []Warning
+}
+
+// Add logs a warning and records it, in the category of its code
+func (c *Collector) Add(code Code, path, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	// report the location of the caller, rather than this function
+	_ = log.Warning.Output(2, msg)
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.warnings = append(c.warnings, Warning{Category: code.Category(), Code: code, Message: msg, Path: path})
+}
+
+// Warnings returns all recorded warnings, sorted by category and path
+func (c *Collector) Warnings() []Warning {
+	if c == nil {
+		return []Warning{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ret := make([]Warning, len(c.warnings))
+	copy(ret, c.warnings)
+	sort.SliceStable(ret, func(i, j int) bool {
+		if ret[i].Category != ret[j].Category {
+			return ret[i].Category < ret[j].Category
+		}
+		return ret[i].Path < ret[j].Path
+	})
+	return ret
+}
+
+// StrictError is returned by Check when warnings were recorded in strict categories
+type StrictError struct {
+	// Codes are the codes of the warnings in strict categories, in the order codes are documented
+	Codes  []Code
+	failed []string
+}
+
+func (e *StrictError) Error() string {
+	return fmt.Sprintf("scan failed due to warnings in strict categories: %s", strings.Join(e.failed, ", "))
+}
+
+// ExitCode returns the exit code of the first code of the warnings in strict categories
+func (e *StrictError) ExitCode() int {
+	if len(e.Codes) == 0 {
+		return 1
+	}
+	return e.Codes[0].ExitCode()
+}
+
+// Check returns a *StrictError if any warnings were recorded in the given categories
+func (c *Collector) Check(categories []Category) error {
+	counts := c.counts()
+	failed := []string{}
+	strict := map[Category]bool{}
+	for _, category := range categories {
+		if counts[category] > 0 {
+			failed = append(failed, fmt.Sprintf("%d %s", counts[category], category))
+			strict[category] = true
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	codes := []Code{}
+	for _, code := range Codes(c.Warnings()) {
+		if strict[code.Category()] {
+			codes = append(codes, code)
+		}
+	}
+	return &StrictError{Codes: codes, failed: failed}
+}
+
+// Summary describes the number of warnings recorded in each category, e.g. "3 warnings (2 truncation, 1 skipped-file)".
+// Returns an empty string if no warnings were recorded.
+func (c *Collector) Summary() string {
+	warnings := c.Warnings()
+	if len(warnings) == 0 {
+		return ""
+	}
+	counts := c.counts()
+	categories := []string{}
+	for _, category := range All {
+		if counts[category] > 0 {
+			categories = append(categories, fmt.Sprintf("%d %s", counts[category], category))
+		}
+	}
+	noun := "warnings"
+	if len(warnings) == 1 {
+		noun = "warning"
+	}
+	return fmt.Sprintf("%d %s (%s)", len(warnings), noun, strings.Join(categories, ", "))
+}
+
+func (c *Collector) counts() map[Category]int {
+	counts := map[Category]int{}
+	for _, w := range c.Warnings() {
+		counts[w.Category]++
+	}
+	return counts
+}
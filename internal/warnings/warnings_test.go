@@ -0,0 +1,107 @@
+package warnings
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+)
+
+func TestMain(m *testing.M) {
+	log.Init(true)
+	os.Exit(m.Run())
+}
+
+func TestParseCategories(t *testing.T) {
+	specs := []struct {
+		name    string
+		value   string
+		want    []Category
+		wantErr bool
+	}{
+		{name: "empty", value: "", want: []Category{}},
+		{name: "single", value: "limit", want: []Category{Limit}},
+		{name: "multiple with spaces", value: "truncation, skipped-file", want: []Category{Truncation, SkippedFile}},
+		{name: "all", value: "limit,all", want: All},
+		{name: "unknown", value: "truncation,unknown", wantErr: true},
+	}
+
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCategories(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCollector(t *testing.T) {
+	c := &Collector{}
+	w := sync.WaitGroup{}
+	for _, path := range []string{"b", "a"} {
+		w.Add(1)
+		go func(path string) {
+			defer w.Done()
+			c.Add(LinesTruncated, path, "truncated lines in %s", path)
+		}(path)
+	}
+	w.Wait()
+	c.Add(ScanTimedOut, "", "limit reached")
+
+	assert.Equal(t, []Warning{
+		{Category: Limit, Code: ScanTimedOut, Message: "limit reached"},
+		{Category: Truncation, Code: LinesTruncated, Message: "truncated lines in a", Path: "a"},
+		{Category: Truncation, Code: LinesTruncated, Message: "truncated lines in b", Path: "b"},
+	}, c.Warnings())
+	assert.Equal(t, []Code{LinesTruncated, ScanTimedOut}, Codes(c.Warnings()))
+
+	assert.NoError(t, c.Check([]Category{SkippedFile, OmittedFlag}))
+	assert.EqualError(t, c.Check(All), "scan failed due to warnings in strict categories: 2 truncation, 1 limit")
+	assert.Equal(t, "3 warnings (2 truncation, 1 limit)", c.Summary())
+}
+
+func TestCollector_Check(t *testing.T) {
+	c := &Collector{}
+	c.Add(FlagsOmittedShort, "", "omitting 1 flags")
+	c.Add(PayloadTruncated, "", "reached the maximum of 1 code references")
+	c.Add(PruneSkippedNoRemote, "", "code references for deleted branches will not be pruned")
+
+	err := c.Check(All)
+	var strictErr *StrictError
+	require.True(t, errors.As(err, &strictErr))
+	assert.Equal(t, []Code{PayloadTruncated, FlagsOmittedShort, PruneSkippedNoRemote}, strictErr.Codes)
+	assert.Equal(t, 11, strictErr.ExitCode(), "the exit code of the first code documented is used")
+
+	err = c.Check([]Category{Prune})
+	require.True(t, errors.As(err, &strictErr))
+	assert.Equal(t, []Code{PruneSkippedNoRemote}, strictErr.Codes)
+	assert.Equal(t, 17, strictErr.ExitCode())
+}
+
+func TestCodes(t *testing.T) {
+	exitCodes := map[int]bool{}
+	for _, info := range codeInfo {
+		assert.Contains(t, All, info.code.Category())
+		assert.False(t, exitCodes[info.exitCode], "exit codes are distinct")
+		exitCodes[info.exitCode] = true
+	}
+	assert.Equal(t, Category(""), Code("UNKNOWN").Category())
+	assert.Equal(t, 1, Code("UNKNOWN").ExitCode())
+}
+
+func TestCollector_nil(t *testing.T) {
+	var c *Collector
+	c.Add(ScanTimedOut, "", "limit reached")
+	assert.Empty(t, c.Warnings())
+	assert.NoError(t, c.Check(All))
+	assert.Empty(t, c.Summary())
+}
@@ -0,0 +1,266 @@
+// Package xlsx writes simple Excel workbooks of text and number cells, with hyperlinks and autofilters, without any
+// formatting other than a bold header row.
+package xlsx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// MaxSheetNameLength is the longest sheet name Excel allows
+	MaxSheetNameLength = 31
+	// maxCellLength is the most characters Excel allows in a cell
+	maxCellLength = 32767
+)
+
+// invalidSheetNameChars are the characters Excel does not allow in sheet names
+var invalidSheetNameChars = strings.NewReplacer(`\`, "_", "/", "_", "?", "_", "*", "_", ":", "_", "[", "(", "]", ")")
+
+// Workbook is a workbook of sheets, in order
+type Workbook struct {
+	Sheets []Sheet
+}
+
+// Sheet is a sheet with a header row, filtered with an autofilter, followed by rows of cells
+type Sheet struct {
+	Name   string
+	Header []string
+	Rows   [][]Cell
+}
+
+// Cell is a text or number cell. If Link is set, the cell is a hyperlink to it.
+type Cell struct {
+	Text   string
+	Number *int
+	Link   string
+}
+
+// Text returns a text cell
+func Text(text string) Cell {
+	return Cell{Text: text}
+}
+
+// Number returns a number cell
+func Number(n int) Cell {
+	return Cell{Number: &n}
+}
+
+// Link returns a text cell which is a hyperlink to url
+func Link(text, url string) Cell {
+	return Cell{Text: text, Link: url}
+}
+
+// SheetName returns a name Excel accepts for a sheet, given a name which may contain invalid characters or be too long
+func SheetName(name string) string {
+	name = strings.Trim(invalidSheetNameChars.Replace(name), "'")
+	if name == "" {
+		name = "_"
+	}
+	if utf8.RuneCountInString(name) > MaxSheetNameLength {
+		name = string([]rune(name)[:MaxSheetNameLength])
+	}
+	return name
+}
+
+// Write writes the workbook to w in the Office Open XML format. Sheet names must be unique and valid, see SheetName.
+func Write(w io.Writer, wb Workbook) error {
+	if len(wb.Sheets) == 0 {
+		return errors.New("workbook must have at least one sheet")
+	}
+	seen := map[string]bool{}
+	for _, s := range wb.Sheets {
+		if s.Name != SheetName(s.Name) {
+			return fmt.Errorf("invalid sheet name %q", s.Name)
+		}
+		if seen[strings.ToLower(s.Name)] {
+			return fmt.Errorf("duplicate sheet name %q", s.Name)
+		}
+		seen[strings.ToLower(s.Name)] = true
+	}
+
+	z := zip.NewWriter(w)
+	parts := []part{
+		{"[Content_Types].xml", contentTypes(wb)},
+		{"_rels/.rels", rootRels},
+		{"xl/workbook.xml", workbook(wb)},
+		{"xl/_rels/workbook.xml.rels", workbookRels(wb)},
+		{"xl/styles.xml", styles},
+	}
+	for i, s := range wb.Sheets {
+		sheetXML, rels := worksheet(s)
+		parts = append(parts, part{fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), sheetXML})
+		if rels != "" {
+			parts = append(parts, part{fmt.Sprintf("xl/worksheets/_rels/sheet%d.xml.rels", i+1), rels})
+		}
+	}
+	for _, p := range parts {
+		f, err := z.Create(p.name)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(f, xml.Header+p.content)
+		if err != nil {
+			return err
+		}
+	}
+	return z.Close()
+}
+
+// part is a file in the workbook package
+type part struct {
+	name    string
+	content string
+}
+
+const rootRels = `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+// styles defines the cell formats referenced by worksheets: 0 is the default, 1 is the bold header, and 2 is a hyperlink
+const styles = `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<fonts count="3"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font>` +
+	`<font><u/><sz val="11"/><color rgb="FF0563C1"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="3"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`<xf numFmtId="0" fontId="2" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>` +
+	`</styleSheet>`
+
+const (
+	styleHeader = 1
+	styleLink   = 2
+)
+
+func contentTypes(wb Workbook) string {
+	b := &strings.Builder{}
+	b.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	b.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	b.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	b.WriteString(`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	b.WriteString(`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	for i := range wb.Sheets {
+		fmt.Fprintf(b, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1)
+	}
+	b.WriteString(`</Types>`)
+	return b.String()
+}
+
+func workbook(wb Workbook) string {
+	b := &strings.Builder{}
+	b.WriteString(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	for i, s := range wb.Sheets {
+		fmt.Fprintf(b, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, escape(s.Name), i+1, i+1)
+	}
+	b.WriteString(`</sheets><definedNames>`)
+	for i, s := range wb.Sheets {
+		// Excel records the range of each autofilter as a hidden name
+		fmt.Fprintf(b, `<definedName name="_xlnm._FilterDatabase" localSheetId="%d" hidden="1">%s</definedName>`, i, escape(fmt.Sprintf("'%s'!$A$1:$%s$%d", strings.ReplaceAll(s.Name, "'", "''"), column(len(s.Header)-1), len(s.Rows)+1)))
+	}
+	b.WriteString(`</definedNames></workbook>`)
+	return b.String()
+}
+
+func workbookRels(wb Workbook) string {
+	b := &strings.Builder{}
+	b.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i := range wb.Sheets {
+		fmt.Fprintf(b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, i+1)
+	}
+	fmt.Fprintf(b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, len(wb.Sheets)+1)
+	b.WriteString(`</Relationships>`)
+	return b.String()
+}
+
+// worksheet returns the XML of a sheet, and the relationships of its hyperlinks, if any
+func worksheet(s Sheet) (string, string) {
+	b := &strings.Builder{}
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">`)
+	// freeze the header row
+	b.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	b.WriteString(`<sheetData><row r="1">`)
+	for i, h := range s.Header {
+		writeCell(b, cellRef(i, 1), Text(h), styleHeader)
+	}
+	b.WriteString(`</row>`)
+	links := &strings.Builder{}
+	rels := &strings.Builder{}
+	linkCount := 0
+	for r, row := range s.Rows {
+		fmt.Fprintf(b, `<row r="%d">`, r+2)
+		for i, c := range row {
+			ref := cellRef(i, r+2)
+			style := 0
+			if c.Link != "" {
+				style = styleLink
+				linkCount++
+				id := fmt.Sprintf("rId%d", linkCount)
+				fmt.Fprintf(links, `<hyperlink ref="%s" r:id="%s"/>`, ref, id)
+				fmt.Fprintf(rels, `<Relationship Id="%s" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/hyperlink" Target="%s" TargetMode="External"/>`, id, escape(c.Link))
+			}
+			writeCell(b, ref, c, style)
+		}
+		b.WriteString(`</row>`)
+	}
+	b.WriteString(`</sheetData>`)
+	fmt.Fprintf(b, `<autoFilter ref="A1:%s"/>`, cellRef(len(s.Header)-1, len(s.Rows)+1))
+	if links.Len() > 0 {
+		b.WriteString(`<hyperlinks>` + links.String() + `</hyperlinks>`)
+	}
+	b.WriteString(`</worksheet>`)
+	if rels.Len() == 0 {
+		return b.String(), ""
+	}
+	return b.String(), `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` + rels.String() + `</Relationships>`
+}
+
+func writeCell(b *strings.Builder, ref string, c Cell, style int) {
+	styleAttr := ""
+	if style != 0 {
+		styleAttr = fmt.Sprintf(` s="%d"`, style)
+	}
+	if c.Number != nil {
+		fmt.Fprintf(b, `<c r="%s"%s><v>%d</v></c>`, ref, styleAttr, *c.Number)
+		return
+	}
+	text := c.Text
+	if utf8.RuneCountInString(text) > maxCellLength {
+		text = string([]rune(text)[:maxCellLength])
+	}
+	fmt.Fprintf(b, `<c r="%s" t="inlineStr"%s><is><t xml:space="preserve">%s</t></is></c>`, ref, styleAttr, escape(text))
+}
+
+// escape escapes text for XML, removing characters which are not allowed in XML documents, such as control characters
+func escape(text string) string {
+	text = strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' || r == '\r' || (r >= 0x20 && r != 0xFFFE && r != 0xFFFF && !(r >= 0xD800 && r <= 0xDFFF)) {
+			return r
+		}
+		return -1
+	}, text)
+	b := &strings.Builder{}
+	_ = xml.EscapeText(b, []byte(text))
+	return b.String()
+}
+
+// cellRef returns the A1 reference of a cell, given its zero-based column and one-based row
+func cellRef(col, row int) string {
+	return column(col) + strconv.Itoa(row)
+}
+
+// column returns the letters of a zero-based column
+func column(col int) string {
+	name := ""
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = string(rune('A'+(col-1)%26)) + name
+	}
+	return name
+}
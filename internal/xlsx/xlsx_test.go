@@ -0,0 +1,84 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readParts(t *testing.T, data []byte) map[string]string {
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	parts := map[string]string{}
+	for _, f := range r.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		content, err := ioutil.ReadAll(rc)
+		require.NoError(t, err)
+		rc.Close()
+		parts[f.Name] = string(content)
+
+		d := xml.NewDecoder(bytes.NewReader(content))
+		for {
+			_, err := d.Token()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err, "%s is well-formed XML", f.Name)
+		}
+	}
+	return parts
+}
+
+func TestWrite(t *testing.T) {
+	wb := Workbook{Sheets: []Sheet{
+		{Name: "All references", Header: []string{"Flag", "Line", "Link"}, Rows: [][]Cell{
+			{Text("flag-1"), Number(10), Link("Open", "https://example.com/a.go?x=1&y=2#L10")},
+			{Text("<b>\"quoted\"</b>\x00\nnext line"), Number(2), Text("")},
+		}},
+		{Name: "Empty", Header: []string{"Flag"}},
+	}}
+	buf := &bytes.Buffer{}
+	require.NoError(t, Write(buf, wb))
+
+	parts := readParts(t, buf.Bytes())
+	assert.Contains(t, parts["xl/workbook.xml"], `<sheet name="All references" sheetId="1" r:id="rId1"/>`)
+	assert.Contains(t, parts["xl/workbook.xml"], `&#39;All references&#39;!$A$1:$C$3`)
+
+	sheet := parts["xl/worksheets/sheet1.xml"]
+	assert.Contains(t, sheet, `<c r="A1" t="inlineStr" s="1"><is><t xml:space="preserve">Flag</t></is></c>`)
+	assert.Contains(t, sheet, `<c r="B2"><v>10</v></c>`)
+	assert.Contains(t, sheet, `<t xml:space="preserve">&lt;b&gt;&#34;quoted&#34;&lt;/b&gt;&#xA;next line</t>`, "text is escaped, and invalid characters are removed")
+	assert.Contains(t, sheet, `<autoFilter ref="A1:C3"/>`)
+	assert.Contains(t, sheet, `<hyperlink ref="C2" r:id="rId1"/>`)
+	assert.Contains(t, parts["xl/worksheets/_rels/sheet1.xml.rels"], `Target="https://example.com/a.go?x=1&amp;y=2#L10" TargetMode="External"`)
+
+	assert.Contains(t, parts["xl/worksheets/sheet2.xml"], `<autoFilter ref="A1:A1"/>`)
+	assert.NotContains(t, parts, "xl/worksheets/_rels/sheet2.xml.rels", "sheets without links have no relationships")
+}
+
+func TestWrite_invalidSheets(t *testing.T) {
+	assert.EqualError(t, Write(ioutil.Discard, Workbook{}), "workbook must have at least one sheet")
+	assert.EqualError(t, Write(ioutil.Discard, Workbook{Sheets: []Sheet{{Name: "a/b"}}}), `invalid sheet name "a/b"`)
+	assert.EqualError(t, Write(ioutil.Discard, Workbook{Sheets: []Sheet{{Name: "Tag"}, {Name: "tag"}}}), `duplicate sheet name "tag"`)
+}
+
+func TestSheetName(t *testing.T) {
+	assert.Equal(t, "team_payments (beta)", SheetName("team/payments [beta]"))
+	assert.Equal(t, "_", SheetName("''"))
+	assert.Equal(t, "abcdefghijklmnopqrstuvwxyzabcde", SheetName("abcdefghijklmnopqrstuvwxyzabcdefghij"))
+}
+
+func TestColumn(t *testing.T) {
+	assert.Equal(t, "A", column(0))
+	assert.Equal(t, "Z", column(25))
+	assert.Equal(t, "AA", column(26))
+	assert.Equal(t, "AZ", column(51))
+	assert.Equal(t, "BA", column(52))
+}
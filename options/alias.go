@@ -1,17 +1,25 @@
 package options
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
 	"regexp"
 	"strings"
+	"text/template"
+	"time"
+
+	"github.com/spf13/viper"
 )
 
 type AliasType string
 
 func (a AliasType) IsValid() error {
 	switch a.Canonical() {
-	case Literal, CamelCase, PascalCase, SnakeCase, UpperSnakeCase, KebabCase, DotCase, FilePattern, Command:
+	case Literal, CamelCase, PascalCase, SnakeCase, UpperSnakeCase, KebabCase, DotCase, FilePattern, Command, Template, Pipeline, Exclude:
 		return nil
 	}
 	return fmt.Errorf("'%s' is not a valid alias type", a)
@@ -42,14 +50,60 @@ const (
 	FilePattern AliasType = "filepattern"
 
 	Command AliasType = "command"
+
+	Template AliasType = "template"
+
+	Pipeline AliasType = "pipeline"
+
+	// Exclude removes aliases generated by other alias configurations for specific flags
+	Exclude AliasType = "exclude"
+)
+
+// AliasCollisionPolicy determines how an alias generated for more than one flag is attributed
+type AliasCollisionPolicy string
+
+const (
+	// AttributeToAll attributes references to a colliding alias to every flag which generated it
+	AttributeToAll AliasCollisionPolicy = "all"
+	// AttributeToNone ignores colliding aliases
+	AttributeToNone AliasCollisionPolicy = "none"
+	// RequireLiteral attributes references to a colliding alias only to flags which define it with a literal alias
+	RequireLiteral AliasCollisionPolicy = "literal"
+	// AttributeToPriority attributes references to a colliding alias only to flags which generated it with the alias
+	// configuration of highest priority
+	AttributeToPriority AliasCollisionPolicy = "priority"
 )
 
+func (p AliasCollisionPolicy) IsValid() error {
+	switch p {
+	case AttributeToAll, AttributeToNone, RequireLiteral, AttributeToPriority:
+		return nil
+	}
+	return fmt.Errorf("'%s' is not a valid alias collision policy, must be one of: %s, %s, %s, %s", p, AttributeToAll, AttributeToNone, RequireLiteral, AttributeToPriority)
+}
+
 // Alias is a catch-all type for alias configurations
 type Alias struct {
 	Type AliasType `mapstructure:"type"`
 	Name string    `mapstructure:"name"`
 
-	// Literal
+	// StripPrefix is a regular expression matching a prefix to remove from flag keys before generating aliases.
+	// Applies to naming convention, template, and pipeline aliases.
+	StripPrefix string `mapstructure:"stripPrefix,omitempty"`
+
+	// CaseInsensitive matches the aliases generated by this configuration regardless of case
+	CaseInsensitive bool `mapstructure:"caseInsensitive,omitempty"`
+
+	// Priority orders alias configurations. Configurations of higher priority generate aliases first, and aliases
+	// generated by more than one configuration are attributed to the configuration of highest priority. Configurations
+	// of equal priority are applied in the order they are defined.
+	Priority int `mapstructure:"priority,omitempty"`
+
+	// Exclusive prevents configurations of lower priority from generating aliases for a flag if this configuration
+	// generates any aliases for it
+	Exclusive bool `mapstructure:"exclusive,omitempty"`
+
+	// Literal, Exclude
 	Flags map[string][]string `mapstructure:"flags,omitempty"`
 
 	// FilePattern
@@ -59,6 +113,124 @@ type Alias struct {
 	// Command
 	Command *string `mapstructure:"command,omitempty"`
 	Timeout *int64  `mapstructure:"timeout,omitempty"`
+
+	// Template
+	Templates []string `mapstructure:"templates,omitempty"`
+
+	// Pipeline
+	Steps []AliasStep `mapstructure:"steps,omitempty"`
+}
+
+// AliasStep is a single transform in an alias pipeline. Steps are applied in order to the output of the previous step.
+type AliasStep struct {
+	Transform string `mapstructure:"transform"`
+	// Value is the text used by the prefix, suffix, trimPrefix, and trimSuffix transforms
+	Value string `mapstructure:"value,omitempty"`
+	// If set to `true`, the output of this step is also used as an alias, in addition to the output of the final step
+	Emit bool `mapstructure:"emit,omitempty"`
+}
+
+const (
+	stepUpper      = "upper"
+	stepLower      = "lower"
+	stepPrefix     = "prefix"
+	stepSuffix     = "suffix"
+	stepTrimPrefix = "trimprefix"
+	stepTrimSuffix = "trimsuffix"
+)
+
+func (s AliasStep) IsValid() error {
+	transform := strings.ToLower(s.Transform)
+	switch AliasType(transform) {
+	case CamelCase, PascalCase, SnakeCase, UpperSnakeCase, KebabCase, DotCase:
+		if s.Value != "" {
+			return fmt.Errorf("unexpected field for %s step: 'value'", transform)
+		}
+		return nil
+	}
+	switch transform {
+	case stepUpper, stepLower:
+		if s.Value != "" {
+			return fmt.Errorf("unexpected field for %s step: 'value'", transform)
+		}
+	case stepPrefix, stepSuffix, stepTrimPrefix, stepTrimSuffix:
+		if s.Value == "" {
+			return fmt.Errorf("%s steps must provide a 'value'", transform)
+		}
+	default:
+		return fmt.Errorf("'%s' is not a valid pipeline transform", s.Transform)
+	}
+	return nil
+}
+
+// Apply returns the result of applying the step's transform to s
+func (s AliasStep) Apply(in string) string {
+	switch strings.ToLower(s.Transform) {
+	case string(CamelCase), string(PascalCase), string(SnakeCase), string(UpperSnakeCase), string(KebabCase), string(DotCase):
+		return ConvertCase(AliasType(s.Transform), in)
+	case stepUpper:
+		return strings.ToUpper(in)
+	case stepLower:
+		return strings.ToLower(in)
+	case stepPrefix:
+		return s.Value + in
+	case stepSuffix:
+		return in + s.Value
+	case stepTrimPrefix:
+		return strings.TrimPrefix(in, s.Value)
+	case stepTrimSuffix:
+		return strings.TrimSuffix(in, s.Value)
+	}
+	return in
+}
+
+// AliasTemplateData is the data available to template aliases, containing the flag key transposed to each supported naming convention
+type AliasTemplateData struct {
+	Key        string
+	Camel      string
+	Pascal     string
+	Snake      string
+	UpperSnake string
+	Kebab      string
+	Dot        string
+}
+
+func NewAliasTemplateData(flag string) AliasTemplateData {
+	return AliasTemplateData{
+		Key:        flag,
+		Camel:      ConvertCase(CamelCase, flag),
+		Pascal:     ConvertCase(PascalCase, flag),
+		Snake:      ConvertCase(SnakeCase, flag),
+		UpperSnake: ConvertCase(UpperSnakeCase, flag),
+		Kebab:      ConvertCase(KebabCase, flag),
+		Dot:        ConvertCase(DotCase, flag),
+	}
+}
+
+var aliasTemplateFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// StripKeyPrefix removes the prefix matched by the alias' stripPrefix pattern from a flag key
+func (a Alias) StripKeyPrefix(flag string) string {
+	if a.StripPrefix == "" {
+		return flag
+	}
+	pattern, err := stripPrefixPattern(a.StripPrefix)
+	if err != nil {
+		return flag
+	}
+	return pattern.ReplaceAllString(flag, "")
+}
+
+func stripPrefixPattern(prefix string) (*regexp.Regexp, error) {
+	return regexp.Compile("^(?:" + prefix + ")")
+}
+
+// ParseAliasTemplate parses a template alias. Referencing a field not defined by AliasTemplateData is an error.
+func ParseAliasTemplate(text string) (*template.Template, error) {
+	return template.New("alias").Funcs(aliasTemplateFuncs).Option("missingkey=error").Parse(text)
 }
 
 func (a *Alias) IsValid() error {
@@ -72,6 +244,13 @@ func (a *Alias) IsValid() error {
 		if a.Flags == nil {
 			return errors.New("literal aliases must provide an 'flags'")
 		}
+	case Exclude:
+		if len(a.Flags) == 0 {
+			return errors.New("exclude aliases must provide at least one flag in 'flags'")
+		}
+		if a.Priority != 0 || a.Exclusive {
+			return errors.New("exclude aliases are applied after all aliases are generated, and cannot set 'priority' or 'exclusive'")
+		}
 	case FilePattern:
 		if len(a.Paths) == 0 {
 			return errors.New("filepattern aliases must provide at least one path in 'paths'")
@@ -88,6 +267,30 @@ func (a *Alias) IsValid() error {
 				return fmt.Errorf("could not validate regex pattern: %v", err)
 			}
 		}
+	case Template:
+		if len(a.Templates) == 0 {
+			return errors.New("template aliases must provide at least one template in 'templates'")
+		}
+		for _, text := range a.Templates {
+			tmpl, err := ParseAliasTemplate(text)
+			if err != nil {
+				return fmt.Errorf("could not parse template '%s': %v", text, err)
+			}
+			err = tmpl.Execute(ioutil.Discard, NewAliasTemplateData("flag-key"))
+			if err != nil {
+				return fmt.Errorf("could not execute template '%s': %v", text, err)
+			}
+		}
+	case Pipeline:
+		if len(a.Steps) == 0 {
+			return errors.New("pipeline aliases must provide at least one step in 'steps'")
+		}
+		for i, step := range a.Steps {
+			err := step.IsValid()
+			if err != nil {
+				return fmt.Errorf("invalid value for 'steps[%d]': %w", i, err)
+			}
+		}
 	case Command:
 		if a.Command == nil {
 			return errors.New("command aliases must provide a 'command'")
@@ -97,10 +300,22 @@ func (a *Alias) IsValid() error {
 		}
 	}
 
+	if a.StripPrefix != "" {
+		switch a.Type.Canonical() {
+		case CamelCase, PascalCase, SnakeCase, UpperSnakeCase, KebabCase, DotCase, Template, Pipeline:
+		default:
+			return a.Type.unexpectedFieldErr("stripPrefix")
+		}
+		_, err := stripPrefixPattern(a.StripPrefix)
+		if err != nil {
+			return fmt.Errorf("could not validate stripPrefix pattern: %v", err)
+		}
+	}
+
 	// Validate unexpected fields
 	var unexpectedField string
 	switch {
-	case a.Type != Literal:
+	case a.Type != Literal && a.Type != Exclude:
 		if a.Flags != nil {
 			unexpectedField = "flags"
 		}
@@ -118,6 +333,14 @@ func (a *Alias) IsValid() error {
 		if a.Timeout != nil {
 			unexpectedField = "timeout"
 		}
+	case a.Type != Template:
+		if len(a.Templates) > 0 {
+			unexpectedField = "templates"
+		}
+	case a.Type != Pipeline:
+		if len(a.Steps) > 0 {
+			unexpectedField = "steps"
+		}
 	}
 	if unexpectedField != "" {
 		return a.Type.unexpectedFieldErr(unexpectedField)
@@ -125,3 +348,80 @@ func (a *Alias) IsValid() error {
 
 	return nil
 }
+
+// remoteSourceTimeout is the timeout of requests for alias sources and base configurations fetched from URLs
+const remoteSourceTimeout = 30 * time.Second
+
+// isRemoteSource returns true if an alias source or base configuration is an http(s) URL
+func isRemoteSource(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+// LoadAliasSources reads shared alias definitions from each source, which may be an http(s) URL or a file path relative to dir,
+// e.g. a checkout of a shared configuration repository. Each source must be a YAML document with an `aliases` list, using the
+// same format as coderefs.yaml. As sources are read from the repository's configuration, files must be inside dir, and URLs
+// must be allowed by allowedSources, the allowedConfigSources option.
+func LoadAliasSources(sources []string, dir, allowedSources string) ([]Alias, error) {
+	ret := []Alias{}
+	client := http.Client{Timeout: remoteSourceTimeout}
+	policy := newSourcePolicy(dir, allowedSources)
+	for _, source := range sources {
+		var data []byte
+		var err error
+		if isRemoteSource(source) {
+			err = policy.check(source)
+			if err == nil {
+				data, err = fetchRemoteSource(client, source)
+			}
+		} else {
+			path := source
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(dir, path)
+			}
+			err = policy.check(filepath.Clean(path))
+			if err == nil {
+				/* #nosec */
+				data, err = ioutil.ReadFile(path)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read alias source '%s': %w", source, err)
+		}
+
+		v := viper.New()
+		v.SetConfigType("yaml")
+		err = v.ReadConfig(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("could not parse alias source '%s': %w", source, err)
+		}
+		var config struct {
+			Aliases []Alias `mapstructure:"aliases"`
+		}
+		err = v.Unmarshal(&config)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse alias source '%s': %w", source, err)
+		}
+		for i, a := range config.Aliases {
+			err = a.IsValid()
+			if err != nil {
+				return nil, fmt.Errorf("alias source '%s': invalid value for \"aliases[%d]\": %w", source, i, err)
+			}
+		}
+		ret = append(ret, config.Aliases...)
+	}
+	return ret, nil
+}
+
+// fetchRemoteSource returns the body of a successful GET request for url
+func fetchRemoteSource(client http.Client, url string) ([]byte, error) {
+	/* #nosec */
+	res, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	}
+	return ioutil.ReadAll(res.Body)
+}
@@ -0,0 +1,186 @@
+package options
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadAliasSources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aliassources")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "repo"), 0700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "shared.yaml"), []byte("aliases:\n  - type: camelcase\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "repo", "shared.yaml"), []byte("aliases:\n  - type: camelcase\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "repo", "invalid.yaml"), []byte("aliases:\n  - type: notatype\n"), 0600))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/aliases.yaml" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte("aliases:\n  - type: literal\n    flags:\n      my-flag:\n        - MY_FLAG\n"))
+	}))
+	defer server.Close()
+
+	specs := []struct {
+		name    string
+		sources []string
+		allowed string
+		want    []Alias
+		wantErr bool
+	}{
+		{
+			name:    "file and url sources",
+			sources: []string{"shared.yaml", server.URL + "/aliases.yaml"},
+			allowed: server.URL,
+			want: []Alias{
+				{Type: CamelCase},
+				{Type: Literal, Flags: map[string][]string{"my-flag": {"MY_FLAG"}}},
+			},
+		},
+		{
+			name:    "missing file",
+			sources: []string{"missing.yaml"},
+			wantErr: true,
+		},
+		{
+			name:    "url not found",
+			sources: []string{server.URL + "/missing.yaml"},
+			allowed: server.URL,
+			wantErr: true,
+		},
+		{
+			name:    "url not allowed",
+			sources: []string{server.URL + "/aliases.yaml"},
+			wantErr: true,
+		},
+		{
+			name:    "file outside directory",
+			sources: []string{"../shared.yaml"},
+			wantErr: true,
+		},
+		{
+			name:    "absolute file outside directory",
+			sources: []string{"/etc/hosts"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid alias",
+			sources: []string{"invalid.yaml"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadAliasSources(tt.sources, filepath.Join(dir, "repo"), tt.allowed)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAliasIsValid_template(t *testing.T) {
+	specs := []struct {
+		name      string
+		templates []string
+		wantErr   bool
+	}{
+		{"valid", []string{"FeatureFlags.{{.Pascal}}", "{{.Snake | upper}}"}, false},
+		{"no templates", nil, true},
+		{"unknown field", []string{"{{.Unknown}}"}, true},
+		{"parse error", []string{"{{.Pascal"}, true},
+	}
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			a := Alias{Type: Template, Templates: tt.templates}
+			err := a.IsValid()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestAliasIsValid_pipeline(t *testing.T) {
+	specs := []struct {
+		name    string
+		steps   []AliasStep
+		wantErr bool
+	}{
+		{"valid", []AliasStep{{Transform: "camelCase"}, {Transform: "prefix", Value: "FLAG_"}, {Transform: "upper"}}, false},
+		{"no steps", nil, true},
+		{"unknown transform", []AliasStep{{Transform: "reverse"}}, true},
+		{"missing value", []AliasStep{{Transform: "suffix"}}, true},
+		{"unexpected value", []AliasStep{{Transform: "upper", Value: "x"}}, true},
+	}
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			a := Alias{Type: Pipeline, Steps: tt.steps}
+			err := a.IsValid()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestAliasIsValid_stripPrefix(t *testing.T) {
+	specs := []struct {
+		name    string
+		alias   Alias
+		wantErr bool
+	}{
+		{"valid", Alias{Type: CamelCase, StripPrefix: `\w+\.`}, false},
+		{"invalid pattern", Alias{Type: CamelCase, StripPrefix: `(`}, true},
+		{"unsupported type", Alias{Type: Literal, Flags: map[string][]string{}, StripPrefix: `\w+\.`}, true},
+	}
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.alias.IsValid()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestAliasIsValid_exclude(t *testing.T) {
+	specs := []struct {
+		name    string
+		alias   Alias
+		wantErr bool
+	}{
+		{"valid", Alias{Type: Exclude, Flags: map[string][]string{"new-user": {"newUser"}}}, false},
+		{"no flags", Alias{Type: Exclude}, true},
+		{"priority", Alias{Type: Exclude, Priority: 1, Flags: map[string][]string{"new-user": {"newUser"}}}, true},
+	}
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.alias.IsValid()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
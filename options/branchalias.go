@@ -0,0 +1,51 @@
+package options
+
+import (
+	"fmt"
+	"strings"
+)
+
+// BranchAlias maps the name a branch is scanned under, such as the name of a branch in a mirror or fork, to the name its
+// code references are sent to LaunchDarkly under. From may contain a single `*`, matching any characters, which are
+// substituted for a `*` in To, e.g. from `mirror/*` to `*` maps mirror/main to main.
+type BranchAlias struct {
+	From string `mapstructure:"from"`
+	To   string `mapstructure:"to"`
+}
+
+// CanonicalBranch returns the name a branch is sent to LaunchDarkly under, using the first branch alias which matches
+// name. Returns name if no alias matches.
+func CanonicalBranch(aliases []BranchAlias, name string) string {
+	for _, a := range aliases {
+		if to, ok := a.match(name); ok {
+			return to
+		}
+	}
+	return name
+}
+
+func (a BranchAlias) match(name string) (string, bool) {
+	i := strings.Index(a.From, "*")
+	if i < 0 {
+		return a.To, name == a.From
+	}
+	prefix, suffix := a.From[:i], a.From[i+1:]
+	if len(name) < len(prefix)+len(suffix) || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+		return "", false
+	}
+	wildcard := name[len(prefix) : len(name)-len(suffix)]
+	return strings.Replace(a.To, "*", wildcard, 1), true
+}
+
+func (a BranchAlias) validate() error {
+	if a.From == "" || a.To == "" {
+		return fmt.Errorf(`"from" and "to" must both be provided`)
+	}
+	if strings.Count(a.From, "*") > 1 || strings.Count(a.To, "*") > 1 {
+		return fmt.Errorf(`"from" and "to" may each contain at most one "*"`)
+	}
+	if strings.Contains(a.To, "*") && !strings.Contains(a.From, "*") {
+		return fmt.Errorf(`"to" may only contain "*" if "from" contains "*"`)
+	}
+	return nil
+}
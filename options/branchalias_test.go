@@ -0,0 +1,40 @@
+package options
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanonicalBranch(t *testing.T) {
+	aliases := []BranchAlias{
+		{From: "mirror/master", To: "main"},
+		{From: "mirror/*", To: "*"},
+		{From: "fork-*-upstream", To: "upstream/*"},
+	}
+	specs := []struct {
+		name string
+		want string
+	}{
+		{name: "mirror/master", want: "main"},
+		{name: "mirror/main", want: "main"},
+		{name: "mirror/feature/ABC#123-añadir", want: "feature/ABC#123-añadir"},
+		{name: "fork-release-upstream", want: "upstream/release"},
+		{name: "fork-upstream", want: "fork-upstream"},
+		{name: "main", want: "main"},
+	}
+
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, CanonicalBranch(aliases, tt.name))
+		})
+	}
+}
+
+func TestBranchAlias_validate(t *testing.T) {
+	assert.NoError(t, BranchAlias{From: "mirror/*", To: "*"}.validate())
+	assert.NoError(t, BranchAlias{From: "mirror/*", To: "main"}.validate())
+	assert.EqualError(t, BranchAlias{From: "mirror/main"}.validate(), `"from" and "to" must both be provided`)
+	assert.EqualError(t, BranchAlias{From: "*/*", To: "*"}.validate(), `"from" and "to" may each contain at most one "*"`)
+	assert.EqualError(t, BranchAlias{From: "mirror/main", To: "*"}.validate(), `"to" may only contain "*" if "from" contains "*"`)
+}
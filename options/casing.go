@@ -0,0 +1,117 @@
+package options
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/iancoleman/strcase"
+)
+
+// unicodeNumberSequence separates numbers from the letters around them, like strcase does for ASCII letters
+var unicodeNumberSequence = regexp.MustCompile(`(\pL)(\d+)(\pL?)`)
+
+// ConvertCase returns s converted to the naming convention of a case alias type, e.g. "my-flag" to "myFlag" for camelCase,
+// or s unchanged if the alias type is not a naming convention.
+//
+// strcase only recognizes ASCII letters, and drops any other letters from camelCase and PascalCase, e.g. "über-flag"
+// would become "berFlag". Strings containing only ASCII characters are converted by strcase, so their aliases are
+// unchanged, while other strings are converted by the same rules applied to Unicode letters.
+func ConvertCase(t AliasType, s string) string {
+	switch t.Canonical() {
+	case CamelCase:
+		if isASCII(s) {
+			return strcase.ToLowerCamel(s)
+		}
+		return toUnicodeCamel(s, false)
+	case PascalCase:
+		if isASCII(s) {
+			return strcase.ToCamel(s)
+		}
+		return toUnicodeCamel(s, true)
+	case SnakeCase:
+		if isASCII(s) {
+			return strcase.ToSnake(s)
+		}
+		return toUnicodeDelimited(s, '_', false)
+	case UpperSnakeCase:
+		if isASCII(s) {
+			return strcase.ToScreamingSnake(s)
+		}
+		return toUnicodeDelimited(s, '_', true)
+	case KebabCase:
+		if isASCII(s) {
+			return strcase.ToKebab(s)
+		}
+		return toUnicodeDelimited(s, '-', false)
+	case DotCase:
+		if isASCII(s) {
+			return strcase.ToDelimited(s, '.')
+		}
+		return toUnicodeDelimited(s, '.', false)
+	}
+	return s
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// toUnicodeCamel converts s to camelCase, or PascalCase if upperFirst is set. Letters without case, such as those of
+// Japanese or Chinese, are kept as they are.
+func toUnicodeCamel(s string, upperFirst bool) string {
+	runes := []rune(strings.Trim(unicodeNumberSequence.ReplaceAllString(s, "$1 $2 $3"), " "))
+	if !upperFirst && len(runes) > 0 && unicode.IsUpper(runes[0]) {
+		runes[0] = unicode.ToLower(runes[0])
+	}
+	var sb strings.Builder
+	capNext := upperFirst
+	for _, r := range runes {
+		switch {
+		case unicode.IsLower(r) && capNext:
+			sb.WriteRune(unicode.ToUpper(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r):
+			sb.WriteRune(r)
+		}
+		capNext = r == '_' || r == ' ' || r == '-' || r == '.'
+	}
+	return sb.String()
+}
+
+// toUnicodeDelimited converts s to words separated by delimiter, in upper case if screaming is set, and otherwise in lower
+// case. A change between lower and upper case letters starts a new word, e.g. "straßeFlag" becomes "straße_flag".
+func toUnicodeDelimited(s string, delimiter rune, screaming bool) string {
+	runes := []rune(strings.Trim(unicodeNumberSequence.ReplaceAllString(s, "$1 $2 $3"), " "))
+	out := make([]rune, 0, len(runes)+4)
+	for i, r := range runes {
+		caseChanges := false
+		if i+1 < len(runes) {
+			next := runes[i+1]
+			caseChanges = unicode.IsUpper(r) && unicode.IsLower(next) || unicode.IsLower(r) && unicode.IsUpper(next)
+		}
+		switch {
+		case i > 0 && out[len(out)-1] != delimiter && caseChanges:
+			// the word boundary is before an upper case letter followed by lower case, and after a lower case letter
+			// followed by upper case
+			if unicode.IsUpper(r) {
+				out = append(out, delimiter, r)
+			} else {
+				out = append(out, r, delimiter)
+			}
+		case r == ' ' || r == '_' || r == '-':
+			out = append(out, delimiter)
+		default:
+			out = append(out, r)
+		}
+	}
+	if screaming {
+		return strings.ToUpper(string(out))
+	}
+	return strings.ToLower(string(out))
+}
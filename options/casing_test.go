@@ -0,0 +1,34 @@
+package options
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvertCase(t *testing.T) {
+	specs := []struct {
+		name string
+		t    AliasType
+		s    string
+		want string
+	}{
+		{name: "ascii camelCase", t: CamelCase, s: "my-flag_v2", want: "myFlagV2"},
+		{name: "ascii snake_case", t: SnakeCase, s: "myFlag", want: "my_flag"},
+		{name: "accented camelCase", t: CamelCase, s: "über-flag", want: "überFlag"},
+		{name: "accented PascalCase", t: PascalCase, s: "über-flag", want: "ÜberFlag"},
+		{name: "accented snake_case", t: SnakeCase, s: "straßeFlag", want: "straße_flag"},
+		{name: "accented SCREAMING_SNAKE_CASE", t: UpperSnakeCase, s: "über-flag", want: "ÜBER_FLAG"},
+		{name: "accented kebab-case", t: KebabCase, s: "ÜberFlag", want: "über-flag"},
+		{name: "accented dot.case", t: DotCase, s: "über_flag", want: "über.flag"},
+		{name: "uncased letters", t: CamelCase, s: "日本-フラグ", want: "日本フラグ"},
+		{name: "combining accents", t: CamelCase, s: "über-flag", want: "überFlag"},
+		{name: "not a naming convention", t: Literal, s: "über-flag", want: "über-flag"},
+	}
+
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ConvertCase(tt.t, tt.s))
+		})
+	}
+}
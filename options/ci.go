@@ -0,0 +1,143 @@
+package options
+
+import (
+	"bufio"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// CI systems whose environment can be used to populate options
+const (
+	CIAuto     = "auto"
+	CIBamboo   = "bamboo"
+	CITeamCity = "teamcity"
+)
+
+// ciEnvironment is the build information a CI system provides
+type ciEnvironment struct {
+	branch      string
+	repoUrl     string
+	buildNumber string
+}
+
+// ciDetectors detect whether a scan is running in a CI system, in the order they are checked by CIAuto
+var ciDetectors = []struct {
+	name   string
+	detect func() bool
+	read   func() ciEnvironment
+}{
+	{CITeamCity, func() bool { return os.Getenv("TEAMCITY_VERSION") != "" }, readTeamCityEnvironment},
+	{CIBamboo, func() bool { return os.Getenv("bamboo_buildNumber") != "" }, readBambooEnvironment},
+}
+
+// mergeCIEnvironment populates the branch, repository, and updateSequenceId options from the environment of the CI system
+// selected by the ci option. Options which were provided are not replaced.
+func (o Options) mergeCIEnvironment() Options {
+	if o.CI == "" {
+		return o
+	}
+	for _, ci := range ciDetectors {
+		if o.CI != ci.name && !(o.CI == CIAuto && ci.detect()) {
+			continue
+		}
+		env := ci.read()
+		if o.Branch == "" {
+			o.Branch = strings.TrimPrefix(env.branch, "refs/heads/")
+		}
+		name, repoType, repoUrl := repoFromCloneUrl(env.repoUrl)
+		if o.RepoName == "" {
+			o.RepoName = name
+		}
+		if o.RepoUrl == "" && repoUrl != "" {
+			o.RepoUrl = repoUrl
+			if strings.ToLower(o.RepoType) == "custom" {
+				o.RepoType = repoType
+			}
+		}
+		if o.UpdateSequenceId < 0 {
+			if n, err := strconv.Atoi(env.buildNumber); err == nil {
+				o.UpdateSequenceId = n
+			}
+		}
+		return o
+	}
+	return o
+}
+
+func readBambooEnvironment() ciEnvironment {
+	return ciEnvironment{
+		branch:      os.Getenv("bamboo_planRepository_branchName"),
+		repoUrl:     os.Getenv("bamboo_planRepository_repositoryUrl"),
+		buildNumber: os.Getenv("bamboo_buildNumber"),
+	}
+}
+
+// readTeamCityEnvironment reads the build's branch and VCS root url from the configuration parameters TeamCity writes to a
+// properties file, which is referenced by the build properties file
+func readTeamCityEnvironment() ciEnvironment {
+	env := ciEnvironment{buildNumber: os.Getenv("BUILD_NUMBER")}
+	buildProps := readProperties(os.Getenv("TEAMCITY_BUILD_PROPERTIES_FILE"))
+	configProps := readProperties(buildProps["teamcity.configuration.properties.file"])
+	if branch := configProps["teamcity.build.branch"]; branch != "<default>" {
+		env.branch = branch
+	}
+	env.repoUrl = configProps["vcsroot.url"]
+	return env
+}
+
+// readProperties reads a Java properties file of key=value pairs. Missing files are treated as empty.
+func readProperties(filename string) map[string]string {
+	props := map[string]string{}
+	if filename == "" {
+		return props
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return props
+	}
+	defer f.Close()
+	unescape := strings.NewReplacer(`\:`, ":", `\=`, "=", `\\`, `\`, `\ `, " ")
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == '!' {
+			continue
+		}
+		i := strings.Index(line, "=")
+		if i < 0 {
+			continue
+		}
+		props[unescape.Replace(strings.TrimSpace(line[:i]))] = unescape.Replace(strings.TrimSpace(line[i+1:]))
+	}
+	return props
+}
+
+// repoFromCloneUrl infers the name, type, and display url of a repository from its clone url. The display url is only
+// returned for http clone urls, with credentials removed.
+func repoFromCloneUrl(cloneUrl string) (name, repoType, repoUrl string) {
+	if cloneUrl == "" {
+		return "", "", ""
+	}
+	name = strings.TrimSuffix(path.Base(strings.TrimSuffix(cloneUrl, "/")), ".git")
+	u, err := url.Parse(cloneUrl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return name, "", ""
+	}
+	u.User = nil
+	switch {
+	case u.Hostname() == "github.com":
+		repoType = "github"
+	case u.Hostname() == "bitbucket.org":
+		repoType = "bitbucket"
+	case strings.Contains(u.Path, "/scm/"):
+		// Bitbucket Server clone urls are converted to the url of the repository by the scanner
+		return name, "bitbucketServer", u.String()
+	default:
+		repoType = "custom"
+	}
+	u.Path = strings.TrimSuffix(u.Path, ".git")
+	return name, repoType, u.String()
+}
@@ -0,0 +1,97 @@
+package options
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setenv sets environment variables, and returns a function which restores their previous values
+func setenv(t *testing.T, env map[string]string) func() {
+	var restore []func()
+	for k, v := range env {
+		k := k
+		if prev, ok := os.LookupEnv(k); ok {
+			restore = append(restore, func() { os.Setenv(k, prev) })
+		} else {
+			restore = append(restore, func() { os.Unsetenv(k) })
+		}
+		require.NoError(t, os.Setenv(k, v))
+	}
+	return func() {
+		for _, r := range restore {
+			r()
+		}
+	}
+}
+
+func TestMergeCIEnvironment_bamboo(t *testing.T) {
+	defer setenv(t, map[string]string{
+		"TEAMCITY_VERSION":                    "",
+		"bamboo_buildNumber":                  "42",
+		"bamboo_planRepository_branchName":    "feature",
+		"bamboo_planRepository_repositoryUrl": "https://bitbucket.example.com/scm/proj/my-repo.git",
+	})()
+
+	opts := Options{CI: CIAuto, RepoType: "custom", UpdateSequenceId: -1}.mergeCIEnvironment()
+	assert.Equal(t, "feature", opts.Branch)
+	assert.Equal(t, "my-repo", opts.RepoName)
+	assert.Equal(t, "bitbucketServer", opts.RepoType)
+	assert.Equal(t, "https://bitbucket.example.com/scm/proj/my-repo.git", opts.RepoUrl)
+	assert.Equal(t, 42, opts.UpdateSequenceId)
+
+	opts = Options{CI: CIBamboo, Branch: "main", RepoName: "app", RepoType: "custom", RepoUrl: "https://example.com/app", UpdateSequenceId: 7}.mergeCIEnvironment()
+	assert.Equal(t, Options{CI: CIBamboo, Branch: "main", RepoName: "app", RepoType: "custom", RepoUrl: "https://example.com/app", UpdateSequenceId: 7}, opts, "provided options are not replaced")
+}
+
+func TestMergeCIEnvironment_teamcity(t *testing.T) {
+	dir, err := ioutil.TempDir("", "teamcity")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	configFile := filepath.Join(dir, "config.properties")
+	buildFile := filepath.Join(dir, "build.properties")
+	require.NoError(t, ioutil.WriteFile(configFile, []byte("#TeamCity configuration parameters\nteamcity.build.branch=refs/heads/feature\nvcsroot.url=https\\://token@github.com/launchdarkly/my-repo.git\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(buildFile, []byte("teamcity.configuration.properties.file="+configFile+"\n"), 0600))
+	defer setenv(t, map[string]string{
+		"TEAMCITY_VERSION":               "2020.1",
+		"TEAMCITY_BUILD_PROPERTIES_FILE": buildFile,
+		"BUILD_NUMBER":                   "1.0.3",
+	})()
+
+	opts := Options{CI: CIAuto, RepoType: "custom", UpdateSequenceId: -1}.mergeCIEnvironment()
+	assert.Equal(t, "feature", opts.Branch)
+	assert.Equal(t, "my-repo", opts.RepoName)
+	assert.Equal(t, "github", opts.RepoType)
+	assert.Equal(t, "https://github.com/launchdarkly/my-repo", opts.RepoUrl)
+	assert.Equal(t, -1, opts.UpdateSequenceId, "non-numeric build numbers are ignored")
+}
+
+func TestMergeCIEnvironment_notDetected(t *testing.T) {
+	defer setenv(t, map[string]string{"TEAMCITY_VERSION": "", "bamboo_buildNumber": ""})()
+
+	opts := Options{CI: CIAuto, RepoType: "custom", UpdateSequenceId: -1}.mergeCIEnvironment()
+	assert.Equal(t, Options{CI: CIAuto, RepoType: "custom", UpdateSequenceId: -1}, opts)
+}
+
+func TestRepoFromCloneUrl(t *testing.T) {
+	specs := []struct {
+		cloneUrl                string
+		name, repoType, repoUrl string
+	}{
+		{"https://github.com/org/repo.git", "repo", "github", "https://github.com/org/repo"},
+		{"https://user@bitbucket.org/team/repo.git", "repo", "bitbucket", "https://bitbucket.org/team/repo"},
+		{"https://git.example.com/org/repo", "repo", "custom", "https://git.example.com/org/repo"},
+		{"git@github.com:org/repo.git", "repo", "", ""},
+		{"", "", "", ""},
+	}
+	for _, tt := range specs {
+		name, repoType, repoUrl := repoFromCloneUrl(tt.cloneUrl)
+		assert.Equal(t, tt.name, name, tt.cloneUrl)
+		assert.Equal(t, tt.repoType, repoType, tt.cloneUrl)
+		assert.Equal(t, tt.repoUrl, repoUrl, tt.cloneUrl)
+	}
+}
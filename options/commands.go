@@ -0,0 +1,36 @@
+package options
+
+import (
+	"strings"
+)
+
+// Options which run commands, other than command aliases
+const (
+	CommandOutputHook = "outputHook"
+	CommandPreScan    = "hooks.preScan"
+	CommandPostScan   = "hooks.postScan"
+	CommandPostUpload = "hooks.postUpload"
+)
+
+// RepoCommands returns the commands run by hooks and the output hook which are set by the YAML configuration of the
+// repository in o.Dir, including configuration it extends, by option name. Repository configuration may not be trusted
+// to run commands, so these commands are restricted like command aliases. Commands provided by flags or environment
+// variables which differ from the repository's configuration are not returned.
+func (o Options) RepoCommands() (map[string]string, error) {
+	ret := map[string]string{}
+	repo, ok, err := readRepoYAML(o.Dir, o.AllowedConfigSources)
+	if err != nil || !ok {
+		return ret, err
+	}
+	for _, c := range []struct{ name, value, repoValue string }{
+		{CommandOutputHook, o.OutputHook, repo.OutputHook},
+		{CommandPreScan, o.Hooks.PreScan, repo.Hooks.PreScan},
+		{CommandPostScan, o.Hooks.PostScan, repo.Hooks.PostScan},
+		{CommandPostUpload, o.Hooks.PostUpload, repo.Hooks.PostUpload},
+	} {
+		if strings.TrimSpace(c.value) != "" && c.value == c.repoValue {
+			ret[c.name] = c.value
+		}
+	}
+	return ret, nil
+}
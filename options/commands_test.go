@@ -0,0 +1,32 @@
+package options
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepoCommands(t *testing.T) {
+	dir, err := ioutil.TempDir("", "commands")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// repositories without configuration set no commands
+	commands, err := Options{Dir: dir, OutputHook: "jq ."}.RepoCommands()
+	require.NoError(t, err)
+	assert.Empty(t, commands)
+
+	require.NoError(t, os.Mkdir(filepath.Join(dir, ".launchdarkly"), 0700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, ".launchdarkly", "base.yaml"), []byte("hooks:\n  postUpload: ./audit.sh\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, ".launchdarkly", "coderefs.yaml"), []byte("extends: base.yaml\noutputHook: cat\nhooks:\n  preScan: make generate\n"), 0600))
+
+	opts := Options{Dir: dir, OutputHook: "jq .", Hooks: Hooks{PreScan: "make generate", PostUpload: "./audit.sh"}}
+	commands, err = opts.RepoCommands()
+	require.NoError(t, err)
+	// the output hook is provided by a flag, overriding the repository's configuration
+	assert.Equal(t, map[string]string{CommandPreScan: "make generate", CommandPostUpload: "./audit.sh"}, commands)
+}
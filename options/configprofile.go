@@ -0,0 +1,107 @@
+package options
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// ConfigProfile contains defaults for options which differ between LaunchDarkly accounts. Profiles are read from a
+// user-level configuration file, so that the same machine can scan repositories belonging to several accounts.
+type ConfigProfile struct {
+	AccessToken string `mapstructure:"accessToken"`
+	BaseUri     string `mapstructure:"baseUri"`
+	ProjKey     string `mapstructure:"projKey"`
+}
+
+// UserConfigPath returns the path of the user-level configuration file, $XDG_CONFIG_HOME/ld-find-code-refs/config.yaml,
+// where $XDG_CONFIG_HOME defaults to ~/.config
+func UserConfigPath() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "ld-find-code-refs", "config.yaml"), nil
+}
+
+// ReadConfigProfile reads the named profile from the `profiles` of a user-level configuration file. Profile names are
+// case-insensitive.
+func ReadConfigProfile(path, name string) (ConfigProfile, error) {
+	/* #nosec */
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return ConfigProfile{}, fmt.Errorf("unknown configuration profile %q: %s does not exist", name, path)
+	} else if err != nil {
+		return ConfigProfile{}, err
+	}
+	v := viper.New()
+	v.SetConfigType("yaml")
+	err = v.ReadConfig(bytes.NewReader(data))
+	if err != nil {
+		return ConfigProfile{}, fmt.Errorf("could not parse %s: %w", path, err)
+	}
+	var config struct {
+		Profiles map[string]ConfigProfile `mapstructure:"profiles"`
+	}
+	err = v.Unmarshal(&config)
+	if err != nil {
+		return ConfigProfile{}, fmt.Errorf("could not parse %s: %w", path, err)
+	}
+	// viper lowercases keys, including profile names
+	profile, ok := config.Profiles[strings.ToLower(name)]
+	if !ok {
+		return ConfigProfile{}, fmt.Errorf("unknown configuration profile %q in %s", name, path)
+	}
+	return profile, nil
+}
+
+// applyConfigProfile uses the values of the profile selected by the configProfile option as defaults, so they take
+// precedence over built-in defaults, but not over flags, environment variables, or YAML configuration. The profile is
+// returned, so its access token is not sent to a baseUri set by the repository.
+func applyConfigProfile(v *viper.Viper) (ConfigProfile, error) {
+	if inConfig(v, "configProfile") {
+		return ConfigProfile{}, errors.New(`"configProfile" may only be set with a command line flag or environment variable`)
+	}
+	name := v.GetString("configProfile")
+	if name == "" {
+		return ConfigProfile{}, nil
+	}
+	path, err := UserConfigPath()
+	if err != nil {
+		return ConfigProfile{}, fmt.Errorf("could not locate user configuration: %w", err)
+	}
+	profile, err := ReadConfigProfile(path, name)
+	if err != nil {
+		return ConfigProfile{}, err
+	}
+	defaults := map[string]string{
+		"accessToken": profile.AccessToken,
+		"baseUri":     profile.BaseUri,
+		"projKey":     profile.ProjKey,
+	}
+	for key, value := range defaults {
+		if value != "" {
+			v.SetDefault(key, value)
+		}
+	}
+	return profile, nil
+}
+
+// checkConfigProfileBaseUri returns an error if the access token of a profile would be sent to a baseUri set by the
+// repository's YAML configuration, which could otherwise send it to any host
+func checkConfigProfileBaseUri(v *viper.Viper, profile ConfigProfile) error {
+	if profile.AccessToken == "" || v.GetString("accessToken") != profile.AccessToken || !inConfig(v, "baseUri") {
+		return nil
+	}
+	return fmt.Errorf(`"baseUri" may not be set by YAML configuration when the access token is read from configuration profile %q`, v.GetString("configProfile"))
+}
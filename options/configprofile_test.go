@@ -0,0 +1,105 @@
+package options
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testUserConfig = `profiles:
+  Acme:
+    accessToken: api-acme
+    projKey: checkout
+  globex:
+    accessToken: api-globex
+    baseUri: https://app.eu.launchdarkly.com
+    projKey: default
+`
+
+func TestReadConfigProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yaml")
+
+	_, err = ReadConfigProfile(path, "acme")
+	assert.EqualError(t, err, `unknown configuration profile "acme": `+path+" does not exist")
+
+	require.NoError(t, ioutil.WriteFile(path, []byte(testUserConfig), 0600))
+	profile, err := ReadConfigProfile(path, "ACME")
+	require.NoError(t, err)
+	assert.Equal(t, ConfigProfile{AccessToken: "api-acme", ProjKey: "checkout"}, profile)
+
+	_, err = ReadConfigProfile(path, "initech")
+	assert.EqualError(t, err, `unknown configuration profile "initech" in `+path)
+}
+
+func TestApplyConfigProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "ld-find-code-refs"), 0750))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "ld-find-code-refs", "config.yaml"), []byte(testUserConfig), 0600))
+	defer os.Setenv("XDG_CONFIG_HOME", os.Getenv("XDG_CONFIG_HOME"))
+	require.NoError(t, os.Setenv("XDG_CONFIG_HOME", dir))
+
+	flagSet := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	v := viper.New()
+	for _, f := range flags {
+		if value, ok := f.defaultValue.(string); ok {
+			flagSet.String(f.name, value, f.usage)
+		}
+	}
+	require.NoError(t, v.BindPFlags(flagSet))
+	require.NoError(t, flagSet.Parse([]string{"--configProfile=globex", "--projKey=my-project"}))
+
+	_, err = applyConfigProfile(v)
+	require.NoError(t, err)
+	assert.Equal(t, "api-globex", v.GetString("accessToken"))
+	assert.Equal(t, "https://app.eu.launchdarkly.com", v.GetString("baseUri"), "profile values take precedence over built-in defaults")
+	assert.Equal(t, "my-project", v.GetString("projKey"), "flags take precedence over profile values")
+}
+
+func TestReadYAML_configProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "ld-find-code-refs"), 0750))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "ld-find-code-refs", "config.yaml"), []byte(testUserConfig), 0600))
+	defer os.Setenv("XDG_CONFIG_HOME", os.Getenv("XDG_CONFIG_HOME"))
+	require.NoError(t, os.Setenv("XDG_CONFIG_HOME", dir))
+	repo := filepath.Join(dir, "repo")
+	require.NoError(t, os.MkdirAll(filepath.Join(repo, ".launchdarkly"), 0750))
+	writeConfig := func(config string) {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(repo, ".launchdarkly", "coderefs.yaml"), []byte(config), 0600))
+	}
+	defer viper.Reset()
+
+	viper.Reset()
+	viper.Set("dir", repo)
+	writeConfig("configProfile: globex\n")
+	assert.EqualError(t, ReadYAML(), `"configProfile" may only be set with a command line flag or environment variable`)
+	writeConfig("allowedConfigSources: evil.example.com\n")
+	assert.EqualError(t, ReadYAML(), `"allowedConfigSources" may only be set with a command line flag or environment variable`)
+	assert.Empty(t, viper.GetString("accessToken"), "a profile selected by the repository is not applied")
+
+	viper.Reset()
+	viper.Set("dir", repo)
+	viper.Set("configProfile", "globex")
+	writeConfig("projKey: repo-project\n")
+	require.NoError(t, ReadYAML())
+	assert.Equal(t, "api-globex", viper.GetString("accessToken"))
+	assert.Equal(t, "repo-project", viper.GetString("projKey"))
+
+	writeConfig("baseUri: https://evil.example.com\n")
+	assert.EqualError(t, ReadYAML(), `"baseUri" may not be set by YAML configuration when the access token is read from configuration profile "globex"`)
+
+	viper.Set("accessToken", "api-flag")
+	assert.NoError(t, ReadYAML(), "a baseUri may be set for an access token provided by flags")
+}
@@ -0,0 +1,289 @@
+package options
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
+
+// extendsKey is the YAML configuration option listing the base configurations which a configuration extends
+const extendsKey = "extends"
+
+// maxExtendsDepth is the maximum length of a chain of configurations extending other configurations
+const maxExtendsDepth = 10
+
+// sourcePolicy restricts the sources which a repository's configuration may read base configurations and alias
+// definitions from, as the repository may not be trusted to read files from the machine running the scan, or to make
+// requests to its network
+type sourcePolicy struct {
+	// root is the directory of the repository. Sources read from files must be inside it.
+	root string
+	// allowed are the hosts, e.g. config.example.com, and URL prefixes, e.g. https://config.example.com/coderefs/, which
+	// sources may be fetched from
+	allowed []string
+}
+
+// newSourcePolicy returns the policy for the configuration of the repository in root. allowedSources is the
+// allowedConfigSources option, which is only read from flags and environment variables.
+func newSourcePolicy(root, allowedSources string) sourcePolicy {
+	p := sourcePolicy{root: root}
+	for _, source := range strings.Split(allowedSources, ",") {
+		source = strings.TrimSpace(source)
+		if source != "" {
+			p.allowed = append(p.allowed, source)
+		}
+	}
+	return p
+}
+
+// check returns an error if a resolved source may not be read
+func (p sourcePolicy) check(source string) error {
+	if isRemoteSource(source) {
+		u, err := url.Parse(source)
+		if err != nil {
+			return err
+		}
+		if p.allowsURL(u) {
+			return nil
+		}
+		return errors.New("remote configuration must be allowed by the allowedConfigSources option")
+	}
+	root, rootErr := filepath.EvalSymlinks(p.root)
+	path, pathErr := filepath.EvalSymlinks(source)
+	if rootErr != nil || pathErr != nil {
+		// missing files are reported when they are read
+		root, path = p.root, source
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return errors.New("configuration files must be inside the repository")
+	}
+	return nil
+}
+
+// allowsURL returns true if u is on an allowed host, or under an allowed URL prefix. URL prefixes must match the scheme
+// and host of u, and whole segments of its path once dot segments are removed, so https://config.example.com/coderefs
+// allows neither https://config.example.com.evil.io/ nor https://config.example.com/coderefs/../private/.
+func (p sourcePolicy) allowsURL(u *url.URL) bool {
+	for _, allowed := range p.allowed {
+		if !strings.Contains(allowed, "://") {
+			if strings.EqualFold(u.Hostname(), allowed) {
+				return true
+			}
+			continue
+		}
+		prefix, err := url.Parse(allowed)
+		if err != nil {
+			continue
+		}
+		if strings.EqualFold(u.Scheme, prefix.Scheme) && strings.EqualFold(u.Host, prefix.Host) && hasPathPrefix(u.Path, prefix.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasPathPrefix returns true if the URL path p is prefix, or is inside it, once dot segments are removed from both
+func hasPathPrefix(p, prefix string) bool {
+	p, prefix = path.Clean("/"+p), path.Clean("/"+prefix)
+	return prefix == "/" || p == prefix || strings.HasPrefix(p, prefix+"/")
+}
+
+// resolveExtends replaces the YAML configuration read by v with the base configurations listed by its `extends` option,
+// overridden by its own configuration. Base configurations may be http(s) URLs allowed by allowedSources, or file paths
+// inside the repository relative to the configuration which extends them, and may extend other configurations.
+func resolveExtends(v *viper.Viper, allowedSources string) error {
+	path := v.ConfigFileUsed()
+	config, err := readConfigSource(path)
+	if err != nil {
+		return err
+	}
+	if _, _, ok := lookupConfigKey(config, extendsKey); !ok {
+		return nil
+	}
+	merged, err := extendConfig(config, path, []string{path}, newSourcePolicy(filepath.Dir(filepath.Dir(path)), allowedSources))
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(merged)
+	if err != nil {
+		return err
+	}
+	return v.ReadConfig(bytes.NewReader(data))
+}
+
+// extendConfig returns config merged over the configurations it extends. Chain is the sources of the configurations
+// being extended, starting with the configuration which was read, and ending with source.
+func extendConfig(config map[interface{}]interface{}, source string, chain []string, policy sourcePolicy) (map[interface{}]interface{}, error) {
+	sources, err := extendsSources(config)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
+	if len(sources) == 0 {
+		return config, nil
+	}
+	if len(chain) > maxExtendsDepth {
+		return nil, fmt.Errorf("%s: configuration may not extend more than %d levels of base configuration", source, maxExtendsDepth)
+	}
+
+	base := map[interface{}]interface{}{}
+	for _, s := range sources {
+		resolved, err := resolveConfigSource(source, s)
+		if err != nil {
+			return nil, err
+		}
+		err = policy.check(resolved)
+		if err != nil {
+			return nil, fmt.Errorf("%s: cannot extend %s: %w", source, resolved, err)
+		}
+		for _, c := range chain {
+			if c == resolved {
+				return nil, fmt.Errorf("%s: configuration cannot extend itself: %s", source, strings.Join(append(chain, resolved), " -> "))
+			}
+		}
+		parent, err := readConfigSource(resolved)
+		if err != nil {
+			return nil, err
+		}
+		parent, err = extendConfig(parent, resolved, append(append([]string{}, chain...), resolved), policy)
+		if err != nil {
+			return nil, err
+		}
+		base = mergeConfig(base, parent, true)
+	}
+	return mergeConfig(base, config, true), nil
+}
+
+// extendsSources removes the `extends` option from config, and returns the base configurations it lists. The option may
+// be a single source, or a list of sources.
+func extendsSources(config map[interface{}]interface{}) ([]string, error) {
+	key, value, ok := lookupConfigKey(config, extendsKey)
+	if !ok {
+		return nil, nil
+	}
+	delete(config, key)
+	invalid := errors.New(`invalid value for "extends": must be a path or URL, or a list of paths and URLs`)
+	switch v := value.(type) {
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		sources := make([]string, 0, len(v))
+		for _, s := range v {
+			source, ok := s.(string)
+			if !ok || source == "" {
+				return nil, invalid
+			}
+			sources = append(sources, source)
+		}
+		return sources, nil
+	case nil:
+		return nil, nil
+	}
+	return nil, invalid
+}
+
+// resolveConfigSource resolves a base configuration listed by the configuration read from a source. Relative paths and
+// URLs are resolved against the source. Remote configuration may only extend other remote configuration.
+func resolveConfigSource(from, source string) (string, error) {
+	if isRemoteSource(from) {
+		base, err := url.Parse(from)
+		if err != nil {
+			return "", err
+		}
+		ref, err := url.Parse(source)
+		if err != nil || (ref.IsAbs() && !isRemoteSource(source)) {
+			return "", fmt.Errorf("%s: remote configuration may only extend other http(s) URLs: %s", from, source)
+		}
+		return base.ResolveReference(ref).String(), nil
+	}
+	if isRemoteSource(source) {
+		_, err := url.ParseRequestURI(source)
+		if err != nil {
+			return "", fmt.Errorf(`%s: invalid value %q for "extends": %w`, from, source, err)
+		}
+		return source, nil
+	}
+	if !filepath.IsAbs(source) {
+		source = filepath.Join(filepath.Dir(from), source)
+	}
+	return filepath.Clean(source), nil
+}
+
+// readConfigSource reads YAML configuration from an http(s) URL or a file path
+func readConfigSource(source string) (map[interface{}]interface{}, error) {
+	var data []byte
+	var err error
+	if isRemoteSource(source) {
+		data, err = fetchRemoteSource(http.Client{Timeout: remoteSourceTimeout}, source)
+	} else {
+		/* #nosec */
+		data, err = ioutil.ReadFile(source)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read configuration '%s': %w", source, err)
+	}
+	config := map[interface{}]interface{}{}
+	err = yaml.Unmarshal(data, &config)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse configuration '%s': %w", source, err)
+	}
+	return config, nil
+}
+
+// mergeConfig returns base overridden by override. Options are matched regardless of case, as they are by viper. Nested
+// options are merged, and lists are replaced, except for the top-level aliases list, which is appended to the aliases of
+// the base configuration, as aliases from aliasSources are.
+func mergeConfig(base, override map[interface{}]interface{}, topLevel bool) map[interface{}]interface{} {
+	ret := make(map[interface{}]interface{}, len(base)+len(override))
+	for k, v := range base {
+		ret[k] = v
+	}
+	for k, v := range override {
+		baseKey, baseValue, ok := lookupConfigKey(ret, k)
+		if ok {
+			delete(ret, baseKey)
+			switch value := v.(type) {
+			case map[interface{}]interface{}:
+				if baseMap, isMap := baseValue.(map[interface{}]interface{}); isMap {
+					v = mergeConfig(baseMap, value, false)
+				}
+			case []interface{}:
+				if baseList, isList := baseValue.([]interface{}); isList && topLevel && isConfigKey(k, "aliases") {
+					v = append(append([]interface{}{}, baseList...), value...)
+				}
+			}
+		}
+		ret[k] = v
+	}
+	return ret
+}
+
+func lookupConfigKey(config map[interface{}]interface{}, key interface{}) (interface{}, interface{}, bool) {
+	if v, ok := config[key]; ok {
+		return key, v, true
+	}
+	name, ok := key.(string)
+	if !ok {
+		return nil, nil, false
+	}
+	for k, v := range config {
+		if isConfigKey(k, name) {
+			return k, v, true
+		}
+	}
+	return nil, nil, false
+}
+
+func isConfigKey(key interface{}, name string) bool {
+	s, ok := key.(string)
+	return ok && strings.EqualFold(s, name)
+}
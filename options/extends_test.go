@@ -0,0 +1,160 @@
+package options
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readExtendedConfig(t *testing.T, path, allowedSources string) (Options, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	require.NoError(t, v.ReadInConfig())
+	err := resolveExtends(v, allowedSources)
+	if err != nil {
+		return Options{}, err
+	}
+	var opts Options
+	require.NoError(t, v.Unmarshal(&opts))
+	return opts, nil
+}
+
+func TestResolveExtends(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/configs/base.yaml":
+			_, _ = w.Write([]byte("extends: common.yaml\ncontextLines: 1\ndelimiters:\n  additional: [\"<\"]\n"))
+		case "/configs/common.yaml":
+			_, _ = w.Write([]byte("aliases:\n  - type: camelcase\ndelimiters:\n  disableDefaults: true\nrepoMetadata:\n  tags: [shared]\n"))
+		case "/configs/local.yaml":
+			_, _ = w.Write([]byte("extends: file:///etc/coderefs.yaml\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	allowed := server.URL + "/configs/"
+
+	dir, err := ioutil.TempDir("", "extends")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0750))
+		require.NoError(t, ioutil.WriteFile(path, []byte(data), 0600))
+		return path
+	}
+
+	write("shared/base.yaml", "aliases:\n  - type: snakecase\nhooks:\n  preScan: make aliases\n  postScan: ./report.sh\n")
+	path := write(".launchdarkly/coderefs.yaml", "extends:\n  - ../shared/base.yaml\n  - "+server.URL+"/configs/base.yaml\ncontextLines: 3\naliases:\n  - type: kebabcase\nhooks:\n  postScan: ./upload.sh\n")
+	opts, err := readExtendedConfig(t, path, allowed)
+	require.NoError(t, err)
+	assert.Equal(t, 3, opts.ContextLines, "local configuration overrides base configuration")
+	assert.Equal(t, []Alias{{Type: SnakeCase}, {Type: CamelCase}, {Type: KebabCase}}, opts.Aliases, "aliases are appended")
+	assert.Equal(t, Delimiters{DisableDefaults: true, Additional: []string{"<"}}, opts.Delimiters, "nested options are merged")
+	assert.Equal(t, Hooks{PreScan: "make aliases", PostScan: "./upload.sh"}, opts.Hooks)
+	assert.Equal(t, []string{"shared"}, opts.RepoMetadata.Tags)
+
+	path = write("cycle/coderefs.yaml", "extends: base.yaml\n")
+	write("cycle/base.yaml", "extends: ./coderefs.yaml\n")
+	_, err = readExtendedConfig(t, path, allowed)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "configuration cannot extend itself")
+
+	path = write("remote/coderefs.yaml", "extends: "+server.URL+"/configs/local.yaml\n")
+	_, err = readExtendedConfig(t, path, allowed)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "remote configuration may only extend other http(s) URLs")
+
+	path = write("invalid/coderefs.yaml", "extends:\n  key: value\n")
+	_, err = readExtendedConfig(t, path, allowed)
+	assert.EqualError(t, err, path+`: invalid value for "extends": must be a path or URL, or a list of paths and URLs`)
+
+	path = write("missing/coderefs.yaml", "extends: "+server.URL+"/configs/missing.yaml\n")
+	_, err = readExtendedConfig(t, path, allowed)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unexpected status code: 404")
+}
+
+func TestResolveExtends_restricted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("contextLines: 1\n"))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "extends")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0750))
+		require.NoError(t, ioutil.WriteFile(path, []byte(data), 0600))
+		return path
+	}
+	write("base.yaml", "contextLines: 1\n")
+	write("repo/shared/base.yaml", "contextLines: 1\n")
+	require.NoError(t, os.Symlink(filepath.Join(dir, "base.yaml"), filepath.Join(dir, "repo/link.yaml")))
+
+	tests := []struct {
+		name    string
+		extends string
+		allowed string
+		wantErr string
+	}{
+		{name: "file inside repository", extends: "../shared/base.yaml"},
+		{name: "file outside repository", extends: "../../base.yaml", wantErr: "configuration files must be inside the repository"},
+		{name: "absolute file outside repository", extends: filepath.Join(dir, "base.yaml"), wantErr: "configuration files must be inside the repository"},
+		{name: "symlink outside repository", extends: "../link.yaml", wantErr: "configuration files must be inside the repository"},
+		{name: "URL not allowed", extends: server.URL + "/base.yaml", wantErr: "must be allowed by the allowedConfigSources option"},
+		{name: "URL prefix allowed", extends: server.URL + "/configs/base.yaml", allowed: "https://example.com, " + server.URL + "/configs/"},
+		{name: "URL outside allowed prefix", extends: server.URL + "/base.yaml", allowed: server.URL + "/configs/", wantErr: "must be allowed by the allowedConfigSources option"},
+		{name: "host allowed", extends: server.URL + "/base.yaml", allowed: "127.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := write("repo/.launchdarkly/coderefs.yaml", "extends: "+tt.extends+"\n")
+			opts, err := readExtendedConfig(t, path, tt.allowed)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, 1, opts.ContextLines)
+		})
+	}
+}
+
+func TestSourcePolicy_allowsURL(t *testing.T) {
+	policy := newSourcePolicy("/repo", "https://config.example.com/coderefs/, shared.example.com")
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://config.example.com/coderefs/base.yaml", true},
+		{"https://CONFIG.example.com/coderefs/nested/base.yaml", true},
+		{"https://config.example.com/coderefs", true},
+		{"https://config.example.com.evil.io/coderefs/base.yaml", false},
+		{"https://config.example.com@evil.io/coderefs/base.yaml", false},
+		{"http://config.example.com/coderefs/base.yaml", false},
+		{"https://config.example.com:8443/coderefs/base.yaml", false},
+		{"https://config.example.com/coderefs-private/base.yaml", false},
+		{"https://config.example.com/coderefs/../private/base.yaml", false},
+		{"https://config.example.com/coderefs/%2e%2e/private/base.yaml", false},
+		{"http://shared.example.com/anything.yaml", true},
+		{"http://shared.example.com.evil.io/anything.yaml", false},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.url)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, policy.allowsURL(u), tt.url)
+	}
+}
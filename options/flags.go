@@ -15,19 +15,106 @@ var flags = []flag{
 		defaultValue: "",
 		usage:        "LaunchDarkly personal access token with write-level access.",
 	},
+	{
+		name:         "adaptiveThrottle",
+		defaultValue: false,
+		usage: `If enabled, reading files pauses while the one minute system load average exceeds the number
+of CPUs, so scans on a busy machine back off until other processes have finished. Only supported on Linux.`,
+	},
+	{
+		name:         "allProjects",
+		defaultValue: false,
+		usage: `If enabled, flags from every project which the access token can read are searched for, and
+projKey is ignored. Each code reference is attributed to the project of its flag, or to each project
+with a flag of the same key. Files written to outDir are named with "all-projects" in place of a project key.`,
+	},
+	{
+		name:         "allowedAliasCommands",
+		defaultValue: "",
+		usage: `Comma-separated list of executables which command aliases may run. If provided,
+command aliases running any other executable will fail the scan. Executables are matched exactly
+as written in the alias command, e.g. "jq" or "./scripts/aliases.sh". Hooks and the outputHook set
+in repository configuration are restricted to the same executables, and hooks may not use shell syntax
+such as ';' or '|' to run other commands.`,
+	},
+	{
+		name:         "allowedConfigSources",
+		defaultValue: "",
+		usage: `Comma-separated list of hosts, e.g. "config.example.com", or URL prefixes, e.g.
+"https://config.example.com/coderefs/", which repository configuration may extend or read aliasSources from.
+Repository configuration may only read files inside the repository, and URLs allowed by this option. This
+option cannot be set in repository configuration.`,
+	},
+	{
+		name:         "anonymizeKey",
+		defaultValue: "",
+		usage: `Secret key used to hash file paths when anonymizePaths is enabled, so paths cannot be recovered
+by hashing guessed paths. Required by anonymizePaths. Use the same key for every scan of a repository, so its
+paths are hashed consistently. Set with the LD_ANONYMIZE_KEY environment variable to keep it out of command lines.`,
+	},
+	{
+		name:         "anonymizePaths",
+		defaultValue: false,
+		usage: `If enabled, file paths are replaced with an HMAC of the path, keyed by anonymizeKey, before code
+references are sent to LaunchDarkly, keeping the file extension. The source code lines of each reference are
+not sent. Outputs written to outDir, other than branches for deferred upload, keep the original paths and lines.`,
+	},
+	{
+		name:         "archive",
+		defaultValue: "",
+		usage: `Path to a .tar, .tar.gz, .tgz, or .zip archive of a source snapshot to scan instead of dir, such as a
+release artifact. If every file is in a single top-level directory, paths are relative to that directory. Git is
+not used, so the "revision" and "branch" options are required. YAML configuration is not read from the archive.`,
+	},
 	{
 		name:         "baseUri",
 		short:        "U",
 		defaultValue: "https://app.launchdarkly.com",
 		usage:        "LaunchDarkly base URI.",
 	},
+	{
+		name:         "bitbucketCodeInsights",
+		defaultValue: false,
+		usage: `If enabled, a Bitbucket Code Insights report summarizing the scan is created for the scanned
+commit, with annotations on references to archived flags. Requires the BITBUCKET_ACCESS_TOKEN environment
+variable, or the BITBUCKET_USERNAME and BITBUCKET_APP_PASSWORD environment variables, to be set.`,
+	},
 	{
 		name:         "branch",
 		short:        "b",
 		defaultValue: "",
 		usage: `The currently checked out branch. If not provided, branch
 name will be auto-detected. Provide this option when using CI systems that
-leave the repository in a detached HEAD state.`,
+leave the repository in a detached HEAD state. Branch names may contain slashes, '#', and unicode
+characters, which are escaped in requests to LaunchDarkly.`,
+	},
+	{
+		name:         "branches",
+		defaultValue: "",
+		usage: `Comma-separated branches to scan instead of the branch checked out in dir. Each branch is fetched
+from origin and scanned in a temporary git worktree, which is removed after the scan, so the checkout
+in dir is never modified. Branches may contain "*" wildcards matched against the branches on origin,
+e.g. "main,release/*".`,
+	},
+	{
+		name:         "caseInsensitive",
+		defaultValue: false,
+		usage: `If enabled, flag keys and aliases will be matched regardless of case. References are attributed to
+the flag key as it is defined in LaunchDarkly. To only match the aliases generated by some alias configurations
+regardless of case, set caseInsensitive on those alias configurations instead.`,
+	},
+	{
+		name:         "checkUpdates",
+		defaultValue: false,
+		usage: `If enabled, a warning will be logged when a newer release of
+ld-find-code-refs is available, or when the running version has been yanked.`,
+	},
+	{
+		name:         "ci",
+		defaultValue: "",
+		usage: `If provided, the branch, repoName, repoType, repoUrl, and updateSequenceId options default to
+values read from the environment of a CI system. If "auto", the CI system is detected from environment variables.
+Acceptable values: auto|bamboo|teamcity.`,
 	},
 	{
 		name:         "commitUrlTemplate",
@@ -38,6 +125,36 @@ Example: https://github.com/launchdarkly/ld-find-code-refs/commit/${sha}.
 Allowed template variables: 'branchName', 'sha'. If commitUrlTemplate is
 not provided, but repoUrl is provided and repoType is not custom,
 LaunchDarkly will automatically generate links to the repository for each commit.`,
+	},
+	{
+		name:         "compareRuns",
+		defaultValue: false,
+		usage: `If enabled, the number of code references to each flag is saved to outDir, and compared with the
+numbers saved by the previous scan of the branch. Flags with new references, and flags with fewer references, are
+printed after the scan. Requires the outDir option.`,
+	},
+	{
+		name:         "configProfile",
+		defaultValue: "",
+		usage: `If provided, the accessToken, baseUri, and projKey options will default to the values of
+this profile in the user configuration file, ~/.config/ld-find-code-refs/config.yaml. May only be set with a
+command line flag or environment variable.`,
+	},
+	{
+		name:         "consoleFormat",
+		defaultValue: "auto",
+		usage: `The format of console output. If "plain", timestamped log lines are written. If "pretty",
+log lines are written without timestamps, and warnings, errors, and summaries are highlighted in color.
+If "auto", pretty output is used when standard output is a terminal outside of CI.
+Set the NO_COLOR environment variable to disable colors. Acceptable values: auto|plain|pretty.`,
+	},
+	{
+		name:         "contentCache",
+		defaultValue: "",
+		usage: `Path to a directory caching the code references found in each file, keyed by the contents of the
+file and the search configuration. Files with the same contents as a file searched by an earlier scan, such as
+the files which do not differ between branches, are not searched again. Share the directory between scans of
+every branch of a repository to reduce the cost of scanning many branches.`,
 	},
 	{
 		name:         "contextLines",
@@ -48,11 +165,17 @@ source code will be sent to LaunchDarkly. If 0, only the lines containing
 flag references will be sent. If > 0, will send that number of context
 lines above and below the flag reference. A maximum of 5 context lines
 may be provided.`,
+	},
+	{
+		name:         "csvDelimiter",
+		defaultValue: ",",
+		usage: `The character separating fields of the CSV file written to outDir. If "tab", a TSV file is
+written instead.`,
 	},
 	{
 		name:         "debug",
 		defaultValue: false,
-		usage:        "Enables verbose debug logging",
+		usage:        `Enables verbose debug logging. Equivalent to setting logLevel to "debug".`,
 	},
 	{
 		name:         "defaultBranch",
@@ -60,6 +183,13 @@ may be provided.`,
 		defaultValue: "master",
 		usage: `The default branch. The LaunchDarkly UI will default to this branch.
 If not provided, will fallback to 'master'.`,
+	},
+	{
+		name:         "deferUpload",
+		defaultValue: false,
+		usage: `If enabled, the branch and its code references will be written to outDir as JSON instead of
+being sent to LaunchDarkly, so branches scanned in separate jobs can be sent together with the upload
+command. Flag extinctions and stale branches are not processed. Requires the outDir option.`,
 	},
 	{
 		name:         "dir",
@@ -67,11 +197,59 @@ If not provided, will fallback to 'master'.`,
 		defaultValue: "",
 		usage:        "Path to existing checkout of the repository.",
 	},
+	{
+		name:         "disallowCommandAliases",
+		defaultValue: false,
+		usage: `If enabled, command aliases, and hooks and the outputHook set in repository configuration,
+will fail the scan instead of being run. Use this option when scanning repositories whose configuration
+is not trusted to run commands.`,
+	},
 	{
 		name:         "dryRun",
 		defaultValue: false,
 		usage: `If enabled, the scanner will run without sending code references to
 LaunchDarkly. Combine with the outDir option to output code references to a CSV.`,
+	},
+	{
+		name:         "flagCacheTtl",
+		defaultValue: 0,
+		usage: `The number of seconds to cache flags retrieved from LaunchDarkly for. If > 0, flags are
+cached on disk, and later runs for the same project will use the cached flags until they expire.
+If 0, flags are retrieved from LaunchDarkly on every run.`,
+	},
+	{
+		name:         "flagFilter",
+		defaultValue: "",
+		usage: `If provided, only flags matching this LaunchDarkly flag list filter will be searched for,
+e.g. "query:checkout" or "tags:backend". Code references to other flags will not be sent to LaunchDarkly.`,
+	},
+	{
+		name:         "flagMetadata",
+		defaultValue: false,
+		usage: `If enabled, the tags and maintainer of each flag are retrieved from LaunchDarkly and included
+in local outputs: the tags and maintainer columns of CSV files, and the flags of JSON outputs and
+the outputHook. They are not sent to LaunchDarkly with code references.`,
+	},
+	{
+		name:         "gitAttributes",
+		defaultValue: true,
+		usage: `If enabled, files marked with the linguist-generated or export-ignore attributes in
+.gitattributes files will not be searched for code references.`,
+	},
+	{
+		name:         "githubChecks",
+		defaultValue: false,
+		usage: `If enabled, a GitHub check run summarizing the scan is created for the scanned commit, with
+annotations on references to archived flags. Requires the GITHUB_TOKEN environment variable to be set to a
+GitHub app installation token with permission to write checks.`,
+	},
+	{
+		name:         "hunkMergeLines",
+		defaultValue: 0,
+		usage: `The maximum number of lines separating references to the same flag for them to be
+combined into a single code reference. Combining nearby references reduces the number of code
+references sent to LaunchDarkly for files with dense flag usage. If 0, references are only
+combined when their context lines overlap.`,
 	},
 	{
 		name:         "hunkUrlTemplate",
@@ -89,6 +267,43 @@ links to the repository for each code reference.`,
 		defaultValue: false,
 		usage: `If enabled, the scanner will terminate with exit code 0 when the
 LaunchDarkly API is unreachable or returns an unexpected response.`,
+	},
+	{
+		name:         "knownBranches",
+		defaultValue: "",
+		usage: `Path to a file listing the branches on the remote, one per line, such as the output of
+git ls-remote --heads. Branches listed by the remote are cached for later runs. If the remote
+cannot be reached, the branches in this file are used to prune code references for deleted
+branches, or the cached branches if not provided. Branches sent to LaunchDarkly after the file was
+last modified are not pruned.`,
+	},
+	{
+		name:         "lineLengthUnit",
+		defaultValue: "characters",
+		usage: `How the length of lines is measured when truncating lines longer than 500
+characters or bytes. If "characters", lines are measured in Unicode code points. If "bytes", lines
+are measured in UTF-8 encoded bytes, and truncated at the last complete character within the
+limit. Acceptable values: characters|bytes.`,
+	},
+	{
+		name:         "logLevel",
+		defaultValue: "",
+		usage: `The verbosity of logging: error, warn, info, debug, or trace. Followed by comma-separated
+overrides for specific modules, e.g. "warn,ld=trace,search=info" logs warnings and errors, every
+request to the LaunchDarkly API, and informational messages from the search for code references.
+Modules: archive, coderefs, discovery, git, ld, search, warnings. If no level is provided, info
+messages are logged, or debug messages if debug is enabled.`,
+	},
+	{
+		name:         "lock",
+		defaultValue: false,
+		usage: `If enabled, only one scan of a branch may run at a time. A lockfile is created in outDir while
+the branch is scanned, and other scans of the branch which use the same outDir exit without sending code references.
+If the "updateSequenceId" option is not set, it defaults to the time the scan started in milliseconds since the
+Unix epoch, so LaunchDarkly rejects code references from a scan which started before the last scan it accepted.
+LaunchDarkly then also rejects later scans of the branch with a smaller "updateSequenceId", such as a CI build
+number, so do not mix the two. Lockfiles which have not been refreshed for 10 minutes, as when a scan is killed,
+are replaced. Requires the outDir option.`,
 	},
 	{
 		name:         "lookback",
@@ -96,6 +311,76 @@ LaunchDarkly API is unreachable or returns an unexpected response.`,
 		defaultValue: 10,
 		usage: `Sets the number of Git commits to search in history for
 whether a feature flag was removed from code. May be set to 0 to disabled this feature. Setting this option to a high value will increase search time.`,
+	},
+	{
+		name:         "maxAliasCommandsPerSecond",
+		defaultValue: 0,
+		usage: `The maximum number of command alias executions per second. Command aliases are run
+once for each flag, so this option limits the load placed on the services they call. The limit applies to all scans
+run by the process, including concurrent scans of a workspace. If 0, executions are unlimited.`,
+	},
+	{
+		name:         "maxFileSizeKb",
+		defaultValue: 0,
+		usage: `The maximum size of files to search, in kilobytes. Larger files, such as
+generated code, lockfiles, or data dumps, will be skipped with a warning. If 0,
+files of any size will be searched.`,
+	},
+	{
+		name:         "maxFlags",
+		defaultValue: 0,
+		usage: `The maximum number of flags to search for. If the project has more flags, only the most
+recently created flags will be searched for, and archived flags are only included if there is room for them.
+If 0, all flags will be searched for.`,
+	},
+	{
+		name:         "maxProcs",
+		defaultValue: 0,
+		usage: `The maximum number of CPUs used to search for code references at once, which sets GOMAXPROCS.
+If 0, every CPU may be used.`,
+	},
+	{
+		name:         "maxReadKbPerSecond",
+		defaultValue: 0,
+		usage: `The maximum average rate, in kilobytes per second, at which files are read while searching for
+code references. If 0, reads are not throttled.`,
+	},
+	{
+		name:         "maxScanTime",
+		defaultValue: 0,
+		usage: `The maximum number of seconds to spend searching for code references. If the
+search exceeds this duration, it will be stopped and the code references found so far will be
+sent to LaunchDarkly, and flag extinctions will not be searched for. If 0, the search duration is unlimited.`,
+	},
+	{
+		name:         "minConfidence",
+		defaultValue: "substring",
+		usage: `The minimum confidence of code references sent to LaunchDarkly and written to outDir. From lowest
+to highest, "substring" is a flag key matched without quotes, "alias" is a match of a flag key alias, "quoted" is a
+flag key in a string literal, and "sdkCall" is a flag key in a string literal passed to an SDK evaluation method.
+Acceptable values: substring|alias|quoted|sdkCall.`,
+	},
+	{
+		name:         "normalizeRepoName",
+		defaultValue: true,
+		usage: `If enabled, repoName is converted to a name LaunchDarkly accepts: it is lowercased, characters other
+than letters, numbers, '.', '_' or '-' are replaced with '-', and it is trimmed to 100 characters. A warning
+is logged when repoName is changed. If disabled, invalid repo names are rejected.`,
+	},
+	{
+		name:         "offlineFlags",
+		defaultValue: "",
+		usage: `Path to a JSON file containing an array of flag keys to search for, or a list of flags returned
+by the LaunchDarkly API. If provided, flags will not be retrieved from LaunchDarkly, and dry runs will not
+send any requests to LaunchDarkly.`,
+	},
+	{
+		name:         "otlpEndpoint",
+		defaultValue: "",
+		usage: `The base url of an OpenTelemetry collector receiving OTLP over HTTP, e.g. http://localhost:4318.
+If provided, spans of the phases of the scan, the search of each top-level directory, and each request to
+LaunchDarkly will be exported to the collector after the scan. If not provided, the standard
+OTEL_EXPORTER_OTLP_TRACES_ENDPOINT and OTEL_EXPORTER_OTLP_ENDPOINT environment variables are used.`,
 	},
 	{
 		name:         "outDir",
@@ -103,6 +388,61 @@ whether a feature flag was removed from code. May be set to 0 to disabled this f
 		defaultValue: "",
 		usage: `If provided, will output a csv file containing all code references for
 the project to this directory.`,
+	},
+	{
+		name:         "outputHook",
+		defaultValue: "",
+		usage: `If provided, will run this command in the repository directory after the scan,
+sending the scan manifest and all code references found to its standard input as JSON.
+The scan will fail if the command exits with a non-zero status. Credentials, such as the LD_ACCESS_TOKEN,
+LD_ANONYMIZE_KEY, and GITHUB_TOKEN environment variables, are not passed to the command.`,
+	},
+	{
+		name:         "outputs",
+		defaultValue: "",
+		usage: `Comma-separated outputs to write the code references found to, each a format and
+a path separated by "=", e.g. "csv=refs.csv,json=refs.json,sarif=refs.sarif". Every output
+is written from the same scan, independently of outDir, including during a dry run.
+Acceptable formats: csv|json|sarif.`,
+	},
+	{
+		name:         "partialUploadOnSignal",
+		defaultValue: false,
+		usage: `If enabled, when the scan receives SIGTERM or SIGINT while searching, such as when a CI
+job is about to time out, the search will be stopped and the code references found so far will be sent to
+LaunchDarkly as partial results, and flag extinctions will not be searched for. Partial results are sent with a
+lower updateSequenceId, so a complete scan of the same revision takes precedence. A second signal terminates the
+scan immediately.`,
+	},
+	{
+		name:         "porcelain",
+		defaultValue: false,
+		usage: `If enabled, the results of the scan will be written to standard output as stable,
+tab-separated records for scripts to consume, and all other console output will be written to
+standard error.`,
+	},
+	{
+		name:         "previewLinks",
+		defaultValue: false,
+		usage: `If enabled, the commit url of the scan, and the hunk urls of code references in a sample of
+files, are printed after the scan, expanded as they will be shown in LaunchDarkly, so url templates
+can be checked before code references are sent. Branch names and file paths are escaped for use in url
+paths, so '#' and '?' in them do not start the fragment or query of a url. Combine with dryRun to check
+url templates without sending code references.`,
+	},
+	{
+		name:         "privacyPreset",
+		defaultValue: "",
+		usage: `If provided, limits the data sent to LaunchDarkly, taking precedence over the options it covers.
+"strict" sends no source code and anonymizes file paths, and requires anonymizeKey. "standard" only sends the lines containing flag
+references. "full" applies the other options unchanged. Options which exceed the preset are lowered, and
+each change is logged. Acceptable values: strict|standard|full.`,
+	},
+	{
+		name:         "profile",
+		defaultValue: "",
+		usage: `If provided, will write a profile of the scan to outDir, or the current
+directory if outDir is not set. Acceptable values: cpu|mem|trace.`,
 	},
 	{
 		name:         "projKey",
@@ -110,32 +450,164 @@ the project to this directory.`,
 		defaultValue: "",
 		usage:        `LaunchDarkly project key. Found under Account Settings -> Projects in the LaunchDarkly dashboard.`,
 	},
+	{
+		name:         "quiet",
+		short:        "q",
+		defaultValue: false,
+		usage:        `If enabled, only errors will be written to the console.`,
+	},
 	{
 		name:         "repoName",
 		short:        "r",
 		defaultValue: "",
 		usage: `Repository name. Will be displayed in LaunchDarkly. Case insensitive.
-Repo names must only contain letters, numbers, '.', '_' or '-'."`,
+Repo names must only contain letters, numbers, '.', '_' or '-'. If not provided, the name is derived
+from repoUrl, or from the url of the origin remote of the repository.`,
 	},
 	{
 		name:         "repoType",
 		short:        "T",
 		defaultValue: "custom",
 		usage: `The repo service provider. Used to correctly categorize repositories in the
-LaunchDarkly UI. Aceptable values: github|bitbucket|custom.`,
+LaunchDarkly UI. Use bitbucketServer for Bitbucket Server and Data Center repositories.
+Aceptable values: github|bitbucket|bitbucketServer|custom.`,
 	},
 	{
 		name:         "repoUrl",
 		short:        "u",
 		defaultValue: "",
-		usage: `The display url for the repository. If provided for a github or
-bitbucket repository, LaunchDarkly will attempt to automatically generate source code links.`,
+		usage: `The display url for the repository. If provided for a github,
+bitbucket, or bitbucketServer repository, LaunchDarkly will attempt to automatically generate source code links.`,
+	},
+	{
+		name:         "report",
+		defaultValue: "",
+		usage: `A comma-separated list of groupings to print a table of code reference counts for
+after the scan. References can be grouped by flag, top-level directory, language, and flag tag.
+If not provided, a table grouped by flag is printed when debug is enabled.
+Acceptable values: flag|directory|language|tag.`,
+	},
+	{
+		name:         "reportSort",
+		defaultValue: "references",
+		usage: `The order of the rows in report tables. Rows are sorted by number of references,
+number of references which only match aliases, or name. Acceptable values: references|aliasOnly|name.`,
+	},
+	{
+		name:         "requestHeaders",
+		defaultValue: "",
+		usage: `Comma-separated list of name=value headers added to every request to the LaunchDarkly API,
+e.g. "X-Request-Source=nightly-scan", so API traffic can be attributed to the pipeline which sent it.
+The Authorization, Content-Length, Content-Type, and User-Agent headers cannot be set.`,
 	},
 	{
 		name:         "revision",
 		short:        "R",
 		defaultValue: "",
-		usage:        `Use this option to scan non-git codebases. The current revision of the repository to be scanned. If set, the version string for the scanned repository will not be inferred, and branch garbage collection will be disabled. The "branch" option is required when "revision" is set.`,
+		usage:        `Use this option to scan non-git codebases, such as generated source trees or exported snapshots. The current revision of the repository to be scanned. If set, git is not used: the version string for the scanned repository will not be inferred, and flag extinctions and branch garbage collection will be disabled. The "branch" option is required when "revision" is set.`,
+	},
+	{
+		name:         "sample",
+		defaultValue: "",
+		usage: `A percentage of files to search, e.g. "5%", to estimate the number of code references to each
+flag in repositories too large to scan in full as often as needed. Files are selected by a hash of their path, so
+scans of the same percentage search the same files. Estimated totals are printed, and written to outDir if set,
+and code references are not sent to LaunchDarkly.`,
+	},
+	{
+		name:         "sdkCalls",
+		defaultValue: false,
+		usage: `If enabled, code references in calls to LaunchDarkly SDK evaluation methods with a literal
+flag key, such as boolVariation("my-flag", context, false), are detected and tagged with the method name in the
+CSV output written to outDir, distinguishing them from plain text matches.`,
+	},
+	{
+		name:         "sdks",
+		defaultValue: "launchdarkly",
+		usage: `A comma-separated list of the SDK APIs whose evaluation calls are recognized by sdkCalls, the
+sdkCall minConfidence, and the check command. Set to "launchdarkly,openfeature" to also recognize OpenFeature
+evaluation calls, such as getBooleanValue("my-flag", false). Acceptable values: launchdarkly|openfeature.`,
+	},
+	{
+		name:         "searchConcurrency",
+		defaultValue: 0,
+		usage: `The maximum number of files searched for code references at once. If 0, the number of files
+is not limited.`,
+	},
+	{
+		name:         "shortFlagKeys",
+		defaultValue: "omit",
+		usage: `How flags with keys shorter than 3 characters are searched for. Short keys match too much
+unrelated code to search for like other keys. If "omit", they are not searched for. If "sdkCalls", only references
+in SDK evaluation calls with the literal flag key, such as boolVariation("ab", context, false), are reported, and
+aliases are not generated for them. Acceptable values: omit|sdkCalls.`,
+	},
+	{
+		name:         "signingKey",
+		defaultValue: "",
+		usage: `Path to a PEM encoded PKCS #8 private key (Ed25519, ECDSA or RSA). If provided, the scan
+manifest written to outDir will be signed, and will include digests of all files written to outDir, so they can be
+verified with the verify command. Requires the outDir option.`,
+	},
+	{
+		name:         "skipDataLines",
+		defaultValue: false,
+		usage: `If enabled, flag keys and aliases found in lines which are clearly data rather than code are
+not code references: lines containing base64 blobs, such as lockfile integrity hashes, JSON documents
+on a single line over 1000 characters, and lines over 200 characters dense with short tokens, such as
+arrays of numbers or minified code.`,
+	},
+	{
+		name:         "sonarQubeIssues",
+		defaultValue: false,
+		usage: `If enabled, references to archived flags are written to outDir as SonarQube Generic Issue Import JSON,
+reporting each reference as a code smell. Import the file with the sonar.externalIssuesReportPaths analysis parameter.
+Requires the outDir option.`,
+	},
+	{
+		name:         "sourceMaps",
+		defaultValue: false,
+		usage: `If enabled, code references found in generated JavaScript files with a source map
+will be reported at their location in the original source file, if the original source file is within
+the repository. Code references found in source map files will be omitted.`,
+	},
+	{
+		name:         "sparsePaths",
+		defaultValue: "report",
+		usage: `How tracked files excluded by a sparse checkout are handled. If "report",
+excluded files are not searched and will be reported in the log. If "fetch", excluded files
+are read from the git object database, and fetched from the remote in a partial clone.
+Acceptable values: report|fetch.`,
+	},
+	{
+		name:         "strict",
+		defaultValue: "",
+		usage: `Comma-separated categories of warnings which cause the scan to fail before code references
+are sent to LaunchDarkly, exiting with the exit code of the first result code raised. Warnings are always
+logged, and included with their result codes in the scan manifest written to outDir.
+Acceptable values: truncation|limit|skipped-file|omitted-flag|prune|all.`,
+	},
+	{
+		name:         "suggestCodemods",
+		defaultValue: false,
+		usage: `If enabled, will output a patch file to outDir suggesting replacements of simple
+SDK variation calls for archived flags which serve the same value in every environment. Flags which are
+off without an off variation in any environment serve the fallback value passed to the SDK, and are skipped.
+Supported for Go, JavaScript, TypeScript and Python. Requires the outDir option.`,
+	},
+	{
+		name:         "symlinks",
+		defaultValue: "skip",
+		usage: `How symbolic links to files and directories are handled while searching for
+code references. If "skip", symbolic links are ignored. If "follow", the targets of symbolic links
+are searched as if they were located at the path of the link. If "error", the scan will fail
+when a symbolic link is found. Acceptable values: skip|follow|error.`,
+	},
+	{
+		name:         "top",
+		defaultValue: 50,
+		usage: `The maximum number of rows in each report table. References in the remaining rows
+are counted in a final row. If 0, all rows are printed.`,
 	},
 	{
 		name:         "updateSequenceId",
@@ -148,4 +620,32 @@ only be updated if the existing "updateSequenceId" is less than the new
 "updateSequenceId". Examples: the time a "git push" was initiated, CI
 build number, the current unix timestamp.`,
 	},
+	{
+		name:         "urlStyle",
+		defaultValue: "",
+		usage: `If provided, commitUrlTemplate and hunkUrlTemplate default to the url conventions of the
+repository's provider, generated from repoUrl. Use for providers LaunchDarkly does not generate
+links for. Templates which are provided are not replaced. Requires the repoUrl option.
+Acceptable values: gitlab|gitea|azure|bitbucket-server.`,
+	},
+	{
+		name:         "userAgentSuffix",
+		defaultValue: "",
+		usage: `If provided, will be appended to the User-Agent header of every request to the LaunchDarkly
+API, e.g. "nightly-scan", so API traffic can be attributed to the pipeline which sent it.`,
+	},
+	{
+		name:         "writeBaseline",
+		defaultValue: false,
+		usage: `If enabled, a suppression for each code reference found will be added to
+.launchdarkly/suppressions.yaml, so that only code references added later are reported. Code references
+will not be sent to LaunchDarkly.`,
+	},
+	{
+		name:         "xlsx",
+		defaultValue: false,
+		usage: `If enabled, will output an Excel workbook of code references to outDir, with a sheet of every
+reference, followed by a sheet of the references to flags with each flag tag. Each reference links to the
+repository's VCS provider when hunkUrlTemplate is set or can be generated. Requires the outDir option.`,
+	},
 }
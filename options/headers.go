@@ -0,0 +1,65 @@
+package options
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// reservedHeaders are set on every request to the LaunchDarkly API, and cannot be set by the requestHeaders option
+var reservedHeaders = map[string]bool{
+	"Authorization":  true,
+	"Content-Length": true,
+	"Content-Type":   true,
+	"User-Agent":     true,
+}
+
+// Headers returns the headers added to every request to the LaunchDarkly API by the requestHeaders option, a
+// comma-separated list of name=value pairs. Header names are returned in canonical form, e.g. X-Request-Source.
+func (o Options) Headers() (map[string]string, error) {
+	headers := map[string]string{}
+	if strings.TrimSpace(o.RequestHeaders) == "" {
+		return headers, nil
+	}
+	for _, pair := range strings.Split(o.RequestHeaders, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf(`invalid value %q for "requestHeaders": each header must be a name=value pair`, pair)
+		}
+		name, value := http.CanonicalHeaderKey(strings.TrimSpace(parts[0])), strings.TrimSpace(parts[1])
+		switch {
+		case !validHeaderName(name):
+			return nil, fmt.Errorf(`invalid value %q for "requestHeaders": %q is not a valid header name`, pair, name)
+		case reservedHeaders[name]:
+			return nil, fmt.Errorf(`invalid value %q for "requestHeaders": the %s header cannot be set`, pair, name)
+		case !validHeaderValue(value):
+			return nil, fmt.Errorf(`invalid value %q for "requestHeaders": header values must not contain control characters`, pair)
+		}
+		headers[name] = value
+	}
+	return headers, nil
+}
+
+// validHeaderName returns true if name is a valid HTTP header name, which may contain letters, digits, and the symbols
+// allowed in an HTTP token
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if r > 0x7E || (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') && !strings.ContainsRune("!#$%&'*+-.^_`|~", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// validHeaderValue returns true if value may be sent in a header, or appended to the User-Agent header
+func validHeaderValue(value string) bool {
+	for _, r := range value {
+		if r < 0x20 || r == 0x7F {
+			return false
+		}
+	}
+	return true
+}
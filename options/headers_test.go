@@ -0,0 +1,39 @@
+package options
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeaders(t *testing.T) {
+	specs := []struct {
+		name    string
+		headers string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "empty", headers: "", want: map[string]string{}},
+		{name: "single", headers: "X-Request-Source=nightly-scan", want: map[string]string{"X-Request-Source": "nightly-scan"}},
+		{name: "multiple", headers: "x-request-source = nightly-scan, X-Team=platform", want: map[string]string{"X-Request-Source": "nightly-scan", "X-Team": "platform"}},
+		{name: "value with equals", headers: "X-Query=a=b", want: map[string]string{"X-Query": "a=b"}},
+		{name: "empty value", headers: "X-Empty=", want: map[string]string{"X-Empty": ""}},
+		{name: "missing value", headers: "X-Request-Source", wantErr: true},
+		{name: "missing name", headers: "=nightly-scan", wantErr: true},
+		{name: "invalid name", headers: "X Request=nightly-scan", wantErr: true},
+		{name: "control character in value", headers: "X-Request-Source=nightly\r\nX-Injected: true", wantErr: true},
+		{name: "reserved header", headers: "authorization=api-x", wantErr: true},
+	}
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Options{RequestHeaders: tt.headers}.Headers()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
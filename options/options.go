@@ -5,48 +5,186 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/iancoleman/strcase"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 
+	"github.com/launchdarkly/ld-find-code-refs/internal/archive"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	"github.com/launchdarkly/ld-find-code-refs/internal/profile"
 	"github.com/launchdarkly/ld-find-code-refs/internal/validation"
+	"github.com/launchdarkly/ld-find-code-refs/internal/warnings"
 )
 
 type Options struct {
-	AccessToken         string `mapstructure:"accessToken"`
-	BaseUri             string `mapstructure:"baseUri"`
-	Branch              string `mapstructure:"branch"`
-	CommitUrlTemplate   string `mapstructure:"commitUrlTemplate"`
-	DefaultBranch       string `mapstructure:"defaultBranch"`
-	Dir                 string `mapstructure:"dir" yaml:"-"`
-	HunkUrlTemplate     string `mapstructure:"hunkUrlTemplate"`
-	OutDir              string `mapstructure:"outDir"`
-	ProjKey             string `mapstructure:"projkey"`
-	RepoName            string `mapstructure:"repoName"`
-	RepoType            string `mapstructure:"repoType"`
-	RepoUrl             string `mapstructure:"repoUrl"`
-	Revision            string `mapstructure:"revision"`
-	ContextLines        int    `mapstructure:"contextLines"`
-	Lookback            int    `mapstructure:"lookback"`
-	UpdateSequenceId    int    `mapstructure:"updateSequenceId"`
-	Debug               bool   `mapstructure:"debug"`
-	DryRun              bool   `mapstructure:"dryRun"`
-	IgnoreServiceErrors bool   `mapstructure:"ignoreServiceErrors"`
+	AccessToken               string `mapstructure:"accessToken"`
+	AllowedAliasCommands      string `mapstructure:"allowedAliasCommands"`
+	AllowedConfigSources      string `mapstructure:"allowedConfigSources"`
+	AnonymizeKey              string `mapstructure:"anonymizeKey"`
+	Archive                   string `mapstructure:"archive"`
+	BaseUri                   string `mapstructure:"baseUri"`
+	Branch                    string `mapstructure:"branch"`
+	Branches                  string `mapstructure:"branches"`
+	CI                        string `mapstructure:"ci"`
+	CSVDelimiter              string `mapstructure:"csvDelimiter"`
+	CommitUrlTemplate         string `mapstructure:"commitUrlTemplate"`
+	ConfigProfile             string `mapstructure:"configProfile"`
+	ConsoleFormat             string `mapstructure:"consoleFormat"`
+	ContentCache              string `mapstructure:"contentCache"`
+	DefaultBranch             string `mapstructure:"defaultBranch"`
+	Dir                       string `mapstructure:"dir" yaml:"-"`
+	FlagFilter                string `mapstructure:"flagFilter"`
+	HunkUrlTemplate           string `mapstructure:"hunkUrlTemplate"`
+	KnownBranches             string `mapstructure:"knownBranches"`
+	LineLengthUnit            string `mapstructure:"lineLengthUnit"`
+	LogLevel                  string `mapstructure:"logLevel"`
+	MinConfidence             string `mapstructure:"minConfidence"`
+	OutDir                    string `mapstructure:"outDir"`
+	OfflineFlags              string `mapstructure:"offlineFlags"`
+	OtlpEndpoint              string `mapstructure:"otlpEndpoint"`
+	OutputHook                string `mapstructure:"outputHook"`
+	Outputs                   string `mapstructure:"outputs"`
+	PrivacyPreset             string `mapstructure:"privacyPreset"`
+	Profile                   string `mapstructure:"profile"`
+	ProjKey                   string `mapstructure:"projkey"`
+	RepoName                  string `mapstructure:"repoName"`
+	RepoType                  string `mapstructure:"repoType"`
+	RepoUrl                   string `mapstructure:"repoUrl"`
+	Report                    string `mapstructure:"report"`
+	ReportSort                string `mapstructure:"reportSort"`
+	RequestHeaders            string `mapstructure:"requestHeaders"`
+	Revision                  string `mapstructure:"revision"`
+	Sample                    string `mapstructure:"sample"`
+	SDKs                      string `mapstructure:"sdks"`
+	ShortFlagKeys             string `mapstructure:"shortFlagKeys"`
+	SigningKey                string `mapstructure:"signingKey"`
+	SparsePaths               string `mapstructure:"sparsePaths"`
+	Strict                    string `mapstructure:"strict"`
+	Symlinks                  string `mapstructure:"symlinks"`
+	UrlStyle                  string `mapstructure:"urlStyle"`
+	UserAgentSuffix           string `mapstructure:"userAgentSuffix"`
+	ContextLines              int    `mapstructure:"contextLines"`
+	FlagCacheTtl              int    `mapstructure:"flagCacheTtl"`
+	HunkMergeLines            int    `mapstructure:"hunkMergeLines"`
+	Lookback                  int    `mapstructure:"lookback"`
+	MaxAliasCommandsPerSecond int    `mapstructure:"maxAliasCommandsPerSecond"`
+	MaxFileSizeKb             int    `mapstructure:"maxFileSizeKb"`
+	MaxFlags                  int    `mapstructure:"maxFlags"`
+	MaxProcs                  int    `mapstructure:"maxProcs"`
+	MaxReadKbPerSecond        int    `mapstructure:"maxReadKbPerSecond"`
+	MaxScanTime               int    `mapstructure:"maxScanTime"`
+	SearchConcurrency         int    `mapstructure:"searchConcurrency"`
+	Top                       int    `mapstructure:"top"`
+	UpdateSequenceId          int    `mapstructure:"updateSequenceId"`
+	AdaptiveThrottle          bool   `mapstructure:"adaptiveThrottle"`
+	AllProjects               bool   `mapstructure:"allProjects"`
+	AnonymizePaths            bool   `mapstructure:"anonymizePaths"`
+	BitbucketCodeInsights     bool   `mapstructure:"bitbucketCodeInsights"`
+	CaseInsensitive           bool   `mapstructure:"caseInsensitive"`
+	CheckUpdates              bool   `mapstructure:"checkUpdates"`
+	CompareRuns               bool   `mapstructure:"compareRuns"`
+	Debug                     bool   `mapstructure:"debug"`
+	DeferUpload               bool   `mapstructure:"deferUpload"`
+	DisallowCommandAliases    bool   `mapstructure:"disallowCommandAliases"`
+	DryRun                    bool   `mapstructure:"dryRun"`
+	FlagMetadata              bool   `mapstructure:"flagMetadata"`
+	GitAttributes             bool   `mapstructure:"gitAttributes"`
+	GithubChecks              bool   `mapstructure:"githubChecks"`
+	IgnoreServiceErrors       bool   `mapstructure:"ignoreServiceErrors"`
+	Lock                      bool   `mapstructure:"lock"`
+	NormalizeRepoName         bool   `mapstructure:"normalizeRepoName"`
+	PartialUploadOnSignal     bool   `mapstructure:"partialUploadOnSignal"`
+	Porcelain                 bool   `mapstructure:"porcelain"`
+	PreviewLinks              bool   `mapstructure:"previewLinks"`
+	Quiet                     bool   `mapstructure:"quiet"`
+	SDKCalls                  bool   `mapstructure:"sdkCalls"`
+	SkipDataLines             bool   `mapstructure:"skipDataLines"`
+	SonarQubeIssues           bool   `mapstructure:"sonarQubeIssues"`
+	SourceMaps                bool   `mapstructure:"sourceMaps"`
+	SuggestCodemods           bool   `mapstructure:"suggestCodemods"`
+	WriteBaseline             bool   `mapstructure:"writeBaseline"`
+	Xlsx                      bool   `mapstructure:"xlsx"`
 
 	// The following options can only be configured via YAML configuration
 
-	Aliases    []Alias    `mapstructure:"aliases"`
-	Delimiters Delimiters `mapstructure:"delimiters"`
+	Aliases              []Alias               `mapstructure:"aliases"`
+	AliasCollisions      AliasCollisionPolicy  `mapstructure:"aliasCollisions"`
+	AliasSources         []string              `mapstructure:"aliasSources"`
+	BranchAliases        []BranchAlias         `mapstructure:"branchAliases"`
+	ContextLineOverrides []ContextLineOverride `mapstructure:"contextLineOverrides"`
+	Delimiters           Delimiters            `mapstructure:"delimiters"`
+	Hooks                Hooks                 `mapstructure:"hooks"`
+	Jira                 Jira                  `mapstructure:"jira"`
+	RepoMetadata         RepoMetadata          `mapstructure:"repoMetadata"`
+}
+
+// RepoMetadata is synced to the code references repository in LaunchDarkly each time a scan runs. Metadata which is not
+// set is left unchanged.
+type RepoMetadata struct {
+	Description string   `mapstructure:"description"`
+	Tags        []string `mapstructure:"tags"`
+	// Enabled enables or disables the repository. Code references are not sent to LaunchDarkly for disabled repositories.
+	Enabled *bool `mapstructure:"enabled"`
+}
+
+// Hooks are shell commands run in the repository directory at points in the lifecycle of a scan. A hook which exits with a
+// non-zero status fails the scan.
+type Hooks struct {
+	// PreScan runs before flags are retrieved and aliases are generated
+	PreScan string `mapstructure:"preScan"`
+	// PostScan runs after code references are found and written to any outputs, including during a dry run
+	PostScan string `mapstructure:"postScan"`
+	// PostUpload runs after code references are sent to LaunchDarkly
+	PostUpload string `mapstructure:"postUpload"`
+}
+
+// Jira configures Jira issues for stale flags which are still referenced in code. An issue is created for each stale
+// flag referenced in the repository, and updated by later scans.
+type Jira struct {
+	// Url is the url of the Jira site, e.g. https://example.atlassian.net
+	Url string `mapstructure:"url"`
+	// Project is the key of the Jira project issues are created in. Issues are only created if a project is set.
+	Project string `mapstructure:"project"`
+	// IssueType is the name of the type of issues created, "Task" by default
+	IssueType string   `mapstructure:"issueType"`
+	Labels    []string `mapstructure:"labels"`
+	// StaleFlags are the policies which make a flag stale: "archived", for archived flags, and "rolledOut", for flags
+	// which serve the same variation to all users in every environment. All policies apply by default.
+	StaleFlags []string `mapstructure:"staleFlags"`
+}
+
+const (
+	StaleArchived  = "archived"
+	StaleRolledOut = "rolledOut"
+)
+
+// ContextLineOverride replaces the contextLines option for references to specific flags, or in files matching specific path globs.
+// If both flags and paths are provided, a reference must match both. The first matching override is used.
+type ContextLineOverride struct {
+	Flags        []string `mapstructure:"flags"`
+	Paths        []string `mapstructure:"paths"`
+	ContextLines int      `mapstructure:"contextLines"`
 }
 
 type Delimiters struct {
 	// If set to `true`, the default delimiters (single-quote, double-qoute, and backtick) will not be used unless provided as `additional` delimiters
-	DisableDefaults bool     `mapstructure:"disableDefaults"`
-	Additional      []string `mapstructure:"additional"`
+	DisableDefaults bool            `mapstructure:"disableDefaults"`
+	Additional      []string        `mapstructure:"additional"`
+	Pairs           []DelimiterPair `mapstructure:"pairs"`
+}
+
+// DelimiterPair is an asymmetric delimiter, e.g. `Flag(` and `)`. Either side may be left empty to match by prefix or suffix only.
+type DelimiterPair struct {
+	Open  string `mapstructure:"open"`
+	Close string `mapstructure:"close"`
 }
 
 func Init(flagSet *pflag.FlagSet) error {
@@ -70,22 +208,64 @@ func Init(flagSet *pflag.FlagSet) error {
 }
 
 func InitYAML() error {
-	err := validateYAMLPreconditions()
+	_, err := applyConfigProfile(viper.GetViper())
 	if err != nil {
 		return err
 	}
+	err = validateYAMLPreconditions()
+	if err != nil {
+		return err
+	}
+	return ReadYAML()
+}
+
+// ReadYAML reads YAML configuration from the configured directory, if present, without checking for other required options
+func ReadYAML() error {
+	if viper.GetString("dir") == "" && viper.GetString("archive") != "" {
+		// configuration is not read from archives, which are only extracted when scanning
+		return nil
+	}
 	absPath, err := validation.NormalizeAndValidatePath(viper.GetString("dir"))
 	if err != nil {
 		return err
 	}
-	viper.SetConfigName("coderefs")
+	// forget configuration read previously, so options which the repository may not set are only read from flags and
+	// environment variables
 	viper.SetConfigType("yaml")
+	err = viper.ReadConfig(strings.NewReader(""))
+	if err != nil {
+		return err
+	}
+	// read before the configuration, so the repository cannot allow its own base configurations, or select a profile
+	allowedSources := viper.GetString("allowedConfigSources")
+	profile, err := applyConfigProfile(viper.GetViper())
+	if err != nil {
+		return err
+	}
+	viper.SetConfigName("coderefs")
 	viper.AddConfigPath(filepath.Join(absPath, ".launchdarkly"))
 	err = viper.ReadInConfig()
-	if err != nil && !errors.As(err, &viper.ConfigFileNotFoundError{}) {
+	if errors.As(err, &viper.ConfigFileNotFoundError{}) {
+		return nil
+	} else if err != nil {
 		return err
 	}
-	return nil
+	err = resolveExtends(viper.GetViper(), allowedSources)
+	if err != nil {
+		return err
+	}
+	for _, key := range []string{"allowedConfigSources", "configProfile"} {
+		if inConfig(viper.GetViper(), key) {
+			return fmt.Errorf("%q may only be set with a command line flag or environment variable", key)
+		}
+	}
+	return checkConfigProfileBaseUri(viper.GetViper(), profile)
+}
+
+// inConfig returns true if an option is set by YAML configuration
+func inConfig(v *viper.Viper, key string) bool {
+	// viper lowercases the keys read from configuration files
+	return v.InConfig(strings.ToLower(key))
 }
 
 // validatePreconditions ensures required flags have been set
@@ -96,7 +276,7 @@ func validateYAMLPreconditions() error {
 	if token == "" {
 		missingRequiredOptions = append(missingRequiredOptions, "accessToken")
 	}
-	if dir == "" {
+	if dir == "" && viper.GetString("archive") == "" {
 		missingRequiredOptions = append(missingRequiredOptions, "dir")
 	}
 	if len(missingRequiredOptions) > 0 {
@@ -105,10 +285,27 @@ func validateYAMLPreconditions() error {
 	return nil
 }
 
+// GetOptions returns the configured options. If the repoName option was not provided, it is derived from the repoUrl
+// option or the origin remote of the repository.
 func GetOptions() (Options, error) {
+	opts, err := getOptions()
+	if err != nil {
+		return opts, err
+	}
+	return opts.withDefaultRepoName(), nil
+}
+
+func getOptions() (Options, error) {
 	var opts Options
-	err := viper.Unmarshal(&opts)
-	return opts, err
+	_, err := applyConfigProfile(viper.GetViper())
+	if err != nil {
+		return opts, err
+	}
+	err = viper.Unmarshal(&opts)
+	if err != nil {
+		return opts, err
+	}
+	return opts.mergeCIEnvironment(), nil
 }
 
 func GetWrapperOptions(dir string, merge func(Options) (Options, error)) (Options, error) {
@@ -134,7 +331,8 @@ func GetWrapperOptions(dir string, merge func(Options) (Options, error)) (Option
 		return Options{}, err
 	}
 
-	opts, err := GetOptions()
+	// the repository name is provided by the environment of each wrapper
+	opts, err := getOptions()
 	if err != nil {
 		return opts, err
 	}
@@ -147,10 +345,10 @@ func (o Options) ValidateRequired() error {
 	if o.AccessToken == "" {
 		missingRequiredOptions = append(missingRequiredOptions, "accessToken")
 	}
-	if o.Dir == "" {
+	if o.Dir == "" && o.Archive == "" {
 		missingRequiredOptions = append(missingRequiredOptions, "dir")
 	}
-	if o.ProjKey == "" {
+	if o.ProjKey == "" && !o.AllProjects {
 		missingRequiredOptions = append(missingRequiredOptions, "projKey")
 	}
 	if o.RepoName == "" {
@@ -162,60 +360,525 @@ func (o Options) ValidateRequired() error {
 	return nil
 }
 
-// Validate ensures all options have been set to a valid value
+// LogLevels returns the level of logging of each module. Unless logLevel sets a default level, info messages are logged,
+// or debug messages if debug is enabled. If logLevel is invalid, the default levels are returned with an error.
+func (o Options) LogLevels() (log.Levels, error) {
+	return log.ParseLevels(o.LogLevel, log.DefaultLevels(o.Debug).Default)
+}
+
+// Validate ensures all options have been set to a valid value. All violations are
+// reported together, rather than stopping at the first invalid option.
 func (o Options) Validate() error {
+	errs := validationErrors{}
+
 	err := o.ValidateRequired()
 	if err != nil {
-		return err
+		errs = append(errs, err)
+	}
+
+	if o.AccessToken != "" {
+		err = validateAccessToken(o.AccessToken)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if o.RepoName != "" && o.NormalizeRepoName {
+		if NormalizeRepoName(o.RepoName) == "" {
+			errs = append(errs, fmt.Errorf(`invalid value %q for "repoName": must contain a letter or number`, o.RepoName))
+		}
+	} else if o.RepoName != "" && !validRepoName.MatchString(o.RepoName) {
+		errs = append(errs, fmt.Errorf(`invalid value %q for "repoName": must only contain letters, numbers, '.', '_' or '-'`, o.RepoName))
+	}
+
+	if o.Branch != "" {
+		err = validateBranch(o.Branch)
+		if err != nil {
+			errs = append(errs, err)
+		}
 	}
 
-	maxContextLines := 5
 	if o.ContextLines > maxContextLines {
-		return fmt.Errorf(`invalid value %q for "contextLines": must be <= %d`, o.ContextLines, maxContextLines)
+		errs = append(errs, fmt.Errorf(`invalid value %d for "contextLines": must be <= %d`, o.ContextLines, maxContextLines))
+	}
+
+	_, err = o.LogLevels()
+	if err != nil {
+		errs = append(errs, fmt.Errorf(`invalid value %q for "logLevel": %w`, o.LogLevel, err))
 	}
 
 	repoType := strings.ToLower(o.RepoType)
-	if repoType != "custom" && repoType != "github" && repoType != "bitbucket" {
-		return fmt.Errorf(`invalid value %q for "repoType": must be "custom", "bitbucket", or "github"`, o.RepoType)
+	if repoType != "custom" && repoType != "github" && repoType != "bitbucket" && repoType != "bitbucketserver" {
+		errs = append(errs, fmt.Errorf(`invalid value %q for "repoType": must be "custom", "bitbucket", "bitbucketServer", or "github"`, o.RepoType))
+	}
+
+	switch strings.ToLower(o.UrlStyle) {
+	case "", "gitlab", "gitea", "azure", "bitbucket-server":
+	default:
+		errs = append(errs, fmt.Errorf(`invalid value %q for "urlStyle": must be "gitlab", "gitea", "azure", or "bitbucket-server"`, o.UrlStyle))
+	}
+	if o.UrlStyle != "" && o.RepoUrl == "" {
+		errs = append(errs, fmt.Errorf(`"repoUrl" option is required when "urlStyle" option is set`))
 	}
 
 	if o.RepoUrl != "" {
 		_, err := url.ParseRequestURI(o.RepoUrl)
 		if err != nil {
-			return fmt.Errorf(`invalid value %q for "repoUrl": %+v`, o.RepoUrl, err)
+			errs = append(errs, fmt.Errorf(`invalid value %q for "repoUrl": %+v`, o.RepoUrl, err))
 		}
 	}
 
-	// match all non-control ASCII characters
-	validDelims := regexp.MustCompile("^[\x20-\x7E]$")
-	for i, d := range o.Delimiters.Additional {
-		if !validDelims.MatchString(d) {
-			return fmt.Errorf(`invalid value %q for "delimiters.additional[%d]": each delimiter must be a valid non-control ASCII character`, d, i)
-		}
+	err = validateUrlTemplate("commitUrlTemplate", o.CommitUrlTemplate, commitUrlTemplateVars)
+	if err != nil {
+		errs = append(errs, err)
 	}
-
-	_, err = validation.NormalizeAndValidatePath(o.Dir)
+	err = validateUrlTemplate("hunkUrlTemplate", o.HunkUrlTemplate, hunkUrlTemplateVars)
 	if err != nil {
-		return fmt.Errorf(`invalid value for "dir": %+v`, err)
+		errs = append(errs, err)
+	}
+
+	if o.Dir != "" {
+		_, err = validation.NormalizeAndValidatePath(o.Dir)
+		if err != nil {
+			errs = append(errs, fmt.Errorf(`invalid value for "dir": %+v`, err))
+		}
 	}
 
 	if o.OutDir != "" {
 		_, err = validation.NormalizeAndValidatePath(o.OutDir)
 		if err != nil {
-			return fmt.Errorf(`invalid valid for "outDir": %+v`, err)
+			errs = append(errs, fmt.Errorf(`invalid value for "outDir": %+v`, err))
 		}
 	}
 
-	for _, a := range o.Aliases {
-		err := a.IsValid()
+	if o.Profile != "" {
+		err = profile.IsValid(o.Profile)
 		if err != nil {
-			return err
+			errs = append(errs, fmt.Errorf(`invalid value for "profile": %w`, err))
+		}
+	}
+
+	switch o.CI {
+	case "", CIAuto, CIBamboo, CITeamCity:
+	default:
+		errs = append(errs, fmt.Errorf(`invalid value %q for "ci": must be "auto", "bamboo", or "teamcity"`, o.CI))
+	}
+
+	for _, sdk := range strings.Split(o.SDKs, ",") {
+		switch strings.TrimSpace(sdk) {
+		case "launchdarkly", "openfeature":
+		default:
+			errs = append(errs, fmt.Errorf(`invalid value %q for "sdks": must be a comma-separated list of "launchdarkly" or "openfeature"`, o.SDKs))
+		}
+	}
+
+	switch o.ShortFlagKeys {
+	case "omit", "sdkCalls":
+	default:
+		errs = append(errs, fmt.Errorf(`invalid value %q for "shortFlagKeys": must be "omit" or "sdkCalls"`, o.ShortFlagKeys))
+	}
+
+	if o.OtlpEndpoint != "" {
+		if u, err := url.Parse(o.OtlpEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf(`invalid value %q for "otlpEndpoint": must be an http or https url`, o.OtlpEndpoint))
+		}
+	}
+
+	if _, err := o.Headers(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := o.OutputFiles(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := o.SampleFraction(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if !validHeaderValue(o.UserAgentSuffix) {
+		errs = append(errs, fmt.Errorf(`invalid value %q for "userAgentSuffix": must not contain control characters`, o.UserAgentSuffix))
+	}
+
+	comma := o.CSVComma()
+	if comma == '"' || comma == '\r' || comma == '\n' || comma == utf8.RuneError || (comma != '\t' && utf8.RuneCountInString(o.CSVDelimiter) > 1) {
+		errs = append(errs, fmt.Errorf(`invalid value %q for "csvDelimiter": must be "tab" or a single character other than a quote or line break`, o.CSVDelimiter))
+	}
+
+	switch o.ConsoleFormat {
+	case "auto", "plain", "pretty":
+	default:
+		errs = append(errs, fmt.Errorf(`invalid value %q for "consoleFormat": must be "auto", "plain", or "pretty"`, o.ConsoleFormat))
+	}
+
+	switch o.Symlinks {
+	case "skip", "follow", "error":
+	default:
+		errs = append(errs, fmt.Errorf(`invalid value %q for "symlinks": must be "skip", "follow", or "error"`, o.Symlinks))
+	}
+
+	switch o.LineLengthUnit {
+	case "characters", "bytes":
+	default:
+		errs = append(errs, fmt.Errorf(`invalid value %q for "lineLengthUnit": must be "characters" or "bytes"`, o.LineLengthUnit))
+	}
+
+	switch o.MinConfidence {
+	case "substring", "alias", "quoted", "sdkCall":
+	default:
+		errs = append(errs, fmt.Errorf(`invalid value %q for "minConfidence": must be "substring", "alias", "quoted", or "sdkCall"`, o.MinConfidence))
+	}
+
+	switch o.SparsePaths {
+	case "report", "fetch":
+	default:
+		errs = append(errs, fmt.Errorf(`invalid value %q for "sparsePaths": must be "report" or "fetch"`, o.SparsePaths))
+	}
+
+	for _, grouping := range strings.Split(o.Report, ",") {
+		switch strings.TrimSpace(grouping) {
+		case "", "flag", "directory", "language", "tag":
+			continue
 		}
+		errs = append(errs, fmt.Errorf(`invalid value %q for "report": must be a comma-separated list of "flag", "directory", "language", or "tag"`, o.Report))
+		break
+	}
+
+	switch o.ReportSort {
+	case "references", "aliasOnly", "name":
+	default:
+		errs = append(errs, fmt.Errorf(`invalid value %q for "reportSort": must be "references", "aliasOnly", or "name"`, o.ReportSort))
+	}
+
+	_, err = warnings.ParseCategories(o.Strict)
+	if err != nil {
+		errs = append(errs, fmt.Errorf(`invalid value for "strict": %w`, err))
+	}
+
+	if o.HunkMergeLines < 0 {
+		errs = append(errs, fmt.Errorf(`invalid value %d for "hunkMergeLines": must be >= 0`, o.HunkMergeLines))
+	}
+
+	if o.MaxAliasCommandsPerSecond < 0 {
+		errs = append(errs, fmt.Errorf(`invalid value %d for "maxAliasCommandsPerSecond": must be >= 0`, o.MaxAliasCommandsPerSecond))
+	}
+
+	if o.MaxFileSizeKb < 0 {
+		errs = append(errs, fmt.Errorf(`invalid value %d for "maxFileSizeKb": must be >= 0`, o.MaxFileSizeKb))
+	}
+
+	if o.FlagCacheTtl < 0 {
+		errs = append(errs, fmt.Errorf(`invalid value %d for "flagCacheTtl": must be >= 0`, o.FlagCacheTtl))
+	}
+
+	if o.MaxFlags < 0 {
+		errs = append(errs, fmt.Errorf(`invalid value %d for "maxFlags": must be >= 0`, o.MaxFlags))
+	}
+
+	if o.MaxProcs < 0 {
+		errs = append(errs, fmt.Errorf(`invalid value %d for "maxProcs": must be >= 0`, o.MaxProcs))
+	}
+
+	if o.MaxReadKbPerSecond < 0 {
+		errs = append(errs, fmt.Errorf(`invalid value %d for "maxReadKbPerSecond": must be >= 0`, o.MaxReadKbPerSecond))
+	}
+
+	if o.SearchConcurrency < 0 {
+		errs = append(errs, fmt.Errorf(`invalid value %d for "searchConcurrency": must be >= 0`, o.SearchConcurrency))
+	}
+
+	if o.MaxScanTime < 0 {
+		errs = append(errs, fmt.Errorf(`invalid value %d for "maxScanTime": must be >= 0`, o.MaxScanTime))
+	}
+
+	if o.Top < 0 {
+		errs = append(errs, fmt.Errorf(`invalid value %d for "top": must be >= 0`, o.Top))
+	}
+
+	if o.SuggestCodemods && o.OutDir == "" {
+		errs = append(errs, fmt.Errorf(`"outDir" option is required when "suggestCodemods" option is set`))
+	}
+
+	if o.DeferUpload && o.OutDir == "" {
+		errs = append(errs, fmt.Errorf(`"outDir" option is required when "deferUpload" option is set`))
+	}
+
+	if o.CompareRuns && o.OutDir == "" {
+		errs = append(errs, fmt.Errorf(`"outDir" option is required when "compareRuns" option is set`))
+	}
+
+	if o.Lock && o.OutDir == "" {
+		errs = append(errs, fmt.Errorf(`"outDir" option is required when "lock" option is set`))
+	}
+
+	if o.Xlsx && o.OutDir == "" {
+		errs = append(errs, fmt.Errorf(`"outDir" option is required when "xlsx" option is set`))
+	}
+
+	if o.AnonymizePaths && o.HunkUrlTemplate != "" {
+		errs = append(errs, fmt.Errorf(`"anonymizePaths" and "hunkUrlTemplate" options cannot both be set`))
+	}
+
+	if o.AnonymizePaths && o.AnonymizeKey == "" {
+		errs = append(errs, fmt.Errorf(`"anonymizeKey" option is required when "anonymizePaths" option is set`))
+	}
+
+	switch strings.ToLower(o.PrivacyPreset) {
+	case "", PrivacyStandard, PrivacyFull:
+	case PrivacyStrict:
+		if o.HunkUrlTemplate != "" {
+			// paths are anonymized, so links to code references would not work
+			errs = append(errs, fmt.Errorf(`"hunkUrlTemplate" option cannot be set when "privacyPreset" is "strict"`))
+		}
+		if o.AnonymizeKey == "" && !o.AnonymizePaths {
+			errs = append(errs, fmt.Errorf(`"anonymizeKey" option is required when "privacyPreset" is "strict"`))
+		}
+	default:
+		errs = append(errs, fmt.Errorf(`invalid value %q for "privacyPreset": must be "strict", "standard", or "full"`, o.PrivacyPreset))
+	}
+
+	if o.AllProjects {
+		if o.OfflineFlags != "" {
+			errs = append(errs, fmt.Errorf(`"allProjects" and "offlineFlags" options cannot both be set`))
+		}
+		if o.SuggestCodemods {
+			errs = append(errs, fmt.Errorf(`"allProjects" and "suggestCodemods" options cannot both be set`))
+		}
+	}
+
+	if o.SonarQubeIssues && o.OutDir == "" {
+		errs = append(errs, fmt.Errorf(`"outDir" option is required when "sonarQubeIssues" option is set`))
+	}
+
+	if o.SigningKey != "" && o.OutDir == "" {
+		errs = append(errs, fmt.Errorf(`"outDir" option is required when "signingKey" option is set`))
+	}
+
+	if o.Archive != "" {
+		if o.Dir != "" {
+			errs = append(errs, fmt.Errorf(`"dir" and "archive" options cannot both be set`))
+		}
+		if !validation.FileExists(o.Archive) {
+			errs = append(errs, fmt.Errorf(`invalid value for "archive": file does not exist: %s`, o.Archive))
+		} else if !archive.IsArchive(o.Archive) {
+			errs = append(errs, fmt.Errorf(`invalid value for "archive": must be a .tar, .tar.gz, .tgz, or .zip file`))
+		}
+		if o.Revision == "" {
+			errs = append(errs, fmt.Errorf(`"revision" option is required when "archive" option is set`))
+		}
+	}
+
+	if o.KnownBranches != "" && !validation.FileExists(o.KnownBranches) {
+		errs = append(errs, fmt.Errorf(`invalid value for "knownBranches": file does not exist: %s`, o.KnownBranches))
 	}
 
 	if o.Revision != "" && o.Branch == "" {
-		return fmt.Errorf(`"branch" option is required when "revision" option is set`)
+		errs = append(errs, fmt.Errorf(`"branch" option is required when "revision" option is set`))
+	}
+
+	if strings.TrimSpace(o.Branches) != "" {
+		for _, conflict := range []struct{ name, value string }{{"branch", o.Branch}, {"revision", o.Revision}, {"archive", o.Archive}} {
+			if conflict.value != "" {
+				errs = append(errs, fmt.Errorf(`"branches" and %q options cannot both be set`, conflict.name))
+			}
+		}
+		for _, branch := range strings.Split(o.Branches, ",") {
+			if _, err := path.Match(strings.TrimSpace(branch), ""); err != nil {
+				errs = append(errs, fmt.Errorf(`invalid value %q for "branches": %s`, branch, err))
+			}
+		}
 	}
 
+	errs = append(errs, o.yamlErrors()...)
+
+	return errs.errOrNil()
+}
+
+// ValidateYAML ensures the options which can only be configured via YAML configuration have been set to a valid value
+func (o Options) ValidateYAML() error {
+	return o.yamlErrors().errOrNil()
+}
+
+func (o Options) yamlErrors() validationErrors {
+	errs := validationErrors{}
+
+	// delimiters may be any printable character, including non-ASCII quotes such as « and »
+	for i, d := range o.Delimiters.Additional {
+		if r, _ := utf8.DecodeRuneInString(d); utf8.RuneCountInString(d) != 1 || r == utf8.RuneError || !unicode.IsPrint(r) {
+			errs = append(errs, fmt.Errorf(`invalid value %q for "delimiters.additional[%d]": each delimiter must be a single printable character`, d, i))
+		}
+	}
+
+	for i, p := range o.Delimiters.Pairs {
+		if p.Open == "" && p.Close == "" {
+			errs = append(errs, fmt.Errorf(`invalid value for "delimiters.pairs[%d]": at least one of "open" or "close" must be provided`, i))
+		}
+	}
+
+	for i, a := range o.Aliases {
+		err := a.IsValid()
+		if err != nil {
+			errs = append(errs, fmt.Errorf(`invalid value for "aliases[%d]": %w`, i, err))
+		}
+	}
+
+	for i, source := range o.AliasSources {
+		if isRemoteSource(source) {
+			_, err := url.ParseRequestURI(source)
+			if err != nil {
+				errs = append(errs, fmt.Errorf(`invalid value %q for "aliasSources[%d]": %+v`, source, i, err))
+			}
+		} else if source == "" {
+			errs = append(errs, fmt.Errorf(`invalid value for "aliasSources[%d]": must be a URL or a file path`, i))
+		}
+	}
+
+	for i, a := range o.BranchAliases {
+		err := a.validate()
+		if err != nil {
+			errs = append(errs, fmt.Errorf(`invalid value for "branchAliases[%d]": %w`, i, err))
+		}
+	}
+
+	for i, c := range o.ContextLineOverrides {
+		if len(c.Flags) == 0 && len(c.Paths) == 0 {
+			errs = append(errs, fmt.Errorf(`invalid value for "contextLineOverrides[%d]": at least one of "flags" or "paths" must be provided`, i))
+		}
+		if c.ContextLines > maxContextLines {
+			errs = append(errs, fmt.Errorf(`invalid value %d for "contextLineOverrides[%d].contextLines": must be <= %d`, c.ContextLines, i, maxContextLines))
+		}
+	}
+
+	for i, tag := range o.RepoMetadata.Tags {
+		if strings.TrimSpace(tag) == "" {
+			errs = append(errs, fmt.Errorf(`invalid value for "repoMetadata.tags[%d]": tags must not be empty`, i))
+		}
+	}
+
+	if o.Jira.Project != "" || o.Jira.Url != "" {
+		if o.Jira.Project == "" {
+			errs = append(errs, fmt.Errorf(`"jira.project" is required when "jira.url" is set`))
+		}
+		if o.Jira.Url == "" {
+			errs = append(errs, fmt.Errorf(`"jira.url" is required when "jira.project" is set`))
+		} else if _, err := url.ParseRequestURI(o.Jira.Url); err != nil {
+			errs = append(errs, fmt.Errorf(`invalid value %q for "jira.url": %+v`, o.Jira.Url, err))
+		}
+	}
+	for i, label := range o.Jira.Labels {
+		if label == "" || strings.ContainsAny(label, " \t\n") {
+			errs = append(errs, fmt.Errorf(`invalid value %q for "jira.labels[%d]": labels must not be empty or contain spaces`, label, i))
+		}
+	}
+	for i, policy := range o.Jira.StaleFlags {
+		if policy != StaleArchived && policy != StaleRolledOut {
+			errs = append(errs, fmt.Errorf(`invalid value %q for "jira.staleFlags[%d]": must be %q or %q`, policy, i, StaleArchived, StaleRolledOut))
+		}
+	}
+
+	if o.AliasCollisions != "" {
+		err := o.AliasCollisions.IsValid()
+		if err != nil {
+			errs = append(errs, fmt.Errorf(`invalid value for "aliasCollisions": %w`, err))
+		}
+	}
+
+	return errs
+}
+
+const maxContextLines = 5
+
+var (
+	commitUrlTemplateVars = []string{"branchName", "sha"}
+	hunkUrlTemplateVars   = []string{"sha", "filePath", "lineNumber"}
+	templateVarRegex      = regexp.MustCompile(`\$\{([^}]*)\}`)
+)
+
+// validateUrlTemplate ensures a url template only references allowed template variables
+func validateUrlTemplate(name, template string, allowedVars []string) error {
+	for _, match := range templateVarRegex.FindAllStringSubmatch(template, -1) {
+		valid := false
+		for _, v := range allowedVars {
+			if match[1] == v {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return fmt.Errorf(`invalid value %q for %q: unknown template variable '${%s}', allowed template variables: %s`, template, name, match[1], strings.Join(allowedVars, ", "))
+		}
+	}
+	return nil
+}
+
+// validateBranch rejects branch names which cannot be sent to LaunchDarkly. Slashes, '#', and unicode are allowed, and
+// are escaped in request urls.
+func validateBranch(branch string) error {
+	if !utf8.ValidString(branch) {
+		return fmt.Errorf(`invalid value %q for "branch": must be valid UTF-8`, branch)
+	}
+	for _, r := range branch {
+		if unicode.IsControl(r) {
+			return fmt.Errorf(`invalid value %q for "branch": must not contain control characters`, branch)
+		}
+	}
+	if strings.TrimSpace(strings.TrimPrefix(branch, "refs/heads/")) == "" {
+		return fmt.Errorf(`invalid value %q for "branch": must not be empty`, branch)
+	}
+	return nil
+}
+
+// CSVComma returns the character separating fields of the CSV output
+func (o Options) CSVComma() rune {
+	if o.CSVDelimiter == "" {
+		return ','
+	} else if strings.EqualFold(o.CSVDelimiter, "tab") {
+		return '\t'
+	}
+	comma, _ := utf8.DecodeRuneInString(o.CSVDelimiter)
+	return comma
+}
+
+// SampleFraction returns the fraction of files searched by the sample option, or 0 if every file is searched
+func (o Options) SampleFraction() (float64, error) {
+	if o.Sample == "" {
+		return 0, nil
+	}
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(o.Sample), "%"), 64)
+	if err != nil || percent <= 0 || percent > 100 {
+		return 0, fmt.Errorf(`invalid value %q for "sample": must be a percentage greater than 0%% and at most 100%%, e.g. "5%%"`, o.Sample)
+	}
+	return percent / 100, nil
+}
+
+// validateAccessToken rejects SDK and mobile keys, which are commonly provided in place of an access token by mistake
+func validateAccessToken(token string) error {
+	switch {
+	case strings.HasPrefix(token, "sdk-"):
+		return errors.New(`invalid value for "accessToken": provided token appears to be a LaunchDarkly SDK key, a personal or service access token is required`)
+	case strings.HasPrefix(token, "mob-"):
+		return errors.New(`invalid value for "accessToken": provided token appears to be a LaunchDarkly mobile key, a personal or service access token is required`)
+	}
 	return nil
 }
+
+// validationErrors aggregates all option validation failures into a single error
+type validationErrors []error
+
+func (v validationErrors) Error() string {
+	msgs := make([]string, 0, len(v))
+	for _, err := range v {
+		msgs = append(msgs, "  - "+err.Error())
+	}
+	return fmt.Sprintf("found %d invalid option(s):\n%s", len(v), strings.Join(msgs, "\n"))
+}
+
+func (v validationErrors) errOrNil() error {
+	switch len(v) {
+	case 0:
+		return nil
+	case 1:
+		return v[0]
+	}
+	return v
+}
@@ -0,0 +1,418 @@
+package options
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func validOptions() Options {
+	return Options{
+		AccessToken:    "api-x",
+		Dir:            ".",
+		ProjKey:        "default",
+		RepoName:       "test-repo",
+		RepoType:       "custom",
+		ContextLines:   2,
+		ConsoleFormat:  "auto",
+		SDKs:           "launchdarkly",
+		ShortFlagKeys:  "omit",
+		Symlinks:       "skip",
+		SparsePaths:    "report",
+		LineLengthUnit: "characters",
+		MinConfidence:  "substring",
+		ReportSort:     "references",
+	}
+}
+
+func TestValidate(t *testing.T) {
+	specs := []struct {
+		name     string
+		modify   func(o *Options)
+		wantErrs int
+	}{
+		{
+			name:     "valid options",
+			modify:   func(o *Options) {},
+			wantErrs: 0,
+		},
+		{
+			name:     "invalid repo name",
+			modify:   func(o *Options) { o.RepoName = "my repo!" },
+			wantErrs: 1,
+		},
+		{
+			name: "invalid repo name with normalization",
+			modify: func(o *Options) {
+				o.RepoName = "my repo!"
+				o.NormalizeRepoName = true
+			},
+		},
+		{
+			name: "repo name without letters or numbers with normalization",
+			modify: func(o *Options) {
+				o.RepoName = "!!!"
+				o.NormalizeRepoName = true
+			},
+			wantErrs: 1,
+		},
+		{
+			name:     "sdk key provided as access token",
+			modify:   func(o *Options) { o.AccessToken = "sdk-xxxx" },
+			wantErrs: 1,
+		},
+		{
+			name:     "unknown hunk url template variable",
+			modify:   func(o *Options) { o.HunkUrlTemplate = "https://example.com/${sha}/${branchName}" },
+			wantErrs: 1,
+		},
+		{
+			name:     "valid commit url template",
+			modify:   func(o *Options) { o.CommitUrlTemplate = "https://example.com/${branchName}/${sha}" },
+			wantErrs: 0,
+		},
+		{
+			name:     "invalid min confidence",
+			modify:   func(o *Options) { o.MinConfidence = "high" },
+			wantErrs: 1,
+		},
+		{
+			name:     "valid strict warning categories",
+			modify:   func(o *Options) { o.Strict = "truncation, limit" },
+			wantErrs: 0,
+		},
+		{
+			name:     "invalid strict warning category",
+			modify:   func(o *Options) { o.Strict = "truncation,unknown" },
+			wantErrs: 1,
+		},
+		{
+			name:     "negative hunk merge distance",
+			modify:   func(o *Options) { o.HunkMergeLines = -1 },
+			wantErrs: 1,
+		},
+		{
+			name:     "valid report groupings",
+			modify:   func(o *Options) { o.Report = "directory, tag" },
+			wantErrs: 0,
+		},
+		{
+			name:     "invalid report grouping",
+			modify:   func(o *Options) { o.Report = "flag,team,owner" },
+			wantErrs: 1,
+		},
+		{
+			name:   "log levels",
+			modify: func(o *Options) { o.LogLevel = "warn,ld=trace,search=info" },
+		},
+		{
+			name:     "invalid log level",
+			modify:   func(o *Options) { o.LogLevel = "ld=verbose" },
+			wantErrs: 1,
+		},
+		{
+			name:     "negative max flags",
+			modify:   func(o *Options) { o.MaxFlags = -1 },
+			wantErrs: 1,
+		},
+		{
+			name: "valid context line overrides",
+			modify: func(o *Options) {
+				o.ContextLineOverrides = []ContextLineOverride{{Paths: []string{"config/"}, ContextLines: -1}, {Flags: []string{"my-flag"}, ContextLines: 5}}
+			},
+			wantErrs: 0,
+		},
+		{
+			name: "invalid context line overrides",
+			modify: func(o *Options) {
+				o.ContextLineOverrides = []ContextLineOverride{{ContextLines: 1}, {Paths: []string{"src/"}, ContextLines: 6}}
+			},
+			wantErrs: 2,
+		},
+		{
+			name: "invalid branch aliases",
+			modify: func(o *Options) {
+				o.BranchAliases = []BranchAlias{{From: "mirror/*", To: "*"}, {From: "mirror/main"}, {From: "main", To: "*"}}
+			},
+			wantErrs: 2,
+		},
+		{
+			name: "bitbucket server repo type",
+			modify: func(o *Options) {
+				o.RepoType = "bitbucketServer"
+			},
+		},
+		{
+			name:   "sample percentage",
+			modify: func(o *Options) { o.Sample = "0.5%" },
+		},
+		{
+			name:     "sample out of range",
+			modify:   func(o *Options) { o.Sample = "150%" },
+			wantErrs: 1,
+		},
+		{
+			name:     "sample not a percentage",
+			modify:   func(o *Options) { o.Sample = "half" },
+			wantErrs: 1,
+		},
+		{
+			name:   "tab csv delimiter",
+			modify: func(o *Options) { o.CSVDelimiter = "tab" },
+		},
+		{
+			name:     "multiple character csv delimiter",
+			modify:   func(o *Options) { o.CSVDelimiter = ",;" },
+			wantErrs: 1,
+		},
+		{
+			name:     "quote csv delimiter",
+			modify:   func(o *Options) { o.CSVDelimiter = `"` },
+			wantErrs: 1,
+		},
+		{
+			name: "negative resource limits",
+			modify: func(o *Options) {
+				o.MaxProcs = -1
+				o.MaxReadKbPerSecond = -1
+				o.SearchConcurrency = -1
+			},
+			wantErrs: 3,
+		},
+		{
+			name: "strict privacy preset with hunk url template",
+			modify: func(o *Options) {
+				o.PrivacyPreset = "strict"
+				o.AnonymizeKey = "secret"
+				o.HunkUrlTemplate = "https://example.com/${filePath}"
+			},
+			wantErrs: 1,
+		},
+		{
+			name:     "strict privacy preset without anonymize key",
+			modify:   func(o *Options) { o.PrivacyPreset = "strict" },
+			wantErrs: 1,
+		},
+		{
+			name: "unknown privacy preset",
+			modify: func(o *Options) {
+				o.PrivacyPreset = "minimal"
+			},
+			wantErrs: 1,
+		},
+		{
+			name: "gitlab url style",
+			modify: func(o *Options) {
+				o.UrlStyle = "gitlab"
+				o.RepoUrl = "https://gitlab.example.com/org/my-repo"
+			},
+		},
+		{
+			name: "unknown url style without repo url",
+			modify: func(o *Options) {
+				o.UrlStyle = "sourcehut"
+			},
+			wantErrs: 2,
+		},
+		{
+			name: "openfeature sdks",
+			modify: func(o *Options) {
+				o.SDKs = "launchdarkly, openfeature"
+			},
+		},
+		{
+			name: "invalid sdks",
+			modify: func(o *Options) {
+				o.SDKs = "launchdarkly,flagsmith"
+			},
+			wantErrs: 1,
+		},
+		{
+			name: "unsupported archive format",
+			modify: func(o *Options) {
+				o.Dir = ""
+				o.Archive = "options_test.go"
+				o.Revision = "abc123"
+				o.Branch = "main"
+			},
+			wantErrs: 1,
+		},
+		{
+			name: "archive with dir and without revision",
+			modify: func(o *Options) {
+				o.Archive = "snapshot.tar.gz"
+			},
+			wantErrs: 3,
+		},
+		{
+			name:     "branch with slashes, '#', and unicode",
+			modify:   func(o *Options) { o.Branch = "feature/ABC#123-añadir" },
+			wantErrs: 0,
+		},
+		{
+			name:     "branch with control characters",
+			modify:   func(o *Options) { o.Branch = "feature\nmain" },
+			wantErrs: 1,
+		},
+		{
+			name:     "branch with invalid UTF-8",
+			modify:   func(o *Options) { o.Branch = "feature/\xff" },
+			wantErrs: 1,
+		},
+		{
+			name:     "empty branch ref",
+			modify:   func(o *Options) { o.Branch = "refs/heads/" },
+			wantErrs: 1,
+		},
+		{
+			name:     "short flag keys in SDK calls",
+			modify:   func(o *Options) { o.ShortFlagKeys = "sdkCalls" },
+			wantErrs: 0,
+		},
+		{
+			name:     "invalid short flag keys policy",
+			modify:   func(o *Options) { o.ShortFlagKeys = "all" },
+			wantErrs: 1,
+		},
+		{
+			name: "anonymize paths with hunkUrlTemplate",
+			modify: func(o *Options) {
+				o.AnonymizePaths = true
+				o.AnonymizeKey = "secret"
+				o.HunkUrlTemplate = "https://github.com/org/repo/blob/${sha}/${filePath}#L${lineNumber}"
+			},
+			wantErrs: 1,
+		},
+		{
+			name:     "anonymize paths without anonymize key",
+			modify:   func(o *Options) { o.AnonymizePaths = true },
+			wantErrs: 1,
+		},
+		{
+			name: "all projects without projKey",
+			modify: func(o *Options) {
+				o.AllProjects = true
+				o.ProjKey = ""
+			},
+			wantErrs: 0,
+		},
+		{
+			name: "all projects with offlineFlags and suggestCodemods",
+			modify: func(o *Options) {
+				o.AllProjects = true
+				o.OfflineFlags = "flags.json"
+				o.SuggestCodemods = true
+				o.OutDir = "."
+			},
+			wantErrs: 2,
+		},
+		{
+			name: "jira without url, and with invalid labels and policies",
+			modify: func(o *Options) {
+				o.Jira = Jira{Project: "FLAGS", Labels: []string{"flag debt"}, StaleFlags: []string{"archived", "unused"}}
+			},
+			wantErrs: 3,
+		},
+		{
+			name:     "sonarQube issues without outDir",
+			modify:   func(o *Options) { o.SonarQubeIssues = true },
+			wantErrs: 1,
+		},
+		{
+			name:     "invalid otlp endpoint",
+			modify:   func(o *Options) { o.OtlpEndpoint = "localhost:4318" },
+			wantErrs: 1,
+		},
+		{
+			name:     "invalid request headers",
+			modify:   func(o *Options) { o.RequestHeaders = "User-Agent=custom" },
+			wantErrs: 1,
+		},
+		{
+			name:     "invalid outputs",
+			modify:   func(o *Options) { o.Outputs = "csv=refs.csv,pdf=refs.pdf" },
+			wantErrs: 1,
+		},
+		{
+			name:     "valid branches",
+			modify:   func(o *Options) { o.Branches = "main, release/*" },
+			wantErrs: 0,
+		},
+		{
+			name: "branches with branch and malformed pattern",
+			modify: func(o *Options) {
+				o.Branches = "main,release/[1-"
+				o.Branch = "main"
+			},
+			wantErrs: 2,
+		},
+		{
+			name:     "user agent suffix with line break",
+			modify:   func(o *Options) { o.UserAgentSuffix = "nightly\nscan" },
+			wantErrs: 1,
+		},
+		{
+			name:     "xlsx without outDir",
+			modify:   func(o *Options) { o.Xlsx = true },
+			wantErrs: 1,
+		},
+		{
+			name:     "compare runs without outDir",
+			modify:   func(o *Options) { o.CompareRuns = true },
+			wantErrs: 1,
+		},
+		{
+			name:     "lock without outDir",
+			modify:   func(o *Options) { o.Lock = true },
+			wantErrs: 1,
+		},
+		{
+			name: "lock with outDir",
+			modify: func(o *Options) {
+				o.Lock = true
+				o.OutDir = "."
+			},
+			wantErrs: 0,
+		},
+		{
+			name:     "non-ascii delimiters",
+			modify:   func(o *Options) { o.Delimiters.Additional = []string{"«", "»", "「"} },
+			wantErrs: 0,
+		},
+		{
+			name:     "control character delimiter",
+			modify:   func(o *Options) { o.Delimiters.Additional = []string{"\t"} },
+			wantErrs: 1,
+		},
+		{
+			name: "reports all violations",
+			modify: func(o *Options) {
+				o.ContextLines = 6
+				o.RepoType = "gitlab"
+				o.Revision = "abc123"
+				o.Delimiters.Additional = []string{"ab"}
+			},
+			wantErrs: 4,
+		},
+	}
+
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := validOptions()
+			tt.modify(&opts)
+			err := opts.Validate()
+			switch tt.wantErrs {
+			case 0:
+				require.NoError(t, err)
+			case 1:
+				require.Error(t, err)
+				_, aggregated := err.(validationErrors)
+				assert.False(t, aggregated, "single violations should not be aggregated")
+			default:
+				require.IsType(t, validationErrors{}, err)
+				assert.Len(t, err.(validationErrors), tt.wantErrs)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package options
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Output formats which may be written by the outputs option
+const (
+	OutputCSV   = "csv"
+	OutputJSON  = "json"
+	OutputSARIF = "sarif"
+)
+
+// Output is a file the code references found by a scan are written to
+type Output struct {
+	Format string
+	Path   string
+}
+
+// OutputFiles returns the files written by the outputs option, a comma-separated list of format=path pairs, e.g.
+// "csv=refs.csv,sarif=refs.sarif". A format may be written to more than one path, but each path may only be written once.
+func (o Options) OutputFiles() ([]Output, error) {
+	ret := []Output{}
+	if strings.TrimSpace(o.Outputs) == "" {
+		return ret, nil
+	}
+	paths := map[string]bool{}
+	for _, pair := range strings.Split(o.Outputs, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf(`invalid value %q for "outputs": each output must be a format=path pair`, pair)
+		}
+		format, path := strings.ToLower(strings.TrimSpace(parts[0])), strings.TrimSpace(parts[1])
+		switch {
+		case format != OutputCSV && format != OutputJSON && format != OutputSARIF:
+			return nil, fmt.Errorf(`invalid value %q for "outputs": format must be "csv", "json", or "sarif"`, pair)
+		case path == "":
+			return nil, fmt.Errorf(`invalid value %q for "outputs": path must not be empty`, pair)
+		case paths[path]:
+			return nil, fmt.Errorf(`invalid value %q for "outputs": %s is written by more than one output`, pair, path)
+		}
+		paths[path] = true
+		ret = append(ret, Output{Format: format, Path: path})
+	}
+	return ret, nil
+}
@@ -0,0 +1,41 @@
+package options
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutputFiles(t *testing.T) {
+	specs := []struct {
+		name    string
+		outputs string
+		want    []Output
+		wantErr bool
+	}{
+		{name: "empty", outputs: "", want: []Output{}},
+		{name: "single", outputs: "sarif=build/refs.sarif", want: []Output{{Format: OutputSARIF, Path: "build/refs.sarif"}}},
+		{
+			name:    "multiple",
+			outputs: "csv=refs.csv, JSON = refs.json,sarif=refs.sarif",
+			want:    []Output{{Format: OutputCSV, Path: "refs.csv"}, {Format: OutputJSON, Path: "refs.json"}, {Format: OutputSARIF, Path: "refs.sarif"}},
+		},
+		{name: "format written twice", outputs: "csv=a.csv,csv=b.csv", want: []Output{{Format: OutputCSV, Path: "a.csv"}, {Format: OutputCSV, Path: "b.csv"}}},
+		{name: "path written twice", outputs: "csv=refs.out,json=refs.out", wantErr: true},
+		{name: "missing path", outputs: "csv", wantErr: true},
+		{name: "empty path", outputs: "csv= ", wantErr: true},
+		{name: "unknown format", outputs: "xml=refs.xml", wantErr: true},
+	}
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Options{Outputs: tt.outputs}.OutputFiles()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package options
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Privacy presets limit the data sent to LaunchDarkly with a single option
+const (
+	// PrivacyStrict sends no source code, and anonymizes file paths
+	PrivacyStrict = "strict"
+	// PrivacyStandard only sends the lines containing flag references
+	PrivacyStandard = "standard"
+	// PrivacyFull applies the other options unchanged
+	PrivacyFull = "full"
+)
+
+// privacyPresetContextLines is the largest number of context lines allowed by each privacy preset
+var privacyPresetContextLines = map[string]int{
+	PrivacyStrict:   -1,
+	PrivacyStandard: 0,
+	PrivacyFull:     maxContextLines,
+}
+
+// WithPrivacyPreset returns the options restricted to the data allowed by the privacyPreset option, and a description of
+// each option which was changed to comply with the preset. The preset takes precedence over the options it covers.
+func (o Options) WithPrivacyPreset() (Options, []string) {
+	preset := strings.ToLower(o.PrivacyPreset)
+	maxLines, ok := privacyPresetContextLines[preset]
+	if !ok {
+		return o, nil
+	}
+	changes := []string{}
+	if o.ContextLines > maxLines {
+		changes = append(changes, fmt.Sprintf("contextLines lowered from %d to %d", o.ContextLines, maxLines))
+		o.ContextLines = maxLines
+	}
+	overrides := make([]ContextLineOverride, len(o.ContextLineOverrides))
+	copy(overrides, o.ContextLineOverrides)
+	for i, override := range overrides {
+		if override.ContextLines > maxLines {
+			changes = append(changes, fmt.Sprintf("contextLines of contextLineOverrides[%d] lowered from %d to %d", i, override.ContextLines, maxLines))
+			overrides[i].ContextLines = maxLines
+		}
+	}
+	o.ContextLineOverrides = overrides
+	if preset == PrivacyStrict && !o.AnonymizePaths {
+		changes = append(changes, "anonymizePaths enabled")
+		o.AnonymizePaths = true
+	}
+	return o, changes
+}
@@ -0,0 +1,41 @@
+package options
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithPrivacyPreset(t *testing.T) {
+	base := Options{
+		ContextLines:         2,
+		ContextLineOverrides: []ContextLineOverride{{Paths: []string{"docs/**"}, ContextLines: 5}, {Flags: []string{"secret-flag"}, ContextLines: -1}},
+	}
+
+	opts, changes := base.WithPrivacyPreset()
+	assert.Equal(t, base, opts, "options are unchanged without a preset")
+	assert.Empty(t, changes)
+
+	base.PrivacyPreset = "strict"
+	opts, changes = base.WithPrivacyPreset()
+	assert.Equal(t, -1, opts.ContextLines)
+	assert.Equal(t, []ContextLineOverride{{Paths: []string{"docs/**"}, ContextLines: -1}, {Flags: []string{"secret-flag"}, ContextLines: -1}}, opts.ContextLineOverrides)
+	assert.True(t, opts.AnonymizePaths)
+	assert.Equal(t, []string{
+		"contextLines lowered from 2 to -1",
+		"contextLines of contextLineOverrides[0] lowered from 5 to -1",
+		"anonymizePaths enabled",
+	}, changes)
+	assert.Equal(t, 5, base.ContextLineOverrides[0].ContextLines, "overrides of the original options are not changed")
+
+	base.PrivacyPreset = "Standard"
+	opts, changes = base.WithPrivacyPreset()
+	assert.Equal(t, 0, opts.ContextLines)
+	assert.False(t, opts.AnonymizePaths)
+	assert.Len(t, changes, 2)
+
+	base.PrivacyPreset = "full"
+	opts, changes = base.WithPrivacyPreset()
+	assert.Equal(t, base, opts)
+	assert.Empty(t, changes)
+}
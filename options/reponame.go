@@ -0,0 +1,46 @@
+package options
+
+import (
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// maxRepoNameLength is the length normalized repository names are trimmed to
+const maxRepoNameLength = 100
+
+var (
+	validRepoName = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+	// invalidRepoNameChars matches each run of characters which are not allowed in normalized repository names
+	invalidRepoNameChars = regexp.MustCompile(`[^a-z0-9._-]+`)
+)
+
+// NormalizeRepoName converts a repository name to one LaunchDarkly accepts. The name is lowercased, each run of
+// characters other than letters, numbers, '.', '_' or '-' is replaced with '-', separators are trimmed from both ends,
+// and the name is trimmed to maxRepoNameLength characters. An empty string is returned if nothing is left.
+func NormalizeRepoName(name string) string {
+	name = invalidRepoNameChars.ReplaceAllString(strings.ToLower(name), "-")
+	name = strings.Trim(name, ".-_")
+	if len(name) > maxRepoNameLength {
+		name = strings.TrimRight(name[:maxRepoNameLength], ".-_")
+	}
+	return name
+}
+
+// withDefaultRepoName derives the repoName option, if it was not provided, from the repoUrl option, or from the url of
+// the origin remote of the git repository in dir
+func (o Options) withDefaultRepoName() Options {
+	if o.RepoName != "" {
+		return o
+	}
+	remoteUrl := o.RepoUrl
+	if remoteUrl == "" && o.Dir != "" {
+		/* #nosec */
+		out, err := exec.Command("git", "-C", o.Dir, "remote", "get-url", "origin").Output()
+		if err == nil {
+			remoteUrl = strings.TrimSpace(string(out))
+		}
+	}
+	o.RepoName, _, _ = repoFromCloneUrl(remoteUrl)
+	return o
+}
@@ -0,0 +1,51 @@
+package options
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeRepoName(t *testing.T) {
+	specs := []struct {
+		name     string
+		repoName string
+		expected string
+	}{
+		{"valid", "my-repo_2.0", "my-repo_2.0"},
+		{"uppercase", "My-Repo", "my-repo"},
+		{"invalid characters", "org/My Repo!", "org-my-repo"},
+		{"separators at ends", "--my repo--", "my-repo"},
+		{"unicode", "répo", "r-po"},
+		{"nothing left", "!!!", ""},
+		{"too long", strings.Repeat("a", 99) + "-b", strings.Repeat("a", 99)},
+	}
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, NormalizeRepoName(tt.repoName))
+		})
+	}
+}
+
+func TestWithDefaultRepoName(t *testing.T) {
+	assert.Equal(t, "my-repo", Options{RepoName: "my-repo", RepoUrl: "https://github.com/org/other"}.withDefaultRepoName().RepoName)
+	assert.Equal(t, "other", Options{RepoUrl: "https://github.com/org/other.git"}.withDefaultRepoName().RepoName)
+
+	dir, err := ioutil.TempDir("", "reponame")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.Equal(t, "", Options{Dir: dir}.withDefaultRepoName().RepoName, "no repository")
+
+	out, err := exec.Command("git", "-C", dir, "init", "-q").CombinedOutput()
+	require.NoError(t, err, string(out))
+	assert.Equal(t, "", Options{Dir: dir}.withDefaultRepoName().RepoName, "no origin remote")
+
+	out, err = exec.Command("git", "-C", dir, "remote", "add", "origin", "git@github.com:org/My.Repo.git").CombinedOutput()
+	require.NoError(t, err, string(out))
+	assert.Equal(t, "My.Repo", Options{Dir: dir}.withDefaultRepoName().RepoName)
+}
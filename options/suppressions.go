@@ -0,0 +1,92 @@
+package options
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
+
+// suppressionsFile is the path of the suppressions file, relative to the repository
+var suppressionsFile = filepath.Join(".launchdarkly", "suppressions.yaml")
+
+// Suppression excludes known false positives from code references. A code reference is excluded if it is in a file
+// matching Path, references Flag, if set, and each line containing the reference matches LinePattern, if set.
+type Suppression struct {
+	// Path is a glob pattern matched against file paths relative to the repository
+	Path        string `mapstructure:"path" yaml:"path"`
+	Flag        string `mapstructure:"flag" yaml:"flag,omitempty"`
+	LinePattern string `mapstructure:"linePattern" yaml:"linePattern,omitempty"`
+	// Comment describes why the reference is suppressed
+	Comment string `mapstructure:"comment" yaml:"comment,omitempty"`
+}
+
+// IsValid returns an error if the suppression does not have a path, or would suppress every reference in a file
+func (s Suppression) IsValid() error {
+	if s.Path == "" {
+		return errors.New(`"path" is required`)
+	}
+	if s.Flag == "" && s.LinePattern == "" {
+		return errors.New(`at least one of "flag" or "linePattern" is required`)
+	}
+	if s.LinePattern != "" {
+		_, err := regexp.Compile(s.LinePattern)
+		if err != nil {
+			return fmt.Errorf(`invalid "linePattern": %w`, err)
+		}
+	}
+	return nil
+}
+
+// ReadSuppressions reads the suppressions listed in the repository's .launchdarkly/suppressions.yaml file, if present
+func ReadSuppressions(dir string) ([]Suppression, error) {
+	/* #nosec */
+	data, err := ioutil.ReadFile(filepath.Join(dir, suppressionsFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	v := viper.New()
+	v.SetConfigType("yaml")
+	err = v.ReadConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", suppressionsFile, err)
+	}
+	var file struct {
+		Suppressions []Suppression `mapstructure:"suppressions"`
+	}
+	err = v.Unmarshal(&file)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", suppressionsFile, err)
+	}
+	for i, s := range file.Suppressions {
+		if err := s.IsValid(); err != nil {
+			return nil, fmt.Errorf(`invalid value for "suppressions[%d]" in %s: %w`, i, suppressionsFile, err)
+		}
+	}
+	return file.Suppressions, nil
+}
+
+// WriteSuppressions replaces the repository's .launchdarkly/suppressions.yaml file with the given suppressions, and
+// returns the path of the file
+func WriteSuppressions(dir string, suppressions []Suppression) (string, error) {
+	data, err := yaml.Marshal(struct {
+		Suppressions []Suppression `yaml:"suppressions"`
+	}{suppressions})
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, suppressionsFile)
+	err = os.MkdirAll(filepath.Dir(path), 0750)
+	if err != nil {
+		return "", err
+	}
+	return path, ioutil.WriteFile(path, data, os.FileMode(0644))
+}
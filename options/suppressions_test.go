@@ -0,0 +1,60 @@
+package options
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadSuppressions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "suppressions")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	suppressions, err := ReadSuppressions(dir)
+	require.NoError(t, err)
+	assert.Empty(t, suppressions, "a missing suppressions file has no suppressions")
+
+	want := []Suppression{
+		{Path: "docs/**", Flag: "my-flag", Comment: "release notes"},
+		{Path: "src/app.js", Flag: "my-flag", LinePattern: `^\s*if \(variation\('my-flag'\)\) \{\s*$`},
+	}
+	path, err := WriteSuppressions(dir, want)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, ".launchdarkly", "suppressions.yaml"), path)
+	suppressions, err = ReadSuppressions(dir)
+	require.NoError(t, err)
+	assert.Equal(t, want, suppressions)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("suppressions:\n  - path: docs/**\n"), 0600))
+	_, err = ReadSuppressions(dir)
+	assert.EqualError(t, err, `invalid value for "suppressions[0]" in .launchdarkly/suppressions.yaml: at least one of "flag" or "linePattern" is required`)
+}
+
+func TestSuppression_IsValid(t *testing.T) {
+	specs := []struct {
+		name        string
+		suppression Suppression
+		wantErr     string
+	}{
+		{name: "flag", suppression: Suppression{Path: "*.js", Flag: "my-flag"}},
+		{name: "line pattern", suppression: Suppression{Path: "*.js", LinePattern: "mock"}},
+		{name: "missing path", suppression: Suppression{Flag: "my-flag"}, wantErr: `"path" is required`},
+		{name: "invalid line pattern", suppression: Suppression{Path: "*.js", LinePattern: "("}, wantErr: "invalid \"linePattern\": error parsing regexp: missing closing ): `(`"},
+	}
+
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.suppression.IsValid()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.wantErr)
+			}
+		})
+	}
+}
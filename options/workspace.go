@@ -0,0 +1,174 @@
+package options
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// WorkspaceRepo is a repository scanned as part of a workspace. Empty fields are inherited from the base options.
+type WorkspaceRepo struct {
+	Dir           string `mapstructure:"dir"`
+	RepoName      string `mapstructure:"repoName"`
+	RepoType      string `mapstructure:"repoType"`
+	RepoUrl       string `mapstructure:"repoUrl"`
+	Branch        string `mapstructure:"branch"`
+	DefaultBranch string `mapstructure:"defaultBranch"`
+	ProjKey       string `mapstructure:"projKey"`
+	// AccessTokenEnv and AccessTokenFile reference the access token used to scan the repository, so the workspace file does
+	// not contain credentials, e.g. an environment variable or a file mounted from a Kubernetes secret
+	AccessTokenEnv  string `mapstructure:"accessTokenEnv"`
+	AccessTokenFile string `mapstructure:"accessTokenFile"`
+}
+
+// ReadWorkspace reads a YAML workspace file containing a list of `repositories`. Relative directories and access token
+// files are resolved relative to the workspace file. If a repository name is not provided, the name of the directory is used.
+func ReadWorkspace(path string) ([]WorkspaceRepo, error) {
+	/* #nosec */
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	v := viper.New()
+	v.SetConfigType("yaml")
+	err = v.ReadConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("could not parse workspace file: %w", err)
+	}
+	var workspace struct {
+		Repositories []WorkspaceRepo `mapstructure:"repositories"`
+	}
+	err = v.Unmarshal(&workspace)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse workspace file: %w", err)
+	}
+
+	for i, r := range workspace.Repositories {
+		if r.Dir == "" {
+			return nil, fmt.Errorf(`invalid value for "repositories[%d]": "dir" is required`, i)
+		}
+		if r.AccessTokenEnv != "" && r.AccessTokenFile != "" {
+			return nil, fmt.Errorf(`invalid value for "repositories[%d]": "accessTokenEnv" and "accessTokenFile" cannot both be set`, i)
+		}
+		if !filepath.IsAbs(r.Dir) {
+			workspace.Repositories[i].Dir = filepath.Join(filepath.Dir(path), r.Dir)
+		}
+		if r.AccessTokenFile != "" && !filepath.IsAbs(r.AccessTokenFile) {
+			workspace.Repositories[i].AccessTokenFile = filepath.Join(filepath.Dir(path), r.AccessTokenFile)
+		}
+	}
+	return withDefaultRepoNames(workspace.Repositories), nil
+}
+
+// WorkspaceReposFromDirs returns a workspace repository for each directory, named after the directory
+func WorkspaceReposFromDirs(dirs []string) []WorkspaceRepo {
+	repos := make([]WorkspaceRepo, 0, len(dirs))
+	for _, dir := range dirs {
+		repos = append(repos, WorkspaceRepo{Dir: dir})
+	}
+	return withDefaultRepoNames(repos)
+}
+
+func withDefaultRepoNames(repos []WorkspaceRepo) []WorkspaceRepo {
+	for i, r := range repos {
+		if r.RepoName == "" {
+			abs, err := filepath.Abs(r.Dir)
+			if err != nil {
+				abs = r.Dir
+			}
+			repos[i].RepoName = filepath.Base(abs)
+		}
+	}
+	return repos
+}
+
+// Options returns the options used to scan the repository
+func (r WorkspaceRepo) Options(base Options) (Options, error) {
+	opts := base
+	opts.Dir = r.Dir
+	opts.RepoName = r.RepoName
+	if r.RepoType != "" {
+		opts.RepoType = r.RepoType
+	}
+	if r.RepoUrl != "" {
+		opts.RepoUrl = r.RepoUrl
+	}
+	if r.Branch != "" {
+		opts.Branch = r.Branch
+	}
+	if r.DefaultBranch != "" {
+		opts.DefaultBranch = r.DefaultBranch
+	}
+	if r.ProjKey != "" {
+		opts.ProjKey = r.ProjKey
+	}
+	switch {
+	case r.AccessTokenEnv != "":
+		opts.AccessToken = os.Getenv(r.AccessTokenEnv)
+		if opts.AccessToken == "" {
+			return opts, fmt.Errorf("access token environment variable %s of repository %s is not set", r.AccessTokenEnv, r.RepoName)
+		}
+	case r.AccessTokenFile != "":
+		/* #nosec */
+		data, err := ioutil.ReadFile(r.AccessTokenFile)
+		if err != nil {
+			return opts, fmt.Errorf("could not read access token of repository %s: %w", r.RepoName, err)
+		}
+		opts.AccessToken = strings.TrimSpace(string(data))
+	}
+	// Revisions are specific to a single repository, and profiles are collected for the whole process
+	opts.Revision = ""
+	opts.Profile = ""
+
+	return opts.withRepoYAML()
+}
+
+// withRepoYAML overrides YAML-only options with configuration from the repository's .launchdarkly/coderefs.yaml, if present
+func (o Options) withRepoYAML() (Options, error) {
+	repo, ok, err := readRepoYAML(o.Dir, o.AllowedConfigSources)
+	if err != nil || !ok {
+		return o, err
+	}
+	o.Aliases = repo.Aliases
+	o.AliasCollisions = repo.AliasCollisions
+	o.AliasSources = repo.AliasSources
+	o.BranchAliases = repo.BranchAliases
+	o.ContextLineOverrides = repo.ContextLineOverrides
+	o.Delimiters = repo.Delimiters
+	o.Hooks = repo.Hooks
+	o.Jira = repo.Jira
+	o.RepoMetadata = repo.RepoMetadata
+	return o, nil
+}
+
+// readRepoYAML returns the options configured by the .launchdarkly/coderefs.yaml of the repository in dir, including
+// configuration it extends, and false if the repository has no configuration. allowedSources is the
+// allowedConfigSources option.
+func readRepoYAML(dir, allowedSources string) (Options, bool, error) {
+	var repo Options
+	v := viper.New()
+	v.SetConfigName("coderefs")
+	v.SetConfigType("yaml")
+	v.AddConfigPath(filepath.Join(dir, ".launchdarkly"))
+	err := v.ReadInConfig()
+	if errors.As(err, &viper.ConfigFileNotFoundError{}) {
+		return repo, false, nil
+	} else if err != nil {
+		return repo, false, err
+	}
+	err = resolveExtends(v, allowedSources)
+	if err != nil {
+		return repo, false, err
+	}
+	err = v.Unmarshal(&repo)
+	if err != nil {
+		return repo, false, err
+	}
+	return repo, true, nil
+}
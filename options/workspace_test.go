@@ -0,0 +1,126 @@
+package options
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadWorkspace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "workspace")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	workspace := `repositories:
+  - dir: service-a
+  - dir: /abs/service-b
+    repoName: b
+    repoType: github
+    projKey: other
+    accessTokenFile: secrets/b
+`
+	path := filepath.Join(dir, "workspace.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(workspace), 0600))
+
+	repos, err := ReadWorkspace(path)
+	require.NoError(t, err)
+	assert.Equal(t, []WorkspaceRepo{
+		{Dir: filepath.Join(dir, "service-a"), RepoName: "service-a"},
+		{Dir: "/abs/service-b", RepoName: "b", RepoType: "github", ProjKey: "other", AccessTokenFile: filepath.Join(dir, "secrets/b")},
+	}, repos)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("repositories:\n  - dir: a\n    accessTokenEnv: A\n    accessTokenFile: a\n"), 0600))
+	_, err = ReadWorkspace(path)
+	assert.EqualError(t, err, `invalid value for "repositories[0]": "accessTokenEnv" and "accessTokenFile" cannot both be set`)
+}
+
+func TestWorkspaceRepoOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "workspace")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.Mkdir(filepath.Join(dir, ".launchdarkly"), 0700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, ".launchdarkly", "coderefs.yaml"), []byte("contextLines: 5\naliases:\n  - type: camelcase\n"), 0600))
+
+	base := validOptions()
+	base.Revision = "abc123"
+	opts, err := WorkspaceRepo{Dir: dir, RepoName: "repo", RepoType: "github"}.Options(base)
+	require.NoError(t, err)
+	assert.Equal(t, dir, opts.Dir)
+	assert.Equal(t, "repo", opts.RepoName)
+	assert.Equal(t, "github", opts.RepoType)
+	assert.Equal(t, "", opts.Revision)
+	// only YAML-only options are read from the repository
+	assert.Equal(t, base.ContextLines, opts.ContextLines)
+	assert.Equal(t, []Alias{{Type: CamelCase}}, opts.Aliases)
+}
+
+func TestWorkspaceRepoOptions_yamlOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "workspace")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.Mkdir(filepath.Join(dir, ".launchdarkly"), 0700))
+	config := `aliases:
+  - type: camelcase
+aliasCollisions: none
+aliasSources:
+  - aliases.yaml
+branchAliases:
+  - from: trunk
+    to: main
+contextLineOverrides:
+  - paths: ["docs/**"]
+    contextLines: 0
+delimiters:
+  additional: ["<"]
+hooks:
+  preScan: make generate
+jira:
+  url: https://example.atlassian.net
+  project: FLAG
+repoMetadata:
+  description: checkout service
+`
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, ".launchdarkly", "coderefs.yaml"), []byte(config), 0600))
+
+	opts, err := WorkspaceRepo{Dir: dir, RepoName: "repo"}.Options(validOptions())
+	require.NoError(t, err)
+	assert.Equal(t, []Alias{{Type: CamelCase}}, opts.Aliases)
+	assert.Equal(t, AttributeToNone, opts.AliasCollisions)
+	assert.Equal(t, []string{"aliases.yaml"}, opts.AliasSources)
+	assert.Equal(t, []BranchAlias{{From: "trunk", To: "main"}}, opts.BranchAliases)
+	assert.Equal(t, []ContextLineOverride{{Paths: []string{"docs/**"}}}, opts.ContextLineOverrides)
+	assert.Equal(t, []string{"<"}, opts.Delimiters.Additional)
+	assert.Equal(t, Hooks{PreScan: "make generate"}, opts.Hooks)
+	assert.Equal(t, Jira{Url: "https://example.atlassian.net", Project: "FLAG"}, opts.Jira)
+	assert.Equal(t, RepoMetadata{Description: "checkout service"}, opts.RepoMetadata)
+}
+
+func TestWorkspaceRepoOptions_credentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "workspace")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	tokenPath := filepath.Join(dir, "token")
+	require.NoError(t, ioutil.WriteFile(tokenPath, []byte("api-file\n"), 0600))
+	defer os.Unsetenv("TEST_WORKSPACE_TOKEN")
+	require.NoError(t, os.Setenv("TEST_WORKSPACE_TOKEN", "api-env"))
+
+	base := validOptions()
+	opts, err := WorkspaceRepo{Dir: dir, RepoName: "repo", ProjKey: "other", AccessTokenEnv: "TEST_WORKSPACE_TOKEN"}.Options(base)
+	require.NoError(t, err)
+	assert.Equal(t, "api-env", opts.AccessToken)
+	assert.Equal(t, "other", opts.ProjKey)
+
+	opts, err = WorkspaceRepo{Dir: dir, RepoName: "repo", AccessTokenFile: tokenPath}.Options(base)
+	require.NoError(t, err)
+	assert.Equal(t, "api-file", opts.AccessToken)
+	assert.Equal(t, base.ProjKey, opts.ProjKey)
+
+	_, err = WorkspaceRepo{Dir: dir, RepoName: "repo", AccessTokenEnv: "TEST_WORKSPACE_TOKEN_UNSET"}.Options(base)
+	assert.EqualError(t, err, "access token environment variable TEST_WORKSPACE_TOKEN_UNSET of repository repo is not set")
+	_, err = WorkspaceRepo{Dir: dir, RepoName: "repo", AccessTokenFile: filepath.Join(dir, "missing")}.Options(base)
+	assert.Error(t, err)
+}
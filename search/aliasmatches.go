@@ -0,0 +1,29 @@
+package search
+
+import (
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+)
+
+// TagAliasMatches records the aliases matched by each hunk which does not contain its flag key, and the name of the
+// alias configuration which generated each alias, so that references made only through aliases can be traced to the
+// configuration which produced them. rules maps each flag key and alias to the name of its configuration. Returns the
+// number of hunks tagged.
+func TagAliasMatches(workspace string, refs []ld.ReferenceHunksRep, delimiters Delimiters, rules map[string]map[string]string) int {
+	tagged := 0
+	forEachHunk(workspace, refs, func(path string, hunk *ld.HunkRep, lines []string) {
+		if len(hunk.Aliases) == 0 {
+			return
+		}
+		for _, line := range lines {
+			if delimiters.Match(line, hunk.FlagKey) {
+				return
+			}
+		}
+		hunk.AliasMatches = make([]ld.AliasMatch, 0, len(hunk.Aliases))
+		for _, alias := range hunk.Aliases {
+			hunk.AliasMatches = append(hunk.AliasMatches, ld.AliasMatch{Alias: alias, Rule: rules[hunk.FlagKey][alias]})
+		}
+		tagged++
+	})
+	return tagged
+}
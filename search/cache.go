@@ -0,0 +1,215 @@
+package search
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/version"
+)
+
+const (
+	contentCacheFile = "contents.json"
+	// contentCacheTTL is how long entries which are not used by any search are kept
+	contentCacheTTL = 30 * 24 * time.Hour
+)
+
+// ContentCache stores the code references found in the contents of each file searched, keyed by a hash of the contents
+// and of the search configuration. Files with the same contents, such as the files which do not differ between branches
+// of a repository, are only searched once, and later searches reuse the references found. The cache is stored in a
+// directory, and shared by searches which open the same directory.
+type ContentCache struct {
+	dir string
+
+	mu      sync.Mutex
+	entries map[string]contentCacheEntry
+
+	hits   int64
+	misses int64
+}
+
+// contentCacheEntry is the code references found in a file. Hunks are stored encoded, so each use of an entry decodes
+// its own copy.
+type contentCacheEntry struct {
+	Hunks json.RawMessage `json:"hunks,omitempty"`
+	// Used is the unix time the entry was last used by a search, so unused entries can be removed
+	Used int64 `json:"used"`
+}
+
+// OpenContentCache reads the cache stored in dir, or returns an empty cache if dir does not contain a cache. An invalid
+// cache is discarded.
+func OpenContentCache(dir string) (*ContentCache, error) {
+	c := &ContentCache{dir: dir, entries: map[string]contentCacheEntry{}}
+	/* #nosec */
+	data, err := ioutil.ReadFile(filepath.Join(dir, contentCacheFile))
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if json.Unmarshal(data, &c.entries) != nil {
+		c.entries = map[string]contentCacheEntry{}
+	}
+	return c, nil
+}
+
+// Save writes the cache to its directory, removing entries which have not been used recently. The cache is written to a
+// temporary file which replaces the previous cache, so a search reading the cache concurrently never reads a partial cache.
+func (c *ContentCache) Save() error {
+	c.mu.Lock()
+	cutoff := time.Now().Add(-contentCacheTTL).Unix()
+	for key, entry := range c.entries {
+		if entry.Used < cutoff {
+			delete(c.entries, key)
+		}
+	}
+	data, err := json.Marshal(c.entries)
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(c.dir, 0700)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(c.dir, contentCacheFile+".*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(c.dir, contentCacheFile))
+}
+
+// Stats returns the number of files whose code references were found in the cache, and the number of files which were
+// searched, by every search using the cache
+func (c *ContentCache) Stats() (hits, misses int64) {
+	if c == nil {
+		return 0, 0
+	}
+	return atomic.LoadInt64(&c.hits), atomic.LoadInt64(&c.misses)
+}
+
+// get returns the hunks stored for key, and true if there is an entry for key. A nil reference is stored for files
+// without code references.
+func (c *ContentCache) get(key string) ([]ld.HunkRep, bool) {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if ok {
+		entry.Used = time.Now().Unix()
+		c.entries[key] = entry
+	}
+	c.mu.Unlock()
+	if !ok {
+		atomic.AddInt64(&c.misses, 1)
+		return nil, false
+	}
+	var hunks []ld.HunkRep
+	if len(entry.Hunks) > 0 && json.Unmarshal(entry.Hunks, &hunks) != nil {
+		atomic.AddInt64(&c.misses, 1)
+		return nil, false
+	}
+	atomic.AddInt64(&c.hits, 1)
+	return hunks, true
+}
+
+// put stores the hunks found for key
+func (c *ContentCache) put(key string, hunks []ld.HunkRep) {
+	entry := contentCacheEntry{Used: time.Now().Unix()}
+	if len(hunks) > 0 {
+		data, err := json.Marshal(hunks)
+		if err != nil {
+			return
+		}
+		entry.Hunks = data
+	}
+	c.mu.Lock()
+	c.entries[key] = entry
+	c.mu.Unlock()
+}
+
+// contentCacheScope is the cache used by a single search, and a hash of the configuration of the search, which is part
+// of the key of each entry
+type contentCacheScope struct {
+	cache  *ContentCache
+	config string
+}
+
+// newContentCacheScope returns the scope of a search using the cache option, or nil if it is not set. Every option which changes
+// the code references found in a file is hashed, along with the version of ld-find-code-refs, as searches by other
+// versions may find different references.
+func newContentCacheScope(opts Options) *contentCacheScope {
+	if opts.Cache == nil {
+		return nil
+	}
+	data, err := json.Marshal(struct {
+		Version    string
+		ProjKey    string
+		Aliases    map[string][]string
+		CtxLines   ContextLines
+		Delimiters Delimiters
+		Unit       LineLengthUnit
+		MergeLines int
+	}{version.Version, opts.ProjKey, opts.Aliases, opts.ContextLines, opts.Delimiters, opts.LineLengthUnit, opts.MergeLines})
+	if err != nil {
+		return nil
+	}
+	sum := sha256.Sum256(data)
+	return &contentCacheScope{cache: opts.Cache, config: hex.EncodeToString(sum[:])}
+}
+
+// key returns the key of a file's entry in the cache. Context line overrides may apply to some paths and not others,
+// so the overrides which apply to the file's path are part of the key.
+func (s *contentCacheScope) key(f file, ctxLines ContextLines) string {
+	h := sha256.New()
+	_, _ = io.WriteString(h, s.config+"\n")
+	for i, o := range ctxLines.Overrides {
+		if o.matchesPath(f.path) {
+			_, _ = io.WriteString(h, strconv.Itoa(i)+",")
+		}
+	}
+	_, _ = io.WriteString(h, "\n"+strconv.Itoa(len(f.lines))+"\n")
+	for _, line := range f.lines {
+		_, _ = io.WriteString(h, line)
+		_, _ = h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// toHunks returns the code references in a file, from the cache if a file with the same contents was searched with the
+// same configuration before. If s is nil, the file is always searched.
+func (s *contentCacheScope) toHunks(f file, opts Options) *ld.ReferenceHunksRep {
+	if s == nil {
+		return opts.toHunks(f)
+	}
+	key := s.key(f, opts.ContextLines)
+	if hunks, ok := s.cache.get(key); ok {
+		if len(hunks) == 0 {
+			return nil
+		}
+		return &ld.ReferenceHunksRep{Path: f.path, Hunks: hunks}
+	}
+	ref := opts.toHunks(f)
+	if ref == nil {
+		s.cache.put(key, nil)
+	} else {
+		s.cache.put(key, ref.Hunks)
+	}
+	return ref
+}
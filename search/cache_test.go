@@ -0,0 +1,135 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+)
+
+func TestContentCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "content-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	aliases := map[string][]string{testFlagKey: {}}
+	ctxLines := NewContextLines(0, nil)
+	delimiters := defaultDelims
+	f := file{path: "src/flags.go", lines: []string{"a", "'" + testFlagKey + "'", "b"}}
+	unchanged := file{path: "other/flags.go", lines: f.lines}
+	noRefs := file{path: "src/main.go", lines: []string{"a"}}
+
+	cache, err := OpenContentCache(dir)
+	require.NoError(t, err)
+	opts := Options{ProjKey: "proj", Aliases: aliases, ContextLines: ctxLines, Delimiters: delimiters, LineLengthUnit: LineLengthBytes, Cache: cache}
+	scope := newContentCacheScope(opts)
+	want := opts.toHunks(f)
+	require.NotNil(t, want)
+
+	assert.Equal(t, want, scope.toHunks(f, opts))
+	assert.Nil(t, scope.toHunks(noRefs, opts))
+	hits, misses := cache.Stats()
+	assert.Equal(t, int64(0), hits)
+	assert.Equal(t, int64(2), misses)
+
+	// a file with the same contents at another path reuses the references found
+	got := scope.toHunks(unchanged, opts)
+	require.NotNil(t, got)
+	assert.Equal(t, unchanged.path, got.Path)
+	assertSameRefs(t, &ld.ReferenceHunksRep{Path: unchanged.path, Hunks: want.Hunks}, got)
+	assert.Nil(t, scope.toHunks(noRefs, opts))
+	hits, _ = cache.Stats()
+	assert.Equal(t, int64(2), hits)
+
+	// entries are persisted, and reused by a search opening the same directory
+	require.NoError(t, cache.Save())
+	reopened, err := OpenContentCache(dir)
+	require.NoError(t, err)
+	opts.Cache = reopened
+	scope = newContentCacheScope(opts)
+	assertSameRefs(t, want, scope.toHunks(f, opts))
+	hits, misses = reopened.Stats()
+	assert.Equal(t, int64(1), hits)
+	assert.Equal(t, int64(0), misses)
+
+	// a search with a different configuration does not reuse entries
+	opts.ContextLines = NewContextLines(1, nil)
+	scope = newContentCacheScope(opts)
+	got = scope.toHunks(f, opts)
+	require.NotNil(t, got)
+	assert.Equal(t, "a\n'"+testFlagKey+"'\nb", got.Hunks[0].Lines)
+	_, misses = reopened.Stats()
+	assert.Equal(t, int64(1), misses)
+}
+
+// assertSameRefs asserts that references are equal, once encoded, as empty and nil slices are not distinguished by the cache
+func assertSameRefs(t *testing.T, want, got *ld.ReferenceHunksRep) {
+	wantJSON, err := json.Marshal(want)
+	require.NoError(t, err)
+	gotJSON, err := json.Marshal(got)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(wantJSON), string(gotJSON))
+}
+
+func TestContentCache_pathOverrides(t *testing.T) {
+	cache, err := OpenContentCache("")
+	require.NoError(t, err)
+	aliases := map[string][]string{testFlagKey: {}}
+	ctxLines := NewContextLines(0, []ContextLinesOverride{{Paths: []string{"docs/"}, Lines: 1}})
+	delimiters := defaultDelims
+	opts := Options{ProjKey: "proj", Aliases: aliases, ContextLines: ctxLines, Delimiters: delimiters, LineLengthUnit: LineLengthBytes, Cache: cache}
+	scope := newContentCacheScope(opts)
+	lines := []string{"a", "'" + testFlagKey + "'", "b"}
+
+	src := scope.toHunks(file{path: "src/flags.go", lines: lines}, opts)
+	docs := scope.toHunks(file{path: "docs/flags.md", lines: lines}, opts)
+	require.NotNil(t, src)
+	require.NotNil(t, docs)
+	assert.Equal(t, "'"+testFlagKey+"'", src.Hunks[0].Lines)
+	assert.Equal(t, "a\n'"+testFlagKey+"'\nb", docs.Hunks[0].Lines)
+}
+
+func TestOpenContentCache_invalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "content-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, contentCacheFile), []byte("{"), 0600))
+
+	cache, err := OpenContentCache(dir)
+	require.NoError(t, err)
+	_, ok := cache.get("key")
+	assert.False(t, ok)
+}
+
+func TestSearchForRefs_contentCache(t *testing.T) {
+	cache, err := OpenContentCache("")
+	require.NoError(t, err)
+	aliases := map[string][]string{testFlagKey: {}}
+	search := func() []ld.ReferenceHunksRep {
+		refs, err := SearchForRefs(context.Background(), Options{ProjKey: "proj", Workspace: "testdata", Aliases: aliases, ContextLines: NewContextLines(0, nil), Delimiters: defaultDelims, LineLengthUnit: LineLengthBytes, Cache: cache})
+		require.NoError(t, err)
+		return refs
+	}
+
+	first := search()
+	_, searched := cache.Stats()
+	second := search()
+	hits, misses := cache.Stats()
+	require.Len(t, second, len(first))
+	for _, ref := range first {
+		for i := range second {
+			if second[i].Path == ref.Path {
+				assertSameRefs(t, &ref, &second[i])
+			}
+		}
+	}
+	assert.Equal(t, searched, hits)
+	assert.Equal(t, searched, misses)
+}
@@ -0,0 +1,83 @@
+package search
+
+import (
+	"strings"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+)
+
+// quoteDelimiters are the delimiters of string literals in most languages
+const quoteDelimiters = `"'` + "`"
+
+// ScoreConfidence sets the confidence of each hunk to the highest confidence of the lines it spans. Calls to evaluation
+// methods of the given SDK APIs are scored as SDK calls.
+func ScoreConfidence(workspace string, refs []ld.ReferenceHunksRep, aliases map[string][]string, delimiters Delimiters, sdks []string) {
+	forEachHunk(workspace, refs, func(path string, hunk *ld.HunkRep, lines []string) {
+		lang := sdkLanguageFor(path, sdks)
+		// hunks always contain a match, so are never scored lower than a substring match
+		hunk.Confidence = ld.ConfidenceSubstring
+		for _, line := range lines {
+			if c := lineConfidence(line, hunk.FlagKey, aliases[hunk.FlagKey], delimiters, lang); c > hunk.Confidence {
+				hunk.Confidence = c
+			}
+		}
+	})
+}
+
+func lineConfidence(line, flagKey string, aliases []string, delimiters Delimiters, lang sdkLanguage) ld.Confidence {
+	if strings.Contains(line, flagKey) {
+		for _, m := range lang.calls(line) {
+			if equalKeys(m.key, flagKey) {
+				return ld.ConfidenceSDKCall
+			}
+		}
+	}
+	quoted := Delimiters{Chars: quoteDelimiters, CaseInsensitive: delimiters.CaseInsensitive}
+	if quoted.Match(line, flagKey) {
+		return ld.ConfidenceQuoted
+	}
+	for _, alias := range aliases {
+		if delimiters.containsAlias(line, alias) {
+			return ld.ConfidenceAlias
+		}
+	}
+	if delimiters.Match(line, flagKey) {
+		return ld.ConfidenceSubstring
+	}
+	return 0
+}
+
+// FilterConfidence removes hunks with a lower confidence than min, and files without any remaining hunks. Returns the
+// remaining references, and the number of hunks removed.
+func FilterConfidence(refs []ld.ReferenceHunksRep, min ld.Confidence) ([]ld.ReferenceHunksRep, int) {
+	return filterHunks(refs, func(hunk ld.HunkRep) bool {
+		return hunk.Confidence >= min
+	})
+}
+
+// FilterFlagConfidence removes hunks of the given flags with a lower confidence than min, and files without any remaining
+// hunks. Hunks of other flags are kept. Returns the remaining references, and the number of hunks removed.
+func FilterFlagConfidence(refs []ld.ReferenceHunksRep, flagKeys map[string]bool, min ld.Confidence) ([]ld.ReferenceHunksRep, int) {
+	return filterHunks(refs, func(hunk ld.HunkRep) bool {
+		return !flagKeys[hunk.FlagKey] || hunk.Confidence >= min
+	})
+}
+
+func filterHunks(refs []ld.ReferenceHunksRep, keep func(hunk ld.HunkRep) bool) ([]ld.ReferenceHunksRep, int) {
+	ret := make([]ld.ReferenceHunksRep, 0, len(refs))
+	removed := 0
+	for _, ref := range refs {
+		hunks := make([]ld.HunkRep, 0, len(ref.Hunks))
+		for _, hunk := range ref.Hunks {
+			if keep(hunk) {
+				hunks = append(hunks, hunk)
+			} else {
+				removed++
+			}
+		}
+		if len(hunks) > 0 {
+			ret = append(ret, ld.ReferenceHunksRep{Path: ref.Path, Hunks: hunks})
+		}
+	}
+	return ret, removed
+}
@@ -0,0 +1,92 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+)
+
+func Test_lineConfidence(t *testing.T) {
+	specs := []struct {
+		name       string
+		line       string
+		delimiters Delimiters
+		expected   ld.Confidence
+	}{
+		{name: "sdk call", line: `client.boolVariation("my-flag", ctx, false)`, expected: ld.ConfidenceSDKCall},
+		{name: "quoted key", line: `const FLAG = "my-flag"`, expected: ld.ConfidenceQuoted},
+		{name: "quoted key with custom delimiters", line: `const FLAG = 'my-flag'`, delimiters: Delimiters{Pairs: []DelimiterPair{{Open: "Flag(", Close: ")"}}}, expected: ld.ConfidenceQuoted},
+		{name: "alias", line: `if (myFlag) {`, expected: ld.ConfidenceAlias},
+		{name: "substring", line: `// remove my-flag after launch`, expected: ld.ConfidenceSubstring},
+		{name: "custom delimiters", line: `Flag(my-flag)`, delimiters: Delimiters{Pairs: []DelimiterPair{{Open: "Flag(", Close: ")"}}}, expected: ld.ConfidenceSubstring},
+		{name: "case insensitive quoted key", line: `flag: "MY-FLAG"`, delimiters: Delimiters{CaseInsensitive: true}, expected: ld.ConfidenceQuoted},
+		{name: "case insensitive alias", line: `if (MYFLAG) {`, delimiters: Delimiters{CaseInsensitiveAliases: map[string]bool{"myFlag": true}}, expected: ld.ConfidenceAlias},
+		{name: "case sensitive", line: `flag: "MY-FLAG"`, expected: 0},
+		{name: "no match", line: `unrelated`, expected: 0},
+	}
+
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			got := lineConfidence(tt.line, "my-flag", []string{"myFlag"}, tt.delimiters, sdkLanguageFor("app.js", nil))
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestScoreConfidence(t *testing.T) {
+	refs := []ld.ReferenceHunksRep{
+		{Path: "missing.js", Hunks: []ld.HunkRep{
+			{StartingLineNumber: 1, FlagKey: "my-flag", Lines: "// my-flag\nconst FLAG = 'my-flag'"},
+			{StartingLineNumber: 5, FlagKey: "my-flag", Lines: "if (myFlag) {"},
+			{StartingLineNumber: 9, FlagKey: "my-flag", Lines: "// my-flag"},
+		}},
+	}
+	ScoreConfidence("testdata", refs, map[string][]string{"my-flag": {"myFlag"}}, Delimiters{}, nil)
+	assert.Equal(t, ld.ConfidenceQuoted, refs[0].Hunks[0].Confidence, "hunks are scored by their highest confidence line")
+	assert.Equal(t, ld.ConfidenceAlias, refs[0].Hunks[1].Confidence)
+	assert.Equal(t, ld.ConfidenceSubstring, refs[0].Hunks[2].Confidence)
+
+	filtered, removed := FilterConfidence(refs, ld.ConfidenceAlias)
+	assert.Equal(t, 1, removed)
+	assert.Len(t, filtered[0].Hunks, 2)
+
+	filtered, removed = FilterConfidence(refs, ld.ConfidenceSDKCall)
+	assert.Equal(t, 3, removed)
+	assert.Empty(t, filtered)
+}
+
+func TestFilterFlagConfidence(t *testing.T) {
+	refs := []ld.ReferenceHunksRep{
+		{Path: "a.go", Hunks: []ld.HunkRep{
+			{StartingLineNumber: 1, FlagKey: "ab", Confidence: ld.ConfidenceSDKCall},
+			{StartingLineNumber: 5, FlagKey: "ab", Confidence: ld.ConfidenceQuoted},
+			{StartingLineNumber: 9, FlagKey: "my-flag", Confidence: ld.ConfidenceSubstring},
+		}},
+		{Path: "b.go", Hunks: []ld.HunkRep{
+			{StartingLineNumber: 1, FlagKey: "ab", Confidence: ld.ConfidenceQuoted},
+		}},
+	}
+	filtered, removed := FilterFlagConfidence(refs, map[string]bool{"ab": true}, ld.ConfidenceSDKCall)
+	assert.Equal(t, 2, removed)
+	require.Len(t, filtered, 1)
+	assert.Equal(t, []ld.HunkRep{refs[0].Hunks[0], refs[0].Hunks[2]}, filtered[0].Hunks, "hunks of other flags are kept")
+}
+
+func TestTagAliasMatches(t *testing.T) {
+	refs := []ld.ReferenceHunksRep{
+		{Path: "missing.js", Hunks: []ld.HunkRep{
+			{StartingLineNumber: 1, FlagKey: "my-flag", Lines: "const FLAG = 'my-flag'\nif (myFlag) {", Aliases: []string{"myFlag"}},
+			{StartingLineNumber: 5, FlagKey: "my-flag", Lines: "if (myFlag || MY_FLAG) {", Aliases: []string{"myFlag", "MY_FLAG"}},
+			{StartingLineNumber: 9, FlagKey: "my-flag", Lines: "// my-flag"},
+		}},
+	}
+	rules := map[string]map[string]string{"my-flag": {"myFlag": "aliases[0] (camelcase)", "MY_FLAG": "aliases[1] (screamingsnakecase)"}}
+	assert.Equal(t, 1, TagAliasMatches("testdata", refs, Delimiters{}, rules))
+	assert.Empty(t, refs[0].Hunks[0].AliasMatches, "hunks containing the flag key are not tagged")
+	assert.Equal(t, []ld.AliasMatch{{Alias: "myFlag", Rule: "aliases[0] (camelcase)"}, {Alias: "MY_FLAG", Rule: "aliases[1] (screamingsnakecase)"}}, refs[0].Hunks[1].AliasMatches)
+	assert.True(t, refs[0].Hunks[1].IsAliasOnly())
+	assert.Empty(t, refs[0].Hunks[2].AliasMatches)
+}
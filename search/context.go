@@ -0,0 +1,135 @@
+package search
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ContextLines configures the number of lines sent on either side of a reference. A negative value sends no lines.
+type ContextLines struct {
+	Default   int
+	Overrides []ContextLinesOverride
+}
+
+// ContextLinesOverride replaces the default number of context lines for references to specific flags, or in files matching specific paths.
+// If both Flags and Paths are set, a reference must match both for the override to apply.
+type ContextLinesOverride struct {
+	Flags []string
+	// Paths are glob patterns matched against file paths relative to the workspace. `*` matches within a single
+	// path segment, `**` matches any number of segments, and a trailing `/` matches everything beneath a directory.
+	Paths []string
+	Lines int
+
+	globs []*regexp.Regexp
+}
+
+// NewContextLines creates a ContextLines value, compiling the path globs of each override
+func NewContextLines(lines int, overrides []ContextLinesOverride) ContextLines {
+	ret := ContextLines{Default: lines, Overrides: make([]ContextLinesOverride, 0, len(overrides))}
+	for _, o := range overrides {
+		o.globs = make([]*regexp.Regexp, 0, len(o.Paths))
+		for _, glob := range o.Paths {
+			o.globs = append(o.globs, globToRegexp(glob))
+		}
+		ret.Overrides = append(ret.Overrides, o)
+	}
+	return ret
+}
+
+// For returns the number of context lines for references to flagKey in the file at path. Overrides are evaluated in order,
+// and the first matching override is used.
+func (c ContextLines) For(path, flagKey string) int {
+	return c.forPath(path)(flagKey)
+}
+
+// forPath returns a function resolving the number of context lines for each flag in the file at path,
+// so that path globs are only matched once per file
+func (c ContextLines) forPath(path string) func(flagKey string) int {
+	if len(c.Overrides) == 0 {
+		return func(string) int { return c.Default }
+	}
+	matched := make([]ContextLinesOverride, 0, len(c.Overrides))
+	for _, o := range c.Overrides {
+		if o.matchesPath(path) {
+			matched = append(matched, o)
+		}
+	}
+	return func(flagKey string) int {
+		for _, o := range matched {
+			if len(o.Flags) == 0 || containsString(o.Flags, flagKey) {
+				return o.Lines
+			}
+		}
+		return c.Default
+	}
+}
+
+func (o ContextLinesOverride) matchesPath(path string) bool {
+	if len(o.Paths) == 0 {
+		return true
+	}
+	path = strings.TrimPrefix(filepath.ToSlash(path), "./")
+	if o.globs == nil {
+		// overrides not created by NewContextLines are compiled on demand
+		for _, glob := range o.Paths {
+			if MatchGlob(glob, path) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, glob := range o.globs {
+		if glob.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchGlob returns true if the slash-separated path matches the glob pattern. `*` and `?` match within a single
+// path segment, `**` matches any number of segments, and a pattern ending in `/` matches everything beneath a directory.
+func MatchGlob(glob, path string) bool {
+	return globToRegexp(glob).MatchString(strings.TrimPrefix(path, "./"))
+}
+
+func globToRegexp(glob string) *regexp.Regexp {
+	glob = strings.TrimPrefix(filepath.ToSlash(glob), "./")
+	if strings.HasSuffix(glob, "/") {
+		glob += "**"
+	}
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+				if i+1 < len(glob) && glob[i+1] == '/' {
+					// `**/` matches zero or more leading directories
+					i++
+					sb.WriteString("(?:.*/)?")
+				} else {
+					sb.WriteString(".*")
+				}
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.MustCompile(sb.String())
+}
@@ -0,0 +1,67 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_MatchGlob(t *testing.T) {
+	specs := []struct {
+		glob  string
+		path  string
+		match bool
+	}{
+		{glob: "config/", path: "config/app.yaml", match: true},
+		{glob: "config/", path: "config/nested/app.yaml", match: true},
+		{glob: "config/", path: "src/config/app.yaml", match: false},
+		{glob: "src/*.go", path: "src/main.go", match: true},
+		{glob: "src/*.go", path: "src/pkg/main.go", match: false},
+		{glob: "src/**/*.go", path: "src/main.go", match: true},
+		{glob: "src/**/*.go", path: "src/pkg/main.go", match: true},
+		{glob: "**/*_test.go", path: "pkg/main_test.go", match: true},
+		{glob: "./docs/*.md", path: "docs/README.md", match: true},
+		{glob: "file?.txt", path: "file1.txt", match: true},
+		{glob: "file?.txt", path: "file10.txt", match: false},
+		{glob: "a+b.txt", path: "aab.txt", match: false},
+	}
+
+	for _, tt := range specs {
+		t.Run(tt.glob+" "+tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.match, MatchGlob(tt.glob, tt.path))
+		})
+	}
+}
+
+func Test_ContextLines_For(t *testing.T) {
+	ctxLines := NewContextLines(2, []ContextLinesOverride{
+		{Paths: []string{"config/"}, Lines: -1},
+		{Flags: []string{"verbose-flag"}, Paths: []string{"src/"}, Lines: 5},
+		{Flags: []string{"verbose-flag"}, Lines: 3},
+	})
+
+	specs := []struct {
+		name    string
+		path    string
+		flagKey string
+		want    int
+	}{
+		{name: "default", path: "main.go", flagKey: "some-flag", want: 2},
+		{name: "path override", path: "config/flags.yaml", flagKey: "verbose-flag", want: -1},
+		{name: "flag and path override", path: "src/main.go", flagKey: "verbose-flag", want: 5},
+		{name: "flag and path override requires flag", path: "src/main.go", flagKey: "some-flag", want: 2},
+		{name: "flag override", path: "main.go", flagKey: "verbose-flag", want: 3},
+	}
+
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ctxLines.For(tt.path, tt.flagKey))
+		})
+	}
+}
+
+func Test_ContextLines_For_uncompiled(t *testing.T) {
+	ctxLines := ContextLines{Default: 1, Overrides: []ContextLinesOverride{{Paths: []string{"config/"}, Lines: 0}}}
+	assert.Equal(t, 0, ctxLines.For("config/app.yaml", "some-flag"))
+	assert.Equal(t, 1, ctxLines.For("main.go", "some-flag"))
+}
@@ -0,0 +1,89 @@
+package search
+
+import (
+	"strings"
+)
+
+const (
+	// dataLineMinLength is the length in bytes below which lines are only data if they contain a base64 blob. Lines of
+	// code are rarely this long.
+	dataLineMinLength = 200
+	// dataLineTokenDensity is the number of tokens per byte above which a long line is data, such as an array of numbers,
+	// or minified code. Typical lines of code have around one token every 6 or 7 bytes.
+	dataLineTokenDensity = 0.25
+	// dataLineJSONLength is the length in bytes above which a line starting a JSON object or array is data
+	dataLineJSONLength = 1000
+	// base64MinLength is the length of the shortest run of base64 characters which is a blob, such as a SHA-512
+	// integrity hash in a lockfile
+	base64MinLength = 64
+	// base64MinClassFraction is the minimum fraction of a base64 blob made up of each of uppercase letters, lowercase
+	// letters and digits, distinguishing encoded data from long identifiers and paths
+	base64MinClassFraction = 0.05
+)
+
+// isDataLine returns true if a line is clearly data rather than code, such as a line of a lockfile, a base64 encoded
+// blob, or a JSON document on a single line. Flag keys found in data lines are almost always coincidental.
+func isDataLine(line string) bool {
+	if hasBase64Blob(line) {
+		return true
+	}
+	if len(line) < dataLineMinLength {
+		return false
+	}
+	trimmed := strings.TrimSpace(line)
+	if len(trimmed) >= dataLineJSONLength && (trimmed[0] == '{' || trimmed[0] == '[') {
+		return true
+	}
+	return float64(countTokens(trimmed)) >= dataLineTokenDensity*float64(len(trimmed))
+}
+
+// countTokens returns the number of runs of letters, digits and underscores in a line
+func countTokens(line string) int {
+	count := 0
+	inToken := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		word := c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+		if word && !inToken {
+			count++
+		}
+		inToken = word
+	}
+	return count
+}
+
+// hasBase64Blob returns true if a line contains a long run of base64 characters mixing uppercase letters, lowercase
+// letters, and digits
+func hasBase64Blob(line string) bool {
+	if len(line) < base64MinLength {
+		return false
+	}
+	start := 0
+	var upper, lower, digits int
+	for i := 0; i <= len(line); i++ {
+		if i < len(line) {
+			switch c := line[i]; {
+			case c >= 'A' && c <= 'Z':
+				upper++
+				continue
+			case c >= 'a' && c <= 'z':
+				lower++
+				continue
+			case c >= '0' && c <= '9':
+				digits++
+				continue
+			case c == '+' || c == '/' || c == '-' || c == '_':
+				continue
+			}
+		}
+		if n := i - start; n >= base64MinLength {
+			min := base64MinClassFraction * float64(n)
+			if float64(upper) >= min && float64(lower) >= min && float64(digits) >= min {
+				return true
+			}
+		}
+		start = i + 1
+		upper, lower, digits = 0, 0, 0
+	}
+	return false
+}
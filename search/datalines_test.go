@@ -0,0 +1,34 @@
+package search
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_isDataLine(t *testing.T) {
+	numbers := make([]string, 0, 100)
+	for i := 0; i < 100; i++ {
+		numbers = append(numbers, "12")
+	}
+	specs := []struct {
+		name string
+		line string
+		want bool
+	}{
+		{name: "code", line: `if (client.variation('dark-mode', user, false)) {`, want: false},
+		{name: "long line of code", line: `log.Printf("the dark-mode flag is enabled for %s, so the new theme is rendered for every page of the application, including settings and the onboarding flow, until it is removed", user.Name)`, want: false},
+		{name: "long path", line: `import { DarkModeToggle } from "../../components/settings/appearance/DarkModeToggle/DarkModeToggleWithPreview"`, want: false},
+		{name: "lockfile integrity", line: `      "integrity": "sha512-v2kDEe57lecTulaDIuNTPy3Ry4gLGJ6Z1O3vE1krgXZNrsQ+LFTGHVxVjcXPs7S7A6HWJAOSgPhPIj6OL0FX9Q==",`, want: true},
+		{name: "data uri", line: `background: url(data:image/png;base64,iVBORw0KGgoAAAANSUhEUgAAABAAAAAQCAYAAAAf8/9hAAAABmJLR0QA8ZLZ7xdSAAAAGElEQVQ4jWNgGAWjYBSMglEwCkbBKAAAAAB2c2Rp);`, want: true},
+		{name: "array of numbers", line: "var table = [" + strings.Join(numbers, ",") + "];", want: true},
+		{name: "json document", line: `{"flags":{"dark-mode":true,"new-checkout":` + strings.Repeat(`{"description":"a long description of the flag"},`, 25) + `}}`, want: true},
+		{name: "short json", line: `{"dark-mode": true}`, want: false},
+	}
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isDataLine(tt.line))
+		})
+	}
+}
@@ -0,0 +1,257 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// DelimiterPair is an asymmetric pair of strings surrounding a flag key, e.g. `Flag(` and `)`.
+// An empty Close matches a flag key immediately following Open which is not followed by another character of a flag
+// key, and vice versa.
+type DelimiterPair struct {
+	Open  string
+	Close string
+}
+
+// surrounds returns true if the flag key at line[start:end] is surrounded by the pair. If one side of the pair is
+// empty, that side of the flag key must be the start or end of the line, or a character which cannot be part of a flag
+// key, so a flag key which is a prefix or suffix of a longer flag key does not match.
+func (p DelimiterPair) surrounds(line string, start, end int) bool {
+	if !strings.HasSuffix(line[:start], p.Open) || !strings.HasPrefix(line[end:], p.Close) {
+		return false
+	}
+	if p.Open == "" && start > 0 {
+		if r, _ := utf8.DecodeLastRuneInString(line[:start]); isFlagKeyRune(r) {
+			return false
+		}
+	}
+	if p.Close == "" && end < len(line) {
+		if r, _ := utf8.DecodeRuneInString(line[end:]); isFlagKeyRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// isFlagKeyRune returns true if r may be part of a flag key, which contain letters, digits, '.', '_', and '-'.
+// Combining marks are included for flag keys in decomposed normalization form.
+func isFlagKeyRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) || r == '.' || r == '_' || r == '-'
+}
+
+// Delimiters configures the text that must surround a flag key for it to be considered a reference, and how flag keys
+// and aliases are compared
+type Delimiters struct {
+	// Chars are single-character delimiters that may appear on either side of a flag key
+	Chars string
+	Pairs []DelimiterPair
+	// CaseInsensitive matches flag keys and aliases regardless of case
+	CaseInsensitive bool
+	// CaseInsensitiveAliases are aliases matched regardless of case, even if CaseInsensitive is not set
+	CaseInsensitiveAliases map[string]bool
+	// SkipDataLines ignores matches in lines which are clearly data rather than code, see isDataLine
+	SkipDataLines bool
+}
+
+// NewDelimiters creates a Delimiters value from a string of single-character delimiters
+func NewDelimiters(chars string) Delimiters {
+	return Delimiters{Chars: chars}
+}
+
+// Match returns true if the given line contains the flag key surrounded by any configured delimiters.
+// If no delimiters are configured, any occurrence of the flag key is a match. Flag keys containing accented characters
+// match in either Unicode normalization form, see normalForms.
+func (d Delimiters) Match(line, flagKey string) bool {
+	for _, key := range normalForms(flagKey) {
+		if d.match(line, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d Delimiters) match(line, flagKey string) bool {
+	if d.CaseInsensitive {
+		return len(d.Indexes(line, flagKey)) > 0
+	}
+	if d.Chars == "" && len(d.Pairs) == 0 {
+		return strings.Contains(line, flagKey)
+	}
+	if d.Chars != "" && MatchDelimiters(line, flagKey, d.Chars) {
+		return true
+	}
+	for _, p := range d.Pairs {
+		for _, i := range indexes(line, flagKey, false) {
+			if p.surrounds(line, i, i+len(flagKey)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Indexes returns the byte offset of each occurrence of the flag key in the given line which is surrounded by any
+// configured delimiters. If no delimiters are configured, every occurrence of the flag key is returned.
+func (d Delimiters) Indexes(line, flagKey string) []int {
+	var ret []int
+	for _, o := range d.keyOccurrences(line, flagKey) {
+		ret = append(ret, o.start)
+	}
+	return ret
+}
+
+// occurrence is the byte offsets of a flag key or alias in a line. Occurrences of the other normalization form of a
+// flag key may differ in length from the flag key.
+type occurrence struct {
+	start, end int
+}
+
+// keyOccurrences returns each occurrence of the flag key, in either normalization form, in the given line which is
+// surrounded by any configured delimiters, in order
+func (d Delimiters) keyOccurrences(line, flagKey string) []occurrence {
+	var ret []occurrence
+	for _, key := range normalForms(flagKey) {
+		for _, i := range indexes(line, key, d.CaseInsensitive) {
+			if d.delimited(line, i, i+len(key)) {
+				ret = append(ret, occurrence{i, i + len(key)})
+			}
+		}
+	}
+	sortOccurrences(ret)
+	return ret
+}
+
+func (d Delimiters) delimited(line string, start, end int) bool {
+	if d.Chars == "" && len(d.Pairs) == 0 {
+		return true
+	}
+	if d.Chars != "" && start > 0 && end < len(line) {
+		left, _ := utf8.DecodeLastRuneInString(line[:start])
+		right, _ := utf8.DecodeRuneInString(line[end:])
+		if strings.ContainsRune(d.Chars, left) && strings.ContainsRune(d.Chars, right) {
+			return true
+		}
+	}
+	for _, p := range d.Pairs {
+		if p.surrounds(line, start, end) {
+			return true
+		}
+	}
+	return false
+}
+
+// aliasOccurrences returns each occurrence of an alias, in either normalization form, in the given line, in order
+func (d Delimiters) aliasOccurrences(line, alias string) []occurrence {
+	var ret []occurrence
+	for _, form := range normalForms(alias) {
+		for _, i := range indexes(line, form, d.foldAlias(alias)) {
+			ret = append(ret, occurrence{i, i + len(form)})
+		}
+	}
+	sortOccurrences(ret)
+	return ret
+}
+
+// containsAlias returns true if the given line contains an alias, in either normalization form
+func (d Delimiters) containsAlias(line, alias string) bool {
+	for _, form := range normalForms(alias) {
+		if d.foldAlias(alias) && indexFold(line, form) >= 0 || !d.foldAlias(alias) && strings.Contains(line, form) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d Delimiters) foldAlias(alias string) bool {
+	return d.CaseInsensitive || d.CaseInsensitiveAliases[alias]
+}
+
+// indexes returns the byte offset of each non-overlapping occurrence of s in line, optionally ignoring case
+func indexes(line, s string, foldCase bool) []int {
+	if s == "" {
+		return nil
+	}
+	index := strings.Index
+	if foldCase {
+		index = indexFold
+	}
+	var ret []int
+	for offset := 0; offset < len(line); {
+		i := index(line[offset:], s)
+		if i < 0 {
+			break
+		}
+		ret = append(ret, offset+i)
+		offset += i + len(s)
+	}
+	return ret
+}
+
+// indexFold returns the byte offset of the first occurrence of s in line ignoring case, or -1 if there is none. Only
+// occurrences with the same length in bytes as s are found, so the few letters whose case differs in length, such as the
+// Kelvin sign and "k", do not match.
+func indexFold(line, s string) int {
+	first := unicode.ToLower(rune(s[0]))
+	for i := 0; i+len(s) <= len(line); i++ {
+		c := line[i]
+		if c < utf8.RuneSelf && s[0] < utf8.RuneSelf && unicode.ToLower(rune(c)) != first {
+			continue
+		}
+		if utf8.RuneStart(c) && strings.EqualFold(line[i:i+len(s)], s) {
+			return i
+		}
+	}
+	return -1
+}
+
+func sortOccurrences(o []occurrence) {
+	if len(o) > 1 {
+		sort.Slice(o, func(i, j int) bool {
+			return o[i].start < o[j].start
+		})
+	}
+}
+
+// normalFormsCache holds the normalization forms of flag keys and aliases containing non-ASCII characters, which are
+// matched against every line searched
+var normalFormsCache sync.Map
+
+// normalForms returns s, followed by its composed (NFC) and decomposed (NFD) Unicode normalization forms if they differ
+// from s. Accented characters may be encoded either way, e.g. "é" as a single character, or as "e" followed by a combining
+// accent, depending on the editor or operating system which wrote a file, so flag keys and aliases are matched in either
+// form.
+func normalForms(s string) []string {
+	if isASCII(s) {
+		return []string{s}
+	}
+	if forms, ok := normalFormsCache.Load(s); ok {
+		return forms.([]string)
+	}
+	forms := []string{s}
+	for _, form := range []norm.Form{norm.NFC, norm.NFD} {
+		if f := form.String(s); f != s && (len(forms) == 1 || f != forms[1]) {
+			forms = append(forms, f)
+		}
+	}
+	normalFormsCache.Store(s, forms)
+	return forms
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// equalKeys returns true if two flag keys are equal, in either Unicode normalization form
+func equalKeys(a, b string) bool {
+	return a == b || !isASCII(a) && !isASCII(b) && norm.NFC.String(a) == norm.NFC.String(b)
+}
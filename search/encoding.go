@@ -0,0 +1,56 @@
+package search
+
+import (
+	"bytes"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/tools/godoc/util"
+)
+
+var (
+	utf8BOM    = []byte{0xEF, 0xBB, 0xBF}
+	utf16LEBOM = []byte{0xFF, 0xFE}
+	utf16BEBOM = []byte{0xFE, 0xFF}
+)
+
+// All text is transcoded to UTF-8 when it is read. Line numbers are 1-based, and lengths and offsets within a line are
+// measured in characters (Unicode code points), unless LineLengthBytes is configured for truncating long lines.
+
+// LineLengthUnit determines how the length of a line is measured when truncating long lines
+type LineLengthUnit string
+
+const (
+	// LineLengthCharacters measures lines in Unicode code points
+	LineLengthCharacters LineLengthUnit = "characters"
+	// LineLengthBytes measures lines in UTF-8 encoded bytes. Lines are truncated at the last complete character within the limit.
+	LineLengthBytes LineLengthUnit = "bytes"
+)
+
+// decodeText detects the encoding of a file and returns its contents transcoded to UTF-8. UTF-8, UTF-16 with a
+// byte order mark, and Windows-1252 (a superset of Latin-1) are supported. Returns false if the contents are not text.
+func decodeText(data []byte) (string, bool) {
+	var decoded []byte
+	var err error
+	switch {
+	case bytes.HasPrefix(data, utf8BOM):
+		decoded = data[len(utf8BOM):]
+	case bytes.HasPrefix(data, utf16LEBOM):
+		decoded, err = unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM).NewDecoder().Bytes(data)
+	case bytes.HasPrefix(data, utf16BEBOM):
+		decoded, err = unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM).NewDecoder().Bytes(data)
+	case utf8.Valid(data):
+		decoded = data
+	default:
+		// Binary files commonly contain null bytes, which are never present in Windows-1252 text
+		if bytes.IndexByte(data, 0) >= 0 {
+			return "", false
+		}
+		decoded, err = charmap.Windows1252.NewDecoder().Bytes(data)
+	}
+	if err != nil || !util.IsText(decoded) {
+		return "", false
+	}
+	return string(decoded), true
+}
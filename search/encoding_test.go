@@ -0,0 +1,102 @@
+package search
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_decodeText(t *testing.T) {
+	specs := []struct {
+		name     string
+		data     []byte
+		expected string
+		ok       bool
+	}{
+		{"utf-8", []byte("flag-key ✓"), "flag-key ✓", true},
+		{"utf-8 with bom", []byte("\xEF\xBB\xBFflag-key"), "flag-key", true},
+		{"utf-16 le", []byte("\xFF\xFEf\x00l\x00a\x00g\x00"), "flag", true},
+		{"utf-16 be", []byte("\xFE\xFF\x00f\x00l\x00a\x00g"), "flag", true},
+		{"windows-1252", []byte("caf\xE9 'flag-key'"), "café 'flag-key'", true},
+		{"binary", []byte("\x00\x01\x02\xFF"), "", false},
+	}
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := decodeText(tt.data)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func Test_splitLines(t *testing.T) {
+	assert.Equal(t, []string{"a", "b", ""}, splitLines("a\r\nb\r\n\n"))
+	assert.Nil(t, splitLines(""))
+}
+
+func Test_truncateLine(t *testing.T) {
+	cjk := strings.Repeat("旗", 300)
+	emoji := strings.Repeat("🚩", maxLineLength+1)
+	specs := []struct {
+		name string
+		line string
+		unit LineLengthUnit
+		want string
+	}{
+		{name: "short ascii", line: "flag", unit: LineLengthCharacters, want: "flag"},
+		{name: "long ascii", line: strings.Repeat("a", maxLineLength+1), unit: LineLengthCharacters, want: strings.Repeat("a", maxLineLength) + "…"},
+		{name: "cjk longer than limit in bytes but not characters", line: cjk, unit: LineLengthCharacters, want: cjk},
+		{name: "cjk truncated by bytes", line: cjk, unit: LineLengthBytes, want: strings.Repeat("旗", maxLineLength/3) + "…"},
+		{name: "emoji truncated by characters", line: emoji, unit: LineLengthCharacters, want: strings.Repeat("🚩", maxLineLength) + "…"},
+		{name: "emoji truncated by bytes", line: emoji, unit: LineLengthBytes, want: strings.Repeat("🚩", maxLineLength/4) + "…"},
+		{name: "combining accent kept with its character", line: strings.Repeat("a", maxLineLength-1) + "e\u0301e", unit: LineLengthCharacters, want: strings.Repeat("a", maxLineLength-1) + "…"},
+	}
+
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, truncateLine(tt.line, tt.unit))
+		})
+	}
+}
+
+func Test_truncateLine_properties(t *testing.T) {
+	alphabet := []rune("a-_.旗🚩é́")
+	gen := func(values []reflect.Value, r *rand.Rand) {
+		runes := make([]rune, r.Intn(3*maxLineLength))
+		for i := range runes {
+			runes[i] = alphabet[r.Intn(len(alphabet))]
+		}
+		values[0] = reflect.ValueOf(string(runes))
+	}
+
+	for _, unit := range []LineLengthUnit{LineLengthCharacters, LineLengthBytes} {
+		unit := unit
+		t.Run(string(unit), func(t *testing.T) {
+			property := func(line string) bool {
+				got := truncateLine(line, unit)
+				if !utf8.ValidString(got) {
+					return false
+				}
+				if got == line {
+					return length(line, unit) <= maxLineLength
+				}
+				truncated := strings.TrimSuffix(got, "…")
+				return strings.HasPrefix(line, truncated) && length(truncated, unit) <= maxLineLength
+			}
+			require.NoError(t, quick.Check(property, &quick.Config{MaxCount: 500, Values: gen}))
+		})
+	}
+}
+
+func length(s string, unit LineLengthUnit) int {
+	if unit == LineLengthBytes {
+		return len(s)
+	}
+	return utf8.RuneCountInString(s)
+}
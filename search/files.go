@@ -1,17 +1,19 @@
 package search
 
 import (
-	"bufio"
 	"context"
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/monochromegane/go-gitignore"
-	"golang.org/x/tools/godoc/util"
 
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
 	"github.com/launchdarkly/ld-find-code-refs/internal/validation"
+	"github.com/launchdarkly/ld-find-code-refs/internal/warnings"
 )
 
 type ignore struct {
@@ -41,36 +43,77 @@ func (m ignore) Match(path string, isDir bool) bool {
 	return false
 }
 
+var errNotText = errors.New("file is not text, or uses an unsupported encoding")
+
+// readFileLines reads the lines of a text file, transcoded to UTF-8
 func readFileLines(path string) ([]string, error) {
 	if !validation.FileExists(path) {
 		return nil, errors.New("file does not exist")
 	}
 
 	/* #nosec */
-	file, err := os.Open(path)
+	data, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	scanner.Split(bufio.ScanLines)
-	var lines []string
+	text, ok := decodeText(data)
+	if !ok {
+		return nil, errNotText
+	}
+	return splitLines(text), nil
+}
 
-	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
+// splitLines splits text into lines, stripping any carriage returns at the end of each line
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
 	}
+	return lines
+}
 
-	return lines, nil
+// SymlinkPolicy determines how symbolic links are handled while searching for references
+type SymlinkPolicy string
+
+const (
+	// SymlinkSkip ignores symbolic links
+	SymlinkSkip SymlinkPolicy = "skip"
+	// SymlinkFollow searches the targets of symbolic links as if they were located at the path of the link
+	SymlinkFollow SymlinkPolicy = "follow"
+	// SymlinkError fails the search when a symbolic link is encountered
+	SymlinkError SymlinkPolicy = "error"
+)
+
+var ignoreFiles = []string{".gitignore", ".ignore", ".ldignore"}
+
+// isHiddenPath returns true if any element of a relative path is a dotfile
+func isHiddenPath(path string) bool {
+	for _, element := range strings.Split(filepath.ToSlash(path), "/") {
+		if strings.HasPrefix(element, ".") {
+			return true
+		}
+	}
+	return false
 }
 
-func readFiles(ctx context.Context, files chan<- file, workspace string) error {
+// readFiles walks the workspace, writing the contents of each text file to files. Files larger than the maxFileSize
+// option are skipped, unless it is 0. If the gitAttributes option is set, files excluded by .gitattributes files are
+// skipped. If the sample option is set, only files in the sample are read.
+func readFiles(ctx context.Context, files chan<- file, opts Options) error {
 	defer close(files)
-	ignoreFiles := []string{".gitignore", ".ignore", ".ldignore"}
-	allIgnores := newIgnore(workspace, ignoreFiles)
-	workspace = filepath.ToSlash(workspace)
-
-	readFile := func(path string, info os.FileInfo, err error) error {
+	allIgnores := newIgnore(opts.Workspace, ignoreFiles)
+	workspace := filepath.ToSlash(opts.Workspace)
+	symlinks, useGitAttributes, sample := opts.Symlinks, opts.GitAttributes, opts.Sample
+	var attributes gitAttributes
+	// real paths of followed directories, to prevent following symlink cycles
+	visitedDirs := map[string]bool{workspace: true}
+
+	var readFile func(path string, info os.FileInfo, err error) error
+	readFile = func(path string, info os.FileInfo, err error) error {
 		if err != nil || ctx.Err() != nil {
 			// global context cancelled, don't read any more files
 			return nil
@@ -78,6 +121,10 @@ func readFiles(ctx context.Context, files chan<- file, workspace string) error {
 
 		isDir := info.IsDir()
 		path = filepath.ToSlash(path)
+		relPath := strings.TrimPrefix(path, workspace+"/")
+		if path == workspace {
+			relPath = ""
+		}
 
 		// Skip directories, hidden files, and ignored files
 		if strings.HasPrefix(info.Name(), ".") || allIgnores.Match(path, isDir) {
@@ -85,23 +132,94 @@ func readFiles(ctx context.Context, files chan<- file, workspace string) error {
 				return filepath.SkipDir
 			}
 			return nil
+		} else if info.Mode()&os.ModeSymlink != 0 {
+			switch symlinks {
+			case SymlinkError:
+				return fmt.Errorf("found symbolic link at %s, set the symlinks option to 'skip' or 'follow' to search repositories containing symbolic links", path)
+			case SymlinkFollow:
+				return followSymlink(path, visitedDirs, readFile)
+			}
+			return nil
+		} else if isDir {
+			if useGitAttributes {
+				attributes.read(workspace, relPath)
+			}
+			return nil
 		} else if !info.Mode().IsRegular() {
 			return nil
+		} else if useGitAttributes && attributes.excludes(relPath) {
+			log.Debug.Printf("skipping %s: excluded by .gitattributes", relPath)
+			return nil
+		} else if ExceedsMaxFileSize(relPath, info.Size(), opts.MaxFileSize, opts.Warnings) {
+			return nil
+		} else if !sample.include(relPath) {
+			return nil
 		}
 
+		waitForLoad(ctx)
 		lines, err := readFileLines(path)
-		if err != nil {
-			return err
-		}
-
-		// only read text files
-		if !util.IsText([]byte(strings.Join(lines, "\n"))) {
+		throttleRead(info.Size())
+		if err == errNotText {
+			log.Debug.Printf("skipping %s: %s", path, err)
 			return nil
+		} else if err != nil {
+			return err
 		}
 
-		files <- file{path: strings.TrimPrefix(path, workspace+"/"), lines: lines}
+		sample.searched()
+		files <- file{path: relPath, lines: lines}
 		return nil
 	}
 
 	return filepath.Walk(workspace, readFile)
 }
+
+// ExceedsMaxFileSize adds a warning if a file is larger than maxFileSize bytes, and should not be searched. Files of
+// any size are searched if maxFileSize is 0.
+func ExceedsMaxFileSize(path string, size, maxFileSize int64, warn *warnings.Collector) bool {
+	if maxFileSize <= 0 || size <= maxFileSize {
+		return false
+	}
+	warn.Add(warnings.FileTooLarge, path, "skipping %s: file size (%d KB) exceeds maxFileSizeKb (%d KB)", path, size/1024, maxFileSize/1024)
+	return true
+}
+
+// followSymlink calls walkFn for the target of a symbolic link, or walks the target if it is a directory.
+// Paths passed to walkFn are rewritten to be located under the path of the symbolic link.
+func followSymlink(path string, visitedDirs map[string]bool, walkFn filepath.WalkFunc) error {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		// broken links are ignored
+		return nil
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return nil
+	}
+	if !info.IsDir() {
+		return walkFn(path, renamedFileInfo{info, filepath.Base(path)}, nil)
+	}
+
+	target = filepath.ToSlash(target)
+	if visitedDirs[target] {
+		return nil
+	}
+	visitedDirs[target] = true
+	return filepath.Walk(target, func(p string, info os.FileInfo, err error) error {
+		linkedPath := path + strings.TrimPrefix(filepath.ToSlash(p), target)
+		if p == target && info != nil {
+			info = renamedFileInfo{info, filepath.Base(path)}
+		}
+		return walkFn(linkedPath, info, err)
+	})
+}
+
+// renamedFileInfo reports the name of a symbolic link in place of the name of its target
+type renamedFileInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (r renamedFileInfo) Name() string {
+	return r.name
+}
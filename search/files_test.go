@@ -2,15 +2,21 @@ package search
 
 import (
 	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/warnings"
 )
 
 func Test_readFiles(t *testing.T) {
 	files := make(chan file, 8)
-	err := readFiles(context.Background(), files, "testdata")
+	err := readFiles(context.Background(), files, Options{Workspace: "testdata"})
 	require.NoError(t, err)
 	got := []file{}
 	for file := range files {
@@ -30,3 +36,68 @@ func Test_readFiles(t *testing.T) {
 	}
 	assert.Len(t, got, 3, "Expected 3 valid files to have been found")
 }
+
+func Test_readFiles_symlinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "symlinks")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	dir, err = filepath.EvalSymlinks(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "dir"), 0700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "file"), []byte("file"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "dir", "nested"), []byte("nested"), 0600))
+	require.NoError(t, os.Symlink(filepath.Join(dir, "file"), filepath.Join(dir, "fileLink")))
+	require.NoError(t, os.Symlink(filepath.Join(dir, "dir"), filepath.Join(dir, "dirLink")))
+	// a cycle should not be followed
+	require.NoError(t, os.Symlink(dir, filepath.Join(dir, "dir", "cycle")))
+
+	specs := []struct {
+		policy   SymlinkPolicy
+		expected []string
+		wantErr  bool
+	}{
+		{SymlinkSkip, []string{"dir/nested", "file"}, false},
+		{SymlinkFollow, []string{"dir/nested", "dirLink/nested", "file", "fileLink"}, false},
+		{SymlinkError, nil, true},
+	}
+	for _, tt := range specs {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			files := make(chan file, 8)
+			err := readFiles(context.Background(), files, Options{Workspace: dir, Symlinks: tt.policy})
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			got := []string{}
+			for f := range files {
+				got = append(got, f.path)
+			}
+			assert.ElementsMatch(t, tt.expected, got)
+		})
+	}
+}
+
+func Test_readFiles_maxFileSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "maxFileSize")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	dir, err = filepath.EvalSymlinks(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "small"), []byte("small"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "large"), []byte(strings.Repeat("large\n", 512)), 0600))
+
+	files := make(chan file, 8)
+	warn := &warnings.Collector{}
+	require.NoError(t, readFiles(context.Background(), files, Options{Workspace: dir, MaxFileSize: 1024, Warnings: warn}))
+	got := []string{}
+	for f := range files {
+		got = append(got, f.path)
+	}
+	assert.Equal(t, []string{"small"}, got)
+	require.Len(t, warn.Warnings(), 1)
+	assert.Equal(t, warnings.SkippedFile, warn.Warnings()[0].Category)
+	assert.Equal(t, "large", warn.Warnings()[0].Path)
+}
@@ -0,0 +1,153 @@
+package search
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const gitAttributesFile = ".gitattributes"
+
+// excludingAttributes are the git attributes which exclude a file from searches. linguist-generated marks generated code,
+// and export-ignore marks files which are not included in archives of the repository.
+var excludingAttributes = []string{"linguist-generated", "export-ignore"}
+
+// gitAttributes matches files excluded from searches by .gitattributes files. As in git, when more than one line matches
+// a file, later lines override earlier lines, and lines in files in subdirectories override lines in their parents.
+type gitAttributes struct {
+	rules []attributeRule
+}
+
+type attributeRule struct {
+	// dir is the directory containing the .gitattributes file, relative to the workspace
+	dir string
+	// base is true if the pattern does not contain a slash, and is matched against file names at any depth
+	base    bool
+	pattern string
+	glob    *regexp.Regexp
+	// states of the excluding attributes included in the rule, true if the attribute is set
+	states map[string]bool
+}
+
+// read parses the .gitattributes file in dir, relative to the workspace, if one exists
+func (a *gitAttributes) read(workspace, dir string) {
+	/* #nosec */
+	data, err := ioutil.ReadFile(filepath.Join(workspace, dir, gitAttributesFile))
+	if err != nil {
+		return
+	}
+	a.parse(dir, data)
+}
+
+// parse parses the contents of a .gitattributes file in dir, relative to the workspace. Macro definitions and quoted
+// patterns are not supported, and are ignored.
+func (a *gitAttributes) parse(dir string, data []byte) {
+	dir = strings.Trim(filepath.ToSlash(dir), "/")
+	if dir == "." {
+		dir = ""
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "[attr]") || strings.HasPrefix(fields[0], `"`) {
+			continue
+		}
+		states := map[string]bool{}
+		for _, attr := range fields[1:] {
+			name, set := parseAttribute(attr)
+			for _, excluding := range excludingAttributes {
+				if name == excluding {
+					states[name] = set
+				}
+			}
+		}
+		if len(states) == 0 {
+			continue
+		}
+		pattern := fields[0]
+		rule := attributeRule{dir: dir, base: !strings.Contains(pattern, "/"), pattern: strings.TrimPrefix(pattern, "/"), states: states}
+		if strings.Contains(pattern, "**") {
+			rule.glob = globToRegexp(rule.pattern)
+		}
+		a.rules = append(a.rules, rule)
+	}
+}
+
+// parseAttribute parses an attribute of a .gitattributes line, returning its name and whether it is set. Unset (`-attr`)
+// and unspecified (`!attr`) attributes both override earlier lines which set the attribute.
+func parseAttribute(attr string) (name string, set bool) {
+	if strings.HasPrefix(attr, "-") || strings.HasPrefix(attr, "!") {
+		return attr[1:], false
+	}
+	if i := strings.Index(attr, "="); i >= 0 {
+		value := attr[i+1:]
+		return attr[:i], value != "false" && value != "0"
+	}
+	return attr, true
+}
+
+// excludes returns true if a file, relative to the workspace, is marked with an excluding attribute
+func (a gitAttributes) excludes(file string) bool {
+	file = filepath.ToSlash(file)
+	states := map[string]bool{}
+	for _, rule := range a.rules {
+		if !rule.matches(file) {
+			continue
+		}
+		for name, state := range rule.states {
+			states[name] = state
+		}
+	}
+	for _, state := range states {
+		if state {
+			return true
+		}
+	}
+	return false
+}
+
+func (r attributeRule) matches(file string) bool {
+	if r.dir != "" {
+		if !strings.HasPrefix(file, r.dir+"/") {
+			return false
+		}
+		file = strings.TrimPrefix(file, r.dir+"/")
+	}
+	if r.base {
+		ok, _ := path.Match(r.pattern, path.Base(file))
+		return ok
+	}
+	if r.glob != nil {
+		return r.glob.MatchString(file)
+	}
+	ok, _ := path.Match(r.pattern, file)
+	return ok
+}
+
+// contentsGitAttributes reads the .gitattributes file at the root of the workspace, and any .gitattributes files in contents
+func contentsGitAttributes(workspace string, contents map[string][]byte) gitAttributes {
+	var attributes gitAttributes
+	attributes.read(workspace, "")
+	dirs := []string{}
+	for file := range contents {
+		if path.Base(filepath.ToSlash(file)) == gitAttributesFile && path.Dir(filepath.ToSlash(file)) != "." {
+			dirs = append(dirs, path.Dir(filepath.ToSlash(file)))
+		}
+	}
+	// parent directories are parsed before their children, so children override their parents
+	sort.Slice(dirs, func(i, j int) bool {
+		if di, dj := strings.Count(dirs[i], "/"), strings.Count(dirs[j], "/"); di != dj {
+			return di < dj
+		}
+		return dirs[i] < dirs[j]
+	})
+	for _, dir := range dirs {
+		attributes.parse(dir, contents[path.Join(dir, gitAttributesFile)])
+	}
+	return attributes
+}
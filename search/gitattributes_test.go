@@ -0,0 +1,108 @@
+package search
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_gitAttributes_excludes(t *testing.T) {
+	var attributes gitAttributes
+	attributes.parse("", []byte(`# generated code
+*.pb.go linguist-generated
+/schema.graphql export-ignore
+gen/** linguist-generated=true
+gen/keep.go -linguist-generated
+docs/*.md text export-ignore=false
+[attr]binary -diff -merge -text
+vendor/** text
+`))
+	attributes.parse("api", []byte(`*.go linguist-generated
+client.go !linguist-generated
+`))
+
+	specs := []struct {
+		name     string
+		file     string
+		expected bool
+	}{
+		{name: "file name pattern", file: "service.pb.go", expected: true},
+		{name: "file name pattern in subdirectory", file: "internal/proto/service.pb.go", expected: true},
+		{name: "anchored pattern", file: "schema.graphql", expected: true},
+		{name: "anchored pattern in subdirectory", file: "nested/schema.graphql", expected: false},
+		{name: "double star pattern", file: "gen/a/b/models.ts", expected: true},
+		{name: "unset attribute overrides earlier line", file: "gen/keep.go", expected: false},
+		{name: "false attribute", file: "docs/README.md", expected: false},
+		{name: "unrelated attributes", file: "vendor/lib.go", expected: false},
+		{name: "unmatched file", file: "main.go", expected: false},
+		{name: "nested attributes file", file: "api/server.go", expected: true},
+		{name: "nested attributes file overrides earlier line", file: "api/client.go", expected: false},
+		{name: "nested attributes file does not match parent", file: "server.go", expected: false},
+	}
+
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, attributes.excludes(tt.file))
+		})
+	}
+}
+
+func Test_readFiles_gitAttributes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitAttributes")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	write := func(name, data string) {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+		require.NoError(t, ioutil.WriteFile(path, []byte(data), 0600))
+	}
+	write(".gitattributes", "*.pb.go linguist-generated\n")
+	write("main.go", "main")
+	write("service.pb.go", "generated")
+	write("graphql/.gitattributes", "generated.ts export-ignore\n")
+	write("graphql/generated.ts", "generated")
+	write("graphql/schema.ts", "schema")
+
+	specs := []struct {
+		name             string
+		useGitAttributes bool
+		expected         []string
+	}{
+		{name: "respects attributes", useGitAttributes: true, expected: []string{"graphql/schema.ts", "main.go"}},
+		{name: "ignores attributes", useGitAttributes: false, expected: []string{"graphql/generated.ts", "graphql/schema.ts", "main.go", "service.pb.go"}},
+	}
+
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			files := make(chan file, 8)
+			require.NoError(t, readFiles(context.Background(), files, Options{Workspace: dir, GitAttributes: tt.useGitAttributes}))
+			got := []string{}
+			for f := range files {
+				got = append(got, f.path)
+			}
+			sort.Strings(got)
+			assert.Equal(t, tt.expected, got)
+
+			contents := map[string][]byte{}
+			for _, path := range []string{"main.go", "service.pb.go", "graphql/.gitattributes", "graphql/generated.ts", "graphql/schema.ts"} {
+				data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(path)))
+				require.NoError(t, err)
+				contents[path] = data
+			}
+			refs := SearchContents(Options{ProjKey: "default", Workspace: dir, Aliases: map[string][]string{"main": {}, "schema": {}, "generated": {}}, LineLengthUnit: LineLengthCharacters, GitAttributes: tt.useGitAttributes}, contents)
+			got = []string{}
+			for _, ref := range refs {
+				got = append(got, ref.Path)
+			}
+			sort.Strings(got)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package search
+
+import (
+	"context"
+	"io/ioutil"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+)
+
+// Limits bounds the resources used while searching, so a scan does not starve other processes on a shared build agent or
+// developer machine. Limits apply to every search in the process, so repositories scanned concurrently share them.
+type Limits struct {
+	// Concurrency is the maximum number of files searched at once. If 0, the number of files is not limited.
+	Concurrency int
+	// ReadBytesPerSecond is the maximum average rate files are read at. If 0, reads are not throttled.
+	ReadBytesPerSecond int64
+	// Adaptive pauses reading files while the system load average exceeds the number of CPUs. Only supported on Linux.
+	Adaptive bool
+}
+
+const (
+	// loadCheckInterval is how often the system load average is read. Linux updates it every 5 seconds.
+	loadCheckInterval = time.Second
+	loadAvgPath       = "/proc/loadavg"
+)
+
+var (
+	// fileSlots is a semaphore of the files which may be searched at once. If nil, the number of files is not limited.
+	fileSlots chan struct{}
+	readLimit *rateLimiter
+	load      *loadMonitor
+)
+
+// SetLimits sets the limits of the resources used by searches. It must not be called while searching.
+func SetLimits(limits Limits) {
+	fileSlots = nil
+	if limits.Concurrency > 0 {
+		fileSlots = make(chan struct{}, limits.Concurrency)
+	}
+	readLimit = nil
+	if limits.ReadBytesPerSecond > 0 {
+		readLimit = &rateLimiter{bytesPerSecond: limits.ReadBytesPerSecond}
+	}
+	load = nil
+	if limits.Adaptive {
+		if _, ok := systemLoad(); ok {
+			load = &loadMonitor{maxLoad: float64(runtime.NumCPU())}
+		} else {
+			log.Warning.Printf("the system load average is not available on %s, searching will not back off when load is high", runtime.GOOS)
+		}
+	}
+}
+
+// acquireFileSlot waits until another file may be searched, and returns a function releasing the slot
+func acquireFileSlot() func() {
+	slots := fileSlots
+	if slots == nil {
+		return func() {}
+	}
+	slots <- struct{}{}
+	return func() { <-slots }
+}
+
+// throttleRead waits after reading a file of size bytes, until reads are within the read limit
+func throttleRead(size int64) {
+	if readLimit != nil {
+		readLimit.wait(size)
+	}
+}
+
+// waitForLoad waits while the system load is high, or until ctx is done
+func waitForLoad(ctx context.Context) {
+	if load != nil {
+		load.wait(ctx)
+	}
+}
+
+// rateLimiter limits the average rate of reads, by delaying each read until the time the previous reads would take at
+// the limited rate
+type rateLimiter struct {
+	mu             sync.Mutex
+	bytesPerSecond int64
+	next           time.Time
+}
+
+func (r *rateLimiter) reserve(size int64, now time.Time) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.next.Before(now) {
+		r.next = now
+	}
+	r.next = r.next.Add(time.Duration(size) * time.Second / time.Duration(r.bytesPerSecond))
+	return r.next.Sub(now)
+}
+
+func (r *rateLimiter) wait(size int64) {
+	time.Sleep(r.reserve(size, time.Now()))
+}
+
+// loadMonitor tracks whether the system load average is high
+type loadMonitor struct {
+	mu      sync.Mutex
+	maxLoad float64
+	checked time.Time
+	high    bool
+}
+
+func (m *loadMonitor) isHigh() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if time.Since(m.checked) < loadCheckInterval {
+		return m.high
+	}
+	m.checked = time.Now()
+	current, ok := systemLoad()
+	if high := ok && current > m.maxLoad; high != m.high {
+		m.high = high
+		if high {
+			log.Info.Printf("system load average %.2f exceeds %.0f CPUs, pausing search until load decreases", current, m.maxLoad)
+		} else {
+			log.Info.Printf("system load average decreased to %.2f, resuming search", current)
+		}
+	}
+	return m.high
+}
+
+func (m *loadMonitor) wait(ctx context.Context) {
+	for m.isHigh() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(loadCheckInterval):
+		}
+	}
+}
+
+// systemLoad returns the one minute system load average
+func systemLoad() (float64, bool) {
+	data, err := ioutil.ReadFile(loadAvgPath)
+	if err != nil {
+		return 0, false
+	}
+	return parseLoadAvg(string(data))
+}
+
+func parseLoadAvg(data string) (float64, bool) {
+	fields := strings.Fields(data)
+	if len(fields) == 0 {
+		return 0, false
+	}
+	load, err := strconv.ParseFloat(fields[0], 64)
+	return load, err == nil
+}
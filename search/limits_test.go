@@ -0,0 +1,57 @@
+package search
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := rateLimiter{bytesPerSecond: 1000}
+	now := time.Now()
+	assert.Equal(t, 500*time.Millisecond, limiter.reserve(500, now))
+	assert.Equal(t, 2500*time.Millisecond, limiter.reserve(2000, now), "reads wait for previous reads")
+	assert.Equal(t, 100*time.Millisecond, limiter.reserve(100, now.Add(time.Minute)), "idle time is not saved up")
+}
+
+func TestParseLoadAvg(t *testing.T) {
+	load, ok := parseLoadAvg("3.25 1.50 0.75 2/345 6789\n")
+	assert.True(t, ok)
+	assert.Equal(t, 3.25, load)
+
+	_, ok = parseLoadAvg("")
+	assert.False(t, ok)
+}
+
+func TestLoadMonitor(t *testing.T) {
+	monitor := loadMonitor{maxLoad: 4, checked: time.Now(), high: true}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	monitor.wait(ctx)
+	assert.True(t, monitor.isHigh(), "load is not read again within loadCheckInterval")
+}
+
+func TestSetLimits(t *testing.T) {
+	SetLimits(Limits{Concurrency: 1, ReadBytesPerSecond: 1 << 30})
+	defer SetLimits(Limits{})
+	require.NotNil(t, readLimit)
+	require.Equal(t, 1, cap(fileSlots))
+
+	got, err := SearchForRefs(context.Background(), Options{ProjKey: "default", Workspace: "testdata", Aliases: aliases, LineLengthUnit: LineLengthCharacters})
+	require.NoError(t, err)
+	assert.Equal(t, []string{testFile.path}, paths(got))
+	assert.Empty(t, fileSlots, "every slot is released")
+}
+
+func paths(refs []ld.ReferenceHunksRep) []string {
+	ret := make([]string, 0, len(refs))
+	for _, r := range refs {
+		ret = append(ret, r.Path)
+	}
+	return ret
+}
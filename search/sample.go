@@ -0,0 +1,59 @@
+package search
+
+import (
+	"hash/fnv"
+	"sync/atomic"
+)
+
+// sampleBuckets is the resolution of sampling, so fractions as small as 0.0001% select files
+const sampleBuckets = 1000000
+
+// Sample selects a deterministic fraction of the files in a workspace to search, to estimate the number of code
+// references in workspaces too large to search in full. Files are selected by a hash of their path relative to the
+// workspace, so searches with the same fraction select the same files, and estimates of successive scans are comparable.
+type Sample struct {
+	Fraction float64
+
+	selected int64
+	skipped  int64
+}
+
+// NewSample returns a sample of the given fraction of files, between 0 and 1
+func NewSample(fraction float64) *Sample {
+	return &Sample{Fraction: fraction}
+}
+
+// Includes returns true if the file at path is in the sample. A nil sample includes every file.
+func (s *Sample) Includes(path string) bool {
+	if s == nil {
+		return true
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(path))
+	return float64(h.Sum64()%sampleBuckets) < s.Fraction*sampleBuckets
+}
+
+// include returns true if the file at path is in the sample, counting the files which are skipped
+func (s *Sample) include(path string) bool {
+	if s.Includes(path) {
+		return true
+	}
+	atomic.AddInt64(&s.skipped, 1)
+	return false
+}
+
+// searched counts a file in the sample which is searched. Files which are not text are not searched, and not counted.
+func (s *Sample) searched() {
+	if s != nil {
+		atomic.AddInt64(&s.selected, 1)
+	}
+}
+
+// Files returns the number of files in the sample which were searched, and the number of files which were not in the
+// sample. Files which are not in the sample are counted whether or not they are text.
+func (s *Sample) Files() (selected, skipped int64) {
+	if s == nil {
+		return 0, 0
+	}
+	return atomic.LoadInt64(&s.selected), atomic.LoadInt64(&s.skipped)
+}
@@ -0,0 +1,44 @@
+package search
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSample_Includes(t *testing.T) {
+	var all *Sample
+	assert.True(t, all.Includes("src/main.go"))
+	assert.True(t, NewSample(1).Includes("src/main.go"))
+
+	sample := NewSample(0.1)
+	included := 0
+	for i := 0; i < 10000; i++ {
+		path := "src/file" + strconv.Itoa(i) + ".go"
+		if sample.Includes(path) {
+			included++
+		}
+		// files are selected deterministically
+		assert.Equal(t, sample.Includes(path), NewSample(0.1).Includes(path))
+		// files in a sample are in every larger sample
+		if sample.Includes(path) {
+			assert.True(t, NewSample(0.2).Includes(path))
+		}
+	}
+	assert.InDelta(t, 1000, included, 150)
+}
+
+func Test_readFiles_sample(t *testing.T) {
+	sample := NewSample(0.000001)
+	files := make(chan file, 8)
+	require.NoError(t, readFiles(context.Background(), files, Options{Workspace: "testdata", Sample: sample}))
+	for range files {
+		assert.Fail(t, "Should not read files which are not in the sample")
+	}
+	selected, skipped := sample.Files()
+	assert.Equal(t, int64(0), selected)
+	assert.Equal(t, int64(4), skipped, "files which are not text are counted when they are not in the sample")
+}
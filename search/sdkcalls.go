@@ -0,0 +1,365 @@
+package search
+
+import (
+	"context"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+)
+
+// SDK APIs whose evaluation calls are recognized
+const (
+	SDKLaunchDarkly = "launchdarkly"
+	SDKOpenFeature  = "openfeature"
+)
+
+// SDKCall is a call to a LaunchDarkly or OpenFeature SDK evaluation method with a literal flag key argument
+type SDKCall struct {
+	Path       string
+	LineNumber int
+	Language   string
+	Method     string
+	FlagKey    string
+	Line       string
+}
+
+// sdkLanguage recognizes SDK evaluation calls in the files of a language. Each pattern captures the name of the method
+// in a "method" group, and the literal flag key in one or more "key" groups.
+type sdkLanguage struct {
+	name       string
+	extensions []string
+	// patterns recognize calls to LaunchDarkly SDKs
+	patterns []*regexp.Regexp
+	// openFeature recognizes calls to OpenFeature SDKs
+	openFeature []*regexp.Regexp
+	// hints are lowercase substrings of which a line must contain at least one to contain a call
+	hints []string
+}
+
+// literal patterns for the flag key argument of an evaluation call. Escaped quotes are not supported, and flag keys
+// may not contain them.
+const (
+	doubleQuoted = `"(?P<key>[^"\\]+)"`
+	singleQuoted = `'(?P<key>[^'\\]+)'`
+	backQuoted   = "`(?P<key>[^`]+)`"
+	anyQuoted    = `(?:` + doubleQuoted + `|` + singleQuoted + `|` + backQuoted + `)`
+	// argument matches a single argument preceding the flag key, e.g. a context
+	argument = `[^,()]+,\s*`
+)
+
+func sdkPatterns(patterns ...string) []*regexp.Regexp {
+	ret := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		ret = append(ret, regexp.MustCompile(p))
+	}
+	return ret
+}
+
+// genericSDKLanguage is used for files in languages without their own patterns. Every SDK names its evaluation methods
+// variation, <type>Variation, or <type>VariationDetail, and most accept the flag key as the first argument.
+// OpenFeature SDKs name their evaluation methods get<type>Value or get<type>Details, in each language's casing.
+var genericSDKLanguage = sdkLanguage{
+	name:     "generic",
+	patterns: sdkPatterns(`\b(?P<method>[a-zA-Z]*[vV]ariation(?:_?[dD]etail)?)\s*\(\s*` + anyQuoted),
+	openFeature: sdkPatterns(
+		`\b(?P<method>[gG]et_?(?:[bB]oolean|[sS]tring|[nN]umber|[iI]nteger|[fF]loat|[dD]ouble|[oO]bject)_?(?:[vV]alue|[dD]etails))\s*\(\s*` + anyQuoted,
+	),
+}
+
+var sdkLanguages = []sdkLanguage{
+	{
+		name:       "javascript",
+		extensions: []string{".js", ".jsx", ".mjs", ".cjs", ".ts", ".tsx", ".mts", ".cts", ".vue", ".svelte"},
+		patterns: sdkPatterns(
+			// client.variation('key', context, false), useBoolVariation('key', false), useLDFlag('key')
+			`\b(?P<method>[a-zA-Z]*[vV]ariation(?:Detail)?|useLDFlag)\s*\(\s*`+anyQuoted,
+			// useFlags()['key'], client.allFlags()['key']
+			`\b(?P<method>useFlags|allFlags)\(\s*\)\s*\[\s*`+anyQuoted+`\s*\]`,
+		),
+		openFeature: sdkPatterns(
+			// client.getBooleanValue('key', false), client.getStringDetails('key', '')
+			`\b(?P<method>get(?:Boolean|String|Number|Object)(?:Value|Details))\s*\(\s*`+anyQuoted,
+			// useFlag('key', false), useBooleanFlagValue('key', false), useSuspenseFlag('key', false)
+			`\b(?P<method>use(?:Boolean|String|Number|Object)?Flag(?:Value|Details)?|useSuspenseFlag)\s*\(\s*`+anyQuoted,
+		),
+	},
+	{
+		name:       "go",
+		extensions: []string{".go"},
+		patterns: sdkPatterns(
+			// client.BoolVariation("key", context, false)
+			`\b(?P<method>[A-Z][a-zA-Z]*Variation(?:Detail)?)\s*\(\s*(?:`+doubleQuoted+`|`+backQuoted+`)`,
+			// client.BoolVariationCtx(ctx, "key", context, false)
+			`\b(?P<method>[A-Z][a-zA-Z]*Variation(?:Detail)?Ctx)\s*\(\s*`+argument+`(?:`+doubleQuoted+`|`+backQuoted+`)`,
+		),
+		openFeature: sdkPatterns(
+			// client.BooleanValue(ctx, "key", false, evalCtx)
+			`\b(?P<method>(?:Boolean|String|Float|Int|Object)Value(?:Details)?)\s*\(\s*` + argument + `(?:` + doubleQuoted + `|` + backQuoted + `)`,
+		),
+	},
+	{
+		name:       "java",
+		extensions: []string{".java", ".kt", ".kts", ".scala", ".groovy"},
+		patterns: sdkPatterns(
+			// client.boolVariation("key", context, false)
+			`\b(?P<method>[a-z][a-zA-Z]*Variation(?:Detail)?)\s*\(\s*` + doubleQuoted,
+		),
+		openFeature: sdkPatterns(
+			// client.getBooleanValue("key", false)
+			`\b(?P<method>get(?:Boolean|String|Integer|Double|Object)(?:Value|Details))\s*\(\s*` + doubleQuoted,
+		),
+	},
+	{
+		name:       "dotnet",
+		extensions: []string{".cs", ".vb", ".fs"},
+		patterns: sdkPatterns(
+			// client.BoolVariation("key", context, false)
+			`\b(?P<method>[A-Z][a-zA-Z]*Variation(?:Detail)?)\s*\(\s*@?` + doubleQuoted,
+		),
+		openFeature: sdkPatterns(
+			// await client.GetBooleanValueAsync("key", false)
+			`\b(?P<method>Get(?:Boolean|String|Integer|Double|Object)(?:Value|Details)Async)\s*\(\s*@?` + doubleQuoted,
+		),
+	},
+	{
+		name:       "python",
+		extensions: []string{".py"},
+		patterns: sdkPatterns(
+			// client.variation("key", context, False)
+			`\b(?P<method>variation(?:_detail)?)\s*\(\s*(?:` + doubleQuoted + `|` + singleQuoted + `)`,
+		),
+		openFeature: sdkPatterns(
+			// client.get_boolean_value("key", False), client.get_boolean_value(flag_key="key", default_value=False)
+			`\b(?P<method>get_(?:boolean|string|integer|float|object)_(?:value|details))\s*\(\s*(?:flag_key\s*=\s*)?(?:` + doubleQuoted + `|` + singleQuoted + `)`,
+		),
+	},
+	{
+		name:       "ruby",
+		extensions: []string{".rb", ".erb"},
+		patterns: sdkPatterns(
+			// client.variation("key", context, false), client.variation "key", context, false
+			`\b(?P<method>variation(?:_detail)?)(?:\s*\(\s*|\s+)(?:` + doubleQuoted + `|` + singleQuoted + `)`,
+		),
+		openFeature: sdkPatterns(
+			// client.fetch_boolean_value(flag_key: "key", default_value: false)
+			`\b(?P<method>fetch_(?:boolean|string|number|integer|float|object)_(?:value|details))(?:\s*\(\s*|\s+)flag_key:\s*(?:` + doubleQuoted + `|` + singleQuoted + `)`,
+		),
+	},
+	{
+		name:       "php",
+		extensions: []string{".php"},
+		patterns: sdkPatterns(
+			// $client->variation('key', $context, false)
+			`->\s*(?P<method>variation(?:Detail)?)\s*\(\s*(?:` + doubleQuoted + `|` + singleQuoted + `)`,
+		),
+		openFeature: sdkPatterns(
+			// $client->getBooleanValue('key', false)
+			`->\s*(?P<method>get(?:Boolean|String|Integer|Float|Object)(?:Value|Details))\s*\(\s*(?:` + doubleQuoted + `|` + singleQuoted + `)`,
+		),
+	},
+	{
+		name:       "swift",
+		extensions: []string{".swift"},
+		patterns: sdkPatterns(
+			// client.boolVariation(forKey: "key", defaultValue: false)
+			`\b(?P<method>[a-z][a-zA-Z]*Variation(?:Detail)?)\s*\(\s*(?:forKey:\s*)?` + doubleQuoted,
+		),
+		openFeature: sdkPatterns(
+			// client.getBooleanValue(key: "key", defaultValue: false)
+			`\b(?P<method>get(?:Boolean|String|Integer|Double|Object)(?:Value|Details))\s*\(\s*(?:key:\s*)?` + doubleQuoted,
+		),
+	},
+	{
+		name:       "objective-c",
+		extensions: []string{".m", ".mm"},
+		patterns: sdkPatterns(
+			// [client boolVariationForKey:@"key" defaultValue:NO]
+			`\b(?P<method>[a-z][a-zA-Z]*Variation(?:Detail)?ForKey):\s*@` + doubleQuoted,
+		),
+	},
+	{
+		name:       "rust",
+		extensions: []string{".rs"},
+		patterns: sdkPatterns(
+			// client.bool_variation(&context, "key", false)
+			`\b(?P<method>[a-z]+_variation(?:_detail)?)\s*\(\s*` + argument + doubleQuoted,
+		),
+		openFeature: sdkPatterns(
+			// client.get_bool_value("key", None, None).await
+			`\b(?P<method>get_(?:bool|string|int|float|struct)_(?:value|details))\s*\(\s*` + doubleQuoted,
+		),
+	},
+	{
+		name:       "c",
+		extensions: []string{".c", ".h", ".cc", ".cpp", ".cxx", ".hpp"},
+		patterns: sdkPatterns(
+			// LDBoolVariation(client, context, "key", false, NULL)
+			`\b(?P<method>LD[A-Z][a-zA-Z]*Variation(?:Detail)?)\s*\(\s*`+argument+argument+doubleQuoted,
+			// client.BoolVariation(context, "key", false)
+			`\b(?P<method>[A-Z][a-zA-Z]*Variation(?:Detail)?)\s*\(\s*`+argument+doubleQuoted,
+		),
+	},
+	{
+		name:       "erlang",
+		extensions: []string{".erl", ".ex", ".exs"},
+		patterns: sdkPatterns(
+			// ldclient:variation(<<"key">>, Context, false), :ldclient.variation("key", context, false)
+			`\bldclient[:.](?P<method>variation(?:_detail)?)\s*\(\s*(?:<<)?` + doubleQuoted,
+		),
+	},
+}
+
+// sdkLanguageFor returns the SDK language of a file, based on its extension, recognizing calls to the given SDK APIs. If
+// no SDK APIs are given, calls to LaunchDarkly SDKs are recognized.
+func sdkLanguageFor(file string, sdks []string) sdkLanguage {
+	ext := strings.ToLower(path.Ext(filepath.ToSlash(file)))
+	lang := genericSDKLanguage
+	for _, l := range sdkLanguages {
+		for _, e := range l.extensions {
+			if ext == e {
+				lang = l
+			}
+		}
+	}
+	if len(sdks) == 0 {
+		sdks = []string{SDKLaunchDarkly}
+	}
+	ret := sdkLanguage{name: lang.name, extensions: lang.extensions}
+	for _, sdk := range sdks {
+		switch sdk {
+		case SDKLaunchDarkly:
+			ret.patterns = append(ret.patterns, lang.patterns...)
+			ret.hints = append(ret.hints, "variation", "flag")
+		case SDKOpenFeature:
+			ret.patterns = append(ret.patterns, lang.openFeature...)
+			ret.hints = append(ret.hints, "value", "details", "flag")
+		}
+	}
+	return ret
+}
+
+// calls returns the SDK evaluation calls in a line
+func (l sdkLanguage) calls(line string) []sdkMatch {
+	lower := strings.ToLower(line)
+	hinted := false
+	for _, hint := range l.hints {
+		if strings.Contains(lower, hint) {
+			hinted = true
+			break
+		}
+	}
+	if !hinted {
+		return nil
+	}
+	ret := []sdkMatch{}
+	for _, p := range l.patterns {
+		for _, match := range p.FindAllStringSubmatchIndex(line, -1) {
+			m := sdkMatch{start: match[0]}
+			for i, name := range p.SubexpNames() {
+				if match[2*i] < 0 {
+					continue
+				}
+				switch name {
+				case "method":
+					m.method = line[match[2*i]:match[2*i+1]]
+				case "key":
+					m.key = line[match[2*i]:match[2*i+1]]
+				}
+			}
+			ret = append(ret, m)
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].start < ret[j].start
+	})
+	return ret
+}
+
+type sdkMatch struct {
+	start  int
+	method string
+	key    string
+}
+
+// sdkCalls returns the SDK evaluation calls in a file
+func (f file) sdkCalls(sdks []string) []SDKCall {
+	lang := sdkLanguageFor(f.path, sdks)
+	ret := []SDKCall{}
+	for i, line := range f.lines {
+		for _, m := range lang.calls(line) {
+			ret = append(ret, SDKCall{Path: f.path, LineNumber: i + 1, Language: lang.name, Method: m.method, FlagKey: m.key, Line: strings.TrimSpace(line)})
+		}
+	}
+	return ret
+}
+
+// FindSDKCalls searches the workspace for calls to evaluation methods of the given SDK APIs with literal flag keys, using
+// the same rules as SearchForRefs to select files. Calls are sorted by path and line number.
+func FindSDKCalls(ctx context.Context, workspace string, symlinks SymlinkPolicy, useGitAttributes bool, maxFileSize int64, sdks []string) ([]SDKCall, error) {
+	files := make(chan file)
+	var err error
+	done := make(chan struct{})
+	go func() {
+		err = readFiles(ctx, files, Options{Workspace: workspace, Symlinks: symlinks, GitAttributes: useGitAttributes, MaxFileSize: maxFileSize})
+		close(done)
+	}()
+
+	ret := []SDKCall{}
+	for f := range files {
+		ret = append(ret, f.sdkCalls(sdks)...)
+	}
+	<-done
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		if ret[i].Path != ret[j].Path {
+			return ret[i].Path < ret[j].Path
+		}
+		return ret[i].LineNumber < ret[j].LineNumber
+	})
+	return ret, nil
+}
+
+// TagSDKCalls records the SDK evaluation method of each hunk which contains a call to one of the given SDK APIs evaluating
+// its flag with a literal flag key, distinguishing these references from plain text matches. Returns the number of hunks tagged.
+func TagSDKCalls(workspace string, refs []ld.ReferenceHunksRep, sdks []string) int {
+	tagged := 0
+	forEachHunk(workspace, refs, func(path string, hunk *ld.HunkRep, lines []string) {
+		lang := sdkLanguageFor(path, sdks)
+		for _, line := range lines {
+			for _, m := range lang.calls(line) {
+				if equalKeys(m.key, hunk.FlagKey) && hunk.SDKCall == "" {
+					hunk.SDKCall = m.method
+					tagged++
+				}
+			}
+		}
+	})
+	return tagged
+}
+
+// forEachHunk calls fn with each hunk and the lines it spans. Lines are read from the workspace, so that lines which
+// were truncated or omitted from the hunk are included, or from the hunk if the file cannot be read, e.g. when the
+// file is excluded by a sparse checkout.
+func forEachHunk(workspace string, refs []ld.ReferenceHunksRep, fn func(path string, hunk *ld.HunkRep, lines []string)) {
+	for _, ref := range refs {
+		lines, err := readFileLines(filepath.Join(workspace, ref.Path))
+		for i := range ref.Hunks {
+			hunk := &ref.Hunks[i]
+			hunkLines := strings.Split(hunk.Lines, "\n")
+			if err == nil {
+				first, last := hunk.StartingLineNumber-1, hunk.StartingLineNumber-1+hunk.NumLines()
+				if first < 0 || last > len(lines) {
+					continue
+				}
+				hunkLines = lines[first:last]
+			}
+			fn(ref.Path, hunk, hunkLines)
+		}
+	}
+}
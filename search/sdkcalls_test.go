@@ -0,0 +1,137 @@
+package search
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+)
+
+func Test_file_sdkCalls(t *testing.T) {
+	specs := []struct {
+		name     string
+		line     string
+		expected []SDKCall
+	}{
+		{name: "javascript", line: `if (client.variation('my-flag', context, false)) {`, expected: []SDKCall{{Method: "variation", FlagKey: "my-flag"}}},
+		{name: "java", line: `boolean on = client.boolVariation("my-flag", context, false);`, expected: []SDKCall{{Method: "boolVariation", FlagKey: "my-flag"}}},
+		{name: "go", line: "on, _ := client.BoolVariationDetail(`my-flag`, context, false)", expected: []SDKCall{{Method: "BoolVariationDetail", FlagKey: "my-flag"}}},
+		{name: "python", line: `detail = client.variation_detail("my-flag", context, False)`, expected: []SDKCall{{Method: "variation_detail", FlagKey: "my-flag"}}},
+		{name: "multiple calls", line: `a = variation("flag-a") && variation("flag-b")`, expected: []SDKCall{{Method: "variation", FlagKey: "flag-a"}, {Method: "variation", FlagKey: "flag-b"}}},
+		{name: "dynamic key", line: `client.variation(flagKey, context, false)`, expected: []SDKCall{}},
+		{name: "unrelated method", line: `deviation("my-flag")`, expected: []SDKCall{}},
+	}
+
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			got := file{path: "file", lines: []string{tt.line}}.sdkCalls(nil)
+			for i := range tt.expected {
+				tt.expected[i].Path, tt.expected[i].LineNumber, tt.expected[i].Language, tt.expected[i].Line = "file", 1, "generic", tt.line
+			}
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func Test_sdkLanguage_calls(t *testing.T) {
+	specs := []struct {
+		path   string
+		line   string
+		method string
+		key    string
+	}{
+		{path: "app.tsx", line: `const { checkout } = useFlags(); const x = useFlags()['my-flag'];`, method: "useFlags", key: "my-flag"},
+		{path: "app.jsx", line: `const on = useBoolVariation("my-flag", false)`, method: "useBoolVariation", key: "my-flag"},
+		{path: "app.vue", line: `const on = useLDFlag('my-flag')`, method: "useLDFlag", key: "my-flag"},
+		{path: "main.go", line: `on, _ := client.BoolVariationCtx(ctx, "my-flag", context, false)`, method: "BoolVariationCtx", key: "my-flag"},
+		{path: "Main.kt", line: `val on = client.boolVariation("my-flag", context, false)`, method: "boolVariation", key: "my-flag"},
+		{path: "Program.cs", line: `var on = client.BoolVariationDetail("my-flag", context, false);`, method: "BoolVariationDetail", key: "my-flag"},
+		{path: "app.rb", line: `on = client.variation "my-flag", context, false`, method: "variation", key: "my-flag"},
+		{path: "index.php", line: `$on = $client->variation('my-flag', $context, false);`, method: "variation", key: "my-flag"},
+		{path: "View.swift", line: `let on = client.boolVariation(forKey: "my-flag", defaultValue: false)`, method: "boolVariation", key: "my-flag"},
+		{path: "View.m", line: `BOOL on = [client boolVariationForKey:@"my-flag" defaultValue:NO];`, method: "boolVariationForKey", key: "my-flag"},
+		{path: "main.rs", line: `let on = client.bool_variation(&context, "my-flag", false);`, method: "bool_variation", key: "my-flag"},
+		{path: "main.c", line: `bool on = LDBoolVariation(client, context, "my-flag", false, NULL);`, method: "LDBoolVariation", key: "my-flag"},
+		{path: "app.erl", line: `On = ldclient:variation(<<"my-flag">>, Context, false),`, method: "variation", key: "my-flag"},
+		// languages with their own patterns don't match calls in other languages' styles
+		{path: "app.py", line: `client.boolVariation("my-flag", context, false)`},
+		{path: "main.go", line: `client.variation("my-flag", context, false)`},
+	}
+
+	for _, tt := range specs {
+		t.Run(tt.path, func(t *testing.T) {
+			calls := sdkLanguageFor(tt.path, nil).calls(tt.line)
+			if tt.key == "" {
+				assert.Empty(t, calls)
+				return
+			}
+			require.Len(t, calls, 1)
+			assert.Equal(t, tt.method, calls[0].method)
+			assert.Equal(t, tt.key, calls[0].key)
+		})
+	}
+}
+
+func TestTagSDKCalls(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sdkCalls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "app.js"), []byte("// my-flag\nclient.variation('my-flag', context, false)\n"), 0600))
+
+	refs := []ld.ReferenceHunksRep{
+		{Path: "app.js", Hunks: []ld.HunkRep{{StartingLineNumber: 1, FlagKey: "my-flag"}, {StartingLineNumber: 2, FlagKey: "my-flag"}, {StartingLineNumber: 2, FlagKey: "other-flag"}}},
+		// files which cannot be read are tagged using the lines of the hunk
+		{Path: "missing.go", Hunks: []ld.HunkRep{{StartingLineNumber: 1, FlagKey: "my-flag", Lines: `client.BoolVariation("my-flag", context, false)`}}},
+	}
+	assert.Equal(t, 2, TagSDKCalls(dir, refs, nil))
+	assert.Equal(t, "", refs[0].Hunks[0].SDKCall)
+	assert.Equal(t, "variation", refs[0].Hunks[1].SDKCall)
+	assert.Equal(t, "", refs[0].Hunks[2].SDKCall)
+	assert.Equal(t, "BoolVariation", refs[1].Hunks[0].SDKCall)
+}
+
+func Test_sdkLanguage_calls_openFeature(t *testing.T) {
+	specs := []struct {
+		path   string
+		line   string
+		method string
+		key    string
+	}{
+		{path: "app.ts", line: `const on = await client.getBooleanValue('my-flag', false);`, method: "getBooleanValue", key: "my-flag"},
+		{path: "app.tsx", line: `const on = useBooleanFlagValue("my-flag", false);`, method: "useBooleanFlagValue", key: "my-flag"},
+		{path: "app.jsx", line: `const { value } = useFlag('my-flag', false);`, method: "useFlag", key: "my-flag"},
+		{path: "main.go", line: `on, _ := client.BooleanValue(ctx, "my-flag", false, evalCtx)`, method: "BooleanValue", key: "my-flag"},
+		{path: "Main.java", line: `Boolean on = client.getBooleanDetails("my-flag", false).getValue();`, method: "getBooleanDetails", key: "my-flag"},
+		{path: "Program.cs", line: `var on = await client.GetBooleanValueAsync("my-flag", false);`, method: "GetBooleanValueAsync", key: "my-flag"},
+		{path: "app.py", line: `on = client.get_boolean_value(flag_key="my-flag", default_value=False)`, method: "get_boolean_value", key: "my-flag"},
+		{path: "app.rb", line: `on = client.fetch_boolean_value(flag_key: 'my-flag', default_value: false)`, method: "fetch_boolean_value", key: "my-flag"},
+		{path: "index.php", line: `$on = $client->getBooleanValue('my-flag', false);`, method: "getBooleanValue", key: "my-flag"},
+		{path: "View.swift", line: `let on = client.getBooleanValue(key: "my-flag", defaultValue: false)`, method: "getBooleanValue", key: "my-flag"},
+		{path: "main.rs", line: `let on = client.get_bool_value("my-flag", None, None).await;`, method: "get_bool_value", key: "my-flag"},
+		{path: "app.dart", line: `final on = await client.getBooleanValue('my-flag', false);`, method: "getBooleanValue", key: "my-flag"},
+		// LaunchDarkly calls are recognized when both SDK APIs are selected
+		{path: "app.js", line: `client.variation('my-flag', context, false)`, method: "variation", key: "my-flag"},
+		{path: "main.go", line: `client.getBooleanValue("my-flag", false)`},
+	}
+
+	for _, tt := range specs {
+		t.Run(tt.path, func(t *testing.T) {
+			calls := sdkLanguageFor(tt.path, []string{SDKLaunchDarkly, SDKOpenFeature}).calls(tt.line)
+			if tt.key == "" {
+				assert.Empty(t, calls)
+				return
+			}
+			require.Len(t, calls, 1)
+			assert.Equal(t, tt.method, calls[0].method)
+			assert.Equal(t, tt.key, calls[0].key)
+		})
+	}
+
+	assert.Empty(t, sdkLanguageFor("app.js", nil).calls(`client.getBooleanValue('my-flag', false)`), "OpenFeature calls are only recognized when selected")
+	assert.Empty(t, sdkLanguageFor("app.js", []string{SDKOpenFeature}).calls(`client.variation('my-flag', context, false)`))
+}
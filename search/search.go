@@ -2,12 +2,18 @@ package search
 
 import (
 	"context"
+	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/launchdarkly/ld-find-code-refs/internal/helpers"
 	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	"github.com/launchdarkly/ld-find-code-refs/internal/tracing"
+	"github.com/launchdarkly/ld-find-code-refs/internal/warnings"
 )
 
 const (
@@ -16,23 +22,40 @@ const (
 	// from taking a very long time to run and b) to prevent the program from
 	// PUTing a massive json payload. These limits will likely be tweaked over
 	// time. The LaunchDarkly backend will also apply limits.
-	maxFileCount     = 10000 // Maximum number of files containing code references
-	maxHunkCount     = 25000 // Maximum number of total code references
-	maxLineCharCount = 500   // Maximum number of characters per line
+	maxFileCount  = 10000 // Maximum number of files containing code references
+	maxHunkCount  = 25000 // Maximum number of total code references
+	maxLineLength = 500   // Maximum length of each line sent, measured in the configured LineLengthUnit
 )
 
 // Truncate lines to prevent sending over massive hunks, e.g. a minified file.
 // NOTE: We may end up truncating a valid flag key reference. We accept this risk
-//       and will handle hunks missing flag key references on the frontend.
-func truncateLine(line string) string {
-	// len(line) returns number of bytes, not num. characters, but it's a close enough
-	// approximation for our purposes
-	if len(line) <= maxLineCharCount {
+// and will handle hunks missing flag key references on the frontend.
+func truncateLine(line string, unit LineLengthUnit) string {
+	if unit == LineLengthBytes {
+		if len(line) <= maxLineLength {
+			return line
+		}
+		// back up to the start of the last complete character, so that multibyte characters are never split, and so that
+		// accents and other combining marks are not separated from the character they modify
+		end := maxLineLength
+		for end > 0 {
+			if r, _ := utf8.DecodeRuneInString(line[end:]); utf8.RuneStart(line[end]) && !unicode.IsMark(r) {
+				break
+			}
+			end--
+		}
+		return line[:end] + "…"
+	}
+	// len(line) is the number of bytes, which is never less than the number of characters
+	if len(line) <= maxLineLength || utf8.RuneCountInString(line) <= maxLineLength {
 		return line
 	}
-	// convert to rune slice so that we don't truncate multibyte unicode characters
 	runes := []rune(line)
-	return string(runes[0:maxLineCharCount]) + "…"
+	end := maxLineLength
+	for end > 0 && unicode.IsMark(runes[end]) {
+		end--
+	}
+	return string(runes[0:end]) + "…"
 }
 
 // MatchDelimiters returns true if the given line contains the flag key surrounded by any delimiters
@@ -60,27 +83,60 @@ type file struct {
 	lines []string
 }
 
-// hunkForLine returns a matching code reference for a given flag key on a line
-func (f file) hunkForLine(projKey, flagKey string, aliases []string, lineNum, ctxLines int, delimiters string) *ld.HunkRep {
-	matchedFlag := false
-	aliasMatches := []string{}
-	line := f.lines[lineNum]
-	// Match flag keys with delimiters
-	if MatchDelimiters(line, flagKey, delimiters) {
-		matchedFlag = true
+// keyMatch is an occurrence of a flag key, or one of its aliases, in a line
+type keyMatch struct {
+	flagKey string
+	// alias is the matched alias, or empty if the flag key was matched
+	alias      string
+	start, end int
+}
+
+// lineMatches returns each occurrence of a flag key or alias in a line. Flag keys must be surrounded by delimiters, and
+// are compared as configured by the delimiters, as are aliases. An
+// occurrence within a longer occurrence of another flag's key or alias is not a match, so that a line referencing
+// my-flag-v2 is only attributed to my-flag-v2, and not also to my-flag.
+func lineMatches(line string, aliases map[string][]string, delimiters Delimiters) []keyMatch {
+	var found []keyMatch
+	for flagKey, flagAliases := range aliases {
+		for _, o := range delimiters.keyOccurrences(line, flagKey) {
+			found = append(found, keyMatch{flagKey: flagKey, start: o.start, end: o.end})
+		}
+		for _, alias := range flagAliases {
+			for _, o := range delimiters.aliasOccurrences(line, alias) {
+				found = append(found, keyMatch{flagKey: flagKey, alias: alias, start: o.start, end: o.end})
+			}
+		}
+	}
+	if len(found) < 2 {
+		return found
 	}
 
-	// Match all aliases for the flag key
-	for _, alias := range aliases {
-		if strings.Contains(line, alias) {
-			aliasMatches = append(aliasMatches, alias)
+	ret := make([]keyMatch, 0, len(found))
+	for _, m := range found {
+		contained := false
+		for _, other := range found {
+			if other.flagKey != m.flagKey && other.start <= m.start && other.end >= m.end && other.end-other.start > m.end-m.start {
+				contained = true
+				break
+			}
+		}
+		if !contained {
+			ret = append(ret, m)
 		}
 	}
+	return ret
+}
 
-	if !matchedFlag && len(aliasMatches) == 0 {
-		return nil
+// column returns the 1-based offset of a byte offset in a line, measured in the given unit
+func column(line string, offset int, unit LineLengthUnit) int {
+	if unit == LineLengthBytes {
+		return offset + 1
 	}
+	return utf8.RuneCountInString(line[:offset]) + 1
+}
 
+// hunkForLine returns a code reference for the matches of a flag key on a line
+func (f file) hunkForLine(projKey, flagKey string, matches []keyMatch, lineNum, ctxLines int, unit LineLengthUnit) ld.HunkRep {
 	startingLineNum := lineNum
 	var hunkLines []string
 	if ctxLines >= 0 {
@@ -96,50 +152,126 @@ func (f file) hunkForLine(projKey, flagKey string, aliases []string, lineNum, ct
 		}
 	}
 
+	// copy lines before truncating, so that the file's lines are still searched in full for other flags
+	truncated := make([]string, len(hunkLines))
 	for i, line := range hunkLines {
-		hunkLines[i] = truncateLine(line)
+		truncated[i] = truncateLine(line, unit)
 	}
 
 	ret := ld.HunkRep{
 		ProjKey:            projKey,
 		FlagKey:            flagKey,
 		StartingLineNumber: startingLineNum + 1,
-		Lines:              strings.Join(hunkLines, "\n"),
+		Lines:              strings.Join(truncated, "\n"),
 		Aliases:            []string{},
+		Matches:            make([]ld.Match, 0, len(matches)),
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].start < matches[j].start
+	})
+	for _, m := range matches {
+		if m.alias != "" {
+			ret.Aliases = append(ret.Aliases, m.alias)
+		}
+		ret.Matches = append(ret.Matches, ld.Match{LineNumber: lineNum + 1, Column: column(f.lines[lineNum], m.start, unit), Alias: m.alias})
 	}
-	ret.Aliases = helpers.Dedupe(append(ret.Aliases, aliasMatches...))
-	return &ret
+	ret.Aliases = helpers.Dedupe(ret.Aliases)
+	return ret
 }
 
-// aggregateHunksForFlag finds all references in a file, and combines matches if their context lines overlap
-func (f file) aggregateHunksForFlag(projKey, flagKey string, flagAliases []string, ctxLines int, delimiters string) []ld.HunkRep {
+// aggregateHunksForFlag creates references for the matches of a flag key on each line, and combines them if their
+// context lines overlap, or are separated by no more than mergeLines lines
+func (f file) aggregateHunksForFlag(projKey, flagKey string, matches map[int][]keyMatch, ctxLines int, unit LineLengthUnit, mergeLines int) []ld.HunkRep {
+	lineNums := make([]int, 0, len(matches))
+	for i := range matches {
+		lineNums = append(lineNums, i)
+	}
+	sort.Ints(lineNums)
+
 	hunksForFlag := []ld.HunkRep{}
-	for i := range f.lines {
-		match := f.hunkForLine(projKey, flagKey, flagAliases, i, ctxLines, delimiters)
-		if match != nil {
-			lastHunkIdx := len(hunksForFlag) - 1
-			// If the previous hunk overlaps or is adjacent to the current hunk, merge them together
-			if lastHunkIdx >= 0 && hunksForFlag[lastHunkIdx].Overlap(*match) >= 0 {
-				hunksForFlag = append(hunksForFlag[:lastHunkIdx], mergeHunks(hunksForFlag[lastHunkIdx], *match)...)
-			} else {
-				hunksForFlag = append(hunksForFlag, *match)
-			}
+	for _, i := range lineNums {
+		match := f.hunkForLine(projKey, flagKey, matches[i], i, ctxLines, unit)
+		lastHunkIdx := len(hunksForFlag) - 1
+		if lastHunkIdx >= 0 && ctxLines >= 0 {
+			f.fillGap(hunksForFlag[lastHunkIdx], &match, mergeLines, unit)
+		}
+		// If the previous hunk overlaps or is adjacent to the current hunk, merge them together
+		if lastHunkIdx >= 0 && hunksForFlag[lastHunkIdx].Overlap(match) >= 0 {
+			hunksForFlag = append(hunksForFlag[:lastHunkIdx], mergeHunks(hunksForFlag[lastHunkIdx], match)...)
+		} else {
+			hunksForFlag = append(hunksForFlag, match)
 		}
 	}
 	return hunksForFlag
 }
 
-func (f file) toHunks(projKey string, aliases map[string][]string, ctxLines int, delimiters string) *ld.ReferenceHunksRep {
-	hunks := []ld.HunkRep{}
-	for flagKey, flagAliases := range aliases {
-		hunks = append(hunks, f.aggregateHunksForFlag(projKey, flagKey, flagAliases, ctxLines, delimiters)...)
+// fillGap extends the start of a hunk to include the lines separating it from the previous hunk, if there are no
+// more than mergeLines of them, so that the hunks will be merged
+func (f file) fillGap(prev ld.HunkRep, h *ld.HunkRep, mergeLines int, unit LineLengthUnit) {
+	gap := -prev.Overlap(*h)
+	if gap <= 0 || gap > mergeLines {
+		return
+	}
+	gapStart := prev.StartingLineNumber - 1 + prev.NumLines()
+	gapLines := make([]string, 0, gap+1)
+	for _, line := range f.lines[gapStart : gapStart+gap] {
+		gapLines = append(gapLines, truncateLine(line, unit))
+	}
+	h.StartingLineNumber -= gap
+	h.Lines = strings.Join(append(gapLines, h.Lines), "\n")
+}
+
+func (f file) toHunks(projKey string, aliases map[string][]string, ctxLines ContextLines, delimiters Delimiters, unit LineLengthUnit, mergeLines int) *ld.ReferenceHunksRep {
+	// matches of each flag key, keyed by line number
+	matchesByFlag := map[string]map[int][]keyMatch{}
+	dataLines := 0
+	for i, line := range f.lines {
+		matches := lineMatches(line, aliases, delimiters)
+		if len(matches) > 0 && delimiters.SkipDataLines && isDataLine(line) {
+			dataLines++
+			continue
+		}
+		for _, m := range matches {
+			if matchesByFlag[m.flagKey] == nil {
+				matchesByFlag[m.flagKey] = map[int][]keyMatch{}
+			}
+			matchesByFlag[m.flagKey][i] = append(matchesByFlag[m.flagKey][i], m)
+		}
+	}
+	if dataLines > 0 {
+		log.Debug.Printf("skipped %d lines of data containing flag keys in %s", dataLines, f.path)
 	}
-	if len(hunks) == 0 {
+	if len(matchesByFlag) == 0 {
 		return nil
 	}
+
+	linesForFlag := ctxLines.forPath(f.path)
+	hunks := []ld.HunkRep{}
+	for flagKey, matches := range matchesByFlag {
+		hunks = append(hunks, f.aggregateHunksForFlag(projKey, flagKey, matches, linesForFlag(flagKey), unit, mergeLines)...)
+	}
 	return &ld.ReferenceHunksRep{Path: f.path, Hunks: hunks}
 }
 
+// warnTruncated adds a warning if any lines included in the file's hunks were truncated
+func (f file) warnTruncated(ref ld.ReferenceHunksRep, unit LineLengthUnit, warn *warnings.Collector) {
+	truncated := map[int]bool{}
+	for _, hunk := range ref.Hunks {
+		if hunk.Lines == "" {
+			continue
+		}
+		start := hunk.StartingLineNumber - 1
+		for i := start; i < start+hunk.NumLines() && i < len(f.lines); i++ {
+			if len(f.lines[i]) > maxLineLength && truncateLine(f.lines[i], unit) != f.lines[i] {
+				truncated[i] = true
+			}
+		}
+	}
+	if len(truncated) > 0 {
+		warn.Add(warnings.LinesTruncated, f.path, "truncated %d lines longer than %d %s in %s", len(truncated), maxLineLength, unit, f.path)
+	}
+}
+
 // mergeHunks combines the lines and aliases of two hunks together for a given file
 // if the hunks do not overlap, returns each hunk separately
 // assumes the startingLineNumber of a is less than b and there is some overlap between the two
@@ -154,25 +286,72 @@ func mergeHunks(a, b ld.HunkRep) []ld.HunkRep {
 	// no overlap
 	if overlap < 0 || len(a.Lines) == 0 && len(b.Lines) == 0 {
 		return []ld.HunkRep{a, b}
-	} else if overlap >= len(bLines) {
-		// subset hunk
-		return []ld.HunkRep{a}
 	}
 
-	combinedLines := append(aLines, bLines[overlap:]...)
-	return []ld.HunkRep{
-		{
-			StartingLineNumber: a.StartingLineNumber,
-			Lines:              strings.Join(combinedLines, "\n"),
-			ProjKey:            a.ProjKey,
-			FlagKey:            a.FlagKey,
-			Aliases:            helpers.Dedupe(append(a.Aliases, b.Aliases...)),
-		},
+	merged := ld.HunkRep{
+		StartingLineNumber: a.StartingLineNumber,
+		Lines:              a.Lines,
+		ProjKey:            a.ProjKey,
+		FlagKey:            a.FlagKey,
+		Aliases:            helpers.Dedupe(append(append([]string{}, a.Aliases...), b.Aliases...)),
+		Matches:            mergeMatches(a.Matches, b.Matches),
+	}
+	// the lines of a subset hunk are already included
+	if overlap < len(bLines) {
+		merged.Lines = strings.Join(append(aLines, bLines[overlap:]...), "\n")
 	}
+	return []ld.HunkRep{merged}
+}
+
+// mergeMatches combines the matches of two hunks, ordered by position
+func mergeMatches(a, b []ld.Match) []ld.Match {
+	if len(a) == 0 && len(b) == 0 {
+		return a
+	}
+	ret := append(append([]ld.Match{}, a...), b...)
+	sort.SliceStable(ret, func(i, j int) bool {
+		if ret[i].LineNumber != ret[j].LineNumber {
+			return ret[i].LineNumber < ret[j].LineNumber
+		}
+		return ret[i].Column < ret[j].Column
+	})
+	return ret
+}
+
+// Options configures a search for code references
+type Options struct {
+	// ProjKey is the key of the project the flags belong to
+	ProjKey string
+	// Workspace is the directory to search. Paths of code references are relative to it.
+	Workspace string
+	// Aliases are the keys of the flags to search for, and the aliases of each flag
+	Aliases        map[string][]string
+	ContextLines   ContextLines
+	Delimiters     Delimiters
+	LineLengthUnit LineLengthUnit
+	// MergeLines is the largest number of lines between hunks of the same flag which are merged into one hunk
+	MergeLines int
+	// Symlinks is the policy for symbolic links in the workspace. If empty, symbolic links are skipped.
+	Symlinks SymlinkPolicy
+	// GitAttributes skips files excluded by .gitattributes files
+	GitAttributes bool
+	// MaxFileSize is the size in bytes of the largest file searched. If 0, files of any size are searched.
+	MaxFileSize int64
+	// Sample limits the search of the workspace to a sample of its files, if set
+	Sample *Sample
+	// Cache reuses the code references found in files with the same contents by earlier searches, if set
+	Cache *ContentCache
+	// Warnings collects the warnings raised by the search, if set
+	Warnings *warnings.Collector
+}
+
+// toHunks returns the code references to flags in a file
+func (o Options) toHunks(f file) *ld.ReferenceHunksRep {
+	return f.toHunks(o.ProjKey, o.Aliases, o.ContextLines, o.Delimiters, o.LineLengthUnit, o.MergeLines)
 }
 
 // processFiles starts goroutines to process files individually. When all files have completed processing, the references channel is closed to signal completion.
-func processFiles(ctx context.Context, files <-chan file, references chan<- ld.ReferenceHunksRep, projKey string, aliases map[string][]string, ctxLines int, delimiters string) {
+func processFiles(ctx context.Context, files <-chan file, references chan<- ld.ReferenceHunksRep, opts Options, spans *directorySpans, cache *contentCacheScope) {
 	defer close(references)
 	w := sync.WaitGroup{}
 	for f := range files {
@@ -181,9 +360,19 @@ func processFiles(ctx context.Context, files <-chan file, references chan<- ld.R
 			continue
 		}
 		w.Add(1)
+		release := acquireFileSlot()
 		go func(f file) {
-			reference := f.toHunks(projKey, aliases, ctxLines, delimiters)
+			spans.start(f.path)
+			reference := cache.toHunks(f, opts)
+			release()
+			hunks := 0
+			if reference != nil {
+				hunks = len(reference.Hunks)
+			}
+			spans.done(f.path, hunks)
+			log.Trace.Printf("searched %s: found %d code references", f.path, hunks)
 			if reference != nil {
+				f.warnTruncated(*reference, opts.LineLengthUnit, opts.Warnings)
 				references <- *reference
 			}
 			w.Done()
@@ -192,39 +381,137 @@ func processFiles(ctx context.Context, files <-chan file, references chan<- ld.R
 	w.Wait()
 }
 
-func SearchForRefs(projKey, workspace string, aliases map[string][]string, ctxLines int, delimiters string) ([]ld.ReferenceHunksRep, error) {
-	ctx, cancel := context.WithCancel(context.Background())
+// SearchContents searches the provided file contents for references, e.g. files which are tracked but not present in the workspace.
+// Paths are relative to the workspace, and are excluded using the same rules as files read from the workspace. The
+// symlinks, sample, and cache options only apply to files read from the workspace.
+func SearchContents(opts Options, contents map[string][]byte) []ld.ReferenceHunksRep {
+	allIgnores := newIgnore(opts.Workspace, ignoreFiles)
+	var attributes gitAttributes
+	if opts.GitAttributes {
+		attributes = contentsGitAttributes(opts.Workspace, contents)
+	}
+	ret := []ld.ReferenceHunksRep{}
+	for path, data := range contents {
+		if isHiddenPath(path) || allIgnores.Match(filepath.ToSlash(filepath.Join(opts.Workspace, path)), false) {
+			continue
+		}
+		if opts.GitAttributes && attributes.excludes(path) {
+			log.Debug.Printf("skipping %s: excluded by .gitattributes", path)
+			continue
+		}
+		if ExceedsMaxFileSize(path, int64(len(data)), opts.MaxFileSize, opts.Warnings) {
+			continue
+		}
+		text, ok := decodeText(data)
+		if !ok {
+			continue
+		}
+		f := file{path: path, lines: splitLines(text)}
+		reference := opts.toHunks(f)
+		if reference != nil {
+			f.warnTruncated(*reference, opts.LineLengthUnit, opts.Warnings)
+			ret = append(ret, *reference)
+		}
+	}
+	sortByPath(ret)
+	return ret
+}
+
+// SearchForRefs searches the workspace for references to flag keys and their aliases. If ctx is cancelled or its deadline
+// is exceeded, searching stops and the references found so far are returned.
+func SearchForRefs(ctx context.Context, opts Options) ([]ld.ReferenceHunksRep, error) {
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 	files := make(chan file)
 	references := make(chan ld.ReferenceHunksRep)
 
+	// the search of each top-level directory is traced if ctx carries a span
+	spans := newDirectorySpans(tracing.SpanFromContext(ctx))
+	defer spans.end()
+
+	// files are only searched if the code references in their contents are not cached by an earlier search
+	cache := newContentCacheScope(opts)
+
 	// Start workers to process files asynchronously as they are written to the files channel
-	go processFiles(ctx, files, references, projKey, aliases, ctxLines, delimiters)
+	go processFiles(ctx, files, references, opts, spans, cache)
+
+	// stop processing files on return, and wait for the workers to finish, so no goroutines are left blocked
+	defer func() {
+		cancel()
+		for range references {
+		}
+	}()
 
-	err := readFiles(ctx, files, workspace)
+	err := readFiles(ctx, files, opts)
 	if err != nil {
 		return nil, err
 	}
 
 	ret := []ld.ReferenceHunksRep{}
+	limits := refLimits{warn: opts.Warnings}
+	for reference := range references {
+		ret = append(ret, reference)
+		if !limits.add(reference) {
+			break
+		}
+	}
+	sortByPath(ret)
+	return ret, nil
+}
 
-	defer sort.SliceStable(ret, func(i, j int) bool {
-		return ret[i].Path < ret[j].Path
+// sortByPath sorts code references by the path of their file, as files are searched concurrently
+func sortByPath(refs []ld.ReferenceHunksRep) {
+	sort.SliceStable(refs, func(i, j int) bool {
+		return refs[i].Path < refs[j].Path
 	})
+}
 
-	totalHunks := 0
-	for reference := range references {
-		ret = append(ret, reference)
+// refLimits counts the code references found by a scan, which are limited to maxFileCount files and maxHunkCount hunks
+type refLimits struct {
+	files int
+	hunks int
+	warn  *warnings.Collector
+}
 
-		// Reached maximum number of files with code references
-		if len(ret) >= maxFileCount {
-			return ret, nil
-		}
-		totalHunks += len(reference.Hunks)
-		// Reached maximum number of hunks across all files
-		if totalHunks > maxHunkCount {
-			return ret, nil
+// reached returns true if no more code references can be added
+func (l *refLimits) reached() bool {
+	return l.files >= maxFileCount || l.hunks > maxHunkCount
+}
+
+// add counts the code references in a file, and returns false with a warning if no more code references can be added
+func (l *refLimits) add(reference ld.ReferenceHunksRep) bool {
+	l.files++
+	// Reached maximum number of files with code references
+	if l.files >= maxFileCount {
+		l.warn.Add(warnings.PayloadTruncated, "", "reached the maximum of %d files containing code references, remaining files were not searched", maxFileCount)
+		return false
+	}
+	l.hunks += len(reference.Hunks)
+	// Reached maximum number of hunks across all files
+	if l.hunks > maxHunkCount {
+		l.warn.Add(warnings.PayloadTruncated, "", "reached the maximum of %d code references, remaining files were not searched", maxHunkCount)
+		return false
+	}
+	return true
+}
+
+// AppendRefs appends more code references to refs, such as those found by SearchContents after SearchForRefs, subject
+// to the same limits on the number of files containing code references and code references as a single search.
+func AppendRefs(refs, more []ld.ReferenceHunksRep, warn *warnings.Collector) []ld.ReferenceHunksRep {
+	limits := refLimits{warn: warn}
+	for _, reference := range refs {
+		limits.files++
+		limits.hunks += len(reference.Hunks)
+	}
+	if limits.reached() {
+		// the limit was reported by the search which found refs
+		return refs
+	}
+	for _, reference := range more {
+		refs = append(refs, reference)
+		if !limits.add(reference) {
+			break
 		}
 	}
-	return ret, nil
+	return refs
 }
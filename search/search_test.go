@@ -2,12 +2,20 @@ package search
 
 import (
 	"context"
+	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
 	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	"github.com/launchdarkly/ld-find-code-refs/internal/warnings"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -27,7 +35,7 @@ const (
 	testFlag2Alias  = "another-flag"
 	testFlag2Alias2 = "another.flag"
 
-	defaultDelims = `"` + "'`"
+	defaultDelimChars = `"` + "'`"
 )
 
 var (
@@ -48,6 +56,8 @@ var (
 		*withFlagKey(withAliases(makeHunkPtr(5, testFlag2Alias), testFlag2Alias), testFlagKey2),
 	}
 
+	defaultDelims = NewDelimiters(defaultDelimChars)
+
 	delimitedTestFlagKey = delimit(testFlagKey, `"`)
 )
 
@@ -58,7 +68,7 @@ func Test_hunkForLine(t *testing.T) {
 		lineNum    int
 		lines      []string
 		flagKey    string
-		delimiters string
+		delimiters Delimiters
 		want       *ld.HunkRep
 	}{
 		{
@@ -77,7 +87,52 @@ func Test_hunkForLine(t *testing.T) {
 			flagKey:    testFlagKey,
 			lines:      []string{delimitedTestFlagKey},
 			delimiters: defaultDelims,
-			want:       makeHunkPtr(1, delimitedTestFlagKey),
+			want:       withMatches(makeHunkPtr(1, delimitedTestFlagKey), match(1, 2)),
+		},
+		{
+			name:       "matches flag key with delimiter pair",
+			ctxLines:   0,
+			lineNum:    0,
+			flagKey:    testFlagKey,
+			lines:      []string{"Flag(" + testFlagKey + ")"},
+			delimiters: Delimiters{Pairs: []DelimiterPair{{Open: "Flag(", Close: ")"}}},
+			want:       withMatches(makeHunkPtr(1, "Flag("+testFlagKey+")"), match(1, 6)),
+		},
+		{
+			name:       "matches flag key with open-only delimiter pair",
+			ctxLines:   0,
+			lineNum:    0,
+			flagKey:    testFlagKey,
+			lines:      []string{"flag_key: " + testFlagKey},
+			delimiters: Delimiters{Pairs: []DelimiterPair{{Open: "flag_key: "}}},
+			want:       withMatches(makeHunkPtr(1, "flag_key: "+testFlagKey), match(1, 11)),
+		},
+		{
+			name:       "does not match prefix of longer flag key with open-only delimiter pair",
+			ctxLines:   0,
+			lineNum:    0,
+			flagKey:    testFlagKey,
+			lines:      []string{"flag_key: " + testFlagKey + "-v2"},
+			delimiters: Delimiters{Pairs: []DelimiterPair{{Open: "flag_key: "}}},
+			want:       nil,
+		},
+		{
+			name:       "does not match suffix of longer flag key with close-only delimiter pair",
+			ctxLines:   0,
+			lineNum:    0,
+			flagKey:    testFlagKey,
+			lines:      []string{"old-" + testFlagKey + " # flag"},
+			delimiters: Delimiters{Pairs: []DelimiterPair{{Close: " # flag"}}},
+			want:       nil,
+		},
+		{
+			name:       "does not match flag key with unclosed delimiter pair",
+			ctxLines:   0,
+			lineNum:    0,
+			flagKey:    testFlagKey,
+			lines:      []string{"Flag(" + testFlagKey + "Other)"},
+			delimiters: Delimiters{Chars: defaultDelimChars, Pairs: []DelimiterPair{{Open: "Flag(", Close: ")"}}},
+			want:       nil,
 		},
 		{
 			name:     "matches no context lines without delimiters",
@@ -85,7 +140,7 @@ func Test_hunkForLine(t *testing.T) {
 			lineNum:  0,
 			flagKey:  testFlagKey,
 			lines:    []string{testFlagKey},
-			want:     makeHunkPtr(1),
+			want:     withMatches(makeHunkPtr(1), match(1, 1)),
 		},
 		{
 			name:     "matches with alias",
@@ -93,7 +148,7 @@ func Test_hunkForLine(t *testing.T) {
 			lineNum:  0,
 			flagKey:  testFlagKey,
 			lines:    []string{testFlagAlias},
-			want:     withAliases(makeHunkPtr(1), testFlagAlias),
+			want:     withMatches(withAliases(makeHunkPtr(1), testFlagAlias), aliasMatch(1, 1, testFlagAlias)),
 		},
 		{
 			name:     "matches with aliases",
@@ -101,7 +156,7 @@ func Test_hunkForLine(t *testing.T) {
 			lineNum:  0,
 			flagKey:  testFlagKey,
 			lines:    []string{testFlagAlias + " " + testFlagAlias2},
-			want:     withAliases(makeHunkPtr(1), testFlagAlias, testFlagAlias2),
+			want:     withMatches(withAliases(makeHunkPtr(1), testFlagAlias, testFlagAlias2), aliasMatch(1, 1, testFlagAlias), aliasMatch(1, 11, testFlagAlias2)),
 		},
 		{
 			name:     "matches with line",
@@ -109,7 +164,7 @@ func Test_hunkForLine(t *testing.T) {
 			lineNum:  1,
 			flagKey:  testFlagKey,
 			lines:    []string{"", testFlagKey, ""},
-			want:     makeHunkPtr(2, testFlagKey),
+			want:     withMatches(makeHunkPtr(2, testFlagKey), match(2, 1)),
 		},
 		{
 			name:     "matches with context lines",
@@ -117,86 +172,252 @@ func Test_hunkForLine(t *testing.T) {
 			lineNum:  1,
 			flagKey:  testFlagKey,
 			lines:    []string{"", testFlagKey, ""},
-			want:     makeHunkPtr(1, "", testFlagKey, ""),
+			want:     withMatches(makeHunkPtr(1, "", testFlagKey, ""), match(2, 1)),
 		},
 		{
 			name:     "truncates long line",
 			ctxLines: 0,
 			lineNum:  0,
 			flagKey:  testFlagKey,
-			lines:    []string{testFlagKey + strings.Repeat("a", maxLineCharCount)},
-			want:     makeHunkPtr(1, testFlagKey+strings.Repeat("a", maxLineCharCount-len(testFlagKey))+"…"),
+			lines:    []string{testFlagKey + strings.Repeat("a", maxLineLength)},
+			want:     withMatches(makeHunkPtr(1, testFlagKey+strings.Repeat("a", maxLineLength-len(testFlagKey))+"…"), match(1, 1)),
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			f := file{lines: tt.lines}
-			got := f.hunkForLine("default", tt.flagKey, aliases[tt.flagKey], tt.lineNum, tt.ctxLines, tt.delimiters)
-			require.Equal(t, tt.want, got)
+			matches := lineMatches(tt.lines[tt.lineNum], map[string][]string{tt.flagKey: aliases[tt.flagKey]}, tt.delimiters)
+			if tt.want == nil {
+				require.Empty(t, matches)
+				return
+			}
+			got := f.hunkForLine("default", tt.flagKey, matches, tt.lineNum, tt.ctxLines, LineLengthCharacters)
+			require.Equal(t, *tt.want, got)
+		})
+	}
+
+}
+
+func Test_lineMatches(t *testing.T) {
+	tests := []struct {
+		name       string
+		line       string
+		aliases    map[string][]string
+		delimiters Delimiters
+		want       []keyMatch
+	}{
+		{
+			name:    "matches each occurrence",
+			line:    "my-flag != my-flag",
+			aliases: map[string][]string{"my-flag": {}},
+			want:    []keyMatch{{flagKey: "my-flag", start: 0, end: 7}, {flagKey: "my-flag", start: 11, end: 18}},
+		},
+		{
+			name:       "matches delimited occurrences",
+			line:       `my-flag = "my-flag"`,
+			aliases:    map[string][]string{"my-flag": {}},
+			delimiters: defaultDelims,
+			want:       []keyMatch{{flagKey: "my-flag", start: 11, end: 18}},
+		},
+		{
+			name:    "does not match flag keys within longer flag keys",
+			line:    "my-flag-v2 && my-flag",
+			aliases: map[string][]string{"my-flag": {}, "my-flag-v2": {}},
+			want:    []keyMatch{{flagKey: "my-flag-v2", start: 0, end: 10}, {flagKey: "my-flag", start: 14, end: 21}},
+		},
+		{
+			name:    "does not match aliases within longer flag keys",
+			line:    "my-flag-v2",
+			aliases: map[string][]string{"my-flag-v2": {}, "other-flag": {"flag-v2"}},
+			want:    []keyMatch{{flagKey: "my-flag-v2", start: 0, end: 10}},
+		},
+		{
+			name:    "matches aliases of the same flag within its flag key",
+			line:    "my-flag",
+			aliases: map[string][]string{"my-flag": {"flag"}},
+			want:    []keyMatch{{flagKey: "my-flag", start: 0, end: 7}, {flagKey: "my-flag", alias: "flag", start: 3, end: 7}},
+		},
+		{
+			name:       "matches flag keys and aliases regardless of case",
+			line:       `"My-Flag" || MYFLAG`,
+			aliases:    map[string][]string{"my-flag": {"myFlag"}},
+			delimiters: Delimiters{Chars: defaultDelimChars, CaseInsensitive: true},
+			want:       []keyMatch{{flagKey: "my-flag", start: 1, end: 8}, {flagKey: "my-flag", alias: "myFlag", start: 13, end: 19}},
+		},
+		{
+			name:       "matches case insensitive aliases regardless of case",
+			line:       `"My-Flag" || MYFLAG || MY_FLAG`,
+			aliases:    map[string][]string{"my-flag": {"myFlag", "my_flag"}},
+			delimiters: Delimiters{Chars: defaultDelimChars, CaseInsensitiveAliases: map[string]bool{"myFlag": true}},
+			want:       []keyMatch{{flagKey: "my-flag", alias: "myFlag", start: 13, end: 19}},
+		},
+		{
+			name:    "matches flags with the same alias",
+			line:    "flag",
+			aliases: map[string][]string{"my-flag": {"flag"}, "your-flag": {"flag"}},
+			want:    []keyMatch{{flagKey: "my-flag", alias: "flag", start: 0, end: 4}, {flagKey: "your-flag", alias: "flag", start: 0, end: 4}},
+		},
+		{
+			name:       "matches flag keys in either normalization form",
+			line:       "\"caf\u00e9-flag\" || \"cafe\u0301-flag\"",
+			aliases:    map[string][]string{"caf\u00e9-flag": {}},
+			delimiters: defaultDelims,
+			want:       []keyMatch{{flagKey: "caf\u00e9-flag", start: 1, end: 11}, {flagKey: "caf\u00e9-flag", start: 17, end: 28}},
+		},
+		{
+			name:    "matches aliases in either normalization form",
+			line:    "cafe\u0301Flag",
+			aliases: map[string][]string{"caf\u00e9-flag": {"caf\u00e9Flag"}},
+			want:    []keyMatch{{flagKey: "caf\u00e9-flag", alias: "caf\u00e9Flag", start: 0, end: 10}},
+		},
+		{
+			name:       "matches non-ascii flag keys regardless of case",
+			line:       `"ÜBER-FLAG"`,
+			aliases:    map[string][]string{"über-flag": {}},
+			delimiters: Delimiters{Chars: defaultDelimChars, CaseInsensitive: true},
+			want:       []keyMatch{{flagKey: "über-flag", start: 1, end: 11}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ElementsMatch(t, tt.want, lineMatches(tt.line, tt.aliases, tt.delimiters))
 		})
 	}
+}
+
+func Test_hunkForLine_columns(t *testing.T) {
+	f := file{lines: []string{`旗 = "someFlag"`}}
+	matches := lineMatches(f.lines[0], map[string][]string{testFlagKey: {}}, defaultDelims)
+	assert.Equal(t, []ld.Match{match(1, 6)}, f.hunkForLine("default", testFlagKey, matches, 0, -1, LineLengthCharacters).Matches)
+	assert.Equal(t, []ld.Match{match(1, 8)}, f.hunkForLine("default", testFlagKey, matches, 0, -1, LineLengthBytes).Matches)
+}
+
+func Test_indexes(t *testing.T) {
+	assert.Equal(t, []int{0, 8}, indexes("my-flag MY-FLAG", "MY-FLAG", true))
+	assert.Equal(t, []int{8}, indexes("my-flag MY-FLAG", "MY-FLAG", false))
+	assert.Equal(t, []int{5}, indexes("旗: Ünïcode", "üNÏCODE", true))
+	assert.Empty(t, indexes("flag", "", true))
+}
+
+func Test_normalForms(t *testing.T) {
+	assert.Equal(t, []string{"my-flag"}, normalForms("my-flag"))
+	assert.Equal(t, []string{"caf\u00e9", "cafe\u0301"}, normalForms("caf\u00e9"))
+	assert.Equal(t, []string{"cafe\u0301", "caf\u00e9"}, normalForms("cafe\u0301"))
+	assert.Equal(t, []string{"旗"}, normalForms("旗"))
+}
 
+func Test_equalKeys(t *testing.T) {
+	assert.True(t, equalKeys("my-flag", "my-flag"))
+	assert.True(t, equalKeys("caf\u00e9", "cafe\u0301"))
+	assert.False(t, equalKeys("cafe", "caf\u00e9"))
+}
+
+func TestDelimiters_Match(t *testing.T) {
+	d := NewDelimiters(`"«»`)
+	assert.True(t, d.Match("«caf\u00e9-flag»", "caf\u00e9-flag"))
+	assert.True(t, d.Match("\"cafe\u0301-flag\"", "caf\u00e9-flag"))
+	assert.False(t, d.Match("caf\u00e9-flag", "caf\u00e9-flag"))
+
+	// the omitted side of a pair must not continue the flag key
+	d = Delimiters{Pairs: []DelimiterPair{{Open: "flag_key: "}}}
+	assert.True(t, d.Match("flag_key: enable-x", "enable-x"))
+	assert.True(t, d.Match("flag_key: enable-x, flag_key: enable-x-v2", "enable-x"))
+	assert.False(t, d.Match("flag_key: enable-x-v2", "enable-x"))
+	assert.Equal(t, []int{10}, d.Indexes("flag_key: enable-x-v2", "enable-x-v2"))
+	assert.Empty(t, d.Indexes("flag_key: enable-x-v2", "enable-x"))
 }
 
 func Test_aggregateHunksForFlag(t *testing.T) {
 	tests := []struct {
-		name     string
-		ctxLines int
-		lines    []string
-		aliases  []string
-		want     []ld.HunkRep
+		name       string
+		ctxLines   int
+		mergeLines int
+		lines      []string
+		aliases    []string
+		want       []*ld.HunkRep
 	}{
 		{
 			name:     "does not set lines when context lines are disabled",
 			ctxLines: -1,
 			lines:    []string{delimitedTestFlagKey, delimitedTestFlagKey, delimitedTestFlagKey},
-			want: []ld.HunkRep{
-				makeHunk(1),
-				makeHunk(2),
-				makeHunk(3),
+			want: []*ld.HunkRep{
+				withMatches(makeHunkPtr(1), match(1, 2)),
+				withMatches(makeHunkPtr(2), match(2, 2)),
+				withMatches(makeHunkPtr(3), match(3, 2)),
 			},
 		},
 		{
 			name:     "combines adjacent hunks with no additional context lines",
 			ctxLines: 0,
 			lines:    []string{delimitedTestFlagKey, delimitedTestFlagKey, delimitedTestFlagKey},
-			want: []ld.HunkRep{
-				makeHunk(1, delimitedTestFlagKey, delimitedTestFlagKey, delimitedTestFlagKey),
+			want: []*ld.HunkRep{
+				withMatches(makeHunkPtr(1, delimitedTestFlagKey, delimitedTestFlagKey, delimitedTestFlagKey), match(1, 2), match(2, 2), match(3, 2)),
 			},
 		},
 		{
 			name:     "combines adjacent hunks",
 			ctxLines: 1,
 			lines:    []string{delimitedTestFlagKey, "", "", delimitedTestFlagKey, "", "", delimitedTestFlagKey},
-			want: []ld.HunkRep{
-				makeHunk(1, delimitedTestFlagKey, "", "", delimitedTestFlagKey, "", "", delimitedTestFlagKey),
+			want: []*ld.HunkRep{
+				withMatches(makeHunkPtr(1, delimitedTestFlagKey, "", "", delimitedTestFlagKey, "", "", delimitedTestFlagKey), match(1, 2), match(4, 2), match(7, 2)),
 			},
 		},
 		{
 			name:     "does not combine hunks with no overlap",
 			ctxLines: 1,
 			lines:    []string{delimitedTestFlagKey, "", "", "", delimitedTestFlagKey, "", "", "", delimitedTestFlagKey},
-			want: []ld.HunkRep{
-				makeHunk(1, delimitedTestFlagKey, ""),
-				makeHunk(4, "", delimitedTestFlagKey, ""),
-				makeHunk(8, "", delimitedTestFlagKey),
+			want: []*ld.HunkRep{
+				withMatches(makeHunkPtr(1, delimitedTestFlagKey, ""), match(1, 2)),
+				withMatches(makeHunkPtr(4, "", delimitedTestFlagKey, ""), match(5, 2)),
+				withMatches(makeHunkPtr(8, "", delimitedTestFlagKey), match(9, 2)),
+			},
+		},
+		{
+			name:       "combines hunks within merge distance",
+			ctxLines:   1,
+			mergeLines: 2,
+			lines:      []string{delimitedTestFlagKey, "", "a", "b", "", delimitedTestFlagKey, "", "", "", "", "", delimitedTestFlagKey},
+			want: []*ld.HunkRep{
+				withMatches(makeHunkPtr(1, delimitedTestFlagKey, "", "a", "b", "", delimitedTestFlagKey, ""), match(1, 2), match(6, 2)),
+				withMatches(makeHunkPtr(11, "", delimitedTestFlagKey), match(12, 2)),
+			},
+		},
+		{
+			name:       "combines hunks within merge distance with no additional context lines",
+			ctxLines:   0,
+			mergeLines: 1,
+			lines:      []string{delimitedTestFlagKey, "a", delimitedTestFlagKey, "", "", delimitedTestFlagKey},
+			want: []*ld.HunkRep{
+				withMatches(makeHunkPtr(1, delimitedTestFlagKey, "a", delimitedTestFlagKey), match(1, 2), match(3, 2)),
+				withMatches(makeHunkPtr(6, delimitedTestFlagKey), match(6, 2)),
+			},
+		},
+		{
+			name:       "does not combine hunks within merge distance when context lines are disabled",
+			ctxLines:   -1,
+			mergeLines: 5,
+			lines:      []string{delimitedTestFlagKey, "", delimitedTestFlagKey},
+			want: []*ld.HunkRep{
+				withMatches(makeHunkPtr(1), match(1, 2)),
+				withMatches(makeHunkPtr(3), match(3, 2)),
 			},
 		},
 		{
 			name:     "combines overlapping hunks",
 			ctxLines: 1,
 			lines:    []string{delimitedTestFlagKey, "", delimitedTestFlagKey, "", delimitedTestFlagKey},
-			want: []ld.HunkRep{
-				makeHunk(1, delimitedTestFlagKey, "", delimitedTestFlagKey, "", delimitedTestFlagKey),
+			want: []*ld.HunkRep{
+				withMatches(makeHunkPtr(1, delimitedTestFlagKey, "", delimitedTestFlagKey, "", delimitedTestFlagKey), match(1, 2), match(3, 2), match(5, 2)),
 			},
 		},
 		{
 			name:     "combines multiple types of overlaps",
 			ctxLines: 1,
 			lines:    []string{delimitedTestFlagKey, "", delimitedTestFlagKey, "", delimitedTestFlagKey},
-			want: []ld.HunkRep{
-				makeHunk(1, delimitedTestFlagKey, "", delimitedTestFlagKey, "", delimitedTestFlagKey),
+			want: []*ld.HunkRep{
+				withMatches(makeHunkPtr(1, delimitedTestFlagKey, "", delimitedTestFlagKey, "", delimitedTestFlagKey), match(1, 2), match(3, 2), match(5, 2)),
 			},
 		},
 	}
@@ -204,8 +425,17 @@ func Test_aggregateHunksForFlag(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			f := file{lines: tt.lines}
-			got := f.aggregateHunksForFlag("default", testFlagKey, []string{}, tt.ctxLines, defaultDelims)
-			require.Equal(t, tt.want, got)
+			matches := map[int][]keyMatch{}
+			for i, line := range tt.lines {
+				if m := lineMatches(line, map[string][]string{testFlagKey: {}}, defaultDelims); len(m) > 0 {
+					matches[i] = m
+				}
+			}
+			got := f.aggregateHunksForFlag("default", testFlagKey, matches, tt.ctxLines, LineLengthCharacters, tt.mergeLines)
+			require.Len(t, got, len(tt.want))
+			for i, want := range tt.want {
+				require.Equal(t, *want, got[i])
+			}
 		})
 	}
 }
@@ -261,6 +491,12 @@ func Test_mergeHunks(t *testing.T) {
 			hunk2: makeHunk(1, "a", "b", "c"),
 			want:  []ld.HunkRep{makeHunk(1, "a", "b", "c"), makeHunk(5, "e", "f", "g")},
 		},
+		{
+			name:  "combine matches and aliases of subset hunk",
+			hunk1: *withMatches(withAliases(makeHunkPtr(1, "a", "b", "c"), "a"), aliasMatch(1, 1, "a")),
+			hunk2: *withMatches(withAliases(makeHunkPtr(3, "c"), "c"), aliasMatch(3, 1, "c")),
+			want:  []ld.HunkRep{*withMatches(withAliases(makeHunkPtr(1, "a", "b", "c"), "a", "c"), aliasMatch(1, 1, "a"), aliasMatch(3, 1, "c"))},
+		},
 		{
 			name:  "does not combine with no context lines",
 			hunk1: makeHunk(1),
@@ -279,11 +515,69 @@ func Test_mergeHunks(t *testing.T) {
 
 func Test_toHunks(t *testing.T) {
 	f := testFile
-	got := f.toHunks("default", aliases, 0, "")
+	got := f.toHunks("default", aliases, ContextLines{}, Delimiters{}, LineLengthCharacters, 0)
 	require.Equal(t, "fileWithRefs", got.Path)
 	require.Equal(t, len(testResultHunks), len(got.Hunks))
 	// no hunks should generate no references
-	require.Nil(t, f.toHunks("default", nil, 0, ""))
+	require.Nil(t, f.toHunks("default", nil, ContextLines{}, Delimiters{}, LineLengthCharacters, 0))
+}
+
+func Test_toHunks_multipleFlagsPerLine(t *testing.T) {
+	f := file{path: "flags.js", lines: []string{"if (flags['my-flag-v2'] && flags['other-flag']) {", "}"}}
+	got := f.toHunks("default", map[string][]string{"my-flag": {}, "my-flag-v2": {}, "other-flag": {}}, NewContextLines(0, nil), Delimiters{}, LineLengthCharacters, 0)
+	require.NotNil(t, got)
+	hunks := map[string]ld.HunkRep{}
+	for _, hunk := range got.Hunks {
+		hunks[hunk.FlagKey] = hunk
+	}
+	require.Len(t, hunks, 2, "my-flag is only matched within my-flag-v2")
+	assert.Equal(t, []ld.Match{match(1, 12)}, hunks["my-flag-v2"].Matches)
+	assert.Equal(t, []ld.Match{match(1, 35)}, hunks["other-flag"].Matches)
+}
+
+func Test_toHunks_longLines(t *testing.T) {
+	// the flag key is beyond the truncation limit for the first flag's hunk, and must still be found for the second flag
+	line := testFlagKey + strings.Repeat("旗", maxLineLength) + testFlagKey2
+	f := file{path: "longLines", lines: []string{line}}
+	got := f.toHunks("default", map[string][]string{testFlagKey: {}, testFlagKey2: {}}, ContextLines{}, Delimiters{}, LineLengthCharacters, 0)
+	require.NotNil(t, got)
+	require.Len(t, got.Hunks, 2)
+	require.Equal(t, line, f.lines[0], "truncating hunk lines should not modify the file")
+}
+
+func Test_toHunks_dataLines(t *testing.T) {
+	f := file{path: "package-lock.json", lines: []string{
+		`"dark-mode": {`,
+		`  "integrity": "sha512-v2kDEe57lecTulaDIuNTPy3Ry4gLGJ6Z1O3vE1krgXZNrsQ+LFTGHVxVjcXPs7S7A6HWJAOSgPhPIj6OL0FX9Q==", "name": "dark-mode"`,
+	}}
+	flags := map[string][]string{"dark-mode": {}}
+	got := f.toHunks("default", flags, NewContextLines(0, nil), NewDelimiters(`"`), LineLengthCharacters, 0)
+	require.NotNil(t, got)
+	require.Len(t, got.Hunks, 1)
+	assert.Equal(t, []ld.Match{match(1, 2), match(2, 124)}, got.Hunks[0].Matches, "data lines are searched by default")
+
+	got = f.toHunks("default", flags, NewContextLines(0, nil), Delimiters{Chars: `"`, SkipDataLines: true}, LineLengthCharacters, 0)
+	require.NotNil(t, got)
+	require.Len(t, got.Hunks, 1)
+	assert.Equal(t, []ld.Match{match(1, 2)}, got.Hunks[0].Matches)
+}
+
+func Test_warnTruncated(t *testing.T) {
+	long := strings.Repeat("a", maxLineLength+1)
+	f := file{path: "longLines", lines: []string{long, testFlagKey, long, "", long}}
+	ref := f.toHunks("default", map[string][]string{testFlagKey: {}}, NewContextLines(1, nil), Delimiters{}, LineLengthCharacters, 0)
+	require.NotNil(t, ref)
+
+	warn := &warnings.Collector{}
+	f.warnTruncated(*ref, LineLengthCharacters, warn)
+	require.Len(t, warn.Warnings(), 1)
+	assert.Equal(t, warnings.Warning{Category: warnings.Truncation, Code: warnings.LinesTruncated, Path: "longLines", Message: "truncated 2 lines longer than 500 characters in longLines"}, warn.Warnings()[0])
+
+	// no lines are sent when context lines are disabled, so nothing is truncated
+	ref = f.toHunks("default", map[string][]string{testFlagKey: {}}, NewContextLines(-1, nil), Delimiters{}, LineLengthCharacters, 0)
+	warn = &warnings.Collector{}
+	f.warnTruncated(*ref, LineLengthCharacters, warn)
+	assert.Empty(t, warn.Warnings())
 }
 
 func Test_processFiles(t *testing.T) {
@@ -298,7 +592,7 @@ func Test_processFiles(t *testing.T) {
 	files <- f2
 	files <- file{path: "no-refs"}
 	close(files)
-	go processFiles(context.Background(), files, references, "default", aliases, 0, "")
+	go processFiles(context.Background(), files, references, Options{ProjKey: "default", Aliases: aliases, LineLengthUnit: LineLengthCharacters}, nil, nil)
 	totalRefs := 0
 	totalHunks := 0
 	for reference := range references {
@@ -311,12 +605,84 @@ func Test_processFiles(t *testing.T) {
 
 func Test_SearchForRefs(t *testing.T) {
 	want := []ld.ReferenceHunksRep{{Path: testFile.path}}
-	got, err := SearchForRefs("default", "testdata", aliases, 0, "")
+	got, err := SearchForRefs(context.Background(), Options{ProjKey: "default", Workspace: "testdata", Aliases: aliases, LineLengthUnit: LineLengthCharacters})
 	require.NoError(t, err)
 	require.Len(t, got, 1)
 	require.Equal(t, want[0].Path, got[0].Path)
 }
 
+func Test_SearchForRefs_sorted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "search-sorted")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	for i := 0; i < 50; i++ {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("file%02d", i)), []byte(testFlagKey), 0600))
+	}
+
+	got, err := SearchForRefs(context.Background(), Options{ProjKey: "default", Workspace: dir, Aliases: aliases, LineLengthUnit: LineLengthCharacters})
+	require.NoError(t, err)
+	require.Len(t, got, 50)
+	assert.True(t, sort.SliceIsSorted(got, func(i, j int) bool { return got[i].Path < got[j].Path }), "references are sorted by path")
+}
+
+func Test_SearchForRefs_cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	got, err := SearchForRefs(ctx, Options{ProjKey: "default", Workspace: "testdata", Aliases: aliases, LineLengthUnit: LineLengthCharacters})
+	require.NoError(t, err)
+	require.Empty(t, got, "No files should be searched after the context has been cancelled")
+}
+
+func Test_SearchForRefs_error(t *testing.T) {
+	dir, err := ioutil.TempDir("", "search-error")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "a"), []byte(strings.Join(testFile.lines, "\n")), 0600))
+	require.NoError(t, os.Symlink(filepath.Join(dir, "a"), filepath.Join(dir, "b")))
+
+	before := runtime.NumGoroutine()
+	_, err = SearchForRefs(context.Background(), Options{ProjKey: "default", Workspace: dir, Aliases: aliases, LineLengthUnit: LineLengthCharacters, Symlinks: SymlinkError})
+	require.Error(t, err)
+	// the references found before the error are not left waiting to be received
+	for deadline := time.Now().Add(time.Second); runtime.NumGoroutine() > before && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), before)
+}
+
+func Test_SearchContents(t *testing.T) {
+	contents := map[string][]byte{
+		"sparse/fileWithRefs":  []byte(strings.Join(testFile.lines, "\n") + "\n"),
+		".hidden/fileWithRefs": []byte(strings.Join(testFile.lines, "\n")),
+		"ignoredLD":            []byte(strings.Join(testFile.lines, "\n")),
+	}
+	got := SearchContents(Options{ProjKey: "default", Workspace: "testdata", Aliases: aliases, LineLengthUnit: LineLengthCharacters}, contents)
+	require.Len(t, got, 1)
+	require.Equal(t, "sparse/fileWithRefs", got[0].Path)
+	require.Equal(t, len(testResultHunks), len(got[0].Hunks))
+}
+
+func TestAppendRefs(t *testing.T) {
+	ref := func(path string, hunks int) ld.ReferenceHunksRep {
+		return ld.ReferenceHunksRep{Path: path, Hunks: make([]ld.HunkRep, hunks)}
+	}
+
+	warn := &warnings.Collector{}
+	got := AppendRefs([]ld.ReferenceHunksRep{ref("a", 1)}, []ld.ReferenceHunksRep{ref("b", 1), ref("c", 1)}, warn)
+	assert.Equal(t, []string{"a", "b", "c"}, paths(got))
+	assert.Empty(t, warn.Warnings())
+
+	got = AppendRefs([]ld.ReferenceHunksRep{ref("a", maxHunkCount)}, []ld.ReferenceHunksRep{ref("b", 1), ref("c", 1)}, warn)
+	assert.Equal(t, []string{"a", "b"}, paths(got), "references are appended until the limit is reached")
+	require.Len(t, warn.Warnings(), 1)
+	assert.Equal(t, warnings.PayloadTruncated, warn.Warnings()[0].Code)
+
+	warn = &warnings.Collector{}
+	got = AppendRefs([]ld.ReferenceHunksRep{ref("a", maxHunkCount+1)}, []ld.ReferenceHunksRep{ref("b", 1)}, warn)
+	assert.Equal(t, []string{"a"}, paths(got))
+	assert.Empty(t, warn.Warnings(), "a limit reached by the search is not reported again")
+}
+
 func withAliases(hunk *ld.HunkRep, aliases ...string) *ld.HunkRep {
 	hunk.Aliases = aliases
 	return hunk
@@ -349,3 +715,16 @@ func makeHunk(startingLineNumber int, lines ...string) ld.HunkRep {
 func delimit(s string, delim string) string {
 	return delim + s + delim
 }
+
+func withMatches(hunk *ld.HunkRep, matches ...ld.Match) *ld.HunkRep {
+	hunk.Matches = matches
+	return hunk
+}
+
+func match(lineNumber, column int) ld.Match {
+	return ld.Match{LineNumber: lineNumber, Column: column}
+}
+
+func aliasMatch(lineNumber, column int, alias string) ld.Match {
+	return ld.Match{LineNumber: lineNumber, Column: column, Alias: alias}
+}
@@ -0,0 +1,269 @@
+package search
+
+import (
+	"io/ioutil"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+	"github.com/launchdarkly/ld-find-code-refs/internal/sourcemap"
+	"github.com/launchdarkly/ld-find-code-refs/internal/validation"
+)
+
+// generatedExtensions are the extensions of generated files which may have source maps
+var generatedExtensions = []string{".js", ".mjs", ".cjs", ".jsx"}
+
+// ResolveSourceMaps replaces references found in generated JavaScript files which have a source map with references to
+// the original source files. A source map may be referenced by a sourceMappingURL comment, or located adjacent to the
+// generated file with a .map extension. References which cannot be resolved to an original source file within the
+// workspace are left unchanged. References found in source map files are removed.
+func ResolveSourceMaps(workspace string, refs []ld.ReferenceHunksRep, ctxLines ContextLines, unit LineLengthUnit) []ld.ReferenceHunksRep {
+	resolved := newReferenceSet()
+	for _, ref := range refs {
+		if strings.HasSuffix(ref.Path, ".map") {
+			continue
+		}
+		if !isGenerated(ref.Path) {
+			resolved.add(ref.Path, ref.Hunks...)
+			continue
+		}
+		lines, err := readFileLines(filepath.Join(workspace, ref.Path))
+		if err != nil {
+			resolved.add(ref.Path, ref.Hunks...)
+			continue
+		}
+		m, mapDir, err := loadSourceMap(workspace, ref.Path, lines)
+		if err != nil {
+			log.Debug.Printf("unable to read source map for %s: %s", ref.Path, err)
+		}
+		if m == nil {
+			resolved.add(ref.Path, ref.Hunks...)
+			continue
+		}
+		r := sourceMapResolver{workspace: workspace, mapDir: mapDir, m: m, ctxLines: ctxLines, unit: unit, sources: map[int][]string{}}
+		for _, hunk := range ref.Hunks {
+			originals := r.resolveHunk(lines, hunk)
+			if len(originals) == 0 {
+				resolved.add(ref.Path, hunk)
+			}
+			for path, hunks := range originals {
+				resolved.add(path, hunks...)
+			}
+		}
+	}
+	return resolved.references()
+}
+
+func isGenerated(path string) bool {
+	for _, ext := range generatedExtensions {
+		if strings.HasSuffix(path, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadSourceMap returns the source map of a generated file, and the directory relative to the workspace which sources are relative to.
+// Returns a nil map if the file does not have a source map.
+func loadSourceMap(workspace, generatedPath string, lines []string) (*sourcemap.Map, string, error) {
+	dir := path.Dir(filepath.ToSlash(generatedPath))
+	mapURL, ok := sourcemap.FindURL(lines)
+	if !ok {
+		mapURL = path.Base(generatedPath) + ".map"
+		if !validation.FileExists(filepath.Join(workspace, dir, mapURL)) {
+			return nil, "", nil
+		}
+	}
+
+	data, isInline, err := sourcemap.DecodeDataURL(mapURL)
+	if err != nil {
+		return nil, "", err
+	}
+	if !isInline {
+		if sourcemap.IsRemote(mapURL) {
+			return nil, "", nil
+		}
+		mapPath, err := url.PathUnescape(strings.TrimPrefix(mapURL, "file://"))
+		if err != nil {
+			return nil, "", err
+		}
+		if !path.IsAbs(mapPath) {
+			mapPath = path.Join(dir, mapPath)
+		} else if mapPath, ok = relativePath(workspace, mapPath); !ok {
+			return nil, "", nil
+		}
+		dir = path.Dir(mapPath)
+		/* #nosec */
+		data, err = ioutil.ReadFile(filepath.Join(workspace, mapPath))
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	m, err := sourcemap.Parse(data)
+	return m, dir, err
+}
+
+// relativePath returns an absolute path relative to the workspace. Returns false if the path is not within the workspace.
+func relativePath(workspace, absPath string) (string, bool) {
+	absWorkspace, err := filepath.Abs(workspace)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(absWorkspace, filepath.FromSlash(absPath))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+type sourceMapResolver struct {
+	workspace string
+	mapDir    string
+	m         *sourcemap.Map
+	ctxLines  ContextLines
+	unit      LineLengthUnit
+	// sources caches the lines of each original source
+	sources map[int][]string
+}
+
+// resolveHunk returns hunks for each reference in a hunk which is mapped to an original source, keyed by the path of the source
+func (r sourceMapResolver) resolveHunk(generated []string, hunk ld.HunkRep) map[string][]ld.HunkRep {
+	ret := map[string][]ld.HunkRep{}
+	start := hunk.StartingLineNumber - 1
+	for i := start; i < start+hunk.NumLines() && i < len(generated); i++ {
+		column, ok := referenceColumn(generated[i], hunk)
+		if !ok {
+			continue
+		}
+		source, origLine, ok := r.m.Lookup(i+1, column)
+		if !ok {
+			continue
+		}
+		sourcePath, ok := r.sourcePath(source)
+		if !ok {
+			continue
+		}
+		origHunk := ld.HunkRep{
+			StartingLineNumber: origLine,
+			ProjKey:            hunk.ProjKey,
+			FlagKey:            hunk.FlagKey,
+			Aliases:            hunk.Aliases,
+		}
+		n := r.ctxLines.For(sourcePath, hunk.FlagKey)
+		if lines := r.sourceLines(source, sourcePath); n >= 0 && origLine <= len(lines) {
+			first, last := origLine-1-n, origLine+n
+			if first < 0 {
+				first = 0
+			}
+			if last > len(lines) {
+				last = len(lines)
+			}
+			truncated := make([]string, 0, last-first)
+			for _, line := range lines[first:last] {
+				truncated = append(truncated, truncateLine(line, r.unit))
+			}
+			origHunk.StartingLineNumber = first + 1
+			origHunk.Lines = strings.Join(truncated, "\n")
+		}
+		ret[sourcePath] = append(ret[sourcePath], origHunk)
+	}
+	return ret
+}
+
+// referenceColumn returns the character offset of the first reference to the hunk's flag key or aliases in a line
+func referenceColumn(line string, hunk ld.HunkRep) (int, bool) {
+	idx := -1
+	for _, s := range append([]string{hunk.FlagKey}, hunk.Aliases...) {
+		if i := strings.Index(line, s); i >= 0 && (idx < 0 || i < idx) {
+			idx = i
+		}
+	}
+	if idx < 0 {
+		return 0, false
+	}
+	return utf8.RuneCountInString(line[:idx]), true
+}
+
+// sourcePath resolves a source to a path relative to the workspace. Sources with a webpack:// URL are relative to the workspace,
+// and other relative sources are relative to the directory containing the source map.
+func (r sourceMapResolver) sourcePath(source int) (string, bool) {
+	s := r.m.Sources[source]
+	switch {
+	case strings.HasPrefix(s, "webpack://"):
+		// webpack://[namespace]/./src/index.js
+		s = strings.TrimPrefix(s, "webpack://")
+		if i := strings.Index(s, "/"); i >= 0 {
+			s = s[i+1:]
+		}
+		s = path.Clean(s)
+	case strings.HasPrefix(s, "file://"):
+		return relativePath(r.workspace, strings.TrimPrefix(s, "file://"))
+	case sourcemap.IsRemote(s):
+		return "", false
+	case path.IsAbs(s):
+		return relativePath(r.workspace, s)
+	default:
+		s = path.Join(r.mapDir, s)
+	}
+	if s == ".." || strings.HasPrefix(s, "../") {
+		return "", false
+	}
+	return s, true
+}
+
+// sourceLines returns the lines of an original source, from the source map if it includes source content, or the workspace
+func (r sourceMapResolver) sourceLines(source int, sourcePath string) []string {
+	if lines, ok := r.sources[source]; ok {
+		return lines
+	}
+	var lines []string
+	if content, ok := r.m.Content(source); ok {
+		lines = splitLines(content)
+	} else if fileLines, err := readFileLines(filepath.Join(r.workspace, sourcePath)); err == nil {
+		lines = fileLines
+	}
+	r.sources[source] = lines
+	return lines
+}
+
+// referenceSet combines hunks by path, removing duplicate hunks for the same flag and line
+type referenceSet struct {
+	hunks map[string][]ld.HunkRep
+	seen  map[string]bool
+}
+
+func newReferenceSet() referenceSet {
+	return referenceSet{hunks: map[string][]ld.HunkRep{}, seen: map[string]bool{}}
+}
+
+func (s referenceSet) add(path string, hunks ...ld.HunkRep) {
+	for _, h := range hunks {
+		key := path + "\x00" + h.FlagKey + "\x00" + strconv.Itoa(h.StartingLineNumber)
+		if s.seen[key] {
+			continue
+		}
+		s.seen[key] = true
+		s.hunks[path] = append(s.hunks[path], h)
+	}
+}
+
+func (s referenceSet) references() []ld.ReferenceHunksRep {
+	ret := make([]ld.ReferenceHunksRep, 0, len(s.hunks))
+	for path, hunks := range s.hunks {
+		sort.SliceStable(hunks, func(i, j int) bool {
+			return hunks[i].StartingLineNumber < hunks[j].StartingLineNumber
+		})
+		ret = append(ret, ld.ReferenceHunksRep{Path: path, Hunks: hunks})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Path < ret[j].Path
+	})
+	return ret
+}
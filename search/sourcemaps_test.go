@@ -0,0 +1,107 @@
+package search
+
+import (
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+)
+
+const (
+	testOriginalSource = "import { client } from './client'\n\nconst a = client.variation('my-flag')\nexport default a\n"
+	// maps column 6 of the first generated line to the third line of ../src/app.js
+	testSourceMap = `{"version":3,"sources":["../src/app.js"],"sourcesContent":["import { client } from './client'\n\nconst a = client.variation('my-flag')\nexport default a\n"],"mappings":"AAAA,MAEA"}`
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for path, content := range files {
+		path = filepath.Join(dir, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0750))
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+	}
+}
+
+func Test_ResolveSourceMaps(t *testing.T) {
+	specs := []struct {
+		name  string
+		files map[string]string
+		want  []ld.ReferenceHunksRep
+	}{
+		{
+			name: "sourceMappingURL comment",
+			files: map[string]string{
+				"dist/app.js":     "var a=client.variation(\"my-flag\");\n//# sourceMappingURL=app.js.map\n",
+				"dist/app.js.map": testSourceMap,
+			},
+			want: []ld.ReferenceHunksRep{{Path: "src/app.js", Hunks: []ld.HunkRep{
+				{StartingLineNumber: 2, Lines: "\nconst a = client.variation('my-flag')\nexport default a", ProjKey: "default", FlagKey: "my-flag"},
+			}}},
+		},
+		{
+			name: "adjacent source map",
+			files: map[string]string{
+				"dist/app.js":     "var a=client.variation(\"my-flag\");\n",
+				"dist/app.js.map": testSourceMap,
+			},
+			want: []ld.ReferenceHunksRep{{Path: "src/app.js", Hunks: []ld.HunkRep{
+				{StartingLineNumber: 2, Lines: "\nconst a = client.variation('my-flag')\nexport default a", ProjKey: "default", FlagKey: "my-flag"},
+			}}},
+		},
+		{
+			name: "inline source map",
+			files: map[string]string{
+				"dist/app.js": "var a=client.variation(\"my-flag\");\n//# sourceMappingURL=data:application/json;base64," + base64.StdEncoding.EncodeToString([]byte(testSourceMap)) + "\n",
+			},
+			want: []ld.ReferenceHunksRep{{Path: "src/app.js", Hunks: []ld.HunkRep{
+				{StartingLineNumber: 2, Lines: "\nconst a = client.variation('my-flag')\nexport default a", ProjKey: "default", FlagKey: "my-flag"},
+			}}},
+		},
+		{
+			name: "original source is deduplicated",
+			files: map[string]string{
+				"dist/app.js":     "var a=client.variation(\"my-flag\");\n",
+				"dist/app.js.map": testSourceMap,
+				"src/app.js":      testOriginalSource,
+			},
+			want: []ld.ReferenceHunksRep{{Path: "src/app.js", Hunks: []ld.HunkRep{
+				{StartingLineNumber: 2, Lines: "\nconst a = client.variation('my-flag')\nexport default a", ProjKey: "default", FlagKey: "my-flag"},
+			}}},
+		},
+		{
+			name: "no source map",
+			files: map[string]string{
+				"dist/app.js": "var a=client.variation(\"my-flag\");\n",
+			},
+			want: []ld.ReferenceHunksRep{{Path: "dist/app.js", Hunks: []ld.HunkRep{
+				{StartingLineNumber: 1, Lines: "var a=client.variation(\"my-flag\");", ProjKey: "default", FlagKey: "my-flag", Matches: []ld.Match{{LineNumber: 1, Column: 25}}},
+			}}},
+		},
+	}
+
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "sourcemaps")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+			writeFiles(t, dir, tt.files)
+
+			ctxLines := NewContextLines(1, nil)
+			refs, err := SearchForRefs(context.Background(), Options{ProjKey: "default", Workspace: dir, Aliases: map[string][]string{"my-flag": {}}, ContextLines: ctxLines, Delimiters: NewDelimiters(`"'`), LineLengthUnit: LineLengthCharacters})
+			require.NoError(t, err)
+			got := ResolveSourceMaps(dir, refs, ctxLines, LineLengthCharacters)
+			for i := range got {
+				for j := range got[i].Hunks {
+					got[i].Hunks[j].Aliases = nil
+				}
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
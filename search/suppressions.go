@@ -0,0 +1,118 @@
+package search
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+)
+
+// Suppression excludes code references to a flag, or on lines matching a pattern, in files matching a glob pattern
+type Suppression struct {
+	Flag string
+	// Line is matched against each line containing the reference. If nil, all lines match.
+	Line *regexp.Regexp
+	glob *regexp.Regexp
+}
+
+// NewSuppression creates a Suppression, compiling its path glob and line pattern. An empty flag matches every flag,
+// and an empty line pattern matches every line.
+func NewSuppression(path, flag, linePattern string) (Suppression, error) {
+	s := Suppression{Flag: flag, glob: globToRegexp(path)}
+	if linePattern != "" {
+		line, err := regexp.Compile(linePattern)
+		if err != nil {
+			return s, err
+		}
+		s.Line = line
+	}
+	return s, nil
+}
+
+func (s Suppression) matches(line ReferencingLine) bool {
+	return (s.Flag == "" || s.Flag == line.FlagKey) && (s.Line == nil || s.Line.MatchString(line.Line)) && s.glob.MatchString(line.Path)
+}
+
+// ReferencingLine is a line of a hunk containing its flag key, or one of the aliases matched in the hunk
+type ReferencingLine struct {
+	Path       string
+	FlagKey    string
+	LineNumber int
+	Line       string
+}
+
+// referencingLines returns the lines of a hunk containing its flag key or one of its matched aliases. Lines are
+// identified by the hunk's matches, if they were recorded.
+func referencingLines(path string, hunk *ld.HunkRep, lines []string) []ReferencingLine {
+	matchedLines := map[int]bool{}
+	for _, m := range hunk.Matches {
+		matchedLines[m.LineNumber] = true
+	}
+	ret := []ReferencingLine{}
+	for i, line := range lines {
+		matched := matchedLines[hunk.StartingLineNumber+i]
+		if len(hunk.Matches) == 0 {
+			matched = strings.Contains(line, hunk.FlagKey)
+			for _, alias := range hunk.Aliases {
+				matched = matched || strings.Contains(line, alias)
+			}
+		}
+		if matched {
+			ret = append(ret, ReferencingLine{Path: path, FlagKey: hunk.FlagKey, LineNumber: hunk.StartingLineNumber + i, Line: line})
+		}
+	}
+	return ret
+}
+
+// ReferencingLines returns the lines of each hunk containing its flag key or one of its matched aliases
+func ReferencingLines(workspace string, refs []ld.ReferenceHunksRep) []ReferencingLine {
+	ret := []ReferencingLine{}
+	forEachHunk(workspace, refs, func(path string, hunk *ld.HunkRep, lines []string) {
+		ret = append(ret, referencingLines(path, hunk, lines)...)
+	})
+	return ret
+}
+
+// Suppress removes hunks where every line containing the reference is matched by a suppression, and files without any
+// remaining hunks. Returns the remaining references, and the number of hunks removed.
+func Suppress(workspace string, refs []ld.ReferenceHunksRep, suppressions []Suppression) ([]ld.ReferenceHunksRep, int) {
+	if len(suppressions) == 0 {
+		return refs, 0
+	}
+	suppressed := map[*ld.HunkRep]bool{}
+	forEachHunk(workspace, refs, func(path string, hunk *ld.HunkRep, lines []string) {
+		matched := referencingLines(path, hunk, lines)
+		for _, line := range matched {
+			if !isSuppressed(line, suppressions) {
+				return
+			}
+		}
+		suppressed[hunk] = len(matched) > 0
+	})
+
+	ret := make([]ld.ReferenceHunksRep, 0, len(refs))
+	removed := 0
+	for _, ref := range refs {
+		hunks := make([]ld.HunkRep, 0, len(ref.Hunks))
+		for i := range ref.Hunks {
+			if suppressed[&ref.Hunks[i]] {
+				removed++
+				continue
+			}
+			hunks = append(hunks, ref.Hunks[i])
+		}
+		if len(hunks) > 0 {
+			ret = append(ret, ld.ReferenceHunksRep{Path: ref.Path, Hunks: hunks})
+		}
+	}
+	return ret, removed
+}
+
+func isSuppressed(line ReferencingLine, suppressions []Suppression) bool {
+	for _, s := range suppressions {
+		if s.matches(line) {
+			return true
+		}
+	}
+	return false
+}
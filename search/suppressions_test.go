@@ -0,0 +1,62 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+)
+
+func TestSuppress(t *testing.T) {
+	newSuppression := func(path, flag, linePattern string) Suppression {
+		s, err := NewSuppression(path, flag, linePattern)
+		require.NoError(t, err)
+		return s
+	}
+	refs := func() []ld.ReferenceHunksRep {
+		return []ld.ReferenceHunksRep{
+			{Path: "docs/flags.md", Hunks: []ld.HunkRep{{StartingLineNumber: 1, FlagKey: "my-flag", Lines: "my-flag"}}},
+			{Path: "src/app.js", Hunks: []ld.HunkRep{
+				{StartingLineNumber: 1, FlagKey: "my-flag", Lines: "mockFlags('my-flag')\nvariation('my-flag')"},
+				{StartingLineNumber: 5, FlagKey: "my-flag", Lines: "mockFlags('my-flag')"},
+				{StartingLineNumber: 7, FlagKey: "other-flag", Lines: "// context\nmockFlags(myAlias)", Aliases: []string{"myAlias"}},
+			}},
+		}
+	}
+
+	specs := []struct {
+		name         string
+		suppressions []Suppression
+		removed      int
+		paths        []string
+	}{
+		{name: "no suppressions", removed: 0, paths: []string{"docs/flags.md", "src/app.js"}},
+		{name: "path and flag", suppressions: []Suppression{newSuppression("docs/**", "my-flag", "")}, removed: 1, paths: []string{"src/app.js"}},
+		{name: "other flag", suppressions: []Suppression{newSuppression("docs/**", "other-flag", "")}, removed: 0, paths: []string{"docs/flags.md", "src/app.js"}},
+		// hunks are only suppressed when every line containing the reference matches
+		{name: "line pattern", suppressions: []Suppression{newSuppression("**/*.js", "", `^mockFlags\(`)}, removed: 2, paths: []string{"docs/flags.md", "src/app.js"}},
+		{name: "all", suppressions: []Suppression{newSuppression("**", "my-flag", ""), newSuppression("src/", "other-flag", "")}, removed: 4, paths: []string{}},
+	}
+
+	for _, tt := range specs {
+		t.Run(tt.name, func(t *testing.T) {
+			got, removed := Suppress("testdata", refs(), tt.suppressions)
+			assert.Equal(t, tt.removed, removed)
+			paths := []string{}
+			for _, ref := range got {
+				paths = append(paths, ref.Path)
+			}
+			assert.Equal(t, tt.paths, paths)
+		})
+	}
+}
+
+func TestReferencingLines(t *testing.T) {
+	refs := []ld.ReferenceHunksRep{{Path: "missing.js", Hunks: []ld.HunkRep{{StartingLineNumber: 3, FlagKey: "my-flag", Lines: "// context\nvariation('my-flag')\nmyAlias", Aliases: []string{"myAlias"}}}}}
+	assert.Equal(t, []ReferencingLine{
+		{Path: "missing.js", FlagKey: "my-flag", LineNumber: 4, Line: "variation('my-flag')"},
+		{Path: "missing.js", FlagKey: "my-flag", LineNumber: 5, Line: "myAlias"},
+	}, ReferencingLines("testdata", refs))
+}
@@ -0,0 +1,89 @@
+package search
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/tracing"
+)
+
+// directorySpans records a span for the search of each top-level directory of the workspace, from when the first file in
+// the directory is searched until the last file is searched. Files are searched concurrently, so the spans may overlap.
+type directorySpans struct {
+	parent *tracing.Span
+	mu     sync.Mutex
+	dirs   map[string]*directorySpan
+}
+
+type directorySpan struct {
+	span       *tracing.Span
+	files      int
+	references int
+	end        time.Time
+}
+
+// newDirectorySpans returns spans recorded as children of parent, or nil if parent is nil
+func newDirectorySpans(parent *tracing.Span) *directorySpans {
+	if parent == nil {
+		return nil
+	}
+	return &directorySpans{parent: parent, dirs: map[string]*directorySpan{}}
+}
+
+// start records that a file is being searched, starting the span of its directory if it is the first file
+func (d *directorySpans) start(path string) {
+	if d == nil {
+		return
+	}
+	dir := topLevelDir(path)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.dirs[dir]; !ok {
+		span := d.parent.StartChild("search "+dir, tracing.KindInternal)
+		span.SetAttribute("code.directory", dir)
+		d.dirs[dir] = &directorySpan{span: span}
+	}
+}
+
+// done records that a file with the given number of references has been searched
+func (d *directorySpans) done(path string, references int) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if ds, ok := d.dirs[topLevelDir(path)]; ok {
+		ds.files++
+		ds.references += references
+		ds.end = time.Now()
+	}
+}
+
+// end ends the span of each directory when its last file was searched
+func (d *directorySpans) end() {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, ds := range d.dirs {
+		ds.span.SetAttribute("files", ds.files)
+		ds.span.SetAttribute("references", ds.references)
+		if ds.end.IsZero() {
+			ds.span.End()
+		} else {
+			ds.span.EndAt(ds.end)
+		}
+	}
+}
+
+// topLevelDir returns the first directory of a path relative to the workspace, or "." for files in the workspace root
+func topLevelDir(path string) string {
+	path = filepath.ToSlash(path)
+	if i := strings.Index(path, "/"); i > 0 {
+		return path[:i]
+	}
+	return "."
+}
@@ -0,0 +1,21 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_topLevelDir(t *testing.T) {
+	assert.Equal(t, ".", topLevelDir("main.go"))
+	assert.Equal(t, "src", topLevelDir("src/main.go"))
+	assert.Equal(t, "src", topLevelDir("src/pkg/main.go"))
+}
+
+func Test_directorySpans_withoutTracing(t *testing.T) {
+	spans := newDirectorySpans(nil)
+	assert.Nil(t, spans)
+	spans.start("src/main.go")
+	spans.done("src/main.go", 1)
+	spans.end()
+}
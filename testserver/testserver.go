@@ -0,0 +1,467 @@
+// Package testserver emulates the LaunchDarkly API endpoints used by ld-find-code-refs with in-memory state, so the
+// scanner can be run end-to-end without sending data to LaunchDarkly. Request payloads are validated, and invalid
+// requests are rejected with the same status codes returned by LaunchDarkly.
+package testserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	jsonpatch "github.com/launchdarkly/json-patch"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+)
+
+const (
+	apiPath   = "/api/v2"
+	reposPath = apiPath + "/code-refs/repositories"
+	// StatePath returns the state of all repositories as JSON, for making assertions in CI
+	StatePath = "/_state"
+)
+
+var validRepoName = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+
+type Flag struct {
+	Key        string      `json:"key"`
+	Archived   bool        `json:"archived"`
+	Tags       []string    `json:"tags,omitempty"`
+	Maintainer *Maintainer `json:"_maintainer,omitempty"`
+}
+
+// Maintainer is the member maintaining a flag
+type Maintainer struct {
+	Email string `json:"email"`
+}
+
+type State struct {
+	Repositories map[string]*RepositoryState `json:"repositories"`
+}
+
+type RepositoryState struct {
+	ld.RepoRep
+	Branches        map[string]ld.BranchRep       `json:"branches"`
+	Extinctions     map[string][]ld.ExtinctionRep `json:"extinctions"`
+	DeletedBranches []string                      `json:"deletedBranches"`
+}
+
+// Server is an http.Handler emulating the LaunchDarkly API
+type Server struct {
+	// If set, requests must be authorized with this access token. Otherwise, any access token is accepted.
+	AccessToken string
+
+	mu       sync.Mutex
+	projects map[string][]Flag
+	state    State
+	// idempotencyKeys are the Idempotency-Key headers of branches which were stored
+	idempotencyKeys map[string]bool
+}
+
+func New(accessToken string) *Server {
+	return &Server{
+		AccessToken:     accessToken,
+		projects:        map[string][]Flag{},
+		state:           State{Repositories: map[string]*RepositoryState{}},
+		idempotencyKeys: map[string]bool{},
+	}
+}
+
+// AddProject adds a project containing the given flags
+func (s *Server) AddProject(projKey string, flags, archivedFlags []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range flags {
+		s.projects[projKey] = append(s.projects[projKey], Flag{Key: f})
+	}
+	for _, f := range archivedFlags {
+		s.projects[projKey] = append(s.projects[projKey], Flag{Key: f, Archived: true})
+	}
+	if s.projects[projKey] == nil {
+		s.projects[projKey] = []Flag{}
+	}
+}
+
+// SetFlagTags sets the tags of a flag added by AddProject
+func (s *Server) SetFlagTags(projKey, flagKey string, tags ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, f := range s.projects[projKey] {
+		if f.Key == flagKey {
+			s.projects[projKey][i].Tags = tags
+		}
+	}
+}
+
+// SetFlagMaintainer sets the email address of the maintainer of a flag added by AddProject
+func (s *Server) SetFlagMaintainer(projKey, flagKey, email string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, f := range s.projects[projKey] {
+		if f.Key == flagKey {
+			s.projects[projKey][i].Maintainer = &Maintainer{Email: email}
+		}
+	}
+}
+
+// Repository returns the state of a repository
+func (s *Server) Repository(name string) (RepositoryState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	repo, ok := s.state.Repositories[strings.ToLower(name)]
+	if !ok {
+		return RepositoryState{}, false
+	}
+	return *repo, true
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := r.URL.EscapedPath()
+	if path == StatePath {
+		writeJSON(w, http.StatusOK, s.state)
+		return
+	}
+
+	token := r.Header.Get("Authorization")
+	if token == "" || (s.AccessToken != "" && token != s.AccessToken) {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "invalid access token")
+		return
+	}
+
+	segments, err := splitPath(path)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	switch {
+	case len(segments) == 1 && segments[0] == "projects" && r.Method == http.MethodGet:
+		s.getProjects(w)
+	case len(segments) == 2 && segments[0] == "projects" && r.Method == http.MethodGet:
+		s.getProject(w, segments[1])
+	case len(segments) == 2 && segments[0] == "flags" && r.Method == http.MethodGet:
+		s.getFlags(w, r, segments[1])
+	case len(segments) >= 2 && segments[0] == "code-refs" && segments[1] == "repositories":
+		s.serveRepositories(w, r, segments[2:])
+	default:
+		writeError(w, http.StatusNotFound, "not_found", "unknown endpoint")
+	}
+}
+
+func (s *Server) serveRepositories(w http.ResponseWriter, r *http.Request, segments []string) {
+	switch {
+	case len(segments) == 0 && r.Method == http.MethodGet:
+		s.getRepositories(w)
+	case len(segments) == 0 && r.Method == http.MethodPost:
+		s.postRepository(w, r)
+	case len(segments) == 1 && r.Method == http.MethodGet:
+		s.withRepository(w, segments[0], func(repo *RepositoryState) {
+			writeJSON(w, http.StatusOK, repo.RepoRep)
+		})
+	case len(segments) == 1 && r.Method == http.MethodDelete:
+		s.withRepository(w, segments[0], func(repo *RepositoryState) {
+			delete(s.state.Repositories, strings.ToLower(repo.Name))
+			w.WriteHeader(http.StatusNoContent)
+		})
+	case len(segments) == 1 && r.Method == http.MethodPatch:
+		s.withRepository(w, segments[0], func(repo *RepositoryState) {
+			s.patchRepository(w, r, repo)
+		})
+	case len(segments) == 2 && segments[1] == "branches" && r.Method == http.MethodGet:
+		s.withRepository(w, segments[0], func(repo *RepositoryState) {
+			s.getBranches(w, repo)
+		})
+	case len(segments) == 3 && segments[1] == "branches" && r.Method == http.MethodGet:
+		s.withRepository(w, segments[0], func(repo *RepositoryState) {
+			s.getBranch(w, repo, segments[2])
+		})
+	case len(segments) == 3 && segments[1] == "branches" && r.Method == http.MethodPut:
+		s.withRepository(w, segments[0], func(repo *RepositoryState) {
+			s.putBranch(w, r, repo, segments[2])
+		})
+	case len(segments) == 4 && segments[1] == "branches" && segments[3] == "extinction-events" && r.Method == http.MethodPost:
+		s.withRepository(w, segments[0], func(repo *RepositoryState) {
+			s.postExtinctions(w, r, repo, segments[2])
+		})
+	case len(segments) == 2 && segments[1] == "branch-delete-tasks" && r.Method == http.MethodPost:
+		s.withRepository(w, segments[0], func(repo *RepositoryState) {
+			s.postDeleteBranchesTask(w, r, repo)
+		})
+	default:
+		writeError(w, http.StatusNotFound, "not_found", "unknown endpoint")
+	}
+}
+
+func (s *Server) getProjects(w http.ResponseWriter) {
+	items := make([]map[string]string, 0, len(s.projects))
+	for projKey := range s.projects {
+		items = append(items, map[string]string{"key": projKey, "name": projKey})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i]["key"] < items[j]["key"] })
+	writeJSON(w, http.StatusOK, map[string]interface{}{"items": items})
+}
+
+func (s *Server) getProject(w http.ResponseWriter, projKey string) {
+	if _, ok := s.projects[projKey]; !ok {
+		writeError(w, http.StatusNotFound, "not_found", "project not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"key": projKey, "name": projKey})
+}
+
+func (s *Server) getFlags(w http.ResponseWriter, r *http.Request, projKey string) {
+	flags, ok := s.projects[projKey]
+	if !ok {
+		writeError(w, http.StatusNotFound, "not_found", "project not found")
+		return
+	}
+	query := r.URL.Query()
+	archived := query.Get("archived") == "true"
+	items := []Flag{}
+	for _, f := range flags {
+		if f.Archived == archived {
+			items = append(items, f)
+		}
+	}
+	total := len(items)
+	if offset, err := strconv.Atoi(query.Get("offset")); err == nil && offset > 0 {
+		if offset > len(items) {
+			offset = len(items)
+		}
+		items = items[offset:]
+	}
+	if limit, err := strconv.Atoi(query.Get("limit")); err == nil && limit >= 0 && limit < len(items) {
+		items = items[:limit]
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"items": items, "totalCount": total, "_links": map[string]interface{}{}})
+}
+
+func (s *Server) getRepositories(w http.ResponseWriter) {
+	items := make([]ld.RepoRep, 0, len(s.state.Repositories))
+	for _, repo := range s.state.Repositories {
+		items = append(items, repo.RepoRep)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+	writeJSON(w, http.StatusOK, map[string]interface{}{"items": items})
+}
+
+func (s *Server) postRepository(w http.ResponseWriter, r *http.Request) {
+	var params ld.RepoParams
+	if !readJSON(w, r, &params) {
+		return
+	}
+	if !validRepoName.MatchString(params.Name) {
+		writeError(w, http.StatusBadRequest, "invalid_request", fmt.Sprintf("invalid repository name %q", params.Name))
+		return
+	}
+	switch params.Type {
+	case "custom", "github", "bitbucket":
+	default:
+		writeError(w, http.StatusBadRequest, "invalid_request", fmt.Sprintf("invalid repository type %q", params.Type))
+		return
+	}
+	key := strings.ToLower(params.Name)
+	if _, ok := s.state.Repositories[key]; ok {
+		writeError(w, http.StatusConflict, "conflict", "repository already exists")
+		return
+	}
+	repo := &RepositoryState{
+		RepoRep: ld.RepoRep{
+			Type:              params.Type,
+			Name:              params.Name,
+			Url:               params.Url,
+			CommitUrlTemplate: params.CommitUrlTemplate,
+			HunkUrlTemplate:   params.HunkUrlTemplate,
+			DefaultBranch:     params.DefaultBranch,
+			Description:       params.Description,
+			Tags:              params.Tags,
+			Enabled:           params.Enabled == nil || *params.Enabled,
+		},
+		Branches:    map[string]ld.BranchRep{},
+		Extinctions: map[string][]ld.ExtinctionRep{},
+	}
+	s.state.Repositories[key] = repo
+	writeJSON(w, http.StatusCreated, repo.RepoRep)
+}
+
+func (s *Server) patchRepository(w http.ResponseWriter, r *http.Request, repo *RepositoryState) {
+	patch, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	doc, err := json.Marshal(repo.RepoRep)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+	patched, err := jsonpatch.MergePatch(doc, patch)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", fmt.Sprintf("invalid merge patch: %s", err))
+		return
+	}
+	var updated ld.RepoRep
+	err = json.Unmarshal(patched, &updated)
+	if err != nil || !strings.EqualFold(updated.Name, repo.Name) {
+		writeError(w, http.StatusBadRequest, "invalid_request", "repository name cannot be changed")
+		return
+	}
+	repo.RepoRep = updated
+	writeJSON(w, http.StatusOK, repo.RepoRep)
+}
+
+func (s *Server) getBranches(w http.ResponseWriter, repo *RepositoryState) {
+	items := make([]ld.BranchRep, 0, len(repo.Branches))
+	for _, b := range repo.Branches {
+		// References are not included when listing branches
+		b.References = nil
+		items = append(items, b)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+	writeJSON(w, http.StatusOK, ld.BranchCollection{Items: items})
+}
+
+func (s *Server) getBranch(w http.ResponseWriter, repo *RepositoryState, branchName string) {
+	branch, ok := repo.Branches[branchName]
+	if !ok {
+		writeError(w, http.StatusNotFound, "not_found", "branch not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, branch)
+}
+
+func (s *Server) putBranch(w http.ResponseWriter, r *http.Request, repo *RepositoryState, branchName string) {
+	if !repo.Enabled {
+		writeError(w, http.StatusMethodNotAllowed, "repository_disabled", "repository is disabled")
+		return
+	}
+	key := r.Header.Get("Idempotency-Key")
+	if key != "" && s.idempotencyKeys[key] {
+		// a retry of a request which was already applied
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	var branch ld.BranchRep
+	if !readJSON(w, r, &branch) {
+		return
+	}
+	err := validateBranch(branch, branchName)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if existing, ok := repo.Branches[branchName]; ok && branch.UpdateSequenceId != nil && existing.UpdateSequenceId != nil &&
+		*branch.UpdateSequenceId <= *existing.UpdateSequenceId {
+		writeError(w, http.StatusConflict, "updateSequenceId_conflict", "updateSequenceId must be greater than the existing updateSequenceId")
+		return
+	}
+	repo.Branches[branchName] = branch
+	if key != "" {
+		s.idempotencyKeys[key] = true
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func validateBranch(branch ld.BranchRep, branchName string) error {
+	if branch.Name != branchName {
+		return fmt.Errorf("branch name %q does not match path %q", branch.Name, branchName)
+	}
+	if branch.Head == "" {
+		return fmt.Errorf("branch head is required")
+	}
+	for _, ref := range branch.References {
+		if ref.Path == "" {
+			return fmt.Errorf("reference path is required")
+		}
+		for _, hunk := range ref.Hunks {
+			if hunk.FlagKey == "" || hunk.ProjKey == "" {
+				return fmt.Errorf("hunks in %q must provide a flagKey and projKey", ref.Path)
+			}
+			if hunk.StartingLineNumber < 1 {
+				return fmt.Errorf("hunks in %q must have a startingLineNumber >= 1", ref.Path)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Server) postExtinctions(w http.ResponseWriter, r *http.Request, repo *RepositoryState, branchName string) {
+	var extinctions []ld.ExtinctionRep
+	if !readJSON(w, r, &extinctions) {
+		return
+	}
+	for _, e := range extinctions {
+		if e.Revision == "" || e.FlagKey == "" || e.ProjKey == "" {
+			writeError(w, http.StatusBadRequest, "invalid_request", "extinctions must provide a revision, flagKey, and projKey")
+			return
+		}
+	}
+	repo.Extinctions[branchName] = append(repo.Extinctions[branchName], extinctions...)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) postDeleteBranchesTask(w http.ResponseWriter, r *http.Request, repo *RepositoryState) {
+	var branches []string
+	if !readJSON(w, r, &branches) {
+		return
+	}
+	for _, b := range branches {
+		delete(repo.Branches, b)
+		delete(repo.Extinctions, b)
+		repo.DeletedBranches = append(repo.DeletedBranches, b)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) withRepository(w http.ResponseWriter, name string, f func(repo *RepositoryState)) {
+	repo, ok := s.state.Repositories[strings.ToLower(name)]
+	if !ok {
+		writeError(w, http.StatusNotFound, "not_found", "repository not found")
+		return
+	}
+	f(repo)
+}
+
+// splitPath returns the unescaped segments of an API path, relative to the API version prefix
+func splitPath(path string) ([]string, error) {
+	if !strings.HasPrefix(path, apiPath+"/") {
+		return nil, nil
+	}
+	segments := strings.Split(strings.TrimPrefix(path, apiPath+"/"), "/")
+	for i, s := range segments {
+		unescaped, err := url.PathUnescape(s)
+		if err != nil {
+			return nil, err
+		}
+		segments[i] = unescaped
+	}
+	return segments, nil
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", fmt.Sprintf("invalid request body: %s", err))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]string{"code": code, "message": message})
+}
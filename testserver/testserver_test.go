@@ -0,0 +1,194 @@
+package testserver
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/launchdarkly/ld-find-code-refs/internal/ld"
+	"github.com/launchdarkly/ld-find-code-refs/internal/log"
+)
+
+func TestMain(m *testing.M) {
+	log.Init(true)
+	os.Exit(m.Run())
+}
+
+func TestServer(t *testing.T) {
+	server := New("api-x")
+	server.AddProject("default", []string{"flag1", "flag2"}, []string{"archived1"})
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	retryMax := 0
+	client := ld.InitApiClient(ld.ApiOptions{ApiKey: "api-x", ProjKey: "default", BaseUri: httpServer.URL, RetryMax: &retryMax})
+
+	require.NoError(t, client.PreflightCheck("test-repo"))
+
+	flags, err := client.GetFlagKeyList()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"flag1", "flag2", "archived1"}, flags)
+
+	repo := ld.RepoParams{Type: "github", Name: "test-repo", DefaultBranch: "master"}
+	require.NoError(t, client.MaybeUpsertCodeReferenceRepository(repo))
+	require.NoError(t, client.PreflightCheck("test-repo"))
+	repo.DefaultBranch = "main"
+	require.NoError(t, client.MaybeUpsertCodeReferenceRepository(repo))
+
+	seq := 1
+	branch := ld.BranchRep{
+		Name:             "feature/x",
+		Head:             "abc123",
+		UpdateSequenceId: &seq,
+		References:       []ld.ReferenceHunksRep{{Path: "main.go", Hunks: []ld.HunkRep{{StartingLineNumber: 1, ProjKey: "default", FlagKey: "flag1"}}}},
+	}
+	require.NoError(t, client.PutCodeReferenceBranch(branch, repo.Name))
+	// a retry of a request which was applied is not applied again
+	require.NoError(t, client.PutCodeReferenceBranch(branch, repo.Name))
+	branch.SyncTime = 1
+	assert.Equal(t, ld.BranchUpdateSequenceIdConflictErr, client.PutCodeReferenceBranch(branch, repo.Name))
+	require.NoError(t, client.PutCodeReferenceBranch(ld.BranchRep{Name: "master", Head: "def456"}, repo.Name))
+
+	invalid := ld.BranchRep{Name: "invalid", Head: "abc123", References: []ld.ReferenceHunksRep{{Path: "main.go", Hunks: []ld.HunkRep{{FlagKey: "flag1"}}}}}
+	assert.Error(t, client.PutCodeReferenceBranch(invalid, repo.Name))
+
+	require.NoError(t, client.PostExtinctionEvents([]ld.ExtinctionRep{{Revision: "abc123", ProjKey: "default", FlagKey: "flag2"}}, repo.Name, "feature/x"))
+
+	branches, err := client.GetCodeReferenceRepositoryBranches(repo.Name)
+	require.NoError(t, err)
+	require.Len(t, branches, 2)
+
+	stored, err := client.GetCodeReferenceBranch(repo.Name, "feature/x")
+	require.NoError(t, err)
+	assert.Equal(t, branch.References, stored.References)
+	_, err = client.GetCodeReferenceBranch(repo.Name, "missing")
+	assert.Equal(t, ld.NotFoundErr, err)
+
+	require.NoError(t, client.PostDeleteBranchesTask(repo.Name, []string{"master"}))
+
+	state, ok := server.Repository("test-repo")
+	require.True(t, ok)
+	assert.Equal(t, "main", state.DefaultBranch)
+	assert.Len(t, state.Branches, 1)
+	assert.Len(t, state.Branches["feature/x"].References, 1)
+	assert.Len(t, state.Extinctions["feature/x"], 1)
+	assert.Equal(t, []string{"master"}, state.DeletedBranches)
+
+	require.NoError(t, client.DeleteCodeReferenceRepository(repo.Name))
+	_, ok = server.Repository("test-repo")
+	assert.False(t, ok)
+	assert.Equal(t, ld.NotFoundErr, client.DeleteCodeReferenceRepository(repo.Name))
+}
+
+func TestServer_repoMetadata(t *testing.T) {
+	server := New("")
+	server.AddProject("default", nil, nil)
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	retryMax := 0
+	client := ld.InitApiClient(ld.ApiOptions{ApiKey: "api-x", ProjKey: "default", BaseUri: httpServer.URL, RetryMax: &retryMax})
+
+	repo := ld.RepoParams{Type: "github", Name: "test-repo", DefaultBranch: "main", Description: "Checkout service", Tags: []string{"payments"}}
+	require.NoError(t, client.MaybeUpsertCodeReferenceRepository(repo))
+	state, _ := server.Repository("test-repo")
+	assert.Equal(t, "Checkout service", state.Description)
+	assert.Equal(t, []string{"payments"}, state.Tags)
+	assert.True(t, state.Enabled)
+
+	// unset metadata is left unchanged
+	repo.Description = ""
+	repo.Tags = nil
+	require.NoError(t, client.MaybeUpsertCodeReferenceRepository(repo))
+	state, _ = server.Repository("test-repo")
+	assert.Equal(t, "Checkout service", state.Description)
+	assert.Equal(t, []string{"payments"}, state.Tags)
+
+	disabled, enabled := false, true
+	repo.Enabled = &disabled
+	assert.Equal(t, ld.RepositoryDisabledErr, client.MaybeUpsertCodeReferenceRepository(repo))
+	state, _ = server.Repository("test-repo")
+	assert.False(t, state.Enabled)
+
+	// disabled repositories are not enabled unless configured
+	repo.Enabled = nil
+	assert.Equal(t, ld.RepositoryDisabledErr, client.MaybeUpsertCodeReferenceRepository(repo))
+	repo.Enabled = &enabled
+	require.NoError(t, client.MaybeUpsertCodeReferenceRepository(repo))
+	state, _ = server.Repository("test-repo")
+	assert.True(t, state.Enabled)
+}
+
+func TestServer_unauthorized(t *testing.T) {
+	server := New("api-x")
+	server.AddProject("default", nil, nil)
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	retryMax := 0
+	client := ld.InitApiClient(ld.ApiOptions{ApiKey: "api-y", ProjKey: "default", BaseUri: httpServer.URL, RetryMax: &retryMax})
+	assert.Equal(t, ld.UnauthorizedErr, client.PreflightCheck("test-repo"))
+}
+
+func TestServer_paginatedFlags(t *testing.T) {
+	flags := make([]string, 0, 250)
+	for i := 0; i < 250; i++ {
+		flags = append(flags, fmt.Sprintf("flag%d", i))
+	}
+	server := New("api-x")
+	server.AddProject("default", flags, []string{"archived1", "archived2"})
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	client := ld.InitApiClient(ld.ApiOptions{ApiKey: "api-x", ProjKey: "default", BaseUri: httpServer.URL})
+	keys, err := client.GetFlagKeyList()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, append(flags, "archived1", "archived2"), keys)
+
+	client = ld.InitApiClient(ld.ApiOptions{ApiKey: "api-x", ProjKey: "default", BaseUri: httpServer.URL, MaxFlags: 120})
+	keys, err = client.GetFlagKeyList()
+	require.NoError(t, err)
+	assert.Equal(t, flags[:120], keys)
+
+	client = ld.InitApiClient(ld.ApiOptions{ApiKey: "api-x", ProjKey: "default", BaseUri: httpServer.URL, MaxFlags: 251})
+	keys, err = client.GetFlagKeyList()
+	require.NoError(t, err)
+	assert.Equal(t, append(flags, "archived1"), keys)
+}
+
+func TestServer_flagTags(t *testing.T) {
+	server := New("api-x")
+	server.AddProject("default", []string{"new-checkout", "dark-mode"}, []string{"old-checkout"})
+	server.SetFlagTags("default", "new-checkout", "checkout", "web")
+	server.SetFlagTags("default", "old-checkout", "checkout")
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	client := ld.InitApiClient(ld.ApiOptions{ApiKey: "api-x", ProjKey: "default", BaseUri: httpServer.URL})
+	tags, err := client.GetFlagTags()
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"new-checkout": {"checkout", "web"}, "old-checkout": {"checkout"}}, tags)
+}
+
+func TestServer_flagMetadata(t *testing.T) {
+	server := New("api-x")
+	server.AddProject("default", []string{"new-checkout", "dark-mode"}, []string{"old-checkout"})
+	server.SetFlagTags("default", "new-checkout", "checkout", "web")
+	server.SetFlagMaintainer("default", "new-checkout", "payments@example.com")
+	server.SetFlagMaintainer("default", "old-checkout", "legacy@example.com")
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	client := ld.InitApiClient(ld.ApiOptions{ApiKey: "api-x", ProjKey: "default", BaseUri: httpServer.URL})
+	metadata, err := client.GetFlagMetadata()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]ld.FlagMetadata{
+		"new-checkout": {Tags: []string{"checkout", "web"}, Maintainer: "payments@example.com"},
+		"dark-mode":    {Tags: []string{}},
+		"old-checkout": {Tags: []string{}, Maintainer: "legacy@example.com"},
+	}, metadata)
+}